@@ -0,0 +1,118 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ofkm/arcane-backend/internal/middleware"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/services"
+	"github.com/ofkm/arcane-backend/internal/utils/pagination"
+)
+
+const maxAggregateTimeout = 60 * time.Second
+
+// AggregateHandler serves listings merged across every environment the caller can access.
+type AggregateHandler struct {
+	aggregateService *services.AggregateService
+}
+
+func NewAggregateHandler(group *gin.RouterGroup, aggregateService *services.AggregateService, authMiddleware *middleware.AuthMiddleware) {
+	handler := &AggregateHandler{aggregateService: aggregateService}
+
+	apiGroup := group.Group("/aggregate")
+	{
+		apiGroup.GET("/containers", authMiddleware.WithPermissions(models.PermissionContainersRead).Add(), handler.ListContainers)
+		apiGroup.GET("/images", authMiddleware.WithPermissions(models.PermissionImagesRead).Add(), handler.ListImages)
+		apiGroup.GET("/projects", authMiddleware.WithPermissions(models.PermissionProjectsRead).Add(), handler.ListProjects)
+	}
+}
+
+func (h *AggregateHandler) ListContainers(c *gin.Context) {
+	caller, params, opts, ok := aggregateRequest(c)
+	if !ok {
+		return
+	}
+	result, err := h.aggregateService.ListContainers(c.Request.Context(), caller, params, opts)
+	respondAggregate(c, "containers", result, err)
+}
+
+func (h *AggregateHandler) ListImages(c *gin.Context) {
+	caller, params, opts, ok := aggregateRequest(c)
+	if !ok {
+		return
+	}
+	result, err := h.aggregateService.ListImages(c.Request.Context(), caller, params, opts)
+	respondAggregate(c, "images", result, err)
+}
+
+func (h *AggregateHandler) ListProjects(c *gin.Context) {
+	caller, params, opts, ok := aggregateRequest(c)
+	if !ok {
+		return
+	}
+	result, err := h.aggregateService.ListProjects(c.Request.Context(), caller, params, opts)
+	respondAggregate(c, "projects", result, err)
+}
+
+// aggregateRequest reads the usual list parameters plus environmentId, a comma-separated list of
+// environments to include, group and tag, which select environments like the environment list
+// does, and timeout, the seconds to wait for each environment.
+func aggregateRequest(c *gin.Context) (services.AggregateCaller, pagination.QueryParams, services.AggregateOptions, bool) {
+	user, _ := middleware.GetCurrentUser(c)
+	caller := services.AggregateCaller{User: user, Permissions: middleware.GetCurrentUserPermissions(c)}
+
+	params := pagination.ExtractListModifiersQueryParams(c)
+	var opts services.AggregateOptions
+	if ids := params.Filters["environmentId"]; ids != "" {
+		for _, id := range strings.Split(ids, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				opts.EnvironmentIDs = append(opts.EnvironmentIDs, id)
+			}
+		}
+	}
+	opts.Group = params.Filters["group"]
+	for _, tag := range strings.Split(params.Filters["tag"], ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			opts.Tags = append(opts.Tags, tag)
+		}
+	}
+	if raw := params.Filters["timeout"]; raw != "" {
+		seconds, err := strconv.Atoi(raw)
+		if err != nil || seconds <= 0 || time.Duration(seconds)*time.Second > maxAggregateTimeout {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"data":    gin.H{"error": "timeout must be between 1 and 60 seconds"},
+			})
+			return caller, params, opts, false
+		}
+		opts.Timeout = time.Duration(seconds) * time.Second
+	}
+	for _, key := range []string{"environmentId", "group", "tag", "timeout"} {
+		delete(params.Filters, key)
+	}
+
+	return caller, params, opts, true
+}
+
+func respondAggregate[T any](c *gin.Context, resource string, result *services.AggregateResult[T], err error) {
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"data":    gin.H{"error": "Failed to list " + resource + ": " + err.Error()},
+		})
+		return
+	}
+
+	c.Header("X-Arcane-Total-Items", strconv.FormatInt(result.Pagination.TotalItems, 10))
+	c.Header("X-Arcane-Total-Available", strconv.FormatInt(result.Pagination.GrandTotalItems, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"success":    true,
+		"data":       result.Items,
+		"pagination": result.Pagination,
+		"failures":   result.Failures,
+	})
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ofkm/arcane-backend/internal/dto"
+	"github.com/ofkm/arcane-backend/internal/middleware"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/services"
+)
+
+type ApiTokenHandler struct {
+	apiTokenService *services.ApiTokenService
+	auditService    *services.AuditService
+}
+
+func NewApiTokenHandler(group *gin.RouterGroup, apiTokenService *services.ApiTokenService, auditService *services.AuditService, authMiddleware *middleware.AuthMiddleware) {
+	handler := &ApiTokenHandler{apiTokenService: apiTokenService, auditService: auditService}
+
+	apiGroup := group.Group("/users/me/tokens")
+	apiGroup.Use(authMiddleware.Add())
+	{
+		apiGroup.GET("", handler.ListTokens)
+		apiGroup.POST("", handler.CreateToken)
+		apiGroup.DELETE("/:tokenId", handler.RevokeToken)
+	}
+}
+
+func (h *ApiTokenHandler) ListTokens(c *gin.Context) {
+	userID, _ := middleware.GetCurrentUserID(c)
+
+	tokens, err := h.apiTokenService.ListTokens(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"data":    gin.H{"error": "Failed to list API tokens"},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    tokens,
+	})
+}
+
+func (h *ApiTokenHandler) CreateToken(c *gin.Context) {
+	// Tokens can only be minted from a login session, otherwise a narrowly scoped token could
+	// be used to create a broader one.
+	if middleware.IsApiTokenRequest(c) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"data":    gin.H{"error": "API tokens cannot create other API tokens"},
+		})
+		return
+	}
+
+	var req dto.CreateApiTokenDto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"data":    gin.H{"error": "Invalid request format"},
+		})
+		return
+	}
+
+	userID, _ := middleware.GetCurrentUserID(c)
+	token, err := h.apiTokenService.CreateToken(c.Request.Context(), userID, req)
+	if err != nil {
+		var validationErr *models.ValidationError
+		if errors.As(err, &validationErr) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"data":    gin.H{"error": validationErr.Error()},
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"data":    gin.H{"error": "Failed to create API token"},
+		})
+		return
+	}
+
+	recordAudit(c, h.auditService, services.AuditRecord{
+		Action:       "api_token.create",
+		ResourceType: "api_token",
+		ResourceID:   token.ID,
+		ResourceName: token.Name,
+		Metadata:     models.JSON{"scopes": token.Scopes, "expiresAt": token.ExpiresAt},
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    token,
+	})
+}
+
+func (h *ApiTokenHandler) RevokeToken(c *gin.Context) {
+	userID, _ := middleware.GetCurrentUserID(c)
+	tokenID := c.Param("tokenId")
+
+	if err := h.apiTokenService.RevokeToken(c.Request.Context(), userID, tokenID); err != nil {
+		if errors.Is(err, services.ErrApiTokenNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"data":    gin.H{"error": "API token not found"},
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"data":    gin.H{"error": "Failed to revoke API token"},
+		})
+		return
+	}
+
+	recordAudit(c, h.auditService, services.AuditRecord{
+		Action:       "api_token.revoke",
+		ResourceType: "api_token",
+		ResourceID:   tokenID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    gin.H{"message": "API token revoked successfully"},
+	})
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ofkm/arcane-backend/internal/middleware"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/services"
+	"github.com/ofkm/arcane-backend/internal/utils/pagination"
+)
+
+type AuditHandler struct {
+	auditService *services.AuditService
+}
+
+func NewAuditHandler(group *gin.RouterGroup, auditService *services.AuditService, authMiddleware *middleware.AuthMiddleware) {
+	handler := &AuditHandler{auditService: auditService}
+
+	// The trail is read-only through the API; there are deliberately no write or delete routes.
+	apiGroup := group.Group("/audit")
+	readAuth := authMiddleware.WithPermissions(models.PermissionAuditRead).Add()
+	{
+		apiGroup.GET("", readAuth, handler.ListEntries)
+		apiGroup.GET("/verify", readAuth, handler.Verify)
+		apiGroup.GET("/export", readAuth, handler.Export)
+	}
+}
+
+func (h *AuditHandler) ListEntries(c *gin.Context) {
+	params := pagination.ExtractListModifiersQueryParams(c)
+
+	entries, paginationResp, err := h.auditService.ListEntriesPaginated(c.Request.Context(), params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"data":    gin.H{"error": "Failed to list audit entries: " + err.Error()},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":    true,
+		"data":       entries,
+		"pagination": paginationResp,
+	})
+}
+
+func (h *AuditHandler) Verify(c *gin.Context) {
+	result, err := h.auditService.Verify(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"data":    gin.H{"error": "Failed to verify audit log: " + err.Error()},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// Export streams the whole trail. format is "jsonl" (default) or "csv".
+func (h *AuditHandler) Export(c *gin.Context) {
+	format := c.DefaultQuery("format", services.AuditExportJSONL)
+	var contentType string
+	switch format {
+	case services.AuditExportJSONL:
+		contentType = "application/x-ndjson"
+	case services.AuditExportCSV:
+		contentType = "text/csv; charset=utf-8"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"data":    gin.H{"error": "Format must be jsonl or csv"},
+		})
+		return
+	}
+
+	filename := fmt.Sprintf("arcane-audit-%s.%s", time.Now().UTC().Format("20060102-150405"), format)
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	// The status is already sent, so a failure part way through can only truncate the file.
+	if err := h.auditService.Export(c.Request.Context(), c.Writer, format); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to export audit log", "format", format, "error", err)
+	}
+}
+
+// recordAudit appends an entry attributed to the authenticated caller. The action has already
+// happened at this point, so a failure is logged instead of failing the request.
+func recordAudit(c *gin.Context, auditService *services.AuditService, rec services.AuditRecord) {
+	if auditService == nil {
+		return
+	}
+	if user, ok := middleware.GetCurrentUser(c); ok {
+		rec.ActorID = user.ID
+		rec.ActorUsername = user.Username
+	}
+	// The entry must be written even when the client has already gone away.
+	ctx := context.WithoutCancel(c.Request.Context())
+	if _, err := auditService.Record(ctx, rec); err != nil {
+		slog.ErrorContext(ctx, "Failed to record audit entry", "action", rec.Action, "error", err)
+	}
+}
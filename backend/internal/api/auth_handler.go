@@ -1,33 +1,65 @@
 package api
 
 import (
+	"context"
 	"errors"
+	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/ofkm/arcane-backend/internal/dto"
 	"github.com/ofkm/arcane-backend/internal/middleware"
+	"github.com/ofkm/arcane-backend/internal/models"
 	"github.com/ofkm/arcane-backend/internal/services"
 	"github.com/ofkm/arcane-backend/internal/utils/cookie"
 )
 
 type AuthHandler struct {
-	userService *services.UserService
-	authService *services.AuthService
-	oidcService *services.OidcService
+	userService      *services.UserService
+	authService      *services.AuthService
+	oidcService      *services.OidcService
+	twoFactorService *services.TwoFactorService
+	webauthnService  *services.WebauthnService
+	sessionService   *services.SessionService
+	auditService     *services.AuditService
 }
 
-func NewAuthHandler(group *gin.RouterGroup, userService *services.UserService, authService *services.AuthService, oidcService *services.OidcService, authMiddleware *middleware.AuthMiddleware) {
-	ah := &AuthHandler{userService: userService, authService: authService, oidcService: oidcService}
+func NewAuthHandler(group *gin.RouterGroup, userService *services.UserService, authService *services.AuthService, oidcService *services.OidcService, twoFactorService *services.TwoFactorService, webauthnService *services.WebauthnService, sessionService *services.SessionService, auditService *services.AuditService, authMiddleware *middleware.AuthMiddleware) {
+	ah := &AuthHandler{userService: userService, authService: authService, oidcService: oidcService, twoFactorService: twoFactorService, webauthnService: webauthnService, sessionService: sessionService, auditService: auditService}
 
 	authApiGroup := group.Group("/auth")
 	{
 		authApiGroup.POST("/login", ah.Login)
-		authApiGroup.POST("/logout", ah.Logout)
-		authApiGroup.GET("/me", authMiddleware.WithAdminNotRequired().Add(), ah.GetCurrentUser)
+		authApiGroup.POST("/ldap/login", ah.LoginLdap)
+		authApiGroup.POST("/login/2fa", ah.LoginTwoFactor)
+		authApiGroup.POST("/login/2fa/enroll", ah.LoginTwoFactorEnroll)
+		authApiGroup.POST("/login/2fa/enroll/confirm", ah.LoginTwoFactorEnrollConfirm)
+		authApiGroup.POST("/login/2fa/webauthn/begin", ah.LoginWebauthnTwoFactorBegin)
+		authApiGroup.POST("/login/2fa/webauthn", ah.LoginWebauthnTwoFactor)
+		authApiGroup.POST("/webauthn/login/begin", ah.WebauthnLoginBegin)
+		authApiGroup.POST("/webauthn/login", ah.WebauthnLogin)
+		authApiGroup.POST("/logout", authMiddleware.WithSuccessOptional().Add(), ah.Logout)
+		authApiGroup.GET("/me", authMiddleware.Add(), ah.GetCurrentUser)
 		authApiGroup.POST("/refresh", ah.RefreshToken)
-		authApiGroup.POST("/password", authMiddleware.WithAdminNotRequired().Add(), ah.ChangePassword)
+		authApiGroup.POST("/password", authMiddleware.Add(), ah.ChangePassword)
+
+		authApiGroup.GET("/2fa", authMiddleware.Add(), ah.GetTwoFactorStatus)
+		authApiGroup.POST("/2fa/enroll", authMiddleware.Add(), ah.EnrollTwoFactor)
+		authApiGroup.POST("/2fa/confirm", authMiddleware.Add(), ah.ConfirmTwoFactor)
+		authApiGroup.POST("/2fa/disable", authMiddleware.Add(), ah.DisableTwoFactor)
+		authApiGroup.POST("/2fa/recovery-codes", authMiddleware.Add(), ah.RegenerateRecoveryCodes)
+
+		authApiGroup.GET("/sessions", authMiddleware.Add(), ah.ListSessions)
+		authApiGroup.DELETE("/sessions", authMiddleware.Add(), ah.RevokeOtherSessions)
+		authApiGroup.DELETE("/sessions/:sessionId", authMiddleware.Add(), ah.RevokeSession)
+
+		authApiGroup.GET("/webauthn/credentials", authMiddleware.Add(), ah.ListWebauthnCredentials)
+		authApiGroup.POST("/webauthn/register/begin", authMiddleware.Add(), ah.BeginWebauthnRegistration)
+		authApiGroup.POST("/webauthn/register", authMiddleware.Add(), ah.FinishWebauthnRegistration)
+		authApiGroup.DELETE("/webauthn/credentials/:credentialId", authMiddleware.Add(), ah.DeleteWebauthnCredential)
 	}
 }
 
@@ -48,7 +80,41 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	user, tokenPair, err := h.authService.Login(c.Request.Context(), req.Username, req.Password)
+	user, tokenPair, err := h.authService.Login(clientContext(c), req.Username, req.Password)
+	h.writePasswordLoginResult(c, user, tokenPair, err)
+}
+
+// LoginLdap signs in with directory credentials; the response matches Login.
+func (h *AuthHandler) LoginLdap(c *gin.Context) {
+	var req dto.LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "data": gin.H{"error": "Invalid request format"}})
+		return
+	}
+
+	user, tokenPair, err := h.authService.LdapLogin(clientContext(c), req.Username, req.Password)
+	h.writePasswordLoginResult(c, user, tokenPair, err)
+}
+
+// writePasswordLoginResult responds to a username/password login with tokens, a 2FA challenge or
+// an error.
+func (h *AuthHandler) writePasswordLoginResult(c *gin.Context, user *models.User, tokenPair *services.TokenPair, err error) {
+	var challenge *services.TwoFactorChallenge
+	if errors.As(err, &challenge) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data": gin.H{
+				"requiresTwoFactor":  true,
+				"enrollmentRequired": challenge.EnrollmentRequired,
+				"challengeToken":     challenge.Token,
+				"methods":            challenge.Methods,
+			},
+		})
+		return
+	}
+	if writeLoginLockoutError(c, err) {
+		return
+	}
 	if err != nil {
 		var statusCode int
 		var errorMsg string
@@ -59,6 +125,12 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		case errors.Is(err, services.ErrLocalAuthDisabled):
 			statusCode = http.StatusBadRequest
 			errorMsg = "Local authentication is disabled"
+		case errors.Is(err, services.ErrLdapAuthDisabled):
+			statusCode = http.StatusBadRequest
+			errorMsg = "LDAP authentication is disabled"
+		case errors.Is(err, services.ErrUsernameTaken):
+			statusCode = http.StatusConflict
+			errorMsg = "An account with this username already exists"
 		default:
 			statusCode = http.StatusInternalServerError
 			errorMsg = "Authentication failed"
@@ -67,6 +139,12 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
+	h.writeLoginResponse(c, user, tokenPair, nil)
+}
+
+// writeLoginResponse sets the session cookie and returns the token pair. recoveryCodes is only
+// set when the login also completed 2FA enrollment.
+func (h *AuthHandler) writeLoginResponse(c *gin.Context, user *models.User, tokenPair *services.TokenPair, recoveryCodes []string) {
 	c.SetSameSite(http.SameSiteLaxMode)
 	maxAge := int(time.Until(tokenPair.ExpiresAt).Seconds())
 	if maxAge < 0 {
@@ -82,21 +160,455 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"data": gin.H{
-			"token":        tokenPair.AccessToken,
-			"refreshToken": tokenPair.RefreshToken,
-			"expiresAt":    tokenPair.ExpiresAt,
-			"user":         out,
-		},
+	data := gin.H{
+		"token":        tokenPair.AccessToken,
+		"refreshToken": tokenPair.RefreshToken,
+		"expiresAt":    tokenPair.ExpiresAt,
+		"user":         out,
+	}
+	if recoveryCodes != nil {
+		data["recoveryCodes"] = recoveryCodes
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+func (h *AuthHandler) LoginTwoFactor(c *gin.Context) {
+	var req dto.TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "data": gin.H{"error": "Invalid request format"}})
+		return
+	}
+
+	user, tokenPair, err := h.authService.CompleteTwoFactorLogin(clientContext(c), req.ChallengeToken, req.Code)
+	if err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+
+	h.writeLoginResponse(c, user, tokenPair, nil)
+}
+
+func (h *AuthHandler) LoginTwoFactorEnroll(c *gin.Context) {
+	var req dto.TwoFactorChallengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "data": gin.H{"error": "Invalid request format"}})
+		return
+	}
+
+	enrollment, err := h.authService.BeginTwoFactorEnrollmentForLogin(c.Request.Context(), req.ChallengeToken)
+	if err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": enrollment})
+}
+
+func (h *AuthHandler) LoginTwoFactorEnrollConfirm(c *gin.Context) {
+	var req dto.TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "data": gin.H{"error": "Invalid request format"}})
+		return
+	}
+
+	user, tokenPair, recoveryCodes, err := h.authService.ConfirmTwoFactorEnrollmentForLogin(clientContext(c), req.ChallengeToken, req.Code)
+	if err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+
+	h.writeLoginResponse(c, user, tokenPair, recoveryCodes)
+}
+
+func (h *AuthHandler) GetTwoFactorStatus(c *gin.Context) {
+	userID, _ := middleware.GetCurrentUserID(c)
+
+	status, err := h.twoFactorService.GetStatus(c.Request.Context(), userID)
+	if err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": status})
+}
+
+func (h *AuthHandler) EnrollTwoFactor(c *gin.Context) {
+	if refuseApiToken(c, "API tokens cannot change two-factor authentication") {
+		return
+	}
+	userID, _ := middleware.GetCurrentUserID(c)
+
+	enrollment, err := h.twoFactorService.BeginEnrollment(c.Request.Context(), userID)
+	if err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": enrollment})
+}
+
+func (h *AuthHandler) ConfirmTwoFactor(c *gin.Context) {
+	if refuseApiToken(c, "API tokens cannot change two-factor authentication") {
+		return
+	}
+
+	var req dto.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "data": gin.H{"error": "Invalid request format"}})
+		return
+	}
+	userID, _ := middleware.GetCurrentUserID(c)
+
+	recoveryCodes, err := h.twoFactorService.ConfirmEnrollment(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"recoveryCodes": recoveryCodes}})
+}
+
+func (h *AuthHandler) DisableTwoFactor(c *gin.Context) {
+	if refuseApiToken(c, "API tokens cannot change two-factor authentication") {
+		return
+	}
+
+	var req dto.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "data": gin.H{"error": "Invalid request format"}})
+		return
+	}
+	userID, _ := middleware.GetCurrentUserID(c)
+
+	if err := h.twoFactorService.Disable(c.Request.Context(), userID, req.Code); err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"message": "Two-factor authentication disabled"}})
+}
+
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	if refuseApiToken(c, "API tokens cannot change two-factor authentication") {
+		return
+	}
+
+	var req dto.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "data": gin.H{"error": "Invalid request format"}})
+		return
+	}
+	userID, _ := middleware.GetCurrentUserID(c)
+
+	recoveryCodes, err := h.twoFactorService.RegenerateRecoveryCodes(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"recoveryCodes": recoveryCodes}})
+}
+
+func (h *AuthHandler) LoginWebauthnTwoFactorBegin(c *gin.Context) {
+	var req dto.TwoFactorChallengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "data": gin.H{"error": "Invalid request format"}})
+		return
+	}
+
+	options, err := h.authService.BeginWebauthnTwoFactorLogin(c.Request.Context(), req.ChallengeToken)
+	if err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": options})
+}
+
+func (h *AuthHandler) LoginWebauthnTwoFactor(c *gin.Context) {
+	var req dto.WebauthnTwoFactorLoginDto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "data": gin.H{"error": "Invalid request format"}})
+		return
+	}
+
+	user, tokenPair, err := h.authService.CompleteWebauthnTwoFactorLogin(clientContext(c), req.ChallengeToken, req.Credential)
+	if err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+
+	h.writeLoginResponse(c, user, tokenPair, nil)
+}
+
+func (h *AuthHandler) WebauthnLoginBegin(c *gin.Context) {
+	var req dto.BeginWebauthnLoginDto
+	// The body is optional; without a username the browser offers discoverable passkeys.
+	_ = c.ShouldBindJSON(&req)
+
+	options, err := h.webauthnService.BeginLogin(clientContext(c), req.Username)
+	if err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": options})
+}
+
+func (h *AuthHandler) WebauthnLogin(c *gin.Context) {
+	var req dto.FinishWebauthnLoginDto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "data": gin.H{"error": "Invalid request format"}})
+		return
+	}
+
+	user, tokenPair, err := h.authService.WebauthnLogin(clientContext(c), req.Credential)
+	if err != nil {
+		if errors.Is(err, services.ErrLocalAuthDisabled) {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "data": gin.H{"error": "Local authentication is disabled"}})
+			return
+		}
+		writeTwoFactorError(c, err)
+		return
+	}
+
+	h.writeLoginResponse(c, user, tokenPair, nil)
+}
+
+func (h *AuthHandler) ListWebauthnCredentials(c *gin.Context) {
+	userID, _ := middleware.GetCurrentUserID(c)
+
+	creds, err := h.webauthnService.ListCredentials(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "data": gin.H{"error": "Failed to list passkeys"}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": creds})
+}
+
+func (h *AuthHandler) BeginWebauthnRegistration(c *gin.Context) {
+	// Like API token creation, adding a login credential needs an interactive session.
+	if refuseApiToken(c, "API tokens cannot register passkeys") {
+		return
+	}
+	userID, _ := middleware.GetCurrentUserID(c)
+
+	options, err := h.webauthnService.BeginRegistration(c.Request.Context(), userID)
+	if err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": options})
+}
+
+func (h *AuthHandler) FinishWebauthnRegistration(c *gin.Context) {
+	if refuseApiToken(c, "API tokens cannot register passkeys") {
+		return
+	}
+
+	var req dto.FinishWebauthnRegistrationDto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "data": gin.H{"error": "Invalid request format"}})
+		return
+	}
+	userID, _ := middleware.GetCurrentUserID(c)
+
+	cred, err := h.webauthnService.FinishRegistration(c.Request.Context(), userID, req)
+	if err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": cred})
+}
+
+func (h *AuthHandler) DeleteWebauthnCredential(c *gin.Context) {
+	if refuseApiToken(c, "API tokens cannot remove passkeys") {
+		return
+	}
+	userID, _ := middleware.GetCurrentUserID(c)
+
+	if err := h.webauthnService.DeleteCredential(c.Request.Context(), userID, c.Param("credentialId")); err != nil {
+		writeTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"message": "Passkey removed"}})
+}
+
+// refuseApiToken responds with 403 when the request is authenticated by an API token. Changes to
+// how the account signs in need an interactive session, so a leaked token cannot take it over.
+func refuseApiToken(c *gin.Context, errorMsg string) bool {
+	if !middleware.IsApiTokenRequest(c) {
+		return false
+	}
+	c.JSON(http.StatusForbidden, gin.H{"success": false, "data": gin.H{"error": errorMsg}})
+	return true
+}
+
+// writeLoginLockoutError responds with 429 and a Retry-After header when err is a login lockout.
+func writeLoginLockoutError(c *gin.Context, err error) bool {
+	var lockout *services.LoginLockoutError
+	if !errors.As(err, &lockout) {
+		return false
+	}
+
+	retryAfter := int(math.Ceil(lockout.RetryAfter().Seconds()))
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	errorMsg := "Too many failed login attempts, try again later"
+	if errors.Is(err, services.ErrAccountLocked) {
+		errorMsg = "Account is temporarily locked, try again later"
+	}
+	c.JSON(http.StatusTooManyRequests, gin.H{"success": false, "data": gin.H{"error": errorMsg, "retryAfter": retryAfter}})
+	return true
+}
+
+// writePasswordPolicyError responds with 400 and the violated rules when err is a password policy
+// validation error.
+func writePasswordPolicyError(c *gin.Context, err error) bool {
+	var validationErr *models.ValidationError
+	if !errors.As(err, &validationErr) {
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"success": false, "data": gin.H{
+		"error":   validationErr.Message,
+		"field":   validationErr.Field,
+		"details": validationErr.Details,
+	}})
+	return true
+}
+
+func writeTwoFactorError(c *gin.Context, err error) {
+	if writeLoginLockoutError(c, err) {
+		return
+	}
+	var statusCode int
+	var errorMsg string
+	switch {
+	case errors.Is(err, services.ErrInvalidToken):
+		statusCode = http.StatusUnauthorized
+		errorMsg = "Login challenge is invalid or has expired"
+	case errors.Is(err, services.ErrInvalidTwoFactorCode):
+		statusCode = http.StatusUnauthorized
+		errorMsg = "Invalid two-factor code"
+	case errors.Is(err, services.ErrWebauthnVerificationFailed):
+		statusCode = http.StatusUnauthorized
+		errorMsg = "Passkey verification failed"
+	case errors.Is(err, services.ErrWebauthnCredentialNotFound):
+		statusCode = http.StatusNotFound
+		errorMsg = err.Error()
+	case errors.Is(err, services.ErrTwoFactorNotEnrolled),
+		errors.Is(err, services.ErrTwoFactorAlreadyEnabled),
+		errors.Is(err, services.ErrWebauthnCredentialExists):
+		statusCode = http.StatusConflict
+		errorMsg = err.Error()
+	case errors.Is(err, services.ErrTwoFactorRequiredBySettings):
+		statusCode = http.StatusForbidden
+		errorMsg = err.Error()
+	case errors.Is(err, services.ErrUserNotFound):
+		statusCode = http.StatusNotFound
+		errorMsg = "User not found"
+	default:
+		statusCode = http.StatusInternalServerError
+		errorMsg = "Two-factor authentication failed"
+	}
+	c.JSON(statusCode, gin.H{"success": false, "data": gin.H{"error": errorMsg}})
+}
+
+// clientContext returns the request context annotated with the caller's user agent and IP so
+// new sessions can record them.
+func clientContext(c *gin.Context) context.Context {
+	return services.WithClientInfo(c.Request.Context(), services.ClientInfo{
+		UserAgent: c.Request.UserAgent(),
+		IPAddress: c.ClientIP(),
 	})
 }
 
+// Logout ends the current session. Sessions started through OIDC also get the provider's logout
+// URL as redirectUrl so the client can end the provider session too.
 func (h *AuthHandler) Logout(c *gin.Context) {
+	data := gin.H{"message": "Logged out successfully"}
+
+	if userID, ok := middleware.GetCurrentUserID(c); ok {
+		if sessionID, ok := middleware.GetCurrentSessionID(c); ok {
+			if session, err := h.sessionService.GetSession(c.Request.Context(), userID, sessionID); err == nil && session.Method == "oidc" {
+				if logoutURL, err := h.oidcService.EndSessionURL(c.Request.Context()); err != nil {
+					slog.WarnContext(c.Request.Context(), "Failed to build OIDC logout URL", "error", err)
+				} else if logoutURL != "" {
+					data["redirectUrl"] = logoutURL
+				}
+			}
+			if err := h.sessionService.RevokeSession(c.Request.Context(), userID, sessionID); err != nil && !errors.Is(err, services.ErrSessionNotFound) {
+				c.JSON(http.StatusInternalServerError, gin.H{"success": false, "data": gin.H{"error": "Failed to end session"}})
+				return
+			}
+		}
+	}
+
 	c.SetSameSite(http.SameSiteLaxMode)
 	cookie.ClearTokenCookie(c)
-	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"message": "Logged out successfully"}})
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": data})
+}
+
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	userID, _ := middleware.GetCurrentUserID(c)
+	sessionID, _ := middleware.GetCurrentSessionID(c)
+
+	sessions, err := h.sessionService.ListSessions(c.Request.Context(), userID, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "data": gin.H{"error": "Failed to list sessions"}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": sessions})
+}
+
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	userID, _ := middleware.GetCurrentUserID(c)
+	sessionID := c.Param("sessionId")
+
+	if err := h.sessionService.RevokeSession(c.Request.Context(), userID, sessionID); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"success": false, "data": gin.H{"error": "Session not found"}})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "data": gin.H{"error": "Failed to revoke session"}})
+		return
+	}
+
+	recordAudit(c, h.auditService, services.AuditRecord{
+		Action:       "session.revoke",
+		ResourceType: "session",
+		ResourceID:   sessionID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"message": "Session revoked"}})
+}
+
+// RevokeOtherSessions signs the user out everywhere except the current session.
+func (h *AuthHandler) RevokeOtherSessions(c *gin.Context) {
+	user, ok := middleware.RequireAuthentication(c)
+	if !ok {
+		return
+	}
+	sessionID, _ := middleware.GetCurrentSessionID(c)
+
+	if err := h.authService.RevokeUserSessions(c.Request.Context(), user, sessionID, "user_request"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "data": gin.H{"error": "Failed to revoke sessions"}})
+		return
+	}
+
+	recordAudit(c, h.auditService, services.AuditRecord{
+		Action:       "session.revoke_others",
+		ResourceType: "user",
+		ResourceID:   user.ID,
+		ResourceName: user.Username,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"message": "Other sessions revoked"}})
 }
 
 func (h *AuthHandler) GetCurrentUser(c *gin.Context) {
@@ -117,6 +629,9 @@ func (h *AuthHandler) GetCurrentUser(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "data": gin.H{"error": "Failed to map user"}})
 		return
 	}
+	for _, p := range middleware.GetCurrentUserPermissions(c) {
+		out.Permissions = append(out.Permissions, string(p))
+	}
 
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": out})
 }
@@ -128,7 +643,7 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	tokenPair, err := h.authService.RefreshToken(c.Request.Context(), req.RefreshToken)
+	tokenPair, err := h.authService.RefreshToken(clientContext(c), req.RefreshToken)
 	if err != nil {
 		var statusCode int
 		var errorMsg string
@@ -180,8 +695,12 @@ func (h *AuthHandler) ChangePassword(c *gin.Context) {
 		return
 	}
 
-	err := h.authService.ChangePassword(c.Request.Context(), user.ID, req.CurrentPassword, req.NewPassword)
+	sessionID, _ := middleware.GetCurrentSessionID(c)
+	err := h.authService.ChangePassword(c.Request.Context(), user.ID, sessionID, req.CurrentPassword, req.NewPassword)
 	if err != nil {
+		if writePasswordPolicyError(c, err) {
+			return
+		}
 		var statusCode int
 		var errorMsg string
 		switch {
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	glsqlite "github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/ofkm/arcane-backend/internal/config"
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/dto"
+	"github.com/ofkm/arcane-backend/internal/middleware"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/services"
+)
+
+func TestAuthHandler_RefusesApiTokensForSignInChanges(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+
+	gdb, err := gorm.Open(glsqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, gdb.AutoMigrate(&models.User{}, &models.Role{}, &models.ApiToken{}))
+	db := &database.DB{DB: gdb}
+
+	userService := services.NewUserService(db)
+	apiTokenService := services.NewApiTokenService(db)
+	user, err := userService.CreateUserWithPassword("ci", "correct-horse", "ci@example.com", models.RoleAdmin, "CI")
+	require.NoError(t, err)
+	token, err := apiTokenService.CreateToken(ctx, user.ID, dto.CreateApiTokenDto{Name: "ci", Scopes: []string{"*"}})
+	require.NoError(t, err)
+
+	// The handler's services are left nil: a refused request must not reach them.
+	router := gin.New()
+	authMiddleware := middleware.NewAuthMiddleware(nil, services.NewRoleService(db), nil, apiTokenService, nil, nil, nil, &config.Config{})
+	NewAuthHandler(router.Group("/api"), userService, nil, nil, nil, nil, nil, nil, authMiddleware)
+
+	for _, route := range []struct{ method, path string }{
+		{http.MethodPost, "/api/auth/2fa/enroll"},
+		{http.MethodPost, "/api/auth/2fa/confirm"},
+		{http.MethodPost, "/api/auth/2fa/disable"},
+		{http.MethodPost, "/api/auth/2fa/recovery-codes"},
+		{http.MethodPost, "/api/auth/webauthn/register/begin"},
+		{http.MethodPost, "/api/auth/webauthn/register"},
+		{http.MethodDelete, "/api/auth/webauthn/credentials/some-id"},
+	} {
+		req := httptest.NewRequest(route.method, route.path, strings.NewReader(`{"code":"123456"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token.Token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusForbidden, rec.Code, route.path+": "+rec.Body.String())
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/ofkm/arcane-backend/internal/config"
 	"github.com/ofkm/arcane-backend/internal/dto"
 	"github.com/ofkm/arcane-backend/internal/middleware"
+	"github.com/ofkm/arcane-backend/internal/models"
 	"github.com/ofkm/arcane-backend/internal/services"
 	httputil "github.com/ofkm/arcane-backend/internal/utils/http"
 	"github.com/ofkm/arcane-backend/internal/utils/pagination"
@@ -30,15 +31,17 @@ type ContainerHandler struct {
 	containerService    *services.ContainerService
 	imageService        *services.ImageService
 	dockerService       *services.DockerClientService
+	auditService        *services.AuditService
 	statsStreams        sync.Map
 	containerWSUpgrader websocket.Upgrader
 }
 
-func NewContainerHandler(group *gin.RouterGroup, dockerService *services.DockerClientService, containerService *services.ContainerService, imageService *services.ImageService, authMiddleware *middleware.AuthMiddleware, cfg *config.Config) {
+func NewContainerHandler(group *gin.RouterGroup, dockerService *services.DockerClientService, containerService *services.ContainerService, imageService *services.ImageService, auditService *services.AuditService, authMiddleware *middleware.AuthMiddleware, cfg *config.Config) {
 	handler := &ContainerHandler{
 		dockerService:    dockerService,
 		containerService: containerService,
 		imageService:     imageService,
+		auditService:     auditService,
 		containerWSUpgrader: websocket.Upgrader{
 			CheckOrigin:       httputil.ValidateWebSocketOrigin(cfg.AppUrl),
 			ReadBufferSize:    32 * 1024,
@@ -48,20 +51,19 @@ func NewContainerHandler(group *gin.RouterGroup, dockerService *services.DockerC
 	}
 
 	apiGroup := group.Group("/environments/:id/containers")
-	apiGroup.Use(authMiddleware.WithAdminNotRequired().Add())
+	readAuth := authMiddleware.WithPermissions(models.PermissionContainersRead).Add()
 	{
-		apiGroup.GET("/counts", handler.GetContainerStatusCounts)
-		apiGroup.GET("", handler.List)
-		apiGroup.POST("", handler.Create)
-		apiGroup.GET("/:containerId", handler.GetByID)
-		apiGroup.GET("/:containerId/stats/ws", handler.GetStatsWS)
-		apiGroup.POST("/:containerId/start", handler.Start)
-		apiGroup.POST("/:containerId/stop", handler.Stop)
-		apiGroup.POST("/:containerId/restart", handler.Restart)
-		apiGroup.GET("/:containerId/logs/ws", handler.GetLogsWS)
-		apiGroup.GET("/:containerId/exec/ws", handler.GetExecWS)
-		apiGroup.DELETE("/:containerId", handler.Delete)
-
+		apiGroup.GET("/counts", readAuth, handler.GetContainerStatusCounts)
+		apiGroup.GET("", readAuth, handler.List)
+		apiGroup.POST("", authMiddleware.WithPermissions(models.PermissionContainersCreate).Add(), handler.Create)
+		apiGroup.GET("/:containerId", readAuth, handler.GetByID)
+		apiGroup.GET("/:containerId/stats/ws", readAuth, handler.GetStatsWS)
+		apiGroup.POST("/:containerId/start", authMiddleware.WithPermissions(models.PermissionContainersStart).Add(), handler.Start)
+		apiGroup.POST("/:containerId/stop", authMiddleware.WithPermissions(models.PermissionContainersStop).Add(), handler.Stop)
+		apiGroup.POST("/:containerId/restart", authMiddleware.WithPermissions(models.PermissionContainersRestart).Add(), handler.Restart)
+		apiGroup.GET("/:containerId/logs/ws", readAuth, handler.GetLogsWS)
+		apiGroup.GET("/:containerId/exec/ws", authMiddleware.WithPermissions(models.PermissionContainersExec).Add(), handler.GetExecWS)
+		apiGroup.DELETE("/:containerId", authMiddleware.WithPermissions(models.PermissionContainersDelete).Add(), handler.Delete)
 	}
 }
 
@@ -72,14 +74,16 @@ type containerLogStream struct {
 	seq    atomic.Uint64
 }
 
-func (h *ContainerHandler) getOrStartContainerLogHub(containerID, format string, batched bool, follow bool, tail, since string, timestamps bool) *ws.Hub {
+// getOrStartContainerLogHub streams logs until the last client leaves. The stream outlives the
+// request that started it but keeps its values, such as the Docker environment it addresses.
+func (h *ContainerHandler) getOrStartContainerLogHub(parent context.Context, containerID, format string, batched bool, follow bool, tail, since string, timestamps bool) *ws.Hub {
 	// Create a new hub for each connection to ensure every client gets historical logs
 	ls := &containerLogStream{
 		hub:    ws.NewHub(1024),
 		format: format,
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(context.WithoutCancel(parent))
 	ls.cancel = cancel
 
 	ls.hub.SetOnEmpty(func() {
@@ -174,7 +178,7 @@ func (h *ContainerHandler) GetLogsWS(c *gin.Context) {
 
 	slog.Debug("websocket connection upgraded", "containerID", containerID)
 
-	hub := h.getOrStartContainerLogHub(containerID, format, batched, follow, tail, since, timestamps)
+	hub := h.getOrStartContainerLogHub(c.Request.Context(), containerID, format, batched, follow, tail, since, timestamps)
 	ws.ServeClient(context.Background(), hub, conn)
 	slog.Debug("websocket connection closed", "containerID", containerID)
 }
@@ -216,6 +220,21 @@ func (h *ContainerHandler) GetExecWS(c *gin.Context) {
 		}
 	}()
 
+	startedAt := time.Now()
+	audit := services.AuditRecord{
+		Action:        "container.exec_start",
+		ResourceType:  "container",
+		ResourceID:    containerID,
+		EnvironmentID: c.Param("id"),
+		Metadata:      models.JSON{"execId": execID, "shell": shell},
+	}
+	recordAudit(c, h.auditService, audit)
+	defer func() {
+		audit.Action = "container.exec_end"
+		audit.Metadata = models.JSON{"execId": execID, "shell": shell, "durationSeconds": int(time.Since(startedAt).Seconds())}
+		recordAudit(c, h.auditService, audit)
+	}()
+
 	done := make(chan struct{})
 	readErr := make(chan error, 1)
 	writeErr := make(chan error, 1)
@@ -564,15 +583,17 @@ type containerStatsStream struct {
 	cancel context.CancelFunc
 }
 
-func (h *ContainerHandler) getOrStartContainerStatsHub(containerID string) *ws.Hub {
-	key := fmt.Sprintf("%s::stats", containerID)
+// getOrStartContainerStatsHub shares one stats stream per container and environment between
+// clients, like getOrStartContainerLogHub keeping the values of the request that started it.
+func (h *ContainerHandler) getOrStartContainerStatsHub(parent context.Context, envID, containerID string) *ws.Hub {
+	key := fmt.Sprintf("%s::%s::stats", envID, containerID)
 	v, _ := h.statsStreams.LoadOrStore(key, &containerStatsStream{
 		hub: ws.NewHub(1024),
 	})
 	ss := v.(*containerStatsStream)
 
 	ss.once.Do(func() {
-		ctx, cancel := context.WithCancel(context.Background())
+		ctx, cancel := context.WithCancel(context.WithoutCancel(parent))
 		ss.cancel = cancel
 
 		ss.hub.SetOnEmpty(func() {
@@ -635,7 +656,7 @@ func (h *ContainerHandler) GetStatsWS(c *gin.Context) {
 
 	slog.Debug("websocket connection upgraded for stats", "containerID", containerID)
 
-	hub := h.getOrStartContainerStatsHub(containerID)
+	hub := h.getOrStartContainerStatsHub(c.Request.Context(), c.Param("id"), containerID)
 	ws.ServeClient(context.Background(), hub, conn)
 	slog.Debug("websocket connection closed for stats", "containerID", containerID)
 }
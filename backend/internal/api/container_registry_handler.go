@@ -24,14 +24,15 @@ func NewContainerRegistryHandler(group *gin.RouterGroup, registryService *servic
 
 	apiGroup := group.Group("/container-registries")
 
-	apiGroup.Use(authMiddleware.WithAdminNotRequired().Add())
+	readAuth := authMiddleware.WithPermissions(models.PermissionRegistriesRead).Add()
+	manageAuth := authMiddleware.WithPermissions(models.PermissionRegistriesManage).Add()
 	{
-		apiGroup.GET("", handler.GetRegistries)
-		apiGroup.POST("", handler.CreateRegistry)
-		apiGroup.GET("/:id", handler.GetRegistry)
-		apiGroup.PUT("/:id", handler.UpdateRegistry)
-		apiGroup.DELETE("/:id", handler.DeleteRegistry)
-		apiGroup.POST("/:id/test", handler.TestRegistry)
+		apiGroup.GET("", readAuth, handler.GetRegistries)
+		apiGroup.POST("", manageAuth, handler.CreateRegistry)
+		apiGroup.GET("/:id", readAuth, handler.GetRegistry)
+		apiGroup.PUT("/:id", manageAuth, handler.UpdateRegistry)
+		apiGroup.DELETE("/:id", manageAuth, handler.DeleteRegistry)
+		apiGroup.POST("/:id/test", manageAuth, handler.TestRegistry)
 	}
 }
 
@@ -21,8 +21,8 @@ func NewCustomizeHandler(group *gin.RouterGroup, customizeSearchService *service
 
 	// Expose customize search and categories endpoints under /api/customize
 	apiGroup := group.Group("/customize")
-	apiGroup.POST("/search", authMiddleware.WithAdminNotRequired().Add(), handler.Search)
-	apiGroup.GET("/categories", authMiddleware.WithAdminNotRequired().Add(), handler.GetCategories)
+	apiGroup.POST("/search", authMiddleware.Add(), handler.Search)
+	apiGroup.GET("/categories", authMiddleware.Add(), handler.GetCategories)
 }
 
 // Search delegates to the customize search service and returns relevance-scored results
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ofkm/arcane-backend/internal/dto"
+	"github.com/ofkm/arcane-backend/internal/middleware"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/services"
+)
+
+// EnvironmentBulkHandler runs actions on every environment in a group or carrying a set of tags.
+type EnvironmentBulkHandler struct {
+	bulkService *services.EnvironmentBulkService
+}
+
+func NewEnvironmentBulkHandler(group *gin.RouterGroup, bulkService *services.EnvironmentBulkService, authMiddleware *middleware.AuthMiddleware) {
+	handler := &EnvironmentBulkHandler{bulkService: bulkService}
+
+	apiGroup := group.Group("/environments/bulk")
+	{
+		apiGroup.POST("/image-updates/check", authMiddleware.WithPermissions(models.PermissionImagesRead).Add(), handler.CheckImageUpdates)
+		apiGroup.POST("/prune", authMiddleware.WithPermissions(models.PermissionSystemPrune).Add(), handler.Prune)
+		apiGroup.POST("/projects/redeploy", authMiddleware.WithPermissions(models.PermissionProjectsDeploy).Add(), handler.RedeployProject)
+	}
+}
+
+func (h *EnvironmentBulkHandler) CheckImageUpdates(c *gin.Context) {
+	var req dto.BulkImageUpdateCheckDto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "data": gin.H{"error": "Invalid request format: " + err.Error()}})
+		return
+	}
+	results, err := h.bulkService.CheckImageUpdates(c.Request.Context(), bulkCaller(c), req.EnvironmentSelectorDto)
+	respondBulk(c, results, err)
+}
+
+func (h *EnvironmentBulkHandler) Prune(c *gin.Context) {
+	var req dto.BulkPruneDto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "data": gin.H{"error": "Invalid request format: " + err.Error()}})
+		return
+	}
+	results, err := h.bulkService.Prune(c.Request.Context(), bulkCaller(c), req.EnvironmentSelectorDto, req.Prune)
+	respondBulk(c, results, err)
+}
+
+func (h *EnvironmentBulkHandler) RedeployProject(c *gin.Context) {
+	var req dto.BulkRedeployProjectDto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "data": gin.H{"error": "Invalid request format: " + err.Error()}})
+		return
+	}
+	results, err := h.bulkService.RedeployProject(c.Request.Context(), bulkCaller(c), req.EnvironmentSelectorDto, req.ProjectName)
+	respondBulk(c, results, err)
+}
+
+func bulkCaller(c *gin.Context) services.AggregateCaller {
+	user, _ := middleware.GetCurrentUser(c)
+	return services.AggregateCaller{User: user, Permissions: middleware.GetCurrentUserPermissions(c)}
+}
+
+func respondBulk(c *gin.Context, results []dto.EnvironmentActionResultDto, err error) {
+	if errors.Is(err, services.ErrEmptyEnvironmentSelector) {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "data": gin.H{"error": err.Error()}})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "data": gin.H{"error": "Bulk action failed: " + err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": results})
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"errors"
 	"log/slog"
 	"net/http"
 	"time"
@@ -19,7 +20,8 @@ const LOCAL_DOCKER_ENVIRONMENT_ID = "0"
 
 type EnvironmentHandler struct {
 	environmentService *services.EnvironmentService
-	settingsService    *services.SettingsService
+	agentTokens        *services.AgentTokenService
+	agentTLS           *services.AgentTLSService
 	cfg                *config.Config
 	httpClient         *http.Client
 }
@@ -27,13 +29,15 @@ type EnvironmentHandler struct {
 func NewEnvironmentHandler(
 	group *gin.RouterGroup,
 	environmentService *services.EnvironmentService,
-	settingsService *services.SettingsService,
+	agentTokens *services.AgentTokenService,
+	agentTLS *services.AgentTLSService,
 	authMiddleware *middleware.AuthMiddleware,
 	cfg *config.Config,
 ) {
 	h := &EnvironmentHandler{
 		environmentService: environmentService,
-		settingsService:    settingsService,
+		agentTokens:        agentTokens,
+		agentTLS:           agentTLS,
 		cfg:                cfg,
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
@@ -41,21 +45,35 @@ func NewEnvironmentHandler(
 	}
 
 	apiGroup := group.Group("/environments")
-	apiGroup.Use(authMiddleware.WithAdminNotRequired().Add())
+	readAuth := authMiddleware.WithPermissions(models.PermissionEnvironmentsRead).Add()
+	manageAuth := authMiddleware.WithPermissions(models.PermissionEnvironmentsManage).Add()
 	{
-		apiGroup.GET("", h.ListEnvironments)
-		apiGroup.POST("", h.CreateEnvironment)
-		apiGroup.GET("/:id", h.GetEnvironment)
-		apiGroup.PUT("/:id", h.UpdateEnvironment)
-		apiGroup.DELETE("/:id", h.DeleteEnvironment)
-		apiGroup.POST("/:id/test", h.TestConnection)
-		apiGroup.POST("/:id/heartbeat", h.UpdateHeartbeat)
-		apiGroup.POST("/:id/agent/pair", h.PairAgent)
+		apiGroup.GET("", readAuth, h.ListEnvironments)
+		apiGroup.POST("", manageAuth, h.CreateEnvironment)
+		apiGroup.GET("/:id", readAuth, h.GetEnvironment)
+		apiGroup.PUT("/:id", manageAuth, h.UpdateEnvironment)
+		apiGroup.DELETE("/:id", manageAuth, h.DeleteEnvironment)
+		apiGroup.POST("/:id/test", readAuth, h.TestConnection)
+		apiGroup.POST("/:id/heartbeat", manageAuth, h.UpdateHeartbeat)
+		apiGroup.POST("/:id/agent/pair", manageAuth, h.PairAgent)
+		apiGroup.POST("/:id/agent/csr", manageAuth, h.CreateAgentCSR)
+		apiGroup.POST("/:id/agent/certificate", manageAuth, h.InstallAgentCertificate)
+		apiGroup.POST("/:id/agent/token", manageAuth, h.StageAgentToken)
+		apiGroup.POST("/:id/agent/token/confirm", manageAuth, h.ConfirmAgentToken)
+		apiGroup.POST("/:id/agent/unpair", manageAuth, h.UnpairFromManager)
+		apiGroup.POST("/:id/token/rotate", manageAuth, h.RotateAgentToken)
+		apiGroup.POST("/:id/unpair", manageAuth, h.UnpairAgent)
+		apiGroup.GET("/:id/certificates", manageAuth, h.ListCertificates)
+		apiGroup.POST("/:id/certificates/rotate", manageAuth, h.RotateCertificate)
+		apiGroup.POST("/:id/certificates/revoke", manageAuth, h.RevokeCertificates)
+		apiGroup.GET("/:id/access", manageAuth, h.ListAccess)
+		apiGroup.PUT("/:id/access", manageAuth, h.SetAccess)
+		apiGroup.DELETE("/:id/access/:grantId", manageAuth, h.DeleteAccess)
 	}
 }
 
 func (h *EnvironmentHandler) PairAgent(c *gin.Context) {
-	if c.Param("id") != LOCAL_DOCKER_ENVIRONMENT_ID {
+	if c.Param("id") != LOCAL_DOCKER_ENVIRONMENT_ID || h.agentTokens == nil {
 		c.JSON(http.StatusNotFound, gin.H{"success": false, "data": gin.H{"error": "Not found"}})
 		return
 	}
@@ -65,24 +83,130 @@ func (h *EnvironmentHandler) PairAgent(c *gin.Context) {
 	var req pairReq
 	_ = c.ShouldBindJSON(&req)
 
-	if h.cfg.AgentToken == "" || (req.Rotate != nil && *req.Rotate) {
-		h.cfg.AgentToken = utils.GenerateRandomString(48)
+	token := h.agentTokens.Token()
+	if token == "" || (req.Rotate != nil && *req.Rotate) {
+		token = utils.GenerateRandomString(48)
 	}
 
 	// Persist token on the agent so it survives restarts
-	if err := h.settingsService.SetStringSetting(c.Request.Context(), "agentToken", h.cfg.AgentToken); err != nil {
+	if err := h.agentTokens.Set(c.Request.Context(), token); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "data": gin.H{"error": "Failed to persist agent token"}})
 		return
 	}
 
+	data := gin.H{"token": token}
+	// An agent serving TLS asks the manager's CA for a certificate as part of pairing.
+	if h.agentTLS != nil {
+		csr, err := h.agentTLS.CreateCSR(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "data": gin.H{"error": "Failed to create certificate request"}})
+			return
+		}
+		data["csr"] = csr
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"data": gin.H{
-			"token": h.cfg.AgentToken,
-		},
+		"data":    data,
 	})
 }
 
+// StageAgentToken runs on an agent: it accepts the token the manager is rotating to alongside the
+// current one until the manager confirms it.
+func (h *EnvironmentHandler) StageAgentToken(c *gin.Context) {
+	if c.Param("id") != LOCAL_DOCKER_ENVIRONMENT_ID || h.agentTokens == nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "data": gin.H{"error": "Not found"}})
+		return
+	}
+
+	var req dto.AgentTokenDto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "data": gin.H{"error": "Invalid request format: " + err.Error()}})
+		return
+	}
+	if err := h.agentTokens.Stage(c.Request.Context(), c.GetHeader("X-Arcane-Agent-Token"), req.Token); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "data": gin.H{"error": "Failed to persist agent token"}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"message": "Agent token staged"}})
+}
+
+// ConfirmAgentToken runs on an agent: called with the staged token, it makes that token the only
+// one the agent accepts.
+func (h *EnvironmentHandler) ConfirmAgentToken(c *gin.Context) {
+	if c.Param("id") != LOCAL_DOCKER_ENVIRONMENT_ID || h.agentTokens == nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "data": gin.H{"error": "Not found"}})
+		return
+	}
+
+	if err := h.agentTokens.Confirm(c.Request.Context(), c.GetHeader("X-Arcane-Agent-Token")); err != nil {
+		if errors.Is(err, services.ErrAgentTokenNotPending) {
+			c.JSON(http.StatusConflict, gin.H{"success": false, "data": gin.H{"error": "No token rotation is pending for this token"}})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "data": gin.H{"error": "Failed to persist agent token"}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"message": "Agent token confirmed"}})
+}
+
+// UnpairFromManager runs on an agent: it forgets the agent's token and certificate, so it has to
+// be paired again before any manager can use it.
+func (h *EnvironmentHandler) UnpairFromManager(c *gin.Context) {
+	if c.Param("id") != LOCAL_DOCKER_ENVIRONMENT_ID || h.agentTokens == nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "data": gin.H{"error": "Not found"}})
+		return
+	}
+
+	if err := h.agentTokens.Clear(c.Request.Context()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "data": gin.H{"error": "Failed to clear agent token"}})
+		return
+	}
+	if h.agentTLS != nil {
+		if err := h.agentTLS.Reset(c.Request.Context()); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "data": gin.H{"error": "Failed to remove agent certificate"}})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"message": "Agent unpaired"}})
+}
+
+// CreateAgentCSR runs on an agent: it generates a new key and returns a certificate request for
+// the manager to sign when rotating the agent's certificate.
+func (h *EnvironmentHandler) CreateAgentCSR(c *gin.Context) {
+	if c.Param("id") != LOCAL_DOCKER_ENVIRONMENT_ID || h.agentTLS == nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "data": gin.H{"error": "Not found"}})
+		return
+	}
+
+	csr, err := h.agentTLS.CreateCSR(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "data": gin.H{"error": "Failed to create certificate request"}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"csr": csr}})
+}
+
+// InstallAgentCertificate runs on an agent: it installs the certificate the manager issued for
+// the last certificate request.
+func (h *EnvironmentHandler) InstallAgentCertificate(c *gin.Context) {
+	if c.Param("id") != LOCAL_DOCKER_ENVIRONMENT_ID || h.agentTLS == nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "data": gin.H{"error": "Not found"}})
+		return
+	}
+
+	var req dto.InstallAgentCertificateDto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "data": gin.H{"error": "Invalid request format: " + err.Error()}})
+		return
+	}
+	if err := h.agentTLS.Install(c.Request.Context(), req.Certificate, req.CaCertificate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "data": gin.H{"error": "Failed to install certificate: " + err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"message": "Certificate installed"}})
+}
+
 // Create
 func (h *EnvironmentHandler) CreateEnvironment(c *gin.Context) {
 	var req dto.CreateEnvironmentDto
@@ -91,23 +215,56 @@ func (h *EnvironmentHandler) CreateEnvironment(c *gin.Context) {
 		return
 	}
 
+	direct := req.Type != nil && *req.Type == models.EnvironmentTypeDocker
+	hasAccessToken := !direct && req.AccessToken != nil && *req.AccessToken != ""
+	if req.ApiUrl == "" && !hasAccessToken {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "data": gin.H{"error": "apiUrl is required unless an access token is given for a tunneled agent"}})
+		return
+	}
+
 	env := &models.Environment{
 		ApiUrl:  req.ApiUrl,
 		Enabled: true,
 	}
+	if direct {
+		env.Type = models.EnvironmentTypeDocker
+		env.SshPrivateKey, env.SshHostKey = req.SshPrivateKey, req.SshHostKey
+		env.TlsCaCert, env.TlsCert, env.TlsKey = req.TlsCaCert, req.TlsCert, req.TlsKey
+	}
 	if req.Name != nil {
 		env.Name = *req.Name
 	}
 	if req.Enabled != nil {
 		env.Enabled = *req.Enabled
 	}
+	env.Group = req.Group
+	env.Tags = req.Tags
+
+	if hasAccessToken {
+		env.AccessToken = req.AccessToken
+	}
 
-	if (req.AccessToken == nil || *req.AccessToken == "") && req.BootstrapToken != nil && *req.BootstrapToken != "" {
-		token, err := h.environmentService.PairAgentWithBootstrap(c.Request.Context(), req.ApiUrl, *req.BootstrapToken)
+	created, err := h.environmentService.CreateEnvironment(c.Request.Context(), env)
+	if errors.Is(err, services.ErrInvalidEnvironmentTag) || errors.Is(err, services.ErrInvalidDockerHost) {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "data": gin.H{"error": err.Error()}})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "data": gin.H{"error": "Failed to create environment: " + err.Error()}})
+		return
+	}
+
+	// Pairing happens after the environment exists so the certificate issued to the agent can
+	// be recorded against it.
+	if !direct && !hasAccessToken && req.BootstrapToken != nil && *req.BootstrapToken != "" {
+		token, err := h.environmentService.PairAndPersistAgentToken(c.Request.Context(), created.ID, req.ApiUrl, *req.BootstrapToken)
 		if err != nil {
 			slog.ErrorContext(c.Request.Context(), "Failed to pair with agent",
 				slog.String("apiUrl", req.ApiUrl),
 				slog.String("error", err.Error()))
+			if delErr := h.environmentService.DeleteEnvironment(c.Request.Context(), created.ID); delErr != nil {
+				slog.ErrorContext(c.Request.Context(), "Failed to remove environment after pairing failed", slog.String("error", delErr.Error()))
+			}
 
 			c.JSON(http.StatusBadGateway, gin.H{
 				"success": false,
@@ -118,15 +275,7 @@ func (h *EnvironmentHandler) CreateEnvironment(c *gin.Context) {
 			})
 			return
 		}
-		env.AccessToken = &token
-	} else if req.AccessToken != nil && *req.AccessToken != "" {
-		env.AccessToken = req.AccessToken
-	}
-
-	created, err := h.environmentService.CreateEnvironment(c.Request.Context(), env)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "data": gin.H{"error": "Failed to create environment: " + err.Error()}})
-		return
+		created.AccessToken = &token
 	}
 
 	out, mapErr := dto.MapOne[*models.Environment, dto.EnvironmentDto](created)
@@ -141,7 +290,10 @@ func (h *EnvironmentHandler) CreateEnvironment(c *gin.Context) {
 func (h *EnvironmentHandler) ListEnvironments(c *gin.Context) {
 	params := pagination.ExtractListModifiersQueryParams(c)
 
-	envs, paginationResp, err := h.environmentService.ListEnvironmentsPaginated(c.Request.Context(), params)
+	user, _ := middleware.GetCurrentUser(c)
+	perms := middleware.GetCurrentUserPermissions(c)
+
+	envs, paginationResp, err := h.environmentService.ListEnvironmentsPaginated(c.Request.Context(), params, user, perms)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "data": gin.H{"error": "Failed to fetch environments"}})
 		return
@@ -196,6 +348,23 @@ func (h *EnvironmentHandler) UpdateEnvironment(c *gin.Context) {
 	if req.Enabled != nil {
 		updates["enabled"] = *req.Enabled
 	}
+	if req.Group != nil {
+		updates["group_name"] = *req.Group
+	}
+	if req.Tags != nil {
+		updates["tags"] = *req.Tags
+	}
+	for column, value := range map[string]*string{
+		"ssh_private_key": req.SshPrivateKey,
+		"ssh_host_key":    req.SshHostKey,
+		"tls_ca_cert":     req.TlsCaCert,
+		"tls_cert":        req.TlsCert,
+		"tls_key":         req.TlsKey,
+	} {
+		if value != nil {
+			updates[column] = *value
+		}
+	}
 
 	// If caller asked to pair (bootstrapToken present) and no accessToken provided in the request,
 	// resolve apiUrl (current or updated) and let the service pair and persist the token.
@@ -218,6 +387,10 @@ func (h *EnvironmentHandler) UpdateEnvironment(c *gin.Context) {
 	}
 
 	updated, err := h.environmentService.UpdateEnvironment(c.Request.Context(), environmentID, updates)
+	if errors.Is(err, services.ErrInvalidEnvironmentTag) || errors.Is(err, services.ErrInvalidDockerHost) {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "data": gin.H{"error": err.Error()}})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "data": gin.H{"error": "Failed to update environment"}})
 		return
@@ -287,3 +460,114 @@ func (h *EnvironmentHandler) UpdateHeartbeat(c *gin.Context) {
 		"message": "Heartbeat updated successfully",
 	})
 }
+
+func (h *EnvironmentHandler) ListCertificates(c *gin.Context) {
+	certs, err := h.environmentService.ListAgentCertificates(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "data": gin.H{"error": "Failed to list agent certificates"}})
+		return
+	}
+
+	out, mapErr := dto.MapSlice[models.AgentCertificate, dto.AgentCertificateDto](certs)
+	if mapErr != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "data": gin.H{"error": "Failed to map agent certificates"}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": out})
+}
+
+func (h *EnvironmentHandler) RotateCertificate(c *gin.Context) {
+	cert, err := h.environmentService.RotateAgentCertificate(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, services.ErrAgentCertificateNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"success": false, "data": gin.H{"error": "Environment has no active agent certificate; pair the agent to issue one"}})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"success": false, "data": gin.H{"error": "Failed to rotate agent certificate: " + err.Error()}})
+		return
+	}
+
+	out, mapErr := dto.MapOne[*models.AgentCertificate, dto.AgentCertificateDto](cert)
+	if mapErr != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "data": gin.H{"error": "Failed to map agent certificate"}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": out})
+}
+
+func (h *EnvironmentHandler) RevokeCertificates(c *gin.Context) {
+	revoked, err := h.environmentService.RevokeAgentCertificates(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "data": gin.H{"error": "Failed to revoke agent certificates"}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"revoked": revoked}})
+}
+
+func (h *EnvironmentHandler) RotateAgentToken(c *gin.Context) {
+	if err := h.environmentService.RotateAgentToken(c.Request.Context(), c.Param("id")); err != nil {
+		if errors.Is(err, services.ErrAgentNotPaired) {
+			c.JSON(http.StatusConflict, gin.H{"success": false, "data": gin.H{"error": "Environment is not paired with an agent"}})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"success": false, "data": gin.H{"error": "Failed to rotate agent token: " + err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"message": "Agent token rotated"}})
+}
+
+// UnpairAgent removes the agent's credentials from the environment. With ?force=true this also
+// happens when the agent cannot be told to forget them.
+func (h *EnvironmentHandler) UnpairAgent(c *gin.Context) {
+	force := c.Query("force") == "true"
+	if err := h.environmentService.UnpairAgent(c.Request.Context(), c.Param("id"), force); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"success": false, "data": gin.H{"error": "Failed to unpair agent: " + err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"message": "Agent unpaired"}})
+}
+
+func (h *EnvironmentHandler) ListAccess(c *gin.Context) {
+	grants, err := h.environmentService.ListEnvironmentAccess(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "data": gin.H{"error": "Failed to list environment access"}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": grants})
+}
+
+func (h *EnvironmentHandler) SetAccess(c *gin.Context) {
+	var req dto.SetEnvironmentAccessDto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "data": gin.H{"error": "Invalid request format: " + err.Error()}})
+		return
+	}
+
+	grant, err := h.environmentService.SetEnvironmentAccess(c.Request.Context(), c.Param("id"), req)
+	if err != nil {
+		var validationErr *models.ValidationError
+		if errors.As(err, &validationErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "data": gin.H{"error": validationErr.Error()}})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "data": gin.H{"error": "Failed to set environment access"}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": grant})
+}
+
+func (h *EnvironmentHandler) DeleteAccess(c *gin.Context) {
+	err := h.environmentService.DeleteEnvironmentAccess(c.Request.Context(), c.Param("id"), c.Param("grantId"))
+	if err != nil {
+		if errors.Is(err, services.ErrEnvironmentAccessNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"success": false, "data": gin.H{"error": "Access grant not found"}})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "data": gin.H{"error": "Failed to delete environment access"}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"message": "Access grant deleted successfully"}})
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ofkm/arcane-backend/internal/dto"
+	"github.com/ofkm/arcane-backend/internal/middleware"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/services"
+)
+
+// EnvironmentScheduleHandler reads and sets the image polling and update policy of a remote
+// environment, overriding the global settings.
+type EnvironmentScheduleHandler struct {
+	scheduleService *services.EnvironmentScheduleService
+}
+
+func NewEnvironmentScheduleHandler(group *gin.RouterGroup, scheduleService *services.EnvironmentScheduleService, authMiddleware *middleware.AuthMiddleware) {
+	handler := &EnvironmentScheduleHandler{scheduleService: scheduleService}
+
+	apiGroup := group.Group("/environments")
+	{
+		apiGroup.GET("/:id/schedule", authMiddleware.WithPermissions(models.PermissionEnvironmentsRead).Add(), handler.GetSchedule)
+		apiGroup.PUT("/:id/schedule", authMiddleware.WithPermissions(models.PermissionEnvironmentsManage).Add(), handler.SetSchedule)
+	}
+}
+
+func (h *EnvironmentScheduleHandler) GetSchedule(c *gin.Context) {
+	schedule, err := h.scheduleService.GetSchedule(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "data": gin.H{"error": "Environment not found"}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": schedule})
+}
+
+func (h *EnvironmentScheduleHandler) SetSchedule(c *gin.Context) {
+	var req dto.EnvironmentScheduleDto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "data": gin.H{"error": "Invalid request format: " + err.Error()}})
+		return
+	}
+
+	schedule, err := h.scheduleService.SetSchedule(c.Request.Context(), c.Param("id"), req)
+	if err != nil {
+		if errors.Is(err, services.ErrLocalEnvironmentSchedule) || errors.Is(err, services.ErrDirectDockerUnsupported) {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "data": gin.H{"error": err.Error()}})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "data": gin.H{"error": "Failed to update schedule: " + err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": schedule})
+}
@@ -6,24 +6,27 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/ofkm/arcane-backend/internal/dto"
 	"github.com/ofkm/arcane-backend/internal/middleware"
+	"github.com/ofkm/arcane-backend/internal/models"
 	"github.com/ofkm/arcane-backend/internal/services"
 	"github.com/ofkm/arcane-backend/internal/utils/pagination"
 )
 
 type EventHandler struct {
 	eventService *services.EventService
+	auditService *services.AuditService
 }
 
-func NewEventHandler(group *gin.RouterGroup, eventService *services.EventService, authMiddleware *middleware.AuthMiddleware) {
-	handler := &EventHandler{eventService: eventService}
+func NewEventHandler(group *gin.RouterGroup, eventService *services.EventService, auditService *services.AuditService, authMiddleware *middleware.AuthMiddleware) {
+	handler := &EventHandler{eventService: eventService, auditService: auditService}
 
 	apiGroup := group.Group("/events")
-	apiGroup.Use(authMiddleware.WithAdminRequired().Add())
+	readAuth := authMiddleware.WithPermissions(models.PermissionEventsRead).Add()
+	manageAuth := authMiddleware.WithPermissions(models.PermissionEventsManage).Add()
 	{
-		apiGroup.GET("", handler.ListEvents)
-		apiGroup.POST("", handler.CreateEvent)
-		apiGroup.DELETE("/:eventId", handler.DeleteEvent)
-		apiGroup.GET("/environment/:environmentId", handler.GetEventsByEnvironment)
+		apiGroup.GET("", readAuth, handler.ListEvents)
+		apiGroup.POST("", manageAuth, handler.CreateEvent)
+		apiGroup.DELETE("/:eventId", manageAuth, handler.DeleteEvent)
+		apiGroup.GET("/environment/:environmentId", readAuth, handler.GetEventsByEnvironment)
 	}
 }
 
@@ -117,6 +120,12 @@ func (h *EventHandler) DeleteEvent(c *gin.Context) {
 		return
 	}
 
+	recordAudit(c, h.auditService, services.AuditRecord{
+		Action:       "event.delete",
+		ResourceType: "event",
+		ResourceID:   eventID,
+	})
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"data":    gin.H{"message": "Event deleted successfully"},
@@ -13,6 +13,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/ofkm/arcane-backend/internal/dto"
 	"github.com/ofkm/arcane-backend/internal/middleware"
+	"github.com/ofkm/arcane-backend/internal/models"
 	"github.com/ofkm/arcane-backend/internal/services"
 	"github.com/ofkm/arcane-backend/internal/utils/pagination"
 )
@@ -28,15 +29,16 @@ func NewImageHandler(group *gin.RouterGroup, dockerService *services.DockerClien
 	handler := &ImageHandler{dockerService: dockerService, imageService: imageService, imageUpdateService: imageUpdateService, settingsService: settingsService}
 
 	apiGroup := group.Group("/environments/:id/images")
-	apiGroup.Use(authMiddleware.WithAdminNotRequired().Add())
+	readAuth := authMiddleware.WithPermissions(models.PermissionImagesRead).Add()
+	pullAuth := authMiddleware.WithPermissions(models.PermissionImagesPull).Add()
 	{
-		apiGroup.GET("/counts", handler.GetImageUsageCounts)
-		apiGroup.GET("", handler.List)
-		apiGroup.GET("/:imageId", handler.GetByID)
-		apiGroup.DELETE("/:imageId", handler.Remove)
-		apiGroup.POST("/pull", handler.Pull)
-		apiGroup.POST("/prune", handler.Prune)
-		apiGroup.POST("/upload", handler.Upload)
+		apiGroup.GET("/counts", readAuth, handler.GetImageUsageCounts)
+		apiGroup.GET("", readAuth, handler.List)
+		apiGroup.GET("/:imageId", readAuth, handler.GetByID)
+		apiGroup.DELETE("/:imageId", authMiddleware.WithPermissions(models.PermissionImagesDelete).Add(), handler.Remove)
+		apiGroup.POST("/pull", pullAuth, handler.Pull)
+		apiGroup.POST("/prune", authMiddleware.WithPermissions(models.PermissionImagesPrune).Add(), handler.Prune)
+		apiGroup.POST("/upload", pullAuth, handler.Upload)
 	}
 }
 
@@ -222,7 +224,8 @@ func (h *ImageHandler) GetImageUsageCounts(c *gin.Context) {
 }
 
 func (h *ImageHandler) Upload(c *gin.Context) {
-	ctx := context.Background()
+	// The load is not cancelled with the request, but keeps the Docker environment it addresses.
+	ctx := context.WithoutCancel(c.Request.Context())
 
 	currentUser, ok := middleware.RequireAuthentication(c)
 	if !ok {
@@ -6,6 +6,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/ofkm/arcane-backend/internal/dto"
 	"github.com/ofkm/arcane-backend/internal/middleware"
+	"github.com/ofkm/arcane-backend/internal/models"
 	"github.com/ofkm/arcane-backend/internal/services"
 )
 
@@ -17,7 +18,7 @@ func NewImageUpdateHandler(group *gin.RouterGroup, imageUpdateService *services.
 	handler := &ImageUpdateHandler{imageUpdateService: imageUpdateService}
 
 	apiGroup := group.Group("/environments/:id/image-updates")
-	apiGroup.Use(authMiddleware.WithAdminNotRequired().Add())
+	apiGroup.Use(authMiddleware.WithPermissions(models.PermissionImagesRead).Add())
 	{
 		apiGroup.GET("/check", handler.CheckImageUpdate)
 		apiGroup.GET("/check/:imageId", handler.CheckImageUpdateByID)
@@ -7,6 +7,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/ofkm/arcane-backend/internal/dto"
 	"github.com/ofkm/arcane-backend/internal/middleware"
+	"github.com/ofkm/arcane-backend/internal/models"
 	"github.com/ofkm/arcane-backend/internal/services"
 	"github.com/ofkm/arcane-backend/internal/utils/pagination"
 )
@@ -20,14 +21,14 @@ func NewNetworkHandler(group *gin.RouterGroup, dockerService *services.DockerCli
 	handler := &NetworkHandler{dockerService: dockerService, networkService: networkService}
 
 	apiGroup := group.Group("/environments/:id/networks")
-	apiGroup.Use(authMiddleware.WithAdminNotRequired().Add())
+	readAuth := authMiddleware.WithPermissions(models.PermissionNetworksRead).Add()
 	{
-		apiGroup.GET("/counts", handler.GetNetworkUsageCounts)
-		apiGroup.GET("", handler.List)
-		apiGroup.GET("/:networkId", handler.GetByID)
-		apiGroup.POST("", handler.Create)
-		apiGroup.DELETE("/:networkId", handler.Remove)
-		apiGroup.POST("/prune", handler.Prune)
+		apiGroup.GET("/counts", readAuth, handler.GetNetworkUsageCounts)
+		apiGroup.GET("", readAuth, handler.List)
+		apiGroup.GET("/:networkId", readAuth, handler.GetByID)
+		apiGroup.POST("", authMiddleware.WithPermissions(models.PermissionNetworksCreate).Add(), handler.Create)
+		apiGroup.DELETE("/:networkId", authMiddleware.WithPermissions(models.PermissionNetworksDelete).Add(), handler.Remove)
+		apiGroup.POST("/prune", authMiddleware.WithPermissions(models.PermissionNetworksPrune).Add(), handler.Prune)
 	}
 }
 
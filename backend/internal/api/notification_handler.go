@@ -22,7 +22,7 @@ func NewNotificationHandler(group *gin.RouterGroup, notificationService *service
 	}
 
 	notifications := group.Group("/environments/:id/notifications")
-	notifications.Use(authMiddleware.WithAdminRequired().Add())
+	notifications.Use(authMiddleware.WithPermissions(models.PermissionNotificationsManage).Add())
 	{
 		notifications.GET("/settings", handler.GetAllSettings)
 		notifications.GET("/settings/:provider", handler.GetSettings)
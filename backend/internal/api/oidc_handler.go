@@ -97,7 +97,7 @@ func (h *OidcHandler) HandleOidcCallback(c *gin.Context) {
 		return
 	}
 
-	user, tokenPair, err := h.authService.OidcLogin(c.Request.Context(), *userInfo, tokenResp)
+	user, tokenPair, err := h.authService.OidcLogin(clientContext(c), *userInfo, tokenResp)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Authentication failed"})
 		return
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ofkm/arcane-backend/internal/dto"
+	"github.com/ofkm/arcane-backend/internal/middleware"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/services"
+	"github.com/ofkm/arcane-backend/internal/utils"
+)
+
+// ProjectGitHandler creates projects from Git repositories and syncs them.
+type ProjectGitHandler struct {
+	gitService     *services.ProjectGitService
+	projectService *services.ProjectService
+}
+
+func NewProjectGitHandler(group *gin.RouterGroup, gitService *services.ProjectGitService, projectService *services.ProjectService, authMiddleware *middleware.AuthMiddleware) {
+	handler := &ProjectGitHandler{gitService: gitService, projectService: projectService}
+
+	apiGroup := group.Group("/environments/:id/projects")
+	updateAuth := authMiddleware.WithPermissions(models.PermissionProjectsUpdate).Add()
+	{
+		apiGroup.POST("/git", authMiddleware.WithPermissions(models.PermissionProjectsCreate).Add(), handler.CreateProject)
+		apiGroup.PUT("/:projectId/git", updateAuth, handler.UpdateProject)
+		apiGroup.POST("/:projectId/git/sync", updateAuth, handler.SyncProject)
+	}
+}
+
+func (h *ProjectGitHandler) CreateProject(c *gin.Context) {
+	var req dto.CreateGitProjectDto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+	if !canDeployProjects(c, req.Deploy) {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	proj, err := h.gitService.CreateProject(c.Request.Context(), req, *user)
+	if err != nil {
+		c.JSON(projectGitErrorStatus(err), gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	if req.Deploy {
+		if err := h.projectService.DeployProject(c.Request.Context(), proj.ID, *user); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Project created but failed to deploy: " + err.Error()})
+			return
+		}
+	}
+
+	var response dto.CreateProjectReponseDto
+	if err := dto.MapStruct(proj, &response); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "failed to map response"})
+		return
+	}
+	response.Status = string(proj.Status)
+	response.StatusReason = proj.StatusReason
+	response.CreatedAt = proj.CreatedAt.Format(time.RFC3339)
+	response.UpdatedAt = proj.UpdatedAt.Format(time.RFC3339)
+	response.DirName = utils.DerefString(proj.DirName)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    response,
+	})
+}
+
+func (h *ProjectGitHandler) UpdateProject(c *gin.Context) {
+	var req dto.UpdateProjectGitDto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	projectID := c.Param("projectId")
+	if _, err := h.gitService.UpdateProject(c.Request.Context(), projectID, req); err != nil {
+		c.JSON(projectGitErrorStatus(err), gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	details, err := h.projectService.GetProjectDetails(c.Request.Context(), projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to fetch updated project details"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    details,
+	})
+}
+
+func (h *ProjectGitHandler) SyncProject(c *gin.Context) {
+	var req dto.SyncProjectGitDto
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+	}
+	if !canDeployProjects(c, req.Deploy) {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	result, err := h.gitService.SyncProject(c.Request.Context(), c.Param("projectId"), req.Deploy, *user)
+	if err != nil {
+		c.JSON(projectGitErrorStatus(err), gin.H{"success": false, "error": err.Error(), "data": result})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// canDeployProjects checks the caller may deploy projects when a request asks to, answering
+// with 403 otherwise.
+func canDeployProjects(c *gin.Context, deploy bool) bool {
+	if !deploy || models.HasPermission(middleware.GetCurrentUserPermissions(c), models.PermissionProjectsDeploy) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, models.APIError{
+		Code:    models.APIErrorCodeForbidden,
+		Message: "You don't have permission to access this resource",
+		Details: gin.H{"missingPermission": models.PermissionProjectsDeploy},
+	})
+	return false
+}
+
+func projectGitErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrProjectNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidGitProject), errors.Is(err, services.ErrNotGitProject):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrGitRemote):
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/ofkm/arcane-backend/internal/config"
 	"github.com/ofkm/arcane-backend/internal/dto"
 	"github.com/ofkm/arcane-backend/internal/middleware"
+	"github.com/ofkm/arcane-backend/internal/models"
 	"github.com/ofkm/arcane-backend/internal/services"
 	"github.com/ofkm/arcane-backend/internal/utils"
 	httputil "github.com/ofkm/arcane-backend/internal/utils/http"
@@ -47,22 +48,21 @@ func NewProjectHandler(group *gin.RouterGroup, projectService *services.ProjectS
 	}
 
 	apiGroup := group.Group("/environments/:id/projects")
-	apiGroup.Use(authMiddleware.WithAdminNotRequired().Add())
+	readAuth := authMiddleware.WithPermissions(models.PermissionProjectsRead).Add()
+	deployAuth := authMiddleware.WithPermissions(models.PermissionProjectsDeploy).Add()
 	{
-
-		apiGroup.GET("", handler.ListProjects)
-		apiGroup.GET("/counts", handler.GetProjectStatusCounts)
-		apiGroup.POST("/:projectId/up", handler.DeployProject)
-		apiGroup.POST("/:projectId/down", handler.DownProject)
-		apiGroup.POST("", handler.CreateProject)
-		apiGroup.GET("/:projectId", handler.GetProject)
-		apiGroup.POST("/:projectId/pull", handler.PullProjectImages)
-		apiGroup.POST("/:projectId/redeploy", handler.RedeployProject)
-		apiGroup.DELETE("/:projectId/destroy", handler.DestroyProject)
-		apiGroup.PUT("/:projectId", handler.UpdateProject)
-		apiGroup.POST("/:projectId/restart", handler.RestartProject)
-		apiGroup.GET("/:projectId/logs/ws", handler.GetProjectLogsWS)
-
+		apiGroup.GET("", readAuth, handler.ListProjects)
+		apiGroup.GET("/counts", readAuth, handler.GetProjectStatusCounts)
+		apiGroup.POST("/:projectId/up", deployAuth, handler.DeployProject)
+		apiGroup.POST("/:projectId/down", deployAuth, handler.DownProject)
+		apiGroup.POST("", authMiddleware.WithPermissions(models.PermissionProjectsCreate).Add(), handler.CreateProject)
+		apiGroup.GET("/:projectId", readAuth, handler.GetProject)
+		apiGroup.POST("/:projectId/pull", deployAuth, handler.PullProjectImages)
+		apiGroup.POST("/:projectId/redeploy", deployAuth, handler.RedeployProject)
+		apiGroup.DELETE("/:projectId/destroy", authMiddleware.WithPermissions(models.PermissionProjectsDelete).Add(), handler.DestroyProject)
+		apiGroup.PUT("/:projectId", authMiddleware.WithPermissions(models.PermissionProjectsUpdate).Add(), handler.UpdateProject)
+		apiGroup.POST("/:projectId/restart", deployAuth, handler.RestartProject)
+		apiGroup.GET("/:projectId/logs/ws", readAuth, handler.GetProjectLogsWS)
 	}
 }
 
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ofkm/arcane-backend/internal/dto"
+	"github.com/ofkm/arcane-backend/internal/middleware"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/services"
+)
+
+// ProjectMigrationHandler moves projects between environments.
+type ProjectMigrationHandler struct {
+	migrationService *services.ProjectMigrationService
+}
+
+func NewProjectMigrationHandler(group *gin.RouterGroup, migrationService *services.ProjectMigrationService, authMiddleware *middleware.AuthMiddleware) {
+	handler := &ProjectMigrationHandler{migrationService: migrationService}
+
+	group.POST("/projects/migrate", authMiddleware.WithPermissions(models.PermissionProjectsCreate).Add(), handler.Migrate)
+}
+
+func (h *ProjectMigrationHandler) Migrate(c *gin.Context) {
+	var req dto.MigrateProjectDto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "data": gin.H{"error": "Invalid request format: " + err.Error()}})
+		return
+	}
+
+	result, err := h.migrationService.Migrate(c.Request.Context(), bulkCaller(c), req)
+	switch {
+	case errors.Is(err, services.ErrInvalidProjectMigration):
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "data": gin.H{"error": err.Error()}})
+		return
+	case errors.Is(err, services.ErrMigrationEnvironment):
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "data": gin.H{"error": err.Error()}})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "data": gin.H{"error": "Migration failed: " + err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": result})
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ofkm/arcane-backend/internal/middleware"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/services"
+)
+
+const (
+	webhookTokenHeader     = "X-Arcane-Webhook-Token"
+	webhookSignatureHeader = "X-Arcane-Signature"
+	// githubSignatureHeader is accepted as well so that repository webhooks work unchanged.
+	githubSignatureHeader = "X-Hub-Signature-256"
+	// maxWebhookBody caps the payloads read to check their signature.
+	maxWebhookBody = 1 << 20
+)
+
+// ProjectWebhookHandler serves the per-project redeploy webhooks and their management.
+type ProjectWebhookHandler struct {
+	webhookService *services.ProjectWebhookService
+}
+
+func NewProjectWebhookHandler(group *gin.RouterGroup, webhookService *services.ProjectWebhookService, authMiddleware *middleware.AuthMiddleware) {
+	handler := &ProjectWebhookHandler{webhookService: webhookService}
+
+	apiGroup := group.Group("/environments/:id/projects/:projectId/webhook")
+	updateAuth := authMiddleware.WithPermissions(models.PermissionProjectsUpdate).Add()
+	{
+		// The webhook itself is called without a session; the token or signature authenticates it.
+		apiGroup.POST("", handler.Trigger)
+		apiGroup.GET("", authMiddleware.WithPermissions(models.PermissionProjectsRead).Add(), handler.GetWebhook)
+		apiGroup.POST("/token", updateAuth, handler.RegenerateToken)
+		apiGroup.DELETE("", updateAuth, handler.DisableWebhook)
+	}
+}
+
+// Trigger queues a redeploy of the project. The token is taken from the X-Arcane-Webhook-Token
+// header, never the URL, so it does not end up in access logs; signed calls carry
+// X-Arcane-Signature or X-Hub-Signature-256 instead. Services are picked with repeated or comma-separated services
+// query parameters, or a JSON body with a services list.
+func (h *ProjectWebhookHandler) Trigger(c *gin.Context) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookBody))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"success": false, "error": "Webhook payload is too large"})
+		return
+	}
+
+	call := services.WebhookCall{
+		Token:     c.GetHeader(webhookTokenHeader),
+		Signature: c.GetHeader(webhookSignatureHeader),
+		Body:      body,
+		ClientIP:  c.ClientIP(),
+	}
+	if call.Signature == "" {
+		call.Signature = c.GetHeader(githubSignatureHeader)
+	}
+	for _, value := range c.QueryArray("services") {
+		call.Services = append(call.Services, strings.Split(value, ",")...)
+	}
+	var payload struct {
+		Services []string `json:"services"`
+	}
+	if strings.HasPrefix(c.ContentType(), "application/json") && json.Unmarshal(body, &payload) == nil {
+		call.Services = append(call.Services, payload.Services...)
+	}
+
+	started, err := h.webhookService.Trigger(c.Request.Context(), c.Param("projectId"), call)
+	switch {
+	case errors.Is(err, services.ErrWebhookNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": err.Error()})
+		return
+	case errors.Is(err, services.ErrWebhookUnauthorized):
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": err.Error()})
+		return
+	case errors.Is(err, services.ErrUnknownProjectService):
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to queue redeploy"})
+		return
+	}
+
+	message := "Redeploy started"
+	if !started {
+		message = "Redeploy queued after the one in progress"
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"data":    gin.H{"message": message},
+	})
+}
+
+func (h *ProjectWebhookHandler) GetWebhook(c *gin.Context) {
+	enabled, err := h.webhookService.Enabled(c.Request.Context(), c.Param("projectId"))
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    gin.H{"enabled": enabled},
+	})
+}
+
+func (h *ProjectWebhookHandler) RegenerateToken(c *gin.Context) {
+	user, _ := middleware.GetCurrentUser(c)
+	token, err := h.webhookService.RegenerateToken(c.Request.Context(), c.Param("projectId"), *user)
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    gin.H{"token": token},
+	})
+}
+
+func (h *ProjectWebhookHandler) DisableWebhook(c *gin.Context) {
+	user, _ := middleware.GetCurrentUser(c)
+	if err := h.webhookService.Disable(c.Request.Context(), c.Param("projectId"), *user); err != nil {
+		c.JSON(webhookErrorStatus(err), gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    gin.H{"message": "Webhook disabled"},
+	})
+}
+
+func webhookErrorStatus(err error) int {
+	if errors.Is(err, services.ErrProjectNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ofkm/arcane-backend/internal/dto"
+	"github.com/ofkm/arcane-backend/internal/middleware"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/services"
+)
+
+type RoleHandler struct {
+	roleService  *services.RoleService
+	auditService *services.AuditService
+}
+
+func NewRoleHandler(group *gin.RouterGroup, roleService *services.RoleService, auditService *services.AuditService, authMiddleware *middleware.AuthMiddleware) {
+	handler := &RoleHandler{roleService: roleService, auditService: auditService}
+
+	apiGroup := group.Group("/roles")
+	readAuth := authMiddleware.WithPermissions(models.PermissionUsersRead).Add()
+	manageAuth := authMiddleware.WithPermissions(models.PermissionRolesManage).Add()
+	{
+		apiGroup.GET("", readAuth, handler.ListRoles)
+		apiGroup.GET("/permissions", readAuth, handler.ListPermissions)
+		apiGroup.GET("/:name", readAuth, handler.GetRole)
+		apiGroup.POST("", manageAuth, handler.CreateRole)
+		apiGroup.PUT("/:name", manageAuth, handler.UpdateRole)
+		apiGroup.DELETE("/:name", manageAuth, handler.DeleteRole)
+	}
+}
+
+func (h *RoleHandler) ListRoles(c *gin.Context) {
+	roles, err := h.roleService.ListRoles(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"data":    gin.H{"error": "Failed to list roles: " + err.Error()},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    roles,
+	})
+}
+
+func (h *RoleHandler) ListPermissions(c *gin.Context) {
+	perms := make([]string, len(models.AllPermissions))
+	for i, p := range models.AllPermissions {
+		perms[i] = string(p)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    perms,
+	})
+}
+
+func (h *RoleHandler) GetRole(c *gin.Context) {
+	role, err := h.roleService.GetRole(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    role,
+	})
+}
+
+func (h *RoleHandler) CreateRole(c *gin.Context) {
+	var req dto.CreateRoleDto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"data":    gin.H{"error": "Invalid request format"},
+		})
+		return
+	}
+
+	role, err := h.roleService.CreateRole(c.Request.Context(), req, middleware.GetCurrentUserPermissions(c))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	recordAudit(c, h.auditService, services.AuditRecord{
+		Action:       "role.create",
+		ResourceType: "role",
+		ResourceID:   role.ID,
+		ResourceName: role.Name,
+		Metadata:     models.JSON{"permissions": role.Permissions},
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    role,
+	})
+}
+
+func (h *RoleHandler) UpdateRole(c *gin.Context) {
+	var req dto.UpdateRoleDto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"data":    gin.H{"error": "Invalid request format"},
+		})
+		return
+	}
+
+	previous, err := h.roleService.GetRole(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	role, err := h.roleService.UpdateRole(c.Request.Context(), c.Param("name"), req, middleware.GetCurrentUserPermissions(c))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	recordAudit(c, h.auditService, services.AuditRecord{
+		Action:       "role.update",
+		ResourceType: "role",
+		ResourceID:   role.ID,
+		ResourceName: role.Name,
+		Metadata:     models.JSON{"permissions": role.Permissions, "previousPermissions": previous.Permissions},
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    role,
+	})
+}
+
+func (h *RoleHandler) DeleteRole(c *gin.Context) {
+	name := c.Param("name")
+	if err := h.roleService.DeleteRole(c.Request.Context(), name); err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	recordAudit(c, h.auditService, services.AuditRecord{
+		Action:       "role.delete",
+		ResourceType: "role",
+		ResourceName: name,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    gin.H{"message": "Role deleted successfully"},
+	})
+}
+
+func (h *RoleHandler) writeError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrRoleNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrRoleBuiltin), errors.Is(err, services.ErrPermissionEscalation):
+		status = http.StatusForbidden
+	case errors.Is(err, services.ErrRoleAlreadyExists):
+		status = http.StatusConflict
+	default:
+		var validationErr *models.ValidationError
+		if errors.As(err, &validationErr) {
+			status = http.StatusBadRequest
+		}
+	}
+
+	c.JSON(status, gin.H{
+		"success": false,
+		"data":    gin.H{"error": err.Error()},
+	})
+}
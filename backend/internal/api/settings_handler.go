@@ -9,30 +9,33 @@ import (
 	"github.com/ofkm/arcane-backend/internal/config"
 	"github.com/ofkm/arcane-backend/internal/dto"
 	"github.com/ofkm/arcane-backend/internal/middleware"
+	"github.com/ofkm/arcane-backend/internal/models"
 	"github.com/ofkm/arcane-backend/internal/services"
 )
 
 type SettingsHandler struct {
 	settingsService       *services.SettingsService
 	settingsSearchService *services.SettingsSearchService
+	auditService          *services.AuditService
 }
 
-func NewSettingsHandler(group *gin.RouterGroup, settingsService *services.SettingsService, settingsSearchService *services.SettingsSearchService, authMiddleware *middleware.AuthMiddleware) {
+func NewSettingsHandler(group *gin.RouterGroup, settingsService *services.SettingsService, settingsSearchService *services.SettingsSearchService, auditService *services.AuditService, authMiddleware *middleware.AuthMiddleware) {
 	handler := &SettingsHandler{
 		settingsService:       settingsService,
 		settingsSearchService: settingsSearchService,
+		auditService:          auditService,
 	}
 
 	apiGroup := group.Group("/environments/:id/settings")
 
 	apiGroup.GET("/public", handler.GetPublicSettings)
-	apiGroup.GET("", authMiddleware.WithAdminNotRequired().Add(), handler.GetSettings)
-	apiGroup.PUT("", authMiddleware.WithAdminRequired().Add(), handler.UpdateSettings)
+	apiGroup.GET("", authMiddleware.WithPermissions(models.PermissionSettingsRead).Add(), handler.GetSettings)
+	apiGroup.PUT("", authMiddleware.WithPermissions(models.PermissionSettingsUpdate).Add(), handler.UpdateSettings)
 
 	// Also expose top-level settings search and categories endpoints under /api/settings
 	top := group.Group("/settings")
-	top.POST("/search", authMiddleware.WithAdminNotRequired().Add(), handler.Search)
-	top.GET("/categories", authMiddleware.WithAdminNotRequired().Add(), handler.GetCategories)
+	top.POST("/search", authMiddleware.Add(), handler.Search)
+	top.GET("/categories", authMiddleware.Add(), handler.GetCategories)
 }
 
 // Search delegates to the settings search service and returns relevance-scored results
@@ -125,8 +128,12 @@ func (h *SettingsHandler) UpdateSettings(c *gin.Context) {
 
 	if environmentID != "0" {
 		if req.AuthLocalEnabled != nil || req.AuthOidcEnabled != nil ||
-			req.AuthSessionTimeout != nil || req.AuthPasswordPolicy != nil ||
-			req.AuthOidcConfig != nil {
+			req.AuthSessionTimeout != nil || req.AuthPasswordPolicy != nil || req.AuthPasswordHistory != nil ||
+			req.AuthOidcConfig != nil || req.AuthLdapEnabled != nil || req.AuthLdapConfig != nil ||
+			req.AuthRequireTwoFactor != nil || req.AuthLoginMaxAttempts != nil ||
+			req.AuthLoginLockoutDuration != nil || req.AuthLoginIpMaxAttempts != nil ||
+			req.AuthLoginAttemptWindow != nil || req.AuthProxyEnabled != nil || req.AuthProxyConfig != nil ||
+			req.AuthJwtRotationInterval != nil || req.AuthJwtGracePeriod != nil {
 			c.JSON(http.StatusForbidden, gin.H{
 				"success": false,
 				"data":    dto.MessageDto{Message: "Authentication settings can only be updated from the main environment"},
@@ -144,6 +151,18 @@ func (h *SettingsHandler) UpdateSettings(c *gin.Context) {
 		return
 	}
 
+	// Only the keys are recorded; values may be secrets.
+	keys := make([]string, 0, len(updatedSettings))
+	for _, setting := range updatedSettings {
+		keys = append(keys, setting.Key)
+	}
+	recordAudit(c, h.auditService, services.AuditRecord{
+		Action:        "settings.update",
+		ResourceType:  "settings",
+		EnvironmentID: environmentID,
+		Metadata:      models.JSON{"keys": keys},
+	})
+
 	settingDtos := make([]dto.SettingDto, 0, len(updatedSettings))
 	for _, setting := range updatedSettings {
 		settingDtos = append(settingDtos, dto.SettingDto{
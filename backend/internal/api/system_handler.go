@@ -83,20 +83,21 @@ func NewSystemHandler(group *gin.RouterGroup, dockerService *services.DockerClie
 	}
 
 	apiGroup := group.Group("/environments/:id/system")
-	apiGroup.Use(authMiddleware.WithAdminNotRequired().Add())
+	readAuth := authMiddleware.WithPermissions(models.PermissionSystemRead).Add()
+	startAuth := authMiddleware.WithPermissions(models.PermissionContainersStart).Add()
+	upgradeAuth := authMiddleware.WithPermissions(models.PermissionSystemUpgrade).Add()
 	{
-		apiGroup.HEAD("/health", handler.Health)
-		apiGroup.GET("/stats/ws", handler.Stats)
-		apiGroup.GET("/docker/info", handler.GetDockerInfo)
-		apiGroup.POST("/prune", handler.PruneAll)
-		apiGroup.POST("/containers/start-all", handler.StartAllContainers)
-		apiGroup.POST("/containers/start-stopped", handler.StartAllStoppedContainers)
-		apiGroup.POST("/containers/stop-all", handler.StopAllContainers)
-		apiGroup.POST("/convert", handler.ConvertDockerRun)
-
-		// Upgrade endpoints (admin required)
-		apiGroup.GET("/upgrade/check", authMiddleware.WithAdminRequired().Add(), handler.CheckUpgradeAvailable)
-		apiGroup.POST("/upgrade", authMiddleware.WithAdminRequired().Add(), handler.TriggerUpgrade)
+		apiGroup.HEAD("/health", authMiddleware.Add(), handler.Health)
+		apiGroup.GET("/stats/ws", readAuth, handler.Stats)
+		apiGroup.GET("/docker/info", readAuth, handler.GetDockerInfo)
+		apiGroup.POST("/prune", authMiddleware.WithPermissions(models.PermissionSystemPrune).Add(), handler.PruneAll)
+		apiGroup.POST("/containers/start-all", startAuth, handler.StartAllContainers)
+		apiGroup.POST("/containers/start-stopped", startAuth, handler.StartAllStoppedContainers)
+		apiGroup.POST("/containers/stop-all", authMiddleware.WithPermissions(models.PermissionContainersStop).Add(), handler.StopAllContainers)
+		apiGroup.POST("/convert", readAuth, handler.ConvertDockerRun)
+
+		apiGroup.GET("/upgrade/check", upgradeAuth, handler.CheckUpgradeAvailable)
+		apiGroup.POST("/upgrade", upgradeAuth, handler.TriggerUpgrade)
 	}
 }
 
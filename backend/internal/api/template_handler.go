@@ -23,25 +23,26 @@ func NewTemplateHandler(group *gin.RouterGroup, templateService *services.Templa
 
 	apiGroup.GET("/fetch", handler.FetchRegistry)
 
-	apiGroup.GET("", authMiddleware.WithAdminNotRequired().WithSuccessOptional().Add(), handler.GetAllTemplatesPaginated)
-	apiGroup.GET("/all", authMiddleware.WithAdminNotRequired().WithSuccessOptional().Add(), handler.GetAllTemplates)
-	apiGroup.GET("/:id", authMiddleware.WithAdminNotRequired().WithSuccessOptional().Add(), handler.GetTemplate)
-	apiGroup.GET("/:id/content", authMiddleware.WithAdminNotRequired().WithSuccessOptional().Add(), handler.GetTemplateContent)
+	apiGroup.GET("", authMiddleware.WithSuccessOptional().Add(), handler.GetAllTemplatesPaginated)
+	apiGroup.GET("/all", authMiddleware.WithSuccessOptional().Add(), handler.GetAllTemplates)
+	apiGroup.GET("/:id", authMiddleware.WithSuccessOptional().Add(), handler.GetTemplate)
+	apiGroup.GET("/:id/content", authMiddleware.WithSuccessOptional().Add(), handler.GetTemplateContent)
 
-	apiGroup.Use(authMiddleware.WithAdminNotRequired().Add())
+	readAuth := authMiddleware.WithPermissions(models.PermissionTemplatesRead).Add()
+	manageAuth := authMiddleware.WithPermissions(models.PermissionTemplatesManage).Add()
 	{
-		apiGroup.POST("", handler.CreateTemplate)
-		apiGroup.PUT("/:id", handler.UpdateTemplate)
-		apiGroup.DELETE("/:id", handler.DeleteTemplate)
-		apiGroup.POST("/:id/download", handler.DownloadTemplate)
-		apiGroup.GET("/default", handler.GetDefaultTemplates)
-		apiGroup.POST("/default", handler.SaveDefaultTemplates)
-		apiGroup.GET("/registries", handler.GetRegistries)
-		apiGroup.POST("/registries", handler.CreateRegistry)
-		apiGroup.PUT("/registries/:id", handler.UpdateRegistry)
-		apiGroup.DELETE("/registries/:id", handler.DeleteRegistry)
-		apiGroup.GET("/variables", handler.GetGlobalVariables)
-		apiGroup.PUT("/variables", handler.UpdateGlobalVariables)
+		apiGroup.POST("", manageAuth, handler.CreateTemplate)
+		apiGroup.PUT("/:id", manageAuth, handler.UpdateTemplate)
+		apiGroup.DELETE("/:id", manageAuth, handler.DeleteTemplate)
+		apiGroup.POST("/:id/download", manageAuth, handler.DownloadTemplate)
+		apiGroup.GET("/default", readAuth, handler.GetDefaultTemplates)
+		apiGroup.POST("/default", manageAuth, handler.SaveDefaultTemplates)
+		apiGroup.GET("/registries", readAuth, handler.GetRegistries)
+		apiGroup.POST("/registries", manageAuth, handler.CreateRegistry)
+		apiGroup.PUT("/registries/:id", manageAuth, handler.UpdateRegistry)
+		apiGroup.DELETE("/registries/:id", manageAuth, handler.DeleteRegistry)
+		apiGroup.GET("/variables", readAuth, handler.GetGlobalVariables)
+		apiGroup.PUT("/variables", manageAuth, handler.UpdateGlobalVariables)
 	}
 }
 
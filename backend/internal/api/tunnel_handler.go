@@ -0,0 +1,54 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"github.com/ofkm/arcane-backend/internal/services"
+	"github.com/ofkm/arcane-backend/internal/utils/tunnel"
+)
+
+type TunnelHandler struct {
+	tunnelService *services.TunnelService
+	upgrader      websocket.Upgrader
+}
+
+// NewTunnelHandler registers the endpoint agents dial to open their tunnel. Agents authenticate
+// with their agent token rather than a user session.
+func NewTunnelHandler(group *gin.RouterGroup, tunnelService *services.TunnelService) {
+	handler := &TunnelHandler{
+		tunnelService: tunnelService,
+		// Agents are not browsers and send no Origin header; the default check rejects
+		// cross-origin browser requests.
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  32 * 1024,
+			WriteBufferSize: 32 * 1024,
+		},
+	}
+
+	group.GET("/tunnel/connect", handler.Connect)
+}
+
+func (h *TunnelHandler) Connect(c *gin.Context) {
+	env, err := h.tunnelService.AuthenticateAgent(c.Request.Context(), c.GetHeader("X-Arcane-Agent-Token"))
+	if err != nil {
+		if errors.Is(err, services.ErrTunnelUnauthorized) {
+			c.JSON(http.StatusUnauthorized, gin.H{"success": false, "data": gin.H{"error": "Invalid agent token"}})
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "Failed to authenticate agent tunnel", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "data": gin.H{"error": "Failed to authenticate agent"}})
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+
+	h.tunnelService.Serve(c.Request.Context(), env, tunnel.NewSession(conn, false))
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/ofkm/arcane-backend/internal/dto"
 	"github.com/ofkm/arcane-backend/internal/middleware"
+	"github.com/ofkm/arcane-backend/internal/models"
 	"github.com/ofkm/arcane-backend/internal/services"
 )
 
@@ -18,11 +19,11 @@ func NewUpdaterHandler(group *gin.RouterGroup, updaterService *services.UpdaterS
 	handler := &UpdaterHandler{updaterService: updaterService}
 
 	apiGroup := group.Group("/environments/:id/updater")
-	apiGroup.Use(authMiddleware.WithAdminNotRequired().Add())
+	readAuth := authMiddleware.WithPermissions(models.PermissionUpdaterRead).Add()
 	{
-		apiGroup.POST("/run", handler.Run)
-		apiGroup.GET("/history", handler.History)
-		apiGroup.GET("/status", handler.Status)
+		apiGroup.POST("/run", authMiddleware.WithPermissions(models.PermissionUpdaterRun).Add(), handler.Run)
+		apiGroup.GET("/history", readAuth, handler.History)
+		apiGroup.GET("/status", readAuth, handler.Status)
 	}
 }
 
@@ -1,7 +1,9 @@
 package api
 
 import (
+	"errors"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,21 +15,32 @@ import (
 )
 
 type UserHandler struct {
-	userService *services.UserService
+	userService      *services.UserService
+	roleService      *services.RoleService
+	twoFactorService *services.TwoFactorService
+	authService      *services.AuthService
+	sessionService   *services.SessionService
+	loginThrottle    *services.LoginThrottleService
+	auditService     *services.AuditService
 }
 
-func NewUserHandler(group *gin.RouterGroup, userService *services.UserService, authMiddleware *middleware.AuthMiddleware) {
+func NewUserHandler(group *gin.RouterGroup, userService *services.UserService, roleService *services.RoleService, twoFactorService *services.TwoFactorService, authService *services.AuthService, sessionService *services.SessionService, loginThrottle *services.LoginThrottleService, auditService *services.AuditService, authMiddleware *middleware.AuthMiddleware) {
 
-	handler := &UserHandler{userService: userService}
+	handler := &UserHandler{userService: userService, roleService: roleService, twoFactorService: twoFactorService, authService: authService, sessionService: sessionService, loginThrottle: loginThrottle, auditService: auditService}
 
 	apiGroup := group.Group("/users")
-	apiGroup.Use(authMiddleware.WithAdminRequired().Add())
+	readAuth := authMiddleware.WithPermissions(models.PermissionUsersRead).Add()
+	manageAuth := authMiddleware.WithPermissions(models.PermissionUsersManage).Add()
 	{
-		apiGroup.GET("", handler.ListUsers)
-		apiGroup.POST("", handler.CreateUser)
-		apiGroup.GET("/:id", handler.GetUser)
-		apiGroup.PUT("/:id", handler.UpdateUser)
-		apiGroup.DELETE("/:id", handler.DeleteUser)
+		apiGroup.GET("", readAuth, handler.ListUsers)
+		apiGroup.POST("", manageAuth, handler.CreateUser)
+		apiGroup.GET("/:id", readAuth, handler.GetUser)
+		apiGroup.PUT("/:id", manageAuth, handler.UpdateUser)
+		apiGroup.DELETE("/:id", manageAuth, handler.DeleteUser)
+		apiGroup.DELETE("/:id/2fa", manageAuth, handler.ResetTwoFactor)
+		apiGroup.GET("/:id/sessions", manageAuth, handler.ListSessions)
+		apiGroup.DELETE("/:id/sessions", manageAuth, handler.RevokeSessions)
+		apiGroup.POST("/:id/unlock", manageAuth, handler.UnlockUser)
 	}
 }
 
@@ -60,8 +73,21 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 		return
 	}
 
-	hashedPassword, err := h.userService.HashPassword(req.Password)
-	if err != nil {
+	user := &models.User{
+		Username:    req.Username,
+		DisplayName: req.DisplayName,
+		Email:       req.Email,
+		Roles:       req.Roles,
+		Locale:      req.Locale,
+		BaseModel: models.BaseModel{
+			CreatedAt: time.Now(),
+		},
+	}
+
+	if err := h.userService.SetPassword(c.Request.Context(), user, req.Password); err != nil {
+		if writePasswordPolicyError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"data":    gin.H{"error": "Failed to hash password"},
@@ -69,20 +95,19 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 		return
 	}
 
-	user := &models.User{
-		Username:     req.Username,
-		PasswordHash: hashedPassword,
-		DisplayName:  req.DisplayName,
-		Email:        req.Email,
-		Roles:        req.Roles,
-		Locale:       req.Locale,
-		BaseModel: models.BaseModel{
-			CreatedAt: time.Now(),
-		},
+	if user.Roles == nil {
+		user.Roles = []string{models.RoleUser}
 	}
 
-	if user.Roles == nil {
-		user.Roles = []string{"user"}
+	if err := h.roleService.ValidateRoleNames(c.Request.Context(), user.Roles); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"data":    gin.H{"error": err.Error()},
+		})
+		return
+	}
+	if !h.checkRoleAssignment(c, nil, user.Roles) {
+		return
 	}
 
 	createdUser, err := h.userService.CreateUser(c.Request.Context(), user)
@@ -94,6 +119,14 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 		return
 	}
 
+	recordAudit(c, h.auditService, services.AuditRecord{
+		Action:       "user.create",
+		ResourceType: "user",
+		ResourceID:   createdUser.ID,
+		ResourceName: createdUser.Username,
+		Metadata:     models.JSON{"roles": createdUser.Roles},
+	})
+
 	out, err := dto.MapOne[*models.User, dto.UserResponseDto](createdUser)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -163,7 +196,20 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 	if req.Email != nil {
 		user.Email = req.Email
 	}
+	previousRoles := slices.Clone(user.Roles)
+	revokeSessions := false
 	if req.Roles != nil {
+		if err := h.roleService.ValidateRoleNames(c.Request.Context(), req.Roles); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"data":    gin.H{"error": err.Error()},
+			})
+			return
+		}
+		if !h.checkRoleAssignment(c, user.Roles, req.Roles) {
+			return
+		}
+		revokeSessions = services.RolesRemoved(user.Roles, req.Roles)
 		user.Roles = req.Roles
 	}
 	if req.Locale != nil {
@@ -171,16 +217,19 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 	}
 
 	if req.Password != nil && *req.Password != "" {
-		hashedPassword, err := h.userService.HashPassword(*req.Password)
-		if err != nil {
+		if err := h.userService.SetPassword(c.Request.Context(), user, *req.Password); err != nil {
+			if writePasswordPolicyError(c, err) {
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"success": false,
 				"data":    gin.H{"error": "Failed to hash password"},
 			})
 			return
 		}
-		user.PasswordHash = hashedPassword
+		revokeSessions = true
 	}
+	passwordReset := req.Password != nil && *req.Password != ""
 
 	now := time.Now()
 	user.UpdatedAt = &now
@@ -194,6 +243,31 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		return
 	}
 
+	// Role changes are recorded with the roles before and after; the password never is.
+	metadata := models.JSON{"passwordReset": passwordReset}
+	if req.Roles != nil {
+		metadata["roles"] = updatedUser.Roles
+		metadata["previousRoles"] = previousRoles
+	}
+	recordAudit(c, h.auditService, services.AuditRecord{
+		Action:       "user.update",
+		ResourceType: "user",
+		ResourceID:   updatedUser.ID,
+		ResourceName: updatedUser.Username,
+		Metadata:     metadata,
+	})
+
+	// Existing sessions must not keep a removed role or survive an administrative password reset.
+	if revokeSessions {
+		if err := h.authService.RevokeUserSessions(c.Request.Context(), updatedUser, "", "user_updated"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"data":    gin.H{"error": "User updated but failed to revoke sessions"},
+			})
+			return
+		}
+	}
+
 	out, err := dto.MapOne[*models.User, dto.UserResponseDto](updatedUser)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -212,6 +286,11 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 func (h *UserHandler) DeleteUser(c *gin.Context) {
 	userID := c.Param("id")
 
+	username := ""
+	if user, err := h.userService.GetUserByID(c.Request.Context(), userID); err == nil {
+		username = user.Username
+	}
+
 	err := h.userService.DeleteUser(c.Request.Context(), userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -221,8 +300,141 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 		return
 	}
 
+	recordAudit(c, h.auditService, services.AuditRecord{
+		Action:       "user.delete",
+		ResourceType: "user",
+		ResourceID:   userID,
+		ResourceName: username,
+	})
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"data":    gin.H{"message": "User deleted successfully"},
 	})
 }
+
+func (h *UserHandler) ResetTwoFactor(c *gin.Context) {
+	userID := c.Param("id")
+	if err := h.twoFactorService.Reset(c.Request.Context(), userID); err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"data":    gin.H{"error": "User not found"},
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"data":    gin.H{"error": "Failed to reset two-factor authentication"},
+		})
+		return
+	}
+
+	recordAudit(c, h.auditService, services.AuditRecord{
+		Action:       "user.two_factor_reset",
+		ResourceType: "user",
+		ResourceID:   userID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    gin.H{"message": "Two-factor authentication reset successfully"},
+	})
+}
+
+func (h *UserHandler) ListSessions(c *gin.Context) {
+	sessions, err := h.sessionService.ListSessions(c.Request.Context(), c.Param("id"), "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"data":    gin.H{"error": "Failed to list sessions"},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    sessions,
+	})
+}
+
+// RevokeSessions signs a user out of every session.
+func (h *UserHandler) RevokeSessions(c *gin.Context) {
+	user, err := h.userService.GetUserByID(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"data":    gin.H{"error": "User not found"},
+		})
+		return
+	}
+
+	if err := h.authService.RevokeUserSessions(c.Request.Context(), user, "", "admin_request"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"data":    gin.H{"error": "Failed to revoke sessions"},
+		})
+		return
+	}
+
+	recordAudit(c, h.auditService, services.AuditRecord{
+		Action:       "user.sessions_revoke",
+		ResourceType: "user",
+		ResourceID:   user.ID,
+		ResourceName: user.Username,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    gin.H{"message": "Sessions revoked successfully"},
+	})
+}
+
+// checkRoleAssignment answers with 403 when the roles being added to a user would grant
+// permissions the caller does not hold.
+func (h *UserHandler) checkRoleAssignment(c *gin.Context, current, requested []string) bool {
+	err := h.roleService.CheckRoleAssignment(c.Request.Context(), middleware.GetCurrentUserPermissions(c), current, requested)
+	if err == nil {
+		return true
+	}
+
+	status := http.StatusInternalServerError
+	if errors.Is(err, services.ErrPermissionEscalation) {
+		status = http.StatusForbidden
+	}
+	c.JSON(status, gin.H{
+		"success": false,
+		"data":    gin.H{"error": err.Error()},
+	})
+	return false
+}
+
+// UnlockUser lifts a lockout caused by failed logins so the user can sign in again right away.
+func (h *UserHandler) UnlockUser(c *gin.Context) {
+	userID := c.Param("id")
+	if err := h.loginThrottle.Unlock(c.Request.Context(), userID); err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"data":    gin.H{"error": "User not found"},
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"data":    gin.H{"error": "Failed to unlock user"},
+		})
+		return
+	}
+
+	recordAudit(c, h.auditService, services.AuditRecord{
+		Action:       "user.unlock",
+		ResourceType: "user",
+		ResourceID:   userID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    gin.H{"message": "User unlocked successfully"},
+	})
+}
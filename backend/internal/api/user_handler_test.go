@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	glsqlite "github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/ofkm/arcane-backend/internal/config"
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/dto"
+	"github.com/ofkm/arcane-backend/internal/middleware"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/services"
+	"github.com/ofkm/arcane-backend/resources"
+)
+
+func TestUserHandler_RoleGrantIsAudited(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+
+	gdb, err := gorm.Open(glsqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, gdb.AutoMigrate(&models.User{}, &models.Role{}, &models.ApiToken{}, &models.Event{}))
+	migration, err := resources.FS.ReadFile("migrations/sqlite/033_add_audit_log.up.sql")
+	require.NoError(t, err)
+	require.NoError(t, gdb.Exec(string(migration)).Error)
+	db := &database.DB{DB: gdb}
+
+	userService := services.NewUserService(db)
+	roleService := services.NewRoleService(db)
+	apiTokenService := services.NewApiTokenService(db)
+	auditService := services.NewAuditService(db, services.NewEventService(db))
+
+	admin, err := userService.CreateUserWithPassword("root", "correct-horse", "root@example.com", models.RoleAdmin, "Root")
+	require.NoError(t, err)
+	target, err := userService.CreateUserWithPassword("dave", "correct-horse", "dave@example.com", models.RoleUser, "Dave")
+	require.NoError(t, err)
+	token, err := apiTokenService.CreateToken(ctx, admin.ID, dto.CreateApiTokenDto{Name: "ci", Scopes: []string{"*"}})
+	require.NoError(t, err)
+
+	router := gin.New()
+	authMiddleware := middleware.NewAuthMiddleware(nil, roleService, nil, apiTokenService, nil, nil, nil, &config.Config{})
+	NewUserHandler(router.Group("/api"), userService, roleService, nil, nil, nil, nil, auditService, authMiddleware)
+
+	req := httptest.NewRequest(http.MethodPut, "/api/users/"+target.ID, strings.NewReader(`{"roles":["user","deployer"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token.Token)
+	req.RemoteAddr = "203.0.113.9:40000"
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var entry models.AuditEntry
+	require.NoError(t, gdb.Where("action = ?", "user.update").First(&entry).Error)
+	require.Equal(t, "root", *entry.ActorUsername)
+	require.Equal(t, target.ID, *entry.ResourceID)
+	require.Equal(t, "203.0.113.9", entry.IPAddress)
+	require.ElementsMatch(t, []interface{}{"user", "deployer"}, entry.Metadata["roles"])
+	require.ElementsMatch(t, []interface{}{"user"}, entry.Metadata["previousRoles"])
+
+	result, err := auditService.Verify(ctx)
+	require.NoError(t, err)
+	require.True(t, result.Valid)
+	require.EqualValues(t, 1, result.Entries)
+}
@@ -1,12 +1,17 @@
 package api
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strings"
 
 	"github.com/docker/docker/api/types/volume"
 	"github.com/gin-gonic/gin"
 	"github.com/ofkm/arcane-backend/internal/dto"
 	"github.com/ofkm/arcane-backend/internal/middleware"
+	"github.com/ofkm/arcane-backend/internal/models"
 	"github.com/ofkm/arcane-backend/internal/services"
 	"github.com/ofkm/arcane-backend/internal/utils/pagination"
 )
@@ -20,15 +25,17 @@ func NewVolumeHandler(group *gin.RouterGroup, dockerService *services.DockerClie
 	handler := &VolumeHandler{dockerService: dockerService, volumeService: volumeService}
 
 	apiGroup := group.Group("/environments/:id/volumes")
-	apiGroup.Use(authMiddleware.WithAdminNotRequired().Add())
+	readAuth := authMiddleware.WithPermissions(models.PermissionVolumesRead).Add()
 	{
-		apiGroup.GET("/counts", handler.GetVolumeUsageCounts)
-		apiGroup.GET("", handler.List)
-		apiGroup.GET("/:volumeName", handler.GetByName)
-		apiGroup.POST("", handler.Create)
-		apiGroup.DELETE("/:volumeName", handler.Remove)
-		apiGroup.POST("/prune", handler.Prune)
-		apiGroup.GET("/:volumeName/usage", handler.GetUsage)
+		apiGroup.GET("/counts", readAuth, handler.GetVolumeUsageCounts)
+		apiGroup.GET("", readAuth, handler.List)
+		apiGroup.GET("/:volumeName", readAuth, handler.GetByName)
+		apiGroup.POST("", authMiddleware.WithPermissions(models.PermissionVolumesCreate).Add(), handler.Create)
+		apiGroup.DELETE("/:volumeName", authMiddleware.WithPermissions(models.PermissionVolumesDelete).Add(), handler.Remove)
+		apiGroup.POST("/prune", authMiddleware.WithPermissions(models.PermissionVolumesPrune).Add(), handler.Prune)
+		apiGroup.GET("/:volumeName/usage", readAuth, handler.GetUsage)
+		apiGroup.GET("/:volumeName/archive", authMiddleware.WithPermissions(models.PermissionVolumesArchive).Add(), handler.ExportArchive)
+		apiGroup.PUT("/:volumeName/archive", authMiddleware.WithPermissions(models.PermissionVolumesArchive).Add(), handler.ImportArchive)
 	}
 }
 
@@ -177,6 +184,62 @@ func (h *VolumeHandler) GetUsage(c *gin.Context) {
 	})
 }
 
+// ExportArchive streams the volume's contents as a tar archive.
+func (h *VolumeHandler) ExportArchive(c *gin.Context) {
+	name := c.Param("volumeName")
+
+	archive, err := h.volumeService.ExportVolume(c.Request.Context(), name)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrVolumeNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"data":    gin.H{"error": err.Error()},
+		})
+		return
+	}
+	defer archive.Close()
+
+	c.Header("Content-Type", "application/x-tar")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".tar"))
+	c.Status(http.StatusOK)
+	_, _ = io.Copy(c.Writer, archive)
+}
+
+// ImportArchive extracts a tar archive made by ExportArchive into the volume, creating it when
+// missing with the labels given as repeated label=key=value query parameters.
+func (h *VolumeHandler) ImportArchive(c *gin.Context) {
+	name := c.Param("volumeName")
+
+	currentUser, ok := middleware.RequireAuthentication(c)
+	if !ok {
+		return
+	}
+
+	labels := map[string]string{}
+	for _, label := range c.QueryArray("label") {
+		key, value, _ := strings.Cut(label, "=")
+		if key != "" {
+			labels[key] = value
+		}
+	}
+
+	if err := h.volumeService.ImportVolume(c.Request.Context(), name, labels, c.Request.Body, *currentUser); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"data":    gin.H{"error": err.Error()},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    gin.H{"message": "Volume contents imported successfully"},
+	})
+}
+
 func (h *VolumeHandler) GetVolumeUsageCounts(c *gin.Context) {
 	_, running, stopped, total, err := h.dockerService.GetAllVolumes(c.Request.Context())
 	if err != nil {
@@ -2,6 +2,7 @@ package bootstrap
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -15,6 +16,7 @@ import (
 
 	"github.com/ofkm/arcane-backend/internal/config"
 	"github.com/ofkm/arcane-backend/internal/utils"
+	"github.com/ofkm/arcane-backend/internal/utils/git"
 	httputils "github.com/ofkm/arcane-backend/internal/utils/http"
 )
 
@@ -49,11 +51,32 @@ func Bootstrap(ctx context.Context) error {
 		return fmt.Errorf("failed to initialize services: %w", err)
 	}
 
-	utils.LoadAgentToken(appCtx, cfg, appServices.Settings.GetStringSetting)
+	if appServices.AgentToken != nil {
+		if err := appServices.AgentToken.Load(appCtx, cfg.AgentToken); err != nil {
+			return fmt.Errorf("failed to load agent token: %w", err)
+		}
+	}
 	utils.EnsureEncryptionKey(appCtx, cfg, appServices.Settings.EnsureEncryptionKey)
 	utils.InitEncryption(cfg)
+	git.AllowLocalRepositories(cfg.GitAllowLocalRepositories)
 	utils.InitializeDefaultSettings(appCtx, cfg, appServices.Settings)
 
+	if !cfg.AgentMode {
+		if n, err := appServices.Environment.EncryptAgentTokens(appCtx); err != nil {
+			slog.WarnContext(appCtx, "Failed to encrypt stored agent tokens", slog.String("error", err.Error()))
+		} else if n > 0 {
+			slog.InfoContext(appCtx, "Encrypted stored agent tokens", slog.Int("count", n))
+		}
+	}
+
+	var tlsConfig *tls.Config
+	if appServices.AgentTLS != nil {
+		if err := appServices.AgentTLS.Load(appCtx); err != nil {
+			return fmt.Errorf("failed to load agent TLS certificate: %w", err)
+		}
+		tlsConfig = appServices.AgentTLS.ServerTLSConfig()
+	}
+
 	utils.TestDockerConnection(appCtx, func(ctx context.Context) error {
 		dockerClient, err := dockerClientService.CreateConnection(ctx)
 		if err != nil {
@@ -77,8 +100,9 @@ func Bootstrap(ctx context.Context) error {
 	registerJobs(appCtx, scheduler, appServices, cfg)
 
 	router := setupRouter(cfg, appServices) //nolint:contextcheck
+	startAgentTunnel(appCtx, cfg, appServices.AgentToken, router)
 
-	err = runServices(appCtx, cfg, router, scheduler)
+	err = runServices(appCtx, cfg, router, tlsConfig, scheduler)
 	if err != nil {
 		return fmt.Errorf("failed to run services: %w", err)
 	}
@@ -87,7 +111,7 @@ func Bootstrap(ctx context.Context) error {
 	return nil
 }
 
-func runServices(appCtx context.Context, cfg *config.Config, router http.Handler, scheduler interface{ Run(context.Context) error }) error {
+func runServices(appCtx context.Context, cfg *config.Config, router http.Handler, tlsConfig *tls.Config, scheduler interface{ Run(context.Context) error }) error {
 	go func() {
 		slog.InfoContext(appCtx, "Starting scheduler")
 		if err := scheduler.Run(appCtx); err != nil {
@@ -102,11 +126,18 @@ func runServices(appCtx context.Context, cfg *config.Config, router http.Handler
 		Addr:              ":" + cfg.Port,
 		Handler:           router,
 		ReadHeaderTimeout: 5 * time.Second,
+		TLSConfig:         tlsConfig,
 	}
 
 	go func() {
-		slog.InfoContext(appCtx, "Starting HTTP server", slog.String("port", cfg.Port))
-		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.InfoContext(appCtx, "Starting HTTP server", slog.String("port", cfg.Port), slog.Bool("tls", tlsConfig != nil))
+		var err error
+		if tlsConfig != nil {
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			slog.ErrorContext(appCtx, "Failed to start server", slog.Any("error", err))
 		}
 	}()
@@ -18,12 +18,12 @@ func initializeScheduler() (*job.Scheduler, error) {
 }
 
 func registerJobs(appCtx context.Context, scheduler *job.Scheduler, appServices *Services, appConfig *config.Config) {
-	autoUpdateJob := job.NewAutoUpdateJob(scheduler, appServices.Updater, appServices.Settings)
+	autoUpdateJob := job.NewAutoUpdateJob(scheduler, appServices.Updater, appServices.Settings, appServices.EnvironmentSchedule)
 	if err := autoUpdateJob.Register(appCtx); err != nil {
 		slog.ErrorContext(appCtx, "Failed to register auto-update job", slog.Any("error", err))
 	}
 
-	imagePollingJob := job.NewImagePollingJob(scheduler, appServices.ImageUpdate, appServices.Settings, appServices.Environment)
+	imagePollingJob := job.NewImagePollingJob(scheduler, appServices.ImageUpdate, appServices.Settings, appServices.Environment, appServices.EnvironmentSchedule)
 	if err := imagePollingJob.Register(appCtx); err != nil {
 		slog.ErrorContext(appCtx, "Failed to register image polling job", slog.Any("error", err))
 	}
@@ -37,6 +37,23 @@ func registerJobs(appCtx context.Context, scheduler *job.Scheduler, appServices
 		slog.ErrorContext(appCtx, "Failed to register event cleanup job", slog.Any("error", err))
 	}
 
+	if err := job.RegisterJwtKeyRotationJob(appCtx, scheduler, appServices.JwtKey); err != nil {
+		slog.ErrorContext(appCtx, "Failed to register JWT key rotation job", slog.Any("error", err))
+	}
+
+	if !appConfig.AgentMode {
+		if err := job.RegisterAgentCertificateRenewalJob(appCtx, scheduler, appServices.Environment); err != nil {
+			slog.ErrorContext(appCtx, "Failed to register agent certificate renewal job", slog.Any("error", err))
+		}
+		if err := job.RegisterEnvironmentHealthJob(appCtx, scheduler, appServices.EnvironmentHealth); err != nil {
+			slog.ErrorContext(appCtx, "Failed to register environment health job", slog.Any("error", err))
+		}
+	}
+
+	if err := job.RegisterProjectGitSyncJob(appCtx, scheduler, appServices.ProjectGit); err != nil {
+		slog.ErrorContext(appCtx, "Failed to register project git sync job", slog.Any("error", err))
+	}
+
 	if err := job.RegisterFilesystemWatcherJob(appCtx, scheduler, appServices.Project, appServices.Template, appServices.Settings); err != nil {
 		slog.ErrorContext(appCtx, "Failed to register filesystem watcher job", slog.Any("error", err))
 	}
@@ -54,4 +71,12 @@ func registerJobs(appCtx context.Context, scheduler *job.Scheduler, appServices
 			slog.WarnContext(ctx, "Failed to reschedule auto-update job", slog.Any("error", err))
 		}
 	}
+	appServices.EnvironmentSchedule.OnScheduleChanged = func(ctx context.Context) {
+		if err := imagePollingJob.RescheduleEnvironments(ctx); err != nil {
+			slog.WarnContext(ctx, "Failed to reschedule image polling for remote environments", slog.Any("error", err))
+		}
+		if err := autoUpdateJob.RescheduleEnvironments(ctx); err != nil {
+			slog.WarnContext(ctx, "Failed to reschedule auto-update for remote environments", slog.Any("error", err))
+		}
+	}
 }
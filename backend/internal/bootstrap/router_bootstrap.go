@@ -1,7 +1,6 @@
 package bootstrap
 
 import (
-	"context"
 	"log/slog"
 	"path"
 	"strings"
@@ -17,6 +16,20 @@ import (
 
 var registerPlaywrightRoutes []func(apiGroup *gin.RouterGroup, services *Services)
 
+// configureTrustedProxies makes gin read client IPs from X-Forwarded-For only when the request
+// comes from one of proxies. With none configured the headers are ignored, since otherwise any
+// client could choose the IP that login throttling, sessions and audit events record.
+func configureTrustedProxies(router *gin.Engine, proxies []string) {
+	if len(proxies) > 0 {
+		err := router.SetTrustedProxies(proxies)
+		if err == nil {
+			return
+		}
+		slog.Error("Invalid TRUSTED_PROXIES, client IPs will not be read from proxy headers", "error", err)
+	}
+	_ = router.SetTrustedProxies(nil)
+}
+
 func setupRouter(cfg *config.Config, appServices *Services) *gin.Engine {
 
 	if cfg.Environment == "production" {
@@ -26,6 +39,7 @@ func setupRouter(cfg *config.Config, appServices *Services) *gin.Engine {
 	}
 	router := gin.New()
 	router.Use(gin.Recovery())
+	configureTrustedProxies(router, cfg.TrustedProxies)
 
 	loggerSkipPatterns := []string{
 		"GET /api/environments/*/containers/*/logs/ws",
@@ -66,47 +80,54 @@ func setupRouter(cfg *config.Config, appServices *Services) *gin.Engine {
 		},
 	}))
 
-	authMiddleware := middleware.NewAuthMiddleware(appServices.Auth, cfg)
+	authMiddleware := middleware.NewAuthMiddleware(appServices.Auth, appServices.Role, appServices.Environment, appServices.ApiToken, appServices.ProxyAuth, appServices.AgentToken, appServices.AgentTLS, cfg)
 	corsMiddleware := middleware.NewCORSMiddleware(cfg).Add()
 	router.Use(corsMiddleware)
 
 	apiGroup := router.Group("/api")
 
 	api.NewApplicationImagesHandler(apiGroup, appServices.AppImages)
-	api.NewUserHandler(apiGroup, appServices.User, authMiddleware)
+	api.NewUserHandler(apiGroup, appServices.User, appServices.Role, appServices.TwoFactor, appServices.Auth, appServices.Session, appServices.LoginThrottle, appServices.Audit, authMiddleware)
+	api.NewRoleHandler(apiGroup, appServices.Role, appServices.Audit, authMiddleware)
+	api.NewApiTokenHandler(apiGroup, appServices.ApiToken, appServices.Audit, authMiddleware)
 	api.NewVersionHandler(apiGroup, appServices.Version)
-	api.NewAuthHandler(apiGroup, appServices.User, appServices.Auth, appServices.Oidc, authMiddleware)
-	api.NewEventHandler(apiGroup, appServices.Event, authMiddleware)
+	api.NewAuthHandler(apiGroup, appServices.User, appServices.Auth, appServices.Oidc, appServices.TwoFactor, appServices.Webauthn, appServices.Session, appServices.Audit, authMiddleware)
+	api.NewEventHandler(apiGroup, appServices.Event, appServices.Audit, authMiddleware)
+	api.NewAuditHandler(apiGroup, appServices.Audit, authMiddleware)
 	api.NewOidcHandler(apiGroup, appServices.Auth, appServices.Oidc, cfg)
-	api.NewEnvironmentHandler(apiGroup, appServices.Environment, appServices.Settings, authMiddleware, cfg)
+	api.NewEnvironmentHandler(apiGroup, appServices.Environment, appServices.AgentToken, appServices.AgentTLS, authMiddleware, cfg)
 	api.NewContainerRegistryHandler(apiGroup, appServices.ContainerRegistry, authMiddleware)
 	api.NewTemplateHandler(apiGroup, appServices.Template, authMiddleware)
+	api.NewTunnelHandler(apiGroup, appServices.Tunnel)
+	if !cfg.AgentMode {
+		api.NewAggregateHandler(apiGroup, appServices.Aggregate, authMiddleware)
+		api.NewEnvironmentBulkHandler(apiGroup, appServices.EnvironmentBulk, authMiddleware)
+		api.NewEnvironmentScheduleHandler(apiGroup, appServices.EnvironmentSchedule, authMiddleware)
+		api.NewProjectMigrationHandler(apiGroup, appServices.ProjectMigration, authMiddleware)
+	}
 
 	envMiddleware := middleware.NewEnvProxyMiddlewareWithParam(
 		api.LOCAL_DOCKER_ENVIRONMENT_ID,
 		"id",
-		func(ctx context.Context, id string) (string, *string, bool, error) {
-			env, err := appServices.Environment.GetEnvironmentByID(ctx, id)
-			if err != nil || env == nil {
-				return "", nil, false, err
-			}
-			return env.ApiUrl, env.AccessToken, env.Enabled, nil
-		},
+		appServices.Environment.GetEnvironmentByID,
 		appServices.Environment,
+		authMiddleware,
 	)
 	apiGroup.Use(envMiddleware)
 
 	api.NewHealthHandler(apiGroup)
-	api.NewContainerHandler(apiGroup, appServices.Docker, appServices.Container, appServices.Image, authMiddleware, cfg)
+	api.NewContainerHandler(apiGroup, appServices.Docker, appServices.Container, appServices.Image, appServices.Audit, authMiddleware, cfg)
 	api.NewImageHandler(apiGroup, appServices.Docker, appServices.Image, appServices.ImageUpdate, appServices.Settings, authMiddleware)
 	api.NewImageUpdateHandler(apiGroup, appServices.ImageUpdate, authMiddleware)
 	api.NewNetworkHandler(apiGroup, appServices.Docker, appServices.Network, authMiddleware)
 	api.NewProjectHandler(apiGroup, appServices.Project, authMiddleware, cfg)
+	api.NewProjectGitHandler(apiGroup, appServices.ProjectGit, appServices.Project, authMiddleware)
+	api.NewProjectWebhookHandler(apiGroup, appServices.ProjectWebhook, authMiddleware)
 	api.NewSystemHandler(apiGroup, appServices.Docker, appServices.System, appServices.SystemUpgrade, authMiddleware, cfg)
 	api.NewUpdaterHandler(apiGroup, appServices.Updater, authMiddleware)
 	api.NewVolumeHandler(apiGroup, appServices.Docker, appServices.Volume, authMiddleware)
 	api.NewNotificationHandler(apiGroup, appServices.Notification, appServices.Apprise, authMiddleware)
-	api.NewSettingsHandler(apiGroup, appServices.Settings, appServices.SettingsSearch, authMiddleware)
+	api.NewSettingsHandler(apiGroup, appServices.Settings, appServices.SettingsSearch, appServices.Audit, authMiddleware)
 	api.NewCustomizeHandler(apiGroup, appServices.CustomizeSearch, authMiddleware)
 
 	if cfg.Environment != "production" {
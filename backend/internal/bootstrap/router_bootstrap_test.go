@@ -0,0 +1,86 @@
+package bootstrap
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	glsqlite "github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/ofkm/arcane-backend/internal/api"
+	"github.com/ofkm/arcane-backend/internal/config"
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/middleware"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/services"
+)
+
+func setupLoginRouter(t *testing.T, trustedProxies []string) (*gin.Engine, *services.LoginThrottleService) {
+	t.Helper()
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+
+	gdb, err := gorm.Open(glsqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, gdb.AutoMigrate(&models.User{}, &models.SettingVariable{}, &models.Event{}))
+	db := &database.DB{DB: gdb}
+
+	settingsService, err := services.NewSettingsService(ctx, db)
+	require.NoError(t, err)
+	require.NoError(t, settingsService.EnsureDefaultSettings(ctx))
+	require.NoError(t, settingsService.SetStringSetting(ctx, "authLoginIpMaxAttempts", "3"))
+
+	userService := services.NewUserService(db)
+	eventService := services.NewEventService(db)
+	throttle := services.NewLoginThrottleService(db, settingsService, eventService)
+	authService := services.NewAuthService(userService, settingsService, eventService, nil, nil, nil, throttle, nil, nil, &config.Config{})
+	authMiddleware := middleware.NewAuthMiddleware(authService, nil, nil, nil, nil, nil, nil, &config.Config{})
+
+	router := gin.New()
+	configureTrustedProxies(router, trustedProxies)
+	api.NewAuthHandler(router.Group("/api"), userService, authService, nil, nil, nil, nil, nil, authMiddleware)
+	return router, throttle
+}
+
+func postLogin(router *gin.Engine, remoteAddr, forwardedFor string) int {
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(`{"username":"nobody","password":"wrong"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestConfigureTrustedProxies_IgnoresSpoofedForwardedFor(t *testing.T) {
+	router, throttle := setupLoginRouter(t, nil)
+
+	// Each attempt claims a different client, but all of them count against the peer address.
+	for _, spoofed := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"} {
+		require.Equal(t, http.StatusUnauthorized, postLogin(router, "198.51.100.7:40000", spoofed))
+	}
+	require.Equal(t, http.StatusTooManyRequests, postLogin(router, "198.51.100.7:40000", "192.0.2.4"))
+	require.Error(t, throttle.CheckIP("198.51.100.7"))
+	require.NoError(t, throttle.CheckIP("192.0.2.1"), "a spoofed address must not be locked out on the peer's behalf")
+}
+
+func TestConfigureTrustedProxies_HonorsConfiguredProxy(t *testing.T) {
+	router, throttle := setupLoginRouter(t, []string{"10.0.0.1"})
+
+	for range 3 {
+		require.Equal(t, http.StatusUnauthorized, postLogin(router, "10.0.0.1:40000", "192.0.2.1"))
+	}
+	require.Error(t, throttle.CheckIP("192.0.2.1"))
+	require.NoError(t, throttle.CheckIP("10.0.0.1"), "the proxy itself is not throttled for its clients")
+
+	// Another client behind the same proxy is unaffected, and an untrusted peer cannot claim it.
+	require.Equal(t, http.StatusUnauthorized, postLogin(router, "10.0.0.1:40000", "192.0.2.2"))
+	require.Equal(t, http.StatusUnauthorized, postLogin(router, "203.0.113.5:40000", "192.0.2.1"))
+}
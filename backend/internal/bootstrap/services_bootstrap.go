@@ -12,10 +12,22 @@ import (
 )
 
 type Services struct {
-	AppImages         *services.ApplicationImagesService
-	User              *services.UserService
-	Project           *services.ProjectService
-	Environment       *services.EnvironmentService
+	AppImages           *services.ApplicationImagesService
+	User                *services.UserService
+	Role                *services.RoleService
+	ApiToken            *services.ApiTokenService
+	Project             *services.ProjectService
+	ProjectGit          *services.ProjectGitService
+	ProjectWebhook      *services.ProjectWebhookService
+	Environment         *services.EnvironmentService
+	EnvironmentHealth   *services.EnvironmentHealthService
+	EnvironmentSchedule *services.EnvironmentScheduleService
+	Tunnel              *services.TunnelService
+	AgentCertificate    *services.AgentCertificateService
+	// AgentToken is only set for agents.
+	AgentToken *services.AgentTokenService
+	// AgentTLS is only set for agents serving TLS.
+	AgentTLS          *services.AgentTLSService
 	Settings          *services.SettingsService
 	SettingsSearch    *services.SettingsSearchService
 	CustomizeSearch   *services.CustomizeSearchService
@@ -25,6 +37,15 @@ type Services struct {
 	Network           *services.NetworkService
 	ImageUpdate       *services.ImageUpdateService
 	Auth              *services.AuthService
+	JwtKey            *services.JwtKeyService
+	TwoFactor         *services.TwoFactorService
+	Webauthn          *services.WebauthnService
+	Session           *services.SessionService
+	LoginThrottle     *services.LoginThrottleService
+	PasswordPolicy    *services.PasswordPolicyService
+	Audit             *services.AuditService
+	ProxyAuth         *services.ProxyAuthService
+	Ldap              *services.LdapService
 	Oidc              *services.OidcService
 	Docker            *services.DockerClientService
 	Template          *services.TemplateService
@@ -36,12 +57,16 @@ type Services struct {
 	Version           *services.VersionService
 	Notification      *services.NotificationService
 	Apprise           *services.AppriseService
+	Aggregate         *services.AggregateService
+	EnvironmentBulk   *services.EnvironmentBulkService
+	ProjectMigration  *services.ProjectMigrationService
 }
 
 func initializeServices(ctx context.Context, db *database.DB, cfg *config.Config, httpClient *http.Client) (svcs *Services, dockerSrvice *services.DockerClientService, err error) {
 	svcs = &Services{}
 
 	svcs.Event = services.NewEventService(db)
+	svcs.Audit = services.NewAuditService(db, svcs.Event)
 	svcs.Settings, err = services.NewSettingsService(ctx, db)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to settings service: %w", err)
@@ -52,23 +77,48 @@ func initializeServices(ctx context.Context, db *database.DB, cfg *config.Config
 	dockerClient := services.NewDockerClientService(db, cfg)
 	svcs.Docker = dockerClient
 	svcs.User = services.NewUserService(db)
+	svcs.PasswordPolicy = services.NewPasswordPolicyService(db, svcs.Settings, svcs.User, cfg.PasswordBreachList)
+	svcs.Role = services.NewRoleService(db)
+	svcs.ApiToken = services.NewApiTokenService(db)
 	svcs.ContainerRegistry = services.NewContainerRegistryService(db)
 	svcs.Notification = services.NewNotificationService(db, cfg)
 	svcs.Apprise = services.NewAppriseService(db, cfg)
 	svcs.ImageUpdate = services.NewImageUpdateService(db, svcs.Settings, svcs.ContainerRegistry, svcs.Docker, svcs.Event, svcs.Notification)
 	svcs.Image = services.NewImageService(db, svcs.Docker, svcs.ContainerRegistry, svcs.ImageUpdate, svcs.Event)
 	svcs.Project = services.NewProjectService(db, svcs.Settings, svcs.Event, svcs.Image)
+	svcs.ProjectGit = services.NewProjectGitService(db, svcs.Settings, svcs.Project, svcs.Event)
+	svcs.ProjectWebhook = services.NewProjectWebhookService(db, svcs.Project, svcs.Event)
 	svcs.Environment = services.NewEnvironmentService(db, httpClient)
+	svcs.Tunnel = services.NewTunnelService(db, svcs.Environment)
+	svcs.AgentCertificate = services.NewAgentCertificateService(db, svcs.Settings, svcs.Environment)
+	svcs.EnvironmentHealth = services.NewEnvironmentHealthService(db, svcs.Environment, svcs.Event, svcs.Notification)
+	svcs.EnvironmentSchedule = services.NewEnvironmentScheduleService(db, svcs.Environment, svcs.Settings)
+	if cfg.AgentMode {
+		svcs.AgentToken = services.NewAgentTokenService(db)
+	}
+	if cfg.AgentMode && cfg.AgentTLS {
+		svcs.AgentTLS = services.NewAgentTLSService(db, svcs.Settings)
+	}
 	svcs.Container = services.NewContainerService(db, svcs.Event, svcs.Docker)
 	svcs.Volume = services.NewVolumeService(db, svcs.Docker, svcs.Event)
 	svcs.Network = services.NewNetworkService(db, svcs.Docker, svcs.Event)
 	svcs.Template = services.NewTemplateService(ctx, db, httpClient, svcs.Settings)
-	svcs.Auth = services.NewAuthService(svcs.User, svcs.Settings, svcs.Event, cfg.JWTSecret, cfg)
+	svcs.TwoFactor = services.NewTwoFactorService(db, svcs.Settings)
+	svcs.Webauthn = services.NewWebauthnService(db, cfg)
+	svcs.Session = services.NewSessionService(db)
+	svcs.LoginThrottle = services.NewLoginThrottleService(db, svcs.Settings, svcs.Event)
+	svcs.Ldap = services.NewLdapService(svcs.Settings)
+	svcs.ProxyAuth = services.NewProxyAuthService(db, svcs.Settings, svcs.User, svcs.Event)
+	svcs.JwtKey = services.NewJwtKeyService(db, svcs.Settings, cfg.JWTSecret)
+	svcs.Auth = services.NewAuthService(svcs.User, svcs.Settings, svcs.Event, svcs.TwoFactor, svcs.Webauthn, svcs.Session, svcs.LoginThrottle, svcs.Ldap, svcs.JwtKey, cfg)
 	svcs.Oidc = services.NewOidcService(svcs.Auth, cfg, httpClient)
 	svcs.Updater = services.NewUpdaterService(db, svcs.Settings, svcs.Docker, svcs.Project, svcs.ImageUpdate, svcs.ContainerRegistry, svcs.Event, svcs.Image, svcs.Notification)
 	svcs.System = services.NewSystemService(db, svcs.Docker, svcs.Container, svcs.Image, svcs.Volume, svcs.Network, svcs.Settings)
 	svcs.Version = services.NewVersionService(httpClient, cfg.UpdateCheckDisabled, config.Version, config.Revision)
 	svcs.SystemUpgrade = services.NewSystemUpgradeService(svcs.Docker, svcs.Version, svcs.Event)
+	svcs.Aggregate = services.NewAggregateService(db, svcs.Environment, svcs.Container, svcs.Image, svcs.Project)
+	svcs.EnvironmentBulk = services.NewEnvironmentBulkService(svcs.Environment, svcs.Aggregate)
+	svcs.ProjectMigration = services.NewProjectMigrationService(svcs.Environment, svcs.Aggregate, svcs.Project, svcs.Volume)
 
 	return svcs, dockerClient, nil
 }
@@ -0,0 +1,43 @@
+package bootstrap
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/ofkm/arcane-backend/internal/config"
+	"github.com/ofkm/arcane-backend/internal/services"
+	"github.com/ofkm/arcane-backend/internal/utils/tunnel"
+)
+
+// startAgentTunnel connects an agent to its manager when MANAGER_URL is set, so the manager can
+// reach the agent's API without an inbound connection.
+func startAgentTunnel(ctx context.Context, cfg *config.Config, agentTokens *services.AgentTokenService, router http.Handler) {
+	if !cfg.AgentMode || cfg.ManagerURL == "" {
+		return
+	}
+	if agentTokens.Token() == "" {
+		slog.ErrorContext(ctx, "MANAGER_URL is set but the agent has no token; pair the agent before enabling the tunnel")
+		return
+	}
+
+	url := strings.TrimRight(cfg.ManagerURL, "/")
+	switch {
+	case strings.HasPrefix(url, "https://"):
+		url = "wss://" + strings.TrimPrefix(url, "https://")
+	case strings.HasPrefix(url, "http://"):
+		url = "ws://" + strings.TrimPrefix(url, "http://")
+	}
+	url += "/api/tunnel/connect"
+
+	// The token is read on every reconnect so the tunnel follows token rotation.
+	header := func() http.Header {
+		h := http.Header{}
+		h.Set("X-Arcane-Agent-Token", agentTokens.Token())
+		return h
+	}
+
+	slog.InfoContext(ctx, "Starting tunnel to manager", "url", url)
+	go tunnel.RunClient(ctx, url, header, router)
+}
@@ -0,0 +1,10 @@
+package jwt
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var JwtCmd = &cobra.Command{
+	Use:   "jwt",
+	Short: "Manage the keys that sign Arcane's session tokens",
+}
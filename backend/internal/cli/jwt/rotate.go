@@ -0,0 +1,76 @@
+package jwt
+
+import (
+	"fmt"
+
+	"github.com/joho/godotenv"
+	"github.com/spf13/cobra"
+
+	"github.com/ofkm/arcane-backend/internal/config"
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/services"
+	"github.com/ofkm/arcane-backend/internal/utils"
+)
+
+var revokePrevious bool
+
+var rotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Rotate the JWT signing key now",
+	Long: `Retire the current JWT signing key and start signing tokens with a new one.
+Tokens signed with the retired key stay valid for the configured grace period, so nobody is
+logged out. A running Arcane instance picks up the new key within a minute.`,
+	Example: `  # Rotate the signing key
+  arcane jwt rotate
+
+  # Rotate and invalidate every token signed with an earlier key, e.g. after a leak
+  arcane jwt rotate --revoke-previous`,
+	RunE: runRotate,
+}
+
+func init() {
+	JwtCmd.AddCommand(rotateCmd)
+	rotateCmd.Flags().BoolVar(&revokePrevious, "revoke-previous", false, "invalidate tokens signed with earlier keys immediately instead of after the grace period")
+}
+
+func runRotate(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	_ = godotenv.Load()
+	cfg := config.Load()
+
+	db, err := database.Initialize(cfg.DatabaseURL, cfg.Environment)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	settingsService, err := services.NewSettingsService(ctx, db)
+	if err != nil {
+		return fmt.Errorf("failed to load settings: %w", err)
+	}
+	utils.EnsureEncryptionKey(ctx, cfg, settingsService.EnsureEncryptionKey)
+	utils.InitEncryption(cfg)
+
+	jwtKeys := services.NewJwtKeyService(db, settingsService, cfg.JWTSecret)
+	// Create the key ring first so a JWT_SECRET still in use is carried over before rotating.
+	if _, _, err := jwtKeys.SigningKey(ctx); err != nil {
+		return fmt.Errorf("failed to load signing keys: %w", err)
+	}
+
+	key, err := jwtKeys.Rotate(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("New JWT signing key: %s\n", key.ID)
+
+	if revokePrevious {
+		revoked, err := jwtKeys.RevokeRetired(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Revoked %d previous signing key(s); sessions signed with them must sign in again\n", revoked)
+	} else {
+		fmt.Printf("Previous keys remain valid for %s\n", jwtKeys.GracePeriod(ctx))
+	}
+	return nil
+}
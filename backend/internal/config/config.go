@@ -8,6 +8,9 @@ import (
 
 const (
 	defaultSqliteString string = "file:data/arcane.db?_pragma=journal_mode(WAL)&_pragma=busy_timeout(2500)&_txlock=immediate"
+	// DefaultJWTSecret is the JWT_SECRET used when none is configured. It is public, so it is
+	// never carried over into the signing key ring.
+	DefaultJWTSecret string = "default-jwt-secret-change-me"
 )
 
 type Config struct {
@@ -25,16 +28,33 @@ type Config struct {
 	OidcScopes       string
 	OidcAdminClaim   string
 	OidcAdminValue   string
+	// OidcRoleMappings is a JSON array of models.OidcRoleMapping.
+	OidcRoleMappings string
 
-	DockerHost              string
-	LogJson                 bool
-	LogLevel                string
-	AgentMode               bool
-	AgentToken              string
-	AgentBootstrapToken     string
+	DockerHost          string
+	LogJson             bool
+	LogLevel            string
+	AgentMode           bool
+	AgentToken          string
+	AgentBootstrapToken string
+	// ManagerURL makes an agent dial out to the manager at this URL and serve its API over the
+	// resulting tunnel, for agents the manager cannot reach directly.
+	ManagerURL string
+	// AgentTLS makes an agent serve its API over TLS. Once paired, it presents a certificate from
+	// the manager's CA and requires the manager's client certificate.
+	AgentTLS                bool
 	UpdateCheckDisabled     bool
 	UIConfigurationDisabled bool
 	AnalyticsDisabled       bool
+	// TrustedProxies lists the proxy addresses or CIDRs whose X-Forwarded-For headers are used to
+	// determine client IPs. When empty no proxy is trusted and the peer address is used.
+	TrustedProxies []string
+	// PasswordBreachList points at a local copy of a breached password list used by the password
+	// policy: either a directory of k-anonymity range files named after the first five characters
+	// of the SHA-1 hash, or a single file of full SHA-1 hashes.
+	PasswordBreachList string
+	// GitAllowLocalRepositories lets git-backed projects use file:// repositories on the server.
+	GitAllowLocalRepositories bool
 }
 
 func Load() *Config {
@@ -43,7 +63,7 @@ func Load() *Config {
 		DatabaseURL:   getEnvOrDefault("DATABASE_URL", defaultSqliteString),
 		Port:          getEnvOrDefault("PORT", "3552"),
 		Environment:   getEnvOrDefault("ENVIRONMENT", "production"),
-		JWTSecret:     getEnvOrDefault("JWT_SECRET", "default-jwt-secret-change-me"),
+		JWTSecret:     getEnvOrDefault("JWT_SECRET", DefaultJWTSecret),
 		EncryptionKey: getEnvOrDefault("ENCRYPTION_KEY", "arcane-dev-key-32-characters!!!"),
 
 		OidcEnabled:      getBoolEnvOrDefault("OIDC_ENABLED", false),
@@ -53,6 +73,7 @@ func Load() *Config {
 		OidcScopes:       getEnvOrDefault("OIDC_SCOPES", "openid email profile"),
 		OidcAdminClaim:   getEnvOrDefault("OIDC_ADMIN_CLAIM", ""),
 		OidcAdminValue:   getEnvOrDefault("OIDC_ADMIN_VALUE", ""),
+		OidcRoleMappings: os.Getenv("OIDC_ROLE_MAPPINGS"),
 
 		DockerHost:              getEnvOrDefault("DOCKER_HOST", "unix:///var/run/docker.sock"),
 		LogJson:                 getBoolEnvOrDefault("LOG_JSON", false),
@@ -60,9 +81,15 @@ func Load() *Config {
 		AgentMode:               getBoolEnvOrDefault("AGENT_MODE", false),
 		AgentToken:              os.Getenv("AGENT_TOKEN"),
 		AgentBootstrapToken:     os.Getenv("AGENT_BOOTSTRAP_TOKEN"),
+		AgentTLS:                getBoolEnvOrDefault("AGENT_TLS", false),
+		ManagerURL:              os.Getenv("MANAGER_URL"),
 		UpdateCheckDisabled:     getBoolEnvOrDefault("UPDATE_CHECK_DISABLED", false),
 		UIConfigurationDisabled: getBoolEnvOrDefault("UI_CONFIGURATION_DISABLED", false),
 		AnalyticsDisabled:       getBoolEnvOrDefault("ANALYTICS_DISABLED", false),
+		TrustedProxies:          getListEnv("TRUSTED_PROXIES"),
+		PasswordBreachList:      os.Getenv("PASSWORD_BREACH_LIST"),
+
+		GitAllowLocalRepositories: getBoolEnvOrDefault("GIT_ALLOW_LOCAL_REPOSITORIES", false),
 	}
 }
 
@@ -71,6 +98,16 @@ func (c *Config) GetOidcRedirectURI() string {
 	return baseUrl + "/auth/oidc/callback"
 }
 
+func getListEnv(key string) []string {
+	var out []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
 func getEnvOrDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
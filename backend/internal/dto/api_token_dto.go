@@ -0,0 +1,25 @@
+package dto
+
+import "time"
+
+type CreateApiTokenDto struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+type ApiTokenDto struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// CreatedApiTokenDto is returned once on creation; Token is never retrievable again.
+type CreatedApiTokenDto struct {
+	ApiTokenDto
+	Token string `json:"token"`
+}
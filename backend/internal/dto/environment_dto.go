@@ -1,11 +1,31 @@
 package dto
 
+import "time"
+
 type CreateEnvironmentDto struct {
-	ApiUrl         string  `json:"apiUrl" binding:"required,url"`
-	Name           *string `json:"name,omitempty"`
-	Enabled        *bool   `json:"enabled,omitempty"`
-	AccessToken    *string `json:"accessToken,omitempty"`
-	BootstrapToken *string `json:"bootstrapToken,omitempty"`
+	// ApiUrl may be omitted for an agent that connects through a tunnel; an access token is
+	// required then. For a direct Docker environment it is the ssh:// or tcp:// Docker host.
+	ApiUrl         string   `json:"apiUrl" binding:"omitempty,url"`
+	Type           *string  `json:"type,omitempty" binding:"omitempty,oneof=agent docker"`
+	Name           *string  `json:"name,omitempty"`
+	Enabled        *bool    `json:"enabled,omitempty"`
+	AccessToken    *string  `json:"accessToken,omitempty"`
+	BootstrapToken *string  `json:"bootstrapToken,omitempty"`
+	Group          *string  `json:"group,omitempty"`
+	Tags           []string `json:"tags,omitempty"`
+	DockerHostCredentialsDto
+}
+
+// DockerHostCredentialsDto authenticates a direct Docker environment: an SSH private key for an
+// ssh:// host, or a CA certificate, client certificate and key, all PEM encoded, for a tcp://
+// host. SshHostKey pins the host's key in authorized_keys format; without it the key seen on
+// first connect is pinned.
+type DockerHostCredentialsDto struct {
+	SshPrivateKey *string `json:"sshPrivateKey,omitempty"`
+	SshHostKey    *string `json:"sshHostKey,omitempty"`
+	TlsCaCert     *string `json:"tlsCaCert,omitempty"`
+	TlsCert       *string `json:"tlsCert,omitempty"`
+	TlsKey        *string `json:"tlsKey,omitempty"`
 }
 
 type UpdateEnvironmentDto struct {
@@ -14,6 +34,11 @@ type UpdateEnvironmentDto struct {
 	Enabled        *bool   `json:"enabled,omitempty"`
 	AccessToken    *string `json:"accessToken,omitempty"`
 	BootstrapToken *string `json:"bootstrapToken,omitempty"`
+	// Group is cleared by an empty string; Tags replaces every tag when present.
+	Group *string   `json:"group,omitempty"`
+	Tags  *[]string `json:"tags,omitempty"`
+	// Credentials replace the stored ones when present; an empty SshHostKey re-pins on next connect.
+	DockerHostCredentialsDto
 }
 
 type TestConnectionDto struct {
@@ -22,11 +47,123 @@ type TestConnectionDto struct {
 }
 
 type EnvironmentDto struct {
-	ID        string  `json:"id"`
-	Name      string  `json:"name,omitempty"`
-	ApiUrl    string  `json:"apiUrl"`
-	Status    string  `json:"status"`
-	Enabled   bool    `json:"enabled"`
+	ID            string     `json:"id"`
+	Name          string     `json:"name,omitempty"`
+	Type          string     `json:"type"`
+	ApiUrl        string     `json:"apiUrl"`
+	Status        string     `json:"status"`
+	Enabled       bool       `json:"enabled"`
+	LastSeen      *time.Time `json:"lastSeen,omitempty"`
+	LatencyMs     *int64     `json:"latencyMs,omitempty"`
+	DockerVersion *string    `json:"dockerVersion,omitempty"`
+	Group         *string    `json:"group,omitempty"`
+	Tags          []string   `json:"tags"`
+	SshHostKey    *string    `json:"sshHostKey,omitempty"`
+	EnvironmentScheduleDto
 	CreatedAt string  `json:"createdAt"`
 	UpdatedAt *string `json:"updatedAt,omitempty"`
 }
+
+// EnvironmentScheduleDto overrides the global image polling, auto-update and prune settings for
+// one environment. Null fields follow the global setting. Intervals are in minutes.
+type EnvironmentScheduleDto struct {
+	PollingEnabled     *bool   `json:"pollingEnabled"`
+	PollingInterval    *int    `json:"pollingInterval" binding:"omitempty,min=5"`
+	AutoUpdate         *bool   `json:"autoUpdate"`
+	AutoUpdateInterval *int    `json:"autoUpdateInterval" binding:"omitempty,min=5"`
+	PruneMode          *string `json:"pruneMode" binding:"omitempty,oneof=all dangling"`
+}
+
+// EffectiveScheduleDto is the schedule an environment runs on once its overrides are applied.
+type EffectiveScheduleDto struct {
+	PollingEnabled     bool   `json:"pollingEnabled"`
+	PollingInterval    int    `json:"pollingInterval"`
+	AutoUpdate         bool   `json:"autoUpdate"`
+	AutoUpdateInterval int    `json:"autoUpdateInterval"`
+	PruneMode          string `json:"pruneMode"`
+}
+
+type EnvironmentScheduleResponseDto struct {
+	Overrides EnvironmentScheduleDto `json:"overrides"`
+	Effective EffectiveScheduleDto   `json:"effective"`
+}
+
+type EnvironmentAccessDto struct {
+	ID            string `json:"id"`
+	EnvironmentID string `json:"environmentId"`
+	SubjectType   string `json:"subjectType"`
+	SubjectID     string `json:"subjectId"`
+	AccessLevel   string `json:"accessLevel"`
+	CreatedAt     string `json:"createdAt"`
+}
+
+type SetEnvironmentAccessDto struct {
+	SubjectType string `json:"subjectType" binding:"required"`
+	SubjectID   string `json:"subjectId" binding:"required"`
+	AccessLevel string `json:"accessLevel" binding:"required"`
+}
+
+type AgentCertificateDto struct {
+	ID            string     `json:"id"`
+	EnvironmentID string     `json:"environmentId"`
+	SerialNumber  string     `json:"serialNumber"`
+	Fingerprint   string     `json:"fingerprint"`
+	NotAfter      time.Time  `json:"notAfter"`
+	ActivatedAt   *time.Time `json:"activatedAt,omitempty"`
+	RevokedAt     *time.Time `json:"revokedAt,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+}
+
+type InstallAgentCertificateDto struct {
+	Certificate   string `json:"certificate" binding:"required"`
+	CaCertificate string `json:"caCertificate" binding:"required"`
+}
+
+type AgentTokenDto struct {
+	Token string `json:"token" binding:"required,min=32"`
+}
+
+// EnvironmentItemDto is an entry of a listing aggregated across environments, tagged with the
+// environment it came from.
+type EnvironmentItemDto[T any] struct {
+	EnvironmentID   string `json:"environmentId"`
+	EnvironmentName string `json:"environmentName"`
+	Item            T      `json:"item"`
+}
+
+// EnvironmentFailureDto reports an environment left out of an aggregated listing.
+type EnvironmentFailureDto struct {
+	EnvironmentID   string `json:"environmentId"`
+	EnvironmentName string `json:"environmentName"`
+	Error           string `json:"error"`
+}
+
+// EnvironmentSelectorDto picks the environments a bulk action runs against: those in Group and
+// carrying every one of Tags.
+type EnvironmentSelectorDto struct {
+	Group string   `json:"group,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+type BulkImageUpdateCheckDto struct {
+	EnvironmentSelectorDto
+}
+
+type BulkPruneDto struct {
+	EnvironmentSelectorDto
+	Prune PruneSystemDto `json:"prune"`
+}
+
+type BulkRedeployProjectDto struct {
+	EnvironmentSelectorDto
+	ProjectName string `json:"projectName" binding:"required"`
+}
+
+// EnvironmentActionResultDto is the outcome of a bulk action on one environment.
+type EnvironmentActionResultDto struct {
+	EnvironmentID   string `json:"environmentId"`
+	EnvironmentName string `json:"environmentName"`
+	Success         bool   `json:"success"`
+	Error           string `json:"error,omitempty"`
+	Data            any    `json:"data,omitempty"`
+}
@@ -39,6 +39,8 @@ type ProjectDetailsDto struct {
 	CreatedAt      string  `json:"createdAt"`
 	UpdatedAt      string  `json:"updatedAt"`
 	Services       []any   `json:"services,omitempty"`
+	// Git is set for projects cloned from a Git repository.
+	Git *ProjectGitDto `json:"git,omitempty"`
 }
 
 type DestroyProjectDto struct {
@@ -51,3 +53,95 @@ type ProjectStatusCounts struct {
 	StoppedProjects int `json:"stoppedProjects"`
 	TotalProjects   int `json:"totalProjects"`
 }
+
+// MigrateProjectDto moves a project from one environment to another.
+type MigrateProjectDto struct {
+	SourceEnvironmentID string `json:"sourceEnvironmentId" binding:"required"`
+	ProjectID           string `json:"projectId" binding:"required"`
+	TargetEnvironmentID string `json:"targetEnvironmentId" binding:"required"`
+	// Name is the project's name on the target; the source project's name when empty.
+	Name       string `json:"name,omitempty"`
+	PullImages bool   `json:"pullImages,omitempty"`
+	Deploy     bool   `json:"deploy,omitempty"`
+	// StopSource brings the source project down once the target is healthy. It needs Deploy.
+	StopSource bool `json:"stopSource,omitempty"`
+	// CopyVolumes copies the contents of the project's named volumes to the target. The source is
+	// stopped while they are copied.
+	CopyVolumes          bool `json:"copyVolumes,omitempty"`
+	HealthTimeoutSeconds int  `json:"healthTimeoutSeconds,omitempty" binding:"omitempty,min=10,max=3600"`
+}
+
+type ProjectMigrationStepDto struct {
+	Step    string `json:"step"`
+	Success bool   `json:"success"`
+	Detail  string `json:"detail,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type ProjectMigrationResultDto struct {
+	Success         bool                      `json:"success"`
+	TargetProjectID string                    `json:"targetProjectId,omitempty"`
+	Steps           []ProjectMigrationStepDto `json:"steps"`
+}
+
+// CreateGitProjectDto creates a project from a Git repository.
+type CreateGitProjectDto struct {
+	// Name defaults to the repository's name.
+	Name          string `json:"name,omitempty"`
+	RepositoryUrl string `json:"repositoryUrl" binding:"required"`
+	// Branch defaults to the repository's default branch.
+	Branch string `json:"branch,omitempty"`
+	// SubPath is the folder in the repository holding the compose file; the root when empty.
+	SubPath string `json:"subPath,omitempty"`
+	// Credential is a private deploy key for ssh URLs or an access token for https ones, sent
+	// as Username.
+	Credential   *string `json:"credential,omitempty"`
+	Username     string  `json:"username,omitempty"`
+	EnvContent   *string `json:"envContent,omitempty"`
+	AutoSync     bool    `json:"autoSync,omitempty"`
+	AutoDeploy   bool    `json:"autoDeploy,omitempty"`
+	SyncInterval *int    `json:"syncInterval,omitempty" binding:"omitempty,min=1,max=1440"`
+	// Deploy deploys the project once it is cloned.
+	Deploy bool `json:"deploy,omitempty"`
+}
+
+// UpdateProjectGitDto changes how a Git project is synced; nil fields are left unchanged. An
+// empty Credential removes the stored one.
+type UpdateProjectGitDto struct {
+	RepositoryUrl *string `json:"repositoryUrl,omitempty"`
+	Branch        *string `json:"branch,omitempty"`
+	Credential    *string `json:"credential,omitempty"`
+	Username      *string `json:"username,omitempty"`
+	AutoSync      *bool   `json:"autoSync,omitempty"`
+	AutoDeploy    *bool   `json:"autoDeploy,omitempty"`
+	SyncInterval  *int    `json:"syncInterval,omitempty" binding:"omitempty,min=1,max=1440"`
+}
+
+type ProjectGitDto struct {
+	RepositoryUrl  string  `json:"repositoryUrl"`
+	Branch         string  `json:"branch"`
+	SubPath        string  `json:"subPath,omitempty"`
+	Username       string  `json:"username,omitempty"`
+	HasCredential  bool    `json:"hasCredential"`
+	AutoSync       bool    `json:"autoSync"`
+	AutoDeploy     bool    `json:"autoDeploy"`
+	SyncInterval   int     `json:"syncInterval"`
+	Commit         string  `json:"commit,omitempty"`
+	DeployedCommit string  `json:"deployedCommit,omitempty"`
+	SyncedAt       *string `json:"syncedAt,omitempty"`
+	SyncError      string  `json:"syncError,omitempty"`
+}
+
+// SyncProjectGitDto syncs a Git project on demand.
+type SyncProjectGitDto struct {
+	// Deploy redeploys the project if a new commit was checked out, or if the commit checked
+	// out has not been deployed yet.
+	Deploy bool `json:"deploy,omitempty"`
+}
+
+type ProjectGitSyncResultDto struct {
+	PreviousCommit string `json:"previousCommit,omitempty"`
+	Commit         string `json:"commit"`
+	Updated        bool   `json:"updated"`
+	Deployed       bool   `json:"deployed"`
+}
@@ -0,0 +1,20 @@
+package dto
+
+type RoleDto struct {
+	ID          string   `json:"id,omitempty"`
+	Name        string   `json:"name"`
+	Description *string  `json:"description,omitempty"`
+	Permissions []string `json:"permissions"`
+	Builtin     bool     `json:"builtin"`
+}
+
+type CreateRoleDto struct {
+	Name        string   `json:"name" binding:"required"`
+	Description *string  `json:"description,omitempty"`
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+type UpdateRoleDto struct {
+	Description *string  `json:"description,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+}
@@ -28,9 +28,21 @@ type UpdateSettingsDto struct {
 	AuthLocalEnabled           *string `json:"authLocalEnabled,omitempty"`
 	AuthOidcEnabled            *string `json:"authOidcEnabled,omitempty"`
 	AuthOidcMergeAccounts      *string `json:"authOidcMergeAccounts,omitempty"`
+	AuthLdapEnabled            *string `json:"authLdapEnabled,omitempty"`
 	AuthSessionTimeout         *string `json:"authSessionTimeout,omitempty"`
 	AuthPasswordPolicy         *string `json:"authPasswordPolicy,omitempty"`
+	AuthPasswordHistory        *string `json:"authPasswordHistory,omitempty"`
+	AuthRequireTwoFactor       *string `json:"authRequireTwoFactor,omitempty"`
+	AuthJwtRotationInterval    *string `json:"authJwtRotationInterval,omitempty"`
+	AuthJwtGracePeriod         *string `json:"authJwtGracePeriod,omitempty"`
+	AuthLoginMaxAttempts       *string `json:"authLoginMaxAttempts,omitempty"`
+	AuthLoginLockoutDuration   *string `json:"authLoginLockoutDuration,omitempty"`
+	AuthLoginIpMaxAttempts     *string `json:"authLoginIpMaxAttempts,omitempty"`
+	AuthLoginAttemptWindow     *string `json:"authLoginAttemptWindow,omitempty"`
 	AuthOidcConfig             *string `json:"authOidcConfig,omitempty"`
+	AuthLdapConfig             *string `json:"authLdapConfig,omitempty"`
+	AuthProxyEnabled           *string `json:"authProxyEnabled,omitempty"`
+	AuthProxyConfig            *string `json:"authProxyConfig,omitempty"`
 	OnboardingCompleted        *string `json:"onboardingCompleted,omitempty"`
 	OnboardingSteps            *string `json:"onboardingSteps,omitempty"`
 	MobileNavigationMode       *string `json:"mobileNavigationMode,omitempty"`
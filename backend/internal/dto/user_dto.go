@@ -1,5 +1,7 @@
 package dto
 
+import "time"
+
 type CreateUserDto struct {
 	Username    string   `json:"username" binding:"required"`
 	Password    string   `json:"password" binding:"required"`
@@ -18,14 +20,18 @@ type UpdateUserDto struct {
 }
 
 type UserResponseDto struct {
-	ID                     string   `json:"id"`
-	Username               string   `json:"username"`
-	DisplayName            *string  `json:"displayName,omitempty"`
-	Email                  *string  `json:"email,omitempty"`
-	Roles                  []string `json:"roles"`
-	OidcSubjectId          *string  `json:"oidcSubjectId,omitempty"`
-	Locale                 *string  `json:"locale,omitempty"`
-	CreatedAt              string   `json:"createdAt,omitempty"`
-	UpdatedAt              string   `json:"updatedAt,omitempty"`
-	RequiresPasswordChange bool     `json:"requiresPasswordChange"`
+	ID                     string     `json:"id"`
+	Username               string     `json:"username"`
+	DisplayName            *string    `json:"displayName,omitempty"`
+	Email                  *string    `json:"email,omitempty"`
+	Roles                  []string   `json:"roles"`
+	OidcSubjectId          *string    `json:"oidcSubjectId,omitempty"`
+	LdapId                 *string    `json:"ldapId,omitempty"`
+	Locale                 *string    `json:"locale,omitempty"`
+	CreatedAt              string     `json:"createdAt,omitempty"`
+	UpdatedAt              string     `json:"updatedAt,omitempty"`
+	RequiresPasswordChange bool       `json:"requiresPasswordChange"`
+	TotpEnabled            bool       `json:"totpEnabled"`
+	LockedUntil            *time.Time `json:"lockedUntil,omitempty"`
+	Permissions            []string   `json:"permissions,omitempty"`
 }
@@ -0,0 +1,108 @@
+package dto
+
+import "time"
+
+type WebauthnCredentialDto struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Transports []string   `json:"transports"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+type WebauthnRelyingPartyDto struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type WebauthnUserEntityDto struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type WebauthnCredentialParameterDto struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type WebauthnCredentialDescriptorDto struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+type WebauthnAuthenticatorSelectionDto struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// WebauthnCreationOptionsDto mirrors PublicKeyCredentialCreationOptionsJSON so browsers can pass
+// it to PublicKeyCredential.parseCreationOptionsFromJSON. Binary values are base64url.
+type WebauthnCreationOptionsDto struct {
+	Challenge              string                            `json:"challenge"`
+	RP                     WebauthnRelyingPartyDto           `json:"rp"`
+	User                   WebauthnUserEntityDto             `json:"user"`
+	PubKeyCredParams       []WebauthnCredentialParameterDto  `json:"pubKeyCredParams"`
+	Timeout                int64                             `json:"timeout"`
+	ExcludeCredentials     []WebauthnCredentialDescriptorDto `json:"excludeCredentials"`
+	AuthenticatorSelection WebauthnAuthenticatorSelectionDto `json:"authenticatorSelection"`
+	Attestation            string                            `json:"attestation"`
+}
+
+// WebauthnRequestOptionsDto mirrors PublicKeyCredentialRequestOptionsJSON. An empty
+// AllowCredentials lets the authenticator offer any discoverable passkey.
+type WebauthnRequestOptionsDto struct {
+	Challenge        string                            `json:"challenge"`
+	RPID             string                            `json:"rpId"`
+	Timeout          int64                             `json:"timeout"`
+	AllowCredentials []WebauthnCredentialDescriptorDto `json:"allowCredentials"`
+	UserVerification string                            `json:"userVerification"`
+}
+
+type WebauthnAttestationResponseDto struct {
+	ClientDataJSON    string   `json:"clientDataJSON" binding:"required"`
+	AttestationObject string   `json:"attestationObject" binding:"required"`
+	Transports        []string `json:"transports,omitempty"`
+}
+
+// WebauthnRegistrationCredentialDto is the JSON form of the credential returned by navigator.credentials.create.
+type WebauthnRegistrationCredentialDto struct {
+	ID       string                         `json:"id" binding:"required"`
+	RawID    string                         `json:"rawId"`
+	Type     string                         `json:"type"`
+	Response WebauthnAttestationResponseDto `json:"response" binding:"required"`
+}
+
+type WebauthnAssertionResponseDto struct {
+	ClientDataJSON    string `json:"clientDataJSON" binding:"required"`
+	AuthenticatorData string `json:"authenticatorData" binding:"required"`
+	Signature         string `json:"signature" binding:"required"`
+	UserHandle        string `json:"userHandle,omitempty"`
+}
+
+// WebauthnAssertionCredentialDto is the JSON form of the credential returned by navigator.credentials.get.
+type WebauthnAssertionCredentialDto struct {
+	ID       string                       `json:"id" binding:"required"`
+	RawID    string                       `json:"rawId"`
+	Type     string                       `json:"type"`
+	Response WebauthnAssertionResponseDto `json:"response" binding:"required"`
+}
+
+type FinishWebauthnRegistrationDto struct {
+	Name       string                            `json:"name" binding:"required"`
+	Credential WebauthnRegistrationCredentialDto `json:"credential" binding:"required"`
+}
+
+type BeginWebauthnLoginDto struct {
+	Username string `json:"username,omitempty"`
+}
+
+type FinishWebauthnLoginDto struct {
+	Credential WebauthnAssertionCredentialDto `json:"credential" binding:"required"`
+}
+
+type WebauthnTwoFactorLoginDto struct {
+	ChallengeToken string                         `json:"challengeToken" binding:"required"`
+	Credential     WebauthnAssertionCredentialDto `json:"credential" binding:"required"`
+}
@@ -0,0 +1,51 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/ofkm/arcane-backend/internal/services"
+)
+
+const AgentCertificateRenewalJobName = "AgentCertificateRenewal"
+
+func RegisterAgentCertificateRenewalJob(
+	ctx context.Context,
+	scheduler *Scheduler,
+	environmentService *services.EnvironmentService,
+) error {
+	slog.InfoContext(ctx, "Registering agent certificate renewal job", "jobName", AgentCertificateRenewalJobName)
+
+	taskFunc := func(jobCtx context.Context) error {
+		renewed, err := environmentService.RenewAgentCertificates(jobCtx)
+		if err != nil {
+			// Agents that were unreachable are retried on the next run; their certificates stay
+			// valid until well after the renewal window opens.
+			slog.WarnContext(jobCtx, "Failed to renew some agent certificates", "jobName", AgentCertificateRenewalJobName, "renewed", renewed, slog.Any("error", err))
+			return err
+		}
+
+		slog.InfoContext(jobCtx, "Agent certificate renewal job completed", "jobName", AgentCertificateRenewalJobName, "renewed", renewed)
+		return nil
+	}
+
+	jobDefinition := gocron.DurationJob(6 * time.Hour)
+
+	err := scheduler.RegisterJob(
+		ctx,
+		AgentCertificateRenewalJobName,
+		jobDefinition,
+		taskFunc,
+		false,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to register agent certificate renewal job %q: %w", AgentCertificateRenewalJobName, err)
+	}
+
+	slog.InfoContext(ctx, "Agent certificate renewal job registered successfully", "jobName", AgentCertificateRenewalJobName, "interval", "6h")
+	return nil
+}
@@ -3,27 +3,39 @@ package job
 import (
 	"context"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/go-co-op/gocron/v2"
 	"github.com/ofkm/arcane-backend/internal/services"
 )
 
+// remoteAutoUpdatePrefix names the auto-update jobs of remote environments, one per environment.
+const remoteAutoUpdatePrefix = "auto-update:"
+
+// AutoUpdateJob applies pending image updates on the global settings' schedule locally, and on
+// each remote agent environment's own schedule there.
 type AutoUpdateJob struct {
 	updaterService  *services.UpdaterService
 	settingsService *services.SettingsService
+	scheduleService *services.EnvironmentScheduleService
 	scheduler       *Scheduler
 }
 
-func NewAutoUpdateJob(scheduler *Scheduler, updaterService *services.UpdaterService, settingsService *services.SettingsService) *AutoUpdateJob {
+func NewAutoUpdateJob(scheduler *Scheduler, updaterService *services.UpdaterService, settingsService *services.SettingsService, scheduleService *services.EnvironmentScheduleService) *AutoUpdateJob {
 	return &AutoUpdateJob{
 		updaterService:  updaterService,
 		settingsService: settingsService,
+		scheduleService: scheduleService,
 		scheduler:       scheduler,
 	}
 }
 
 func (j *AutoUpdateJob) Register(ctx context.Context) error {
+	if err := j.RescheduleEnvironments(ctx); err != nil {
+		slog.WarnContext(ctx, "failed to schedule auto-update for remote environments", "error", err)
+	}
+
 	autoUpdateEnabled := j.settingsService.GetBoolSetting(ctx, "autoUpdate", false)
 	pollingEnabled := j.settingsService.GetBoolSetting(ctx, "pollingEnabled", true)
 	autoUpdateInterval := j.settingsService.GetIntSetting(ctx, "autoUpdateInterval", 1440)
@@ -85,6 +97,11 @@ func (j *AutoUpdateJob) Execute(ctx context.Context) error {
 }
 
 func (j *AutoUpdateJob) Reschedule(ctx context.Context) error {
+	// Remote environments without their own policy follow the global one.
+	if err := j.RescheduleEnvironments(ctx); err != nil {
+		slog.WarnContext(ctx, "failed to reschedule auto-update for remote environments", "error", err)
+	}
+
 	autoUpdateEnabled := j.settingsService.GetBoolSetting(ctx, "autoUpdate", false)
 	pollingEnabled := j.settingsService.GetBoolSetting(ctx, "pollingEnabled", true)
 	autoUpdateInterval := j.settingsService.GetIntSetting(ctx, "autoUpdateInterval", 1440)
@@ -104,3 +121,27 @@ func (j *AutoUpdateJob) Reschedule(ctx context.Context) error {
 
 	return j.scheduler.RescheduleDurationJobByName(ctx, "auto-update", interval, j.Execute, false)
 }
+
+// RescheduleEnvironments gives every remote agent environment that auto-updates a job on its own
+// interval and drops the jobs of the others.
+func (j *AutoUpdateJob) RescheduleEnvironments(ctx context.Context) error {
+	if j.scheduleService == nil {
+		return nil
+	}
+	schedules, err := j.scheduleService.RemoteSchedules(ctx)
+	if err != nil {
+		return err
+	}
+	intervals := map[string]time.Duration{}
+	for _, schedule := range schedules {
+		if schedule.PollingEnabled && schedule.AutoUpdate {
+			intervals[remoteAutoUpdatePrefix+schedule.EnvironmentID] = schedule.AutoUpdateInterval
+		}
+	}
+	return j.scheduler.SyncDurationJobs(ctx, remoteAutoUpdatePrefix, intervals, func(name string) func(ctx context.Context) error {
+		environmentID := strings.TrimPrefix(name, remoteAutoUpdatePrefix)
+		return func(ctx context.Context) error {
+			return j.scheduleService.ApplyUpdates(ctx, environmentID)
+		}
+	})
+}
@@ -0,0 +1,53 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/services"
+)
+
+const EnvironmentHealthJobName = "EnvironmentHealth"
+
+func RegisterEnvironmentHealthJob(
+	ctx context.Context,
+	scheduler *Scheduler,
+	healthService *services.EnvironmentHealthService,
+) error {
+	slog.InfoContext(ctx, "Registering environment health job", "jobName", EnvironmentHealthJobName)
+
+	taskFunc := func(jobCtx context.Context) error {
+		counts, err := healthService.CheckAll(jobCtx)
+		if err != nil {
+			slog.WarnContext(jobCtx, "Failed to record the health of some environments", "jobName", EnvironmentHealthJobName, slog.Any("error", err))
+			return err
+		}
+
+		slog.DebugContext(jobCtx, "Environment health job completed", "jobName", EnvironmentHealthJobName,
+			"online", counts[models.EnvironmentStatusOnline],
+			"offline", counts[models.EnvironmentStatusOffline],
+			"error", counts[models.EnvironmentStatusError])
+		return nil
+	}
+
+	jobDefinition := gocron.DurationJob(1 * time.Minute)
+
+	err := scheduler.RegisterJob(
+		ctx,
+		EnvironmentHealthJobName,
+		jobDefinition,
+		taskFunc,
+		true,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to register environment health job %q: %w", EnvironmentHealthJobName, err)
+	}
+
+	slog.InfoContext(ctx, "Environment health job registered successfully", "jobName", EnvironmentHealthJobName, "interval", "1m")
+	return nil
+}
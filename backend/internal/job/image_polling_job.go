@@ -3,6 +3,7 @@ package job
 import (
 	"context"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/go-co-op/gocron/v2"
@@ -10,23 +11,34 @@ import (
 	"github.com/ofkm/arcane-backend/internal/services"
 )
 
+// remoteImagePollingPrefix names the polling jobs of remote environments, one per environment.
+const remoteImagePollingPrefix = "image-polling:"
+
+// ImagePollingJob checks for image updates on the global settings' schedule locally, and on
+// each remote agent environment's own schedule there.
 type ImagePollingJob struct {
 	imageUpdateService *services.ImageUpdateService
 	settingsService    *services.SettingsService
 	environmentService *services.EnvironmentService
+	scheduleService    *services.EnvironmentScheduleService
 	scheduler          *Scheduler
 }
 
-func NewImagePollingJob(scheduler *Scheduler, imageUpdateService *services.ImageUpdateService, settingsService *services.SettingsService, environmentService *services.EnvironmentService) *ImagePollingJob {
+func NewImagePollingJob(scheduler *Scheduler, imageUpdateService *services.ImageUpdateService, settingsService *services.SettingsService, environmentService *services.EnvironmentService, scheduleService *services.EnvironmentScheduleService) *ImagePollingJob {
 	return &ImagePollingJob{
 		imageUpdateService: imageUpdateService,
 		settingsService:    settingsService,
 		environmentService: environmentService,
+		scheduleService:    scheduleService,
 		scheduler:          scheduler,
 	}
 }
 
 func (j *ImagePollingJob) Register(ctx context.Context) error {
+	if err := j.RescheduleEnvironments(ctx); err != nil {
+		slog.WarnContext(ctx, "failed to schedule image polling for remote environments", slog.Any("error", err))
+	}
+
 	pollingEnabled := j.settingsService.GetBoolSetting(ctx, "pollingEnabled", true)
 	pollingInterval := j.settingsService.GetIntSetting(ctx, "pollingInterval", 60)
 
@@ -102,6 +114,11 @@ func (j *ImagePollingJob) loadRegistryCredentials(ctx context.Context) ([]dto.Co
 }
 
 func (j *ImagePollingJob) Reschedule(ctx context.Context) error {
+	// Remote environments without their own interval follow the global one.
+	if err := j.RescheduleEnvironments(ctx); err != nil {
+		slog.WarnContext(ctx, "failed to reschedule image polling for remote environments", slog.Any("error", err))
+	}
+
 	pollingEnabled := j.settingsService.GetBoolSetting(ctx, "pollingEnabled", true)
 	pollingInterval := j.settingsService.GetIntSetting(ctx, "pollingInterval", 60)
 
@@ -119,3 +136,27 @@ func (j *ImagePollingJob) Reschedule(ctx context.Context) error {
 
 	return j.scheduler.RescheduleDurationJobByName(ctx, "image-polling", interval, j.Execute, false)
 }
+
+// RescheduleEnvironments gives every remote agent environment that polls a job on its own
+// interval and drops the jobs of the others.
+func (j *ImagePollingJob) RescheduleEnvironments(ctx context.Context) error {
+	if j.scheduleService == nil {
+		return nil
+	}
+	schedules, err := j.scheduleService.RemoteSchedules(ctx)
+	if err != nil {
+		return err
+	}
+	intervals := map[string]time.Duration{}
+	for _, schedule := range schedules {
+		if schedule.PollingEnabled {
+			intervals[remoteImagePollingPrefix+schedule.EnvironmentID] = schedule.PollingInterval
+		}
+	}
+	return j.scheduler.SyncDurationJobs(ctx, remoteImagePollingPrefix, intervals, func(name string) func(ctx context.Context) error {
+		environmentID := strings.TrimPrefix(name, remoteImagePollingPrefix)
+		return func(ctx context.Context) error {
+			return j.scheduleService.CheckImages(ctx, environmentID)
+		}
+	})
+}
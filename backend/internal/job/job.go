@@ -2,8 +2,11 @@ package job
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-co-op/gocron/v2"
@@ -12,6 +15,10 @@ import (
 
 type Scheduler struct {
 	scheduler gocron.Scheduler
+
+	mu sync.Mutex
+	// synced holds the intervals of the jobs registered through SyncDurationJobs.
+	synced map[string]time.Duration
 }
 
 func NewScheduler() (*Scheduler, error) {
@@ -19,7 +26,7 @@ func NewScheduler() (*Scheduler, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new gocron scheduler: %w", err)
 	}
-	return &Scheduler{scheduler: s}, nil
+	return &Scheduler{scheduler: s, synced: map[string]time.Duration{}}, nil
 }
 
 func (s *Scheduler) Run(ctx context.Context) error {
@@ -102,3 +109,40 @@ func (s *Scheduler) RescheduleDurationJobByName(
 	definition := gocron.DurationJob(interval)
 	return s.RegisterJob(ctx, name, definition, taskFunc, runImmediately)
 }
+
+// SyncDurationJobs makes the jobs named with prefix match intervals, which maps job names to
+// their interval: missing jobs are registered, jobs whose interval changed are rescheduled and
+// the others named with prefix removed. Jobs whose interval is unchanged keep their cadence.
+func (s *Scheduler) SyncDurationJobs(
+	ctx context.Context,
+	prefix string,
+	intervals map[string]time.Duration,
+	taskFor func(name string) func(ctx context.Context) error,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, j := range s.scheduler.Jobs() {
+		name := j.Name()
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if interval, ok := intervals[name]; !ok || s.synced[name] != interval {
+			_ = s.scheduler.RemoveJob(j.ID())
+			delete(s.synced, name)
+		}
+	}
+
+	var errs []error
+	for name, interval := range intervals {
+		if _, ok := s.synced[name]; ok {
+			continue
+		}
+		if err := s.RegisterJob(ctx, name, gocron.DurationJob(interval), taskFor(name), false); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		s.synced[name] = interval
+	}
+	return errors.Join(errs...)
+}
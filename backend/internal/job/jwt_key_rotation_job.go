@@ -0,0 +1,55 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/ofkm/arcane-backend/internal/services"
+)
+
+const JwtKeyRotationJobName = "JwtKeyRotation"
+
+func RegisterJwtKeyRotationJob(
+	ctx context.Context,
+	scheduler *Scheduler,
+	jwtKeyService *services.JwtKeyService,
+) error {
+	slog.InfoContext(ctx, "Registering JWT key rotation job", "jobName", JwtKeyRotationJobName)
+
+	taskFunc := func(jobCtx context.Context) error {
+		// The rotation interval is read on every run, so settings changes need no reschedule.
+		rotated, err := jwtKeyService.RotateIfDue(jobCtx)
+		if err != nil {
+			slog.ErrorContext(jobCtx, "Failed to rotate JWT signing key", "jobName", JwtKeyRotationJobName, slog.Any("error", err))
+			return err
+		}
+		if _, err := jwtKeyService.PruneExpired(jobCtx); err != nil {
+			slog.ErrorContext(jobCtx, "Failed to prune expired JWT signing keys", "jobName", JwtKeyRotationJobName, slog.Any("error", err))
+			return err
+		}
+
+		slog.InfoContext(jobCtx, "JWT key rotation job completed", "jobName", JwtKeyRotationJobName, "rotated", rotated)
+		return nil
+	}
+
+	// Check hourly; keys are rotated in days, so this keeps rotation close to the interval
+	jobDefinition := gocron.DurationJob(time.Hour)
+
+	err := scheduler.RegisterJob(
+		ctx,
+		JwtKeyRotationJobName,
+		jobDefinition,
+		taskFunc,
+		true, // Create the key ring and catch up on missed rotations at startup
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to register JWT key rotation job %q: %w", JwtKeyRotationJobName, err)
+	}
+
+	slog.InfoContext(ctx, "JWT key rotation job registered successfully", "jobName", JwtKeyRotationJobName, "interval", "1h")
+	return nil
+}
@@ -0,0 +1,51 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/ofkm/arcane-backend/internal/services"
+)
+
+const ProjectGitSyncJobName = "ProjectGitSync"
+
+// RegisterProjectGitSyncJob checks every minute for Git projects whose own sync interval has
+// passed and syncs them.
+func RegisterProjectGitSyncJob(
+	ctx context.Context,
+	scheduler *Scheduler,
+	gitService *services.ProjectGitService,
+) error {
+	slog.InfoContext(ctx, "Registering project git sync job", "jobName", ProjectGitSyncJobName)
+
+	taskFunc := func(jobCtx context.Context) error {
+		synced, err := gitService.SyncDue(jobCtx)
+		if err != nil {
+			slog.WarnContext(jobCtx, "Failed to sync some git projects", "jobName", ProjectGitSyncJobName, slog.Any("error", err))
+			return err
+		}
+
+		slog.DebugContext(jobCtx, "Project git sync job completed", "jobName", ProjectGitSyncJobName, "synced", synced)
+		return nil
+	}
+
+	jobDefinition := gocron.DurationJob(1 * time.Minute)
+
+	err := scheduler.RegisterJob(
+		ctx,
+		ProjectGitSyncJobName,
+		jobDefinition,
+		taskFunc,
+		false,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to register project git sync job %q: %w", ProjectGitSyncJobName, err)
+	}
+
+	slog.InfoContext(ctx, "Project git sync job registered successfully", "jobName", ProjectGitSyncJobName, "interval", "1m")
+	return nil
+}
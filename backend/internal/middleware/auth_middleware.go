@@ -2,8 +2,10 @@ package middleware
 
 import (
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -14,40 +16,66 @@ import (
 )
 
 const (
-	headerAgentBootstrap = "X-Arcane-Agent-Bootstrap"
-	headerAgentToken     = "X-Arcane-Agent-Token" // #nosec G101: header name, not a credential
-	agentPairingPrefix   = "/api/environments/0/agent/pair"
+	headerAgentBootstrap   = "X-Arcane-Agent-Bootstrap"
+	headerAgentToken       = "X-Arcane-Agent-Token" // #nosec G101: header name, not a credential
+	headerAgentUser        = "X-Arcane-Agent-User"
+	headerAgentPermissions = "X-Arcane-Agent-Permissions"
+	agentPairingPrefix     = "/api/environments/0/agent/pair"
+)
+
+var (
+	errAuthenticationRequired = errors.New("authentication required")
+	errProxyAuthFailed        = errors.New("proxy authentication failed")
 )
 
 type AuthOptions struct {
-	AdminRequired   bool
+	Permissions     []models.Permission
 	SuccessOptional bool
 }
 
 type AuthMiddleware struct {
-	authService *services.AuthService
-	cfg         *config.Config
-	options     AuthOptions
+	authService        *services.AuthService
+	roleService        *services.RoleService
+	environmentService *services.EnvironmentService
+	apiTokenService    *services.ApiTokenService
+	proxyAuthService   *services.ProxyAuthService
+	agentTokens        *services.AgentTokenService
+	agentTLS           *services.AgentTLSService
+	cfg                *config.Config
+	options            AuthOptions
 }
 
-func NewAuthMiddleware(authService *services.AuthService, cfg *config.Config) *AuthMiddleware {
+func NewAuthMiddleware(
+	authService *services.AuthService,
+	roleService *services.RoleService,
+	environmentService *services.EnvironmentService,
+	apiTokenService *services.ApiTokenService,
+	proxyAuthService *services.ProxyAuthService,
+	agentTokens *services.AgentTokenService,
+	agentTLS *services.AgentTLSService,
+	cfg *config.Config,
+) *AuthMiddleware {
 	return &AuthMiddleware{
-		authService: authService,
-		cfg:         cfg,
-		options:     AuthOptions{},
+		authService:        authService,
+		roleService:        roleService,
+		environmentService: environmentService,
+		apiTokenService:    apiTokenService,
+		proxyAuthService:   proxyAuthService,
+		agentTokens:        agentTokens,
+		agentTLS:           agentTLS,
+		cfg:                cfg,
+		options:            AuthOptions{},
 	}
 }
 
-func (m *AuthMiddleware) WithAdminRequired() *AuthMiddleware {
-	clone := *m
-	clone.options.AdminRequired = true
-	return &clone
-}
-func (m *AuthMiddleware) WithAdminNotRequired() *AuthMiddleware {
+// WithPermissions returns a copy of the middleware that additionally requires the caller
+// to hold every one of the given permissions.
+func (m *AuthMiddleware) WithPermissions(perms ...models.Permission) *AuthMiddleware {
 	clone := *m
-	clone.options.AdminRequired = false
+	clone.options.Permissions = append(slices.Clone(m.options.Permissions), perms...)
 	return &clone
 }
+
 func (m *AuthMiddleware) WithSuccessOptional() *AuthMiddleware {
 	clone := *m
 	clone.options.SuccessOptional = true
@@ -78,7 +106,33 @@ func (m *AuthMiddleware) agentAuth(c *gin.Context) {
 		return
 	}
 
-	if tok := c.GetHeader(headerAgentToken); tok != "" && m.cfg.AgentToken != "" && tok == m.cfg.AgentToken {
+	if tok := c.GetHeader(headerAgentToken); m.agentTokens != nil && m.agentTokens.Valid(tok) {
+		// Over TLS the token alone is not enough once the agent holds a certificate from its
+		// manager: the connection must also carry the manager's client certificate. Requests
+		// arriving through the agent's own tunnel have no TLS state and are exempt.
+		if m.agentTLS != nil && c.Request.TLS != nil {
+			if err := m.agentTLS.VerifyManager(c.Request.TLS); err != nil {
+				slog.Warn("Agent auth: missing manager client certificate", "path", c.Request.URL.Path, "method", c.Request.Method)
+				c.JSON(http.StatusForbidden, models.APIError{
+					Code:    "FORBIDDEN",
+					Message: "Manager client certificate required",
+				})
+				c.Abort()
+				return
+			}
+		}
+		// Requests proxied on behalf of a manager user carry that user's identity and
+		// permissions; the manager already authenticated them, we only enforce.
+		if userID := c.GetHeader(headerAgentUser); userID != "" {
+			user := &models.User{BaseModel: models.BaseModel{ID: userID}, Username: userID}
+			perms := parsePermissionsHeader(c.GetHeader(headerAgentPermissions))
+			if !m.authorize(c, perms) {
+				return
+			}
+			setAuthenticatedUser(c, user, perms)
+			c.Next()
+			return
+		}
 		agentSudo(c)
 		return
 	}
@@ -87,7 +141,7 @@ func (m *AuthMiddleware) agentAuth(c *gin.Context) {
 		"path", c.Request.URL.Path,
 		"method", c.Request.Method,
 		"has_agent_token_hdr", c.GetHeader(headerAgentToken) != "",
-		"agent_token_config_set", m.cfg.AgentToken != "",
+		"agent_token_set", m.agentTokens != nil && m.agentTokens.Token() != "",
 	)
 	c.JSON(http.StatusForbidden, models.APIError{
 		Code:    "FORBIDDEN",
@@ -97,58 +151,201 @@ func (m *AuthMiddleware) agentAuth(c *gin.Context) {
 }
 
 func (m *AuthMiddleware) managerAuth(c *gin.Context) {
-	token := extractBearerOrCookieToken(c)
-	if token == "" {
-		if m.options.SuccessOptional {
+	user, sessionID, perms, err := m.identifyRequest(c)
+	if err != nil {
+		// A token from before an update is always reported so the client drops it.
+		if m.options.SuccessOptional && !errors.Is(err, services.ErrTokenVersionMismatch) {
 			c.Next()
 			return
 		}
-		c.JSON(http.StatusUnauthorized, models.APIError{
-			Code:    models.APIErrorCodeUnauthorized,
-			Message: "Authentication required",
-		})
-		c.Abort()
+		abortUnauthenticated(c, err)
+		return
+	}
+
+	m.authenticated(c, user, sessionID, perms)
+}
+
+// authenticated applies environment scoping and the route's permission check for an identified
+// caller, then hands the request on.
+func (m *AuthMiddleware) authenticated(c *gin.Context, user *models.User, sessionID string, perms []models.Permission) {
+	perms, ok := m.scopeToEnvironment(c, user, perms)
+	if !ok {
+		return
+	}
+
+	if !m.authorize(c, perms) {
 		return
 	}
 
-	user, err := m.authService.VerifyToken(c.Request.Context(), token)
+	setAuthenticatedUser(c, user, perms)
+	// Services that record who did something, such as the audit trail, read the client from the
+	// request context.
+	c.Request = c.Request.WithContext(services.WithClientInfo(c.Request.Context(), services.ClientInfo{
+		UserAgent: c.Request.UserAgent(),
+		IPAddress: c.ClientIP(),
+	}))
+	if sessionID != "" {
+		c.Set("sessionID", sessionID)
+	}
+	c.Next()
+}
+
+// identifyProxyUser authenticates a request without a token from the headers of a trusted
+// reverse proxy. It returns a nil user when proxy authentication does not apply. The direct peer
+// address is checked, never X-Forwarded-For, so clients cannot claim to be the proxy.
+func (m *AuthMiddleware) identifyProxyUser(c *gin.Context) (*models.User, []models.Permission, error) {
+	if m.proxyAuthService == nil {
+		return nil, nil, nil
+	}
+	user, err := m.proxyAuthService.Authenticate(c.Request.Context(), c.RemoteIP(), c.Request.Header)
+	if err != nil || user == nil {
+		return nil, nil, err
+	}
+	perms, err := m.roleService.ResolvePermissions(c.Request.Context(), user.Roles)
 	if err != nil {
-		if errors.Is(err, services.ErrTokenVersionMismatch) {
-			cookie.ClearTokenCookie(c)
-			c.JSON(http.StatusUnauthorized, models.APIError{
-				Code:    models.APIErrorCodeUnauthorized,
-				Message: "Application has been updated. Please log in again.",
-			})
-			c.Abort()
-			return
-		}
+		return nil, nil, err
+	}
+	return user, perms, nil
+}
 
-		if m.options.SuccessOptional {
-			c.Next()
-			return
+// identifyRequest resolves the caller from the bearer or cookie token, falling back to the
+// headers of a trusted reverse proxy when there is no token or it does not verify, so a stale
+// cookie cannot shadow the proxy's identity. Without either it returns errAuthenticationRequired.
+func (m *AuthMiddleware) identifyRequest(c *gin.Context) (*models.User, string, []models.Permission, error) {
+	var tokenErr error
+	if token := extractBearerOrCookieToken(c); token != "" {
+		user, sessionID, perms, err := m.identify(c, token)
+		if err == nil {
+			return user, sessionID, perms, nil
 		}
-		c.JSON(http.StatusUnauthorized, models.APIError{
-			Code:    models.APIErrorCodeUnauthorized,
-			Message: "Invalid or expired token",
+		tokenErr = err
+	}
+
+	user, perms, err := m.identifyProxyUser(c)
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "Proxy authentication failed", "error", err)
+		return nil, "", nil, fmt.Errorf("%w: %w", errProxyAuthFailed, err)
+	}
+	if user != nil {
+		return user, "", perms, nil
+	}
+	if tokenErr != nil {
+		return nil, "", nil, tokenErr
+	}
+	return nil, "", nil, errAuthenticationRequired
+}
+
+// abortUnauthenticated answers 401 for an error from identifyRequest.
+func abortUnauthenticated(c *gin.Context, err error) {
+	message := "Invalid or expired token"
+	switch {
+	case errors.Is(err, errAuthenticationRequired):
+		message = "Authentication required"
+	case errors.Is(err, errProxyAuthFailed):
+		message = "Proxy authentication failed"
+	case errors.Is(err, services.ErrTokenVersionMismatch):
+		cookie.ClearTokenCookie(c)
+		message = "Application has been updated. Please log in again."
+	}
+	c.JSON(http.StatusUnauthorized, models.APIError{
+		Code:    models.APIErrorCodeUnauthorized,
+		Message: message,
+	})
+	c.Abort()
+}
+
+// identify verifies the token and resolves the permissions granted by the user's roles. Both
+// access JWTs and personal API tokens are accepted; an API token's scopes further narrow the
+// owner's permissions. The session ID is empty for API tokens.
+func (m *AuthMiddleware) identify(c *gin.Context, token string) (*models.User, string, []models.Permission, error) {
+	var user *models.User
+	var sessionID string
+	var scopes []models.Permission
+	var err error
+	apiToken := services.IsApiToken(token) && m.apiTokenService != nil
+	if apiToken {
+		user, scopes, err = m.apiTokenService.Authenticate(c.Request.Context(), token)
+	} else {
+		ctx := services.WithClientInfo(c.Request.Context(), services.ClientInfo{IPAddress: c.ClientIP()})
+		user, sessionID, err = m.authService.VerifyTokenSession(ctx, token)
+	}
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	perms, err := m.roleService.ResolvePermissions(c.Request.Context(), user.Roles)
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "Failed to resolve user permissions", "user", user.Username, "error", err)
+		return nil, "", nil, err
+	}
+	if apiToken && !slices.Contains(scopes, models.PermissionAll) {
+		perms = models.IntersectPermissions(perms, scopes)
+	}
+	return user, sessionID, perms, nil
+}
+
+// scopeToEnvironment narrows perms to the caller's access grant when the route addresses an
+// environment. It aborts with 403 when the environment is restricted and the caller holds no grant.
+func (m *AuthMiddleware) scopeToEnvironment(c *gin.Context, user *models.User, perms []models.Permission) ([]models.Permission, bool) {
+	envID := environmentIDFromRoute(c)
+	if envID == "" || m.environmentService == nil || models.HasPermission(perms, models.PermissionAll) {
+		return perms, true
+	}
+
+	level, restricted, err := m.environmentService.ResolveEnvironmentAccess(c.Request.Context(), envID, user)
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "Failed to resolve environment access", "user", user.Username, "environment", envID, "error", err)
+		c.JSON(http.StatusInternalServerError, models.APIError{
+			Code:    models.APIErrorCodeInternalServerError,
+			Message: "Failed to resolve environment access",
 		})
 		c.Abort()
-		return
+		return nil, false
 	}
-
-	isAdmin := userHasRole(user, "admin")
-	if m.options.AdminRequired && !isAdmin {
+	if !restricted {
+		return perms, true
+	}
+	if level == "" {
 		c.JSON(http.StatusForbidden, models.APIError{
-			Code:    "FORBIDDEN",
-			Message: "You don't have permission to access this resource",
+			Code:    models.APIErrorCodeForbidden,
+			Message: "You don't have access to this environment",
+			Details: gin.H{"environmentId": envID},
 		})
 		c.Abort()
-		return
+		return nil, false
+	}
+	return level.Restrict(perms), true
+}
+
+// environmentIDFromRoute returns the environment addressed by an /environments/:id route.
+func environmentIDFromRoute(c *gin.Context) string {
+	if !strings.HasPrefix(c.FullPath(), "/api/environments/:id") {
+		return ""
+	}
+	return c.Param("id")
+}
+
+// authorize aborts with 403 when perms do not cover every permission this middleware requires.
+func (m *AuthMiddleware) authorize(c *gin.Context, perms []models.Permission) bool {
+	for _, required := range m.options.Permissions {
+		if !models.HasPermission(perms, required) {
+			c.JSON(http.StatusForbidden, models.APIError{
+				Code:    models.APIErrorCodeForbidden,
+				Message: "You don't have permission to access this resource",
+				Details: gin.H{"missingPermission": required},
+			})
+			c.Abort()
+			return false
+		}
 	}
+	return true
+}
 
+func setAuthenticatedUser(c *gin.Context, user *models.User, perms []models.Permission) {
 	c.Set("userID", user.ID)
 	c.Set("currentUser", user)
-	c.Set("userIsAdmin", isAdmin)
-	c.Next()
+	c.Set("userPermissions", perms)
+	c.Set("userIsAdmin", models.HasPermission(perms, models.PermissionAll))
 }
 
 func isPreflight(c *gin.Context) bool {
@@ -160,11 +357,9 @@ func agentSudo(c *gin.Context) {
 	agentUser := &models.User{
 		BaseModel: models.BaseModel{ID: "agent"},
 		Email:     &email,
-		Roles:     []string{"admin"},
+		Roles:     []string{models.RoleAdmin},
 	}
-	c.Set("userID", agentUser.ID)
-	c.Set("currentUser", agentUser)
-	c.Set("userIsAdmin", true)
+	setAuthenticatedUser(c, agentUser, []models.Permission{models.PermissionAll})
 	c.Next()
 }
 
@@ -179,13 +374,28 @@ func extractBearerOrCookieToken(c *gin.Context) string {
 	return ""
 }
 
-func userHasRole(user *models.User, role string) bool {
-	for _, r := range user.Roles {
-		if r == role {
-			return true
+// IsApiTokenRequest reports whether the request authenticated with a personal API token rather
+// than a login session.
+func IsApiTokenRequest(c *gin.Context) bool {
+	return services.IsApiToken(extractBearerOrCookieToken(c))
+}
+
+func parsePermissionsHeader(v string) []models.Permission {
+	var perms []models.Permission
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			perms = append(perms, models.Permission(p))
 		}
 	}
-	return false
+	return perms
+}
+
+func formatPermissionsHeader(perms []models.Permission) string {
+	parts := make([]string, len(perms))
+	for i, p := range perms {
+		parts[i] = string(p)
+	}
+	return strings.Join(parts, ",")
 }
 
 func GetCurrentUserID(c *gin.Context) (string, bool) {
@@ -197,6 +407,16 @@ func GetCurrentUserID(c *gin.Context) (string, bool) {
 	return userIDStr, ok
 }
 
+// GetCurrentSessionID returns the login session the request's access token belongs to.
+func GetCurrentSessionID(c *gin.Context) (string, bool) {
+	sessionID, exists := c.Get("sessionID")
+	if !exists {
+		return "", false
+	}
+	id, ok := sessionID.(string)
+	return id, ok
+}
+
 func GetCurrentUser(c *gin.Context) (*models.User, bool) {
 	user, exists := c.Get("currentUser")
 	if !exists {
@@ -206,6 +426,16 @@ func GetCurrentUser(c *gin.Context) (*models.User, bool) {
 	return u, ok
 }
 
+// GetCurrentUserPermissions returns the permissions resolved for the authenticated caller.
+func GetCurrentUserPermissions(c *gin.Context) []models.Permission {
+	perms, exists := c.Get("userPermissions")
+	if !exists {
+		return nil
+	}
+	p, _ := perms.([]models.Permission)
+	return p
+}
+
 func RequireAuthentication(c *gin.Context) (*models.User, bool) {
 	user, exists := GetCurrentUser(c)
 	if !exists {
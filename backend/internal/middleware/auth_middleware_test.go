@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	glsqlite "github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/ofkm/arcane-backend/internal/config"
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/dto"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/services"
+	"github.com/ofkm/arcane-backend/internal/utils"
+)
+
+// setupProxyAuthMiddleware returns an auth middleware that accepts proxy headers from 10.0.0.1
+// for the existing admin "mia", and mia's user ID.
+func setupProxyAuthMiddleware(t *testing.T) (*AuthMiddleware, *services.EnvironmentService, string) {
+	t.Helper()
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+	utils.InitEncryption(&config.Config{})
+
+	gdb, err := gorm.Open(glsqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, gdb.AutoMigrate(&models.User{}, &models.Role{}, &models.SettingVariable{}, &models.Event{}, &models.Environment{}, &models.JwtSigningKey{}))
+	db := &database.DB{DB: gdb}
+
+	settingsService, err := services.NewSettingsService(ctx, db)
+	require.NoError(t, err)
+	require.NoError(t, settingsService.EnsureDefaultSettings(ctx))
+	raw, err := json.Marshal(models.ProxyAuthConfig{TrustedProxies: []string{"10.0.0.1"}})
+	require.NoError(t, err)
+	require.NoError(t, settingsService.SetStringSetting(ctx, "authProxyConfig", string(raw)))
+	require.NoError(t, settingsService.SetBoolSetting(ctx, "authProxyEnabled", true))
+
+	userService := services.NewUserService(db)
+	eventService := services.NewEventService(db)
+	mia, err := userService.CreateUser(ctx, &models.User{Username: "mia", Roles: models.StringSlice{models.RoleAdmin}})
+	require.NoError(t, err)
+
+	authService := services.NewAuthService(userService, settingsService, eventService, nil, nil, nil, nil, nil, services.NewJwtKeyService(db, settingsService, ""), &config.Config{})
+	envService := services.NewEnvironmentService(db, &http.Client{})
+	proxyAuth := services.NewProxyAuthService(db, settingsService, userService, eventService)
+	return NewAuthMiddleware(authService, services.NewRoleService(db), envService, nil, proxyAuth, nil, nil, &config.Config{}), envService, mia.ID
+}
+
+func proxiedRequest(remoteAddr, remoteUser, token string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/api/environments/remote/containers", nil)
+	req.RemoteAddr = remoteAddr
+	if remoteUser != "" {
+		req.Header.Set("Remote-User", remoteUser)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+func TestAuthMiddleware_FallsBackToProxyAuthentication(t *testing.T) {
+	authMiddleware, _, miaID := setupProxyAuthMiddleware(t)
+
+	router := gin.New()
+	handler := func(c *gin.Context) {
+		userID, _ := GetCurrentUserID(c)
+		c.String(http.StatusOK, userID)
+	}
+	router.GET("/api/environments/remote/containers", authMiddleware.Add(), handler)
+	router.GET("/optional", authMiddleware.WithSuccessOptional().Add(), handler)
+
+	// A token that does not verify falls back to the proxy headers.
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, proxiedRequest("10.0.0.1:40000", "mia", "stale"))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Equal(t, miaID, rec.Body.String())
+
+	// An unknown proxy user fails authentication, unless it is optional for the route.
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, proxiedRequest("10.0.0.1:40000", "ghost", ""))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req := proxiedRequest("10.0.0.1:40000", "ghost", "")
+	req.URL.Path = "/optional"
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Empty(t, rec.Body.String())
+}
+
+func TestAuthMiddleware_ApiTokenScopes(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+	gdb, err := gorm.Open(glsqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, gdb.AutoMigrate(&models.User{}, &models.Role{}, &models.ApiToken{}))
+	db := &database.DB{DB: gdb}
+
+	userService := services.NewUserService(db)
+	apiTokenService := services.NewApiTokenService(db)
+	admin, err := userService.CreateUser(ctx, &models.User{Username: "root", Roles: models.StringSlice{models.RoleAdmin}})
+	require.NoError(t, err)
+
+	authMiddleware := NewAuthMiddleware(nil, services.NewRoleService(db), nil, apiTokenService, nil, nil, nil, &config.Config{})
+	router := gin.New()
+	router.GET("/users", authMiddleware.WithPermissions(models.PermissionUsersManage).Add(), func(c *gin.Context) {
+		c.String(http.StatusOK, formatPermissionsHeader(GetCurrentUserPermissions(c)))
+	})
+	call := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	all, err := apiTokenService.CreateToken(ctx, admin.ID, dto.CreateApiTokenDto{Name: "all", Scopes: []string{"*"}})
+	require.NoError(t, err)
+	rec := call(all.Token)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Equal(t, "*", rec.Body.String(), "an explicit * scope keeps the owner's wildcard")
+
+	narrow, err := apiTokenService.CreateToken(ctx, admin.ID, dto.CreateApiTokenDto{Name: "narrow", Scopes: []string{string(models.PermissionProjectsRead)}})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusForbidden, call(narrow.Token).Code)
+
+	// A token stored without scopes carries no permissions rather than all of them.
+	require.NoError(t, gdb.Model(&models.ApiToken{}).Where("id = ?", narrow.ID).Update("scopes", models.StringSlice{}).Error)
+	require.Equal(t, http.StatusForbidden, call(narrow.Token).Code)
+}
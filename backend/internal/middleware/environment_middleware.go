@@ -2,44 +2,143 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"math"
 	"net/http"
+	"net/http/httptrace"
 	"path"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/ofkm/arcane-backend/internal/models"
 	"github.com/ofkm/arcane-backend/internal/services"
 	"github.com/ofkm/arcane-backend/internal/utils/remenv"
 	wsutil "github.com/ofkm/arcane-backend/internal/utils/ws"
 )
 
-// EnvResolver should return the environment api url, optional access token, whether the env is enabled, and an error.
-type EnvResolver func(ctx context.Context, id string) (apiURL string, accessToken *string, enabled bool, err error)
+// EnvResolver should return the environment with its access token decrypted, or an error.
+type EnvResolver func(ctx context.Context, id string) (*models.Environment, error)
 
 // NewEnvProxyMiddlewareWithParam returns a gin middleware that proxies requests whose environment id
 // is remote. paramName is the URL param key (e.g. "id") that contains the environment id when using
 // router groups; if that param is not present the middleware will attempt to auto-detect the id
 // by parsing the request path after the first "/environments/" segment.
-func NewEnvProxyMiddlewareWithParam(localID string, paramName string, resolver EnvResolver, envService *services.EnvironmentService) gin.HandlerFunc {
+//
+// Remote requests are authenticated here before being proxied, and the caller's identity and
+// permissions are forwarded so the agent can enforce the same route permissions. Environments
+// whose agent holds a tunnel open are reached through it instead of their API URL. Direct Docker
+// environments are not proxied: their container, image, network and volume routes are served
+// here against the environment's daemon, and the route's own middleware authenticates them.
+//
+// How long a proxied request may take depends on the route, see proxyTimeoutsFor. Reads that fail
+// to reach the agent are retried, and once an agent keeps failing its requests fail fast with 503
+// until it answers again.
+func NewEnvProxyMiddlewareWithParam(localID string, paramName string, resolver EnvResolver, envService *services.EnvironmentService, authMiddleware *AuthMiddleware) gin.HandlerFunc {
 	m := &EnvironmentMiddleware{
-		localID:    localID,
-		resolver:   resolver,
-		envService: envService,
-		httpClient: &http.Client{
-			Timeout: 60 * time.Second,
-		},
+		localID:      localID,
+		resolver:     resolver,
+		envService:   envService,
+		auth:         authMiddleware,
+		retryBackoff: 250 * time.Millisecond,
 	}
 	return m.handle(paramName)
 }
 
 type EnvironmentMiddleware struct {
-	localID    string
-	resolver   EnvResolver
-	envService *services.EnvironmentService
-	httpClient *http.Client
+	localID      string
+	resolver     EnvResolver
+	envService   *services.EnvironmentService
+	auth         *AuthMiddleware
+	retryBackoff time.Duration
+}
+
+// proxyTimeouts bounds a proxied request. total caps the whole exchange, body included;
+// responseHeader caps the wait for the agent to start answering once the request has been sent.
+// Zero means no limit beyond the caller's own.
+type proxyTimeouts struct {
+	total          time.Duration
+	responseHeader time.Duration
+	retries        int
+}
+
+var (
+	// streamTimeouts suit routes that report progress as they go, so only their start is bounded.
+	streamTimeouts = proxyTimeouts{responseHeader: 30 * time.Second}
+	// longMutateTimeouts suit routes that only answer once a lengthy operation is done.
+	longMutateTimeouts = proxyTimeouts{total: 30 * time.Minute}
+	mutateTimeouts     = proxyTimeouts{total: 60 * time.Second}
+	listTimeouts       = proxyTimeouts{total: 30 * time.Second, retries: 2}
+)
+
+// proxyRouteTimeouts lists the routes below /api/environments/:id that do not fit the default for
+// their method.
+var proxyRouteTimeouts = map[string]proxyTimeouts{
+	"POST /images/pull":                     streamTimeouts,
+	"POST /images/upload":                   streamTimeouts,
+	"POST /projects/:projectId/pull":        streamTimeouts,
+	"GET /volumes/:volumeName/archive":      streamTimeouts,
+	"PUT /volumes/:volumeName/archive":      streamTimeouts,
+	"POST /projects/:projectId/up":          longMutateTimeouts,
+	"POST /projects/:projectId/redeploy":    longMutateTimeouts,
+	"POST /projects/git":                    longMutateTimeouts,
+	"POST /projects/:projectId/git/sync":    longMutateTimeouts,
+	"POST /images/prune":                    longMutateTimeouts,
+	"POST /system/prune":                    longMutateTimeouts,
+	"POST /image-updates/check-all":         longMutateTimeouts,
+	"POST /image-updates/check-batch":       longMutateTimeouts,
+	"POST /updater/run":                     longMutateTimeouts,
+	"POST /system/containers/start-all":     longMutateTimeouts,
+	"POST /system/containers/start-stopped": longMutateTimeouts,
+	"POST /system/containers/stop-all":      longMutateTimeouts,
+}
+
+// proxyTimeoutsFor returns the timeouts for a route: reads are listings unless listed otherwise,
+// everything else a mutation.
+func proxyTimeoutsFor(method, fullPath string) proxyTimeouts {
+	if t, ok := proxyRouteTimeouts[method+" "+strings.TrimPrefix(fullPath, "/api/environments/:id")]; ok {
+		return t
+	}
+	if isIdempotentMethod(method) {
+		return listTimeouts
+	}
+	return mutateTimeouts
+}
+
+func isIdempotentMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead
+}
+
+// publicEnvRoutes are environment-scoped routes, keyed by method and path, that may be proxied
+// without a logged-in user. Project webhooks authenticate their callers themselves.
+var publicEnvRoutes = map[string]struct{}{
+	"GET /api/environments/:id/settings/public":              {},
+	"POST /api/environments/:id/projects/:projectId/webhook": {},
+}
+
+// directDockerRoutes are the route prefixes below /api/environments/:id served for direct Docker
+// environments; everything else needs an agent.
+var directDockerRoutes = []string{"/containers", "/images", "/networks", "/volumes", "/system/docker/info", "/system/prune", "/system/containers"}
+
+func isDirectDockerRoute(fullPath string) bool {
+	rest := strings.TrimPrefix(fullPath, "/api/environments/:id")
+	for _, prefix := range directDockerRoutes {
+		if rest == prefix || strings.HasPrefix(rest, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedIdentity is the manager-authenticated caller forwarded to the agent.
+type forwardedIdentity struct {
+	userID      string
+	permissions []models.Permission
 }
 
 func (m *EnvironmentMiddleware) handle(paramName string) gin.HandlerFunc {
@@ -51,29 +150,79 @@ func (m *EnvironmentMiddleware) handle(paramName string) gin.HandlerFunc {
 			return
 		}
 
-		apiURL, accessToken, enabled, err := m.resolver(c.Request.Context(), envID)
-		if err != nil || apiURL == "" {
+		env, err := m.resolver(c.Request.Context(), envID)
+		if err != nil || env == nil || (env.ApiUrl == "" && !m.envService.TunnelConnected(envID)) {
 			c.JSON(http.StatusNotFound, gin.H{"success": false, "data": gin.H{"error": "Environment not found"}})
 			c.Abort()
 			return
 		}
-		if !enabled {
+		if !env.Enabled {
 			c.JSON(http.StatusBadRequest, gin.H{"success": false, "data": gin.H{"error": "Environment is disabled"}})
 			c.Abort()
 			return
 		}
 
-		target := m.buildTargetURL(c, envID, apiURL)
+		if env.Type == models.EnvironmentTypeDocker {
+			if !isDirectDockerRoute(c.FullPath()) {
+				c.JSON(http.StatusBadRequest, gin.H{"success": false, "data": gin.H{"error": "This endpoint is " + services.ErrDirectDockerUnsupported.Error()}})
+				c.Abort()
+				return
+			}
+			c.Request = c.Request.WithContext(services.WithDockerEnvironment(c.Request.Context(), envID))
+			c.Next()
+			return
+		}
+		apiURL, accessToken := env.ApiUrl, env.AccessToken
+
+		identity, ok := m.authenticate(c)
+		if !ok {
+			return
+		}
 
 		if m.isWebSocketRequest(c) {
-			m.handleWebSocket(c, target, accessToken, envID)
+			m.handleWebSocket(c, apiURL, accessToken, envID, identity)
 			return
 		}
 
-		m.proxyHTTP(c, target, accessToken)
+		m.proxyHTTP(c, apiURL, accessToken, envID, identity)
 	}
 }
 
+// authenticate resolves the caller before a request leaves for a remote environment. Public
+// routes pass through anonymously; everything else needs a valid session or trusted proxy
+// headers and, on restricted environments, an access grant.
+func (m *EnvironmentMiddleware) authenticate(c *gin.Context) (*forwardedIdentity, bool) {
+	if m.auth == nil {
+		return nil, true
+	}
+	if _, public := publicEnvRoutes[c.Request.Method+" "+c.FullPath()]; public {
+		return nil, true
+	}
+
+	user, _, perms, err := m.auth.identifyRequest(c)
+	if err != nil {
+		abortUnauthenticated(c, err)
+		return nil, false
+	}
+
+	perms, ok := m.auth.scopeToEnvironment(c, user, perms)
+	if !ok {
+		return nil, false
+	}
+
+	return &forwardedIdentity{userID: user.ID, permissions: perms}, true
+}
+
+func setIdentityHeaders(h http.Header, identity *forwardedIdentity) {
+	h.Del(headerAgentUser)
+	h.Del(headerAgentPermissions)
+	if identity == nil {
+		return
+	}
+	h.Set(headerAgentUser, identity.userID)
+	h.Set(headerAgentPermissions, formatPermissionsHeader(identity.permissions))
+}
+
 func (m *EnvironmentMiddleware) extractEnvironmentID(c *gin.Context, paramName string) string {
 	envID := c.Param(paramName)
 	if envID != "" {
@@ -112,11 +261,19 @@ func (m *EnvironmentMiddleware) isWebSocketRequest(c *gin.Context) bool {
 		strings.Contains(strings.ToLower(c.GetHeader("Connection")), "upgrade")
 }
 
-func (m *EnvironmentMiddleware) handleWebSocket(c *gin.Context, target string, accessToken *string, envID string) {
-	wsTarget := m.convertToWebSocketURL(target)
+func (m *EnvironmentMiddleware) handleWebSocket(c *gin.Context, apiURL string, accessToken *string, envID string, identity *forwardedIdentity) {
+	dialer, baseURL, err := m.envService.AgentWebSocketDialer(c.Request.Context(), envID, apiURL)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"success": false, "data": gin.H{"error": fmt.Sprintf("Proxy request failed: %v", err)}})
+		c.Abort()
+		return
+	}
+
+	wsTarget := m.convertToWebSocketURL(m.buildTargetURL(c, envID, baseURL))
 	hdr := m.buildWebSocketHeaders(c, accessToken)
+	setIdentityHeaders(hdr, identity)
 
-	if err := wsutil.ProxyHTTP(c.Writer, c.Request, wsTarget, hdr); err != nil {
+	if err := wsutil.ProxyHTTPWithDialer(c.Writer, c.Request, wsTarget, hdr, dialer); err != nil {
 		slog.Error("websocket proxy failed", "env_id", envID, "target", wsTarget, "err", err)
 	}
 	c.Abort()
@@ -154,16 +311,30 @@ func (m *EnvironmentMiddleware) buildWebSocketHeaders(c *gin.Context, accessToke
 	return hdr
 }
 
-func (m *EnvironmentMiddleware) proxyHTTP(c *gin.Context, target string, accessToken *string) {
-	req, err := m.createProxyRequest(c, target, accessToken)
+func (m *EnvironmentMiddleware) proxyHTTP(c *gin.Context, apiURL string, accessToken *string, envID string, identity *forwardedIdentity) {
+	timeouts := proxyTimeoutsFor(c.Request.Method, c.FullPath())
+	client, baseURL, err := m.envService.AgentHTTPClient(c.Request.Context(), envID, apiURL, timeouts.total)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "data": gin.H{"error": "Failed to create proxy request"}})
+		c.JSON(http.StatusBadGateway, gin.H{"success": false, "data": gin.H{"error": fmt.Sprintf("Proxy request failed: %v", err)}})
 		c.Abort()
 		return
 	}
+	target := m.buildTargetURL(c, envID, baseURL)
 
-	resp, err := m.httpClient.Do(req)
-	if err != nil {
+	resp, err := m.sendProxyRequest(c, client, target, accessToken, identity, timeouts)
+	switch {
+	case errors.Is(err, errCreateProxyRequest):
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "data": gin.H{"error": "Failed to create proxy request"}})
+		c.Abort()
+		return
+	case errors.Is(err, services.ErrEnvironmentUnavailable):
+		if wait := m.envService.AgentRetryAfter(envID); wait > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		}
+		c.JSON(http.StatusServiceUnavailable, gin.H{"success": false, "data": gin.H{"error": fmt.Sprintf("Proxy request failed: %v", err)}})
+		c.Abort()
+		return
+	case err != nil:
 		c.JSON(http.StatusBadGateway, gin.H{"success": false, "data": gin.H{"error": fmt.Sprintf("Proxy request failed: %v", err)}})
 		c.Abort()
 		return
@@ -174,7 +345,114 @@ func (m *EnvironmentMiddleware) proxyHTTP(c *gin.Context, target string, accessT
 	c.Abort()
 }
 
-func (m *EnvironmentMiddleware) createProxyRequest(c *gin.Context, target string, accessToken *string) (*http.Request, error) {
+var errCreateProxyRequest = errors.New("failed to create proxy request")
+
+// sendProxyRequest sends the request to the agent, retrying reads that could not reach it or
+// that a gateway in front of it turned away, with exponential backoff between attempts.
+func (m *EnvironmentMiddleware) sendProxyRequest(c *gin.Context, client *http.Client, target string, accessToken *string, identity *forwardedIdentity, timeouts proxyTimeouts) (*http.Response, error) {
+	ctx := c.Request.Context()
+	retries := 0
+	if isIdempotentMethod(c.Request.Method) {
+		retries = timeouts.retries
+	}
+	for attempt := 0; ; attempt++ {
+		req, err := m.createProxyRequest(c, target, accessToken, identity)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errCreateProxyRequest, err)
+		}
+		resp, err := doWithResponseHeaderTimeout(client, req, timeouts.responseHeader)
+		if attempt >= retries || !retryableProxyResult(ctx, resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			_ = resp.Body.Close()
+		}
+
+		slog.DebugContext(ctx, "Retrying proxied request", "target", target, "attempt", attempt+1, "error", err)
+		timer := time.NewTimer(m.retryBackoff << attempt)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func retryableProxyResult(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, services.ErrEnvironmentUnavailable) {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// errResponseHeaderTimeout counts as a deadline, so the circuit breaker treats an agent that
+// stops answering like one that cannot be reached.
+var errResponseHeaderTimeout = fmt.Errorf("agent did not start responding in time: %w", context.DeadlineExceeded)
+
+// doWithResponseHeaderTimeout sends req, giving up if the response has not started within timeout
+// of the request being written. The response body may then take as long as it needs.
+func doWithResponseHeaderTimeout(client *http.Client, req *http.Request, timeout time.Duration) (*http.Response, error) {
+	if timeout <= 0 {
+		return client.Do(req)
+	}
+
+	ctx, cancel := context.WithCancelCause(req.Context())
+	var (
+		mu    sync.Mutex
+		timer *time.Timer
+		done  bool
+	)
+	trace := &httptrace.ClientTrace{
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			if !done && timer == nil {
+				timer = time.AfterFunc(timeout, func() { cancel(errResponseHeaderTimeout) })
+			}
+		},
+	}
+	resp, err := client.Do(req.WithContext(httptrace.WithClientTrace(ctx, trace)))
+
+	mu.Lock()
+	done = true
+	if timer != nil {
+		timer.Stop()
+	}
+	mu.Unlock()
+
+	if err != nil {
+		if errors.Is(context.Cause(ctx), errResponseHeaderTimeout) {
+			err = fmt.Errorf("%w after %s", errResponseHeaderTimeout, timeout)
+		}
+		cancel(nil)
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: func() { cancel(nil) }}
+	return resp, nil
+}
+
+// cancelOnClose releases the request's context once its response body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel func()
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+func (m *EnvironmentMiddleware) createProxyRequest(c *gin.Context, target string, accessToken *string, identity *forwardedIdentity) (*http.Request, error) {
 	var bodyReader io.Reader
 	if c.Request.Body != nil {
 		bodyReader = c.Request.Body
@@ -190,6 +468,7 @@ func (m *EnvironmentMiddleware) createProxyRequest(c *gin.Context, target string
 	remenv.SetAuthHeader(req, c)
 	remenv.SetAgentToken(req, accessToken)
 	remenv.SetForwardedHeaders(req, c.ClientIP(), c.Request.Host)
+	setIdentityHeaders(req.Header, identity)
 
 	if remenv.NeedsCredentialInjection(target) {
 		if err := remenv.InjectRegistryCredentials(c.Request.Context(), req, m.envService); err != nil {
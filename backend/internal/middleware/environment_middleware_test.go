@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ofkm/arcane-backend/internal/models"
+)
+
+func TestEnvironmentMiddleware_AcceptsProxyAuthentication(t *testing.T) {
+	authMiddleware, envService, miaID := setupProxyAuthMiddleware(t)
+
+	var forwardedUser string
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwardedUser = r.Header.Get(headerAgentUser)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(agent.Close)
+
+	resolver := func(ctx context.Context, id string) (*models.Environment, error) {
+		return &models.Environment{BaseModel: models.BaseModel{ID: id}, Type: models.EnvironmentTypeAgent, ApiUrl: agent.URL, Enabled: true}, nil
+	}
+	router := gin.New()
+	router.GET("/api/environments/:id/containers", NewEnvProxyMiddlewareWithParam("0", "id", resolver, envService, authMiddleware), func(c *gin.Context) {
+		c.Status(http.StatusTeapot)
+	})
+
+	for name, token := range map[string]string{"without a token": "", "with a stale token": "stale"} {
+		t.Run(name, func(t *testing.T) {
+			forwardedUser = ""
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, proxiedRequest("10.0.0.1:40000", "mia", token))
+			require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+			require.Equal(t, miaID, forwardedUser)
+		})
+	}
+
+	// Proxy headers from any other peer are ignored.
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, proxiedRequest("203.0.113.5:40000", "mia", ""))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// AgentCertificate is a certificate the manager's CA issued to an environment's agent. A
+// certificate is activated once the agent installed it; the manager only accepts the
+// environment's activated, unrevoked certificate when connecting to the agent over mutual TLS.
+type AgentCertificate struct {
+	EnvironmentID string     `json:"environmentId" gorm:"column:environment_id"`
+	SerialNumber  string     `json:"serialNumber" gorm:"column:serial_number"`
+	Fingerprint   string     `json:"fingerprint" gorm:"column:fingerprint"`
+	Certificate   string     `json:"certificate" gorm:"column:certificate"`
+	NotAfter      time.Time  `json:"notAfter" gorm:"column:not_after"`
+	ActivatedAt   *time.Time `json:"activatedAt,omitempty" gorm:"column:activated_at"`
+	RevokedAt     *time.Time `json:"revokedAt,omitempty" gorm:"column:revoked_at"`
+	BaseModel
+}
+
+func (AgentCertificate) TableName() string { return "agent_certificates" }
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// ApiToken is a long-lived personal access token. Only a hash of the secret is stored; Prefix
+// keeps the first characters so users can tell their tokens apart.
+type ApiToken struct {
+	UserID     string      `json:"userId" gorm:"column:user_id"`
+	Name       string      `json:"name" sortable:"true"`
+	Prefix     string      `json:"prefix"`
+	TokenHash  string      `json:"-" gorm:"column:token_hash;uniqueIndex"`
+	Scopes     StringSlice `json:"scopes" gorm:"type:text"`
+	ExpiresAt  *time.Time  `json:"expiresAt,omitempty" gorm:"column:expires_at" sortable:"true"`
+	LastUsedAt *time.Time  `json:"lastUsedAt,omitempty" gorm:"column:last_used_at" sortable:"true"`
+	BaseModel
+}
+
+func (ApiToken) TableName() string { return "api_tokens" }
+
+func (t *ApiToken) IsExpired(now time.Time) bool {
+	return t.ExpiresAt != nil && now.After(*t.ExpiresAt)
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// AuditEntry is one record of the append-only audit trail. Hash covers every other field and the
+// previous entry's hash, so editing, inserting or removing an entry breaks the chain from that
+// point on. Rows are never updated or deleted; the database rejects both.
+type AuditEntry struct {
+	ID            string    `json:"id" gorm:"primaryKey;type:text"`
+	Sequence      int64     `json:"sequence" gorm:"column:sequence"`
+	Timestamp     time.Time `json:"timestamp"`
+	Action        string    `json:"action"`
+	ActorID       *string   `json:"actorId,omitempty" gorm:"column:actor_id"`
+	ActorUsername *string   `json:"actorUsername,omitempty" gorm:"column:actor_username"`
+	IPAddress     string    `json:"ipAddress,omitempty" gorm:"column:ip_address"`
+	UserAgent     string    `json:"userAgent,omitempty" gorm:"column:user_agent"`
+	ResourceType  *string   `json:"resourceType,omitempty" gorm:"column:resource_type"`
+	ResourceID    *string   `json:"resourceId,omitempty" gorm:"column:resource_id"`
+	ResourceName  *string   `json:"resourceName,omitempty" gorm:"column:resource_name"`
+	EnvironmentID *string   `json:"environmentId,omitempty" gorm:"column:environment_id"`
+	Metadata      JSON      `json:"metadata,omitempty" gorm:"type:text"`
+	PrevHash      string    `json:"prevHash" gorm:"column:prev_hash"`
+	Hash          string    `json:"hash"`
+}
+
+func (AuditEntry) TableName() string {
+	return "audit_log"
+}
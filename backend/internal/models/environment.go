@@ -3,18 +3,59 @@ package models
 import "time"
 
 type Environment struct {
-	Name        string     `json:"name" sortable:"true"`
+	Name string `json:"name" sortable:"true"`
+	// Type is "agent" for environments reached through an Arcane agent and "docker" for a Docker
+	// daemon the manager connects to itself, in which case ApiUrl is its ssh:// or tcp:// host.
+	Type        string     `json:"type" gorm:"column:type;default:agent" sortable:"true"`
 	ApiUrl      string     `json:"apiUrl" gorm:"column:api_url" sortable:"true"`
 	Status      string     `json:"status" sortable:"true"`
 	Enabled     bool       `json:"enabled" sortable:"true"`
 	LastSeen    *time.Time `json:"lastSeen" gorm:"column:last_seen"`
-	AccessToken *string    `json:"-" gorm:"column:access_token"`
+	AccessToken *string    `json:"-" gorm:"column:access_token"` // encrypted at rest
+
+	// LatencyMs and DockerVersion are recorded by the last successful health probe.
+	LatencyMs     *int64  `json:"latencyMs,omitempty" gorm:"column:latency_ms"`
+	DockerVersion *string `json:"dockerVersion,omitempty" gorm:"column:docker_version"`
+
+	// Group and Tags select environments for filtering and bulk actions, e.g. group "eu-west"
+	// with tags "prod" and "edge".
+	Group *string     `json:"group,omitempty" gorm:"column:group_name"`
+	Tags  StringSlice `json:"tags" gorm:"type:text"`
+
+	// PollingEnabled, PollingInterval, AutoUpdate, AutoUpdateInterval and PruneMode override the
+	// global settings of the same name for this environment; nil follows the global setting.
+	// Intervals are in minutes.
+	PollingEnabled     *bool   `json:"pollingEnabled,omitempty" gorm:"column:polling_enabled"`
+	PollingInterval    *int    `json:"pollingInterval,omitempty" gorm:"column:polling_interval"`
+	AutoUpdate         *bool   `json:"autoUpdate,omitempty" gorm:"column:auto_update"`
+	AutoUpdateInterval *int    `json:"autoUpdateInterval,omitempty" gorm:"column:auto_update_interval"`
+	PruneMode          *string `json:"pruneMode,omitempty" gorm:"column:prune_mode"`
+
+	// SshPrivateKey authenticates to an ssh:// Docker host whose key, in authorized_keys format,
+	// is pinned in SshHostKey on first connect when not given. TlsCaCert, TlsCert and TlsKey
+	// secure a tcp:// Docker host. The private keys are encrypted at rest.
+	SshPrivateKey *string `json:"-" gorm:"column:ssh_private_key"`
+	SshHostKey    *string `json:"sshHostKey,omitempty" gorm:"column:ssh_host_key"`
+	TlsCaCert     *string `json:"-" gorm:"column:tls_ca_cert"`
+	TlsCert       *string `json:"-" gorm:"column:tls_cert"`
+	TlsKey        *string `json:"-" gorm:"column:tls_key"`
+
+	// AccessTokenHash finds the environment an agent's tunnel authenticates as.
+	AccessTokenHash *string `json:"-" gorm:"column:access_token_hash"`
+	// PreviousAccessTokenHash keeps the token being rotated out valid for the agent's tunnel until
+	// the agent confirms the new one.
+	PreviousAccessTokenHash *string `json:"-" gorm:"column:previous_access_token_hash"`
 
 	BaseModel
 }
 
 func (Environment) TableName() string { return "environments" }
 
+const (
+	EnvironmentTypeAgent  = "agent"
+	EnvironmentTypeDocker = "docker"
+)
+
 type EnvironmentStatus string
 
 const (
@@ -0,0 +1,79 @@
+package models
+
+import "strings"
+
+type EnvironmentAccessLevel string
+
+const (
+	// EnvironmentAccessRead limits the grantee to read-only actions on the environment.
+	EnvironmentAccessRead EnvironmentAccessLevel = "read"
+	// EnvironmentAccessWrite allows everything the grantee's roles permit except managing the
+	// environment itself.
+	EnvironmentAccessWrite EnvironmentAccessLevel = "write"
+	// EnvironmentAccessManage allows everything the grantee's roles permit.
+	EnvironmentAccessManage EnvironmentAccessLevel = "manage"
+)
+
+var environmentAccessRank = map[EnvironmentAccessLevel]int{
+	EnvironmentAccessRead:   1,
+	EnvironmentAccessWrite:  2,
+	EnvironmentAccessManage: 3,
+}
+
+func (l EnvironmentAccessLevel) IsValid() bool {
+	_, ok := environmentAccessRank[l]
+	return ok
+}
+
+// Covers reports whether l is at least as permissive as other.
+func (l EnvironmentAccessLevel) Covers(other EnvironmentAccessLevel) bool {
+	return environmentAccessRank[l] >= environmentAccessRank[other]
+}
+
+// Restrict narrows role permissions to what this access level allows. The result only
+// contains concrete permissions so it can be forwarded to agents as-is.
+func (l EnvironmentAccessLevel) Restrict(perms []Permission) []Permission {
+	if l == EnvironmentAccessManage {
+		return perms
+	}
+
+	out := make([]Permission, 0, len(perms))
+	for _, p := range AllPermissions {
+		if !HasPermission(perms, p) {
+			continue
+		}
+		switch l {
+		case EnvironmentAccessRead:
+			if strings.HasSuffix(string(p), ":read") {
+				out = append(out, p)
+			}
+		case EnvironmentAccessWrite:
+			if p != PermissionEnvironmentsManage {
+				out = append(out, p)
+			}
+		}
+	}
+	return out
+}
+
+type EnvironmentAccessSubject string
+
+const (
+	EnvironmentAccessSubjectUser EnvironmentAccessSubject = "user"
+	// EnvironmentAccessSubjectRole grants access to every user holding the named role, which
+	// is how groups are modelled.
+	EnvironmentAccessSubjectRole EnvironmentAccessSubject = "role"
+)
+
+// EnvironmentAccess grants a user or role access to one environment. Environments without any
+// grants stay open to every authenticated user; once a grant exists, only grantees (and users
+// holding the "*" permission) can reach it.
+type EnvironmentAccess struct {
+	EnvironmentID string                   `json:"environmentId" gorm:"column:environment_id"`
+	SubjectType   EnvironmentAccessSubject `json:"subjectType" gorm:"column:subject_type"`
+	SubjectID     string                   `json:"subjectId" gorm:"column:subject_id"`
+	AccessLevel   EnvironmentAccessLevel   `json:"accessLevel" gorm:"column:access_level"`
+	BaseModel
+}
+
+func (EnvironmentAccess) TableName() string { return "environment_access" }
@@ -120,6 +120,13 @@ func (e *DockerAPIError) HTTPStatus() int {
 type ValidationError struct {
 	Message string
 	Field   string
+	// Details lists every rule the value failed, when there can be more than one.
+	Details []ValidationDetail
+}
+
+type ValidationDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
 }
 
 func (e *ValidationError) Error() string {
@@ -141,7 +148,11 @@ func ToAPIError(err error) *APIError {
 	}
 	var validationErr *ValidationError
 	if errors.As(err, &validationErr) {
-		return NewValidationError(validationErr.Message, map[string]string{"field": validationErr.Field})
+		details := map[string]interface{}{"field": validationErr.Field}
+		if len(validationErr.Details) > 0 {
+			details["violations"] = validationErr.Details
+		}
+		return NewValidationError(validationErr.Message, details)
 	}
 	var dockerAPIErr *DockerAPIError
 	if errors.As(err, &dockerAPIErr) {
@@ -32,6 +32,9 @@ const (
 	EventTypeProjectUpdate EventType = "project.update"
 	EventTypeProjectError  EventType = "project.error"
 
+	EventTypeProjectWebhook         EventType = "project.webhook"
+	EventTypeProjectWebhookRejected EventType = "project.webhook_rejected"
+
 	EventTypeVolumeCreate EventType = "volume.create"
 	EventTypeVolumeDelete EventType = "volume.delete"
 	EventTypeVolumeError  EventType = "volume.error"
@@ -43,9 +46,15 @@ const (
 	EventTypeSystemPrune      EventType = "system.prune"
 	EventTypeUserLogin        EventType = "user.login"
 	EventTypeUserLogout       EventType = "user.logout"
+	EventTypeUserLoginFailed  EventType = "user.login_failed"
+	EventTypeUserLocked       EventType = "user.locked"
 	EventTypeSystemAutoUpdate EventType = "system.auto_update"
 	EventTypeSystemUpgrade    EventType = "system.upgrade"
 
+	EventTypeEnvironmentOnline  EventType = "environment.online"
+	EventTypeEnvironmentOffline EventType = "environment.offline"
+	EventTypeEnvironmentError   EventType = "environment.error"
+
 	// Event severities
 	EventSeverityInfo    EventSeverity = "info"
 	EventSeverityWarning EventSeverity = "warning"
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// JwtSigningKey is one key of the JWT key ring. Tokens name the key that signed them in their
+// kid header. The current key has no RetiredAt; retired keys still verify tokens until the grace
+// period after their retirement has passed.
+type JwtSigningKey struct {
+	// Secret is the encrypted, base64 encoded HMAC secret.
+	Secret    string     `json:"-" gorm:"column:secret"`
+	RetiredAt *time.Time `json:"retiredAt,omitempty" gorm:"column:retired_at"`
+	BaseModel
+}
+
+func (JwtSigningKey) TableName() string { return "jwt_signing_keys" }
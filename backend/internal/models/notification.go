@@ -16,6 +16,7 @@ type NotificationEventType string
 const (
 	NotificationEventImageUpdate     NotificationEventType = "image_update"
 	NotificationEventContainerUpdate NotificationEventType = "container_update"
+	NotificationEventEnvironment     NotificationEventType = "environment_status"
 )
 
 type EmailTLSMode string
@@ -0,0 +1,11 @@
+package models
+
+// PasswordHistory keeps a previous password hash of a user so the password policy can refuse
+// its reuse.
+type PasswordHistory struct {
+	UserID       string `json:"-" gorm:"column:user_id"`
+	PasswordHash string `json:"-" gorm:"column:password_hash"`
+	BaseModel
+}
+
+func (PasswordHistory) TableName() string { return "user_password_history" }
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type ProjectStatus string
 
 const (
@@ -21,6 +23,31 @@ type Project struct {
 	ServiceCount int           `json:"service_count" sortable:"true"`
 	RunningCount int           `json:"running_count" sortable:"true"`
 
+	// GitRepositoryUrl is set for projects cloned from Git: the clone lives in the project's
+	// folder and Path points at GitSubPath inside it. GitCredential, a deploy key for ssh
+	// remotes or an access token sent as GitUsername for https ones, is encrypted at rest.
+	GitRepositoryUrl *string `json:"git_repository_url,omitempty" gorm:"column:git_repository_url"`
+	GitBranch        *string `json:"git_branch,omitempty" gorm:"column:git_branch"`
+	GitSubPath       *string `json:"git_sub_path,omitempty" gorm:"column:git_sub_path"`
+	GitUsername      *string `json:"git_username,omitempty" gorm:"column:git_username"`
+	GitCredential    *string `json:"-" gorm:"column:git_credential"`
+
+	// GitAutoSync polls the branch every GitSyncInterval minutes and GitAutoDeploy redeploys the
+	// project when a new commit is checked out.
+	GitAutoSync     bool `json:"git_auto_sync" gorm:"column:git_auto_sync"`
+	GitAutoDeploy   bool `json:"git_auto_deploy" gorm:"column:git_auto_deploy"`
+	GitSyncInterval *int `json:"git_sync_interval,omitempty" gorm:"column:git_sync_interval"`
+
+	// GitCommit is the commit checked out and GitDeployedCommit the one last deployed.
+	GitCommit         *string    `json:"git_commit,omitempty" gorm:"column:git_commit"`
+	GitDeployedCommit *string    `json:"git_deployed_commit,omitempty" gorm:"column:git_deployed_commit"`
+	GitSyncedAt       *time.Time `json:"git_synced_at,omitempty" gorm:"column:git_synced_at"`
+	GitSyncError      *string    `json:"git_sync_error,omitempty" gorm:"column:git_sync_error"`
+
+	// WebhookSecret, encrypted at rest, is the token or HMAC key that authenticates calls to the
+	// project's redeploy webhook; the webhook is off while it is nil.
+	WebhookSecret *string `json:"-" gorm:"column:webhook_secret"`
+
 	BaseModel
 }
 
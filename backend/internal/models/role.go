@@ -0,0 +1,218 @@
+package models
+
+import (
+	"slices"
+	"strings"
+)
+
+type Permission string
+
+const (
+	// PermissionAll grants every permission, including ones added in later releases.
+	PermissionAll Permission = "*"
+
+	PermissionContainersRead    Permission = "containers:read"
+	PermissionContainersCreate  Permission = "containers:create"
+	PermissionContainersStart   Permission = "containers:start"
+	PermissionContainersStop    Permission = "containers:stop"
+	PermissionContainersRestart Permission = "containers:restart"
+	PermissionContainersExec    Permission = "containers:exec"
+	PermissionContainersDelete  Permission = "containers:delete"
+
+	PermissionImagesRead   Permission = "images:read"
+	PermissionImagesPull   Permission = "images:pull"
+	PermissionImagesDelete Permission = "images:delete"
+	PermissionImagesPrune  Permission = "images:prune"
+
+	PermissionNetworksRead   Permission = "networks:read"
+	PermissionNetworksCreate Permission = "networks:create"
+	PermissionNetworksDelete Permission = "networks:delete"
+	PermissionNetworksPrune  Permission = "networks:prune"
+
+	PermissionVolumesRead   Permission = "volumes:read"
+	PermissionVolumesCreate Permission = "volumes:create"
+	PermissionVolumesDelete Permission = "volumes:delete"
+	PermissionVolumesPrune  Permission = "volumes:prune"
+	// PermissionVolumesArchive allows reading and replacing a volume's contents.
+	PermissionVolumesArchive Permission = "volumes:archive"
+
+	PermissionProjectsRead   Permission = "projects:read"
+	PermissionProjectsCreate Permission = "projects:create"
+	PermissionProjectsUpdate Permission = "projects:update"
+	PermissionProjectsDeploy Permission = "projects:deploy"
+	PermissionProjectsDelete Permission = "projects:delete"
+
+	PermissionSystemRead    Permission = "system:read"
+	PermissionSystemPrune   Permission = "system:prune"
+	PermissionSystemUpgrade Permission = "system:upgrade"
+
+	PermissionUpdaterRead Permission = "updater:read"
+	PermissionUpdaterRun  Permission = "updater:run"
+
+	PermissionEnvironmentsRead   Permission = "environments:read"
+	PermissionEnvironmentsManage Permission = "environments:manage"
+
+	PermissionRegistriesRead   Permission = "registries:read"
+	PermissionRegistriesManage Permission = "registries:manage"
+
+	PermissionTemplatesRead   Permission = "templates:read"
+	PermissionTemplatesManage Permission = "templates:manage"
+
+	PermissionSettingsRead   Permission = "settings:read"
+	PermissionSettingsUpdate Permission = "settings:update"
+
+	PermissionNotificationsManage Permission = "notifications:manage"
+
+	PermissionEventsRead   Permission = "events:read"
+	PermissionEventsManage Permission = "events:manage"
+
+	PermissionUsersRead   Permission = "users:read"
+	PermissionUsersManage Permission = "users:manage"
+
+	PermissionRolesManage Permission = "roles:manage"
+
+	PermissionAuditRead Permission = "audit:read"
+)
+
+// AllPermissions lists every concrete permission known to this release, in display order.
+var AllPermissions = []Permission{
+	PermissionContainersRead, PermissionContainersCreate, PermissionContainersStart, PermissionContainersStop,
+	PermissionContainersRestart, PermissionContainersExec, PermissionContainersDelete,
+	PermissionImagesRead, PermissionImagesPull, PermissionImagesDelete, PermissionImagesPrune,
+	PermissionNetworksRead, PermissionNetworksCreate, PermissionNetworksDelete, PermissionNetworksPrune,
+	PermissionVolumesRead, PermissionVolumesCreate, PermissionVolumesDelete, PermissionVolumesPrune, PermissionVolumesArchive,
+	PermissionProjectsRead, PermissionProjectsCreate, PermissionProjectsUpdate, PermissionProjectsDeploy, PermissionProjectsDelete,
+	PermissionSystemRead, PermissionSystemPrune, PermissionSystemUpgrade,
+	PermissionUpdaterRead, PermissionUpdaterRun,
+	PermissionEnvironmentsRead, PermissionEnvironmentsManage,
+	PermissionRegistriesRead, PermissionRegistriesManage,
+	PermissionTemplatesRead, PermissionTemplatesManage,
+	PermissionSettingsRead, PermissionSettingsUpdate,
+	PermissionNotificationsManage,
+	PermissionEventsRead, PermissionEventsManage,
+	PermissionUsersRead, PermissionUsersManage,
+	PermissionRolesManage,
+	PermissionAuditRead,
+}
+
+// Grants reports whether p satisfies required. Besides exact matches, "*" grants
+// everything and "<resource>:*" grants every action on that resource.
+func (p Permission) Grants(required Permission) bool {
+	if p == PermissionAll || p == required {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(string(p), ":*"); ok {
+		resource, _, _ := strings.Cut(string(required), ":")
+		return resource == prefix
+	}
+	return false
+}
+
+// IsKnown reports whether p is a concrete permission, a wildcard, or a resource wildcard
+// for a known resource.
+func (p Permission) IsKnown() bool {
+	if p == PermissionAll || slices.Contains(AllPermissions, p) {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(string(p), ":*"); ok {
+		for _, known := range AllPermissions {
+			if resource, _, _ := strings.Cut(string(known), ":"); resource == prefix {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasPermission reports whether any of the granted permissions satisfies required.
+func HasPermission(granted []Permission, required Permission) bool {
+	for _, g := range granted {
+		if g.Grants(required) {
+			return true
+		}
+	}
+	return false
+}
+
+// IntersectPermissions returns the concrete permissions granted by both a and b.
+func IntersectPermissions(a, b []Permission) []Permission {
+	out := make([]Permission, 0, len(a))
+	for _, p := range AllPermissions {
+		if HasPermission(a, p) && HasPermission(b, p) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+const (
+	RoleAdmin    = "admin"
+	RoleDeployer = "deployer"
+	RoleOperator = "operator"
+	RoleViewer   = "viewer"
+	// RoleUser is the role every account received before roles were introduced. It keeps
+	// exactly what non-admin users could do previously so existing installs behave the same.
+	RoleUser = "user"
+)
+
+var viewerPermissions = []Permission{
+	PermissionContainersRead,
+	PermissionImagesRead,
+	PermissionNetworksRead,
+	PermissionVolumesRead,
+	PermissionProjectsRead,
+	PermissionSystemRead,
+	PermissionUpdaterRead,
+	PermissionEnvironmentsRead,
+	PermissionRegistriesRead,
+	PermissionTemplatesRead,
+	PermissionSettingsRead,
+}
+
+var operatorPermissions = append(slices.Clone(viewerPermissions),
+	PermissionContainersStart,
+	PermissionContainersStop,
+	PermissionContainersRestart,
+	PermissionContainersExec,
+)
+
+var deployerPermissions = append(slices.Clone(operatorPermissions),
+	PermissionContainersCreate,
+	PermissionImagesPull,
+	PermissionProjectsCreate,
+	PermissionProjectsUpdate,
+	PermissionProjectsDeploy,
+	PermissionUpdaterRun,
+)
+
+// BuiltinRoles are defined in code and cannot be modified or shadowed by custom roles.
+var BuiltinRoles = map[string][]Permission{
+	RoleAdmin:    {PermissionAll},
+	RoleDeployer: deployerPermissions,
+	RoleOperator: operatorPermissions,
+	RoleViewer:   viewerPermissions,
+	RoleUser: {
+		"containers:*", "images:*", "networks:*", "volumes:*", "projects:*",
+		PermissionSystemRead, PermissionSystemPrune,
+		"updater:*", "environments:*", "registries:*", "templates:*",
+		PermissionSettingsRead,
+	},
+}
+
+// IsBuiltinRole reports whether name refers to one of the roles defined in code.
+func IsBuiltinRole(name string) bool {
+	_, ok := BuiltinRoles[strings.ToLower(name)]
+	return ok
+}
+
+// Role is a custom, user-defined set of permissions that can be assigned to users by name.
+type Role struct {
+	Name        string      `json:"name" gorm:"uniqueIndex" sortable:"true"`
+	Description *string     `json:"description,omitempty"`
+	Permissions StringSlice `json:"permissions" gorm:"type:text"`
+	BaseModel
+}
+
+func (Role) TableName() string {
+	return "roles"
+}
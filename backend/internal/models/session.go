@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Session is a server-side login session. Access and refresh tokens carry its ID, so deleting
+// the row revokes both.
+type Session struct {
+	UserID     string    `json:"userId" gorm:"column:user_id"`
+	UserAgent  string    `json:"userAgent" gorm:"column:user_agent"`
+	IPAddress  string    `json:"ipAddress" gorm:"column:ip_address"`
+	Method     string    `json:"method"`
+	LastSeenAt time.Time `json:"lastSeenAt" gorm:"column:last_seen_at" sortable:"true"`
+	ExpiresAt  time.Time `json:"expiresAt" gorm:"column:expires_at" sortable:"true"`
+	BaseModel
+}
+
+func (Session) TableName() string { return "user_sessions" }
+
+func (s *Session) IsExpired(now time.Time) bool {
+	return now.After(s.ExpiresAt)
+}
@@ -14,6 +14,7 @@ import (
 const (
 	redactionMask     = "XXXXXXXXXX"
 	keyAuthOidcConfig = "authOidcConfig"
+	keyAuthLdapConfig = "authLdapConfig"
 )
 
 type SettingVariable struct {
@@ -71,12 +72,24 @@ type Settings struct {
 	DockerHost         SettingVariable `key:"dockerHost,public,envOverride" meta:"label=Docker Host;type=text;keywords=docker,host,daemon,socket,unix,remote;category=docker;description=URI for Docker daemon"`
 
 	// Security category
-	AuthLocalEnabled      SettingVariable `key:"authLocalEnabled,public" meta:"label=Local Authentication;type=boolean;keywords=local,auth,authentication,username,password,login,credentials;category=security;description=Enable local username/password authentication" catmeta:"id=security;title=Security;icon=shield;url=/settings/security;description=Manage authentication and security settings"`
-	AuthOidcEnabled       SettingVariable `key:"authOidcEnabled,public" meta:"label=OIDC Authentication;type=boolean;keywords=oidc,openid,connect,sso,oauth,external,provider,federation;category=security;description=Enable OpenID Connect (OIDC) authentication"`
-	AuthOidcMergeAccounts SettingVariable `key:"authOidcMergeAccounts,public" meta:"label=OIDC Account Merging;type=boolean;keywords=oidc,merge,link,accounts,email,match,existing,users,combine;category=security;description=Allow OIDC logins to merge with existing accounts by email"`
-	AuthSessionTimeout    SettingVariable `key:"authSessionTimeout" meta:"label=Session Timeout;type=number;keywords=session,timeout,expire,duration,lifetime,minutes,logout;category=security;description=How long user sessions remain active"`
-	AuthPasswordPolicy    SettingVariable `key:"authPasswordPolicy" meta:"label=Password Policy;type=select;keywords=password,policy,strength,complexity,requirements,security,rules;category=security;description=Set password strength requirements"`
-	AuthOidcConfig        SettingVariable `key:"authOidcConfig,sensitive" meta:"label=OIDC Config;type=text;keywords=oidc,config,client,id,issuer,secret,oauth;category=security;description=OIDC provider configuration"`
+	AuthLocalEnabled         SettingVariable `key:"authLocalEnabled,public" meta:"label=Local Authentication;type=boolean;keywords=local,auth,authentication,username,password,login,credentials;category=security;description=Enable local username/password authentication" catmeta:"id=security;title=Security;icon=shield;url=/settings/security;description=Manage authentication and security settings"`
+	AuthOidcEnabled          SettingVariable `key:"authOidcEnabled,public" meta:"label=OIDC Authentication;type=boolean;keywords=oidc,openid,connect,sso,oauth,external,provider,federation;category=security;description=Enable OpenID Connect (OIDC) authentication"`
+	AuthProxyEnabled         SettingVariable `key:"authProxyEnabled,public" meta:"label=Proxy Authentication;type=boolean;keywords=proxy,forward,auth,header,authelia,authentik,oauth2-proxy,remote-user,sso,trusted;category=security;description=Trust user headers set by a reverse proxy that has already authenticated the user"`
+	AuthLdapEnabled          SettingVariable `key:"authLdapEnabled,public" meta:"label=LDAP Authentication;type=boolean;keywords=ldap,active,directory,ad,bind,dn,domain,sso,external,provider;category=security;description=Enable LDAP / Active Directory authentication"`
+	AuthOidcMergeAccounts    SettingVariable `key:"authOidcMergeAccounts,public" meta:"label=OIDC Account Merging;type=boolean;keywords=oidc,merge,link,accounts,email,match,existing,users,combine;category=security;description=Allow OIDC logins to merge with existing accounts by email"`
+	AuthSessionTimeout       SettingVariable `key:"authSessionTimeout" meta:"label=Session Timeout;type=number;keywords=session,timeout,expire,duration,lifetime,minutes,logout;category=security;description=How long user sessions remain active"`
+	AuthPasswordPolicy       SettingVariable `key:"authPasswordPolicy" meta:"label=Password Policy;type=select;keywords=password,policy,strength,complexity,requirements,security,rules;category=security;description=Set password strength requirements"`
+	AuthPasswordHistory      SettingVariable `key:"authPasswordHistory" meta:"label=Password History;type=number;keywords=password,history,reuse,previous,old,rotation,policy;category=security;description=Number of most recent passwords a user cannot reuse. 0 disables password history"`
+	AuthLoginMaxAttempts     SettingVariable `key:"authLoginMaxAttempts" meta:"label=Max Failed Logins;type=number;keywords=brute,force,lockout,lock,failed,login,attempts,limit;category=security;description=Failed logins allowed per account before it is locked. 0 disables account lockout"`
+	AuthLoginLockoutDuration SettingVariable `key:"authLoginLockoutDuration" meta:"label=Lockout Duration;type=number;keywords=brute,force,lockout,lock,duration,minutes,ban;category=security;description=Minutes an account or IP is locked for the first time; repeated lockouts double it up to 24 hours"`
+	AuthLoginIpMaxAttempts   SettingVariable `key:"authLoginIpMaxAttempts" meta:"label=Max Failed Logins per IP;type=number;keywords=rate,limit,ip,address,brute,force,credential,stuffing,throttle;category=security;description=Failed logins allowed from one IP address within the attempt window. 0 disables IP rate limiting"`
+	AuthLoginAttemptWindow   SettingVariable `key:"authLoginAttemptWindow" meta:"label=Failed Login Window;type=number;keywords=rate,limit,window,minutes,failed,login,attempts;category=security;description=Minutes after which failed login attempts are forgotten"`
+	AuthJwtRotationInterval  SettingVariable `key:"authJwtRotationInterval" meta:"label=Signing Key Rotation;type=number;keywords=jwt,token,signing,key,rotation,rotate,secret,kid,days;category=security;description=Days between automatic rotations of the token signing key. 0 disables scheduled rotation"`
+	AuthJwtGracePeriod       SettingVariable `key:"authJwtGracePeriod" meta:"label=Signing Key Grace Period;type=number;keywords=jwt,token,signing,key,rotation,grace,previous,hours;category=security;description=Hours a retired signing key keeps verifying tokens it issued"`
+	AuthRequireTwoFactor     SettingVariable `key:"authRequireTwoFactor,public" meta:"label=Require Two-Factor Authentication;type=boolean;keywords=2fa,mfa,totp,two,factor,otp,authenticator,require,enforce;category=security;description=Require every local account to sign in with a TOTP code"`
+	AuthOidcConfig           SettingVariable `key:"authOidcConfig,sensitive" meta:"label=OIDC Config;type=text;keywords=oidc,config,client,id,issuer,secret,oauth;category=security;description=OIDC provider configuration"`
+	AuthProxyConfig          SettingVariable `key:"authProxyConfig" meta:"label=Proxy Authentication Config;type=text;keywords=proxy,forward,auth,header,trusted,cidr,groups,roles,provision;category=security;description=Trusted proxies, header names and group mappings for proxy authentication"`
+	AuthLdapConfig           SettingVariable `key:"authLdapConfig,sensitive" meta:"label=LDAP Config;type=text;keywords=ldap,active,directory,ad,server,bind,dn,base,filter,group,starttls,ldaps;category=security;description=LDAP / Active Directory server configuration"`
 
 	// Navigation category
 	MobileNavigationMode       SettingVariable `key:"mobileNavigationMode,public,local" meta:"label=Mobile Navigation Mode;type=select;keywords=mode,style,type,floating,docked,position,layout,design,appearance,bottom;category=navigation;description=Choose between floating or docked navigation on mobile" catmeta:"id=navigation;title=Navigation;icon=navigation;url=/settings/navigation;description=Customize navigation and interface behavior"`
@@ -206,6 +219,17 @@ func redactSettingValue(key, value, attrs string, redact bool) string {
 		return redactionMask
 	}
 
+	if key == keyAuthLdapConfig {
+		var cfg LdapConfig
+		if err := json.Unmarshal([]byte(value), &cfg); err == nil {
+			cfg.BindPassword = ""
+			if redacted, err := json.Marshal(cfg); err == nil {
+				return string(redacted)
+			}
+		}
+		return redactionMask
+	}
+
 	return redactionMask
 }
 
@@ -245,6 +269,8 @@ type OidcConfig struct {
 	TokenEndpoint         string `json:"tokenEndpoint,omitempty"`
 	UserinfoEndpoint      string `json:"userinfoEndpoint,omitempty"`
 	JwksURI               string `json:"jwksUri,omitempty"`
+	// EndSessionEndpoint overrides the discovered RP-initiated logout endpoint.
+	EndSessionEndpoint string `json:"endSessionEndpoint,omitempty"`
 
 	// Admin mapping: evaluate this claim to grant admin.
 	// Examples:
@@ -253,4 +279,81 @@ type OidcConfig struct {
 	// - adminClaim: "realm_access.roles", adminValue: "admin" (Keycloak)
 	AdminClaim string `json:"adminClaim,omitempty"`
 	AdminValue string `json:"adminValue,omitempty"`
+
+	// RoleMappings assign Arcane roles from provider claims. When set, a user's roles are replaced
+	// on every login and refresh with the "user" role plus every matching mapping, so group
+	// membership at the provider is the single source of truth. The admin claim above counts as
+	// one more mapping to the admin role.
+	RoleMappings []OidcRoleMapping `json:"roleMappings,omitempty"`
+}
+
+// OidcRoleMapping grants Role when the claim at Claim matches one of Values. Claim is a dot
+// separated path, e.g. "groups" or "realm_access.roles". Without Values the claim must be true.
+type OidcRoleMapping struct {
+	Claim  string   `json:"claim"`
+	Values []string `json:"values,omitempty"`
+	Role   string   `json:"role"`
+}
+
+// LdapConfig describes the directory used for LDAP / Active Directory logins. Users are found
+// with a search bound as BindDN (or anonymously) and then authenticated by binding as themselves.
+type LdapConfig struct {
+	// URL is ldap://host:389 or ldaps://host:636.
+	URL string `json:"url"`
+	// StartTLS upgrades an ldap:// connection before anything is sent.
+	StartTLS      bool `json:"startTls,omitempty"`
+	SkipTLSVerify bool `json:"skipTlsVerify,omitempty"`
+
+	BindDN       string `json:"bindDn,omitempty"`
+	BindPassword string `json:"bindPassword,omitempty"`
+	BaseDN       string `json:"baseDn"`
+	// UserFilter finds the user; {username} is replaced with the escaped login name.
+	// Examples: "(uid={username})", "(&(objectClass=user)(sAMAccountName={username}))".
+	UserFilter string `json:"userFilter,omitempty"`
+
+	// Attributes read from the user entry. IDAttribute should be immutable, such as entryUUID or
+	// objectGUID; the entry DN is used when it is empty.
+	IDAttribute          string `json:"idAttribute,omitempty"`
+	UsernameAttribute    string `json:"usernameAttribute,omitempty"`
+	EmailAttribute       string `json:"emailAttribute,omitempty"`
+	DisplayNameAttribute string `json:"displayNameAttribute,omitempty"`
+	GroupAttribute       string `json:"groupAttribute,omitempty"`
+
+	// GroupMappings assign Arcane roles from group membership. When set, a user's roles are
+	// replaced on every login with the "user" role plus every matching mapping.
+	GroupMappings []LdapGroupMapping `json:"groupMappings,omitempty"`
+}
+
+// LdapGroupMapping grants Role to members of Group, given as a full DN or just its CN.
+type LdapGroupMapping struct {
+	Group string `json:"group"`
+	Role  string `json:"role"`
+}
+
+// ProxyAuthConfig configures authentication by a reverse proxy such as Authelia, Authentik or
+// oauth2-proxy that passes the authenticated user in request headers.
+type ProxyAuthConfig struct {
+	// TrustedProxies lists the addresses or CIDRs of the proxies allowed to set the headers.
+	// Headers arriving from any other peer are ignored.
+	TrustedProxies []string `json:"trustedProxies"`
+
+	// Header names; the defaults are Remote-User, Remote-Email, Remote-Name and Remote-Groups.
+	UserHeader   string `json:"userHeader,omitempty"`
+	EmailHeader  string `json:"emailHeader,omitempty"`
+	NameHeader   string `json:"nameHeader,omitempty"`
+	GroupsHeader string `json:"groupsHeader,omitempty"`
+	// GroupSeparator splits the groups header; the default is a comma.
+	GroupSeparator string `json:"groupSeparator,omitempty"`
+
+	// AutoProvision creates an account for users Arcane does not know yet.
+	AutoProvision bool `json:"autoProvision,omitempty"`
+	// GroupMappings assign Arcane roles from the groups header. When set, a user's roles are
+	// replaced with the "user" role plus every matching mapping.
+	GroupMappings []ProxyGroupMapping `json:"groupMappings,omitempty"`
+}
+
+// ProxyGroupMapping grants Role to members of Group.
+type ProxyGroupMapping struct {
+	Group string `json:"group"`
+	Role  string `json:"role"`
 }
@@ -11,10 +11,24 @@ type User struct {
 	Email                  *string     `json:"email,omitempty" sortable:"true"`
 	Roles                  StringSlice `json:"roles" gorm:"type:text"`
 	OidcSubjectId          *string     `json:"oidcSubjectId,omitempty" gorm:"column:oidc_subject_id"`
+	LdapId                 *string     `json:"ldapId,omitempty" gorm:"column:ldap_id"`
 	LastLogin              *time.Time  `json:"lastLogin,omitempty" gorm:"column:last_login" sortable:"true"`
 	Locale                 *string     `json:"locale,omitempty" gorm:"column:locale"`
 	RequiresPasswordChange bool        `json:"requiresPasswordChange" gorm:"column:requires_password_change"`
 
+	// TOTP two-factor authentication. The secret is encrypted at rest and recovery codes are
+	// stored as hashes; TotpLastStep rejects replays of an already used code.
+	TotpSecret        *string     `json:"-" gorm:"column:totp_secret;type:text"`
+	TotpEnabled       bool        `json:"totpEnabled" gorm:"column:totp_enabled"`
+	TotpRecoveryCodes StringSlice `json:"-" gorm:"column:totp_recovery_codes;type:text"`
+	TotpLastStep      int64       `json:"-" gorm:"column:totp_last_step"`
+
+	// Brute-force protection. FailedLoginAttempts counts consecutive failures; LockoutCount
+	// counts consecutive lockouts and makes each one twice as long as the previous.
+	FailedLoginAttempts int        `json:"-" gorm:"column:failed_login_attempts"`
+	LockoutCount        int        `json:"-" gorm:"column:lockout_count"`
+	LockedUntil         *time.Time `json:"lockedUntil,omitempty" gorm:"column:locked_until"`
+
 	// OIDC provider tokens
 	OidcAccessToken          *string    `json:"-" gorm:"type:text"`
 	OidcRefreshToken         *string    `json:"-" gorm:"type:text"`
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// WebauthnCredential is a passkey or security key registered to a user. CredentialID and
+// PublicKey (a COSE key) are stored base64url encoded.
+type WebauthnCredential struct {
+	UserID       string      `json:"userId" gorm:"column:user_id"`
+	Name         string      `json:"name" sortable:"true"`
+	CredentialID string      `json:"credentialId" gorm:"column:credential_id;uniqueIndex"`
+	PublicKey    string      `json:"-" gorm:"column:public_key"`
+	Algorithm    int64       `json:"algorithm"`
+	SignCount    int64       `json:"-" gorm:"column:sign_count"`
+	Transports   StringSlice `json:"transports" gorm:"type:text"`
+	LastUsedAt   *time.Time  `json:"lastUsedAt,omitempty" gorm:"column:last_used_at" sortable:"true"`
+	BaseModel
+}
+
+func (WebauthnCredential) TableName() string { return "webauthn_credentials" }
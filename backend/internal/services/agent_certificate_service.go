@@ -0,0 +1,455 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/utils"
+	"github.com/ofkm/arcane-backend/internal/utils/pki"
+)
+
+const (
+	// AgentManagerCommonName is the subject of the client certificate the manager presents to
+	// agents; agents refuse client certificates with any other name.
+	AgentManagerCommonName = "arcane-manager"
+
+	agentCaValidity          = 10 * 365 * 24 * time.Hour
+	agentManagerCertValidity = 365 * 24 * time.Hour
+	agentCertValidity        = 90 * 24 * time.Hour
+	// AgentCertRenewBefore is how long before expiry certificates are renewed.
+	AgentCertRenewBefore = 30 * 24 * time.Hour
+
+	agentCaCertificateKey      = "agentCaCertificate"
+	agentCaPrivateKeyKey       = "agentCaPrivateKey" // #nosec G101: setting name, not a credential
+	agentManagerCertificateKey = "agentManagerCertificate"
+	agentManagerPrivateKeyKey  = "agentManagerPrivateKey" // #nosec G101: setting name, not a credential
+)
+
+var ErrAgentCertificateNotFound = errors.New("agent certificate not found")
+
+type agentTransport struct {
+	serial    string
+	transport *http.Transport
+}
+
+// AgentCertificateService is the manager's certificate authority for mutual TLS with agents. It
+// issues each agent a certificate during pairing, keeps a client certificate for the manager
+// itself, and builds the TLS transports used to reach agents that hold a certificate.
+type AgentCertificateService struct {
+	db              *database.DB
+	settingsService *SettingsService
+
+	mu         sync.Mutex
+	ca         *x509.Certificate
+	caKey      *ecdsa.PrivateKey
+	manager    *tls.Certificate
+	transports map[string]*agentTransport
+}
+
+func NewAgentCertificateService(db *database.DB, settingsService *SettingsService, environmentService *EnvironmentService) *AgentCertificateService {
+	s := &AgentCertificateService{
+		db:              db,
+		settingsService: settingsService,
+		transports:      make(map[string]*agentTransport),
+	}
+	environmentService.certs = s
+	return s
+}
+
+// CACertificate returns the PEM encoded CA certificate agents use to verify the manager,
+// creating the CA on first use.
+func (s *AgentCertificateService) CACertificate(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadCALocked(ctx); err != nil {
+		return "", err
+	}
+	return pki.EncodeCertificate(s.ca), nil
+}
+
+// Issue signs the agent's certificate request for the environment. The certificate is valid for
+// the host of apiURL and is recorded, but it only becomes the one the manager accepts after
+// Activate.
+func (s *AgentCertificateService) Issue(ctx context.Context, environmentID, apiURL, csrPEM string) (*models.AgentCertificate, error) {
+	csr, err := pki.ParseCSR(csrPEM)
+	if err != nil {
+		return nil, err
+	}
+	var hosts []string
+	if u, err := url.Parse(apiURL); err == nil && u.Hostname() != "" {
+		hosts = append(hosts, u.Hostname())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadCALocked(ctx); err != nil {
+		return nil, err
+	}
+
+	cert, err := pki.Issue(s.ca, s.caKey, csr.PublicKey, pki.LeafTemplate{
+		CommonName: "arcane-agent-" + environmentID,
+		Hosts:      hosts,
+		Validity:   agentCertValidity,
+		Client:     true,
+		Server:     true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	record := &models.AgentCertificate{
+		EnvironmentID: environmentID,
+		SerialNumber:  pki.SerialString(cert.SerialNumber),
+		Fingerprint:   pki.Fingerprint(cert),
+		Certificate:   pki.EncodeCertificate(cert),
+		NotAfter:      cert.NotAfter,
+		BaseModel:     models.BaseModel{ID: uuid.NewString(), CreatedAt: time.Now()},
+	}
+	if err := s.db.WithContext(ctx).Create(record).Error; err != nil {
+		return nil, fmt.Errorf("failed to record agent certificate: %w", err)
+	}
+	return record, nil
+}
+
+// Activate makes the certificate the one accepted for its environment and revokes every other
+// certificate issued to it. Call it once the agent has installed the certificate.
+func (s *AgentCertificateService) Activate(ctx context.Context, environmentID, certificateID string) error {
+	now := time.Now()
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.AgentCertificate{}).
+			Where("id = ? AND environment_id = ? AND revoked_at IS NULL", certificateID, environmentID).
+			Updates(map[string]interface{}{"activated_at": &now, "updated_at": &now})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrAgentCertificateNotFound
+		}
+		return tx.Model(&models.AgentCertificate{}).
+			Where("environment_id = ? AND id <> ? AND revoked_at IS NULL", environmentID, certificateID).
+			Updates(map[string]interface{}{"revoked_at": &now, "updated_at": &now}).Error
+	})
+	if errors.Is(err, ErrAgentCertificateNotFound) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to activate agent certificate: %w", err)
+	}
+	s.invalidate(environmentID)
+	return nil
+}
+
+// Revoke revokes every certificate of the environment. The manager refuses the agent until it is
+// paired again with its bootstrap token.
+func (s *AgentCertificateService) Revoke(ctx context.Context, environmentID string) (int64, error) {
+	now := time.Now()
+	res := s.db.WithContext(ctx).Model(&models.AgentCertificate{}).
+		Where("environment_id = ? AND revoked_at IS NULL", environmentID).
+		Updates(map[string]interface{}{"revoked_at": &now, "updated_at": &now})
+	if res.Error != nil {
+		return 0, fmt.Errorf("failed to revoke agent certificates: %w", res.Error)
+	}
+	s.invalidate(environmentID)
+	if res.RowsAffected > 0 {
+		slog.InfoContext(ctx, "Revoked agent certificates", "environmentId", environmentID, "count", res.RowsAffected)
+	}
+	return res.RowsAffected, nil
+}
+
+// RevokeCertificate revokes one certificate of the environment.
+func (s *AgentCertificateService) RevokeCertificate(ctx context.Context, environmentID, certificateID string) error {
+	now := time.Now()
+	res := s.db.WithContext(ctx).Model(&models.AgentCertificate{}).
+		Where("id = ? AND environment_id = ? AND revoked_at IS NULL", certificateID, environmentID).
+		Updates(map[string]interface{}{"revoked_at": &now, "updated_at": &now})
+	if res.Error != nil {
+		return fmt.Errorf("failed to revoke agent certificate: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrAgentCertificateNotFound
+	}
+	s.invalidate(environmentID)
+	return nil
+}
+
+// DeleteForEnvironment removes every certificate record of a deleted environment.
+func (s *AgentCertificateService) DeleteForEnvironment(ctx context.Context, tx *gorm.DB, environmentID string) error {
+	if err := tx.WithContext(ctx).Delete(&models.AgentCertificate{}, "environment_id = ?", environmentID).Error; err != nil {
+		return fmt.Errorf("failed to delete agent certificates: %w", err)
+	}
+	s.invalidate(environmentID)
+	return nil
+}
+
+// List returns the certificates issued to the environment, newest first.
+func (s *AgentCertificateService) List(ctx context.Context, environmentID string) ([]models.AgentCertificate, error) {
+	var certs []models.AgentCertificate
+	if err := s.db.WithContext(ctx).Where("environment_id = ?", environmentID).Order("created_at DESC").Find(&certs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list agent certificates: %w", err)
+	}
+	return certs, nil
+}
+
+// Active returns the certificate accepted for the environment.
+func (s *AgentCertificateService) Active(ctx context.Context, environmentID string) (*models.AgentCertificate, error) {
+	var cert models.AgentCertificate
+	err := s.db.WithContext(ctx).
+		Where("environment_id = ? AND activated_at IS NOT NULL AND revoked_at IS NULL", environmentID).
+		Order("activated_at DESC").
+		First(&cert).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAgentCertificateNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load agent certificate: %w", err)
+	}
+	return &cert, nil
+}
+
+// HasInstalled reports whether the environment's agent ever installed a certificate. Such an
+// environment is only reached over mutual TLS, even after its certificates were revoked.
+func (s *AgentCertificateService) HasInstalled(ctx context.Context, environmentID string) (bool, error) {
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&models.AgentCertificate{}).Where("environment_id = ? AND activated_at IS NOT NULL", environmentID).Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check agent certificates: %w", err)
+	}
+	return count > 0, nil
+}
+
+// ExpiringEnvironments returns the environments whose active certificate expires within d.
+func (s *AgentCertificateService) ExpiringEnvironments(ctx context.Context, d time.Duration) ([]string, error) {
+	var ids []string
+	err := s.db.WithContext(ctx).Model(&models.AgentCertificate{}).
+		Where("activated_at IS NOT NULL AND revoked_at IS NULL AND not_after < ?", time.Now().Add(d)).
+		Distinct().Pluck("environment_id", &ids).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find expiring agent certificates: %w", err)
+	}
+	return ids, nil
+}
+
+// Transport returns the mutual TLS transport for the environment's agent. It trusts only the
+// environment's active certificate, so a revoked or superseded certificate is refused even though
+// it chains to the CA.
+func (s *AgentCertificateService) Transport(ctx context.Context, environmentID string) (*http.Transport, error) {
+	active, err := s.Active(ctx, environmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.transports[environmentID]; ok && t.serial == active.SerialNumber {
+		return t.transport, nil
+	}
+
+	cfg, err := s.tlsConfigLocked(ctx, active.SerialNumber)
+	if err != nil {
+		return nil, err
+	}
+	t := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		TLSClientConfig:     cfg,
+		TLSHandshakeTimeout: 10 * time.Second,
+		MaxIdleConnsPerHost: 16,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	if previous, ok := s.transports[environmentID]; ok {
+		previous.transport.CloseIdleConnections()
+	}
+	s.transports[environmentID] = &agentTransport{serial: active.SerialNumber, transport: t}
+	return t, nil
+}
+
+// PairingTransport returns the transport used to pair with an agent. The agent's certificate is
+// self-signed at that point and cannot be verified; the bootstrap token authenticates the agent
+// and the certificate issued during pairing is bound to a key the agent generated. The manager
+// still presents its client certificate, which an agent paired before requires.
+func (s *AgentCertificateService) PairingTransport(ctx context.Context) *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{ // #nosec G402 -- see above
+			MinVersion:         tls.VersionTLS12,
+			InsecureSkipVerify: true,
+			GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return s.managerCertificate(context.WithoutCancel(ctx))
+			},
+		},
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+}
+
+func (s *AgentCertificateService) tlsConfigLocked(ctx context.Context, serial string) (*tls.Config, error) {
+	if err := s.loadCALocked(ctx); err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(s.ca)
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    roots,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return s.managerCertificate(context.WithoutCancel(ctx))
+		},
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 || pki.SerialString(cs.PeerCertificates[0].SerialNumber) != serial {
+				return errors.New("agent presented a revoked or unknown certificate")
+			}
+			return nil
+		},
+	}, nil
+}
+
+// managerCertificate returns the manager's client certificate, renewing it when it nears expiry.
+func (s *AgentCertificateService) managerCertificate(ctx context.Context) (*tls.Certificate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.manager != nil && time.Until(s.manager.Leaf.NotAfter) > AgentCertRenewBefore {
+		return s.manager, nil
+	}
+
+	if s.manager == nil {
+		certPEM := s.settingsService.GetStringSetting(ctx, agentManagerCertificateKey, "")
+		keyPEM := s.decryptSetting(ctx, agentManagerPrivateKeyKey)
+		if certPEM != "" && keyPEM != "" {
+			if pair, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM)); err == nil && pair.Leaf != nil {
+				s.manager = &pair
+				if time.Until(pair.Leaf.NotAfter) > AgentCertRenewBefore {
+					return s.manager, nil
+				}
+			}
+		}
+	}
+
+	if err := s.loadCALocked(ctx); err != nil {
+		return nil, err
+	}
+	key, err := pki.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	cert, err := pki.Issue(s.ca, s.caKey, key.Public(), pki.LeafTemplate{
+		CommonName: AgentManagerCommonName,
+		Validity:   agentManagerCertValidity,
+		Client:     true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := pki.EncodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	certPEM := pki.EncodeCertificate(cert)
+	if err := saveSettingValues(ctx, s.db, map[string]string{agentManagerCertificateKey: certPEM}, map[string]string{agentManagerPrivateKeyKey: keyPEM}); err != nil {
+		return nil, err
+	}
+
+	pair, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load manager certificate: %w", err)
+	}
+	s.manager = &pair
+	slog.InfoContext(ctx, "Issued manager client certificate for agent connections", "notAfter", cert.NotAfter)
+	return s.manager, nil
+}
+
+// loadCALocked loads the CA, creating it on first use.
+func (s *AgentCertificateService) loadCALocked(ctx context.Context) error {
+	if s.ca != nil {
+		return nil
+	}
+
+	certPEM := s.settingsService.GetStringSetting(ctx, agentCaCertificateKey, "")
+	keyPEM := s.decryptSetting(ctx, agentCaPrivateKeyKey)
+	if certPEM != "" && keyPEM != "" {
+		cert, err := pki.ParseCertificate(certPEM)
+		if err != nil {
+			return fmt.Errorf("failed to load agent CA: %w", err)
+		}
+		key, err := pki.ParseKey(keyPEM)
+		if err != nil {
+			return fmt.Errorf("failed to load agent CA: %w", err)
+		}
+		s.ca, s.caKey = cert, key
+		return nil
+	}
+
+	key, err := pki.GenerateKey()
+	if err != nil {
+		return err
+	}
+	cert, err := pki.NewCA(key, "Arcane Agent CA", agentCaValidity)
+	if err != nil {
+		return err
+	}
+	encodedKey, err := pki.EncodeKey(key)
+	if err != nil {
+		return err
+	}
+	if err := saveSettingValues(ctx, s.db, map[string]string{agentCaCertificateKey: pki.EncodeCertificate(cert)}, map[string]string{agentCaPrivateKeyKey: encodedKey}); err != nil {
+		return err
+	}
+	s.ca, s.caKey = cert, key
+	slog.InfoContext(ctx, "Created certificate authority for agent connections", "notAfter", cert.NotAfter)
+	return nil
+}
+
+func (s *AgentCertificateService) decryptSetting(ctx context.Context, key string) string {
+	encrypted := s.settingsService.GetStringSetting(ctx, key, "")
+	if encrypted == "" {
+		return ""
+	}
+	decrypted, err := utils.Decrypt(encrypted)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to decrypt agent certificate setting", "key", key, "error", err)
+		return ""
+	}
+	return decrypted
+}
+
+// saveSettingValues stores internal setting values in one transaction, encrypting those in secret.
+func saveSettingValues(ctx context.Context, db *database.DB, plain map[string]string, secret map[string]string) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for k, v := range plain {
+			if err := tx.Save(&models.SettingVariable{Key: k, Value: v}).Error; err != nil {
+				return fmt.Errorf("failed to store %s: %w", k, err)
+			}
+		}
+		for k, v := range secret {
+			encrypted, err := utils.Encrypt(v)
+			if err != nil {
+				return fmt.Errorf("failed to encrypt %s: %w", k, err)
+			}
+			if err := tx.Save(&models.SettingVariable{Key: k, Value: encrypted}).Error; err != nil {
+				return fmt.Errorf("failed to store %s: %w", k, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *AgentCertificateService) invalidate(environmentID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.transports[environmentID]; ok {
+		t.transport.CloseIdleConnections()
+		delete(s.transports, environmentID)
+	}
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	glsqlite "github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/ofkm/arcane-backend/internal/config"
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/utils"
+)
+
+func newAgentTLSTestDB(t *testing.T, extra ...interface{}) (*database.DB, *SettingsService) {
+	t.Helper()
+	gdb, err := gorm.Open(glsqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, gdb.AutoMigrate(append([]interface{}{&models.SettingVariable{}}, extra...)...))
+	db := &database.DB{DB: gdb}
+	settingsService, err := NewSettingsService(context.Background(), db)
+	require.NoError(t, err)
+	return db, settingsService
+}
+
+// startTestAgent serves the agent's pairing and certificate endpoints over TLS the way the agent
+// router does, guarding token-authenticated routes with VerifyManager.
+func startTestAgent(t *testing.T, agentTLS *AgentTLSService) *httptest.Server {
+	t.Helper()
+	const bootstrapToken, agentToken = "bootstrap", "agent-token"
+
+	reply := func(w http.ResponseWriter, data any) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"success": true, "data": data})
+	}
+	authorized := func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get("X-Arcane-Agent-Token") != agentToken || agentTLS.VerifyManager(r.TLS) != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return false
+		}
+		return true
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/environments/0/agent/pair", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Arcane-Agent-Bootstrap") != bootstrapToken {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		csr, err := agentTLS.CreateCSR(r.Context())
+		require.NoError(t, err)
+		reply(w, map[string]string{"token": agentToken, "csr": csr})
+	})
+	mux.HandleFunc("POST /api/environments/0/agent/csr", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+		csr, err := agentTLS.CreateCSR(r.Context())
+		require.NoError(t, err)
+		reply(w, map[string]string{"csr": csr})
+	})
+	mux.HandleFunc("POST /api/environments/0/agent/certificate", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+		var body struct {
+			Certificate   string `json:"certificate"`
+			CaCertificate string `json:"caCertificate"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		if err := agentTLS.Install(r.Context(), body.Certificate, body.CaCertificate); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		reply(w, nil)
+	})
+	mux.HandleFunc("GET /api/health", func(w http.ResponseWriter, r *http.Request) {
+		if agentTLS.VerifyManager(r.TLS) != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("GET /api/environments/0/system/docker/info", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"version": "27.0.0"})
+	})
+
+	srv := httptest.NewUnstartedServer(mux)
+	srv.TLS = agentTLS.ServerTLSConfig()
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestAgentCertificates_PairRotateRevoke(t *testing.T) {
+	ctx := context.Background()
+	utils.InitEncryption(&config.Config{})
+
+	managerDB, managerSettings := newAgentTLSTestDB(t, &models.Environment{}, &models.EnvironmentAccess{}, &models.AgentCertificate{})
+	envService := NewEnvironmentService(managerDB, nil)
+	certs := NewAgentCertificateService(managerDB, managerSettings, envService)
+
+	agentDB, agentSettings := newAgentTLSTestDB(t)
+	agentTLS := NewAgentTLSService(agentDB, agentSettings)
+	require.NoError(t, agentTLS.Load(ctx))
+	require.False(t, agentTLS.Installed())
+	agent := startTestAgent(t, agentTLS)
+
+	env, err := envService.CreateEnvironment(ctx, &models.Environment{Name: "edge", ApiUrl: agent.URL, Enabled: true})
+	require.NoError(t, err)
+
+	token, err := envService.PairAndPersistAgentToken(ctx, env.ID, agent.URL, "bootstrap")
+	require.NoError(t, err)
+	require.Equal(t, "agent-token", token)
+	require.True(t, agentTLS.Installed())
+
+	first, err := certs.Active(ctx, env.ID)
+	require.NoError(t, err)
+
+	status, err := envService.TestConnection(ctx, env.ID)
+	require.NoError(t, err)
+	require.Equal(t, "online", status)
+
+	// Without the manager's client certificate the agent token alone is refused.
+	anonymous := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}} // #nosec G402 -- test client
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, agent.URL+"/api/environments/0/agent/csr", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Arcane-Agent-Token", token)
+	resp, err := anonymous.Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	rotated, err := envService.RotateAgentCertificate(ctx, env.ID)
+	require.NoError(t, err)
+	require.NotEqual(t, first.SerialNumber, rotated.SerialNumber)
+
+	list, err := envService.ListAgentCertificates(ctx, env.ID)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	for _, c := range list {
+		if c.ID == first.ID {
+			require.NotNil(t, c.RevokedAt, "rotation must revoke the previous certificate")
+		} else {
+			require.Nil(t, c.RevokedAt)
+		}
+	}
+
+	status, err = envService.TestConnection(ctx, env.ID)
+	require.NoError(t, err)
+	require.Equal(t, "online", status)
+
+	// A revoked agent is never reached again without TLS; it has to be paired anew.
+	revoked, err := envService.RevokeAgentCertificates(ctx, env.ID)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, revoked)
+	status, err = envService.TestConnection(ctx, env.ID)
+	require.Error(t, err)
+	require.Equal(t, "offline", status)
+
+	_, err = envService.PairAndPersistAgentToken(ctx, env.ID, agent.URL, "bootstrap")
+	require.NoError(t, err)
+	status, err = envService.TestConnection(ctx, env.ID)
+	require.NoError(t, err)
+	require.Equal(t, "online", status)
+}
+
+func TestAgentTLSService_RejectsForeignCertificate(t *testing.T) {
+	ctx := context.Background()
+	utils.InitEncryption(&config.Config{})
+
+	managerDB, managerSettings := newAgentTLSTestDB(t, &models.Environment{}, &models.EnvironmentAccess{}, &models.AgentCertificate{})
+	certs := NewAgentCertificateService(managerDB, managerSettings, NewEnvironmentService(managerDB, nil))
+
+	agentDB, agentSettings := newAgentTLSTestDB(t)
+	agentTLS := NewAgentTLSService(agentDB, agentSettings)
+	require.NoError(t, agentTLS.Load(ctx))
+
+	csr, err := agentTLS.CreateCSR(ctx)
+	require.NoError(t, err)
+	issued, err := certs.Issue(ctx, "env-1", "https://edge.example:3553", csr)
+	require.NoError(t, err)
+
+	// A certificate from another CA is refused, and the agent keeps accepting any client.
+	otherDB, otherSettings := newAgentTLSTestDB(t, &models.Environment{}, &models.EnvironmentAccess{}, &models.AgentCertificate{})
+	otherCA, err := NewAgentCertificateService(otherDB, otherSettings, NewEnvironmentService(otherDB, nil)).CACertificate(ctx)
+	require.NoError(t, err)
+	require.Error(t, agentTLS.Install(ctx, issued.Certificate, otherCA))
+	require.False(t, agentTLS.Installed())
+
+	ca, err := certs.CACertificate(ctx)
+	require.NoError(t, err)
+	require.NoError(t, agentTLS.Install(ctx, issued.Certificate, ca))
+	require.True(t, agentTLS.Installed())
+	require.ErrorIs(t, agentTLS.VerifyManager(&tls.ConnectionState{}), ErrAgentManagerCertificateRequired)
+
+	// The installed certificate survives a restart.
+	restarted := NewAgentTLSService(agentDB, agentSettings)
+	require.NoError(t, restarted.Load(ctx))
+	require.True(t, restarted.Installed())
+}
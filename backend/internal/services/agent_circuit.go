@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/utils/circuit"
+)
+
+const (
+	// agentCircuitThreshold consecutive failed requests mark an agent unavailable.
+	agentCircuitThreshold = 3
+	// agentCircuitCooldown is how long requests to an unavailable agent fail fast before one is
+	// let through to find out whether it is back.
+	agentCircuitCooldown = 30 * time.Second
+)
+
+// ErrEnvironmentUnavailable is returned without contacting the agent while its environment's
+// circuit is open.
+var ErrEnvironmentUnavailable = errors.New("environment is unavailable")
+
+// AgentRetryAfter returns how long requests to the environment's agent keep failing fast; zero
+// when they go through.
+func (s *EnvironmentService) AgentRetryAfter(id string) time.Duration {
+	return s.circuits.Get(id).RetryAfter()
+}
+
+// resetAgentCircuit closes the environment's circuit once the agent has been seen healthy.
+func (s *EnvironmentService) resetAgentCircuit(ctx context.Context, id string) {
+	if s.circuits.Get(id).Reset() {
+		slog.InfoContext(ctx, "Agent circuit closed after a successful probe", "environmentId", id)
+	}
+}
+
+// agentCircuitTransport guards every request to one environment's agent with its circuit
+// breaker and keeps the environment's status in step when the circuit opens or closes.
+type agentCircuitTransport struct {
+	next               http.RoundTripper
+	environmentService *EnvironmentService
+	id                 string
+	breaker            *circuit.Breaker
+}
+
+func (s *EnvironmentService) guardAgentClient(client *http.Client, id string) *http.Client {
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	guarded := *client
+	guarded.Transport = &agentCircuitTransport{next: next, environmentService: s, id: id, breaker: s.circuits.Get(id)}
+	return &guarded
+}
+
+func (t *agentCircuitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.breaker.Allow(); err != nil {
+		return nil, fmt.Errorf("%w: retrying in %s", ErrEnvironmentUnavailable, t.breaker.RetryAfter().Round(time.Second))
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	ctx := context.WithoutCancel(req.Context())
+	switch {
+	case err != nil && errors.Is(context.Cause(req.Context()), context.Canceled):
+		// The caller gave up; that says nothing about the agent.
+	case err != nil:
+		t.failed(ctx, err.Error())
+	case resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable || resp.StatusCode == http.StatusGatewayTimeout:
+		t.failed(ctx, fmt.Sprintf("agent returned %d", resp.StatusCode))
+	default:
+		if t.breaker.Success() {
+			now := time.Now()
+			if err := t.environmentService.setStatus(ctx, t.id, models.EnvironmentStatusOnline, map[string]interface{}{"last_seen": &now}, ""); err != nil {
+				slog.WarnContext(ctx, "Failed to mark environment online", "environmentId", t.id, "error", err)
+			}
+		}
+	}
+	return resp, err
+}
+
+func (t *agentCircuitTransport) failed(ctx context.Context, reason string) {
+	if !t.breaker.Failure() {
+		return
+	}
+	slog.WarnContext(ctx, "Agent circuit opened", "environmentId", t.id, "reason", reason)
+	reason = fmt.Sprintf("%d consecutive requests failed: %s", agentCircuitThreshold, reason)
+	if err := t.environmentService.setStatus(ctx, t.id, models.EnvironmentStatusOffline, map[string]interface{}{}, reason); err != nil {
+		slog.WarnContext(ctx, "Failed to mark environment offline", "environmentId", t.id, "error", err)
+	}
+}
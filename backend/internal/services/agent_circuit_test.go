@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ofkm/arcane-backend/internal/config"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/utils"
+)
+
+func TestAgentCircuit_FailsFastAndTracksStatus(t *testing.T) {
+	ctx := context.Background()
+	utils.InitEncryption(&config.Config{})
+	db, _ := newAgentTLSTestDB(t, &models.Environment{}, &models.Event{})
+	envService := NewEnvironmentService(db, nil)
+	NewEnvironmentHealthService(db, envService, NewEventService(db), nil)
+
+	var down atomic.Bool
+	var requests atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/health", func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	})
+	mux.HandleFunc("GET /api/environments/0/containers", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if down.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	})
+	agent := httptest.NewServer(mux)
+	t.Cleanup(agent.Close)
+
+	env, err := envService.CreateEnvironment(ctx, &models.Environment{Name: "edge", ApiUrl: agent.URL, Enabled: true})
+	require.NoError(t, err)
+	require.NoError(t, envService.RecordProbe(ctx, env.ID, envService.ProbeEnvironment(ctx, env)))
+
+	get := func() error {
+		t.Helper()
+		client, baseURL, err := envService.AgentHTTPClient(ctx, env.ID, env.ApiUrl, 0)
+		require.NoError(t, err)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/api/environments/0/containers", nil)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+		return err
+	}
+	statusOf := func() string {
+		t.Helper()
+		var stored models.Environment
+		require.NoError(t, db.Where("id = ?", env.ID).First(&stored).Error)
+		return stored.Status
+	}
+
+	require.NoError(t, get())
+	require.Equal(t, "online", statusOf())
+
+	// Consecutive gateway failures open the circuit and take the environment offline.
+	down.Store(true)
+	for range agentCircuitThreshold {
+		require.NoError(t, get())
+	}
+	require.Equal(t, "offline", statusOf())
+	require.Positive(t, envService.AgentRetryAfter(env.ID))
+
+	// Further requests fail without reaching the agent.
+	seen := requests.Load()
+	require.ErrorIs(t, get(), ErrEnvironmentUnavailable)
+	require.Equal(t, seen, requests.Load())
+
+	// Probes bypass the circuit, and a healthy one closes it again.
+	probe := envService.ProbeEnvironment(ctx, env)
+	require.Equal(t, models.EnvironmentStatusError, probe.Status)
+	down.Store(false)
+	require.NoError(t, envService.RecordProbe(ctx, env.ID, envService.ProbeEnvironment(ctx, env)))
+	require.Equal(t, "online", statusOf())
+	require.Zero(t, envService.AgentRetryAfter(env.ID))
+	require.NoError(t, get())
+	require.Equal(t, seen+1, requests.Load())
+}
@@ -0,0 +1,242 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/utils"
+	"github.com/ofkm/arcane-backend/internal/utils/pki"
+)
+
+const (
+	agentTlsCertificateKey   = "agentTlsCertificate"
+	agentTlsCaCertificateKey = "agentTlsCaCertificate"
+	agentTlsPrivateKeyKey    = "agentTlsPrivateKey"        // #nosec G101: setting name, not a credential
+	agentTlsPendingKeyKey    = "agentTlsPendingPrivateKey" // #nosec G101: setting name, not a credential
+)
+
+var ErrAgentManagerCertificateRequired = errors.New("a client certificate issued to the manager is required")
+
+// AgentTLSService serves an agent's API over TLS. Until the manager installs a certificate from
+// its CA the agent uses a self-signed one and accepts any client; afterwards it presents the
+// issued certificate and only trusts clients holding the manager's certificate from that CA.
+type AgentTLSService struct {
+	db              *database.DB
+	settingsService *SettingsService
+
+	mu         sync.RWMutex
+	key        *ecdsa.PrivateKey
+	pendingKey *ecdsa.PrivateKey
+	cert       *tls.Certificate
+	clientCAs  *x509.CertPool
+}
+
+func NewAgentTLSService(db *database.DB, settingsService *SettingsService) *AgentTLSService {
+	return &AgentTLSService{db: db, settingsService: settingsService}
+}
+
+// Load restores the agent's key and certificates, generating a key and a self-signed
+// certificate when the agent has not been issued one.
+func (s *AgentTLSService) Load(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyPEM, err := s.readSecret(ctx, agentTlsPrivateKeyKey)
+	if err != nil {
+		return err
+	}
+	if keyPEM == "" {
+		key, err := pki.GenerateKey()
+		if err != nil {
+			return err
+		}
+		if keyPEM, err = pki.EncodeKey(key); err != nil {
+			return err
+		}
+		if err := saveSettingValues(ctx, s.db, nil, map[string]string{agentTlsPrivateKeyKey: keyPEM}); err != nil {
+			return err
+		}
+	}
+	if s.key, err = pki.ParseKey(keyPEM); err != nil {
+		return err
+	}
+
+	s.pendingKey = nil
+	if pendingPEM, err := s.readSecret(ctx, agentTlsPendingKeyKey); err == nil && pendingPEM != "" {
+		s.pendingKey, _ = pki.ParseKey(pendingPEM)
+	}
+
+	certPEM := s.settingsService.GetStringSetting(ctx, agentTlsCertificateKey, "")
+	caPEM := s.settingsService.GetStringSetting(ctx, agentTlsCaCertificateKey, "")
+	if certPEM != "" && caPEM != "" {
+		if cert, pool, err := parseIssuedCertificate(certPEM, caPEM, s.key); err != nil {
+			slog.WarnContext(ctx, "Stored agent certificate is unusable; serving a self-signed certificate until the manager issues a new one", "error", err)
+		} else {
+			s.cert, s.clientCAs = cert, pool
+			slog.InfoContext(ctx, "Serving agent API with the manager-issued certificate", "notAfter", s.cert.Leaf.NotAfter)
+			return nil
+		}
+	}
+
+	cert, err := pki.SelfSigned(s.key, "arcane-agent", 365*24*time.Hour)
+	if err != nil {
+		return err
+	}
+	s.cert = &tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: s.key, Leaf: cert}
+	s.clientCAs = nil
+	slog.InfoContext(ctx, "Serving agent API with a self-signed certificate until paired with a manager")
+	return nil
+}
+
+// Installed reports whether the agent holds a certificate issued by its manager.
+func (s *AgentTLSService) Installed() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.clientCAs != nil
+}
+
+// CreateCSR generates a new key and returns a certificate request for it. The key replaces the
+// current one once the manager installs a certificate issued for it.
+func (s *AgentTLSService) CreateCSR(ctx context.Context) (string, error) {
+	key, err := pki.GenerateKey()
+	if err != nil {
+		return "", err
+	}
+	keyPEM, err := pki.EncodeKey(key)
+	if err != nil {
+		return "", err
+	}
+	csr, err := pki.CreateCSR(key, "arcane-agent")
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := saveSettingValues(ctx, s.db, nil, map[string]string{agentTlsPendingKeyKey: keyPEM}); err != nil {
+		return "", err
+	}
+	s.pendingKey = key
+	return csr, nil
+}
+
+// Install starts serving certPEM, which must be issued by caPEM for the key of the last
+// certificate request, and from then on only accepts the manager's client certificate.
+func (s *AgentTLSService) Install(ctx context.Context, certPEM, caPEM string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := s.pendingKey
+	if key == nil {
+		return errors.New("no certificate request is pending")
+	}
+	cert, pool, err := parseIssuedCertificate(certPEM, caPEM, key)
+	if err != nil {
+		return err
+	}
+	keyPEM, err := pki.EncodeKey(key)
+	if err != nil {
+		return err
+	}
+	if err := saveSettingValues(ctx, s.db,
+		map[string]string{agentTlsCertificateKey: certPEM, agentTlsCaCertificateKey: caPEM, agentTlsPendingKeyKey: ""},
+		map[string]string{agentTlsPrivateKeyKey: keyPEM},
+	); err != nil {
+		return err
+	}
+	s.key, s.pendingKey = key, nil
+	s.cert, s.clientCAs = cert, pool
+
+	slog.InfoContext(ctx, "Installed agent certificate from manager", "notAfter", s.cert.Leaf.NotAfter, "fingerprint", pki.Fingerprint(s.cert.Leaf))
+	return nil
+}
+
+// Reset forgets the certificate issued by the manager, so the agent serves a self-signed one and
+// accepts any client until it is paired again.
+func (s *AgentTLSService) Reset(ctx context.Context) error {
+	if err := saveSettingValues(ctx, s.db, map[string]string{agentTlsCertificateKey: "", agentTlsCaCertificateKey: "", agentTlsPendingKeyKey: ""}, nil); err != nil {
+		return err
+	}
+	return s.Load(ctx)
+}
+
+// ServerTLSConfig returns the TLS configuration for the agent's listener. Certificates are looked
+// up per connection, so an installed certificate takes effect without a restart.
+func (s *AgentTLSService) ServerTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			s.mu.RLock()
+			defer s.mu.RUnlock()
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*s.cert},
+			}
+			// Clients without a certificate still reach unauthenticated routes such as the health
+			// check; VerifyManager guards everything else.
+			if s.clientCAs != nil {
+				cfg.ClientAuth = tls.VerifyClientCertIfGiven
+				cfg.ClientCAs = s.clientCAs
+			}
+			return cfg, nil
+		},
+	}
+}
+
+// VerifyManager checks that a TLS connection was made with the manager's client certificate. It
+// accepts any connection before the agent has been issued a certificate.
+func (s *AgentTLSService) VerifyManager(state *tls.ConnectionState) error {
+	if !s.Installed() {
+		return nil
+	}
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ErrAgentManagerCertificateRequired
+	}
+	if state.VerifiedChains[0][0].Subject.CommonName != AgentManagerCommonName {
+		return ErrAgentManagerCertificateRequired
+	}
+	return nil
+}
+
+// parseIssuedCertificate checks that certPEM was issued by caPEM for key and returns it with a
+// pool trusting the CA.
+func parseIssuedCertificate(certPEM, caPEM string, key *ecdsa.PrivateKey) (*tls.Certificate, *x509.CertPool, error) {
+	ca, err := pki.ParseCertificate(caPEM)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid CA certificate: %w", err)
+	}
+	cert, err := pki.ParseCertificate(certPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !pki.SamePublicKey(cert, key) {
+		return nil, nil, errors.New("certificate was not issued for the requested key")
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: pool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}); err != nil {
+		return nil, nil, fmt.Errorf("certificate is not issued by the given CA: %w", err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key, Leaf: cert}, pool, nil
+}
+
+func (s *AgentTLSService) readSecret(ctx context.Context, key string) (string, error) {
+	value := s.settingsService.GetStringSetting(ctx, key, "")
+	if value == "" {
+		return "", nil
+	}
+	decrypted, err := utils.Decrypt(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt %s: %w", key, err)
+	}
+	return decrypted, nil
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"sync"
+
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/models"
+)
+
+const (
+	agentTokenKey        = "agentToken"        // #nosec G101: setting name, not a credential
+	agentPendingTokenKey = "agentPendingToken" // #nosec G101: setting name, not a credential
+)
+
+var ErrAgentTokenNotPending = errors.New("token is not the pending agent token")
+
+// AgentTokenService holds the token an agent accepts from its manager. While the manager rotates
+// it, the new token is pending and both are accepted; confirming the new token retires the old one.
+type AgentTokenService struct {
+	db *database.DB
+
+	mu      sync.RWMutex
+	current string
+	pending string
+}
+
+func NewAgentTokenService(db *database.DB) *AgentTokenService {
+	return &AgentTokenService{db: db}
+}
+
+// Load restores the tokens saved by pairing or rotation. A saved token takes precedence over the
+// configured AGENT_TOKEN, which is only used until the agent has been paired.
+func (s *AgentTokenService) Load(ctx context.Context, configured string) error {
+	var rows []models.SettingVariable
+	if err := s.db.WithContext(ctx).Where("key IN ?", []string{agentTokenKey, agentPendingTokenKey}).Find(&rows).Error; err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current, s.pending = configured, ""
+	for _, row := range rows {
+		switch row.Key {
+		case agentTokenKey:
+			s.current = row.Value
+			if row.Value != "" {
+				slog.InfoContext(ctx, "Loaded agent token from database")
+			}
+		case agentPendingTokenKey:
+			s.pending = row.Value
+		}
+	}
+	return nil
+}
+
+// Token returns the token the agent presents to its manager.
+func (s *AgentTokenService) Token() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current
+}
+
+// Valid reports whether token is the agent's token or the one being rotated in.
+func (s *AgentTokenService) Valid(token string) bool {
+	if token == "" {
+		return false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return constantTimeEqual(token, s.current) || constantTimeEqual(token, s.pending)
+}
+
+// Set replaces the agent's token, as pairing does, and drops any pending one.
+func (s *AgentTokenService) Set(ctx context.Context, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := saveSettingValues(ctx, s.db, map[string]string{agentTokenKey: token, agentPendingTokenKey: ""}, nil); err != nil {
+		return err
+	}
+	s.current, s.pending = token, ""
+	return nil
+}
+
+// Stage makes next the pending token. A manager presenting the previously pending token has
+// already switched to it, so that token is confirmed first.
+func (s *AgentTokenService) Stage(ctx context.Context, presented, next string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current := s.current
+	if constantTimeEqual(presented, s.pending) {
+		current = s.pending
+	}
+	if err := saveSettingValues(ctx, s.db, map[string]string{agentTokenKey: current, agentPendingTokenKey: next}, nil); err != nil {
+		return err
+	}
+	s.current, s.pending = current, next
+	return nil
+}
+
+// Confirm makes the pending token the agent's only token.
+func (s *AgentTokenService) Confirm(ctx context.Context, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !constantTimeEqual(token, s.pending) {
+		return ErrAgentTokenNotPending
+	}
+	if err := saveSettingValues(ctx, s.db, map[string]string{agentTokenKey: token, agentPendingTokenKey: ""}, nil); err != nil {
+		return err
+	}
+	s.current, s.pending = token, ""
+	return nil
+}
+
+// Clear forgets every token, so the agent has to be paired again before a manager can use it.
+func (s *AgentTokenService) Clear(ctx context.Context) error {
+	return s.Set(ctx, "")
+}
+
+func constantTimeEqual(a, b string) bool {
+	return b != "" && subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ofkm/arcane-backend/internal/config"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/utils"
+)
+
+// startTokenTestAgent serves the agent's token endpoints the way the agent router does. While
+// failConfirm is set, confirmations are refused as if the agent could not be reached.
+func startTokenTestAgent(t *testing.T, tokens *AgentTokenService, failConfirm *atomic.Bool) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	route := func(pattern string, fn func(r *http.Request) error) {
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			if !tokens.Valid(r.Header.Get("X-Arcane-Agent-Token")) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			if err := fn(r); err != nil {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"success": true})
+		})
+	}
+	route("POST /api/environments/0/agent/token", func(r *http.Request) error {
+		var body struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			return err
+		}
+		return tokens.Stage(r.Context(), r.Header.Get("X-Arcane-Agent-Token"), body.Token)
+	})
+	route("POST /api/environments/0/agent/token/confirm", func(r *http.Request) error {
+		if failConfirm.Load() {
+			return ErrAgentTokenNotPending
+		}
+		return tokens.Confirm(r.Context(), r.Header.Get("X-Arcane-Agent-Token"))
+	})
+	route("POST /api/environments/0/agent/unpair", func(r *http.Request) error {
+		return tokens.Clear(r.Context())
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestAgentToken_RotateAndUnpair(t *testing.T) {
+	ctx := context.Background()
+	utils.InitEncryption(&config.Config{})
+
+	managerDB, _ := newAgentTLSTestDB(t, &models.Environment{}, &models.EnvironmentAccess{})
+	envService := NewEnvironmentService(managerDB, nil)
+	tunnels := NewTunnelService(managerDB, envService)
+
+	agentDB, _ := newAgentTLSTestDB(t)
+	tokens := NewAgentTokenService(agentDB)
+	require.NoError(t, tokens.Load(ctx, ""))
+	const original = "original-agent-token-0123456789abcdef"
+	require.NoError(t, tokens.Set(ctx, original))
+
+	var failConfirm atomic.Bool
+	agent := startTokenTestAgent(t, tokens, &failConfirm)
+
+	token := original
+	env, err := envService.CreateEnvironment(ctx, &models.Environment{Name: "edge", ApiUrl: agent.URL, Enabled: true, AccessToken: &token})
+	require.NoError(t, err)
+
+	// The token is encrypted at rest and decrypted on load.
+	var stored models.Environment
+	require.NoError(t, managerDB.Where("id = ?", env.ID).First(&stored).Error)
+	require.NotEqual(t, original, *stored.AccessToken)
+	loaded, err := envService.GetEnvironmentByID(ctx, env.ID)
+	require.NoError(t, err)
+	require.Equal(t, original, *loaded.AccessToken)
+	_, err = tunnels.AuthenticateAgent(ctx, original)
+	require.NoError(t, err)
+
+	require.NoError(t, envService.RotateAgentToken(ctx, env.ID))
+	loaded, err = envService.GetEnvironmentByID(ctx, env.ID)
+	require.NoError(t, err)
+	rotated := *loaded.AccessToken
+	require.NotEqual(t, original, rotated)
+	require.False(t, tokens.Valid(original))
+	require.True(t, tokens.Valid(rotated))
+	require.Equal(t, rotated, tokens.Token())
+	_, err = tunnels.AuthenticateAgent(ctx, original)
+	require.ErrorIs(t, err, ErrTunnelUnauthorized)
+
+	// Until the agent confirms, both sides keep accepting the old token.
+	failConfirm.Store(true)
+	require.Error(t, envService.RotateAgentToken(ctx, env.ID))
+	loaded, err = envService.GetEnvironmentByID(ctx, env.ID)
+	require.NoError(t, err)
+	unconfirmed := *loaded.AccessToken
+	require.True(t, tokens.Valid(rotated))
+	require.True(t, tokens.Valid(unconfirmed))
+	_, err = tunnels.AuthenticateAgent(ctx, rotated)
+	require.NoError(t, err)
+
+	// Rotating again finishes the interrupted rotation.
+	failConfirm.Store(false)
+	require.NoError(t, envService.RotateAgentToken(ctx, env.ID))
+	loaded, err = envService.GetEnvironmentByID(ctx, env.ID)
+	require.NoError(t, err)
+	require.False(t, tokens.Valid(rotated))
+	require.False(t, tokens.Valid(unconfirmed))
+	require.True(t, tokens.Valid(*loaded.AccessToken))
+	_, err = tunnels.AuthenticateAgent(ctx, rotated)
+	require.ErrorIs(t, err, ErrTunnelUnauthorized)
+
+	// The rotated token survives an agent restart and takes precedence over AGENT_TOKEN.
+	restarted := NewAgentTokenService(agentDB)
+	require.NoError(t, restarted.Load(ctx, original))
+	require.Equal(t, *loaded.AccessToken, restarted.Token())
+
+	current := *loaded.AccessToken
+	require.NoError(t, envService.UnpairAgent(ctx, env.ID, false))
+	require.Equal(t, "", tokens.Token())
+	loaded, err = envService.GetEnvironmentByID(ctx, env.ID)
+	require.NoError(t, err)
+	require.Nil(t, loaded.AccessToken)
+	_, err = tunnels.AuthenticateAgent(ctx, current)
+	require.ErrorIs(t, err, ErrTunnelUnauthorized)
+	require.ErrorIs(t, envService.RotateAgentToken(ctx, env.ID), ErrAgentNotPaired)
+}
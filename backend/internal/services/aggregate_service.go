@@ -0,0 +1,389 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/dto"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/utils/pagination"
+)
+
+const (
+	// localEnvironmentID addresses the Docker host the manager itself runs on.
+	localEnvironmentID   = "0"
+	localEnvironmentName = "Local Docker"
+
+	defaultAggregateTimeout = 10 * time.Second
+	aggregateConcurrency    = 8
+	// aggregatePageSize is the most items requested from an environment at once; list endpoints
+	// backed by the database cap their page size at this.
+	aggregatePageSize = 100
+)
+
+// AggregateCaller is the user an aggregated listing is made for. Each environment is listed with
+// the permissions the user holds there.
+type AggregateCaller struct {
+	User        *models.User
+	Permissions []models.Permission
+}
+
+// AggregateOptions narrows an aggregated listing.
+type AggregateOptions struct {
+	// EnvironmentIDs limits the listing to these environments; all accessible ones when empty.
+	EnvironmentIDs []string
+	// Group and Tags limit the listing to environments in Group carrying every one of Tags.
+	Group string
+	Tags  []string
+	// Timeout bounds how long each environment is waited for.
+	Timeout time.Duration
+}
+
+// AggregateResult is one page of an aggregated listing. Environments that could not be listed
+// are reported in Failures and do not count towards the totals.
+type AggregateResult[T any] struct {
+	Items      []dto.EnvironmentItemDto[T]
+	Pagination pagination.Response
+	Failures   []dto.EnvironmentFailureDto
+}
+
+// AggregateService lists resources across every environment a user can access, querying the
+// environments concurrently and merging their results into a single page.
+type AggregateService struct {
+	db                 *database.DB
+	environmentService *EnvironmentService
+	containerService   *ContainerService
+	imageService       *ImageService
+	projectService     *ProjectService
+}
+
+func NewAggregateService(db *database.DB, environmentService *EnvironmentService, containerService *ContainerService, imageService *ImageService, projectService *ProjectService) *AggregateService {
+	return &AggregateService{
+		db:                 db,
+		environmentService: environmentService,
+		containerService:   containerService,
+		imageService:       imageService,
+		projectService:     projectService,
+	}
+}
+
+// aggregateSource lists one kind of resource, locally through its service and remotely through
+// the agent route below /api/environments/0. Docker sources list direct Docker environments
+// through the local service too.
+type aggregateSource[T any] struct {
+	path       string
+	permission models.Permission
+	docker     bool
+	local      func(ctx context.Context, params pagination.QueryParams) ([]T, pagination.Response, error)
+	sorts      []pagination.SortBinding[T]
+}
+
+type aggregateTarget struct {
+	id          string
+	name        string
+	group       string
+	tags        []string
+	apiURL      string
+	accessToken string
+	// direct marks a Docker daemon the manager connects to itself rather than through an agent.
+	direct      bool
+	permissions []models.Permission
+}
+
+// environmentSelector picks targets by ID, group and tags; empty criteria match everything.
+type environmentSelector struct {
+	ids   []string
+	group string
+	tags  []string
+}
+
+func (sel environmentSelector) matches(t aggregateTarget) bool {
+	if len(sel.ids) > 0 && !slices.Contains(sel.ids, t.id) {
+		return false
+	}
+	if sel.group != "" && !strings.EqualFold(sel.group, t.group) {
+		return false
+	}
+	for _, tag := range sel.tags {
+		if !slices.Contains(t.tags, strings.ToLower(tag)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *AggregateService) ListContainers(ctx context.Context, caller AggregateCaller, params pagination.QueryParams, opts AggregateOptions) (*AggregateResult[dto.ContainerSummaryDto], error) {
+	return aggregateList(ctx, s, caller, params, opts, aggregateSource[dto.ContainerSummaryDto]{
+		path:       "/containers",
+		permission: models.PermissionContainersRead,
+		docker:     true,
+		local: func(ctx context.Context, params pagination.QueryParams) ([]dto.ContainerSummaryDto, pagination.Response, error) {
+			return s.containerService.ListContainersPaginated(ctx, params, true)
+		},
+		sorts: containerListConfig().SortBindings,
+	})
+}
+
+func (s *AggregateService) ListImages(ctx context.Context, caller AggregateCaller, params pagination.QueryParams, opts AggregateOptions) (*AggregateResult[dto.ImageSummaryDto], error) {
+	return aggregateList(ctx, s, caller, params, opts, aggregateSource[dto.ImageSummaryDto]{
+		path:       "/images",
+		permission: models.PermissionImagesRead,
+		docker:     true,
+		local:      s.imageService.ListImagesPaginated,
+		sorts:      imageListConfig().SortBindings,
+	})
+}
+
+func (s *AggregateService) ListProjects(ctx context.Context, caller AggregateCaller, params pagination.QueryParams, opts AggregateOptions) (*AggregateResult[dto.ProjectDetailsDto], error) {
+	return aggregateList(ctx, s, caller, params, opts, aggregateSource[dto.ProjectDetailsDto]{
+		path:       "/projects",
+		permission: models.PermissionProjectsRead,
+		local:      s.projectService.ListProjects,
+		sorts:      projectListSortBindings(),
+	})
+}
+
+// aggregateList asks every environment for the first Start+Limit matching items, already
+// searched, filtered and sorted, then sorts the union and cuts the requested page out of it.
+func aggregateList[T any](ctx context.Context, s *AggregateService, caller AggregateCaller, params pagination.QueryParams, opts AggregateOptions, src aggregateSource[T]) (*AggregateResult[T], error) {
+	targets, err := s.targets(ctx, caller, src.permission, environmentSelector{ids: opts.EnvironmentIDs, group: opts.Group, tags: opts.Tags})
+	if err != nil {
+		return nil, err
+	}
+	if !src.docker {
+		targets = slices.DeleteFunc(targets, func(t aggregateTarget) bool { return t.direct })
+	}
+	if params.Limit <= 0 {
+		params.Limit = 20
+	}
+	params.Limit = min(params.Limit, aggregatePageSize)
+	params.Start = max(params.Start, 0)
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultAggregateTimeout
+	}
+
+	type envResult struct {
+		items []T
+		resp  pagination.Response
+		err   error
+	}
+	results := make([]envResult, len(targets))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, aggregateConcurrency)
+	for i, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			envCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			page := src.local
+			switch {
+			case target.direct:
+				page = func(ctx context.Context, params pagination.QueryParams) ([]T, pagination.Response, error) {
+					return src.local(WithDockerEnvironment(ctx, target.id), params)
+				}
+			case target.id != localEnvironmentID:
+				page = func(ctx context.Context, params pagination.QueryParams) ([]T, pagination.Response, error) {
+					return fetchAgentList[T](ctx, s.environmentService, target, caller, src.path, params)
+				}
+			}
+			items, resp, err := fetchWindow(envCtx, page, params, params.Start+params.Limit)
+			if errors.Is(err, context.DeadlineExceeded) || errors.Is(envCtx.Err(), context.DeadlineExceeded) {
+				err = fmt.Errorf("timed out after %s", timeout)
+			}
+			results[i] = envResult{items: items, resp: resp, err: err}
+		}()
+	}
+	wg.Wait()
+
+	out := &AggregateResult[T]{Items: []dto.EnvironmentItemDto[T]{}, Failures: []dto.EnvironmentFailureDto{}}
+	var merged []dto.EnvironmentItemDto[T]
+	var total, grandTotal int64
+	for i, r := range results {
+		if r.err != nil {
+			out.Failures = append(out.Failures, dto.EnvironmentFailureDto{EnvironmentID: targets[i].id, EnvironmentName: targets[i].name, Error: r.err.Error()})
+			continue
+		}
+		for _, item := range r.items {
+			merged = append(merged, dto.EnvironmentItemDto[T]{EnvironmentID: targets[i].id, EnvironmentName: targets[i].name, Item: item})
+		}
+		total += r.resp.TotalItems
+		grandTotal += r.resp.GrandTotalItems
+	}
+
+	// Environments already searched and filtered their items; only the order and the page are left.
+	mergeParams := params
+	mergeParams.Search = ""
+	mergeParams.Filters = nil
+	page := pagination.SearchOrderAndPaginate(merged, mergeParams, pagination.Config[dto.EnvironmentItemDto[T]]{
+		SortBindings: wrapSortBindings(src.sorts),
+	})
+	if page.Items != nil {
+		out.Items = page.Items
+	}
+	out.Pagination = pagination.Response{
+		TotalPages:      (total + int64(params.Limit) - 1) / int64(params.Limit),
+		TotalItems:      total,
+		CurrentPage:     params.Start/params.Limit + 1,
+		ItemsPerPage:    params.Limit,
+		GrandTotalItems: grandTotal,
+	}
+	return out, nil
+}
+
+// targets returns the enabled environments matching sel that the caller may use with permission,
+// each with the permissions the caller holds on it.
+func (s *AggregateService) targets(ctx context.Context, caller AggregateCaller, permission models.Permission, sel environmentSelector) ([]aggregateTarget, error) {
+	var environments []models.Environment
+	if err := s.db.WithContext(ctx).Where("enabled = ?", true).Order("name asc").Find(&environments).Error; err != nil {
+		return nil, fmt.Errorf("failed to list environments: %w", err)
+	}
+
+	candidates := []aggregateTarget{{id: localEnvironmentID, name: localEnvironmentName}}
+	for i := range environments {
+		environment := &environments[i]
+		if err := openAgentToken(environment); err != nil {
+			return nil, err
+		}
+		target := aggregateTarget{
+			id:     environment.ID,
+			name:   environment.Name,
+			tags:   environment.Tags,
+			apiURL: environment.ApiUrl,
+			direct: environment.Type == models.EnvironmentTypeDocker,
+		}
+		if environment.Group != nil {
+			target.group = *environment.Group
+		}
+		if environment.AccessToken != nil {
+			target.accessToken = *environment.AccessToken
+		}
+		candidates = append(candidates, target)
+	}
+
+	var targets []aggregateTarget
+	for _, target := range candidates {
+		if !sel.matches(target) {
+			continue
+		}
+		target.permissions = caller.Permissions
+		if caller.User != nil && !models.HasPermission(caller.Permissions, models.PermissionAll) {
+			level, restricted, err := s.environmentService.ResolveEnvironmentAccess(ctx, target.id, caller.User)
+			if err != nil {
+				return nil, err
+			}
+			if restricted {
+				target.permissions = level.Restrict(caller.Permissions)
+			}
+		}
+		if !models.HasPermission(target.permissions, permission) {
+			continue
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// fetchWindow collects the first window items of a listing, a page at a time.
+func fetchWindow[T any](ctx context.Context, page func(context.Context, pagination.QueryParams) ([]T, pagination.Response, error), params pagination.QueryParams, window int) ([]T, pagination.Response, error) {
+	// Pages keep the same size so that offset-based listings land on whole pages.
+	params.Limit = min(window, aggregatePageSize)
+	var items []T
+	var first pagination.Response
+	for params.Start = 0; ; params.Start += params.Limit {
+		got, resp, err := page(ctx, params)
+		if err != nil {
+			return nil, pagination.Response{}, err
+		}
+		if params.Start == 0 {
+			first = resp
+		}
+		items = append(items, got...)
+		if len(got) < params.Limit || len(items) >= window || int64(len(items)) >= resp.TotalItems {
+			break
+		}
+	}
+	if len(items) > window {
+		items = items[:window]
+	}
+	return items, first, nil
+}
+
+// fetchAgentList requests one page of a listing from a remote environment on behalf of the caller.
+func fetchAgentList[T any](ctx context.Context, environmentService *EnvironmentService, target aggregateTarget, caller AggregateCaller, path string, params pagination.QueryParams) ([]T, pagination.Response, error) {
+	client, baseURL, err := environmentService.AgentHTTPClient(ctx, target.id, target.apiURL, 0)
+	if err != nil {
+		return nil, pagination.Response{}, err
+	}
+	url := baseURL + "/api/environments/" + localEnvironmentID + path + "?" + params.Values().Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, pagination.Response{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header = target.header(caller)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, pagination.Response{}, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, pagination.Response{}, fmt.Errorf("agent returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var envelope struct {
+		Data       []T                 `json:"data"`
+		Pagination pagination.Response `json:"pagination"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return nil, pagination.Response{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return envelope.Data, envelope.Pagination, nil
+}
+
+// header authenticates a request to the target's agent as the caller, with the permissions the
+// caller holds on the environment, the way proxied requests are.
+func (t aggregateTarget) header(caller AggregateCaller) http.Header {
+	header := agentTokenHeader(t.accessToken)
+	if caller.User != nil {
+		perms := make([]string, len(t.permissions))
+		for i, p := range t.permissions {
+			perms[i] = string(p)
+		}
+		header.Set("X-Arcane-Agent-User", caller.User.ID)
+		header.Set("X-Arcane-Agent-Permissions", strings.Join(perms, ","))
+	}
+	return header
+}
+
+func wrapSortBindings[T any](sorts []pagination.SortBinding[T]) []pagination.SortBinding[dto.EnvironmentItemDto[T]] {
+	wrapped := make([]pagination.SortBinding[dto.EnvironmentItemDto[T]], 0, len(sorts)+1)
+	for _, sort := range sorts {
+		fn := sort.Fn
+		wrapped = append(wrapped, pagination.SortBinding[dto.EnvironmentItemDto[T]]{
+			Key: sort.Key,
+			Fn:  func(a, b dto.EnvironmentItemDto[T]) int { return fn(a.Item, b.Item) },
+		})
+	}
+	wrapped = append(wrapped, pagination.SortBinding[dto.EnvironmentItemDto[T]]{
+		Key: "environment",
+		Fn: func(a, b dto.EnvironmentItemDto[T]) int {
+			return strings.Compare(a.EnvironmentName, b.EnvironmentName)
+		},
+	})
+	return wrapped
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ofkm/arcane-backend/internal/config"
+	"github.com/ofkm/arcane-backend/internal/dto"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/utils"
+	"github.com/ofkm/arcane-backend/internal/utils/pagination"
+)
+
+// startListTestAgent serves a container listing the way the agent's container handler does.
+func startListTestAgent(t *testing.T, containers []dto.ContainerSummaryDto, users chan<- string) *httptest.Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/environments/0/containers", func(c *gin.Context) {
+		if users != nil {
+			users <- c.GetHeader("X-Arcane-Agent-User")
+		}
+		params := pagination.ExtractListModifiersQueryParams(c)
+		result := pagination.SearchOrderAndPaginate(append([]dto.ContainerSummaryDto(nil), containers...), params, containerListConfig())
+		c.JSON(http.StatusOK, gin.H{
+			"success":    true,
+			"data":       result.Items,
+			"pagination": pagination.Response{TotalItems: result.TotalCount, GrandTotalItems: result.TotalAvailable},
+		})
+	})
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func testContainer(name, state, status string) dto.ContainerSummaryDto {
+	return dto.ContainerSummaryDto{ID: name, Names: []string{"/" + name}, State: state, Status: status}
+}
+
+func TestAggregateService_ListContainers(t *testing.T) {
+	ctx := context.Background()
+	utils.InitEncryption(&config.Config{})
+
+	db, _ := newAgentTLSTestDB(t, &models.Environment{}, &models.EnvironmentAccess{})
+	envService := NewEnvironmentService(db, nil)
+	// The manager's own Docker host is unreachable, so the local environment fails.
+	docker := NewDockerClientService(db, &config.Config{DockerHost: "unix:///nonexistent/docker.sock"})
+	aggregate := NewAggregateService(db, envService, NewContainerService(db, nil, docker), nil, nil)
+
+	users := make(chan string, 16)
+	alpha := startListTestAgent(t, []dto.ContainerSummaryDto{
+		testContainer("a3", "exited", "Exited (0) 2 hours ago"),
+		testContainer("a1", "running", "Up 2 hours (healthy)"),
+		testContainer("a2", "running", "Up 2 hours (unhealthy)"),
+	}, users)
+	bravo := startListTestAgent(t, []dto.ContainerSummaryDto{
+		testContainer("b2", "running", "Up 5 minutes"),
+		testContainer("b1", "running", "Up 5 minutes (unhealthy)"),
+	}, nil)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	t.Cleanup(slow.Close)
+
+	ids := map[string]string{}
+	for name, url := range map[string]string{"alpha": alpha.URL, "bravo": bravo.URL, "slow": slow.URL} {
+		token := name + "-agent-token"
+		env, err := envService.CreateEnvironment(ctx, &models.Environment{Name: name, ApiUrl: url, Enabled: true, AccessToken: &token})
+		require.NoError(t, err)
+		ids[name] = env.ID
+	}
+
+	caller := AggregateCaller{User: &models.User{BaseModel: models.BaseModel{ID: "user-1"}}, Permissions: []models.Permission{models.PermissionAll}}
+	opts := AggregateOptions{Timeout: 300 * time.Millisecond}
+	names := func(items []dto.EnvironmentItemDto[dto.ContainerSummaryDto]) []string {
+		out := make([]string, 0, len(items))
+		for _, item := range items {
+			out = append(out, item.EnvironmentName+":"+item.Item.Names[0])
+		}
+		return out
+	}
+	query := func(raw string) pagination.QueryParams {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/?"+raw, nil)
+		return pagination.ExtractListModifiersQueryParams(c)
+	}
+
+	result, err := aggregate.ListContainers(ctx, caller, query("sort=name&order=asc&limit=3"), opts)
+	require.NoError(t, err)
+	require.Equal(t, []string{"alpha:/a1", "alpha:/a2", "alpha:/a3"}, names(result.Items))
+	require.EqualValues(t, 5, result.Pagination.TotalItems)
+	require.EqualValues(t, 2, result.Pagination.TotalPages)
+	require.Equal(t, "user-1", <-users)
+
+	failed := map[string]string{}
+	for _, f := range result.Failures {
+		failed[f.EnvironmentID] = f.Error
+	}
+	require.Len(t, failed, 2)
+	require.Contains(t, failed, localEnvironmentID)
+	require.Contains(t, failed[ids["slow"]], "timed out")
+
+	result, err = aggregate.ListContainers(ctx, caller, query("sort=name&order=desc&start=3&limit=3"), opts)
+	require.NoError(t, err)
+	require.Equal(t, []string{"alpha:/a2", "alpha:/a1"}, names(result.Items))
+
+	result, err = aggregate.ListContainers(ctx, caller, query("sort=name&health=unhealthy"), opts)
+	require.NoError(t, err)
+	require.Equal(t, []string{"alpha:/a2", "bravo:/b1"}, names(result.Items))
+	require.EqualValues(t, 2, result.Pagination.TotalItems)
+
+	opts.EnvironmentIDs = []string{ids["bravo"]}
+	result, err = aggregate.ListContainers(ctx, caller, query("search=b2"), opts)
+	require.NoError(t, err)
+	require.Equal(t, []string{"bravo:/b2"}, names(result.Items))
+	require.Empty(t, result.Failures)
+
+	// Environments the caller holds no grant on are left out rather than reported as failures.
+	require.NoError(t, db.Create(&models.EnvironmentAccess{EnvironmentID: ids["bravo"], SubjectType: models.EnvironmentAccessSubjectUser, SubjectID: "someone-else", AccessLevel: models.EnvironmentAccessManage}).Error)
+	restricted := AggregateCaller{User: caller.User, Permissions: []models.Permission{models.PermissionContainersRead}}
+	result, err = aggregate.ListContainers(ctx, restricted, query(""), opts)
+	require.NoError(t, err)
+	require.Empty(t, result.Items)
+	require.Empty(t, result.Failures)
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/dto"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/utils"
+)
+
+const (
+	// ApiTokenPrefix marks personal API tokens so they can be told apart from JWTs.
+	ApiTokenPrefix = "arc_"
+
+	apiTokenSecretLength   = 40
+	apiTokenDisplayLength  = len(ApiTokenPrefix) + 8
+	apiTokenLastUsedWindow = time.Minute
+)
+
+var (
+	ErrApiTokenNotFound = errors.New("api token not found")
+	ErrApiTokenExpired  = errors.New("api token expired")
+)
+
+type ApiTokenService struct {
+	db *database.DB
+}
+
+func NewApiTokenService(db *database.DB) *ApiTokenService {
+	return &ApiTokenService{db: db}
+}
+
+// IsApiToken reports whether a bearer credential looks like a personal API token.
+func IsApiToken(token string) bool {
+	return strings.HasPrefix(token, ApiTokenPrefix)
+}
+
+func hashApiToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *ApiTokenService) CreateToken(ctx context.Context, userID string, req dto.CreateApiTokenDto) (*dto.CreatedApiTokenDto, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, &models.ValidationError{Field: "name", Message: "Token name is required"}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, &models.ValidationError{Field: "expiresAt", Message: "Expiry must be in the future"}
+	}
+
+	scopes, err := validatePermissions(req.Scopes)
+	if err != nil {
+		var validationErr *models.ValidationError
+		if errors.As(err, &validationErr) {
+			validationErr.Field = "scopes"
+		}
+		return nil, err
+	}
+	if len(scopes) == 0 {
+		return nil, &models.ValidationError{Field: "scopes", Message: "At least one scope is required, use \"*\" for all of your permissions"}
+	}
+
+	plain := ApiTokenPrefix + utils.GenerateRandomString(apiTokenSecretLength)
+	token := &models.ApiToken{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    plain[:apiTokenDisplayLength],
+		TokenHash: hashApiToken(plain),
+		Scopes:    scopes,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := s.db.WithContext(ctx).Create(token).Error; err != nil {
+		return nil, fmt.Errorf("failed to create api token: %w", err)
+	}
+
+	return &dto.CreatedApiTokenDto{ApiTokenDto: toApiTokenDto(*token), Token: plain}, nil
+}
+
+func (s *ApiTokenService) ListTokens(ctx context.Context, userID string) ([]dto.ApiTokenDto, error) {
+	var tokens []models.ApiToken
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error; err != nil {
+		return nil, fmt.Errorf("failed to list api tokens: %w", err)
+	}
+
+	out := make([]dto.ApiTokenDto, 0, len(tokens))
+	for _, t := range tokens {
+		out = append(out, toApiTokenDto(t))
+	}
+	return out, nil
+}
+
+func (s *ApiTokenService) RevokeToken(ctx context.Context, userID, tokenID string) error {
+	res := s.db.WithContext(ctx).Delete(&models.ApiToken{}, "id = ? AND user_id = ?", tokenID, userID)
+	if res.Error != nil {
+		return fmt.Errorf("failed to revoke api token: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrApiTokenNotFound
+	}
+	return nil
+}
+
+// Authenticate resolves a plain API token to its owner and scopes, recording when it was used.
+// A token carries the owner's permissions its scopes cover, so one without scopes carries none.
+func (s *ApiTokenService) Authenticate(ctx context.Context, plain string) (*models.User, []models.Permission, error) {
+	var token models.ApiToken
+	if err := s.db.WithContext(ctx).Where("token_hash = ?", hashApiToken(plain)).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidToken
+		}
+		return nil, nil, fmt.Errorf("failed to look up api token: %w", err)
+	}
+
+	now := time.Now()
+	if token.IsExpired(now) {
+		return nil, nil, ErrApiTokenExpired
+	}
+
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("id = ?", token.UserID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidToken
+		}
+		return nil, nil, fmt.Errorf("failed to load api token owner: %w", err)
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > apiTokenLastUsedWindow {
+		if err := s.db.WithContext(ctx).Model(&models.ApiToken{}).
+			Where("id = ?", token.ID).
+			UpdateColumn("last_used_at", now).Error; err != nil {
+			return nil, nil, fmt.Errorf("failed to record api token use: %w", err)
+		}
+	}
+
+	scopes := make([]models.Permission, len(token.Scopes))
+	for i, sc := range token.Scopes {
+		scopes[i] = models.Permission(sc)
+	}
+	return &user, scopes, nil
+}
+
+func toApiTokenDto(t models.ApiToken) dto.ApiTokenDto {
+	scopes := []string(t.Scopes)
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return dto.ApiTokenDto{
+		ID:         t.ID,
+		Name:       t.Name,
+		Prefix:     t.Prefix,
+		Scopes:     scopes,
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+		CreatedAt:  t.CreatedAt,
+	}
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	glsqlite "github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/dto"
+	"github.com/ofkm/arcane-backend/internal/models"
+)
+
+func setupApiTokenTestDB(t *testing.T) *database.DB {
+	t.Helper()
+	db, err := gorm.Open(glsqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.ApiToken{}, &models.User{}))
+	return &database.DB{DB: db}
+}
+
+func TestApiTokenService_CreateAndAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	db := setupApiTokenTestDB(t)
+	svc := NewApiTokenService(db)
+
+	user := &models.User{Username: "ci", Roles: models.StringSlice{models.RoleDeployer}}
+	require.NoError(t, db.Create(user).Error)
+
+	created, err := svc.CreateToken(ctx, user.ID, dto.CreateApiTokenDto{
+		Name:   "ci",
+		Scopes: []string{string(models.PermissionProjectsDeploy)},
+	})
+	require.NoError(t, err)
+	require.True(t, IsApiToken(created.Token))
+	require.Equal(t, created.Token[:len(created.Prefix)], created.Prefix)
+
+	var stored models.ApiToken
+	require.NoError(t, db.First(&stored, "id = ?", created.ID).Error)
+	require.NotEqual(t, created.Token, stored.TokenHash)
+	require.Nil(t, stored.LastUsedAt)
+
+	got, scopes, err := svc.Authenticate(ctx, created.Token)
+	require.NoError(t, err)
+	require.Equal(t, user.ID, got.ID)
+	require.Equal(t, []models.Permission{models.PermissionProjectsDeploy}, scopes)
+
+	require.NoError(t, db.First(&stored, "id = ?", created.ID).Error)
+	require.NotNil(t, stored.LastUsedAt)
+
+	_, _, err = svc.Authenticate(ctx, created.Token+"x")
+	require.ErrorIs(t, err, ErrInvalidToken)
+
+	require.NoError(t, svc.RevokeToken(ctx, user.ID, created.ID))
+	_, _, err = svc.Authenticate(ctx, created.Token)
+	require.ErrorIs(t, err, ErrInvalidToken)
+	require.ErrorIs(t, svc.RevokeToken(ctx, user.ID, created.ID), ErrApiTokenNotFound)
+}
+
+func TestApiTokenService_ExpiredAndInvalidTokens(t *testing.T) {
+	ctx := context.Background()
+	db := setupApiTokenTestDB(t)
+	svc := NewApiTokenService(db)
+
+	user := &models.User{Username: "ci"}
+	require.NoError(t, db.Create(user).Error)
+
+	var validationErr *models.ValidationError
+	_, err := svc.CreateToken(ctx, user.ID, dto.CreateApiTokenDto{Name: "bad", Scopes: []string{"projects:teleport"}})
+	require.ErrorAs(t, err, &validationErr)
+	require.Equal(t, "scopes", validationErr.Field)
+
+	for _, scopes := range [][]string{nil, {}} {
+		validationErr = nil
+		_, err = svc.CreateToken(ctx, user.ID, dto.CreateApiTokenDto{Name: "unscoped", Scopes: scopes})
+		require.ErrorAs(t, err, &validationErr, "a token without scopes is not a token for everything")
+		require.Equal(t, "scopes", validationErr.Field)
+	}
+
+	past := time.Now().Add(-time.Hour)
+	_, err = svc.CreateToken(ctx, user.ID, dto.CreateApiTokenDto{Name: "old", Scopes: []string{"*"}, ExpiresAt: &past})
+	require.ErrorAs(t, err, &validationErr)
+	require.Equal(t, "expiresAt", validationErr.Field)
+
+	created, err := svc.CreateToken(ctx, user.ID, dto.CreateApiTokenDto{Name: "short", Scopes: []string{"*"}})
+	require.NoError(t, err)
+	require.NoError(t, db.Model(&models.ApiToken{}).Where("id = ?", created.ID).Update("expires_at", past).Error)
+
+	_, _, err = svc.Authenticate(ctx, created.Token)
+	require.ErrorIs(t, err, ErrApiTokenExpired)
+}
+
+func TestIntersectPermissions(t *testing.T) {
+	perms := models.IntersectPermissions(models.BuiltinRoles[models.RoleUser], []models.Permission{"projects:*", models.PermissionUsersManage})
+	require.True(t, models.HasPermission(perms, models.PermissionProjectsDeploy))
+	require.False(t, models.HasPermission(perms, models.PermissionContainersRead))
+	require.False(t, models.HasPermission(perms, models.PermissionUsersManage))
+}
@@ -172,6 +172,15 @@ func (s *AppriseService) SendContainerUpdateNotification(ctx context.Context, co
 	return s.SendNotification(ctx, title, body, "text", models.NotificationEventContainerUpdate)
 }
 
+func (s *AppriseService) SendEnvironmentStatusNotification(ctx context.Context, environmentName, previousStatus, status, reason string) error {
+	title := fmt.Sprintf("Environment %s: %s", environmentStatusTitle(status), environmentName)
+	body := fmt.Sprintf("Environment: %s\nPrevious Status: %s\nStatus: %s", environmentName, previousStatus, status)
+	if reason != "" {
+		body += "\nReason: " + reason
+	}
+	return s.SendNotification(ctx, title, body, "text", models.NotificationEventEnvironment)
+}
+
 func (s *AppriseService) SendBatchImageUpdateNotification(ctx context.Context, updates map[string]*dto.ImageUpdateResponse) error {
 	if len(updates) == 0 {
 		return nil
@@ -0,0 +1,367 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/utils/pagination"
+)
+
+const (
+	AuditExportJSONL = "jsonl"
+	AuditExportCSV   = "csv"
+
+	auditBatchSize = 500
+)
+
+// auditGenesisHash is the previous hash of the first entry.
+var auditGenesisHash = strings.Repeat("0", sha256.Size*2)
+
+// auditedEventTypes are the events that are copied into the audit trail when they are logged.
+var auditedEventTypes = map[models.EventType]bool{
+	models.EventTypeUserLogin:        true,
+	models.EventTypeUserLogout:       true,
+	models.EventTypeUserLoginFailed:  true,
+	models.EventTypeUserLocked:       true,
+	models.EventTypeProjectDeploy:    true,
+	models.EventTypeProjectDelete:    true,
+	models.EventTypeContainerDelete:  true,
+	models.EventTypeImageDelete:      true,
+	models.EventTypeVolumeDelete:     true,
+	models.EventTypeNetworkDelete:    true,
+	models.EventTypeSystemPrune:      true,
+	models.EventTypeSystemUpgrade:    true,
+	models.EventTypeSystemAutoUpdate: true,
+}
+
+// AuditRecord describes an action to append to the audit trail. The client IP and user agent are
+// taken from the context.
+type AuditRecord struct {
+	Action        string
+	ActorID       string
+	ActorUsername string
+	ResourceType  string
+	ResourceID    string
+	ResourceName  string
+	EnvironmentID string
+	Metadata      models.JSON
+}
+
+// AuditVerification is the result of walking the whole chain. HeadHash can be stored outside
+// Arcane to also detect entries removed from the end of the trail.
+type AuditVerification struct {
+	Valid        bool      `json:"valid"`
+	Entries      int64     `json:"entries"`
+	HeadSequence int64     `json:"headSequence"`
+	HeadHash     string    `json:"headHash"`
+	BrokenAt     *int64    `json:"brokenAt,omitempty"`
+	Reason       string    `json:"reason,omitempty"`
+	VerifiedAt   time.Time `json:"verifiedAt"`
+}
+
+type AuditService struct {
+	db *database.DB
+	// mu serialises appends so each entry links to the one written before it.
+	mu sync.Mutex
+}
+
+// NewAuditService creates the audit trail and registers it with eventService so audited event
+// types are recorded as they are logged.
+func NewAuditService(db *database.DB, eventService *EventService) *AuditService {
+	s := &AuditService{db: db}
+	if eventService != nil {
+		eventService.audit = s
+	}
+	return s
+}
+
+// Record appends an entry to the audit trail.
+func (s *AuditService) Record(ctx context.Context, rec AuditRecord) (*models.AuditEntry, error) {
+	info := clientInfoFromContext(ctx)
+	entry := &models.AuditEntry{
+		ID:            uuid.New().String(),
+		Timestamp:     time.Now().UTC().Truncate(time.Microsecond),
+		Action:        rec.Action,
+		ActorID:       optionalString(rec.ActorID),
+		ActorUsername: optionalString(rec.ActorUsername),
+		IPAddress:     info.IPAddress,
+		UserAgent:     info.UserAgent,
+		ResourceType:  optionalString(rec.ResourceType),
+		ResourceID:    optionalString(rec.ResourceID),
+		ResourceName:  optionalString(rec.ResourceName),
+		EnvironmentID: optionalString(rec.EnvironmentID),
+		Metadata:      rec.Metadata,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var last []models.AuditEntry
+		if err := tx.Order("sequence DESC").Limit(1).Find(&last).Error; err != nil {
+			return err
+		}
+		entry.Sequence = 1
+		entry.PrevHash = auditGenesisHash
+		if len(last) > 0 {
+			entry.Sequence = last[0].Sequence + 1
+			entry.PrevHash = last[0].Hash
+		}
+
+		hash, err := auditEntryHash(entry)
+		if err != nil {
+			return err
+		}
+		entry.Hash = hash
+		return tx.Create(entry).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	return entry, nil
+}
+
+// recordEvent copies an audited event into the trail. Failures are logged rather than returned so
+// the action that raised the event is not affected.
+func (s *AuditService) recordEvent(ctx context.Context, event *models.Event) {
+	if !auditedEventTypes[event.Type] {
+		return
+	}
+	rec := AuditRecord{
+		Action:        string(event.Type),
+		ActorID:       stringPtrValue(event.UserID),
+		ActorUsername: stringPtrValue(event.Username),
+		ResourceType:  stringPtrValue(event.ResourceType),
+		ResourceID:    stringPtrValue(event.ResourceID),
+		ResourceName:  stringPtrValue(event.ResourceName),
+		EnvironmentID: stringPtrValue(event.EnvironmentID),
+		Metadata:      event.Metadata,
+	}
+	if _, err := s.Record(ctx, rec); err != nil {
+		slog.ErrorContext(ctx, "Failed to record audit entry", "action", rec.Action, "error", err)
+	}
+}
+
+func (s *AuditService) ListEntriesPaginated(ctx context.Context, params pagination.QueryParams) ([]models.AuditEntry, pagination.Response, error) {
+	var entries []models.AuditEntry
+	q := s.db.WithContext(ctx).Model(&models.AuditEntry{}).Order("sequence DESC")
+
+	if term := strings.TrimSpace(params.Search); term != "" {
+		searchPattern := "%" + term + "%"
+		q = q.Where(
+			"action LIKE ? OR COALESCE(actor_username, '') LIKE ? OR COALESCE(resource_name, '') LIKE ? OR ip_address LIKE ?",
+			searchPattern, searchPattern, searchPattern, searchPattern,
+		)
+	}
+	if action := params.Filters["action"]; action != "" {
+		q = q.Where("action = ?", action)
+	}
+	if actor := params.Filters["actorUsername"]; actor != "" {
+		q = q.Where("actor_username = ?", actor)
+	}
+	if resourceType := params.Filters["resourceType"]; resourceType != "" {
+		q = q.Where("resource_type = ?", resourceType)
+	}
+	if environmentID := params.Filters["environmentId"]; environmentID != "" {
+		q = q.Where("environment_id = ?", environmentID)
+	}
+
+	paginationResp, err := pagination.PaginateAndSortDB(params, q, &entries)
+	if err != nil {
+		return nil, pagination.Response{}, fmt.Errorf("failed to paginate audit entries: %w", err)
+	}
+	return entries, paginationResp, nil
+}
+
+// Verify recomputes every hash in sequence order and reports the first entry where the chain
+// does not hold.
+func (s *AuditService) Verify(ctx context.Context) (*AuditVerification, error) {
+	result := &AuditVerification{Valid: true, HeadHash: auditGenesisHash}
+	fail := func(seq int64, reason string) {
+		result.Valid = false
+		result.BrokenAt = &seq
+		result.Reason = reason
+	}
+
+	expected := int64(1)
+	prev := auditGenesisHash
+	err := s.forEachEntry(ctx, func(entry *models.AuditEntry) error {
+		result.Entries++
+		switch {
+		case entry.Sequence != expected:
+			fail(expected, fmt.Sprintf("entry %d is missing", expected))
+		case entry.PrevHash != prev:
+			fail(entry.Sequence, "previous hash does not match")
+		default:
+			hash, err := auditEntryHash(entry)
+			if err != nil {
+				return err
+			}
+			if hash != entry.Hash {
+				fail(entry.Sequence, "entry was modified")
+			}
+		}
+		if !result.Valid {
+			return errStopIteration
+		}
+		expected = entry.Sequence + 1
+		prev = entry.Hash
+		result.HeadSequence = entry.Sequence
+		result.HeadHash = entry.Hash
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.VerifiedAt = time.Now()
+	return result, nil
+}
+
+// Export writes the whole trail in sequence order as JSON Lines or CSV. Both formats include
+// the hashes, so an export can be verified independently.
+func (s *AuditService) Export(ctx context.Context, w io.Writer, format string) error {
+	switch format {
+	case AuditExportJSONL:
+		enc := json.NewEncoder(w)
+		return s.forEachEntry(ctx, func(entry *models.AuditEntry) error {
+			return enc.Encode(entry)
+		})
+	case AuditExportCSV:
+		cw := csv.NewWriter(w)
+		header := []string{
+			"sequence", "timestamp", "action", "actorId", "actorUsername", "ipAddress", "userAgent",
+			"resourceType", "resourceId", "resourceName", "environmentId", "metadata", "prevHash", "hash", "id",
+		}
+		if err := cw.Write(header); err != nil {
+			return err
+		}
+		err := s.forEachEntry(ctx, func(entry *models.AuditEntry) error {
+			metadata := ""
+			if entry.Metadata != nil {
+				b, err := json.Marshal(entry.Metadata)
+				if err != nil {
+					return err
+				}
+				metadata = string(b)
+			}
+			return cw.Write([]string{
+				strconv.FormatInt(entry.Sequence, 10),
+				entry.Timestamp.UTC().Format(time.RFC3339Nano),
+				entry.Action,
+				stringPtrValue(entry.ActorID),
+				stringPtrValue(entry.ActorUsername),
+				entry.IPAddress,
+				entry.UserAgent,
+				stringPtrValue(entry.ResourceType),
+				stringPtrValue(entry.ResourceID),
+				stringPtrValue(entry.ResourceName),
+				stringPtrValue(entry.EnvironmentID),
+				metadata,
+				entry.PrevHash,
+				entry.Hash,
+				entry.ID,
+			})
+		})
+		if err != nil {
+			return err
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return &models.ValidationError{Field: "format", Message: fmt.Sprintf("Unknown export format '%s'", format)}
+	}
+}
+
+var errStopIteration = errors.New("stop iteration")
+
+// optionalString maps an empty string to nil for nullable columns.
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// forEachEntry calls fn for every entry in sequence order, loading them in batches.
+func (s *AuditService) forEachEntry(ctx context.Context, fn func(*models.AuditEntry) error) error {
+	after := int64(-1)
+	for {
+		var batch []models.AuditEntry
+		if err := s.db.WithContext(ctx).
+			Where("sequence > ?", after).
+			Order("sequence ASC").
+			Limit(auditBatchSize).
+			Find(&batch).Error; err != nil {
+			return fmt.Errorf("failed to load audit entries: %w", err)
+		}
+		for i := range batch {
+			if err := fn(&batch[i]); err != nil {
+				if errors.Is(err, errStopIteration) {
+					return nil
+				}
+				return err
+			}
+		}
+		if len(batch) < auditBatchSize {
+			return nil
+		}
+		after = batch[len(batch)-1].Sequence
+	}
+}
+
+// auditEntryHash hashes every field of entry except Hash itself. Timestamps are hashed in UTC
+// with microsecond precision, which every supported database round-trips unchanged.
+func auditEntryHash(entry *models.AuditEntry) (string, error) {
+	payload, err := json.Marshal(struct {
+		ID            string      `json:"id"`
+		Sequence      int64       `json:"sequence"`
+		Timestamp     string      `json:"timestamp"`
+		Action        string      `json:"action"`
+		ActorID       *string     `json:"actorId"`
+		ActorUsername *string     `json:"actorUsername"`
+		IPAddress     string      `json:"ipAddress"`
+		UserAgent     string      `json:"userAgent"`
+		ResourceType  *string     `json:"resourceType"`
+		ResourceID    *string     `json:"resourceId"`
+		ResourceName  *string     `json:"resourceName"`
+		EnvironmentID *string     `json:"environmentId"`
+		Metadata      models.JSON `json:"metadata"`
+		PrevHash      string      `json:"prevHash"`
+	}{
+		ID:            entry.ID,
+		Sequence:      entry.Sequence,
+		Timestamp:     entry.Timestamp.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano),
+		Action:        entry.Action,
+		ActorID:       entry.ActorID,
+		ActorUsername: entry.ActorUsername,
+		IPAddress:     entry.IPAddress,
+		UserAgent:     entry.UserAgent,
+		ResourceType:  entry.ResourceType,
+		ResourceID:    entry.ResourceID,
+		ResourceName:  entry.ResourceName,
+		EnvironmentID: entry.EnvironmentID,
+		Metadata:      entry.Metadata,
+		PrevHash:      entry.PrevHash,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
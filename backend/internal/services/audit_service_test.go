@@ -0,0 +1,109 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	glsqlite "github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/resources"
+)
+
+func setupAuditTest(t *testing.T) (*AuditService, *EventService, *database.DB) {
+	t.Helper()
+	gdb, err := gorm.Open(glsqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, gdb.AutoMigrate(&models.Event{}))
+	// Use the real migration so the append-only triggers are in place.
+	migration, err := resources.FS.ReadFile("migrations/sqlite/033_add_audit_log.up.sql")
+	require.NoError(t, err)
+	require.NoError(t, gdb.Exec(string(migration)).Error)
+	db := &database.DB{DB: gdb}
+
+	eventService := NewEventService(db)
+	return NewAuditService(db, eventService), eventService, db
+}
+
+func TestAuditService_RecordsChainAndVerifies(t *testing.T) {
+	audit, events, _ := setupAuditTest(t)
+	ctx := WithClientInfo(context.Background(), ClientInfo{IPAddress: "203.0.113.9", UserAgent: "curl/8"})
+
+	require.NoError(t, events.LogUserEvent(ctx, models.EventTypeUserLogin, "u1", "alice", models.JSON{"method": "local"}))
+	// Events that are not security relevant stay out of the trail.
+	require.NoError(t, events.LogContainerEvent(ctx, models.EventTypeContainerStart, "c1", "web", "u1", "alice", "0", nil))
+	_, err := audit.Record(ctx, AuditRecord{Action: "settings.update", ActorID: "u1", ActorUsername: "alice", Metadata: models.JSON{"keys": []string{"authLocalEnabled"}}})
+	require.NoError(t, err)
+	require.NoError(t, events.LogProjectEvent(ctx, models.EventTypeProjectDeploy, "p1", "stack", "u1", "alice", "0", nil))
+
+	result, err := audit.Verify(ctx)
+	require.NoError(t, err)
+	require.True(t, result.Valid)
+	require.EqualValues(t, 3, result.Entries)
+	require.EqualValues(t, 3, result.HeadSequence)
+
+	var entries []models.AuditEntry
+	var jsonl bytes.Buffer
+	require.NoError(t, audit.Export(ctx, &jsonl, AuditExportJSONL))
+	for _, line := range strings.Split(strings.TrimSpace(jsonl.String()), "\n") {
+		var entry models.AuditEntry
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		entries = append(entries, entry)
+	}
+	require.Len(t, entries, 3)
+	require.Equal(t, []string{"user.login", "settings.update", "project.deploy"}, []string{entries[0].Action, entries[1].Action, entries[2].Action})
+	require.Equal(t, auditGenesisHash, entries[0].PrevHash)
+	require.Equal(t, entries[0].Hash, entries[1].PrevHash)
+	require.Equal(t, "203.0.113.9", entries[0].IPAddress)
+	require.Equal(t, result.HeadHash, entries[2].Hash)
+
+	var csvOut bytes.Buffer
+	require.NoError(t, audit.Export(ctx, &csvOut, AuditExportCSV))
+	rows, err := csv.NewReader(&csvOut).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 4)
+	require.Equal(t, "sequence", rows[0][0])
+	require.Equal(t, "settings.update", rows[2][2])
+
+	var validationErr *models.ValidationError
+	require.ErrorAs(t, audit.Export(ctx, &bytes.Buffer{}, "xml"), &validationErr)
+}
+
+func TestAuditService_DetectsTampering(t *testing.T) {
+	audit, _, db := setupAuditTest(t)
+	ctx := context.Background()
+
+	for _, action := range []string{"user.login", "settings.update", "user.delete"} {
+		_, err := audit.Record(ctx, AuditRecord{Action: action, ActorUsername: "bob"})
+		require.NoError(t, err)
+	}
+
+	// The database itself refuses to change history.
+	require.Error(t, db.Exec("UPDATE audit_log SET actor_username = 'mallory' WHERE sequence = 2").Error)
+	require.Error(t, db.Exec("DELETE FROM audit_log WHERE sequence = 2").Error)
+
+	// Someone with direct database access can drop the triggers, but verification notices.
+	require.NoError(t, db.Exec("DROP TRIGGER audit_log_no_update").Error)
+	require.NoError(t, db.Exec("DROP TRIGGER audit_log_no_delete").Error)
+	require.NoError(t, db.Exec("UPDATE audit_log SET actor_username = 'mallory' WHERE sequence = 2").Error)
+
+	result, err := audit.Verify(ctx)
+	require.NoError(t, err)
+	require.False(t, result.Valid)
+	require.EqualValues(t, 2, *result.BrokenAt)
+	require.Equal(t, "entry was modified", result.Reason)
+
+	require.NoError(t, db.Exec("DELETE FROM audit_log WHERE sequence = 2").Error)
+	result, err = audit.Verify(ctx)
+	require.NoError(t, err)
+	require.False(t, result.Valid)
+	require.EqualValues(t, 2, *result.BrokenAt)
+	require.Equal(t, "entry 2 is missing", result.Reason)
+}
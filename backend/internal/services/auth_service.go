@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"strings"
 	"time"
 
@@ -25,12 +26,41 @@ var (
 	ErrTokenVersionMismatch = errors.New("token version mismatch")
 	ErrLocalAuthDisabled    = errors.New("local authentication is disabled")
 	ErrOidcAuthDisabled     = errors.New("OIDC authentication is disabled")
+	ErrUsernameTaken        = errors.New("username is already used by another account")
+	ErrTwoFactorRequired    = errors.New("two-factor authentication required")
 )
 
+const (
+	twoFactorChallengeSubject       = "2fa"
+	twoFactorEnrollChallengeSubject = "2fa-enroll"
+	twoFactorChallengeExpiry        = 5 * time.Minute
+)
+
+// Second factors a TwoFactorChallenge can be answered with.
+const (
+	TwoFactorMethodTotp     = "totp"
+	TwoFactorMethodWebauthn = "webauthn"
+)
+
+// TwoFactorChallenge is returned by Login instead of tokens when the password was correct but a
+// second factor is still needed. Token is a short-lived JWT identifying the pending login.
+type TwoFactorChallenge struct {
+	Token string
+	// EnrollmentRequired is set when 2FA is mandatory and the user has not enrolled yet.
+	EnrollmentRequired bool
+	// Methods lists the second factors the user has set up.
+	Methods []string
+}
+
+func (c *TwoFactorChallenge) Error() string { return ErrTwoFactorRequired.Error() }
+
+func (c *TwoFactorChallenge) Unwrap() error { return ErrTwoFactorRequired }
+
 type TokenPair struct {
-	AccessToken  string    `json:"accessToken"`
-	RefreshToken string    `json:"refreshToken"`
-	ExpiresAt    time.Time `json:"expiresAt"`
+	AccessToken      string    `json:"accessToken"`
+	RefreshToken     string    `json:"refreshToken"`
+	ExpiresAt        time.Time `json:"expiresAt"`
+	RefreshExpiresAt time.Time `json:"-"`
 }
 
 type AuthSettings struct {
@@ -48,25 +78,49 @@ type UserClaims struct {
 	DisplayName string   `json:"display_name,omitempty"`
 	Roles       []string `json:"roles"`
 	AppVersion  string   `json:"app_version,omitempty"`
+	SessionID   string   `json:"sid,omitempty"`
+}
+
+// RefreshClaims identify the session a refresh token belongs to; ID remains the user ID.
+type RefreshClaims struct {
+	jwt.RegisteredClaims
+	SessionID string `json:"sid,omitempty"`
+}
+
+// oidcUserInfoRefresher re-reads an OIDC user's claims with their provider refresh token. It is
+// implemented by OidcService, which registers itself on construction.
+type oidcUserInfoRefresher interface {
+	RefreshUserInfo(ctx context.Context, refreshToken string) (*dto.OidcUserInfo, *dto.OidcTokenResponse, error)
 }
 
 type AuthService struct {
-	userService     *UserService
-	settingsService *SettingsService
-	eventService    *EventService
-	jwtSecret       []byte
-	refreshExpiry   time.Duration
-	config          *config.Config
+	userService      *UserService
+	settingsService  *SettingsService
+	eventService     *EventService
+	twoFactorService *TwoFactorService
+	webauthnService  *WebauthnService
+	sessionService   *SessionService
+	loginThrottle    *LoginThrottleService
+	ldapService      *LdapService
+	oidcRefresher    oidcUserInfoRefresher
+	jwtKeys          *JwtKeyService
+	refreshExpiry    time.Duration
+	config           *config.Config
 }
 
-func NewAuthService(userService *UserService, settingsService *SettingsService, eventService *EventService, jwtSecret string, cfg *config.Config) *AuthService {
+func NewAuthService(userService *UserService, settingsService *SettingsService, eventService *EventService, twoFactorService *TwoFactorService, webauthnService *WebauthnService, sessionService *SessionService, loginThrottle *LoginThrottleService, ldapService *LdapService, jwtKeys *JwtKeyService, cfg *config.Config) *AuthService {
 	return &AuthService{
-		userService:     userService,
-		settingsService: settingsService,
-		eventService:    eventService,
-		jwtSecret:       utils.CheckOrGenerateJwtSecret(jwtSecret),
-		refreshExpiry:   7 * 24 * time.Hour,
-		config:          cfg,
+		userService:      userService,
+		settingsService:  settingsService,
+		eventService:     eventService,
+		twoFactorService: twoFactorService,
+		webauthnService:  webauthnService,
+		sessionService:   sessionService,
+		loginThrottle:    loginThrottle,
+		ldapService:      ldapService,
+		jwtKeys:          jwtKeys,
+		refreshExpiry:    7 * 24 * time.Hour,
+		config:           cfg,
 	}
 }
 
@@ -177,15 +231,30 @@ func (s *AuthService) Login(ctx context.Context, username, password string) (*mo
 		return nil, nil, ErrLocalAuthDisabled
 	}
 
+	ip := clientInfoFromContext(ctx).IPAddress
+	if s.loginThrottle != nil {
+		if err := s.loginThrottle.CheckIP(ip); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	user, err := s.userService.GetUserByUsername(ctx, username)
 	if err != nil {
 		if strings.Contains(err.Error(), "user not found") {
+			s.recordLoginFailure(ctx, username, nil, "unknown_user")
 			return nil, nil, ErrInvalidCredentials
 		}
 		return nil, nil, err
 	}
 
+	if s.loginThrottle != nil {
+		if err := s.loginThrottle.CheckUser(user); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	if err := s.userService.ValidatePassword(user.PasswordHash, password); err != nil {
+		s.recordLoginFailure(ctx, username, user, "invalid_password")
 		return nil, nil, ErrInvalidCredentials
 	}
 
@@ -197,20 +266,193 @@ func (s *AuthService) Login(ctx context.Context, username, password string) (*mo
 		}
 	}
 
+	return s.completePasswordLogin(ctx, user, "local")
+}
+
+// completePasswordLogin asks for a second factor when the user has one or 2FA is required, and
+// otherwise issues tokens.
+func (s *AuthService) completePasswordLogin(ctx context.Context, user *models.User, method string) (*models.User, *TokenPair, error) {
+	if s.twoFactorService != nil {
+		methods := s.twoFactorMethods(ctx, user)
+		if len(methods) > 0 || s.twoFactorService.IsRequired(ctx) {
+			subject := twoFactorChallengeSubject
+			if len(methods) == 0 {
+				subject = twoFactorEnrollChallengeSubject
+			}
+			challenge, err := s.generateTwoFactorChallenge(ctx, user, subject)
+			if err != nil {
+				return nil, nil, err
+			}
+			return user, nil, &TwoFactorChallenge{Token: challenge, EnrollmentRequired: len(methods) == 0, Methods: methods}
+		}
+	}
+
+	return s.completeLocalLogin(ctx, user, method)
+}
+
+// LdapLogin authenticates against the configured directory and signs in the matching Arcane
+// user, creating it on first login.
+func (s *AuthService) LdapLogin(ctx context.Context, username, password string) (*models.User, *TokenPair, error) {
+	if s.ldapService == nil {
+		return nil, nil, ErrLdapAuthDisabled
+	}
+
+	// Known directory users are checked for a lockout before their password reaches the
+	// directory, so Arcane does not also trip the directory's own lockout policy.
+	var known *models.User
+	if u, err := s.userService.GetUserByUsername(ctx, username); err == nil && u.LdapId != nil {
+		known = u
+	}
+	if s.loginThrottle != nil {
+		if err := s.loginThrottle.CheckIP(clientInfoFromContext(ctx).IPAddress); err != nil {
+			return nil, nil, err
+		}
+		if err := s.loginThrottle.CheckUser(known); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	ldapUser, err := s.ldapService.Authenticate(ctx, username, password)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			s.recordLoginFailure(ctx, username, known, "ldap_invalid_credentials")
+		} else {
+			slog.ErrorContext(ctx, "LDAP login failed", "username", username, "error", err)
+		}
+		return nil, nil, err
+	}
+
+	user, isNewUser, err := s.findOrCreateLdapUser(ctx, ldapUser)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if s.loginThrottle != nil {
+		if err := s.loginThrottle.CheckUser(user); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if isNewUser {
+		slog.InfoContext(ctx, "Provisioned LDAP user", "username", user.Username, "dn", ldapUser.DN)
+	}
+	return s.completePasswordLogin(ctx, user, "ldap")
+}
+
+func (s *AuthService) findOrCreateLdapUser(ctx context.Context, ldapUser *LdapUser) (*models.User, bool, error) {
+	cfg, err := s.ldapService.GetConfig(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	user, err := s.userService.GetUserByLdapId(ctx, ldapUser.ID)
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		return nil, false, err
+	}
+
+	if user == nil {
+		created, err := s.createLdapUser(ctx, cfg, ldapUser)
+		if err != nil {
+			return nil, false, err
+		}
+		return created, true, nil
+	}
+
+	if err := s.updateLdapUser(ctx, cfg, user, ldapUser); err != nil {
+		return nil, false, err
+	}
+	return user, false, nil
+}
+
+func (s *AuthService) createLdapUser(ctx context.Context, cfg *models.LdapConfig, ldapUser *LdapUser) (*models.User, error) {
+	// Never attach a directory identity to an existing local or OIDC account by username alone.
+	if _, err := s.userService.GetUserByUsername(ctx, ldapUser.Username); err == nil {
+		return nil, ErrUsernameTaken
+	}
+
+	displayName := ldapUser.DisplayName
+	if displayName == "" {
+		displayName = ldapUser.Username
+	}
+
+	user := &models.User{
+		BaseModel:   models.BaseModel{ID: uuid.NewString()},
+		Username:    ldapUser.Username,
+		DisplayName: &displayName,
+		Roles:       s.ldapService.MapRoles(cfg, nil, ldapUser.Groups),
+		LdapId:      &ldapUser.ID,
+	}
+	if ldapUser.Email != "" {
+		user.Email = &ldapUser.Email
+	}
+
+	if _, err := s.userService.CreateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *AuthService) updateLdapUser(ctx context.Context, cfg *models.LdapConfig, user *models.User, ldapUser *LdapUser) error {
+	if ldapUser.DisplayName != "" {
+		user.DisplayName = &ldapUser.DisplayName
+	}
+	if ldapUser.Email != "" {
+		user.Email = &ldapUser.Email
+	}
+
+	previousRoles := user.Roles
+	user.Roles = s.ldapService.MapRoles(cfg, user.Roles, ldapUser.Groups)
+	if _, err := s.userService.UpdateUser(ctx, user); err != nil {
+		return err
+	}
+
+	if RolesRemoved(previousRoles, user.Roles) {
+		return s.RevokeUserSessions(ctx, user, "", "roles_removed")
+	}
+	return nil
+}
+
+// twoFactorMethods returns the second factors the user can complete a login with. A registered
+// passkey counts as a second factor on its own.
+func (s *AuthService) twoFactorMethods(ctx context.Context, user *models.User) []string {
+	var methods []string
+	if user.TotpEnabled {
+		methods = append(methods, TwoFactorMethodTotp)
+	}
+	if s.webauthnService != nil && s.webauthnService.HasCredentials(ctx, user.ID) {
+		methods = append(methods, TwoFactorMethodWebauthn)
+	}
+	return methods
+}
+
+// recordLoginFailure counts a failed local login towards the account and client IP limits.
+func (s *AuthService) recordLoginFailure(ctx context.Context, username string, user *models.User, reason string) {
+	if s.loginThrottle == nil {
+		return
+	}
+	s.loginThrottle.RecordFailure(ctx, clientInfoFromContext(ctx).IPAddress, username, user, reason)
+}
+
+// completeLocalLogin issues tokens once every required factor has been verified.
+func (s *AuthService) completeLocalLogin(ctx context.Context, user *models.User, method string) (*models.User, *TokenPair, error) {
+	if s.loginThrottle != nil {
+		s.loginThrottle.RecordSuccess(ctx, user)
+	}
+
 	now := time.Now()
 	user.LastLogin = &now
 	if _, err := s.userService.UpdateUser(ctx, user); err != nil {
 		fmt.Printf("Failed to update user's last login time: %v\n", err)
 	}
 
-	tokenPair, err := s.generateTokenPair(ctx, user)
+	tokenPair, err := s.startSession(ctx, user, method)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	metadata := models.JSON{
 		"action": "login",
-		"method": "local",
+		"method": method,
 	}
 	if logErr := s.eventService.LogUserEvent(ctx, models.EventTypeUserLogin, user.ID, user.Username, metadata); logErr != nil {
 		fmt.Printf("Could not log user login action: %s\n", logErr)
@@ -219,6 +461,179 @@ func (s *AuthService) Login(ctx context.Context, username, password string) (*mo
 	return user, tokenPair, nil
 }
 
+// CompleteTwoFactorLogin finishes a login started by Login once the TOTP or recovery code checks out.
+func (s *AuthService) CompleteTwoFactorLogin(ctx context.Context, challengeToken, code string) (*models.User, *TokenPair, error) {
+	user, err := s.userFromTwoFactorChallenge(ctx, challengeToken, twoFactorChallengeSubject)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if s.loginThrottle != nil {
+		if err := s.loginThrottle.CheckUser(user); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := s.twoFactorService.Verify(ctx, user.ID, code); err != nil {
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			s.recordLoginFailure(ctx, user.Username, user, "invalid_totp")
+		}
+		return nil, nil, err
+	}
+
+	// Reload so saving the last login does not overwrite the 2FA state Verify just updated.
+	user, err = s.userService.GetUserByID(ctx, user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.completeLocalLogin(ctx, user, "local+totp")
+}
+
+// BeginWebauthnTwoFactorLogin returns assertion options for answering a login challenge with a passkey.
+func (s *AuthService) BeginWebauthnTwoFactorLogin(ctx context.Context, challengeToken string) (*dto.WebauthnRequestOptionsDto, error) {
+	user, err := s.userFromTwoFactorChallenge(ctx, challengeToken, twoFactorChallengeSubject)
+	if err != nil {
+		return nil, err
+	}
+	if s.webauthnService == nil {
+		return nil, ErrWebauthnCredentialNotFound
+	}
+	return s.webauthnService.BeginSecondFactor(ctx, user.ID)
+}
+
+// CompleteWebauthnTwoFactorLogin finishes a login started by Login with a passkey assertion.
+func (s *AuthService) CompleteWebauthnTwoFactorLogin(ctx context.Context, challengeToken string, credential dto.WebauthnAssertionCredentialDto) (*models.User, *TokenPair, error) {
+	user, err := s.userFromTwoFactorChallenge(ctx, challengeToken, twoFactorChallengeSubject)
+	if err != nil {
+		return nil, nil, err
+	}
+	if s.webauthnService == nil {
+		return nil, nil, ErrWebauthnVerificationFailed
+	}
+
+	if s.loginThrottle != nil {
+		if err := s.loginThrottle.CheckUser(user); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := s.webauthnService.VerifySecondFactor(ctx, user.ID, credential); err != nil {
+		if errors.Is(err, ErrWebauthnVerificationFailed) {
+			s.recordLoginFailure(ctx, user.Username, user, "invalid_passkey")
+		}
+		return nil, nil, err
+	}
+	return s.completeLocalLogin(ctx, user, "local+webauthn")
+}
+
+// WebauthnLogin signs a user in with a user-verified passkey, without a password or further factor.
+func (s *AuthService) WebauthnLogin(ctx context.Context, credential dto.WebauthnAssertionCredentialDto) (*models.User, *TokenPair, error) {
+	localEnabled, err := s.IsLocalAuthEnabled(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !localEnabled {
+		return nil, nil, ErrLocalAuthDisabled
+	}
+	if s.webauthnService == nil {
+		return nil, nil, ErrWebauthnVerificationFailed
+	}
+
+	if s.loginThrottle != nil {
+		if err := s.loginThrottle.CheckIP(clientInfoFromContext(ctx).IPAddress); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	user, err := s.webauthnService.FinishLogin(ctx, credential)
+	if err != nil {
+		// A failed assertion does not tell which account it was meant for, since anyone can name
+		// another user's credential, so it only counts against the client IP.
+		if errors.Is(err, ErrWebauthnVerificationFailed) {
+			s.recordLoginFailure(ctx, "", nil, "invalid_passkey")
+		}
+		return nil, nil, err
+	}
+
+	if s.loginThrottle != nil {
+		if err := s.loginThrottle.CheckUser(user); err != nil {
+			return nil, nil, err
+		}
+	}
+	return s.completeLocalLogin(ctx, user, "webauthn")
+}
+
+// BeginTwoFactorEnrollmentForLogin starts enrollment for a user whose login is blocked because
+// 2FA is mandatory and they have not set it up yet.
+func (s *AuthService) BeginTwoFactorEnrollmentForLogin(ctx context.Context, challengeToken string) (*dto.TwoFactorEnrollmentDto, error) {
+	user, err := s.userFromTwoFactorChallenge(ctx, challengeToken, twoFactorEnrollChallengeSubject)
+	if err != nil {
+		return nil, err
+	}
+	return s.twoFactorService.BeginEnrollment(ctx, user.ID)
+}
+
+// ConfirmTwoFactorEnrollmentForLogin enables 2FA and completes the pending login.
+func (s *AuthService) ConfirmTwoFactorEnrollmentForLogin(ctx context.Context, challengeToken, code string) (*models.User, *TokenPair, []string, error) {
+	user, err := s.userFromTwoFactorChallenge(ctx, challengeToken, twoFactorEnrollChallengeSubject)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	recoveryCodes, err := s.twoFactorService.ConfirmEnrollment(ctx, user.ID, code)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	user, err = s.userService.GetUserByID(ctx, user.ID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	user, tokenPair, err := s.completeLocalLogin(ctx, user, "local+totp")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return user, tokenPair, recoveryCodes, nil
+}
+
+func (s *AuthService) generateTwoFactorChallenge(ctx context.Context, user *models.User, subject string) (string, error) {
+	return s.signToken(ctx, jwt.RegisteredClaims{
+		ID:        user.ID,
+		Subject:   subject,
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(twoFactorChallengeExpiry)),
+	})
+}
+
+// signToken signs claims with the current key of the key ring and names the key in the kid header.
+func (s *AuthService) signToken(ctx context.Context, claims jwt.Claims) (string, error) {
+	kid, secret, err := s.jwtKeys.SigningKey(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get signing key: %w", err)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = kid
+	return token.SignedString(secret)
+}
+
+func (s *AuthService) userFromTwoFactorChallenge(ctx context.Context, challengeToken, subject string) (*models.User, error) {
+	if s.twoFactorService == nil {
+		return nil, ErrInvalidToken
+	}
+
+	token, err := jwt.ParseWithClaims(challengeToken, &jwt.RegisteredClaims{}, s.jwtKeys.Keyfunc(ctx))
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	claims, ok := token.Claims.(*jwt.RegisteredClaims)
+	if !ok || claims.Subject != subject || claims.ID == "" {
+		return nil, ErrInvalidToken
+	}
+
+	return s.userService.GetUserByID(ctx, claims.ID)
+}
+
 func (s *AuthService) OidcLogin(ctx context.Context, userInfo dto.OidcUserInfo, tokenResp *dto.OidcTokenResponse) (*models.User, *TokenPair, error) {
 	if userInfo.Subject == "" {
 		return nil, nil, errors.New("missing OIDC subject identifier")
@@ -229,7 +644,7 @@ func (s *AuthService) OidcLogin(ctx context.Context, userInfo dto.OidcUserInfo,
 		return nil, nil, err
 	}
 
-	tokenPair, err := s.generateTokenPair(ctx, user)
+	tokenPair, err := s.startSession(ctx, user, "oidc")
 	if err != nil {
 		return nil, nil, err
 	}
@@ -313,10 +728,7 @@ func (s *AuthService) createOidcUser(ctx context.Context, userInfo dto.OidcUserI
 
 	email := userInfo.Email
 
-	roles := models.StringSlice{"user"}
-	if s.isAdminFromOidc(ctx, userInfo, tokenResp) {
-		roles = append(roles, "admin")
-	}
+	roles := s.mapOidcRoles(ctx, models.StringSlice{models.RoleUser}, userInfo, tokenResp)
 
 	user := &models.User{
 		BaseModel:     models.BaseModel{ID: uuid.NewString()},
@@ -344,21 +756,22 @@ func (s *AuthService) updateOidcUser(ctx context.Context, user *models.User, use
 		user.Email = &userInfo.Email
 	}
 
-	wantAdmin := s.isAdminFromOidc(ctx, userInfo, tokenResp)
-	hasAdmin := hasRole(user.Roles, "admin")
-	switch {
-	case wantAdmin && !hasAdmin:
-		user.Roles = addRole(user.Roles, "admin")
-	case !wantAdmin && hasAdmin:
-		user.Roles = removeRole(user.Roles, "admin")
-	}
+	previousRoles := user.Roles
+	user.Roles = s.mapOidcRoles(ctx, user.Roles, userInfo, tokenResp)
 
 	s.persistOidcTokens(user, tokenResp)
 
 	now := time.Now()
 	user.LastLogin = &now
-	_, err := s.userService.UpdateUser(ctx, user)
-	return err
+	if _, err := s.userService.UpdateUser(ctx, user); err != nil {
+		return err
+	}
+
+	// Sessions issued while the user still held a role must not outlive it.
+	if RolesRemoved(previousRoles, user.Roles) {
+		return s.RevokeUserSessions(ctx, user, "", "roles_removed")
+	}
+	return nil
 }
 
 func (s *AuthService) mergeOidcWithExistingUser(ctx context.Context, user *models.User, userInfo dto.OidcUserInfo, tokenResp *dto.OidcTokenResponse) error {
@@ -369,15 +782,8 @@ func (s *AuthService) mergeOidcWithExistingUser(ctx context.Context, user *model
 			u.DisplayName = &userInfo.Name
 		}
 
-		// Update admin role based on OIDC claims
-		wantAdmin := s.isAdminFromOidc(ctx, userInfo, tokenResp)
-		hasAdmin := hasRole(u.Roles, "admin")
-		switch {
-		case wantAdmin && !hasAdmin:
-			u.Roles = addRole(u.Roles, "admin")
-		case !wantAdmin && hasAdmin:
-			u.Roles = removeRole(u.Roles, "admin")
-		}
+		// Update roles based on OIDC claims
+		u.Roles = s.mapOidcRoles(ctx, u.Roles, userInfo, tokenResp)
 
 		// Persist OIDC tokens
 		s.persistOidcTokens(u, tokenResp)
@@ -414,48 +820,77 @@ func removeRole(roles models.StringSlice, role string) models.StringSlice {
 	return out
 }
 
-func (s *AuthService) isAdminFromOidc(ctx context.Context, userInfo dto.OidcUserInfo, tokenResp *dto.OidcTokenResponse) bool {
-	claimKey, values := s.getAdminClaimConfig(ctx)
-	if claimKey == "" {
-		return false
-	}
-
-	if v, ok := utils.GetByPath(userInfo.Extra, claimKey); ok && utils.EvalMatch(v, values) {
-		return true
+// mapOidcRoles returns the roles a user should hold according to the configured role mappings.
+// Without RoleMappings only the admin role follows the admin claim and other roles in current are
+// kept; with them the result is rebuilt from the claims alone.
+func (s *AuthService) mapOidcRoles(ctx context.Context, current models.StringSlice, userInfo dto.OidcUserInfo, tokenResp *dto.OidcTokenResponse) models.StringSlice {
+	oidcConfig, err := s.GetOidcConfig(ctx)
+	if err != nil {
+		oidcConfig = &models.OidcConfig{}
 	}
 
+	sources := []map[string]any{userInfo.Extra}
 	if tokenResp != nil && tokenResp.IDToken != "" {
 		if claims := utils.ParseJWTClaims(tokenResp.IDToken); claims != nil {
-			if v, ok := utils.GetByPath(claims, claimKey); ok && utils.EvalMatch(v, values) {
-				return true
-			}
+			sources = append(sources, claims)
 		}
 	}
 
-	return false
+	var roles models.StringSlice
+	if len(oidcConfig.RoleMappings) == 0 {
+		roles = removeRole(current, models.RoleAdmin)
+	} else {
+		roles = models.StringSlice{models.RoleUser}
+	}
+
+	mappings := oidcConfig.RoleMappings
+	if adminClaim := adminClaimMapping(oidcConfig); adminClaim != nil {
+		mappings = append(slices.Clone(mappings), *adminClaim)
+	}
+	for _, mapping := range mappings {
+		if mapping.Role != "" && oidcClaimMatches(sources, mapping) {
+			roles = addRole(roles, mapping.Role)
+		}
+	}
+	return roles
 }
 
-func (s *AuthService) getAdminClaimConfig(ctx context.Context) (claim string, values []string) {
-	as, err := s.getAuthSettings(ctx)
-	if err != nil || as.Oidc == nil {
-		return "", nil
+// adminClaimMapping expresses the legacy admin claim setting as a role mapping.
+func adminClaimMapping(oidcConfig *models.OidcConfig) *models.OidcRoleMapping {
+	claim := strings.TrimSpace(oidcConfig.AdminClaim)
+	if claim == "" {
+		return nil
 	}
-	claim = strings.TrimSpace(as.Oidc.AdminClaim)
-	raw := strings.TrimSpace(as.Oidc.AdminValue)
+	var values []string
+	for _, p := range strings.Split(oidcConfig.AdminValue, ",") {
+		if v := strings.TrimSpace(p); v != "" {
+			values = append(values, v)
+		}
+	}
+	return &models.OidcRoleMapping{Claim: claim, Values: values, Role: models.RoleAdmin}
+}
+
+func oidcClaimMatches(sources []map[string]any, mapping models.OidcRoleMapping) bool {
+	claim := strings.TrimSpace(mapping.Claim)
 	if claim == "" {
-		return "", nil
+		return false
 	}
-	if raw == "" {
-		return claim, nil
+	for _, claims := range sources {
+		if v, ok := utils.GetByPath(claims, claim); ok && utils.EvalMatch(v, mapping.Values) {
+			return true
+		}
 	}
-	parts := strings.Split(raw, ",")
-	for _, p := range parts {
-		v := strings.TrimSpace(p)
-		if v != "" {
-			values = append(values, v)
+	return false
+}
+
+// rolesRemoved reports whether before holds a role that after does not.
+func RolesRemoved(before, after []string) bool {
+	for _, role := range before {
+		if !hasRole(after, role) {
+			return true
 		}
 	}
-	return claim, values
+	return false
 }
 
 func (s *AuthService) persistOidcTokens(user *models.User, tokenResp *dto.OidcTokenResponse) {
@@ -475,10 +910,7 @@ func (s *AuthService) persistOidcTokens(user *models.User, tokenResp *dto.OidcTo
 }
 
 func (s *AuthService) RefreshToken(ctx context.Context, refreshToken string) (*TokenPair, error) {
-	token, err := jwt.ParseWithClaims(refreshToken, &jwt.RegisteredClaims{},
-		func(t *jwt.Token) (interface{}, error) {
-			return s.jwtSecret, nil
-		})
+	token, err := jwt.ParseWithClaims(refreshToken, &RefreshClaims{}, s.jwtKeys.Keyfunc(ctx))
 
 	if err != nil {
 		return nil, ErrInvalidToken
@@ -488,7 +920,7 @@ func (s *AuthService) RefreshToken(ctx context.Context, refreshToken string) (*T
 		return nil, ErrInvalidToken
 	}
 
-	claims, ok := token.Claims.(*jwt.RegisteredClaims)
+	claims, ok := token.Claims.(*RefreshClaims)
 	if !ok {
 		return nil, errors.New("invalid token claims")
 	}
@@ -502,47 +934,117 @@ func (s *AuthService) RefreshToken(ctx context.Context, refreshToken string) (*T
 		return nil, errors.New("missing user ID in token")
 	}
 
+	method := ""
+	if s.sessionService != nil {
+		if claims.SessionID == "" {
+			return nil, ErrInvalidToken
+		}
+		session, err := s.sessionService.ValidateSession(ctx, claims.SessionID, userId)
+		if err != nil {
+			if errors.Is(err, ErrSessionRevoked) {
+				return nil, ErrInvalidToken
+			}
+			return nil, err
+		}
+		method = session.Method
+	}
+
 	user, err := s.userService.GetUserByID(ctx, userId)
 	if err != nil {
 		return nil, err
 	}
 
-	tokenPair, err := s.generateTokenPair(ctx, user)
+	if method == "oidc" {
+		if err := s.refreshOidcRoles(ctx, user, claims.SessionID); err != nil {
+			return nil, err
+		}
+	}
+
+	tokenPair, err := s.generateTokenPair(ctx, user, claims.SessionID)
 	if err != nil {
 		return nil, err
 	}
 
+	if s.sessionService != nil {
+		if err := s.sessionService.ExtendSession(ctx, claims.SessionID, tokenPair.RefreshExpiresAt); err != nil {
+			return nil, err
+		}
+	}
+
 	return tokenPair, nil
 }
 
+// refreshOidcRoles re-evaluates the role mappings of an OIDC session against fresh provider
+// claims, so group changes at the provider take effect without a new login. A refresh token the
+// provider rejects ends the session; an unreachable provider leaves the roles unchanged.
+func (s *AuthService) refreshOidcRoles(ctx context.Context, user *models.User, sessionID string) error {
+	if s.oidcRefresher == nil || user.OidcSubjectId == nil || user.OidcRefreshToken == nil || *user.OidcRefreshToken == "" {
+		return nil
+	}
+
+	userInfo, tokenResp, err := s.oidcRefresher.RefreshUserInfo(ctx, *user.OidcRefreshToken)
+	if err != nil {
+		if errors.Is(err, ErrOidcRefreshRejected) {
+			slog.InfoContext(ctx, "OIDC provider rejected refresh; ending session", "user", user.Username)
+			if s.sessionService != nil {
+				if revokeErr := s.sessionService.RevokeSession(ctx, user.ID, sessionID); revokeErr != nil && !errors.Is(revokeErr, ErrSessionNotFound) {
+					slog.WarnContext(ctx, "Failed to revoke session", "session", sessionID, "error", revokeErr)
+				}
+			}
+			return ErrInvalidToken
+		}
+		slog.WarnContext(ctx, "Could not refresh OIDC claims; keeping current roles", "user", user.Username, "error", err)
+		return nil
+	}
+	if userInfo.Subject != *user.OidcSubjectId {
+		return ErrInvalidToken
+	}
+
+	previousRoles := user.Roles
+	user.Roles = s.mapOidcRoles(ctx, user.Roles, *userInfo, tokenResp)
+	s.persistOidcTokens(user, tokenResp)
+	if _, err := s.userService.UpdateUser(ctx, user); err != nil {
+		return err
+	}
+
+	if RolesRemoved(previousRoles, user.Roles) {
+		return s.RevokeUserSessions(ctx, user, sessionID, "roles_removed")
+	}
+	return nil
+}
+
 func (s *AuthService) VerifyToken(ctx context.Context, accessToken string) (*models.User, error) {
-	token, err := jwt.ParseWithClaims(accessToken, &UserClaims{},
-		func(t *jwt.Token) (interface{}, error) {
-			return s.jwtSecret, nil
-		})
+	user, _, err := s.VerifyTokenSession(ctx, accessToken)
+	return user, err
+}
+
+// VerifyTokenSession verifies an access token like VerifyToken and also returns the ID of the
+// session it belongs to.
+func (s *AuthService) VerifyTokenSession(ctx context.Context, accessToken string) (*models.User, string, error) {
+	token, err := jwt.ParseWithClaims(accessToken, &UserClaims{}, s.jwtKeys.Keyfunc(ctx))
 
 	if err != nil {
 		if strings.Contains(err.Error(), "token is expired") {
-			return nil, ErrExpiredToken
+			return nil, "", ErrExpiredToken
 		}
-		return nil, ErrInvalidToken
+		return nil, "", ErrInvalidToken
 	}
 
 	if !token.Valid {
-		return nil, ErrInvalidToken
+		return nil, "", ErrInvalidToken
 	}
 
 	claims, ok := token.Claims.(*UserClaims)
 	if !ok {
-		return nil, errors.New("invalid token claims")
+		return nil, "", errors.New("invalid token claims")
 	}
 
 	if claims.Subject != "access" {
-		return nil, errors.New("not an access token")
+		return nil, "", errors.New("not an access token")
 	}
 
 	if claims.ID == "" {
-		return nil, errors.New("missing user ID in token")
+		return nil, "", errors.New("missing user ID in token")
 	}
 
 	if claims.AppVersion != "" && claims.AppVersion != config.Version {
@@ -550,7 +1052,19 @@ func (s *AuthService) VerifyToken(ctx context.Context, accessToken string) (*mod
 			"tokenVersion", claims.AppVersion,
 			"currentVersion", config.Version,
 			"user", claims.Username)
-		return nil, ErrTokenVersionMismatch
+		return nil, "", ErrTokenVersionMismatch
+	}
+
+	if s.sessionService != nil {
+		if claims.SessionID == "" {
+			return nil, "", ErrInvalidToken
+		}
+		if _, err := s.sessionService.ValidateSession(ctx, claims.SessionID, claims.ID); err != nil {
+			if errors.Is(err, ErrSessionRevoked) {
+				return nil, "", ErrInvalidToken
+			}
+			return nil, "", err
+		}
 	}
 
 	user := &models.User{
@@ -567,10 +1081,12 @@ func (s *AuthService) VerifyToken(ctx context.Context, accessToken string) (*mod
 		user.DisplayName = &claims.DisplayName
 	}
 
-	return user, nil
+	return user, claims.SessionID, nil
 }
 
-func (s *AuthService) ChangePassword(ctx context.Context, userID, currentPassword, newPassword string) error {
+// ChangePassword sets a new password and revokes every other session of the user, keeping the
+// one the change was made from.
+func (s *AuthService) ChangePassword(ctx context.Context, userID, currentSessionID, currentPassword, newPassword string) error {
 	user, err := s.userService.GetUserByID(ctx, userID)
 	if err != nil {
 		return err
@@ -582,18 +1098,50 @@ func (s *AuthService) ChangePassword(ctx context.Context, userID, currentPasswor
 		}
 	}
 
-	hashedPassword, err := s.userService.hashPassword(newPassword)
+	if err := s.userService.SetPassword(ctx, user, newPassword); err != nil {
+		return err
+	}
+	user.RequiresPasswordChange = false
+	if _, err = s.userService.UpdateUser(ctx, user); err != nil {
+		return err
+	}
+
+	return s.RevokeUserSessions(ctx, user, currentSessionID, "password_changed")
+}
+
+// RevokeUserSessions ends every session of user except exceptSessionID, logging a logout event
+// with reason when any were revoked.
+func (s *AuthService) RevokeUserSessions(ctx context.Context, user *models.User, exceptSessionID, reason string) error {
+	if s.sessionService == nil {
+		return nil
+	}
+	revoked, err := s.sessionService.RevokeUserSessions(ctx, user.ID, exceptSessionID)
 	if err != nil {
-		return fmt.Errorf("failed to hash password: %w", err)
+		return err
+	}
+	if revoked > 0 && s.eventService != nil {
+		metadata := models.JSON{"action": "revoke_sessions", "reason": reason, "count": revoked}
+		if logErr := s.eventService.LogUserEvent(ctx, models.EventTypeUserLogout, user.ID, user.Username, metadata); logErr != nil {
+			slog.WarnContext(ctx, "Could not log session revocation", "user", user.Username, "error", logErr)
+		}
 	}
+	return nil
+}
 
-	user.PasswordHash = hashedPassword
-	user.RequiresPasswordChange = false
-	_, err = s.userService.UpdateUser(ctx, user)
-	return err
+// startSession records a session for a completed login and issues tokens bound to it.
+func (s *AuthService) startSession(ctx context.Context, user *models.User, method string) (*TokenPair, error) {
+	sessionID := ""
+	if s.sessionService != nil {
+		session, err := s.sessionService.CreateSession(ctx, user.ID, method, time.Now().Add(s.refreshExpiry))
+		if err != nil {
+			return nil, err
+		}
+		sessionID = session.ID
+	}
+	return s.generateTokenPair(ctx, user, sessionID)
 }
 
-func (s *AuthService) generateTokenPair(ctx context.Context, user *models.User) (*TokenPair, error) {
+func (s *AuthService) generateTokenPair(ctx context.Context, user *models.User, sessionID string) (*TokenPair, error) {
 	sessionTimeout, _ := s.GetSessionTimeout(ctx)
 
 	accessTokenExpiry := time.Now().Add(time.Duration(sessionTimeout) * time.Minute)
@@ -610,6 +1158,7 @@ func (s *AuthService) generateTokenPair(ctx context.Context, user *models.User)
 		Username:   user.Username,
 		Roles:      []string(user.Roles),
 		AppVersion: config.Version,
+		SessionID:  sessionID,
 	}
 
 	if user.Email != nil {
@@ -620,29 +1169,30 @@ func (s *AuthService) generateTokenPair(ctx context.Context, user *models.User)
 		userClaims.DisplayName = *user.DisplayName
 	}
 
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, userClaims)
-
-	accessTokenString, err := accessToken.SignedString(s.jwtSecret)
+	accessTokenString, err := s.signToken(ctx, userClaims)
 	if err != nil {
 		return nil, err
 	}
 
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		ID:        user.ID,
-		Subject:   "refresh",
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.refreshExpiry)),
+	refreshExpiry := time.Now().Add(s.refreshExpiry)
+	refreshTokenString, err := s.signToken(ctx, RefreshClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        user.ID,
+			Subject:   "refresh",
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(refreshExpiry),
+		},
+		SessionID: sessionID,
 	})
-
-	refreshTokenString, err := refreshToken.SignedString(s.jwtSecret)
 	if err != nil {
 		return nil, err
 	}
 
 	return &TokenPair{
-		AccessToken:  accessTokenString,
-		RefreshToken: refreshTokenString,
-		ExpiresAt:    accessTokenExpiry,
+		AccessToken:      accessTokenString,
+		RefreshToken:     refreshTokenString,
+		ExpiresAt:        accessTokenExpiry,
+		RefreshExpiresAt: refreshExpiry,
 	}, nil
 }
 
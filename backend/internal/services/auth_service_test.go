@@ -3,33 +3,49 @@ package services
 import (
 	"context"
 	"crypto/rand"
+	"encoding/json"
 	"errors"
 	"testing"
 	"time"
 
+	glsqlite "github.com/glebarez/sqlite"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
 	"github.com/ofkm/arcane-backend/internal/config"
+	"github.com/ofkm/arcane-backend/internal/database"
 	"github.com/ofkm/arcane-backend/internal/dto"
 	"github.com/ofkm/arcane-backend/internal/models"
 )
 
-func newTestAuthService(secret string) *AuthService {
-	if secret == "" {
-		b := make([]byte, 32)
-		if _, err := rand.Read(b); err != nil {
-			panic(err)
-		}
-		return &AuthService{
-			jwtSecret:     b,
-			refreshExpiry: 24 * time.Hour,
-			config:        &config.Config{},
-		}
+// newTestAuthService returns an AuthService whose key ring carries over a random legacy secret,
+// which verifies the kid-less tokens built by makeAccessToken.
+func newTestAuthService(t *testing.T) (*AuthService, []byte) {
+	t.Helper()
+	ctx := context.Background()
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		t.Fatalf("rand.Read: %v", err)
 	}
+
+	gdb, err := gorm.Open(glsqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, gdb.AutoMigrate(&models.SettingVariable{}))
+	db := &database.DB{DB: gdb}
+	settingsService, err := NewSettingsService(ctx, db)
+	require.NoError(t, err)
+
+	jwtKeys := newTestJwtKeyService(t, db, settingsService)
+	jwtKeys.legacySecret = string(secret)
+	_, _, err = jwtKeys.SigningKey(ctx)
+	require.NoError(t, err)
+
 	return &AuthService{
-		jwtSecret:     []byte(secret),
+		jwtKeys:       jwtKeys,
 		refreshExpiry: 24 * time.Hour,
 		config:        &config.Config{},
-	}
+	}, secret
 }
 
 func makeAccessToken(t *testing.T, secret []byte, subject string, id string, username string, roles []string, email, displayName string, exp time.Time) string {
@@ -57,9 +73,9 @@ func makeAccessToken(t *testing.T, secret []byte, subject string, id string, use
 }
 
 func TestVerifyToken_ValidClaims(t *testing.T) {
-	s := newTestAuthService("")
+	s, secret := newTestAuthService(t)
 	exp := time.Now().Add(5 * time.Minute)
-	token := makeAccessToken(t, s.jwtSecret, "access", "u123", "alice", []string{"user", "admin"}, "a@example.com", "Alice", exp)
+	token := makeAccessToken(t, secret, "access", "u123", "alice", []string{"user", "admin"}, "a@example.com", "Alice", exp)
 
 	user, err := s.VerifyToken(context.Background(), token)
 	if err != nil {
@@ -83,9 +99,9 @@ func TestVerifyToken_ValidClaims(t *testing.T) {
 }
 
 func TestVerifyToken_Expired(t *testing.T) {
-	s := newTestAuthService("")
+	s, secret := newTestAuthService(t)
 	exp := time.Now().Add(-1 * time.Minute)
-	token := makeAccessToken(t, s.jwtSecret, "access", "u1", "bob", []string{"user"}, "", "", exp)
+	token := makeAccessToken(t, secret, "access", "u1", "bob", []string{"user"}, "", "", exp)
 
 	_, err := s.VerifyToken(context.Background(), token)
 	if !errors.Is(err, ErrExpiredToken) {
@@ -94,9 +110,9 @@ func TestVerifyToken_Expired(t *testing.T) {
 }
 
 func TestVerifyToken_InvalidSubject(t *testing.T) {
-	s := newTestAuthService("")
+	s, secret := newTestAuthService(t)
 	exp := time.Now().Add(5 * time.Minute)
-	token := makeAccessToken(t, s.jwtSecret, "refresh", "u1", "bob", []string{"user"}, "", "", exp)
+	token := makeAccessToken(t, secret, "refresh", "u1", "bob", []string{"user"}, "", "", exp)
 
 	_, err := s.VerifyToken(context.Background(), token)
 	if err == nil || err.Error() != "not an access token" {
@@ -105,7 +121,7 @@ func TestVerifyToken_InvalidSubject(t *testing.T) {
 }
 
 func TestVerifyToken_InvalidSignature(t *testing.T) {
-	s := newTestAuthService("")
+	s, _ := newTestAuthService(t)
 	exp := time.Now().Add(5 * time.Minute)
 	otherSecret := make([]byte, 32)
 	if _, err := rand.Read(otherSecret); err != nil {
@@ -120,9 +136,9 @@ func TestVerifyToken_InvalidSignature(t *testing.T) {
 }
 
 func TestVerifyToken_MissingUserID(t *testing.T) {
-	s := newTestAuthService("")
+	s, secret := newTestAuthService(t)
 	exp := time.Now().Add(5 * time.Minute)
-	token := makeAccessToken(t, s.jwtSecret, "access", "", "bob", []string{"user"}, "", "", exp)
+	token := makeAccessToken(t, secret, "access", "", "bob", []string{"user"}, "", "", exp)
 
 	_, err := s.VerifyToken(context.Background(), token)
 	if err == nil || err.Error() != "missing user ID in token" {
@@ -146,7 +162,7 @@ func TestGenerateUsernameFromEmail(t *testing.T) {
 }
 
 func TestPersistOidcTokens_SetsFields(t *testing.T) {
-	s := newTestAuthService("")
+	s, _ := newTestAuthService(t)
 	user := &models.User{}
 	start := time.Now()
 	resp := &dto.OidcTokenResponse{
@@ -175,12 +191,12 @@ func TestPersistOidcTokens_SetsFields(t *testing.T) {
 }
 
 func TestVerifyToken_VersionMismatch(t *testing.T) {
-	s := newTestAuthService("")
+	s, secret := newTestAuthService(t)
 	exp := time.Now().Add(5 * time.Minute)
 
 	oldVersion := config.Version
 	config.Version = "1.0.0"
-	token := makeAccessToken(t, s.jwtSecret, "access", "u1", "bob", []string{"user"}, "", "", exp)
+	token := makeAccessToken(t, secret, "access", "u1", "bob", []string{"user"}, "", "", exp)
 	config.Version = "2.0.0"
 
 	_, err := s.VerifyToken(context.Background(), token)
@@ -193,7 +209,7 @@ func TestVerifyToken_VersionMismatch(t *testing.T) {
 
 func TestGetOidcConfigurationStatus(t *testing.T) {
 	// Disabled
-	s := newTestAuthService("")
+	s, _ := newTestAuthService(t)
 	s.config = &config.Config{}
 	// Set a non-nil settingsService to prevent nil pointer dereference
 	// GetSettings will fail gracefully and mergeAccounts will default to false
@@ -232,3 +248,95 @@ func TestGetOidcConfigurationStatus(t *testing.T) {
 		t.Errorf("expected enabled and configured, got forced=%v configured=%v", status.EnvForced, status.EnvConfigured)
 	}
 }
+
+type fakeOidcRefresher struct {
+	userInfo *dto.OidcUserInfo
+	err      error
+}
+
+func (f *fakeOidcRefresher) RefreshUserInfo(ctx context.Context, refreshToken string) (*dto.OidcUserInfo, *dto.OidcTokenResponse, error) {
+	if f.err != nil {
+		return nil, nil, f.err
+	}
+	return f.userInfo, &dto.OidcTokenResponse{AccessToken: "at-new", RefreshToken: refreshToken}, nil
+}
+
+func setupOidcRoleMappingTest(t *testing.T) (*AuthService, *fakeOidcRefresher) {
+	t.Helper()
+	ctx := context.Background()
+	gdb, err := gorm.Open(glsqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, gdb.AutoMigrate(&models.User{}, &models.Session{}, &models.SettingVariable{}, &models.Event{}))
+	db := &database.DB{DB: gdb}
+
+	settingsService, err := NewSettingsService(ctx, db)
+	require.NoError(t, err)
+	require.NoError(t, settingsService.EnsureDefaultSettings(ctx))
+	oidcConfig, err := json.Marshal(models.OidcConfig{
+		ClientID:  "arcane",
+		IssuerURL: "https://sso.example.com/realms/main",
+		RoleMappings: []models.OidcRoleMapping{
+			{Claim: "groups", Values: []string{"/arcane-admins"}, Role: models.RoleAdmin},
+			{Claim: "realm_access.roles", Values: []string{"ops"}, Role: "operator"},
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, settingsService.SetBoolSetting(ctx, "authOidcEnabled", true))
+	require.NoError(t, settingsService.SetStringSetting(ctx, "authOidcConfig", string(oidcConfig)))
+
+	authService := NewAuthService(NewUserService(db), settingsService, NewEventService(db), nil, nil, NewSessionService(db), nil, nil, newTestJwtKeyService(t, db, settingsService), &config.Config{})
+	refresher := &fakeOidcRefresher{}
+	authService.oidcRefresher = refresher
+	return authService, refresher
+}
+
+func oidcUserInfo(groups []any, realmRoles []any) dto.OidcUserInfo {
+	return dto.OidcUserInfo{
+		Subject:           "sub-1",
+		PreferredUsername: "heidi",
+		Email:             "heidi@example.com",
+		Extra: map[string]any{
+			"sub":          "sub-1",
+			"groups":       groups,
+			"realm_access": map[string]any{"roles": realmRoles},
+		},
+	}
+}
+
+func TestAuthService_OidcRoleMappings(t *testing.T) {
+	authService, _ := setupOidcRoleMappingTest(t)
+	ctx := context.Background()
+
+	roles := authService.mapOidcRoles(ctx, models.StringSlice{models.RoleUser, "auditor"}, oidcUserInfo([]any{"/arcane-admins"}, []any{"ops"}), nil)
+	require.ElementsMatch(t, []string{models.RoleUser, models.RoleAdmin, "operator"}, roles)
+
+	// Roles the provider does not grant are dropped.
+	roles = authService.mapOidcRoles(ctx, models.StringSlice{models.RoleUser, models.RoleAdmin}, oidcUserInfo(nil, []any{"ops"}), nil)
+	require.ElementsMatch(t, []string{models.RoleUser, "operator"}, roles)
+}
+
+func TestAuthService_OidcRolesReevaluatedOnRefresh(t *testing.T) {
+	authService, refresher := setupOidcRoleMappingTest(t)
+	ctx := context.Background()
+
+	user, tokens, err := authService.OidcLogin(ctx, oidcUserInfo([]any{"/arcane-admins"}, nil), &dto.OidcTokenResponse{AccessToken: "at", RefreshToken: "rt"})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{models.RoleUser, models.RoleAdmin}, user.Roles)
+
+	info := oidcUserInfo([]any{"/developers"}, nil)
+	refresher.userInfo = &info
+	_, err = authService.RefreshToken(ctx, tokens.RefreshToken)
+	require.NoError(t, err)
+
+	user, err = authService.userService.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	require.Equal(t, models.StringSlice{models.RoleUser}, user.Roles)
+
+	// Once the provider refuses the refresh token the session ends.
+	refresher.err = ErrOidcRefreshRejected
+	_, err = authService.RefreshToken(ctx, tokens.RefreshToken)
+	require.ErrorIs(t, err, ErrInvalidToken)
+	refresher.err = nil
+	_, err = authService.RefreshToken(ctx, tokens.RefreshToken)
+	require.ErrorIs(t, err, ErrInvalidToken)
+}
@@ -420,7 +420,32 @@ func (s *ContainerService) ListContainersPaginated(ctx context.Context, params p
 		items = append(items, dto.NewContainerSummaryDto(dc))
 	}
 
-	config := pagination.Config[dto.ContainerSummaryDto]{
+	result := pagination.SearchOrderAndPaginate(items, params, containerListConfig())
+
+	totalPages := int64(0)
+	if params.Limit > 0 {
+		totalPages = (int64(result.TotalCount) + int64(params.Limit) - 1) / int64(params.Limit)
+	}
+
+	page := 1
+	if params.Limit > 0 {
+		page = (params.Start / params.Limit) + 1
+	}
+
+	paginationResp := pagination.Response{
+		TotalPages:      totalPages,
+		TotalItems:      int64(result.TotalCount),
+		CurrentPage:     page,
+		ItemsPerPage:    params.Limit,
+		GrandTotalItems: int64(result.TotalAvailable),
+	}
+
+	return result.Items, paginationResp, nil
+}
+
+// containerListConfig describes how container listings are searched, sorted and filtered.
+func containerListConfig() pagination.Config[dto.ContainerSummaryDto] {
+	return pagination.Config[dto.ContainerSummaryDto]{
 		SearchAccessors: []pagination.SearchAccessor[dto.ContainerSummaryDto]{
 			func(c dto.ContainerSummaryDto) (string, error) {
 				if len(c.Names) > 0 {
@@ -478,29 +503,35 @@ func (s *ContainerService) ListContainersPaginated(ctx context.Context, params p
 				},
 			},
 		},
+		FilterAccessors: []pagination.FilterAccessor[dto.ContainerSummaryDto]{
+			{
+				Key: "state",
+				Fn: func(c dto.ContainerSummaryDto, filterValue string) bool {
+					return strings.EqualFold(c.State, filterValue)
+				},
+			},
+			{
+				Key: "health",
+				Fn: func(c dto.ContainerSummaryDto, filterValue string) bool {
+					return containerHealth(c.Status) == strings.ToLower(filterValue)
+				},
+			},
+		},
 	}
+}
 
-	result := pagination.SearchOrderAndPaginate(items, params, config)
-
-	totalPages := int64(0)
-	if params.Limit > 0 {
-		totalPages = (int64(result.TotalCount) + int64(params.Limit) - 1) / int64(params.Limit)
-	}
-
-	page := 1
-	if params.Limit > 0 {
-		page = (params.Start / params.Limit) + 1
-	}
-
-	paginationResp := pagination.Response{
-		TotalPages:      totalPages,
-		TotalItems:      int64(result.TotalCount),
-		CurrentPage:     page,
-		ItemsPerPage:    params.Limit,
-		GrandTotalItems: int64(result.TotalAvailable),
-	}
-
-	return result.Items, paginationResp, nil
+// containerHealth extracts the health check state Docker appends to a container's status, such
+// as "Up 2 hours (unhealthy)". Containers without a health check report "none".
+func containerHealth(status string) string {
+	switch {
+	case strings.Contains(status, "(unhealthy)"):
+		return "unhealthy"
+	case strings.Contains(status, "(healthy)"):
+		return "healthy"
+	case strings.Contains(status, "(health: starting)"):
+		return "starting"
+	}
+	return "none"
 }
 
 // CreateExec creates an exec instance in the container
@@ -2,7 +2,13 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/image"
@@ -12,9 +18,27 @@ import (
 	"github.com/docker/docker/client"
 	"github.com/ofkm/arcane-backend/internal/config"
 	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/utils"
 	"github.com/ofkm/arcane-backend/internal/utils/docker"
+	"golang.org/x/crypto/ssh"
 )
 
+var ErrDirectDockerUnsupported = errors.New("not supported for direct Docker environments")
+
+type dockerEnvironmentKey struct{}
+
+// WithDockerEnvironment makes Docker connections created with the returned context go to the
+// daemon of the direct Docker environment id instead of the manager's own.
+func WithDockerEnvironment(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, dockerEnvironmentKey{}, id)
+}
+
+func dockerEnvironmentFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(dockerEnvironmentKey{}).(string)
+	return id, ok && id != ""
+}
+
 type DockerClientService struct {
 	db     *database.DB
 	config *config.Config
@@ -27,7 +51,20 @@ func NewDockerClientService(db *database.DB, cfg *config.Config) *DockerClientSe
 	}
 }
 
+// CreateConnection connects to the manager's Docker host, or to a direct Docker environment's
+// daemon when ctx carries one (see WithDockerEnvironment).
 func (s *DockerClientService) CreateConnection(ctx context.Context) (*client.Client, error) {
+	if id, ok := dockerEnvironmentFromContext(ctx); ok {
+		var environment models.Environment
+		if err := s.db.WithContext(ctx).Where("id = ?", id).First(&environment).Error; err != nil {
+			return nil, fmt.Errorf("failed to load environment: %w", err)
+		}
+		if !environment.Enabled {
+			return nil, fmt.Errorf("environment %s is disabled", environment.Name)
+		}
+		return newEnvironmentDockerClient(ctx, s.db, &environment)
+	}
+
 	cli, err := client.NewClientWithOpts(
 		client.WithHost(s.config.DockerHost),
 		client.WithAPIVersionNegotiation(),
@@ -40,6 +77,115 @@ func (s *DockerClientService) CreateConnection(ctx context.Context) (*client.Cli
 	return cli, nil
 }
 
+// newEnvironmentDockerClient connects to the daemon of a direct Docker environment over SSH or
+// TLS. An ssh:// host without a pinned host key is trusted on first connect and its key pinned.
+func newEnvironmentDockerClient(ctx context.Context, db *database.DB, environment *models.Environment) (*client.Client, error) {
+	if environment.Type != models.EnvironmentTypeDocker {
+		return nil, fmt.Errorf("environment %s is not a direct Docker environment", environment.Name)
+	}
+
+	var opts []client.Opt
+	switch scheme, _, _ := strings.Cut(environment.ApiUrl, "://"); scheme {
+	case "ssh":
+		host, err := docker.ParseSSHHost(environment.ApiUrl)
+		if err != nil {
+			return nil, err
+		}
+		config, err := sshClientConfig(db, environment, host.User)
+		if err != nil {
+			return nil, err
+		}
+		// The address is only used to form request URLs; every connection goes through SSH.
+		opts = append(opts, client.WithHost("http://docker"), client.WithDialContext(docker.SSHDialer(host, config)))
+	case "tcp":
+		if environment.TlsCaCert == nil || environment.TlsCert == nil || environment.TlsKey == nil {
+			return nil, fmt.Errorf("environment %s has no TLS client certificate", environment.Name)
+		}
+		key, err := utils.Decrypt(*environment.TlsKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt TLS key: %w", err)
+		}
+		tlsConfig, err := docker.TLSConfig(*environment.TlsCaCert, *environment.TlsCert, key)
+		if err != nil {
+			return nil, err
+		}
+		httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		opts = append(opts, client.WithHTTPClient(httpClient), client.WithHost(environment.ApiUrl))
+	default:
+		return nil, fmt.Errorf("unsupported Docker host %q: expected ssh:// or tcp://", environment.ApiUrl)
+	}
+
+	cli, err := client.NewClientWithOpts(append(opts, client.WithAPIVersionNegotiation())...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Docker client: %w", err)
+	}
+	return cli, nil
+}
+
+func sshClientConfig(db *database.DB, environment *models.Environment, user string) (*ssh.ClientConfig, error) {
+	if environment.SshPrivateKey == nil || *environment.SshPrivateKey == "" {
+		return nil, fmt.Errorf("environment %s has no SSH private key", environment.Name)
+	}
+	pemKey, err := utils.Decrypt(*environment.SshPrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt SSH private key: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey([]byte(pemKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSH private key: %w", err)
+	}
+
+	var hostKeyCallback ssh.HostKeyCallback
+	if environment.SshHostKey != nil && *environment.SshHostKey != "" {
+		pinned, _, _, _, err := ssh.ParseAuthorizedKey([]byte(*environment.SshHostKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid SSH host key: %w", err)
+		}
+		hostKeyCallback = ssh.FixedHostKey(pinned)
+	} else {
+		id := environment.ID
+		hostKeyCallback = func(hostname string, _ net.Addr, key ssh.PublicKey) error {
+			authorized := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+			// Only the first key seen is kept; a concurrent first connect to another key loses.
+			res := db.Model(&models.Environment{}).Where("id = ? AND (ssh_host_key IS NULL OR ssh_host_key = '')", id).Update("ssh_host_key", authorized)
+			if res.Error != nil {
+				return fmt.Errorf("failed to pin SSH host key: %w", res.Error)
+			}
+			if res.RowsAffected == 0 {
+				var current models.Environment
+				if err := db.Select("ssh_host_key").Where("id = ?", id).First(&current).Error; err != nil {
+					return fmt.Errorf("failed to read pinned SSH host key: %w", err)
+				}
+				if current.SshHostKey == nil || *current.SshHostKey != authorized {
+					return fmt.Errorf("SSH host key of %s does not match the pinned key", hostname)
+				}
+				return nil
+			}
+			slog.Info("Pinned SSH host key for Docker environment", "environmentId", id, "host", hostname, "fingerprint", ssh.FingerprintSHA256(key))
+			return nil
+		}
+	}
+
+	return &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+	}, nil
+}
+
+// ValidateDockerHost checks that apiURL is an ssh://user@host or tcp://host:port Docker host.
+func ValidateDockerHost(apiURL string) error {
+	if strings.HasPrefix(apiURL, "ssh://") {
+		_, err := docker.ParseSSHHost(apiURL)
+		return err
+	}
+	u, err := url.Parse(apiURL)
+	if err != nil || u.Scheme != "tcp" || u.Hostname() == "" || u.Port() == "" {
+		return fmt.Errorf("invalid Docker host %q: expected ssh://user@host or tcp://host:port", apiURL)
+	}
+	return nil
+}
+
 func (s *DockerClientService) GetAllContainers(ctx context.Context) ([]container.Summary, int, int, int, error) {
 	dockerClient, err := s.CreateConnection(ctx)
 	if err != nil {
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"context"
+	"crypto/ed25519"
+	crand "crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ofkm/arcane-backend/internal/config"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/utils"
+	"github.com/ofkm/arcane-backend/internal/utils/pagination"
+	"github.com/ofkm/arcane-backend/internal/utils/pki"
+)
+
+// fakeDockerDaemon answers the few Docker API calls the tests make, listing a single container.
+func fakeDockerDaemon(containerName string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Api-Version", "1.41")
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/_ping":
+			_, _ = io.WriteString(w, "OK")
+		case strings.HasSuffix(r.URL.Path, "/version"):
+			_ = json.NewEncoder(w).Encode(map[string]string{"Version": "27.3.1", "ApiVersion": "1.41"})
+		case strings.HasSuffix(r.URL.Path, "/containers/json"):
+			_ = json.NewEncoder(w).Encode([]map[string]any{{"Id": "c1", "Names": []string{"/" + containerName}, "State": "running", "Status": "Up 1 minute"}})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// startSSHDockerHost serves daemon on a unix socket behind an SSH server that only admits
+// clientKey and forwards direct-streamlocal channels to that socket. It returns the ssh:// host
+// and the server's host key.
+func startSSHDockerHost(t *testing.T, daemon http.Handler, user string, clientKey ssh.PublicKey) (string, ssh.PublicKey) {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "dk")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	socketPath := filepath.Join(dir, "docker.sock")
+	socket, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	srv := httptest.NewUnstartedServer(daemon)
+	srv.Listener = socket
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	_, hostPriv, err := ed25519.GenerateKey(crand.Reader)
+	require.NoError(t, err)
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	require.NoError(t, err)
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if meta.User() != user || string(key.Marshal()) != string(clientKey.Marshal()) {
+				return nil, io.EOF
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					_ = conn.Close()
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for newChan := range chans {
+					var target struct {
+						SocketPath string
+						Reserved0  string
+						Reserved1  uint32
+					}
+					if newChan.ChannelType() != "direct-streamlocal@openssh.com" || ssh.Unmarshal(newChan.ExtraData(), &target) != nil || target.SocketPath != socketPath {
+						_ = newChan.Reject(ssh.Prohibited, "unsupported channel")
+						continue
+					}
+					channel, chanReqs, err := newChan.Accept()
+					if err != nil {
+						continue
+					}
+					go ssh.DiscardRequests(chanReqs)
+					upstream, err := net.Dial("unix", socketPath)
+					if err != nil {
+						_ = channel.Close()
+						continue
+					}
+					go func() { _, _ = io.Copy(upstream, channel); _ = upstream.Close() }()
+					go func() { _, _ = io.Copy(channel, upstream); _ = channel.Close() }()
+				}
+			}()
+		}
+	}()
+
+	return "ssh://" + user + "@" + listener.Addr().String() + socketPath, hostSigner.PublicKey()
+}
+
+func TestDockerClientService_DirectSSHEnvironment(t *testing.T) {
+	ctx := context.Background()
+	utils.InitEncryption(&config.Config{})
+	db, _ := newAgentTLSTestDB(t, &models.Environment{})
+	envService := NewEnvironmentService(db, nil)
+	docker := NewDockerClientService(db, &config.Config{DockerHost: "unix:///nonexistent/docker.sock"})
+	containers := NewContainerService(db, nil, docker)
+
+	clientPub, clientPriv, err := ed25519.GenerateKey(crand.Reader)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(clientPriv, "")
+	require.NoError(t, err)
+	privateKey := string(pem.EncodeToMemory(block))
+	sshPub, err := ssh.NewPublicKey(clientPub)
+	require.NoError(t, err)
+	host, hostKey := startSSHDockerHost(t, fakeDockerDaemon("remote-web"), "deploy", sshPub)
+
+	_, err = envService.CreateEnvironment(ctx, &models.Environment{Name: "no-key", Type: models.EnvironmentTypeDocker, ApiUrl: host, Enabled: true})
+	require.ErrorIs(t, err, ErrInvalidDockerHost)
+	_, err = envService.CreateEnvironment(ctx, &models.Environment{Name: "bad-host", Type: models.EnvironmentTypeDocker, ApiUrl: "https://docker.example.com", Enabled: true, SshPrivateKey: &privateKey})
+	require.ErrorIs(t, err, ErrInvalidDockerHost)
+
+	env, err := envService.CreateEnvironment(ctx, &models.Environment{Name: "remote", Type: models.EnvironmentTypeDocker, ApiUrl: host, Enabled: true, SshPrivateKey: &privateKey})
+	require.NoError(t, err)
+	var stored models.Environment
+	require.NoError(t, db.First(&stored, "id = ?", env.ID).Error)
+	require.NotContains(t, *stored.SshPrivateKey, "PRIVATE KEY", "the private key is encrypted at rest")
+
+	// Services reach the remote daemon when the context names the environment.
+	envCtx := WithDockerEnvironment(ctx, env.ID)
+	items, _, err := containers.ListContainersPaginated(envCtx, pagination.QueryParams{PaginationParams: pagination.PaginationParams{Limit: 10}}, true)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	require.Equal(t, []string{"/remote-web"}, items[0].Names)
+
+	// The host key seen on first connect is pinned.
+	require.NoError(t, db.First(&stored, "id = ?", env.ID).Error)
+	require.NotNil(t, stored.SshHostKey)
+	require.Equal(t, strings.TrimSpace(string(ssh.MarshalAuthorizedKey(hostKey))), *stored.SshHostKey)
+
+	probe := envService.ProbeEnvironment(ctx, &stored)
+	require.NoError(t, probe.Err)
+	require.Equal(t, models.EnvironmentStatusOnline, probe.Status)
+	require.Equal(t, "27.3.1", probe.DockerVersion)
+
+	// A different pinned key makes the connection fail.
+	_, otherPriv, err := ed25519.GenerateKey(crand.Reader)
+	require.NoError(t, err)
+	otherSigner, err := ssh.NewSignerFromKey(otherPriv)
+	require.NoError(t, err)
+	_, err = envService.UpdateEnvironment(ctx, env.ID, map[string]interface{}{"ssh_host_key": string(ssh.MarshalAuthorizedKey(otherSigner.PublicKey()))})
+	require.NoError(t, err)
+	_, _, err = containers.ListContainersPaginated(envCtx, pagination.QueryParams{}, true)
+	require.ErrorContains(t, err, "host key mismatch")
+
+	// Moving to another host drops the pinned key.
+	updated, err := envService.UpdateEnvironment(ctx, env.ID, map[string]interface{}{"api_url": strings.Replace(host, "deploy@", "admin@", 1)})
+	require.NoError(t, err)
+	require.Nil(t, updated.SshHostKey)
+
+	// Agent environments take no Docker host credentials.
+	agent, err := envService.CreateEnvironment(ctx, &models.Environment{Name: "agent", ApiUrl: "http://agent:3553", Enabled: true})
+	require.NoError(t, err)
+	require.Equal(t, models.EnvironmentTypeAgent, agent.Type)
+	_, err = envService.UpdateEnvironment(ctx, agent.ID, map[string]interface{}{"ssh_private_key": privateKey})
+	require.ErrorIs(t, err, ErrInvalidDockerHost)
+}
+
+func TestDockerClientService_DirectTLSEnvironment(t *testing.T) {
+	ctx := context.Background()
+	utils.InitEncryption(&config.Config{})
+	db, _ := newAgentTLSTestDB(t, &models.Environment{})
+	envService := NewEnvironmentService(db, nil)
+	containers := NewContainerService(db, nil, NewDockerClientService(db, &config.Config{}))
+
+	caKey, err := pki.GenerateKey()
+	require.NoError(t, err)
+	ca, err := pki.NewCA(caKey, "docker-ca", time.Hour)
+	require.NoError(t, err)
+	clientKey, err := pki.GenerateKey()
+	require.NoError(t, err)
+	clientCert, err := pki.Issue(ca, caKey, clientKey.Public(), pki.LeafTemplate{CommonName: "arcane", Validity: time.Hour, Client: true})
+	require.NoError(t, err)
+	clientKeyPEM, err := pki.EncodeKey(clientKey)
+	require.NoError(t, err)
+
+	srv := httptest.NewUnstartedServer(fakeDockerDaemon("tls-web"))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca)
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	serverCA := pki.EncodeCertificate(srv.Certificate())
+	clientPEM := pki.EncodeCertificate(clientCert)
+	host := "tcp://" + srv.Listener.Addr().String()
+
+	_, err = envService.CreateEnvironment(ctx, &models.Environment{Name: "no-certs", Type: models.EnvironmentTypeDocker, ApiUrl: host, Enabled: true, TlsCaCert: &serverCA})
+	require.ErrorIs(t, err, ErrInvalidDockerHost)
+
+	env, err := envService.CreateEnvironment(ctx, &models.Environment{
+		Name: "tls", Type: models.EnvironmentTypeDocker, ApiUrl: host, Enabled: true,
+		TlsCaCert: &serverCA, TlsCert: &clientPEM, TlsKey: &clientKeyPEM,
+	})
+	require.NoError(t, err)
+
+	items, _, err := containers.ListContainersPaginated(WithDockerEnvironment(ctx, env.ID), pagination.QueryParams{}, true)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	require.Equal(t, []string{"/tls-web"}, items[0].Names)
+
+	// A disabled environment is not connected to.
+	_, err = envService.UpdateEnvironment(ctx, env.ID, map[string]interface{}{"enabled": false})
+	require.NoError(t, err)
+	_, _, err = containers.ListContainersPaginated(WithDockerEnvironment(ctx, env.ID), pagination.QueryParams{}, true)
+	require.ErrorContains(t, err, "disabled")
+}
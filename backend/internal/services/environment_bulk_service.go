@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/ofkm/arcane-backend/internal/dto"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/utils/pagination"
+)
+
+// bulkActionTimeout bounds a bulk action on one environment; pruning or redeploying can take a while.
+const bulkActionTimeout = 10 * time.Minute
+
+var ErrEmptyEnvironmentSelector = errors.New("a group or at least one tag is required")
+
+// EnvironmentBulkService runs an action on every environment in a group or carrying a set of
+// tags and reports the outcome per environment. One environment failing does not stop the others.
+// Actions run through the environments' agents, so direct Docker environments report a failure.
+type EnvironmentBulkService struct {
+	environmentService *EnvironmentService
+	aggregateService   *AggregateService
+}
+
+func NewEnvironmentBulkService(environmentService *EnvironmentService, aggregateService *AggregateService) *EnvironmentBulkService {
+	return &EnvironmentBulkService{environmentService: environmentService, aggregateService: aggregateService}
+}
+
+type bulkAction func(ctx context.Context, target aggregateTarget, client *http.Client, baseURL string) (any, error)
+
+// CheckImageUpdates checks every image on the selected environments for updates.
+func (s *EnvironmentBulkService) CheckImageUpdates(ctx context.Context, caller AggregateCaller, sel dto.EnvironmentSelectorDto) ([]dto.EnvironmentActionResultDto, error) {
+	return s.run(ctx, caller, sel, models.PermissionImagesRead, func(ctx context.Context, target aggregateTarget, client *http.Client, baseURL string) (any, error) {
+		var out dto.BatchImageUpdateResponse
+		if err := s.environmentService.callAgent(ctx, client, baseURL, "/image-updates/check-all", target.header(caller), struct{}{}, &out); err != nil {
+			return nil, err
+		}
+		return out, nil
+	})
+}
+
+// Prune prunes the selected environments as requested.
+func (s *EnvironmentBulkService) Prune(ctx context.Context, caller AggregateCaller, sel dto.EnvironmentSelectorDto, req dto.PruneSystemDto) ([]dto.EnvironmentActionResultDto, error) {
+	return s.run(ctx, caller, sel, models.PermissionSystemPrune, func(ctx context.Context, target aggregateTarget, client *http.Client, baseURL string) (any, error) {
+		var out dto.PruneAllResult
+		if err := s.environmentService.callAgent(ctx, client, baseURL, "/system/prune", target.header(caller), req, &out); err != nil {
+			return nil, err
+		}
+		return out, nil
+	})
+}
+
+// RedeployProject redeploys the project named name on each selected environment. Environments
+// without such a project report a failure.
+func (s *EnvironmentBulkService) RedeployProject(ctx context.Context, caller AggregateCaller, sel dto.EnvironmentSelectorDto, name string) ([]dto.EnvironmentActionResultDto, error) {
+	return s.run(ctx, caller, sel, models.PermissionProjectsDeploy, func(ctx context.Context, target aggregateTarget, client *http.Client, baseURL string) (any, error) {
+		params := pagination.QueryParams{SearchQuery: pagination.SearchQuery{Search: name}, PaginationParams: pagination.PaginationParams{Limit: aggregatePageSize}}
+		projects, _, err := fetchAgentList[dto.ProjectDetailsDto](ctx, s.environmentService, target, caller, "/projects", params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list projects: %w", err)
+		}
+		for _, project := range projects {
+			if project.Name != name {
+				continue
+			}
+			endpoint := "/projects/" + url.PathEscape(project.ID) + "/redeploy"
+			if err := s.environmentService.callAgent(ctx, client, baseURL, endpoint, target.header(caller), nil, nil); err != nil {
+				return nil, err
+			}
+			return map[string]string{"projectId": project.ID}, nil
+		}
+		return nil, fmt.Errorf("project %q not found", name)
+	})
+}
+
+func (s *EnvironmentBulkService) run(ctx context.Context, caller AggregateCaller, sel dto.EnvironmentSelectorDto, permission models.Permission, action bulkAction) ([]dto.EnvironmentActionResultDto, error) {
+	if sel.Group == "" && len(sel.Tags) == 0 {
+		return nil, ErrEmptyEnvironmentSelector
+	}
+	targets, err := s.aggregateService.targets(ctx, caller, permission, environmentSelector{group: sel.Group, tags: sel.Tags})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]dto.EnvironmentActionResultDto, len(targets))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, aggregateConcurrency)
+	for i, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			envCtx, cancel := context.WithTimeout(ctx, bulkActionTimeout)
+			defer cancel()
+			result := dto.EnvironmentActionResultDto{EnvironmentID: target.id, EnvironmentName: target.name}
+			if target.direct {
+				result.Error = ErrDirectDockerUnsupported.Error()
+				results[i] = result
+				return
+			}
+			client, baseURL, err := s.environmentService.AgentHTTPClient(envCtx, target.id, target.apiURL, 0)
+			var data any
+			if err == nil {
+				data, err = action(envCtx, target, client, baseURL)
+			}
+			if err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Success, result.Data = true, data
+			}
+			results[i] = result
+		}()
+	}
+	wg.Wait()
+	return results, nil
+}
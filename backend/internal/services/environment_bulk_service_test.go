@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ofkm/arcane-backend/internal/config"
+	"github.com/ofkm/arcane-backend/internal/dto"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/utils"
+)
+
+// startProjectTestAgent serves the agent's project listing and redeploy routes for projects.
+func startProjectTestAgent(t *testing.T, projects []dto.ProjectDetailsDto, redeployed *atomic.Int32) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/environments/0/projects", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Arcane-Agent-Token") == "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"success": true, "data": projects, "pagination": map[string]any{"totalItems": len(projects)}})
+	})
+	mux.HandleFunc("POST /api/environments/0/projects/{projectId}/redeploy", func(w http.ResponseWriter, r *http.Request) {
+		redeployed.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]any{"success": true, "data": map[string]string{"message": "ok"}})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestEnvironmentBulk_RedeployProjectByName(t *testing.T) {
+	ctx := context.Background()
+	utils.InitEncryption(&config.Config{})
+
+	db, _ := newAgentTLSTestDB(t, &models.Environment{}, &models.EnvironmentAccess{})
+	envService := NewEnvironmentService(db, nil)
+	bulk := NewEnvironmentBulkService(envService, NewAggregateService(db, envService, nil, nil, nil))
+
+	var deployedA, deployedB, deployedOther atomic.Int32
+	web := []dto.ProjectDetailsDto{{ID: "p-1", Name: "web"}, {ID: "p-2", Name: "web-staging"}}
+	agents := map[string]*httptest.Server{
+		"edge-a":  startProjectTestAgent(t, web, &deployedA),
+		"edge-b":  startProjectTestAgent(t, []dto.ProjectDetailsDto{{ID: "p-3", Name: "web-staging"}}, &deployedB),
+		"central": startProjectTestAgent(t, web, &deployedOther),
+	}
+	for name, agent := range agents {
+		group, token := "edge", name+"-token"
+		env := &models.Environment{Name: name, ApiUrl: agent.URL, Enabled: true, AccessToken: &token, Tags: []string{"prod"}}
+		if name != "central" {
+			env.Group = &group
+		}
+		_, err := envService.CreateEnvironment(ctx, env)
+		require.NoError(t, err)
+	}
+
+	caller := AggregateCaller{User: &models.User{BaseModel: models.BaseModel{ID: "user-1"}}, Permissions: []models.Permission{models.PermissionAll}}
+	_, err := bulk.RedeployProject(ctx, caller, dto.EnvironmentSelectorDto{}, "web")
+	require.ErrorIs(t, err, ErrEmptyEnvironmentSelector)
+
+	results, err := bulk.RedeployProject(ctx, caller, dto.EnvironmentSelectorDto{Group: "edge", Tags: []string{"prod"}}, "web")
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	byName := map[string]dto.EnvironmentActionResultDto{}
+	for _, r := range results {
+		byName[r.EnvironmentName] = r
+	}
+	require.True(t, byName["edge-a"].Success)
+	require.Equal(t, map[string]string{"projectId": "p-1"}, byName["edge-a"].Data)
+	require.False(t, byName["edge-b"].Success)
+	require.Contains(t, byName["edge-b"].Error, `project "web" not found`)
+
+	require.EqualValues(t, 1, deployedA.Load())
+	require.EqualValues(t, 0, deployedB.Load())
+	require.EqualValues(t, 0, deployedOther.Load(), "environments outside the group are left alone")
+
+	// A caller without the deploy permission on the group gets no targets at all.
+	viewer := AggregateCaller{User: caller.User, Permissions: []models.Permission{models.PermissionProjectsRead}}
+	results, err = bulk.RedeployProject(ctx, viewer, dto.EnvironmentSelectorDto{Tags: []string{"prod"}}, "web")
+	require.NoError(t, err)
+	require.Empty(t, results)
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/models"
+)
+
+// environmentProbeConcurrency bounds how many environments are probed at once.
+const environmentProbeConcurrency = 8
+
+// EnvironmentHealthService probes environments in the background and raises events and
+// notifications whenever one changes status, whether the change was seen by a probe, a
+// connection test or the agent's tunnel.
+type EnvironmentHealthService struct {
+	db                  *database.DB
+	environmentService  *EnvironmentService
+	eventService        *EventService
+	notificationService *NotificationService
+}
+
+func NewEnvironmentHealthService(db *database.DB, environmentService *EnvironmentService, eventService *EventService, notificationService *NotificationService) *EnvironmentHealthService {
+	s := &EnvironmentHealthService{
+		db:                  db,
+		environmentService:  environmentService,
+		eventService:        eventService,
+		notificationService: notificationService,
+	}
+	environmentService.health = s
+	return s
+}
+
+// CheckAll probes every enabled environment concurrently, records the results and returns how
+// many environments ended up in each status.
+func (s *EnvironmentHealthService) CheckAll(ctx context.Context) (map[models.EnvironmentStatus]int, error) {
+	var environments []models.Environment
+	if err := s.db.WithContext(ctx).Where("enabled = ?", true).Find(&environments).Error; err != nil {
+		return nil, fmt.Errorf("failed to list environments: %w", err)
+	}
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		errs   []error
+		counts = map[models.EnvironmentStatus]int{}
+		sem    = make(chan struct{}, environmentProbeConcurrency)
+	)
+	for i := range environments {
+		environment := &environments[i]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			err := openAgentToken(environment)
+			if err == nil {
+				probe := s.environmentService.ProbeEnvironment(ctx, environment)
+				err = s.environmentService.RecordProbe(ctx, environment.ID, probe)
+				mu.Lock()
+				counts[probe.Status]++
+				mu.Unlock()
+			}
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("environment %s: %w", environment.ID, err))
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return counts, errors.Join(errs...)
+}
+
+// statusChanged records an event for the transition and notifies the configured providers. An
+// environment coming online for the first time is not worth a notification.
+func (s *EnvironmentHealthService) statusChanged(ctx context.Context, previous *models.Environment, status models.EnvironmentStatus, reason string) {
+	var eventType models.EventType
+	switch status {
+	case models.EnvironmentStatusOnline:
+		eventType = models.EventTypeEnvironmentOnline
+	case models.EnvironmentStatusOffline:
+		eventType = models.EventTypeEnvironmentOffline
+	default:
+		eventType = models.EventTypeEnvironmentError
+	}
+
+	metadata := models.JSON{"previousStatus": previous.Status, "status": string(status)}
+	if reason != "" {
+		metadata["reason"] = reason
+	}
+	if err := s.eventService.LogEnvironmentEvent(ctx, eventType, previous.ID, previous.Name, metadata); err != nil {
+		slog.WarnContext(ctx, "Failed to log environment status event", "environmentId", previous.ID, "error", err)
+	}
+
+	slog.InfoContext(ctx, "Environment status changed", "environmentId", previous.ID, "name", previous.Name, "from", previous.Status, "to", status, "reason", reason)
+	if s.notificationService == nil || (status == models.EnvironmentStatusOnline && previous.LastSeen == nil) {
+		return
+	}
+	// Sending can take a while per provider; don't hold up the probe or the agent's heartbeat.
+	notifyCtx := context.WithoutCancel(ctx)
+	go func() {
+		if err := s.notificationService.SendEnvironmentStatusNotification(notifyCtx, previous.Name, previous.Status, string(status), reason); err != nil {
+			slog.WarnContext(notifyCtx, "Failed to send environment status notification", "environmentId", previous.ID, "error", err)
+		}
+	}()
+}
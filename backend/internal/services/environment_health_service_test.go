@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ofkm/arcane-backend/internal/config"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/utils"
+)
+
+func TestEnvironmentHealth_RecordsTransitions(t *testing.T) {
+	ctx := context.Background()
+	utils.InitEncryption(&config.Config{})
+
+	db, _ := newAgentTLSTestDB(t, &models.Environment{}, &models.EnvironmentAccess{}, &models.Event{})
+	envService := NewEnvironmentService(db, nil)
+	eventService := NewEventService(db)
+	health := NewEnvironmentHealthService(db, envService, eventService, nil)
+
+	const token = "health-agent-token-0123456789abcdef"
+	var dockerDown atomic.Bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("GET /api/environments/0/system/docker/info", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Arcane-Agent-Token") != token {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if dockerDown.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"version": "27.3.1"})
+	})
+	agent := httptest.NewServer(mux)
+	t.Cleanup(agent.Close)
+
+	accessToken := token
+	env, err := envService.CreateEnvironment(ctx, &models.Environment{Name: "edge", ApiUrl: agent.URL, Enabled: true, AccessToken: &accessToken})
+	require.NoError(t, err)
+	disabled, err := envService.CreateEnvironment(ctx, &models.Environment{Name: "parked", ApiUrl: "http://127.0.0.1:1", Enabled: false})
+	require.NoError(t, err)
+
+	statusOf := func(id string) models.Environment {
+		t.Helper()
+		var stored models.Environment
+		require.NoError(t, db.Where("id = ?", id).First(&stored).Error)
+		return stored
+	}
+	eventTypes := func() []string {
+		t.Helper()
+		var events []models.Event
+		require.NoError(t, db.Where("environment_id = ?", env.ID).Order("timestamp asc").Find(&events).Error)
+		types := make([]string, 0, len(events))
+		for _, e := range events {
+			types = append(types, string(e.Type))
+		}
+		return types
+	}
+
+	counts, err := health.CheckAll(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, counts[models.EnvironmentStatusOnline])
+	stored := statusOf(env.ID)
+	require.Equal(t, "online", stored.Status)
+	require.NotNil(t, stored.LastSeen)
+	require.NotNil(t, stored.LatencyMs)
+	require.Equal(t, "27.3.1", *stored.DockerVersion)
+	require.Equal(t, "offline", statusOf(disabled.ID).Status, "disabled environments are not probed")
+
+	// A second probe with the same outcome is not a transition.
+	_, err = health.CheckAll(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"environment.online"}, eventTypes())
+
+	dockerDown.Store(true)
+	_, err = health.CheckAll(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "error", statusOf(env.ID).Status)
+
+	agent.Close()
+	counts, err = health.CheckAll(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, counts[models.EnvironmentStatusOffline])
+	stored = statusOf(env.ID)
+	require.Equal(t, "offline", stored.Status)
+	require.Equal(t, "27.3.1", *stored.DockerVersion, "the last known version is kept while offline")
+
+	// The agent's tunnel heartbeat brings the environment back online.
+	require.NoError(t, envService.UpdateEnvironmentHeartbeat(ctx, env.ID))
+	require.Equal(t, []string{"environment.online", "environment.error", "environment.offline", "environment.online"}, eventTypes())
+}
@@ -0,0 +1,245 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/dto"
+	"github.com/ofkm/arcane-backend/internal/models"
+)
+
+const (
+	// minScheduleInterval is the shortest polling or update interval honoured; shorter ones fall
+	// back to fallbackScheduleInterval, as they always have for the global settings.
+	minScheduleInterval      = 5 * time.Minute
+	fallbackScheduleInterval = 60 * time.Minute
+)
+
+var ErrLocalEnvironmentSchedule = errors.New("the local environment follows the global settings")
+
+// EnvironmentSchedule is the image polling and update policy an environment runs on: its own
+// overrides applied on top of the global settings.
+type EnvironmentSchedule struct {
+	EnvironmentID      string
+	PollingEnabled     bool
+	PollingInterval    time.Duration
+	AutoUpdate         bool
+	AutoUpdateInterval time.Duration
+	PruneMode          string
+}
+
+// EnvironmentScheduleService resolves per-environment polling and update policies and runs the
+// scheduled checks and updates on remote agents. The manager drives these for every agent, so
+// the agents' own polling and update jobs are switched off when a policy is pushed to them.
+type EnvironmentScheduleService struct {
+	db                 *database.DB
+	environmentService *EnvironmentService
+	settingsService    *SettingsService
+
+	// OnScheduleChanged is called after an environment's schedule may have changed, so the
+	// polling and update jobs can be rescheduled.
+	OnScheduleChanged func(ctx context.Context)
+}
+
+func NewEnvironmentScheduleService(db *database.DB, environmentService *EnvironmentService, settingsService *SettingsService) *EnvironmentScheduleService {
+	s := &EnvironmentScheduleService{db: db, environmentService: environmentService, settingsService: settingsService}
+	environmentService.schedules = s
+	return s
+}
+
+// Global returns the schedule the global settings describe, which the local environment follows.
+func (s *EnvironmentScheduleService) Global(ctx context.Context) EnvironmentSchedule {
+	return EnvironmentSchedule{
+		EnvironmentID:      localEnvironmentID,
+		PollingEnabled:     s.settingsService.GetBoolSetting(ctx, "pollingEnabled", true),
+		PollingInterval:    scheduleInterval(s.settingsService.GetIntSetting(ctx, "pollingInterval", 60)),
+		AutoUpdate:         s.settingsService.GetBoolSetting(ctx, "autoUpdate", false),
+		AutoUpdateInterval: scheduleInterval(s.settingsService.GetIntSetting(ctx, "autoUpdateInterval", 1440)),
+		PruneMode:          s.settingsService.GetStringSetting(ctx, "dockerPruneMode", "dangling"),
+	}
+}
+
+// Effective applies the environment's overrides to the global settings.
+func (s *EnvironmentScheduleService) Effective(ctx context.Context, environment *models.Environment) EnvironmentSchedule {
+	schedule := s.Global(ctx)
+	schedule.EnvironmentID = environment.ID
+	if environment.PollingEnabled != nil {
+		schedule.PollingEnabled = *environment.PollingEnabled
+	}
+	if environment.PollingInterval != nil {
+		schedule.PollingInterval = scheduleInterval(*environment.PollingInterval)
+	}
+	if environment.AutoUpdate != nil {
+		schedule.AutoUpdate = *environment.AutoUpdate
+	}
+	if environment.AutoUpdateInterval != nil {
+		schedule.AutoUpdateInterval = scheduleInterval(*environment.AutoUpdateInterval)
+	}
+	if environment.PruneMode != nil {
+		schedule.PruneMode = *environment.PruneMode
+	}
+	return schedule
+}
+
+// RemoteSchedules returns the effective schedules of the enabled agent environments.
+func (s *EnvironmentScheduleService) RemoteSchedules(ctx context.Context) ([]EnvironmentSchedule, error) {
+	var environments []models.Environment
+	err := s.db.WithContext(ctx).
+		Where("enabled = ? AND COALESCE(type, ?) = ?", true, models.EnvironmentTypeAgent, models.EnvironmentTypeAgent).
+		Find(&environments).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list environments: %w", err)
+	}
+	schedules := make([]EnvironmentSchedule, 0, len(environments))
+	for i := range environments {
+		schedules = append(schedules, s.Effective(ctx, &environments[i]))
+	}
+	return schedules, nil
+}
+
+// GetSchedule returns the environment's overrides and the schedule in effect.
+func (s *EnvironmentScheduleService) GetSchedule(ctx context.Context, id string) (*dto.EnvironmentScheduleResponseDto, error) {
+	if id == localEnvironmentID {
+		return scheduleResponse(dto.EnvironmentScheduleDto{}, s.Global(ctx)), nil
+	}
+	environment, err := s.environmentService.GetEnvironmentByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return scheduleResponse(scheduleOverrides(environment), s.Effective(ctx, environment)), nil
+}
+
+// SetSchedule replaces the environment's overrides and pushes the result to its agent. An agent
+// that cannot be reached picks the policy up with its next scheduled run.
+func (s *EnvironmentScheduleService) SetSchedule(ctx context.Context, id string, req dto.EnvironmentScheduleDto) (*dto.EnvironmentScheduleResponseDto, error) {
+	if id == localEnvironmentID {
+		return nil, ErrLocalEnvironmentSchedule
+	}
+	environment, err := s.environmentService.GetEnvironmentByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if environment.Type == models.EnvironmentTypeDocker {
+		return nil, fmt.Errorf("image polling and updates are %w", ErrDirectDockerUnsupported)
+	}
+
+	updates := map[string]interface{}{
+		"polling_enabled":      req.PollingEnabled,
+		"polling_interval":     req.PollingInterval,
+		"auto_update":          req.AutoUpdate,
+		"auto_update_interval": req.AutoUpdateInterval,
+		"prune_mode":           req.PruneMode,
+		"updated_at":           time.Now(),
+	}
+	if err := s.db.WithContext(ctx).Model(&models.Environment{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to update environment schedule: %w", err)
+	}
+	environment.PollingEnabled, environment.PollingInterval = req.PollingEnabled, req.PollingInterval
+	environment.AutoUpdate, environment.AutoUpdateInterval = req.AutoUpdate, req.AutoUpdateInterval
+	environment.PruneMode = req.PruneMode
+	schedule := s.Effective(ctx, environment)
+
+	s.changed(ctx)
+	if environment.Enabled {
+		if err := s.pushToAgent(ctx, environment, schedule); err != nil {
+			slog.WarnContext(ctx, "Failed to push schedule to agent", "environmentId", id, "error", err)
+		}
+	}
+	return scheduleResponse(req, schedule), nil
+}
+
+// CheckImages checks a remote environment's images for updates when its schedule polls.
+func (s *EnvironmentScheduleService) CheckImages(ctx context.Context, id string) error {
+	return s.runRemote(ctx, id, func(schedule EnvironmentSchedule) bool { return schedule.PollingEnabled }, "/image-updates/check-all", struct{}{})
+}
+
+// ApplyUpdates applies pending image updates on a remote environment when its schedule
+// auto-updates.
+func (s *EnvironmentScheduleService) ApplyUpdates(ctx context.Context, id string) error {
+	return s.runRemote(ctx, id, func(schedule EnvironmentSchedule) bool {
+		return schedule.PollingEnabled && schedule.AutoUpdate
+	}, "/updater/run", dto.UpdaterRunRequest{})
+}
+
+// runRemote calls endpoint on the environment's agent if the environment is still enabled and
+// its current schedule wants the run, pushing the schedule first so the agent's own jobs stay off.
+func (s *EnvironmentScheduleService) runRemote(ctx context.Context, id string, wanted func(EnvironmentSchedule) bool, endpoint string, body any) error {
+	environment, err := s.environmentService.GetEnvironmentByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !environment.Enabled || environment.Type == models.EnvironmentTypeDocker {
+		return nil
+	}
+	schedule := s.Effective(ctx, environment)
+	if !wanted(schedule) {
+		return nil
+	}
+	if err := s.pushToAgent(ctx, environment, schedule); err != nil {
+		return err
+	}
+	client, baseURL, err := s.environmentService.AgentHTTPClient(ctx, id, environment.ApiUrl, 0)
+	if err != nil {
+		return err
+	}
+	return s.environmentService.callAgent(ctx, client, baseURL, endpoint, agentTokenHeader(*environment.AccessToken), body, nil)
+}
+
+// pushToAgent switches the agent's own polling and update jobs off, since the manager now runs
+// them on the environment's schedule, and hands it the prune mode.
+func (s *EnvironmentScheduleService) pushToAgent(ctx context.Context, environment *models.Environment, schedule EnvironmentSchedule) error {
+	if environment.AccessToken == nil || *environment.AccessToken == "" {
+		return ErrAgentNotPaired
+	}
+	client, baseURL, err := s.environmentService.AgentHTTPClient(ctx, environment.ID, environment.ApiUrl, 0)
+	if err != nil {
+		return err
+	}
+	settings := dto.UpdateSettingsDto{}
+	off := "false"
+	settings.PollingEnabled, settings.AutoUpdate, settings.PruneMode = &off, &off, &schedule.PruneMode
+	return s.environmentService.callAgentMethod(ctx, client, http.MethodPut, baseURL, "/settings", agentTokenHeader(*environment.AccessToken), settings, nil)
+}
+
+func (s *EnvironmentScheduleService) changed(ctx context.Context) {
+	if s.OnScheduleChanged != nil {
+		s.OnScheduleChanged(ctx)
+	}
+}
+
+// scheduleInterval turns minutes into an interval, falling back for ones too short to honour.
+func scheduleInterval(minutes int) time.Duration {
+	interval := time.Duration(minutes) * time.Minute
+	if interval < minScheduleInterval {
+		return fallbackScheduleInterval
+	}
+	return interval
+}
+
+func scheduleOverrides(environment *models.Environment) dto.EnvironmentScheduleDto {
+	return dto.EnvironmentScheduleDto{
+		PollingEnabled:     environment.PollingEnabled,
+		PollingInterval:    environment.PollingInterval,
+		AutoUpdate:         environment.AutoUpdate,
+		AutoUpdateInterval: environment.AutoUpdateInterval,
+		PruneMode:          environment.PruneMode,
+	}
+}
+
+func scheduleResponse(overrides dto.EnvironmentScheduleDto, schedule EnvironmentSchedule) *dto.EnvironmentScheduleResponseDto {
+	return &dto.EnvironmentScheduleResponseDto{
+		Overrides: overrides,
+		Effective: dto.EffectiveScheduleDto{
+			PollingEnabled:     schedule.PollingEnabled,
+			PollingInterval:    int(schedule.PollingInterval / time.Minute),
+			AutoUpdate:         schedule.AutoUpdate,
+			AutoUpdateInterval: int(schedule.AutoUpdateInterval / time.Minute),
+			PruneMode:          schedule.PruneMode,
+		},
+	}
+}
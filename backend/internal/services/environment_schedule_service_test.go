@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ofkm/arcane-backend/internal/config"
+	"github.com/ofkm/arcane-backend/internal/dto"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/utils"
+)
+
+// scheduleTestAgent records the settings pushes and scheduled runs an agent receives.
+type scheduleTestAgent struct {
+	mu       sync.Mutex
+	settings []dto.UpdateSettingsDto
+	calls    []string
+}
+
+func (a *scheduleTestAgent) start(t *testing.T) *httptest.Server {
+	t.Helper()
+	ok := func(w http.ResponseWriter) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"success": true, "data": map[string]string{}})
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /api/environments/0/settings", func(w http.ResponseWriter, r *http.Request) {
+		var req dto.UpdateSettingsDto
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		a.mu.Lock()
+		a.settings = append(a.settings, req)
+		a.mu.Unlock()
+		ok(w)
+	})
+	for _, path := range []string{"/api/environments/0/image-updates/check-all", "/api/environments/0/updater/run"} {
+		mux.HandleFunc("POST "+path, func(w http.ResponseWriter, r *http.Request) {
+			a.mu.Lock()
+			a.calls = append(a.calls, r.URL.Path)
+			a.mu.Unlock()
+			ok(w)
+		})
+	}
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestEnvironmentSchedule_OverridesGlobalSettings(t *testing.T) {
+	ctx := context.Background()
+	utils.InitEncryption(&config.Config{})
+	db, settings := newAgentTLSTestDB(t, &models.Environment{})
+	envService := NewEnvironmentService(db, nil)
+	schedules := NewEnvironmentScheduleService(db, envService, settings)
+	require.NoError(t, settings.SetIntSetting(ctx, "pollingInterval", 30))
+	require.NoError(t, settings.SetBoolSetting(ctx, "autoUpdate", true))
+
+	changes := 0
+	schedules.OnScheduleChanged = func(context.Context) { changes++ }
+
+	agent := &scheduleTestAgent{}
+	srv := agent.start(t)
+	token := "prod-token"
+	prod, err := envService.CreateEnvironment(ctx, &models.Environment{Name: "prod", ApiUrl: srv.URL, Enabled: true, AccessToken: &token})
+	require.NoError(t, err)
+	require.Equal(t, 1, changes, "a new environment is scheduled")
+
+	// Without overrides the environment follows the global settings.
+	got, err := schedules.GetSchedule(ctx, prod.ID)
+	require.NoError(t, err)
+	require.Equal(t, dto.EffectiveScheduleDto{PollingEnabled: true, PollingInterval: 30, AutoUpdate: true, AutoUpdateInterval: 1440, PruneMode: "dangling"}, got.Effective)
+
+	// Production checks weekly and never updates on its own.
+	weekly, never, all := 7*24*60, false, "all"
+	got, err = schedules.SetSchedule(ctx, prod.ID, dto.EnvironmentScheduleDto{PollingInterval: &weekly, AutoUpdate: &never, PruneMode: &all})
+	require.NoError(t, err)
+	require.Equal(t, dto.EffectiveScheduleDto{PollingEnabled: true, PollingInterval: weekly, AutoUpdate: false, AutoUpdateInterval: 1440, PruneMode: "all"}, got.Effective)
+	require.Equal(t, 2, changes)
+
+	// The agent's own jobs are switched off and it is handed the prune mode.
+	require.Len(t, agent.settings, 1)
+	require.Equal(t, "false", *agent.settings[0].PollingEnabled)
+	require.Equal(t, "false", *agent.settings[0].AutoUpdate)
+	require.Equal(t, "all", *agent.settings[0].PruneMode)
+
+	remote, err := schedules.RemoteSchedules(ctx)
+	require.NoError(t, err)
+	require.Len(t, remote, 1)
+	require.Equal(t, 7*24*time.Hour, remote[0].PollingInterval)
+
+	// Checks run, updates are skipped by the policy.
+	require.NoError(t, schedules.CheckImages(ctx, prod.ID))
+	require.NoError(t, schedules.ApplyUpdates(ctx, prod.ID))
+	require.Equal(t, []string{"/api/environments/0/image-updates/check-all"}, agent.calls)
+
+	// Global changes still reach fields that are not overridden.
+	require.NoError(t, settings.SetIntSetting(ctx, "autoUpdateInterval", 120))
+	got, err = schedules.GetSchedule(ctx, prod.ID)
+	require.NoError(t, err)
+	require.Equal(t, 120, got.Effective.AutoUpdateInterval)
+	require.Equal(t, weekly, *got.Overrides.PollingInterval)
+	require.Nil(t, got.Overrides.PollingEnabled)
+
+	// Disabled environments drop out of the remote schedules.
+	_, err = envService.UpdateEnvironment(ctx, prod.ID, map[string]interface{}{"enabled": false})
+	require.NoError(t, err)
+	require.Equal(t, 3, changes)
+	remote, err = schedules.RemoteSchedules(ctx)
+	require.NoError(t, err)
+	require.Empty(t, remote)
+
+	_, err = schedules.SetSchedule(ctx, localEnvironmentID, dto.EnvironmentScheduleDto{})
+	require.ErrorIs(t, err, ErrLocalEnvironmentSchedule)
+}
@@ -1,37 +1,59 @@
 package services
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
 	"net/http"
 	"net/url"
 	"path"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
 	"github.com/ofkm/arcane-backend/internal/database"
 	"github.com/ofkm/arcane-backend/internal/dto"
 	"github.com/ofkm/arcane-backend/internal/models"
 	"github.com/ofkm/arcane-backend/internal/utils"
+	"github.com/ofkm/arcane-backend/internal/utils/circuit"
+	"github.com/ofkm/arcane-backend/internal/utils/docker"
 	"github.com/ofkm/arcane-backend/internal/utils/pagination"
+	"golang.org/x/crypto/ssh"
 	"gorm.io/gorm"
 )
 
+var (
+	ErrAgentNotPaired        = errors.New("environment has no agent token")
+	ErrInvalidEnvironmentTag = errors.New("tags and groups may only contain lowercase letters, digits, '.', '_', ':' and '-' and be at most 63 characters long")
+	ErrInvalidDockerHost     = errors.New("invalid direct Docker environment")
+	environmentTagPattern    = regexp.MustCompile(`^[a-z0-9][a-z0-9._:-]{0,62}$`)
+)
+
 type EnvironmentService struct {
 	db         *database.DB
 	httpClient *http.Client
+	tunnels    *TunnelService
+	certs      *AgentCertificateService
+	health     *EnvironmentHealthService
+	schedules  *EnvironmentScheduleService
+	circuits   *circuit.Set
 }
 
 func NewEnvironmentService(db *database.DB, httpClient *http.Client) *EnvironmentService {
 	if httpClient == nil {
 		httpClient = http.DefaultClient
 	}
-	return &EnvironmentService{db: db, httpClient: httpClient}
+	return &EnvironmentService{db: db, httpClient: httpClient, circuits: circuit.NewSet(agentCircuitThreshold, agentCircuitCooldown)}
 }
 
 func (s *EnvironmentService) CreateEnvironment(ctx context.Context, environment *models.Environment) (*models.Environment, error) {
@@ -41,10 +63,50 @@ func (s *EnvironmentService) CreateEnvironment(ctx context.Context, environment
 	environment.CreatedAt = now
 	environment.UpdatedAt = &now
 
+	var err error
+	if environment.Tags, err = normalizeEnvironmentTags(environment.Tags); err != nil {
+		return nil, err
+	}
+	if environment.Group, err = normalizeEnvironmentGroup(environment.Group); err != nil {
+		return nil, err
+	}
+
+	switch environment.Type {
+	case "", models.EnvironmentTypeAgent:
+		environment.Type = models.EnvironmentTypeAgent
+		environment.SshPrivateKey, environment.SshHostKey = nil, nil
+		environment.TlsCaCert, environment.TlsCert, environment.TlsKey = nil, nil, nil
+	case models.EnvironmentTypeDocker:
+		if err := validateDockerHost(environment); err != nil {
+			return nil, err
+		}
+		environment.AccessToken = nil
+		if environment.SshPrivateKey, err = encryptDockerKey(environment.SshPrivateKey); err != nil {
+			return nil, err
+		}
+		if environment.TlsKey, err = encryptDockerKey(environment.TlsKey); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown type %q", ErrInvalidDockerHost, environment.Type)
+	}
+
+	token := environment.AccessToken
+	if token != nil && *token != "" {
+		encrypted, err := utils.Encrypt(*token)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt agent token: %w", err)
+		}
+		hash := hashAgentToken(*token)
+		environment.AccessToken, environment.AccessTokenHash = &encrypted, &hash
+	}
+
 	if err := s.db.WithContext(ctx).Create(environment).Error; err != nil {
 		return nil, fmt.Errorf("failed to create environment: %w", err)
 	}
+	s.scheduleChanged(ctx)
 
+	environment.AccessToken = token
 	return environment, nil
 }
 
@@ -56,21 +118,47 @@ func (s *EnvironmentService) GetEnvironmentByID(ctx context.Context, id string)
 		}
 		return nil, fmt.Errorf("failed to get environment: %w", err)
 	}
+	if err := openAgentToken(&environment); err != nil {
+		return nil, err
+	}
 	return &environment, nil
 }
 
-func (s *EnvironmentService) ListEnvironmentsPaginated(ctx context.Context, params pagination.QueryParams) ([]dto.EnvironmentDto, pagination.Response, error) {
+// ListEnvironmentsPaginated lists environments visible to user. A nil user or one holding the "*"
+// permission sees everything; otherwise environments restricted by access grants the user does
+// not hold are left out.
+func (s *EnvironmentService) ListEnvironmentsPaginated(ctx context.Context, params pagination.QueryParams, user *models.User, perms []models.Permission) ([]dto.EnvironmentDto, pagination.Response, error) {
 	var envs []models.Environment
 	q := s.db.WithContext(ctx).Model(&models.Environment{})
 
+	if user != nil && !models.HasPermission(perms, models.PermissionAll) {
+		hidden, err := s.hiddenEnvironmentIDs(ctx, user)
+		if err != nil {
+			return nil, pagination.Response{}, err
+		}
+		if len(hidden) > 0 {
+			q = q.Where("id NOT IN ?", hidden)
+		}
+	}
+
 	if term := strings.TrimSpace(params.Search); term != "" {
 		searchPattern := "%" + term + "%"
 		q = q.Where(
-			"name LIKE ? OR api_url LIKE ?",
-			searchPattern, searchPattern,
+			"name LIKE ? OR api_url LIKE ? OR COALESCE(group_name, '') LIKE ?",
+			searchPattern, searchPattern, searchPattern,
 		)
 	}
 
+	if group := params.Filters["group"]; group != "" {
+		q = q.Where("group_name = ?", strings.ToLower(group))
+	}
+	// tag takes a comma-separated list; environments must carry all of them.
+	for _, tag := range strings.Split(params.Filters["tag"], ",") {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+			q = q.Where(`CAST(tags AS TEXT) LIKE ? ESCAPE '\'`, tagPattern(tag))
+		}
+	}
+
 	if status := params.Filters["status"]; status != "" {
 		q = q.Where("status = ?", status)
 	}
@@ -100,126 +188,857 @@ func (s *EnvironmentService) UpdateEnvironment(ctx context.Context, id string, u
 	now := time.Now()
 	updates["updated_at"] = &now
 
+	if tags, ok := updates["tags"].([]string); ok {
+		normalized, err := normalizeEnvironmentTags(tags)
+		if err != nil {
+			return nil, err
+		}
+		updates["tags"] = models.StringSlice(normalized)
+	}
+	if group, ok := updates["group_name"].(string); ok {
+		normalized, err := normalizeEnvironmentGroup(&group)
+		if err != nil {
+			return nil, err
+		}
+		updates["group_name"] = normalized
+	}
+	if err := s.prepareDockerHostUpdates(ctx, id, updates); err != nil {
+		return nil, err
+	}
+
+	token, tokenChanged := updates["access_token"]
+	if tokenChanged {
+		tokenStr, _ := token.(string)
+		sealed, err := sealAgentToken(tokenStr)
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(updates, sealed)
+	}
+
 	if err := s.db.WithContext(ctx).Model(&models.Environment{}).Where("id = ?", id).Updates(updates).Error; err != nil {
 		return nil, fmt.Errorf("failed to update environment: %w", err)
 	}
 
+	// A tunnel authenticated with the old token, or for a now disabled environment, must not
+	// outlive the change.
+	enabled, enabledChanged := updates["enabled"].(bool)
+	if tokenChanged || (enabledChanged && !enabled) {
+		s.disconnectTunnel(id)
+	}
+	// A new address or a re-enabled environment deserves a fresh chance.
+	if _, urlChanged := updates["api_url"]; urlChanged || (enabledChanged && enabled) {
+		s.circuits.Remove(id)
+	}
+	if enabledChanged {
+		s.scheduleChanged(ctx)
+	}
+
 	return s.GetEnvironmentByID(ctx, id)
 }
 
+// normalizeEnvironmentTags lowercases, validates and de-duplicates tags.
+func normalizeEnvironmentTags(tags []string) (models.StringSlice, error) {
+	out := models.StringSlice{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || slices.Contains(out, tag) {
+			continue
+		}
+		if !environmentTagPattern.MatchString(tag) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidEnvironmentTag, tag)
+		}
+		out = append(out, tag)
+	}
+	slices.Sort(out)
+	return out, nil
+}
+
+// normalizeEnvironmentGroup validates a group name; an empty one means no group.
+func normalizeEnvironmentGroup(group *string) (*string, error) {
+	if group == nil {
+		return nil, nil
+	}
+	normalized := strings.ToLower(strings.TrimSpace(*group))
+	if normalized == "" {
+		return nil, nil
+	}
+	if !environmentTagPattern.MatchString(normalized) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidEnvironmentTag, normalized)
+	}
+	return &normalized, nil
+}
+
+// dockerHostColumns are the columns that make up a direct Docker environment's connection.
+var dockerHostColumns = []string{"api_url", "ssh_private_key", "ssh_host_key", "tls_ca_cert", "tls_cert", "tls_key"}
+
+// prepareDockerHostUpdates validates changes to a direct Docker environment's host and
+// credentials as a whole and encrypts new private keys. Moving an ssh:// environment to another
+// host drops its pinned host key unless a new one is given.
+func (s *EnvironmentService) prepareDockerHostUpdates(ctx context.Context, id string, updates map[string]interface{}) error {
+	if !slices.ContainsFunc(dockerHostColumns, func(column string) bool { _, ok := updates[column]; return ok }) {
+		return nil
+	}
+	var environment models.Environment
+	if err := s.db.WithContext(ctx).Where("id = ?", id).First(&environment).Error; err != nil {
+		return fmt.Errorf("failed to get environment: %w", err)
+	}
+	if environment.Type != models.EnvironmentTypeDocker {
+		for _, column := range dockerHostColumns[1:] {
+			if _, ok := updates[column]; ok {
+				return fmt.Errorf("%w: only direct Docker environments take SSH or TLS credentials", ErrInvalidDockerHost)
+			}
+		}
+		return nil
+	}
+
+	for _, key := range []**string{&environment.SshPrivateKey, &environment.TlsKey} {
+		if *key == nil || **key == "" {
+			continue
+		}
+		plain, err := utils.Decrypt(**key)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt Docker host key: %w", err)
+		}
+		*key = &plain
+	}
+	if apiURL, ok := updates["api_url"].(string); ok && apiURL != environment.ApiUrl {
+		if _, ok := updates["ssh_host_key"]; !ok {
+			updates["ssh_host_key"] = nil
+		}
+		environment.ApiUrl = apiURL
+	}
+	fields := map[string]**string{
+		"ssh_private_key": &environment.SshPrivateKey,
+		"ssh_host_key":    &environment.SshHostKey,
+		"tls_ca_cert":     &environment.TlsCaCert,
+		"tls_cert":        &environment.TlsCert,
+		"tls_key":         &environment.TlsKey,
+	}
+	for column, field := range fields {
+		value, ok := updates[column]
+		if !ok {
+			continue
+		}
+		if str, _ := value.(string); str != "" {
+			*field = &str
+		} else {
+			*field, updates[column] = nil, nil
+		}
+	}
+	if err := validateDockerHost(&environment); err != nil {
+		return err
+	}
+
+	for _, column := range []string{"ssh_private_key", "tls_key"} {
+		if value, ok := updates[column].(string); ok {
+			sealed, err := encryptDockerKey(&value)
+			if err != nil {
+				return err
+			}
+			updates[column] = *sealed
+		}
+	}
+	return nil
+}
+
+// validateDockerHost checks that a direct Docker environment's host and plaintext credentials
+// fit together: an ssh:// host needs a private key, a tcp:// host a CA and client certificate.
+func validateDockerHost(environment *models.Environment) error {
+	if err := ValidateDockerHost(environment.ApiUrl); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidDockerHost, err)
+	}
+	if strings.HasPrefix(environment.ApiUrl, "ssh://") {
+		if environment.SshPrivateKey == nil || *environment.SshPrivateKey == "" {
+			return fmt.Errorf("%w: an SSH private key is required", ErrInvalidDockerHost)
+		}
+		if _, err := ssh.ParsePrivateKey([]byte(*environment.SshPrivateKey)); err != nil {
+			return fmt.Errorf("%w: invalid SSH private key: %w", ErrInvalidDockerHost, err)
+		}
+		if environment.SshHostKey != nil && *environment.SshHostKey != "" {
+			if _, _, _, _, err := ssh.ParseAuthorizedKey([]byte(*environment.SshHostKey)); err != nil {
+				return fmt.Errorf("%w: invalid SSH host key: %w", ErrInvalidDockerHost, err)
+			}
+		}
+		environment.TlsCaCert, environment.TlsCert, environment.TlsKey = nil, nil, nil
+		return nil
+	}
+	if environment.TlsCaCert == nil || environment.TlsCert == nil || environment.TlsKey == nil {
+		return fmt.Errorf("%w: a CA certificate, client certificate and client key are required", ErrInvalidDockerHost)
+	}
+	if _, err := docker.TLSConfig(*environment.TlsCaCert, *environment.TlsCert, *environment.TlsKey); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidDockerHost, err)
+	}
+	environment.SshPrivateKey, environment.SshHostKey = nil, nil
+	return nil
+}
+
+func encryptDockerKey(key *string) (*string, error) {
+	if key == nil || *key == "" {
+		return nil, nil
+	}
+	encrypted, err := utils.Encrypt(*key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt Docker host key: %w", err)
+	}
+	return &encrypted, nil
+}
+
+// tagPattern matches tag inside the JSON array the tags column holds, escaping the LIKE wildcard
+// "_" that tags may contain.
+func tagPattern(tag string) string {
+	encoded, _ := json.Marshal(tag)
+	return "%" + strings.ReplaceAll(string(encoded), "_", `\_`) + "%"
+}
+
 func (s *EnvironmentService) DeleteEnvironment(ctx context.Context, id string) error {
-	if err := s.db.WithContext(ctx).Delete(&models.Environment{}, "id = ?", id).Error; err != nil {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.EnvironmentAccess{}, "environment_id = ?", id).Error; err != nil {
+			return err
+		}
+		if s.certs != nil {
+			if err := s.certs.DeleteForEnvironment(ctx, tx, id); err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&models.Environment{}, "id = ?", id).Error
+	})
+	if err != nil {
 		return fmt.Errorf("failed to delete environment: %w", err)
 	}
+	s.disconnectTunnel(id)
+	s.circuits.Remove(id)
+	s.scheduleChanged(ctx)
 	return nil
 }
 
+// scheduleChanged lets the polling and update jobs follow environments coming and going.
+func (s *EnvironmentService) scheduleChanged(ctx context.Context) {
+	if s.schedules != nil {
+		s.schedules.changed(ctx)
+	}
+}
+
+func (s *EnvironmentService) disconnectTunnel(id string) {
+	if s.tunnels != nil {
+		s.tunnels.Disconnect(id)
+	}
+}
+
 func (s *EnvironmentService) TestConnection(ctx context.Context, id string) (string, error) {
 	environment, err := s.GetEnvironmentByID(ctx, id)
 	if err != nil {
 		return "error", err
 	}
 
+	probe := s.ProbeEnvironment(ctx, environment)
+	if err := s.RecordProbe(ctx, id, probe); err != nil {
+		slog.WarnContext(ctx, "Failed to record environment status", "environmentId", id, "error", err)
+	}
+	return string(probe.Status), probe.Err
+}
+
+// EnvironmentProbe is the outcome of probing an environment's agent.
+type EnvironmentProbe struct {
+	Status        models.EnvironmentStatus
+	Latency       time.Duration
+	DockerVersion string
+	Err           error
+}
+
+// ProbeEnvironment checks that the environment's agent answers its health check and, once it is
+// paired, that its Docker daemon responds; a direct Docker environment's daemon is pinged
+// instead. The result is not recorded.
+func (s *EnvironmentService) ProbeEnvironment(ctx context.Context, environment *models.Environment) EnvironmentProbe {
 	reqCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
-	url := strings.TrimRight(environment.ApiUrl, "/") + "/api/health"
-	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, url, nil)
+
+	if environment.Type == models.EnvironmentTypeDocker {
+		return s.probeDockerHost(reqCtx, environment)
+	}
+
+	// Probes bypass the circuit breaker: they are how an unavailable agent is found to be back.
+	client, baseURL, err := s.agentHTTPClient(reqCtx, environment.ID, environment.ApiUrl, 0)
 	if err != nil {
-		_ = s.updateEnvironmentStatusInternal(ctx, id, string(models.EnvironmentStatusOffline))
-		return "offline", fmt.Errorf("failed to create request: %w", err)
+		return EnvironmentProbe{Status: models.EnvironmentStatusOffline, Err: err}
 	}
-	resp, err := s.httpClient.Do(req)
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, baseURL+"/api/health", nil)
 	if err != nil {
-		_ = s.updateEnvironmentStatusInternal(ctx, id, string(models.EnvironmentStatusOffline))
-		return "offline", fmt.Errorf("connection failed: %w", err)
+		return EnvironmentProbe{Status: models.EnvironmentStatusOffline, Err: fmt.Errorf("failed to create request: %w", err)}
 	}
-	defer resp.Body.Close()
+	started := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return EnvironmentProbe{Status: models.EnvironmentStatusOffline, Err: fmt.Errorf("connection failed: %w", err)}
+	}
+	latency := time.Since(started)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return EnvironmentProbe{Status: models.EnvironmentStatusError, Latency: latency, Err: fmt.Errorf("unexpected status code: %d", resp.StatusCode)}
+	}
+
+	probe := EnvironmentProbe{Status: models.EnvironmentStatusOnline, Latency: latency}
+	if environment.AccessToken == nil || *environment.AccessToken == "" {
+		return probe
+	}
+	if probe.DockerVersion, err = agentDockerVersion(reqCtx, client, baseURL, *environment.AccessToken); err != nil {
+		return EnvironmentProbe{Status: models.EnvironmentStatusError, Latency: latency, Err: fmt.Errorf("docker is not responding: %w", err)}
+	}
+	return probe
+}
 
-	if resp.StatusCode == http.StatusOK {
-		_ = s.updateEnvironmentStatusInternal(ctx, id, string(models.EnvironmentStatusOnline))
-		return "online", nil
+// probeDockerHost pings a direct Docker environment's daemon.
+func (s *EnvironmentService) probeDockerHost(ctx context.Context, environment *models.Environment) EnvironmentProbe {
+	cli, err := newEnvironmentDockerClient(ctx, s.db, environment)
+	if err != nil {
+		return EnvironmentProbe{Status: models.EnvironmentStatusError, Err: err}
 	}
+	defer cli.Close()
 
-	_ = s.updateEnvironmentStatusInternal(ctx, id, string(models.EnvironmentStatusError))
-	return "error", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	started := time.Now()
+	if _, err := cli.Ping(ctx); err != nil {
+		return EnvironmentProbe{Status: models.EnvironmentStatusOffline, Err: fmt.Errorf("connection failed: %w", err)}
+	}
+	latency := time.Since(started)
+	version, err := cli.ServerVersion(ctx)
+	if err != nil {
+		return EnvironmentProbe{Status: models.EnvironmentStatusError, Latency: latency, Err: fmt.Errorf("docker is not responding: %w", err)}
+	}
+	return EnvironmentProbe{Status: models.EnvironmentStatusOnline, Latency: latency, DockerVersion: version.Version}
 }
 
-func (s *EnvironmentService) updateEnvironmentStatusInternal(ctx context.Context, id, status string) error {
-	now := time.Now()
-	updates := map[string]interface{}{
-		"status":     status,
-		"last_seen":  &now,
-		"updated_at": &now,
+// RecordProbe stores the outcome of a probe on the environment.
+func (s *EnvironmentService) RecordProbe(ctx context.Context, id string, probe EnvironmentProbe) error {
+	fields := map[string]interface{}{}
+	if probe.Status != models.EnvironmentStatusOffline {
+		now := time.Now()
+		fields["last_seen"] = &now
+		fields["latency_ms"] = probe.Latency.Milliseconds()
 	}
-	if err := s.db.WithContext(ctx).Model(&models.Environment{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+	if probe.DockerVersion != "" {
+		fields["docker_version"] = probe.DockerVersion
+	}
+	reason := ""
+	if probe.Err != nil {
+		reason = probe.Err.Error()
+	}
+	if probe.Status == models.EnvironmentStatusOnline {
+		s.resetAgentCircuit(ctx, id)
+	}
+	return s.setStatus(ctx, id, probe.Status, fields, reason)
+}
+
+// setStatus updates the environment's status along with fields and reports a change of status
+// to the health monitor. Of concurrent writers only the one that actually changes the status
+// reports it.
+func (s *EnvironmentService) setStatus(ctx context.Context, id string, status models.EnvironmentStatus, fields map[string]interface{}, reason string) error {
+	var previous models.Environment
+	if err := s.db.WithContext(ctx).Select("id", "name", "status", "last_seen").Where("id = ?", id).First(&previous).Error; err != nil {
 		return fmt.Errorf("failed to update environment status: %w", err)
 	}
+
+	now := time.Now()
+	fields["updated_at"] = &now
+	changed := false
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Environment{}).Where("id = ?", id).Updates(fields).Error; err != nil {
+			return err
+		}
+		if previous.Status == string(status) {
+			return nil
+		}
+		res := tx.Model(&models.Environment{}).Where("id = ? AND status = ?", id, previous.Status).Update("status", string(status))
+		changed = res.RowsAffected == 1
+		return res.Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update environment status: %w", err)
+	}
+
+	if changed && s.health != nil {
+		s.health.statusChanged(ctx, &previous, status, reason)
+	}
 	return nil
 }
 
 func (s *EnvironmentService) UpdateEnvironmentHeartbeat(ctx context.Context, id string) error {
 	now := time.Now()
-	if err := s.db.WithContext(ctx).Model(&models.Environment{}).Where("id = ?", id).Updates(map[string]interface{}{
-		"last_seen":  &now,
-		"status":     string(models.EnvironmentStatusOnline),
-		"updated_at": &now,
-	}).Error; err != nil {
+	if err := s.setStatus(ctx, id, models.EnvironmentStatusOnline, map[string]interface{}{"last_seen": &now}, ""); err != nil {
 		return fmt.Errorf("failed to update environment heartbeat: %w", err)
 	}
 	return nil
 }
 
-func (s *EnvironmentService) PairAgentWithBootstrap(ctx context.Context, apiUrl, bootstrapToken string) (string, error) {
-	reqCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, strings.TrimRight(apiUrl, "/")+"/api/environments/0/agent/pair", nil)
+// TunnelConnected reports whether the environment's agent has a tunnel open to the manager.
+func (s *EnvironmentService) TunnelConnected(id string) bool {
+	return s.tunnels != nil && s.tunnels.Connected(id)
+}
+
+// AgentHTTPClient returns a client for requests to the environment's agent and the base URL they
+// must target. Requests go through the agent's tunnel when one is open, otherwise to apiURL, over
+// mutual TLS once the agent has installed a certificate from the manager's CA. Requests fail fast
+// with ErrEnvironmentUnavailable while the environment's circuit breaker is open.
+func (s *EnvironmentService) AgentHTTPClient(ctx context.Context, id, apiURL string, timeout time.Duration) (*http.Client, string, error) {
+	client, baseURL, err := s.agentHTTPClient(ctx, id, apiURL, timeout)
 	if err != nil {
-		return "", fmt.Errorf("create request: %w", err)
+		return nil, "", err
 	}
-	req.Header.Set("X-Arcane-Agent-Bootstrap", bootstrapToken)
+	return s.guardAgentClient(client, id), baseURL, nil
+}
 
-	resp, err := s.httpClient.Do(req)
+func (s *EnvironmentService) agentHTTPClient(ctx context.Context, id, apiURL string, timeout time.Duration) (*http.Client, string, error) {
+	if s.tunnels != nil {
+		if client := s.tunnels.HTTPClient(id, timeout); client != nil {
+			return client, TunnelBaseURL, nil
+		}
+	}
+	if apiURL == "" {
+		return nil, "", fmt.Errorf("environment has no API URL and its agent tunnel is not connected")
+	}
+
+	transport, err := s.agentTransport(ctx, id)
 	if err != nil {
-		return "", fmt.Errorf("request failed: %w", err)
+		return nil, "", err
 	}
-	defer resp.Body.Close()
+	client := &http.Client{Transport: s.httpClient.Transport, Timeout: timeout}
+	if transport != nil {
+		client.Transport = transport
+	}
+	return client, strings.TrimRight(apiURL, "/"), nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(body))
+// AgentWebSocketDialer is AgentHTTPClient for WebSocket connections.
+func (s *EnvironmentService) AgentWebSocketDialer(ctx context.Context, id, apiURL string) (*websocket.Dialer, string, error) {
+	dialer := &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: 45 * time.Second,
+	}
+	if s.tunnels != nil {
+		if dial := s.tunnels.DialContext(id); dial != nil {
+			dialer.Proxy = nil
+			dialer.NetDialContext = dial
+			return dialer, TunnelBaseURL, nil
+		}
+	}
+	if apiURL == "" {
+		return nil, "", fmt.Errorf("environment has no API URL and its agent tunnel is not connected")
 	}
 
-	var parsed struct {
-		Success bool `json:"success"`
-		Data    struct {
-			Token string `json:"token"`
-		} `json:"data"`
-		Message string `json:"message"`
+	transport, err := s.agentTransport(ctx, id)
+	if err != nil {
+		return nil, "", err
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
-		return "", fmt.Errorf("decode response: %w", err)
+	if transport != nil {
+		dialer.TLSClientConfig = transport.TLSClientConfig
+	}
+	return dialer, strings.TrimRight(apiURL, "/"), nil
+}
+
+// agentTransport returns the mutual TLS transport for the environment, or nil when its agent was
+// never issued a certificate. An agent whose certificates were all revoked is refused rather than
+// reached without TLS.
+func (s *EnvironmentService) agentTransport(ctx context.Context, id string) (*http.Transport, error) {
+	if s.certs == nil {
+		return nil, nil
+	}
+	transport, err := s.certs.Transport(ctx, id)
+	if err == nil {
+		return transport, nil
+	}
+	if !errors.Is(err, ErrAgentCertificateNotFound) {
+		return nil, err
+	}
+	installed, err := s.certs.HasInstalled(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if installed {
+		return nil, fmt.Errorf("agent certificate was revoked; pair the agent again")
 	}
-	if !parsed.Success || parsed.Data.Token == "" {
+	return nil, nil
+}
+
+// PairAgentWithBootstrap exchanges the agent's bootstrap token for its agent token. When the agent
+// serves TLS it also sends a certificate request, and the manager's CA issues and installs the
+// environment's certificate before the token is returned.
+func (s *EnvironmentService) PairAgentWithBootstrap(ctx context.Context, environmentID, apiUrl, bootstrapToken string) (string, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	client := s.httpClient
+	if s.certs != nil {
+		client = &http.Client{Transport: s.certs.PairingTransport(ctx)}
+	}
+	baseURL := strings.TrimRight(apiUrl, "/")
+
+	var paired struct {
+		Token string `json:"token"`
+		CSR   string `json:"csr"`
+	}
+	if err := s.callAgent(reqCtx, client, baseURL, "/agent/pair", http.Header{"X-Arcane-Agent-Bootstrap": {bootstrapToken}}, nil, &paired); err != nil {
+		return "", err
+	}
+	if paired.Token == "" {
 		return "", fmt.Errorf("pairing unsuccessful")
 	}
 
-	return parsed.Data.Token, nil
+	if paired.CSR != "" {
+		if s.certs == nil {
+			return "", fmt.Errorf("agent requested a certificate but the manager has no certificate authority")
+		}
+		if _, err := s.installAgentCertificate(reqCtx, client, baseURL, environmentID, apiUrl, paired.Token, paired.CSR); err != nil {
+			return "", err
+		}
+	}
+
+	return paired.Token, nil
 }
 
 func (s *EnvironmentService) PairAndPersistAgentToken(ctx context.Context, environmentID, apiUrl, bootstrapToken string) (string, error) {
-	token, err := s.PairAgentWithBootstrap(ctx, apiUrl, bootstrapToken)
+	token, err := s.PairAgentWithBootstrap(ctx, environmentID, apiUrl, bootstrapToken)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := sealAgentToken(token)
 	if err != nil {
 		return "", err
 	}
 	if err := s.db.WithContext(ctx).
 		Model(&models.Environment{}).
 		Where("id = ?", environmentID).
-		Update("access_token", token).Error; err != nil {
+		Updates(sealed).Error; err != nil {
 		return "", fmt.Errorf("failed to persist agent token: %w", err)
 	}
 	return token, nil
 }
 
+// RotateAgentToken replaces the environment's agent token. The agent accepts the new token
+// alongside the old one until the manager, having stored the new token, confirms it; only then
+// is the old token invalidated on both sides.
+func (s *EnvironmentService) RotateAgentToken(ctx context.Context, id string) error {
+	environment, err := s.GetEnvironmentByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if environment.AccessToken == nil || *environment.AccessToken == "" {
+		return ErrAgentNotPaired
+	}
+	current := *environment.AccessToken
+
+	reqCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	client, baseURL, err := s.AgentHTTPClient(reqCtx, id, environment.ApiUrl, 0)
+	if err != nil {
+		return err
+	}
+
+	next := utils.GenerateRandomString(48)
+	if err := s.callAgent(reqCtx, client, baseURL, "/agent/token", agentTokenHeader(current), map[string]string{"token": next}, nil); err != nil {
+		return fmt.Errorf("send new token to agent: %w", err)
+	}
+
+	sealed, err := sealAgentToken(next)
+	if err != nil {
+		return err
+	}
+	sealed["previous_access_token_hash"] = hashAgentToken(current)
+	sealed["updated_at"] = time.Now()
+	if err := s.db.WithContext(ctx).Model(&models.Environment{}).Where("id = ?", id).Updates(sealed).Error; err != nil {
+		return fmt.Errorf("failed to persist agent token: %w", err)
+	}
+
+	if err := s.callAgent(reqCtx, client, baseURL, "/agent/token/confirm", agentTokenHeader(next), nil, nil); err != nil {
+		return fmt.Errorf("agent has not confirmed the new token; rotate again to finish: %w", err)
+	}
+	if err := s.db.WithContext(ctx).Model(&models.Environment{}).Where("id = ?", id).Update("previous_access_token_hash", nil).Error; err != nil {
+		return fmt.Errorf("failed to retire previous agent token: %w", err)
+	}
+
+	slog.InfoContext(ctx, "Rotated agent token", "environmentId", id)
+	return nil
+}
+
+// UnpairAgent makes the agent forget its token and certificate, then removes them from the
+// environment. With force the environment is unpaired even if the agent cannot be reached.
+func (s *EnvironmentService) UnpairAgent(ctx context.Context, id string, force bool) error {
+	environment, err := s.GetEnvironmentByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if environment.AccessToken != nil && *environment.AccessToken != "" {
+		reqCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+		client, baseURL, err := s.AgentHTTPClient(reqCtx, id, environment.ApiUrl, 0)
+		if err == nil {
+			err = s.callAgent(reqCtx, client, baseURL, "/agent/unpair", agentTokenHeader(*environment.AccessToken), nil, nil)
+		}
+		if err != nil {
+			if !force {
+				return fmt.Errorf("unpair agent: %w", err)
+			}
+			slog.WarnContext(ctx, "Agent could not be unpaired; removing its credentials from the manager only", "environmentId", id, "error", err)
+		}
+	}
+
+	if s.certs != nil {
+		if _, err := s.certs.Revoke(ctx, id); err != nil {
+			return err
+		}
+	}
+	sealed, err := sealAgentToken("")
+	if err != nil {
+		return err
+	}
+	sealed["updated_at"] = time.Now()
+	if err := s.db.WithContext(ctx).Model(&models.Environment{}).Where("id = ?", id).Updates(sealed).Error; err != nil {
+		return fmt.Errorf("failed to unpair environment: %w", err)
+	}
+	s.disconnectTunnel(id)
+
+	slog.InfoContext(ctx, "Unpaired agent", "environmentId", id)
+	return nil
+}
+
+// EncryptAgentTokens encrypts agent tokens stored before tokens were kept encrypted.
+func (s *EnvironmentService) EncryptAgentTokens(ctx context.Context) (int, error) {
+	var envs []models.Environment
+	if err := s.db.WithContext(ctx).
+		Where("access_token IS NOT NULL AND access_token <> '' AND access_token_hash IS NULL").
+		Find(&envs).Error; err != nil {
+		return 0, fmt.Errorf("failed to list agent tokens: %w", err)
+	}
+	for _, env := range envs {
+		sealed, err := sealAgentToken(*env.AccessToken)
+		if err != nil {
+			return 0, err
+		}
+		if err := s.db.WithContext(ctx).Model(&models.Environment{}).Where("id = ?", env.ID).Updates(sealed).Error; err != nil {
+			return 0, fmt.Errorf("failed to encrypt agent token: %w", err)
+		}
+	}
+	return len(envs), nil
+}
+
+// sealAgentToken returns the columns storing token: encrypted, and hashed for the tunnel to look
+// the environment up by. Any previous token stops being accepted; an empty token clears them all.
+func sealAgentToken(token string) (map[string]interface{}, error) {
+	sealed := map[string]interface{}{"access_token": nil, "access_token_hash": nil, "previous_access_token_hash": nil}
+	if token == "" {
+		return sealed, nil
+	}
+	encrypted, err := utils.Encrypt(token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt agent token: %w", err)
+	}
+	sealed["access_token"], sealed["access_token_hash"] = encrypted, hashAgentToken(token)
+	return sealed, nil
+}
+
+// openAgentToken decrypts the environment's access token in place. A token without a hash was
+// stored before tokens were encrypted and is left as it is.
+func openAgentToken(environment *models.Environment) error {
+	if environment.AccessToken == nil || *environment.AccessToken == "" || environment.AccessTokenHash == nil {
+		return nil
+	}
+	token, err := utils.Decrypt(*environment.AccessToken)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt agent token: %w", err)
+	}
+	environment.AccessToken = &token
+	return nil
+}
+
+func hashAgentToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ListAgentCertificates returns the certificates issued to the environment's agent.
+func (s *EnvironmentService) ListAgentCertificates(ctx context.Context, id string) ([]models.AgentCertificate, error) {
+	if s.certs == nil {
+		return []models.AgentCertificate{}, nil
+	}
+	return s.certs.List(ctx, id)
+}
+
+// RotateAgentCertificate has the agent generate a new key and installs a freshly issued
+// certificate for it. The previous certificate is revoked once the agent uses the new one.
+func (s *EnvironmentService) RotateAgentCertificate(ctx context.Context, id string) (*models.AgentCertificate, error) {
+	if s.certs == nil {
+		return nil, ErrAgentCertificateNotFound
+	}
+	environment, err := s.GetEnvironmentByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.certs.Active(ctx, id); err != nil {
+		return nil, err
+	}
+	if environment.AccessToken == nil || *environment.AccessToken == "" {
+		return nil, ErrAgentNotPaired
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	client, baseURL, err := s.AgentHTTPClient(reqCtx, id, environment.ApiUrl, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var requested struct {
+		CSR string `json:"csr"`
+	}
+	if err := s.callAgent(reqCtx, client, baseURL, "/agent/csr", agentTokenHeader(*environment.AccessToken), nil, &requested); err != nil {
+		return nil, err
+	}
+	if requested.CSR == "" {
+		return nil, fmt.Errorf("agent did not return a certificate request")
+	}
+	return s.installAgentCertificate(reqCtx, client, baseURL, id, environment.ApiUrl, *environment.AccessToken, requested.CSR)
+}
+
+// RevokeAgentCertificates revokes every certificate of the environment's agent.
+func (s *EnvironmentService) RevokeAgentCertificates(ctx context.Context, id string) (int64, error) {
+	if s.certs == nil {
+		return 0, nil
+	}
+	return s.certs.Revoke(ctx, id)
+}
+
+// RenewAgentCertificates rotates every agent certificate that is close to expiry and returns how
+// many were renewed.
+func (s *EnvironmentService) RenewAgentCertificates(ctx context.Context) (int, error) {
+	if s.certs == nil {
+		return 0, nil
+	}
+	ids, err := s.certs.ExpiringEnvironments(ctx, AgentCertRenewBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	renewed := 0
+	var errs []error
+	for _, id := range ids {
+		if _, err := s.RotateAgentCertificate(ctx, id); err != nil {
+			errs = append(errs, fmt.Errorf("environment %s: %w", id, err))
+			continue
+		}
+		renewed++
+	}
+	return renewed, errors.Join(errs...)
+}
+
+// installAgentCertificate issues a certificate for csr, which is valid for the host of apiUrl, and
+// sends it to the agent at baseURL.
+func (s *EnvironmentService) installAgentCertificate(ctx context.Context, client *http.Client, baseURL, environmentID, apiUrl, agentToken, csr string) (*models.AgentCertificate, error) {
+	cert, err := s.certs.Issue(ctx, environmentID, apiUrl, csr)
+	if err != nil {
+		return nil, fmt.Errorf("issue agent certificate: %w", err)
+	}
+	caCert, err := s.certs.CACertificate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	body := map[string]string{"certificate": cert.Certificate, "caCertificate": caCert}
+	if err := s.callAgent(ctx, client, baseURL, "/agent/certificate", agentTokenHeader(agentToken), body, nil); err != nil {
+		// The agent kept its previous certificate; the new one must never be trusted.
+		if revokeErr := s.certs.RevokeCertificate(context.WithoutCancel(ctx), environmentID, cert.ID); revokeErr != nil {
+			slog.WarnContext(ctx, "Failed to revoke uninstalled agent certificate", "environmentId", environmentID, "error", revokeErr)
+		}
+		return nil, fmt.Errorf("install agent certificate: %w", err)
+	}
+
+	if err := s.certs.Activate(ctx, environmentID, cert.ID); err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "Installed agent certificate", "environmentId", environmentID, "serial", cert.SerialNumber, "notAfter", cert.NotAfter)
+	return cert, nil
+}
+
+// callAgent posts body as JSON to an agent's local environment endpoint under path and decodes
+// the data of its response into out.
+func (s *EnvironmentService) callAgent(ctx context.Context, client *http.Client, baseURL, endpoint string, header http.Header, body any, out any) error {
+	return s.callAgentMethod(ctx, client, http.MethodPost, baseURL, endpoint, header, body, out)
+}
+
+// callAgentMethod is callAgent with another HTTP method.
+func (s *EnvironmentService) callAgentMethod(ctx context.Context, client *http.Client, method, baseURL, endpoint string, header http.Header, body any, out any) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("encode request: %w", err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, baseURL+"/api/environments/0"+endpoint, reader)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(respBody))
+	}
+	if out == nil {
+		return nil
+	}
+
+	parsed := struct {
+		Success bool `json:"success"`
+		Data    any  `json:"data"`
+	}{Data: out}
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	if !parsed.Success {
+		return fmt.Errorf("agent reported failure")
+	}
+	return nil
+}
+
+// agentDockerVersion asks the agent for the version of its Docker daemon.
+func agentDockerVersion(ctx context.Context, client *http.Client, baseURL, agentToken string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/api/environments/0/system/docker/info", nil)
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+	req.Header = agentTokenHeader(agentToken)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var info dto.DockerInfoDto
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return "", fmt.Errorf("decode response: %w", err)
+	}
+	return info.Version, nil
+}
+
+func agentTokenHeader(token string) http.Header {
+	return http.Header{"X-Arcane-Agent-Token": {token}}
+}
+
 func (s *EnvironmentService) BuildWSAuthHeadersFromRequest(req *http.Request, agentToken string) http.Header {
 	h := http.Header{}
 	if auth := req.Header.Get("Authorization"); auth != "" {
@@ -359,3 +1178,171 @@ func (s *EnvironmentService) GetEnabledRegistryCredentials(ctx context.Context)
 
 	return creds, nil
 }
+
+var ErrEnvironmentAccessNotFound = errors.New("environment access grant not found")
+
+// ResolveEnvironmentAccess returns the strongest access level user holds on the environment.
+// restricted is false when the environment has no grants at all, in which case level is empty
+// and the caller's role permissions apply unchanged.
+func (s *EnvironmentService) ResolveEnvironmentAccess(ctx context.Context, environmentID string, user *models.User) (level models.EnvironmentAccessLevel, restricted bool, err error) {
+	var grants []models.EnvironmentAccess
+	if err := s.db.WithContext(ctx).Where("environment_id = ?", environmentID).Find(&grants).Error; err != nil {
+		return "", false, fmt.Errorf("failed to load environment access: %w", err)
+	}
+	if len(grants) == 0 {
+		return "", false, nil
+	}
+
+	for _, g := range grants {
+		if !grantMatchesUser(g, user) {
+			continue
+		}
+		if level == "" || g.AccessLevel.Covers(level) {
+			level = g.AccessLevel
+		}
+	}
+	return level, true, nil
+}
+
+// hiddenEnvironmentIDs returns the restricted environments user holds no grant on.
+func (s *EnvironmentService) hiddenEnvironmentIDs(ctx context.Context, user *models.User) ([]string, error) {
+	var grants []models.EnvironmentAccess
+	if err := s.db.WithContext(ctx).Find(&grants).Error; err != nil {
+		return nil, fmt.Errorf("failed to load environment access: %w", err)
+	}
+
+	visible := map[string]bool{}
+	for _, g := range grants {
+		if grantMatchesUser(g, user) {
+			visible[g.EnvironmentID] = true
+		} else if _, seen := visible[g.EnvironmentID]; !seen {
+			visible[g.EnvironmentID] = false
+		}
+	}
+
+	var hidden []string
+	for id, ok := range visible {
+		if !ok {
+			hidden = append(hidden, id)
+		}
+	}
+	return hidden, nil
+}
+
+func grantMatchesUser(g models.EnvironmentAccess, user *models.User) bool {
+	switch g.SubjectType {
+	case models.EnvironmentAccessSubjectUser:
+		return g.SubjectID == user.ID
+	case models.EnvironmentAccessSubjectRole:
+		for _, r := range user.Roles {
+			if strings.EqualFold(r, g.SubjectID) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *EnvironmentService) ListEnvironmentAccess(ctx context.Context, environmentID string) ([]dto.EnvironmentAccessDto, error) {
+	var grants []models.EnvironmentAccess
+	if err := s.db.WithContext(ctx).
+		Where("environment_id = ?", environmentID).
+		Order("subject_type ASC, subject_id ASC").
+		Find(&grants).Error; err != nil {
+		return nil, fmt.Errorf("failed to list environment access: %w", err)
+	}
+
+	out, err := dto.MapSlice[models.EnvironmentAccess, dto.EnvironmentAccessDto](grants)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map environment access: %w", err)
+	}
+	return out, nil
+}
+
+// SetEnvironmentAccess creates the grant for the subject or updates its access level.
+func (s *EnvironmentService) SetEnvironmentAccess(ctx context.Context, environmentID string, req dto.SetEnvironmentAccessDto) (*dto.EnvironmentAccessDto, error) {
+	subjectType := models.EnvironmentAccessSubject(req.SubjectType)
+	level := models.EnvironmentAccessLevel(req.AccessLevel)
+	subjectID := strings.TrimSpace(req.SubjectID)
+
+	if !level.IsValid() {
+		return nil, &models.ValidationError{Field: "accessLevel", Message: fmt.Sprintf("Unknown access level '%s'", req.AccessLevel)}
+	}
+	if err := s.validateAccessSubject(ctx, subjectType, subjectID); err != nil {
+		return nil, err
+	}
+	if subjectType == models.EnvironmentAccessSubjectRole {
+		subjectID = strings.ToLower(subjectID)
+	}
+
+	var grant models.EnvironmentAccess
+	err := s.db.WithContext(ctx).
+		Where("environment_id = ? AND subject_type = ? AND subject_id = ?", environmentID, subjectType, subjectID).
+		First(&grant).Error
+	switch {
+	case err == nil:
+		grant.AccessLevel = level
+		if err := s.db.WithContext(ctx).Save(&grant).Error; err != nil {
+			return nil, fmt.Errorf("failed to update environment access: %w", err)
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		grant = models.EnvironmentAccess{
+			EnvironmentID: environmentID,
+			SubjectType:   subjectType,
+			SubjectID:     subjectID,
+			AccessLevel:   level,
+		}
+		if err := s.db.WithContext(ctx).Create(&grant).Error; err != nil {
+			return nil, fmt.Errorf("failed to create environment access: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("failed to load environment access: %w", err)
+	}
+
+	out, err := dto.MapOne[models.EnvironmentAccess, dto.EnvironmentAccessDto](grant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map environment access: %w", err)
+	}
+	return &out, nil
+}
+
+func (s *EnvironmentService) DeleteEnvironmentAccess(ctx context.Context, environmentID, grantID string) error {
+	res := s.db.WithContext(ctx).Delete(&models.EnvironmentAccess{}, "id = ? AND environment_id = ?", grantID, environmentID)
+	if res.Error != nil {
+		return fmt.Errorf("failed to delete environment access: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrEnvironmentAccessNotFound
+	}
+	return nil
+}
+
+func (s *EnvironmentService) validateAccessSubject(ctx context.Context, subjectType models.EnvironmentAccessSubject, subjectID string) error {
+	if subjectID == "" {
+		return &models.ValidationError{Field: "subjectId", Message: "Subject ID is required"}
+	}
+
+	var count int64
+	switch subjectType {
+	case models.EnvironmentAccessSubjectUser:
+		if err := s.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", subjectID).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to look up user: %w", err)
+		}
+		if count == 0 {
+			return &models.ValidationError{Field: "subjectId", Message: fmt.Sprintf("Unknown user '%s'", subjectID)}
+		}
+	case models.EnvironmentAccessSubjectRole:
+		if models.IsBuiltinRole(subjectID) {
+			return nil
+		}
+		if err := s.db.WithContext(ctx).Model(&models.Role{}).Where("name = ?", strings.ToLower(subjectID)).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to look up role: %w", err)
+		}
+		if count == 0 {
+			return &models.ValidationError{Field: "subjectId", Message: fmt.Sprintf("Unknown role '%s'", subjectID)}
+		}
+	default:
+		return &models.ValidationError{Field: "subjectType", Message: fmt.Sprintf("Unknown subject type '%s'", subjectType)}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	glsqlite "github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/dto"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/utils/pagination"
+)
+
+func setupEnvironmentTestDB(t *testing.T) *database.DB {
+	t.Helper()
+	db, err := gorm.Open(glsqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Environment{}, &models.EnvironmentAccess{}, &models.User{}, &models.Role{}))
+	return &database.DB{DB: db}
+}
+
+func createTestEnvironment(t *testing.T, svc *EnvironmentService, name string) *models.Environment {
+	t.Helper()
+	env, err := svc.CreateEnvironment(context.Background(), &models.Environment{Name: name, ApiUrl: "http://" + name + ":3553", Enabled: true})
+	require.NoError(t, err)
+	return env
+}
+
+func TestEnvironmentService_EnvironmentAccess(t *testing.T) {
+	ctx := context.Background()
+	db := setupEnvironmentTestDB(t)
+	svc := NewEnvironmentService(db, nil)
+
+	prod := createTestEnvironment(t, svc, "prod")
+	staging := createTestEnvironment(t, svc, "staging")
+
+	senior := &models.User{Username: "senior", Roles: models.StringSlice{models.RoleDeployer}}
+	junior := &models.User{Username: "junior", Roles: models.StringSlice{models.RoleUser}}
+	require.NoError(t, db.Create(senior).Error)
+	require.NoError(t, db.Create(junior).Error)
+
+	// Unrestricted until the first grant is added.
+	_, restricted, err := svc.ResolveEnvironmentAccess(ctx, prod.ID, junior)
+	require.NoError(t, err)
+	require.False(t, restricted)
+
+	_, err = svc.SetEnvironmentAccess(ctx, prod.ID, dto.SetEnvironmentAccessDto{
+		SubjectType: "role", SubjectID: models.RoleDeployer, AccessLevel: "write",
+	})
+	require.NoError(t, err)
+
+	level, restricted, err := svc.ResolveEnvironmentAccess(ctx, prod.ID, senior)
+	require.NoError(t, err)
+	require.True(t, restricted)
+	require.Equal(t, models.EnvironmentAccessWrite, level)
+
+	level, restricted, err = svc.ResolveEnvironmentAccess(ctx, prod.ID, junior)
+	require.NoError(t, err)
+	require.True(t, restricted)
+	require.Empty(t, level)
+
+	// A direct user grant takes the strongest level.
+	grant, err := svc.SetEnvironmentAccess(ctx, prod.ID, dto.SetEnvironmentAccessDto{
+		SubjectType: "user", SubjectID: senior.ID, AccessLevel: "manage",
+	})
+	require.NoError(t, err)
+	level, _, err = svc.ResolveEnvironmentAccess(ctx, prod.ID, senior)
+	require.NoError(t, err)
+	require.Equal(t, models.EnvironmentAccessManage, level)
+
+	params := pagination.QueryParams{}
+	envs, _, err := svc.ListEnvironmentsPaginated(ctx, params, junior, nil)
+	require.NoError(t, err)
+	require.Len(t, envs, 1)
+	require.Equal(t, staging.ID, envs[0].ID)
+
+	envs, _, err = svc.ListEnvironmentsPaginated(ctx, params, senior, nil)
+	require.NoError(t, err)
+	require.Len(t, envs, 2)
+
+	envs, _, err = svc.ListEnvironmentsPaginated(ctx, params, junior, []models.Permission{models.PermissionAll})
+	require.NoError(t, err)
+	require.Len(t, envs, 2)
+
+	require.NoError(t, svc.DeleteEnvironmentAccess(ctx, prod.ID, grant.ID))
+	require.ErrorIs(t, svc.DeleteEnvironmentAccess(ctx, prod.ID, grant.ID), ErrEnvironmentAccessNotFound)
+
+	require.NoError(t, svc.DeleteEnvironment(ctx, prod.ID))
+	grants, err := svc.ListEnvironmentAccess(ctx, prod.ID)
+	require.NoError(t, err)
+	require.Empty(t, grants)
+}
+
+func TestEnvironmentService_SetEnvironmentAccessValidation(t *testing.T) {
+	ctx := context.Background()
+	svc := NewEnvironmentService(setupEnvironmentTestDB(t), nil)
+	env := createTestEnvironment(t, svc, "prod")
+
+	var validationErr *models.ValidationError
+	_, err := svc.SetEnvironmentAccess(ctx, env.ID, dto.SetEnvironmentAccessDto{SubjectType: "user", SubjectID: "missing", AccessLevel: "read"})
+	require.ErrorAs(t, err, &validationErr)
+	_, err = svc.SetEnvironmentAccess(ctx, env.ID, dto.SetEnvironmentAccessDto{SubjectType: "role", SubjectID: "viewer", AccessLevel: "owner"})
+	require.ErrorAs(t, err, &validationErr)
+	_, err = svc.SetEnvironmentAccess(ctx, env.ID, dto.SetEnvironmentAccessDto{SubjectType: "team", SubjectID: "viewer", AccessLevel: "read"})
+	require.ErrorAs(t, err, &validationErr)
+}
+
+func TestEnvironmentAccessLevel_Restrict(t *testing.T) {
+	perms := models.BuiltinRoles[models.RoleUser]
+
+	read := models.EnvironmentAccessRead.Restrict(perms)
+	require.True(t, models.HasPermission(read, models.PermissionContainersRead))
+	require.False(t, models.HasPermission(read, models.PermissionContainersExec))
+
+	write := models.EnvironmentAccessWrite.Restrict(perms)
+	require.True(t, models.HasPermission(write, models.PermissionContainersExec))
+	require.False(t, models.HasPermission(write, models.PermissionEnvironmentsManage))
+	require.False(t, models.HasPermission(write, models.PermissionUsersManage))
+
+	require.Equal(t, perms, models.EnvironmentAccessManage.Restrict(perms))
+}
+
+func TestEnvironmentService_TagsAndGroups(t *testing.T) {
+	ctx := context.Background()
+	svc := NewEnvironmentService(setupEnvironmentTestDB(t), nil)
+
+	group := "EU-West"
+	edge, err := svc.CreateEnvironment(ctx, &models.Environment{Name: "edge-1", ApiUrl: "http://edge-1:3553", Enabled: true, Group: &group, Tags: []string{"Edge", "prod", "edge", "rack_1"}})
+	require.NoError(t, err)
+	require.Equal(t, "eu-west", *edge.Group)
+	require.Equal(t, models.StringSlice{"edge", "prod", "rack_1"}, edge.Tags)
+	staging := createTestEnvironment(t, svc, "staging")
+
+	_, err = svc.CreateEnvironment(ctx, &models.Environment{Name: "bad", ApiUrl: "http://bad:3553", Tags: []string{"no spaces"}})
+	require.ErrorIs(t, err, ErrInvalidEnvironmentTag)
+
+	list := func(filters map[string]string) []string {
+		t.Helper()
+		envs, _, err := svc.ListEnvironmentsPaginated(ctx, pagination.QueryParams{Filters: filters}, nil, nil)
+		require.NoError(t, err)
+		names := []string{}
+		for _, e := range envs {
+			names = append(names, e.Name)
+		}
+		return names
+	}
+	require.Equal(t, []string{"edge-1"}, list(map[string]string{"tag": "prod,edge"}))
+	require.Empty(t, list(map[string]string{"tag": "prod,staging"}))
+	require.Equal(t, []string{"edge-1"}, list(map[string]string{"group": "eu-west"}))
+	// "_" in a tag is matched literally rather than as a wildcard.
+	require.Empty(t, list(map[string]string{"tag": "rack1"}))
+	require.Empty(t, list(map[string]string{"tag": "rack-1"}))
+
+	updated, err := svc.UpdateEnvironment(ctx, staging.ID, map[string]interface{}{"tags": []string{"prod"}, "group_name": "eu-west"})
+	require.NoError(t, err)
+	require.Equal(t, models.StringSlice{"prod"}, updated.Tags)
+	require.ElementsMatch(t, []string{"edge-1", "staging"}, list(map[string]string{"tag": "prod", "group": "eu-west"}))
+
+	updated, err = svc.UpdateEnvironment(ctx, staging.ID, map[string]interface{}{"group_name": ""})
+	require.NoError(t, err)
+	require.Nil(t, updated.Group)
+
+	out, err := dto.MapOne[*models.Environment, dto.EnvironmentDto](edge)
+	require.NoError(t, err)
+	require.Equal(t, []string{"edge", "prod", "rack_1"}, out.Tags)
+}
@@ -16,6 +16,8 @@ import (
 
 type EventService struct {
 	db *database.DB
+	// audit is registered by NewAuditService and receives the security-relevant events.
+	audit *AuditService
 }
 
 func NewEventService(db *database.DB) *EventService {
@@ -41,6 +43,11 @@ func (s *EventService) CreateEvent(ctx context.Context, req CreateEventRequest)
 	if severity == "" {
 		severity = models.EventSeverityInfo
 	}
+	// Docker services log against the local environment; a request for a direct Docker
+	// environment is attributed to that environment instead.
+	if id, ok := dockerEnvironmentFromContext(ctx); ok && req.EnvironmentID != nil && *req.EnvironmentID == localEnvironmentID {
+		req.EnvironmentID = &id
+	}
 
 	event := &models.Event{
 		Type:          req.Type,
@@ -64,6 +71,10 @@ func (s *EventService) CreateEvent(ctx context.Context, req CreateEventRequest)
 		return nil, fmt.Errorf("failed to create event: %w", err)
 	}
 
+	if s.audit != nil {
+		s.audit.recordEvent(ctx, event)
+	}
+
 	return event, nil
 }
 
@@ -326,6 +337,26 @@ func (s *EventService) LogNetworkEvent(ctx context.Context, eventType models.Eve
 	return err
 }
 
+func (s *EventService) LogEnvironmentEvent(ctx context.Context, eventType models.EventType, environmentID, environmentName string, metadata models.JSON) error {
+	title := s.generateEventTitle(eventType, environmentName)
+	description := s.generateEventDescription(eventType, "environment", environmentName)
+	severity := s.getEventSeverity(eventType)
+
+	resourceType := "environment"
+	_, err := s.CreateEvent(ctx, CreateEventRequest{
+		Type:          eventType,
+		Severity:      severity,
+		Title:         title,
+		Description:   description,
+		ResourceType:  &resourceType,
+		ResourceID:    &environmentID,
+		ResourceName:  &environmentName,
+		EnvironmentID: &environmentID,
+		Metadata:      metadata,
+	})
+	return err
+}
+
 func (s *EventService) LogErrorEvent(ctx context.Context, eventType models.EventType, resourceType, resourceID, resourceName, userID, username, environmentID string, err error, metadata models.JSON) {
 	if err == nil {
 		return
@@ -429,6 +460,10 @@ func (s *EventService) generateEventTitle(eventType models.EventType, resourceNa
 		return fmt.Sprintf("Project updated: %s", resourceName)
 	case models.EventTypeProjectError:
 		return fmt.Sprintf("Project error: %s", resourceName)
+	case models.EventTypeProjectWebhook:
+		return fmt.Sprintf("Project webhook called: %s", resourceName)
+	case models.EventTypeProjectWebhookRejected:
+		return fmt.Sprintf("Project webhook rejected: %s", resourceName)
 	case models.EventTypeVolumeCreate:
 		return fmt.Sprintf("Volume created: %s", resourceName)
 	case models.EventTypeVolumeDelete:
@@ -451,6 +486,16 @@ func (s *EventService) generateEventTitle(eventType models.EventType, resourceNa
 		return fmt.Sprintf("User logged in: %s", resourceName)
 	case models.EventTypeUserLogout:
 		return fmt.Sprintf("User logged out: %s", resourceName)
+	case models.EventTypeUserLoginFailed:
+		return fmt.Sprintf("Failed login: %s", resourceName)
+	case models.EventTypeUserLocked:
+		return fmt.Sprintf("User locked out: %s", resourceName)
+	case models.EventTypeEnvironmentOnline:
+		return fmt.Sprintf("Environment online: %s", resourceName)
+	case models.EventTypeEnvironmentOffline:
+		return fmt.Sprintf("Environment offline: %s", resourceName)
+	case models.EventTypeEnvironmentError:
+		return fmt.Sprintf("Environment error: %s", resourceName)
 	default:
 		return fmt.Sprintf("Event: %s", string(eventType))
 	}
@@ -496,6 +541,10 @@ func (s *EventService) generateEventDescription(eventType models.EventType, reso
 		return fmt.Sprintf("Project '%s' has been updated", resourceName)
 	case models.EventTypeProjectError:
 		return fmt.Sprintf("An error occurred with project '%s'", resourceName)
+	case models.EventTypeProjectWebhook:
+		return fmt.Sprintf("The webhook of project '%s' has been called to redeploy it", resourceName)
+	case models.EventTypeProjectWebhookRejected:
+		return fmt.Sprintf("A call to the webhook of project '%s' failed authentication", resourceName)
 	case models.EventTypeVolumeCreate:
 		return fmt.Sprintf("Volume '%s' has been created", resourceName)
 	case models.EventTypeVolumeDelete:
@@ -518,6 +567,16 @@ func (s *EventService) generateEventDescription(eventType models.EventType, reso
 		return fmt.Sprintf("User '%s' has logged in", resourceName)
 	case models.EventTypeUserLogout:
 		return fmt.Sprintf("User '%s' has logged out", resourceName)
+	case models.EventTypeUserLoginFailed:
+		return fmt.Sprintf("A login attempt for '%s' has failed", resourceName)
+	case models.EventTypeUserLocked:
+		return fmt.Sprintf("User '%s' has been locked out after repeated failed logins", resourceName)
+	case models.EventTypeEnvironmentOnline:
+		return fmt.Sprintf("Environment '%s' is reachable again", resourceName)
+	case models.EventTypeEnvironmentOffline:
+		return fmt.Sprintf("Environment '%s' can no longer be reached", resourceName)
+	case models.EventTypeEnvironmentError:
+		return fmt.Sprintf("Environment '%s' is reachable but its Docker daemon is not responding", resourceName)
 	default:
 		return fmt.Sprintf("%s operation performed on %s '%s'", string(eventType), resourceType, resourceName)
 	}
@@ -525,13 +584,13 @@ func (s *EventService) generateEventDescription(eventType models.EventType, reso
 
 func (s *EventService) getEventSeverity(eventType models.EventType) models.EventSeverity {
 	switch eventType {
-	case models.EventTypeContainerDelete, models.EventTypeImageDelete, models.EventTypeProjectDelete, models.EventTypeVolumeDelete, models.EventTypeNetworkDelete:
+	case models.EventTypeContainerDelete, models.EventTypeImageDelete, models.EventTypeProjectDelete, models.EventTypeVolumeDelete, models.EventTypeNetworkDelete, models.EventTypeUserLoginFailed, models.EventTypeUserLocked, models.EventTypeEnvironmentOffline, models.EventTypeProjectWebhookRejected:
 		return models.EventSeverityWarning
-	case models.EventTypeContainerStart, models.EventTypeContainerCreate, models.EventTypeImagePull, models.EventTypeImageLoad, models.EventTypeProjectDeploy, models.EventTypeProjectStart, models.EventTypeProjectCreate, models.EventTypeVolumeCreate, models.EventTypeNetworkCreate:
+	case models.EventTypeContainerStart, models.EventTypeContainerCreate, models.EventTypeImagePull, models.EventTypeImageLoad, models.EventTypeProjectDeploy, models.EventTypeProjectStart, models.EventTypeProjectCreate, models.EventTypeVolumeCreate, models.EventTypeNetworkCreate, models.EventTypeEnvironmentOnline:
 		return models.EventSeveritySuccess
-	case models.EventTypeContainerStop, models.EventTypeContainerRestart, models.EventTypeContainerScan, models.EventTypeContainerUpdate, models.EventTypeImageScan, models.EventTypeProjectStop, models.EventTypeProjectUpdate, models.EventTypeSystemPrune, models.EventTypeSystemAutoUpdate, models.EventTypeSystemUpgrade, models.EventTypeUserLogin, models.EventTypeUserLogout:
+	case models.EventTypeContainerStop, models.EventTypeContainerRestart, models.EventTypeContainerScan, models.EventTypeContainerUpdate, models.EventTypeImageScan, models.EventTypeProjectStop, models.EventTypeProjectUpdate, models.EventTypeProjectWebhook, models.EventTypeSystemPrune, models.EventTypeSystemAutoUpdate, models.EventTypeSystemUpgrade, models.EventTypeUserLogin, models.EventTypeUserLogout:
 		return models.EventSeverityInfo
-	case models.EventTypeContainerError, models.EventTypeImageError, models.EventTypeProjectError, models.EventTypeVolumeError, models.EventTypeNetworkError:
+	case models.EventTypeContainerError, models.EventTypeImageError, models.EventTypeProjectError, models.EventTypeVolumeError, models.EventTypeNetworkError, models.EventTypeEnvironmentError:
 		return models.EventSeverityError
 	default:
 		return models.EventSeverityInfo
@@ -416,7 +416,32 @@ func (s *ImageService) ListImagesPaginated(ctx context.Context, params paginatio
 
 	items := mapDockerImagesToDTOs(dockerImages, inUseMap, updateMap)
 
-	config := pagination.Config[dto.ImageSummaryDto]{
+	result := pagination.SearchOrderAndPaginate(items, params, imageListConfig())
+
+	totalPages := int64(0)
+	if params.Limit > 0 {
+		totalPages = (int64(result.TotalCount) + int64(params.Limit) - 1) / int64(params.Limit)
+	}
+
+	page := 1
+	if params.Limit > 0 {
+		page = (params.Start / params.Limit) + 1
+	}
+
+	paginationResp := pagination.Response{
+		TotalPages:      totalPages,
+		TotalItems:      int64(result.TotalCount),
+		CurrentPage:     page,
+		ItemsPerPage:    params.Limit,
+		GrandTotalItems: int64(result.TotalAvailable),
+	}
+
+	return result.Items, paginationResp, nil
+}
+
+// imageListConfig describes how image listings are searched, sorted and filtered.
+func imageListConfig() pagination.Config[dto.ImageSummaryDto] {
+	return pagination.Config[dto.ImageSummaryDto]{
 		SearchAccessors: []pagination.SearchAccessor[dto.ImageSummaryDto]{
 			func(i dto.ImageSummaryDto) (string, error) { return i.Repo, nil },
 			func(i dto.ImageSummaryDto) (string, error) { return i.Tag, nil },
@@ -506,28 +531,6 @@ func (s *ImageService) ListImagesPaginated(ctx context.Context, params paginatio
 			},
 		},
 	}
-
-	result := pagination.SearchOrderAndPaginate(items, params, config)
-
-	totalPages := int64(0)
-	if params.Limit > 0 {
-		totalPages = (int64(result.TotalCount) + int64(params.Limit) - 1) / int64(params.Limit)
-	}
-
-	page := 1
-	if params.Limit > 0 {
-		page = (params.Start / params.Limit) + 1
-	}
-
-	paginationResp := pagination.Response{
-		TotalPages:      totalPages,
-		TotalItems:      int64(result.TotalCount),
-		CurrentPage:     page,
-		ItemsPerPage:    params.Limit,
-		GrandTotalItems: int64(result.TotalAvailable),
-	}
-
-	return result.Items, paginationResp, nil
 }
 
 func convertLabels(labels map[string]string) map[string]interface{} {
@@ -0,0 +1,337 @@
+package services
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/ofkm/arcane-backend/internal/config"
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/utils"
+)
+
+const (
+	// jwtLegacyKeyID names the static JWT_SECRET the key ring replaced. Tokens issued before the
+	// key ring existed carry no kid and verify against it until its grace period has passed.
+	jwtLegacyKeyID = "legacy"
+	jwtKeySize     = 64
+	// jwtKeyRefreshInterval bounds how long the cached key ring may lag behind the database, for
+	// example after `arcane jwt rotate` ran in another process.
+	jwtKeyRefreshInterval = time.Minute
+	// jwtKeyMinReloadInterval limits reloads triggered by tokens naming an unknown key.
+	jwtKeyMinReloadInterval = 5 * time.Second
+)
+
+var (
+	ErrJwtKeyNotFound = errors.New("unknown token signing key")
+	ErrJwtKeyExpired  = errors.New("token signing key has expired")
+)
+
+type jwtKey struct {
+	id        string
+	secret    []byte
+	createdAt time.Time
+	retiredAt *time.Time
+}
+
+// JwtKeyService maintains the key ring used to sign and verify Arcane's JWTs. Only the current
+// key signs; a rotated key keeps verifying for the configured grace period so sessions survive
+// the rotation.
+type JwtKeyService struct {
+	db              *database.DB
+	settingsService *SettingsService
+	legacySecret    string
+
+	mu       sync.Mutex
+	keys     map[string]*jwtKey
+	current  *jwtKey
+	loadedAt time.Time
+}
+
+func NewJwtKeyService(db *database.DB, settingsService *SettingsService, legacySecret string) *JwtKeyService {
+	return &JwtKeyService{
+		db:              db,
+		settingsService: settingsService,
+		legacySecret:    legacySecret,
+	}
+}
+
+// RotationInterval returns how often the signing key is rotated by the scheduled job; zero
+// disables scheduled rotation.
+func (s *JwtKeyService) RotationInterval(ctx context.Context) time.Duration {
+	days := s.settingsService.GetIntSetting(ctx, "authJwtRotationInterval", 30)
+	if days <= 0 {
+		return 0
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// GracePeriod returns how long a retired key keeps verifying tokens.
+func (s *JwtKeyService) GracePeriod(ctx context.Context) time.Duration {
+	hours := s.settingsService.GetIntSetting(ctx, "authJwtGracePeriod", 168)
+	if hours < 0 {
+		hours = 0
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// SigningKey returns the ID and secret of the current key, creating the key ring on first use.
+func (s *JwtKeyService) SigningKey(ctx context.Context) (string, []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.refreshLocked(ctx, false); err != nil {
+		return "", nil, err
+	}
+	if s.current == nil {
+		if err := s.initLocked(ctx); err != nil {
+			return "", nil, err
+		}
+	}
+	return s.current.id, s.current.secret, nil
+}
+
+// Keyfunc returns a jwt.Keyfunc that resolves the token's kid header against the key ring and
+// refuses keys whose grace period has passed.
+func (s *JwtKeyService) Keyfunc(ctx context.Context) jwt.Keyfunc {
+	return func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		kid, _ := t.Header["kid"].(string)
+		if kid == "" {
+			kid = jwtLegacyKeyID
+		}
+
+		key, err := s.lookup(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if key.retiredAt != nil && time.Since(*key.retiredAt) > s.GracePeriod(ctx) {
+			return nil, ErrJwtKeyExpired
+		}
+		return key.secret, nil
+	}
+}
+
+// Rotate retires the current key and makes a new one current. Tokens signed with the retired key
+// stay valid for the grace period.
+func (s *JwtKeyService) Rotate(ctx context.Context) (*models.JwtSigningKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, err := newJwtSigningKey()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.JwtSigningKey{}).Where("retired_at IS NULL").Update("retired_at", time.Now()).Error; err != nil {
+			return fmt.Errorf("failed to retire signing key: %w", err)
+		}
+		if err := tx.Create(key).Error; err != nil {
+			return fmt.Errorf("failed to create signing key: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "Rotated JWT signing key", "kid", key.ID)
+	return key, s.refreshLocked(ctx, true)
+}
+
+// RotateIfDue rotates the signing key once it is older than the rotation interval and reports
+// whether it did.
+func (s *JwtKeyService) RotateIfDue(ctx context.Context) (bool, error) {
+	interval := s.RotationInterval(ctx)
+	if interval == 0 {
+		return false, nil
+	}
+
+	if _, _, err := s.SigningKey(ctx); err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	due := s.current != nil && time.Since(s.current.createdAt) >= interval
+	s.mu.Unlock()
+	if !due {
+		return false, nil
+	}
+
+	if _, err := s.Rotate(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// PruneExpired deletes retired keys whose grace period has passed.
+func (s *JwtKeyService) PruneExpired(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().Add(-s.GracePeriod(ctx))
+	result := s.db.WithContext(ctx).Where("retired_at IS NOT NULL AND retired_at < ?", cutoff).Delete(&models.JwtSigningKey{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to prune signing keys: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		slog.InfoContext(ctx, "Pruned expired JWT signing keys", "count", result.RowsAffected)
+	}
+	return result.RowsAffected, s.refreshLocked(ctx, true)
+}
+
+// RevokeRetired deletes every retired key, ending the sessions they signed without waiting for
+// the grace period. Use it after a rotation when a key may have leaked.
+func (s *JwtKeyService) RevokeRetired(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := s.db.WithContext(ctx).Where("retired_at IS NOT NULL").Delete(&models.JwtSigningKey{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to revoke signing keys: %w", result.Error)
+	}
+	return result.RowsAffected, s.refreshLocked(ctx, true)
+}
+
+func (s *JwtKeyService) lookup(ctx context.Context, kid string) (*jwtKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.refreshLocked(ctx, false); err != nil {
+		return nil, err
+	}
+	if key, ok := s.keys[kid]; ok {
+		return key, nil
+	}
+
+	// The key may have been created by another process since the last refresh.
+	if time.Since(s.loadedAt) >= jwtKeyMinReloadInterval {
+		if err := s.refreshLocked(ctx, true); err != nil {
+			return nil, err
+		}
+		if key, ok := s.keys[kid]; ok {
+			return key, nil
+		}
+	}
+	return nil, ErrJwtKeyNotFound
+}
+
+// initLocked creates the first key of the ring. The JWT_SECRET in use until now is kept as a
+// retired key so existing sessions survive the upgrade, unless it is the well-known default.
+func (s *JwtKeyService) initLocked(ctx context.Context) error {
+	key, err := newJwtSigningKey()
+	if err != nil {
+		return err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var active int64
+		if err := tx.Model(&models.JwtSigningKey{}).Where("retired_at IS NULL").Count(&active).Error; err != nil {
+			return fmt.Errorf("failed to check signing keys: %w", err)
+		}
+		if active > 0 {
+			// Another process initialized the ring first.
+			return nil
+		}
+
+		var legacy int64
+		if err := tx.Model(&models.JwtSigningKey{}).Where("id = ?", jwtLegacyKeyID).Count(&legacy).Error; err != nil {
+			return fmt.Errorf("failed to check signing keys: %w", err)
+		}
+		if legacy == 0 && s.legacySecret == config.DefaultJWTSecret {
+			slog.WarnContext(ctx, "Not carrying the default JWT_SECRET over into the key ring; existing sessions must sign in again")
+		} else if legacy == 0 && s.legacySecret != "" {
+			encrypted, err := utils.Encrypt(base64.StdEncoding.EncodeToString([]byte(s.legacySecret)))
+			if err != nil {
+				return fmt.Errorf("failed to encrypt signing key: %w", err)
+			}
+			now := time.Now()
+			if err := tx.Create(&models.JwtSigningKey{
+				BaseModel: models.BaseModel{ID: jwtLegacyKeyID},
+				Secret:    encrypted,
+				RetiredAt: &now,
+			}).Error; err != nil {
+				return fmt.Errorf("failed to store legacy signing key: %w", err)
+			}
+		}
+
+		if err := tx.Create(key).Error; err != nil {
+			return fmt.Errorf("failed to create signing key: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.refreshLocked(ctx, true); err != nil {
+		return err
+	}
+	if s.current == nil {
+		return errors.New("no current signing key after initialization")
+	}
+	return nil
+}
+
+func (s *JwtKeyService) refreshLocked(ctx context.Context, force bool) error {
+	if !force && s.keys != nil && time.Since(s.loadedAt) < jwtKeyRefreshInterval {
+		return nil
+	}
+
+	var rows []models.JwtSigningKey
+	if err := s.db.WithContext(ctx).Order("created_at ASC").Find(&rows).Error; err != nil {
+		return fmt.Errorf("failed to load signing keys: %w", err)
+	}
+
+	keys := make(map[string]*jwtKey, len(rows))
+	var current *jwtKey
+	for _, row := range rows {
+		decrypted, err := utils.Decrypt(row.Secret)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to decrypt JWT signing key; skipping", "kid", row.ID, "error", err)
+			continue
+		}
+		secret, err := base64.StdEncoding.DecodeString(decrypted)
+		if err != nil || len(secret) == 0 {
+			slog.ErrorContext(ctx, "Invalid JWT signing key; skipping", "kid", row.ID)
+			continue
+		}
+		key := &jwtKey{id: row.ID, secret: secret, createdAt: row.CreatedAt, retiredAt: row.RetiredAt}
+		keys[row.ID] = key
+		if key.retiredAt == nil {
+			current = key
+		}
+	}
+
+	s.keys = keys
+	s.current = current
+	s.loadedAt = time.Now()
+	return nil
+}
+
+func newJwtSigningKey() (*models.JwtSigningKey, error) {
+	secret := make([]byte, jwtKeySize)
+	if _, err := crand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	encrypted, err := utils.Encrypt(base64.StdEncoding.EncodeToString(secret))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt signing key: %w", err)
+	}
+	return &models.JwtSigningKey{
+		BaseModel: models.BaseModel{ID: uuid.NewString(), CreatedAt: time.Now()},
+		Secret:    encrypted,
+	}, nil
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	glsqlite "github.com/glebarez/sqlite"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/ofkm/arcane-backend/internal/config"
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/utils"
+)
+
+// newTestJwtKeyService returns a key ring without a legacy secret on db.
+func newTestJwtKeyService(t *testing.T, db *database.DB, settingsService *SettingsService) *JwtKeyService {
+	t.Helper()
+	utils.InitEncryption(&config.Config{})
+	require.NoError(t, db.AutoMigrate(&models.JwtSigningKey{}))
+	return NewJwtKeyService(db, settingsService, "")
+}
+
+func setupJwtKeyTest(t *testing.T, legacySecret string) (*JwtKeyService, *AuthService, *database.DB) {
+	t.Helper()
+	ctx := context.Background()
+	utils.InitEncryption(&config.Config{})
+	gdb, err := gorm.Open(glsqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, gdb.AutoMigrate(&models.User{}, &models.SettingVariable{}, &models.Event{}, &models.JwtSigningKey{}))
+	db := &database.DB{DB: gdb}
+
+	settingsService, err := NewSettingsService(ctx, db)
+	require.NoError(t, err)
+	require.NoError(t, settingsService.EnsureDefaultSettings(ctx))
+
+	jwtKeys := NewJwtKeyService(db, settingsService, legacySecret)
+	authService := NewAuthService(NewUserService(db), settingsService, NewEventService(db), nil, nil, nil, nil, nil, jwtKeys, &config.Config{})
+	return jwtKeys, authService, db
+}
+
+func signLegacyToken(t *testing.T, secret string, user *models.User) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, UserClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        user.ID,
+			Subject:   "access",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		UserID: user.ID,
+	})
+	signed, err := token.SignedString([]byte(secret))
+	require.NoError(t, err)
+	return signed
+}
+
+func TestJwtKeyService_RotationKeepsPreviousKeyDuringGrace(t *testing.T) {
+	jwtKeys, authService, db := setupJwtKeyTest(t, "")
+	ctx := context.Background()
+
+	user, err := authService.userService.CreateUser(ctx, &models.User{Username: "ivy", Roles: models.StringSlice{models.RoleUser}})
+	require.NoError(t, err)
+	pair, err := authService.generateTokenPair(ctx, user, "")
+	require.NoError(t, err)
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(pair.AccessToken, &UserClaims{})
+	require.NoError(t, err)
+	firstKid := parsed.Header["kid"]
+	require.NotEmpty(t, firstKid)
+
+	rotated, err := jwtKeys.Rotate(ctx)
+	require.NoError(t, err)
+	require.NotEqual(t, firstKid, rotated.ID)
+
+	// Tokens signed before the rotation still verify, new tokens name the new key.
+	_, err = authService.VerifyToken(ctx, pair.AccessToken)
+	require.NoError(t, err)
+	_, err = authService.RefreshToken(ctx, pair.RefreshToken)
+	require.NoError(t, err)
+	newPair, err := authService.generateTokenPair(ctx, user, "")
+	require.NoError(t, err)
+	parsed, _, err = jwt.NewParser().ParseUnverified(newPair.AccessToken, &UserClaims{})
+	require.NoError(t, err)
+	require.Equal(t, rotated.ID, parsed.Header["kid"])
+
+	// Once the grace period has passed the retired key no longer verifies and is pruned.
+	require.NoError(t, jwtKeys.settingsService.SetIntSetting(ctx, "authJwtGracePeriod", 0))
+	_, err = authService.VerifyToken(ctx, pair.AccessToken)
+	require.ErrorIs(t, err, ErrInvalidToken)
+	_, err = authService.VerifyToken(ctx, newPair.AccessToken)
+	require.NoError(t, err)
+
+	pruned, err := jwtKeys.PruneExpired(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, pruned)
+	var remaining int64
+	require.NoError(t, db.Model(&models.JwtSigningKey{}).Count(&remaining).Error)
+	require.EqualValues(t, 1, remaining)
+}
+
+func TestJwtKeyService_CarriesOverLegacySecret(t *testing.T) {
+	jwtKeys, authService, _ := setupJwtKeyTest(t, "operator-chosen-secret")
+	ctx := context.Background()
+
+	user, err := authService.userService.CreateUser(ctx, &models.User{Username: "jude", Roles: models.StringSlice{models.RoleUser}})
+	require.NoError(t, err)
+	legacyToken := signLegacyToken(t, "operator-chosen-secret", user)
+
+	// Sessions issued with JWT_SECRET survive the switch to the key ring.
+	_, _, err = jwtKeys.SigningKey(ctx)
+	require.NoError(t, err)
+	_, err = authService.VerifyToken(ctx, legacyToken)
+	require.NoError(t, err)
+
+	// A token without kid signed with any other secret is refused.
+	_, err = authService.VerifyToken(ctx, signLegacyToken(t, "guessed", user))
+	require.ErrorIs(t, err, ErrInvalidToken)
+
+	require.NoError(t, jwtKeys.settingsService.SetIntSetting(ctx, "authJwtGracePeriod", 0))
+	pruned, err := jwtKeys.PruneExpired(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, pruned)
+	_, err = authService.VerifyToken(ctx, legacyToken)
+	require.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestJwtKeyService_IgnoresDefaultSecretAndRotatesWhenDue(t *testing.T) {
+	jwtKeys, _, db := setupJwtKeyTest(t, config.DefaultJWTSecret)
+	ctx := context.Background()
+
+	kid, _, err := jwtKeys.SigningKey(ctx)
+	require.NoError(t, err)
+	var count int64
+	require.NoError(t, db.Model(&models.JwtSigningKey{}).Count(&count).Error)
+	require.EqualValues(t, 1, count)
+
+	rotated, err := jwtKeys.RotateIfDue(ctx)
+	require.NoError(t, err)
+	require.False(t, rotated)
+
+	// A later start sees a key older than the rotation interval and replaces it.
+	require.NoError(t, db.Model(&models.JwtSigningKey{}).Where("id = ?", kid).Update("created_at", time.Now().Add(-31*24*time.Hour)).Error)
+	restarted := NewJwtKeyService(db, jwtKeys.settingsService, config.DefaultJWTSecret)
+	rotated, err = restarted.RotateIfDue(ctx)
+	require.NoError(t, err)
+	require.True(t, rotated)
+	current, _, err := restarted.SigningKey(ctx)
+	require.NoError(t, err)
+	require.NotEqual(t, kid, current)
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/utils"
+)
+
+const ldapTimeout = 10 * time.Second
+
+var ErrLdapAuthDisabled = errors.New("LDAP authentication is disabled")
+
+// LdapUser is a directory entry that passed a bind with the user's own password.
+type LdapUser struct {
+	ID          string
+	DN          string
+	Username    string
+	Email       string
+	DisplayName string
+	Groups      []string
+}
+
+type LdapService struct {
+	settingsService *SettingsService
+}
+
+func NewLdapService(settingsService *SettingsService) *LdapService {
+	return &LdapService{settingsService: settingsService}
+}
+
+func (s *LdapService) IsEnabled(ctx context.Context) bool {
+	settings, err := s.settingsService.GetSettings(ctx)
+	return err == nil && settings.AuthLdapEnabled.IsTrue()
+}
+
+// GetConfig returns the LDAP configuration with defaults applied for unset attributes.
+func (s *LdapService) GetConfig(ctx context.Context) (*models.LdapConfig, error) {
+	settings, err := s.settingsService.GetSettings(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get settings: %w", err)
+	}
+	if !settings.AuthLdapEnabled.IsTrue() {
+		return nil, ErrLdapAuthDisabled
+	}
+
+	var cfg models.LdapConfig
+	if err := json.Unmarshal([]byte(settings.AuthLdapConfig.Value), &cfg); err != nil {
+		return nil, fmt.Errorf("invalid LDAP config: %w", err)
+	}
+	if cfg.URL == "" || cfg.BaseDN == "" {
+		return nil, errors.New("LDAP URL and base DN must be configured")
+	}
+	// Passwords saved before they were encrypted are used as they are.
+	if cfg.BindPassword != "" {
+		if decrypted, err := utils.Decrypt(cfg.BindPassword); err == nil {
+			cfg.BindPassword = decrypted
+		}
+	}
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = "(uid={username})"
+	}
+	if cfg.UsernameAttribute == "" {
+		cfg.UsernameAttribute = "uid"
+	}
+	if cfg.EmailAttribute == "" {
+		cfg.EmailAttribute = "mail"
+	}
+	if cfg.DisplayNameAttribute == "" {
+		cfg.DisplayNameAttribute = "displayName"
+	}
+	if cfg.GroupAttribute == "" {
+		cfg.GroupAttribute = "memberOf"
+	}
+	return &cfg, nil
+}
+
+// Authenticate looks the user up with the configured filter and verifies the password by
+// binding as the entry found. Unknown users and wrong passwords both yield ErrInvalidCredentials.
+func (s *LdapService) Authenticate(ctx context.Context, username, password string) (*LdapUser, error) {
+	// An empty password would turn the user bind into an unauthenticated bind, which many
+	// servers accept.
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	cfg, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := s.connect(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if cfg.BindDN != "" {
+		if err := conn.Bind(cfg.BindDN, cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("LDAP service bind failed: %w", err)
+		}
+	}
+
+	attributes := []string{cfg.UsernameAttribute, cfg.EmailAttribute, cfg.DisplayNameAttribute, cfg.GroupAttribute}
+	if cfg.IDAttribute != "" {
+		attributes = append(attributes, cfg.IDAttribute)
+	}
+	filter := strings.ReplaceAll(cfg.UserFilter, "{username}", ldap.EscapeFilter(username))
+	result, err := conn.Search(ldap.NewSearchRequest(
+		cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(ldapTimeout.Seconds()), false, filter, attributes, nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("LDAP user search failed: %w", err)
+	}
+	if result == nil || len(result.Entries) != 1 {
+		if result != nil && len(result.Entries) > 1 {
+			slog.WarnContext(ctx, "LDAP user filter matched more than one entry", "username", username)
+		}
+		return nil, ErrInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("LDAP user bind failed: %w", err)
+	}
+
+	user := &LdapUser{
+		ID:          entry.DN,
+		DN:          entry.DN,
+		Username:    entry.GetAttributeValue(cfg.UsernameAttribute),
+		Email:       entry.GetAttributeValue(cfg.EmailAttribute),
+		DisplayName: entry.GetAttributeValue(cfg.DisplayNameAttribute),
+		Groups:      entry.GetAttributeValues(cfg.GroupAttribute),
+	}
+	if cfg.IDAttribute != "" {
+		if raw := entry.GetRawAttributeValue(cfg.IDAttribute); len(raw) > 0 {
+			user.ID = ldapIdentifier(raw)
+		}
+	}
+	if user.Username == "" {
+		user.Username = username
+	}
+	return user, nil
+}
+
+func (s *LdapService) connect(ctx context.Context, cfg *models.LdapConfig) (*ldap.Conn, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LDAP URL: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: cfg.SkipTLSVerify, //nolint:gosec // opt-in for directories with self-signed certificates
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	dialer := &net.Dialer{Timeout: ldapTimeout}
+	if deadline, ok := ctx.Deadline(); ok {
+		dialer.Deadline = deadline
+	}
+	conn, err := ldap.DialURL(cfg.URL, ldap.DialWithDialer(dialer), ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to LDAP server: %w", err)
+	}
+	conn.SetTimeout(ldapTimeout)
+
+	if cfg.StartTLS && u.Scheme == "ldap" {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("LDAP StartTLS failed: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// MapRoles returns the roles an LDAP user should hold. Without group mappings the current roles
+// are kept; with them the result is rebuilt from group membership alone.
+func (s *LdapService) MapRoles(cfg *models.LdapConfig, current models.StringSlice, groups []string) models.StringSlice {
+	if len(cfg.GroupMappings) == 0 {
+		if len(current) == 0 {
+			return models.StringSlice{models.RoleUser}
+		}
+		return current
+	}
+
+	roles := models.StringSlice{models.RoleUser}
+	for _, mapping := range cfg.GroupMappings {
+		if mapping.Role != "" && ldapMemberOf(groups, mapping.Group) {
+			roles = addRole(roles, mapping.Role)
+		}
+	}
+	return roles
+}
+
+// ldapMemberOf matches group against the user's group DNs, either as a full DN or as the value
+// of the first RDN.
+func ldapMemberOf(groups []string, group string) bool {
+	group = strings.TrimSpace(group)
+	if group == "" {
+		return false
+	}
+	for _, dn := range groups {
+		if strings.EqualFold(dn, group) {
+			return true
+		}
+		if parsed, err := ldap.ParseDN(dn); err == nil && len(parsed.RDNs) > 0 && len(parsed.RDNs[0].Attributes) > 0 {
+			if strings.EqualFold(parsed.RDNs[0].Attributes[0].Value, group) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ldapIdentifier renders an ID attribute; binary values such as objectGUID are hex encoded.
+func ldapIdentifier(raw []byte) string {
+	if utf8.Valid(raw) && !strings.ContainsRune(string(raw), 0) {
+		return string(raw)
+	}
+	return hex.EncodeToString(raw)
+}
@@ -0,0 +1,365 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	glsqlite "github.com/glebarez/sqlite"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/ofkm/arcane-backend/internal/config"
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/dto"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/utils"
+)
+
+const startTLSOID = "1.3.6.1.4.1.1466.20037"
+
+type ldapTestEntry struct {
+	dn         string
+	password   string
+	attributes map[string][]string
+}
+
+// ldapTestServer is a minimal in-process directory. It understands simple binds, equality
+// searches on uid, StartTLS and unbind, which is all the LDAP provider uses.
+type ldapTestServer struct {
+	t          *testing.T
+	listener   net.Listener
+	tlsConfig  *tls.Config
+	requireTLS bool
+
+	mu      sync.Mutex
+	entries []ldapTestEntry
+}
+
+func newLdapTestServer(t *testing.T, entries ...ldapTestEntry) *ldapTestServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := &ldapTestServer{t: t, listener: listener, tlsConfig: selfSignedTLSConfig(t), entries: entries}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn)
+		}
+	}()
+	return srv
+}
+
+func (srv *ldapTestServer) url() string {
+	return "ldap://" + srv.listener.Addr().String()
+}
+
+func (srv *ldapTestServer) setGroups(dn string, groups ...string) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for i := range srv.entries {
+		if srv.entries[i].dn == dn {
+			srv.entries[i].attributes["memberOf"] = groups
+		}
+	}
+}
+
+func (srv *ldapTestServer) serve(conn net.Conn) {
+	defer conn.Close()
+	_, secure := conn.(*tls.Conn)
+	boundAsService := false
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		messageID := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			code := int64(ldap.LDAPResultInvalidCredentials)
+			name := op.Children[1].Value.(string)
+			password := string(op.Children[2].Data.Bytes())
+			switch {
+			case srv.requireTLS && !secure:
+				code = ldap.LDAPResultConfidentialityRequired
+			case srv.checkPassword(name, password):
+				code = ldap.LDAPResultSuccess
+				boundAsService = name == "cn=svc,dc=example,dc=org"
+			}
+			srv.write(conn, messageID, ldapResult(ldap.ApplicationBindResponse, code))
+
+		case ldap.ApplicationSearchRequest:
+			if !boundAsService {
+				srv.write(conn, messageID, ldapResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights))
+				continue
+			}
+			filter, err := ldap.DecompileFilter(op.Children[6])
+			require.NoError(srv.t, err)
+			for _, entry := range srv.search(filter) {
+				srv.write(conn, messageID, searchResultEntry(entry))
+			}
+			srv.write(conn, messageID, ldapResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+
+		case ldap.ApplicationExtendedRequest:
+			if string(op.Children[0].Data.Bytes()) != startTLSOID {
+				srv.write(conn, messageID, ldapResult(ldap.ApplicationExtendedResponse, ldap.LDAPResultProtocolError))
+				continue
+			}
+			srv.write(conn, messageID, ldapResult(ldap.ApplicationExtendedResponse, ldap.LDAPResultSuccess))
+			tlsConn := tls.Server(conn, srv.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			secure = true
+
+		case ldap.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+func (srv *ldapTestServer) checkPassword(dn, password string) bool {
+	if dn == "cn=svc,dc=example,dc=org" {
+		return password == "svc-secret"
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for _, entry := range srv.entries {
+		if strings.EqualFold(entry.dn, dn) {
+			return password != "" && password == entry.password
+		}
+	}
+	return false
+}
+
+func (srv *ldapTestServer) search(filter string) []ldapTestEntry {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	var out []ldapTestEntry
+	for _, entry := range srv.entries {
+		if filter == fmt.Sprintf("(uid=%s)", ldap.EscapeFilter(entry.attributes["uid"][0])) {
+			out = append(out, entry)
+		}
+	}
+	return out
+}
+
+func (srv *ldapTestServer) write(conn net.Conn, messageID int64, op *ber.Packet) {
+	envelope := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
+	envelope.AppendChild(op)
+	_, _ = conn.Write(envelope.Bytes())
+}
+
+func ldapResult(application ber.Tag, code int64) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, application, nil, "Response")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "resultCode"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	return op
+}
+
+func searchResultEntry(entry ldapTestEntry) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, "objectName"))
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	for name, values := range entry.attributes {
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "value"))
+		}
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+	op.AppendChild(attributes)
+	return op
+}
+
+func selfSignedTLSConfig(t *testing.T) *tls.Config {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}, MinVersion: tls.VersionTLS12}
+}
+
+func setupLdapTest(t *testing.T, srv *ldapTestServer, mutate func(*models.LdapConfig)) (*AuthService, *UserService) {
+	t.Helper()
+	ctx := context.Background()
+	utils.InitEncryption(&config.Config{})
+	gdb, err := gorm.Open(glsqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, gdb.AutoMigrate(&models.User{}, &models.SettingVariable{}, &models.Event{}))
+	db := &database.DB{DB: gdb}
+
+	settingsService, err := NewSettingsService(ctx, db)
+	require.NoError(t, err)
+	require.NoError(t, settingsService.EnsureDefaultSettings(ctx))
+
+	ldapConfig := models.LdapConfig{
+		URL:          srv.url(),
+		BindDN:       "cn=svc,dc=example,dc=org",
+		BindPassword: "svc-secret",
+		BaseDN:       "ou=people,dc=example,dc=org",
+		IDAttribute:  "entryUUID",
+		GroupMappings: []models.LdapGroupMapping{
+			{Group: "arcane-admins", Role: models.RoleAdmin},
+		},
+	}
+	if mutate != nil {
+		mutate(&ldapConfig)
+	}
+	raw, err := json.Marshal(ldapConfig)
+	require.NoError(t, err)
+	require.NoError(t, settingsService.SetBoolSetting(ctx, "authLdapEnabled", true))
+	rawConfig := string(raw)
+	_, err = settingsService.UpdateSettings(ctx, dto.UpdateSettingsDto{AuthLdapConfig: &rawConfig})
+	require.NoError(t, err)
+
+	userService := NewUserService(db)
+	authService := NewAuthService(userService, settingsService, NewEventService(db), nil, nil, nil, nil, NewLdapService(settingsService), newTestJwtKeyService(t, db, settingsService), &config.Config{})
+	return authService, userService
+}
+
+func aliceEntry() ldapTestEntry {
+	return ldapTestEntry{
+		dn:       "uid=alice,ou=people,dc=example,dc=org",
+		password: "wonderland",
+		attributes: map[string][]string{
+			"uid":         {"alice"},
+			"mail":        {"alice@example.org"},
+			"displayName": {"Alice Liddell"},
+			"entryUUID":   {"5f1c3f3e-0b7a-4c1e-9d4a-1f0e2b3c4d5e"},
+			"memberOf":    {"cn=arcane-admins,ou=groups,dc=example,dc=org"},
+		},
+	}
+}
+
+func TestAuthService_LdapLoginProvisionsUser(t *testing.T) {
+	srv := newLdapTestServer(t, aliceEntry())
+	authService, _ := setupLdapTest(t, srv, nil)
+	ctx := context.Background()
+
+	user, tokens, err := authService.LdapLogin(ctx, "alice", "wonderland")
+	require.NoError(t, err)
+	require.NotNil(t, tokens)
+	require.Equal(t, "alice", user.Username)
+	require.Equal(t, "alice@example.org", *user.Email)
+	require.Equal(t, "Alice Liddell", *user.DisplayName)
+	require.Equal(t, "5f1c3f3e-0b7a-4c1e-9d4a-1f0e2b3c4d5e", *user.LdapId)
+	require.ElementsMatch(t, []string{models.RoleUser, models.RoleAdmin}, user.Roles)
+
+	_, _, err = authService.LdapLogin(ctx, "alice", "wrong")
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+	_, _, err = authService.LdapLogin(ctx, "bob", "wonderland")
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+	_, _, err = authService.LdapLogin(ctx, "alice", "")
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// Group membership is re-read on every login and the same account is reused.
+	srv.setGroups("uid=alice,ou=people,dc=example,dc=org", "cn=developers,ou=groups,dc=example,dc=org")
+	again, _, err := authService.LdapLogin(ctx, "alice", "wonderland")
+	require.NoError(t, err)
+	require.Equal(t, user.ID, again.ID)
+	require.Equal(t, models.StringSlice{models.RoleUser}, again.Roles)
+}
+
+func TestSettingsService_EncryptsLdapBindPassword(t *testing.T) {
+	srv := newLdapTestServer(t, aliceEntry())
+	authService, _ := setupLdapTest(t, srv, nil)
+	ctx := context.Background()
+	settingsService := authService.settingsService
+
+	storedPassword := func() string {
+		settings, err := settingsService.GetSettings(ctx)
+		require.NoError(t, err)
+		var stored models.LdapConfig
+		require.NoError(t, json.Unmarshal([]byte(settings.AuthLdapConfig.Value), &stored))
+		return stored.BindPassword
+	}
+	encrypted := storedPassword()
+	require.NotEmpty(t, encrypted)
+	require.NotContains(t, encrypted, "svc-secret")
+	_, _, err := authService.LdapLogin(ctx, "alice", "wonderland")
+	require.NoError(t, err)
+
+	// Saving without a password keeps the encrypted one.
+	raw, err := json.Marshal(models.LdapConfig{URL: srv.url(), BindDN: "cn=svc,dc=example,dc=org", BaseDN: "ou=people,dc=example,dc=org", IDAttribute: "entryUUID"})
+	require.NoError(t, err)
+	rawConfig := string(raw)
+	_, err = settingsService.UpdateSettings(ctx, dto.UpdateSettingsDto{AuthLdapConfig: &rawConfig})
+	require.NoError(t, err)
+	require.Equal(t, encrypted, storedPassword())
+	_, _, err = authService.LdapLogin(ctx, "alice", "wonderland")
+	require.NoError(t, err)
+
+	// A password stored before encryption was added still works.
+	legacy, err := json.Marshal(models.LdapConfig{URL: srv.url(), BindDN: "cn=svc,dc=example,dc=org", BindPassword: "svc-secret", BaseDN: "ou=people,dc=example,dc=org", IDAttribute: "entryUUID"})
+	require.NoError(t, err)
+	require.NoError(t, settingsService.SetStringSetting(ctx, "authLdapConfig", string(legacy)))
+	_, _, err = authService.LdapLogin(ctx, "alice", "wonderland")
+	require.NoError(t, err)
+}
+
+func TestAuthService_LdapLoginWithStartTLS(t *testing.T) {
+	srv := newLdapTestServer(t, aliceEntry())
+	srv.requireTLS = true
+
+	authService, _ := setupLdapTest(t, srv, nil)
+	_, _, err := authService.LdapLogin(context.Background(), "alice", "wonderland")
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrInvalidCredentials)
+
+	authService, _ = setupLdapTest(t, srv, func(cfg *models.LdapConfig) {
+		cfg.StartTLS = true
+		cfg.SkipTLSVerify = true
+	})
+	_, tokens, err := authService.LdapLogin(context.Background(), "alice", "wonderland")
+	require.NoError(t, err)
+	require.NotNil(t, tokens)
+}
+
+func TestAuthService_LdapLoginDoesNotTakeOverLocalAccounts(t *testing.T) {
+	srv := newLdapTestServer(t, aliceEntry())
+	authService, userService := setupLdapTest(t, srv, nil)
+	ctx := context.Background()
+
+	_, err := userService.CreateUserWithPassword("alice", "local-password", "alice@local", models.RoleUser, "Local Alice")
+	require.NoError(t, err)
+
+	_, _, err = authService.LdapLogin(ctx, "alice", "wonderland")
+	require.ErrorIs(t, err, ErrUsernameTaken)
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/models"
+)
+
+const (
+	maxLockoutDuration = 24 * time.Hour
+	// ipAttemptRetention is how long an IP's lockout history is kept after its last failure.
+	ipAttemptRetention = 24 * time.Hour
+)
+
+var (
+	ErrAccountLocked        = errors.New("account is temporarily locked")
+	ErrTooManyLoginAttempts = errors.New("too many failed login attempts")
+)
+
+// LoginLockoutError is returned while an account or client IP is locked out. It unwraps to
+// ErrAccountLocked or ErrTooManyLoginAttempts.
+type LoginLockoutError struct {
+	Until time.Time
+	err   error
+}
+
+func (e *LoginLockoutError) Error() string { return e.err.Error() }
+
+func (e *LoginLockoutError) Unwrap() error { return e.err }
+
+// RetryAfter returns how long the caller has to wait before trying again.
+func (e *LoginLockoutError) RetryAfter() time.Duration {
+	return max(time.Until(e.Until), 0)
+}
+
+type loginThrottleConfig struct {
+	maxAttempts   int
+	ipMaxAttempts int
+	lockout       time.Duration
+	window        time.Duration
+}
+
+type ipAttempts struct {
+	failures    int
+	firstFailed time.Time
+	lastFailed  time.Time
+	lockouts    int
+	lockedUntil time.Time
+}
+
+// LoginThrottleService protects password logins against brute force. Accounts are locked in the
+// database after repeated failures; client IPs are rate limited in memory.
+type LoginThrottleService struct {
+	db              *database.DB
+	settingsService *SettingsService
+	eventService    *EventService
+
+	mu  sync.Mutex
+	ips map[string]*ipAttempts
+}
+
+func NewLoginThrottleService(db *database.DB, settingsService *SettingsService, eventService *EventService) *LoginThrottleService {
+	return &LoginThrottleService{
+		db:              db,
+		settingsService: settingsService,
+		eventService:    eventService,
+		ips:             make(map[string]*ipAttempts),
+	}
+}
+
+func (s *LoginThrottleService) config(ctx context.Context) loginThrottleConfig {
+	cfg := loginThrottleConfig{maxAttempts: 5, ipMaxAttempts: 20, lockout: 5 * time.Minute, window: 15 * time.Minute}
+	settings, err := s.settingsService.GetSettings(ctx)
+	if err != nil {
+		return cfg
+	}
+	cfg.maxAttempts = settings.AuthLoginMaxAttempts.AsInt()
+	cfg.ipMaxAttempts = settings.AuthLoginIpMaxAttempts.AsInt()
+	if minutes := settings.AuthLoginLockoutDuration.AsInt(); minutes > 0 {
+		cfg.lockout = time.Duration(minutes) * time.Minute
+	}
+	if minutes := settings.AuthLoginAttemptWindow.AsInt(); minutes > 0 {
+		cfg.window = time.Duration(minutes) * time.Minute
+	}
+	return cfg
+}
+
+// CheckIP fails while ip is locked out. It runs before the username is looked up so blocked
+// clients cannot probe accounts at all.
+func (s *LoginThrottleService) CheckIP(ip string) error {
+	if ip == "" {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry, ok := s.ips[ip]; ok && time.Now().Before(entry.lockedUntil) {
+		return &LoginLockoutError{Until: entry.lockedUntil, err: ErrTooManyLoginAttempts}
+	}
+	return nil
+}
+
+// CheckUser fails while the account is locked out.
+func (s *LoginThrottleService) CheckUser(user *models.User) error {
+	if user != nil && user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
+		return &LoginLockoutError{Until: *user.LockedUntil, err: ErrAccountLocked}
+	}
+	return nil
+}
+
+// RecordFailure counts a failed login from ip against username, locking the account or IP once
+// their limits are reached. user is nil when the username does not exist.
+func (s *LoginThrottleService) RecordFailure(ctx context.Context, ip, username string, user *models.User, reason string) {
+	cfg := s.config(ctx)
+	now := time.Now()
+
+	ipLockedUntil := s.recordIPFailure(ip, cfg, now)
+
+	userID := ""
+	if user != nil {
+		userID = user.ID
+		if until := s.recordUserFailure(ctx, user, cfg, now); until != nil {
+			s.logEvent(ctx, models.EventTypeUserLocked, userID, username, models.JSON{
+				"reason":       "account",
+				"lockedUntil":  until,
+				"lockoutCount": user.LockoutCount,
+				"ipAddress":    ip,
+			})
+		}
+	}
+
+	s.logEvent(ctx, models.EventTypeUserLoginFailed, userID, username, models.JSON{
+		"reason":    reason,
+		"ipAddress": ip,
+	})
+	if ipLockedUntil != nil {
+		s.logEvent(ctx, models.EventTypeUserLocked, userID, username, models.JSON{
+			"reason":      "ip",
+			"lockedUntil": ipLockedUntil,
+			"ipAddress":   ip,
+		})
+	}
+}
+
+// RecordSuccess clears the account's failure and lockout history after a successful login.
+func (s *LoginThrottleService) RecordSuccess(ctx context.Context, user *models.User) {
+	if user.FailedLoginAttempts == 0 && user.LockoutCount == 0 && user.LockedUntil == nil {
+		return
+	}
+	if err := s.resetUser(ctx, user.ID); err != nil {
+		slog.WarnContext(ctx, "Failed to reset failed login counter", "user", user.Username, "error", err)
+	}
+	user.FailedLoginAttempts = 0
+	user.LockoutCount = 0
+	user.LockedUntil = nil
+}
+
+// Unlock clears a user's lockout so they can sign in immediately.
+func (s *LoginThrottleService) Unlock(ctx context.Context, userID string) error {
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", userID).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to load user: %w", err)
+	}
+	if count == 0 {
+		return ErrUserNotFound
+	}
+	return s.resetUser(ctx, userID)
+}
+
+// UnlockIP clears the in-memory lockout of a client IP.
+func (s *LoginThrottleService) UnlockIP(ip string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.ips, ip)
+}
+
+func (s *LoginThrottleService) recordUserFailure(ctx context.Context, user *models.User, cfg loginThrottleConfig, now time.Time) *time.Time {
+	if cfg.maxAttempts <= 0 {
+		return nil
+	}
+
+	user.FailedLoginAttempts++
+	var lockedUntil *time.Time
+	if user.FailedLoginAttempts >= cfg.maxAttempts {
+		user.LockoutCount++
+		until := now.Add(lockoutDuration(cfg.lockout, user.LockoutCount))
+		user.LockedUntil = &until
+		user.FailedLoginAttempts = 0
+		lockedUntil = &until
+	}
+
+	if err := s.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"failed_login_attempts": user.FailedLoginAttempts,
+		"lockout_count":         user.LockoutCount,
+		"locked_until":          user.LockedUntil,
+	}).Error; err != nil {
+		slog.WarnContext(ctx, "Failed to record failed login", "user", user.Username, "error", err)
+	}
+	return lockedUntil
+}
+
+func (s *LoginThrottleService) recordIPFailure(ip string, cfg loginThrottleConfig, now time.Time) *time.Time {
+	if ip == "" || cfg.ipMaxAttempts <= 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, entry := range s.ips {
+		if now.Sub(entry.lastFailed) > ipAttemptRetention && now.After(entry.lockedUntil) {
+			delete(s.ips, key)
+		}
+	}
+
+	entry, ok := s.ips[ip]
+	if !ok {
+		entry = &ipAttempts{}
+		s.ips[ip] = entry
+	}
+	if now.Sub(entry.firstFailed) > cfg.window {
+		entry.failures = 0
+		entry.firstFailed = now
+	}
+	entry.failures++
+	entry.lastFailed = now
+
+	if entry.failures < cfg.ipMaxAttempts {
+		return nil
+	}
+	entry.lockouts++
+	entry.failures = 0
+	entry.lockedUntil = now.Add(lockoutDuration(cfg.lockout, entry.lockouts))
+	until := entry.lockedUntil
+	return &until
+}
+
+func (s *LoginThrottleService) resetUser(ctx context.Context, userID string) error {
+	if err := s.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"failed_login_attempts": 0,
+		"lockout_count":         0,
+		"locked_until":          nil,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to unlock user: %w", err)
+	}
+	return nil
+}
+
+func (s *LoginThrottleService) logEvent(ctx context.Context, eventType models.EventType, userID, username string, metadata models.JSON) {
+	if s.eventService == nil {
+		return
+	}
+	if err := s.eventService.LogUserEvent(ctx, eventType, userID, username, metadata); err != nil {
+		slog.WarnContext(ctx, "Could not log login throttle event", "type", eventType, "error", err)
+	}
+}
+
+// lockoutDuration doubles base for every lockout after the first, capped at 24 hours.
+func lockoutDuration(base time.Duration, lockouts int) time.Duration {
+	d := base
+	for i := 1; i < lockouts && d < maxLockoutDuration; i++ {
+		d *= 2
+	}
+	return min(d, maxLockoutDuration)
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	glsqlite "github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/ofkm/arcane-backend/internal/config"
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/models"
+)
+
+func setupLoginThrottleTest(t *testing.T) (*AuthService, *LoginThrottleService, *UserService, *SettingsService, *database.DB) {
+	t.Helper()
+	ctx := context.Background()
+	gdb, err := gorm.Open(glsqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, gdb.AutoMigrate(&models.User{}, &models.SettingVariable{}, &models.Event{}))
+	db := &database.DB{DB: gdb}
+
+	settingsService, err := NewSettingsService(ctx, db)
+	require.NoError(t, err)
+	require.NoError(t, settingsService.EnsureDefaultSettings(ctx))
+	userService := NewUserService(db)
+	eventService := NewEventService(db)
+	throttle := NewLoginThrottleService(db, settingsService, eventService)
+	authService := NewAuthService(userService, settingsService, eventService, nil, nil, nil, throttle, nil, newTestJwtKeyService(t, db, settingsService), &config.Config{})
+	return authService, throttle, userService, settingsService, db
+}
+
+func TestAuthService_LocksAccountAfterFailedLogins(t *testing.T) {
+	authService, throttle, userService, _, db := setupLoginThrottleTest(t)
+	ctx := WithClientInfo(context.Background(), ClientInfo{IPAddress: "192.0.2.20"})
+
+	user, err := userService.CreateUserWithPassword("erin", "correct-horse", "erin@example.com", models.RoleUser, "Erin")
+	require.NoError(t, err)
+
+	for range 5 {
+		_, _, err = authService.Login(ctx, "erin", "wrong")
+		require.ErrorIs(t, err, ErrInvalidCredentials)
+	}
+
+	// The right password is rejected while the account is locked.
+	_, _, err = authService.Login(ctx, "erin", "correct-horse")
+	require.ErrorIs(t, err, ErrAccountLocked)
+	var lockout *LoginLockoutError
+	require.ErrorAs(t, err, &lockout)
+	require.InDelta(t, 5*time.Minute, lockout.RetryAfter(), float64(5*time.Second))
+
+	var failed, locked int64
+	require.NoError(t, db.Model(&models.Event{}).Where("type = ?", models.EventTypeUserLoginFailed).Count(&failed).Error)
+	require.NoError(t, db.Model(&models.Event{}).Where("type = ?", models.EventTypeUserLocked).Count(&locked).Error)
+	require.EqualValues(t, 5, failed)
+	require.EqualValues(t, 1, locked)
+
+	require.NoError(t, throttle.Unlock(ctx, user.ID))
+	_, tokens, err := authService.Login(ctx, "erin", "correct-horse")
+	require.NoError(t, err)
+	require.NotNil(t, tokens)
+
+	require.ErrorIs(t, throttle.Unlock(ctx, "missing"), ErrUserNotFound)
+}
+
+func TestAuthService_LockoutGrowsWithRepeatedLockouts(t *testing.T) {
+	authService, _, userService, _, _ := setupLoginThrottleTest(t)
+	ctx := context.Background()
+
+	user, err := userService.CreateUserWithPassword("frank", "correct-horse", "frank@example.com", models.RoleUser, "Frank")
+	require.NoError(t, err)
+	// Pretend the account was locked once before and that lockout has run out.
+	expired := time.Now().Add(-time.Minute)
+	user.LockoutCount = 1
+	user.LockedUntil = &expired
+	_, err = userService.UpdateUser(ctx, user)
+	require.NoError(t, err)
+
+	for range 5 {
+		_, _, err = authService.Login(ctx, "frank", "wrong")
+		require.ErrorIs(t, err, ErrInvalidCredentials)
+	}
+
+	user, err = userService.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	require.Equal(t, 2, user.LockoutCount)
+	require.NotNil(t, user.LockedUntil)
+	require.InDelta(t, 10*time.Minute, time.Until(*user.LockedUntil), float64(5*time.Second))
+}
+
+func TestAuthService_ThrottlesClientIP(t *testing.T) {
+	authService, throttle, userService, settingsService, _ := setupLoginThrottleTest(t)
+	ctx := WithClientInfo(context.Background(), ClientInfo{IPAddress: "198.51.100.7"})
+	require.NoError(t, settingsService.SetIntSetting(ctx, "authLoginIpMaxAttempts", 3))
+
+	_, err := userService.CreateUserWithPassword("grace", "correct-horse", "grace@example.com", models.RoleUser, "Grace")
+	require.NoError(t, err)
+
+	for _, username := range []string{"nobody", "admin", "root"} {
+		_, _, err = authService.Login(ctx, username, "guess")
+		require.ErrorIs(t, err, ErrInvalidCredentials)
+	}
+
+	_, _, err = authService.Login(ctx, "grace", "correct-horse")
+	require.ErrorIs(t, err, ErrTooManyLoginAttempts)
+
+	// Other clients are not affected.
+	other := WithClientInfo(context.Background(), ClientInfo{IPAddress: "198.51.100.8"})
+	_, _, err = authService.Login(other, "grace", "correct-horse")
+	require.NoError(t, err)
+
+	throttle.UnlockIP("198.51.100.7")
+	_, _, err = authService.Login(ctx, "grace", "correct-horse")
+	require.NoError(t, err)
+}
+
+func TestLockoutDuration(t *testing.T) {
+	require.Equal(t, 5*time.Minute, lockoutDuration(5*time.Minute, 1))
+	require.Equal(t, 20*time.Minute, lockoutDuration(5*time.Minute, 3))
+	require.Equal(t, 24*time.Hour, lockoutDuration(5*time.Minute, 40))
+}
@@ -638,6 +638,280 @@ func (s *NotificationService) renderContainerUpdateEmailTemplate(containerName,
 	return htmlBuf.String(), textBuf.String(), nil
 }
 
+// SendEnvironmentStatusNotification tells every enabled provider that an environment changed
+// status. reason explains a failed probe and is empty when the environment recovered.
+func (s *NotificationService) SendEnvironmentStatusNotification(ctx context.Context, environmentName, previousStatus, status, reason string) error {
+	if appriseErr := s.appriseService.SendEnvironmentStatusNotification(ctx, environmentName, previousStatus, status, reason); appriseErr != nil {
+		slog.WarnContext(ctx, "Failed to send Apprise notification", "error", appriseErr)
+	}
+
+	settings, err := s.GetAllSettings(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get notification settings: %w", err)
+	}
+
+	var errors []string
+	for _, setting := range settings {
+		if !setting.Enabled || !s.isEventEnabled(setting.Config, models.NotificationEventEnvironment) {
+			continue
+		}
+
+		var sendErr error
+		switch setting.Provider {
+		case models.NotificationProviderDiscord:
+			sendErr = s.sendDiscordEnvironmentStatusNotification(ctx, environmentName, previousStatus, status, reason, setting.Config)
+		case models.NotificationProviderEmail:
+			sendErr = s.sendEmailEnvironmentStatusNotification(ctx, environmentName, previousStatus, status, reason, setting.Config)
+		default:
+			slog.WarnContext(ctx, "Unknown notification provider", "provider", setting.Provider)
+			continue
+		}
+
+		logStatus := "success"
+		var errMsg *string
+		if sendErr != nil {
+			logStatus = "failed"
+			msg := sendErr.Error()
+			errMsg = &msg
+			errors = append(errors, fmt.Sprintf("%s: %s", setting.Provider, msg))
+		}
+
+		s.logNotification(ctx, setting.Provider, environmentName, logStatus, errMsg, models.JSON{
+			"environmentName": environmentName,
+			"previousStatus":  previousStatus,
+			"status":          status,
+			"eventType":       string(models.NotificationEventEnvironment),
+		})
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("notification errors: %s", strings.Join(errors, "; "))
+	}
+
+	return nil
+}
+
+func (s *NotificationService) sendDiscordEnvironmentStatusNotification(ctx context.Context, environmentName, previousStatus, status, reason string, config models.JSON) error {
+	var discordConfig models.DiscordConfig
+	configBytes, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to marshal Discord config: %w", err)
+	}
+	if err := json.Unmarshal(configBytes, &discordConfig); err != nil {
+		return fmt.Errorf("failed to unmarshal Discord config: %w", err)
+	}
+
+	if discordConfig.WebhookURL == "" {
+		return fmt.Errorf("discord webhook URL not configured")
+	}
+
+	webhookURL := discordConfig.WebhookURL
+	if decrypted, err := utils.Decrypt(webhookURL); err == nil {
+		webhookURL = decrypted
+	}
+
+	if err := validateWebhookURL(webhookURL); err != nil {
+		return fmt.Errorf("invalid webhook URL: %w", err)
+	}
+
+	username := discordConfig.Username
+	if username == "" {
+		username = "Arcane"
+	}
+
+	fields := []map[string]interface{}{
+		{"name": "Environment", "value": environmentName, "inline": false},
+		{"name": "Previous Status", "value": previousStatus, "inline": true},
+		{"name": "Status", "value": status, "inline": true},
+	}
+	if reason != "" {
+		fields = append(fields, map[string]interface{}{"name": "Reason", "value": reason, "inline": false})
+	}
+
+	color := 5025616 // Green when the environment is back online
+	switch models.EnvironmentStatus(status) {
+	case models.EnvironmentStatusOffline:
+		color = 15548997 // Red
+	case models.EnvironmentStatusError:
+		color = 15105570 // Orange
+	}
+
+	payload := map[string]interface{}{
+		"username": username,
+		"embeds": []map[string]interface{}{
+			{
+				"title":       fmt.Sprintf("Environment %s", environmentStatusTitle(status)),
+				"description": environmentStatusSummary(environmentName, status),
+				"color":       color,
+				"fields":      fields,
+				"timestamp":   time.Now().Format(time.RFC3339),
+			},
+		},
+	}
+
+	if discordConfig.AvatarURL != "" {
+		payload["avatar_url"] = discordConfig.AvatarURL
+	}
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal Discord payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("webhook returned status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	return nil
+}
+
+func (s *NotificationService) sendEmailEnvironmentStatusNotification(ctx context.Context, environmentName, previousStatus, status, reason string, config models.JSON) error {
+	var emailConfig models.EmailConfig
+	configBytes, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to marshal email config: %w", err)
+	}
+	if err := json.Unmarshal(configBytes, &emailConfig); err != nil {
+		return fmt.Errorf("failed to unmarshal email config: %w", err)
+	}
+
+	if emailConfig.SMTPHost == "" || emailConfig.SMTPPort == 0 {
+		return fmt.Errorf("SMTP host or port not configured")
+	}
+	if len(emailConfig.ToAddresses) == 0 {
+		return fmt.Errorf("no recipient email addresses configured")
+	}
+
+	if _, err := mail.ParseAddress(emailConfig.FromAddress); err != nil {
+		return fmt.Errorf("invalid from address: %w", err)
+	}
+	for _, addr := range emailConfig.ToAddresses {
+		if _, err := mail.ParseAddress(addr); err != nil {
+			return fmt.Errorf("invalid to address %s: %w", addr, err)
+		}
+	}
+
+	if emailConfig.SMTPPassword != "" {
+		if decrypted, err := utils.Decrypt(emailConfig.SMTPPassword); err == nil {
+			emailConfig.SMTPPassword = decrypted
+		}
+	}
+
+	htmlBody, textBody, err := s.renderEnvironmentStatusEmailTemplate(environmentName, previousStatus, status, reason)
+	if err != nil {
+		return fmt.Errorf("failed to render email template: %w", err)
+	}
+
+	subject := fmt.Sprintf("Environment %s: %s", environmentStatusTitle(status), notifications.SanitizeForEmail(environmentName))
+	message := notifications.BuildMultipartMessage(emailConfig.FromAddress, emailConfig.ToAddresses, subject, htmlBody, textBody)
+
+	client, err := notifications.ConnectSMTP(ctx, emailConfig)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	defer client.Close()
+
+	if err := client.SendMessage(emailConfig.FromAddress, emailConfig.ToAddresses, message); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	return nil
+}
+
+func (s *NotificationService) renderEnvironmentStatusEmailTemplate(environmentName, previousStatus, status, reason string) (string, string, error) {
+	statusColor := "#34d399"
+	switch models.EnvironmentStatus(status) {
+	case models.EnvironmentStatusOffline:
+		statusColor = "#f87171"
+	case models.EnvironmentStatusError:
+		statusColor = "#fb923c"
+	}
+	if reason == "" {
+		reason = "-"
+	}
+
+	data := map[string]interface{}{
+		"LogoURL":         "https://raw.githubusercontent.com/getarcaneapp/arcane/main/backend/resources/images/logo-full.svg",
+		"AppURL":          s.config.AppUrl,
+		"EnvironmentName": environmentName,
+		"StatusTitle":     environmentStatusTitle(status),
+		"Summary":         environmentStatusSummary(environmentName, status),
+		"PreviousStatus":  previousStatus,
+		"Status":          status,
+		"StatusColor":     statusColor,
+		"Reason":          reason,
+		"DetectedAt":      time.Now().Format(time.RFC1123),
+	}
+
+	htmlContent, err := resources.FS.ReadFile("email-templates/environment-status_html.tmpl")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read HTML template: %w", err)
+	}
+
+	htmlTmpl, err := template.New("html").Parse(string(htmlContent))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse HTML template: %w", err)
+	}
+
+	var htmlBuf bytes.Buffer
+	if err := htmlTmpl.ExecuteTemplate(&htmlBuf, "root", data); err != nil {
+		return "", "", fmt.Errorf("failed to execute HTML template: %w", err)
+	}
+
+	textContent, err := resources.FS.ReadFile("email-templates/environment-status_text.tmpl")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read text template: %w", err)
+	}
+
+	textTmpl, err := template.New("text").Parse(string(textContent))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse text template: %w", err)
+	}
+
+	var textBuf bytes.Buffer
+	if err := textTmpl.ExecuteTemplate(&textBuf, "root", data); err != nil {
+		return "", "", fmt.Errorf("failed to execute text template: %w", err)
+	}
+
+	return htmlBuf.String(), textBuf.String(), nil
+}
+
+func environmentStatusTitle(status string) string {
+	switch models.EnvironmentStatus(status) {
+	case models.EnvironmentStatusOnline:
+		return "Back Online"
+	case models.EnvironmentStatusOffline:
+		return "Offline"
+	default:
+		return "Unhealthy"
+	}
+}
+
+func environmentStatusSummary(environmentName, status string) string {
+	switch models.EnvironmentStatus(status) {
+	case models.EnvironmentStatusOnline:
+		return fmt.Sprintf("Environment %s is reachable again.", environmentName)
+	case models.EnvironmentStatusOffline:
+		return fmt.Sprintf("Environment %s can no longer be reached.", environmentName)
+	default:
+		return fmt.Sprintf("Environment %s is reachable, but its Docker daemon is not responding.", environmentName)
+	}
+}
+
 func (s *NotificationService) TestNotification(ctx context.Context, provider models.NotificationProvider, testType string) error {
 	setting, err := s.GetSettingsByProvider(ctx, provider)
 	if err != nil {
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 	"sync"
 	"time"
@@ -22,6 +23,9 @@ import (
 	"github.com/ofkm/arcane-backend/internal/utils"
 )
 
+// ErrOidcRefreshRejected is returned when the provider refuses a refresh token.
+var ErrOidcRefreshRejected = errors.New("OIDC provider rejected the refresh token")
+
 type OidcService struct {
 	authService   *AuthService
 	config        *config.Config
@@ -43,11 +47,16 @@ func NewOidcService(authService *AuthService, cfg *config.Config, httpClient *ht
 	if httpClient == nil {
 		httpClient = http.DefaultClient
 	}
-	return &OidcService{
+	s := &OidcService{
 		authService: authService,
 		config:      cfg,
 		httpClient:  httpClient,
 	}
+	if authService != nil {
+		// AuthService re-reads OIDC claims through this service when sessions are refreshed.
+		authService.oidcRefresher = s
+	}
+	return s
 }
 
 func (s *OidcService) getEffectiveConfig(ctx context.Context) (*models.OidcConfig, error) {
@@ -322,38 +331,8 @@ func (s *OidcService) HandleCallback(ctx context.Context, code, state, storedSta
 		return nil, nil, errors.New("missing required 'sub' claim in user info")
 	}
 
-	userInfoDto := dto.OidcUserInfo{
-		Subject:           subject,
-		Name:              utils.GetStringClaim(claims, "name"),
-		Email:             utils.GetStringClaim(claims, "email"),
-		EmailVerified:     utils.GetBoolClaim(claims, "email_verified"),
-		PreferredUsername: utils.GetStringClaim(claims, "preferred_username"),
-		GivenName:         utils.GetStringClaim(claims, "given_name"),
-		FamilyName:        utils.GetStringClaim(claims, "family_name"),
-		Admin:             utils.GetBoolClaim(claims, "admin"),
-		Roles:             utils.GetStringSliceClaim(claims, "roles"),
-		Groups:            utils.GetStringSliceClaim(claims, "groups"),
-		Extra:             claims,
-	}
-
-	tokenType := token.TokenType
-	if tokenType == "" {
-		tokenType = "Bearer"
-	}
-
-	tokenResp := &dto.OidcTokenResponse{
-		AccessToken:  token.AccessToken,
-		TokenType:    tokenType,
-		RefreshToken: token.RefreshToken,
-		IDToken:      rawIDToken,
-	}
-	if !token.Expiry.IsZero() {
-		expiresIn := int(time.Until(token.Expiry).Seconds())
-		if expiresIn < 0 {
-			expiresIn = 0
-		}
-		tokenResp.ExpiresIn = expiresIn
-	}
+	userInfoDto := userInfoFromClaims(subject, claims)
+	tokenResp := tokenResponseFromOauth(token, rawIDToken)
 
 	slog.Info("HandleCallback: authentication successful", "subject", userInfoDto.Subject, "email", userInfoDto.Email)
 	return &userInfoDto, tokenResp, nil
@@ -375,6 +354,58 @@ func (s *OidcService) RefreshToken(ctx context.Context, refreshToken string) (*d
 		return nil, err
 	}
 
+	tokenResp, _, err := s.refreshOauthToken(ctx, cfg, provider, refreshToken)
+	return tokenResp, err
+}
+
+// RefreshUserInfo redeems refreshToken and re-reads the user's claims so role mappings can be
+// evaluated again without an interactive login. It returns ErrOidcRefreshRejected when the
+// provider no longer accepts the refresh token, e.g. because the user was disabled.
+func (s *OidcService) RefreshUserInfo(ctx context.Context, refreshToken string) (*dto.OidcUserInfo, *dto.OidcTokenResponse, error) {
+	if refreshToken == "" {
+		return nil, nil, errors.New("refresh token is required")
+	}
+
+	cfg, err := s.getEffectiveConfig(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	provider, err := s.getOrDiscoverProvider(ctx, cfg.IssuerURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tokenResp, token, err := s.refreshOauthToken(ctx, cfg, provider, refreshToken)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var idToken *oidc.IDToken
+	if tokenResp.IDToken != "" {
+		verifier := provider.Verifier(&oidc.Config{ClientID: cfg.ClientID})
+		idToken, err = verifier.Verify(oidc.ClientContext(ctx, s.httpClient), tokenResp.IDToken)
+		if err != nil {
+			slog.Error("RefreshUserInfo: ID token verification failed", "error", err)
+			return nil, nil, fmt.Errorf("failed to verify ID token: %w", err)
+		}
+	}
+
+	claims, err := s.fetchClaims(ctx, provider, token, idToken)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch user claims: %w", err)
+	}
+
+	subject := utils.GetStringClaim(claims, "sub")
+	if subject == "" {
+		return nil, nil, errors.New("missing required 'sub' claim in user info")
+	}
+
+	userInfo := userInfoFromClaims(subject, claims)
+	return &userInfo, tokenResp, nil
+}
+
+func (s *OidcService) refreshOauthToken(ctx context.Context, cfg *models.OidcConfig, provider *oidc.Provider, refreshToken string) (*dto.OidcTokenResponse, *oauth2.Token, error) {
 	scopes := strings.Fields(cfg.Scopes)
 	if len(scopes) == 0 {
 		scopes = []string{"email", "profile"}
@@ -399,12 +430,11 @@ func (s *OidcService) RefreshToken(ctx context.Context, refreshToken string) (*d
 	newToken, err := tokenSource.Token()
 	if err != nil {
 		slog.Error("RefreshToken: token refresh failed", "error", err)
-		return nil, fmt.Errorf("failed to refresh access token: %w", err)
-	}
-
-	tokenType := newToken.TokenType
-	if tokenType == "" {
-		tokenType = "Bearer"
+		var retrieveErr *oauth2.RetrieveError
+		if errors.As(err, &retrieveErr) && retrieveErr.Response != nil && retrieveErr.Response.StatusCode < http.StatusInternalServerError {
+			return nil, nil, fmt.Errorf("%w: %w", ErrOidcRefreshRejected, err)
+		}
+		return nil, nil, fmt.Errorf("failed to refresh access token: %w", err)
 	}
 
 	var rawIDToken string
@@ -414,28 +444,89 @@ func (s *OidcService) RefreshToken(ctx context.Context, refreshToken string) (*d
 		}
 	}
 
+	tokenResp := tokenResponseFromOauth(newToken, rawIDToken)
+	if tokenResp.RefreshToken == "" {
+		tokenResp.RefreshToken = refreshToken
+		slog.Debug("RefreshToken: no new refresh token issued, reusing existing")
+	}
+
+	slog.Info("RefreshToken: token refresh successful", "has_new_refresh_token", newToken.RefreshToken != "")
+	return tokenResp, newToken, nil
+}
+
+// EndSessionURL returns the provider's RP-initiated logout URL, or "" when the provider does not
+// support it. After signing out the provider sends the browser back to the application URL.
+func (s *OidcService) EndSessionURL(ctx context.Context) (string, error) {
+	cfg, err := s.getEffectiveConfig(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	endpoint := cfg.EndSessionEndpoint
+	if endpoint == "" {
+		provider, err := s.getOrDiscoverProvider(ctx, cfg.IssuerURL)
+		if err != nil {
+			return "", err
+		}
+		var metadata struct {
+			EndSessionEndpoint string `json:"end_session_endpoint"`
+		}
+		if err := provider.Claims(&metadata); err != nil {
+			return "", fmt.Errorf("failed to read provider metadata: %w", err)
+		}
+		endpoint = metadata.EndSessionEndpoint
+	}
+	if endpoint == "" {
+		return "", nil
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid end session endpoint: %w", err)
+	}
+	q := u.Query()
+	q.Set("client_id", cfg.ClientID)
+	q.Set("post_logout_redirect_uri", s.config.AppUrl)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+func userInfoFromClaims(subject string, claims map[string]any) dto.OidcUserInfo {
+	return dto.OidcUserInfo{
+		Subject:           subject,
+		Name:              utils.GetStringClaim(claims, "name"),
+		Email:             utils.GetStringClaim(claims, "email"),
+		EmailVerified:     utils.GetBoolClaim(claims, "email_verified"),
+		PreferredUsername: utils.GetStringClaim(claims, "preferred_username"),
+		GivenName:         utils.GetStringClaim(claims, "given_name"),
+		FamilyName:        utils.GetStringClaim(claims, "family_name"),
+		Admin:             utils.GetBoolClaim(claims, "admin"),
+		Roles:             utils.GetStringSliceClaim(claims, "roles"),
+		Groups:            utils.GetStringSliceClaim(claims, "groups"),
+		Extra:             claims,
+	}
+}
+
+func tokenResponseFromOauth(token *oauth2.Token, rawIDToken string) *dto.OidcTokenResponse {
+	tokenType := token.TokenType
+	if tokenType == "" {
+		tokenType = "Bearer"
+	}
+
 	tokenResp := &dto.OidcTokenResponse{
-		AccessToken:  newToken.AccessToken,
+		AccessToken:  token.AccessToken,
 		TokenType:    tokenType,
-		RefreshToken: newToken.RefreshToken,
+		RefreshToken: token.RefreshToken,
 		IDToken:      rawIDToken,
 	}
-
-	if !newToken.Expiry.IsZero() {
-		expiresIn := int(time.Until(newToken.Expiry).Seconds())
+	if !token.Expiry.IsZero() {
+		expiresIn := int(time.Until(token.Expiry).Seconds())
 		if expiresIn < 0 {
 			expiresIn = 0
 		}
 		tokenResp.ExpiresIn = expiresIn
 	}
-
-	if tokenResp.RefreshToken == "" {
-		tokenResp.RefreshToken = refreshToken
-		slog.Debug("RefreshToken: no new refresh token issued, reusing existing")
-	}
-
-	slog.Info("RefreshToken: token refresh successful", "has_new_refresh_token", newToken.RefreshToken != "")
-	return tokenResp, nil
+	return tokenResp
 }
 
 func (s *OidcService) decodeState(encodedState string) (*OidcState, error) {
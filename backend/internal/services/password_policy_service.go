@@ -0,0 +1,272 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1" //nolint:gosec // SHA-1 is the hash breached password lists are published with
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/models"
+)
+
+// PasswordPolicy is the set of rules a new password has to satisfy.
+type PasswordPolicy struct {
+	Name          string `json:"name"`
+	MinLength     int    `json:"minLength"`
+	RequireLower  bool   `json:"requireLower"`
+	RequireUpper  bool   `json:"requireUpper"`
+	RequireDigit  bool   `json:"requireDigit"`
+	RequireSymbol bool   `json:"requireSymbol"`
+	CheckBreached bool   `json:"checkBreached"`
+	// History is the number of most recent passwords, including the current one, that cannot be
+	// reused.
+	History int `json:"history"`
+}
+
+// passwordPolicies are the presets selectable through the authPasswordPolicy setting.
+var passwordPolicies = map[string]PasswordPolicy{
+	"basic": {
+		Name:      "basic",
+		MinLength: 8,
+	},
+	"standard": {
+		Name:          "standard",
+		MinLength:     10,
+		RequireLower:  true,
+		RequireUpper:  true,
+		RequireDigit:  true,
+		CheckBreached: true,
+	},
+	"strong": {
+		Name:          "strong",
+		MinLength:     12,
+		RequireLower:  true,
+		RequireUpper:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+		CheckBreached: true,
+	},
+}
+
+const defaultPasswordPolicy = "strong"
+
+type PasswordPolicyService struct {
+	db              *database.DB
+	settingsService *SettingsService
+	userService     *UserService
+	breachList      string
+}
+
+// NewPasswordPolicyService creates the policy and registers it with userService, which applies
+// it whenever a password is set.
+func NewPasswordPolicyService(db *database.DB, settingsService *SettingsService, userService *UserService, breachList string) *PasswordPolicyService {
+	s := &PasswordPolicyService{
+		db:              db,
+		settingsService: settingsService,
+		userService:     userService,
+		breachList:      breachList,
+	}
+	if userService != nil {
+		userService.passwordPolicy = s
+	}
+	return s
+}
+
+// GetPolicy returns the policy selected in settings. Unknown values fall back to the strong
+// policy rather than to no policy at all.
+func (s *PasswordPolicyService) GetPolicy(ctx context.Context) PasswordPolicy {
+	policy := passwordPolicies[defaultPasswordPolicy]
+	settings, err := s.settingsService.GetSettings(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to load password policy settings, using defaults", "error", err)
+		return policy
+	}
+	if p, ok := passwordPolicies[strings.ToLower(settings.AuthPasswordPolicy.Value)]; ok {
+		policy = p
+	}
+	policy.History = max(settings.AuthPasswordHistory.AsInt(), 0)
+	return policy
+}
+
+// Validate checks password against the current policy. user may be nil for accounts that do not
+// exist yet. Every failed rule is reported in the returned *models.ValidationError.
+func (s *PasswordPolicyService) Validate(ctx context.Context, user *models.User, password string) error {
+	policy := s.GetPolicy(ctx)
+	var details []models.ValidationDetail
+	violate := func(code, message string) {
+		details = append(details, models.ValidationDetail{Code: code, Message: message})
+	}
+
+	if len([]rune(password)) < policy.MinLength {
+		violate("min_length", fmt.Sprintf("Password must be at least %d characters long", policy.MinLength))
+	}
+
+	var hasLower, hasUpper, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+	if policy.RequireLower && !hasLower {
+		violate("lowercase", "Password must contain a lowercase letter")
+	}
+	if policy.RequireUpper && !hasUpper {
+		violate("uppercase", "Password must contain an uppercase letter")
+	}
+	if policy.RequireDigit && !hasDigit {
+		violate("digit", "Password must contain a digit")
+	}
+	if policy.RequireSymbol && !hasSymbol {
+		violate("symbol", "Password must contain a symbol")
+	}
+
+	if policy.CheckBreached && password != "" {
+		breached, err := s.isBreached(password)
+		if err != nil {
+			// A broken list must not keep everyone from changing their password.
+			slog.ErrorContext(ctx, "Failed to check breached password list", "path", s.breachList, "error", err)
+		} else if breached {
+			violate("breached", "Password appears in a list of breached passwords")
+		}
+	}
+
+	if policy.History > 0 && user != nil && user.ID != "" {
+		reused, err := s.isReused(ctx, user, password, policy.History)
+		if err != nil {
+			return err
+		}
+		if reused {
+			violate("reused", fmt.Sprintf("Password must differ from the last %d passwords", policy.History))
+		}
+	}
+
+	if len(details) > 0 {
+		return &models.ValidationError{
+			Field:   "password",
+			Message: "Password does not meet the password policy",
+			Details: details,
+		}
+	}
+	return nil
+}
+
+// isReused compares password with the user's current hash and the history kept for them.
+func (s *PasswordPolicyService) isReused(ctx context.Context, user *models.User, password string, history int) (bool, error) {
+	hashes := make([]string, 0, history)
+	if user.PasswordHash != "" {
+		hashes = append(hashes, user.PasswordHash)
+	}
+	if history > 1 {
+		var previous []string
+		if err := s.db.WithContext(ctx).Model(&models.PasswordHistory{}).
+			Where("user_id = ?", user.ID).
+			Order("created_at DESC").
+			Limit(history-1).
+			Pluck("password_hash", &previous).Error; err != nil {
+			return false, fmt.Errorf("failed to load password history: %w", err)
+		}
+		hashes = append(hashes, previous...)
+	}
+
+	for _, hash := range hashes {
+		if s.userService.ValidatePassword(hash, password) == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Remember stores a hash the user is about to replace and drops entries that fell out of the
+// history window.
+func (s *PasswordPolicyService) Remember(ctx context.Context, userID, passwordHash string) error {
+	history := s.GetPolicy(ctx).History
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if history > 1 && passwordHash != "" {
+			if err := tx.Create(&models.PasswordHistory{UserID: userID, PasswordHash: passwordHash}).Error; err != nil {
+				return fmt.Errorf("failed to record password history: %w", err)
+			}
+		}
+
+		// The current password is checked from the user row, so history-1 entries are enough.
+		var ids []string
+		if err := tx.Model(&models.PasswordHistory{}).
+			Where("user_id = ?", userID).
+			Order("created_at DESC").
+			Pluck("id", &ids).Error; err != nil {
+			return fmt.Errorf("failed to load password history: %w", err)
+		}
+		if keep := max(history-1, 0); len(ids) > keep {
+			if err := tx.Delete(&models.PasswordHistory{}, "id IN ?", ids[keep:]).Error; err != nil {
+				return fmt.Errorf("failed to trim password history: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// isBreached looks password up in the configured breach list without ever handling the clear
+// text beyond hashing it. Range files are only opened for the hash's five character prefix, the
+// same k-anonymity scheme the public Pwned Passwords API uses.
+func (s *PasswordPolicyService) isBreached(password string) (bool, error) {
+	if s.breachList == "" {
+		return false, nil
+	}
+
+	sum := sha1.Sum([]byte(password)) //nolint:gosec // see import
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	info, err := os.Stat(s.breachList)
+	if err != nil {
+		return false, err
+	}
+	if !info.IsDir() {
+		return scanBreachList(s.breachList, hash)
+	}
+
+	for _, name := range []string{prefix + ".txt", prefix} {
+		found, err := scanBreachList(filepath.Join(s.breachList, name), suffix)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		return found, err
+	}
+	return false, nil
+}
+
+// scanBreachList reports whether the file has a "HASH[:COUNT]" line for hash. Lines with a count
+// of zero are padding added by the range API and are ignored.
+func scanBreachList(path, hash string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		entry, count, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(entry, hash) {
+			return count != "0", nil
+		}
+	}
+	return false, scanner.Err()
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"crypto/sha1" //nolint:gosec // matches the breach list format
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	glsqlite "github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/ofkm/arcane-backend/internal/config"
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/models"
+)
+
+func setupPasswordPolicyTest(t *testing.T, breachList string) (*AuthService, *UserService, *SettingsService, *database.DB) {
+	t.Helper()
+	ctx := context.Background()
+	gdb, err := gorm.Open(glsqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, gdb.AutoMigrate(&models.User{}, &models.PasswordHistory{}, &models.SettingVariable{}, &models.Event{}))
+	db := &database.DB{DB: gdb}
+
+	settingsService, err := NewSettingsService(ctx, db)
+	require.NoError(t, err)
+	require.NoError(t, settingsService.EnsureDefaultSettings(ctx))
+	userService := NewUserService(db)
+	NewPasswordPolicyService(db, settingsService, userService, breachList)
+	authService := NewAuthService(userService, settingsService, NewEventService(db), nil, nil, nil, nil, nil, newTestJwtKeyService(t, db, settingsService), &config.Config{})
+	return authService, userService, settingsService, db
+}
+
+func violationCodes(t *testing.T, err error) []string {
+	t.Helper()
+	var validationErr *models.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	require.Equal(t, "password", validationErr.Field)
+	codes := make([]string, 0, len(validationErr.Details))
+	for _, d := range validationErr.Details {
+		codes = append(codes, d.Code)
+	}
+	return codes
+}
+
+func TestPasswordPolicy_EnforcesSelectedPolicy(t *testing.T) {
+	_, userService, settingsService, _ := setupPasswordPolicyTest(t, "")
+	ctx := context.Background()
+
+	_, err := userService.CreateUserWithPassword("hank", "password", "hank@example.com", models.RoleUser, "Hank")
+	require.ElementsMatch(t, []string{"min_length", "uppercase", "digit", "symbol"}, violationCodes(t, err))
+
+	_, err = userService.CreateUserWithPassword("hank", "Correct-Horse-9", "hank@example.com", models.RoleUser, "Hank")
+	require.NoError(t, err)
+
+	require.NoError(t, settingsService.SetStringSetting(ctx, "authPasswordPolicy", "basic"))
+	_, err = userService.CreateUserWithPassword("ivy", "short", "ivy@example.com", models.RoleUser, "Ivy")
+	require.Equal(t, []string{"min_length"}, violationCodes(t, err))
+	_, err = userService.CreateUserWithPassword("ivy", "lowercase only", "ivy@example.com", models.RoleUser, "Ivy")
+	require.NoError(t, err)
+}
+
+func TestPasswordPolicy_RejectsBreachedPasswords(t *testing.T) {
+	sum := sha1.Sum([]byte("Summer-2024-Password!")) //nolint:gosec // see import
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	// Range files as served by the k-anonymity API, including a zero-count padding entry.
+	dir := t.TempDir()
+	paddedSum := sha1.Sum([]byte("Padding-Only-Entry-1!")) //nolint:gosec // see import
+	padded := strings.ToUpper(hex.EncodeToString(paddedSum[:]))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, hash[:5]+".txt"), []byte("0000000000000000000000000000000000A:3\r\n"+hash[5:]+":42\r\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, padded[:5]+".txt"), []byte(padded[5:]+":0\r\n"), 0o600))
+
+	_, userService, _, _ := setupPasswordPolicyTest(t, dir)
+	_, err := userService.CreateUserWithPassword("jack", "Summer-2024-Password!", "jack@example.com", models.RoleUser, "Jack")
+	require.Equal(t, []string{"breached"}, violationCodes(t, err))
+	_, err = userService.CreateUserWithPassword("jack", "Padding-Only-Entry-1!", "jack@example.com", models.RoleUser, "Jack")
+	require.NoError(t, err)
+
+	// A single file of full hashes works too.
+	file := filepath.Join(t.TempDir(), "pwned.txt")
+	require.NoError(t, os.WriteFile(file, []byte(strings.ToLower(hash)+"\n"), 0o600))
+	_, userService, _, _ = setupPasswordPolicyTest(t, file)
+	_, err = userService.CreateUserWithPassword("kim", "Summer-2024-Password!", "kim@example.com", models.RoleUser, "Kim")
+	require.Equal(t, []string{"breached"}, violationCodes(t, err))
+}
+
+func TestPasswordPolicy_PreventsReuse(t *testing.T) {
+	authService, userService, settingsService, db := setupPasswordPolicyTest(t, "")
+	ctx := context.Background()
+	require.NoError(t, settingsService.SetIntSetting(ctx, "authPasswordHistory", 3))
+
+	user, err := userService.CreateUserWithPassword("liam", "First-Password-1", "liam@example.com", models.RoleUser, "Liam")
+	require.NoError(t, err)
+
+	err = authService.ChangePassword(ctx, user.ID, "", "First-Password-1", "First-Password-1")
+	require.Equal(t, []string{"reused"}, violationCodes(t, err))
+
+	current := "First-Password-1"
+	for _, next := range []string{"Second-Password-2", "Third-Password-3", "Fourth-Password-4"} {
+		require.NoError(t, authService.ChangePassword(ctx, user.ID, "", current, next))
+		current = next
+	}
+
+	// The last three passwords are remembered; older ones may be used again.
+	for _, reused := range []string{"Second-Password-2", "Third-Password-3"} {
+		err = authService.ChangePassword(ctx, user.ID, "", current, reused)
+		require.Equal(t, []string{"reused"}, violationCodes(t, err))
+	}
+	require.NoError(t, authService.ChangePassword(ctx, user.ID, "", current, "First-Password-1"))
+
+	var kept int64
+	require.NoError(t, db.Model(&models.PasswordHistory{}).Where("user_id = ?", user.ID).Count(&kept).Error)
+	require.EqualValues(t, 2, kept)
+}
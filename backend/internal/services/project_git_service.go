@@ -0,0 +1,445 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/dto"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/utils"
+	"github.com/ofkm/arcane-backend/internal/utils/fs"
+	"github.com/ofkm/arcane-backend/internal/utils/git"
+	"github.com/ofkm/arcane-backend/internal/utils/projects"
+)
+
+const (
+	// defaultGitSyncInterval is how often, in minutes, a Git project is polled when it has no
+	// interval of its own.
+	defaultGitSyncInterval = 5
+	// gitKnownHostsFile, in the projects directory, pins the host keys of ssh remotes.
+	gitKnownHostsFile = ".git_known_hosts"
+)
+
+var (
+	ErrInvalidGitProject = errors.New("invalid git project")
+	ErrNotGitProject     = errors.New("project is not backed by a Git repository")
+	// ErrGitRemote is returned when the repository cannot be cloned or fetched.
+	ErrGitRemote = errors.New("git repository unavailable")
+)
+
+// ProjectGitService manages projects cloned from Git repositories: it creates them, keeps
+// their clone on the configured branch and redeploys them when a new commit is checked out.
+type ProjectGitService struct {
+	db              *database.DB
+	settingsService *SettingsService
+	projectService  *ProjectService
+	eventService    *EventService
+
+	mu sync.Mutex
+	// syncing serializes the syncs of each project between the job and the API.
+	syncing map[string]*sync.Mutex
+}
+
+func NewProjectGitService(db *database.DB, settingsService *SettingsService, projectService *ProjectService, eventService *EventService) *ProjectGitService {
+	return &ProjectGitService{
+		db:              db,
+		settingsService: settingsService,
+		projectService:  projectService,
+		eventService:    eventService,
+		syncing:         map[string]*sync.Mutex{},
+	}
+}
+
+func (s *ProjectGitService) projectLock(id string) *sync.Mutex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lock, ok := s.syncing[id]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.syncing[id] = lock
+	}
+	return lock
+}
+
+// CreateProject clones the repository into a new project folder. The project is not deployed.
+func (s *ProjectGitService) CreateProject(ctx context.Context, req dto.CreateGitProjectDto, user models.User) (*models.Project, error) {
+	url := strings.TrimSpace(req.RepositoryUrl)
+	if err := git.ValidateRepository(url, req.Branch); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidGitProject, err)
+	}
+	subPath, err := cleanGitSubPath(req.SubPath)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = repositoryName(url)
+	}
+
+	projectsDirectory, err := fs.GetProjectsDirectory(ctx, s.settingsService.GetStringSetting(ctx, "projectsDirectory", "data/projects"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get projects directory: %w", err)
+	}
+	cloneDir, folderName, err := fs.CreateUniqueDir(projectsDirectory, filepath.Join(projectsDirectory, fs.SanitizeProjectName(name)), name, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create project directory: %w", err)
+	}
+	// Until the project is saved the folder is ours to clean up.
+	saved := false
+	defer func() {
+		if !saved {
+			if rerr := os.RemoveAll(cloneDir); rerr != nil {
+				slog.WarnContext(ctx, "failed to remove project folder", "path", cloneDir, "error", rerr)
+			}
+		}
+	}()
+
+	credential := utils.DerefString(req.Credential)
+	auth := gitAuth(projectsDirectory, req.Username, credential, url)
+	branch, commit, err := git.Clone(ctx, cloneDir, url, req.Branch, auth)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrGitRemote, err)
+	}
+
+	projectPath := filepath.Join(cloneDir, filepath.FromSlash(subPath))
+	if _, err := projects.DetectComposeFile(projectPath); err != nil {
+		return nil, fmt.Errorf("%w: no compose file found in %s", ErrInvalidGitProject, path.Join(repositoryName(url), subPath))
+	}
+	if req.EnvContent != nil && *req.EnvContent != "" {
+		if err := fs.WriteEnvFile(projectsDirectory, projectPath, *req.EnvContent); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	proj := &models.Project{
+		Name:             name,
+		DirName:          &folderName,
+		Path:             projectPath,
+		Status:           models.ProjectStatusStopped,
+		GitRepositoryUrl: &url,
+		GitBranch:        &branch,
+		GitAutoSync:      req.AutoSync,
+		GitAutoDeploy:    req.AutoDeploy,
+		GitSyncInterval:  req.SyncInterval,
+		GitCommit:        &commit,
+		GitSyncedAt:      &now,
+	}
+	if subPath != "" {
+		proj.GitSubPath = &subPath
+	}
+	if req.Username != "" {
+		proj.GitUsername = &req.Username
+	}
+	if credential != "" {
+		encrypted, err := utils.Encrypt(credential)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt git credential: %w", err)
+		}
+		proj.GitCredential = &encrypted
+	}
+	if err := s.db.WithContext(ctx).Create(proj).Error; err != nil {
+		return nil, fmt.Errorf("failed to create project: %w", err)
+	}
+	saved = true
+
+	metadata := models.JSON{"action": "create", "projectID": proj.ID, "projectName": name, "path": projectPath, "repository": url, "branch": branch, "commit": commit}
+	if logErr := s.eventService.LogProjectEvent(ctx, models.EventTypeProjectCreate, proj.ID, name, user.ID, user.Username, "0", metadata); logErr != nil {
+		slog.ErrorContext(ctx, "could not log project creation", "error", logErr)
+	}
+	return proj, nil
+}
+
+// UpdateProject changes the repository, branch, credential or sync policy of a Git project.
+// A new repository or branch is checked out on the next sync.
+func (s *ProjectGitService) UpdateProject(ctx context.Context, projectID string, req dto.UpdateProjectGitDto) (*models.Project, error) {
+	lock := s.projectLock(projectID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	proj, err := s.gitProject(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	url, branch := *proj.GitRepositoryUrl, utils.DerefString(proj.GitBranch)
+	if req.RepositoryUrl != nil {
+		url = strings.TrimSpace(*req.RepositoryUrl)
+	}
+	if req.Branch != nil {
+		branch = strings.TrimSpace(*req.Branch)
+	}
+	if branch == "" {
+		return nil, fmt.Errorf("%w: branch is required", ErrInvalidGitProject)
+	}
+	if err := git.ValidateRepository(url, branch); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidGitProject, err)
+	}
+
+	updates := map[string]interface{}{"git_repository_url": url, "git_branch": branch}
+	if req.Username != nil {
+		updates["git_username"] = nilIfEmpty(*req.Username)
+	}
+	if req.Credential != nil {
+		if *req.Credential == "" {
+			updates["git_credential"] = nil
+		} else {
+			encrypted, err := utils.Encrypt(*req.Credential)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encrypt git credential: %w", err)
+			}
+			updates["git_credential"] = encrypted
+		}
+	}
+	if req.AutoSync != nil {
+		updates["git_auto_sync"] = *req.AutoSync
+	}
+	if req.AutoDeploy != nil {
+		updates["git_auto_deploy"] = *req.AutoDeploy
+	}
+	if req.SyncInterval != nil {
+		updates["git_sync_interval"] = *req.SyncInterval
+	}
+	if err := s.db.WithContext(ctx).Model(proj).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to update project: %w", err)
+	}
+	return s.gitProject(ctx, projectID)
+}
+
+// SyncProject checks out the latest commit of the project's branch. With deploy the project is
+// redeployed when that commit has not been deployed yet.
+func (s *ProjectGitService) SyncProject(ctx context.Context, projectID string, deploy bool, user models.User) (*dto.ProjectGitSyncResultDto, error) {
+	lock := s.projectLock(projectID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	proj, err := s.gitProject(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	return s.sync(ctx, proj, user, func(result *dto.ProjectGitSyncResultDto) bool {
+		return deploy && (result.Updated || utils.DerefString(proj.GitDeployedCommit) != result.Commit)
+	})
+}
+
+// SyncDue syncs the projects whose sync interval has passed, redeploying those set to deploy
+// automatically when a new commit is checked out. Projects being synced already are skipped.
+func (s *ProjectGitService) SyncDue(ctx context.Context) (int, error) {
+	var due []models.Project
+	if err := s.db.WithContext(ctx).
+		Where("git_repository_url IS NOT NULL AND git_auto_sync = ?", true).
+		Find(&due).Error; err != nil {
+		return 0, fmt.Errorf("failed to list git projects: %w", err)
+	}
+
+	now := time.Now()
+	synced := 0
+	var errs []error
+	for i := range due {
+		proj := &due[i]
+		interval := time.Duration(gitSyncInterval(proj)) * time.Minute
+		if proj.GitSyncedAt != nil && now.Sub(*proj.GitSyncedAt) < interval {
+			continue
+		}
+		lock := s.projectLock(proj.ID)
+		if !lock.TryLock() {
+			continue
+		}
+		_, err := s.sync(ctx, proj, systemUser, func(result *dto.ProjectGitSyncResultDto) bool {
+			return proj.GitAutoDeploy && result.Updated
+		})
+		lock.Unlock()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("project %s: %w", proj.Name, err))
+			continue
+		}
+		synced++
+	}
+	return synced, errors.Join(errs...)
+}
+
+func (s *ProjectGitService) sync(ctx context.Context, proj *models.Project, user models.User, shouldDeploy func(*dto.ProjectGitSyncResultDto) bool) (*dto.ProjectGitSyncResultDto, error) {
+	url, branch := *proj.GitRepositoryUrl, utils.DerefString(proj.GitBranch)
+	result := &dto.ProjectGitSyncResultDto{PreviousCommit: utils.DerefString(proj.GitCommit)}
+
+	auth, err := s.auth(ctx, proj)
+	if err != nil {
+		return nil, s.recordSyncError(ctx, proj, err)
+	}
+	remote, err := git.RemoteHead(ctx, url, branch, auth)
+	if err != nil {
+		return nil, s.recordSyncError(ctx, proj, fmt.Errorf("%w: %w", ErrGitRemote, err))
+	}
+	result.Commit = remote
+	if remote != result.PreviousCommit {
+		commit, err := git.Checkout(ctx, gitCloneRoot(proj), url, branch, auth)
+		if err != nil {
+			return nil, s.recordSyncError(ctx, proj, fmt.Errorf("%w: %w", ErrGitRemote, err))
+		}
+		result.Commit, result.Updated = commit, true
+	}
+	if _, err := projects.DetectComposeFile(proj.Path); err != nil {
+		return nil, s.recordSyncError(ctx, proj, fmt.Errorf("no compose file found in %s at %s", path.Join(repositoryName(url), utils.DerefString(proj.GitSubPath)), shortCommit(result.Commit)))
+	}
+
+	if err := s.db.WithContext(ctx).Model(proj).Updates(map[string]interface{}{
+		"git_commit":     result.Commit,
+		"git_synced_at":  time.Now(),
+		"git_sync_error": nil,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to record git sync: %w", err)
+	}
+	proj.GitCommit = &result.Commit
+
+	if result.Updated {
+		slog.InfoContext(ctx, "Checked out new commit for git project", "projectID", proj.ID, "branch", branch, "commit", result.Commit)
+		metadata := models.JSON{"action": "git-sync", "projectID": proj.ID, "projectName": proj.Name, "repository": url, "branch": branch, "previousCommit": result.PreviousCommit, "commit": result.Commit}
+		if logErr := s.eventService.LogProjectEvent(ctx, models.EventTypeProjectUpdate, proj.ID, proj.Name, user.ID, user.Username, "0", metadata); logErr != nil {
+			slog.ErrorContext(ctx, "could not log project git sync", "error", logErr)
+		}
+	}
+
+	if shouldDeploy(result) {
+		if err := s.projectService.DeployProject(ctx, proj.ID, user); err != nil {
+			return result, s.recordSyncError(ctx, proj, err)
+		}
+		result.Deployed = true
+	}
+	return result, nil
+}
+
+// recordSyncError keeps err on the project, so failed syncs show up and are not retried before
+// the next interval, and returns it.
+func (s *ProjectGitService) recordSyncError(ctx context.Context, proj *models.Project, err error) error {
+	msg := err.Error()
+	if uerr := s.db.WithContext(ctx).Model(proj).Updates(map[string]interface{}{
+		"git_synced_at":  time.Now(),
+		"git_sync_error": msg,
+	}).Error; uerr != nil {
+		slog.WarnContext(ctx, "Failed to record git sync error", "projectID", proj.ID, "error", uerr)
+	}
+	proj.GitSyncError = &msg
+	return err
+}
+
+func (s *ProjectGitService) gitProject(ctx context.Context, projectID string) (*models.Project, error) {
+	proj, err := s.projectService.GetProjectFromDatabaseByID(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	if proj.GitRepositoryUrl == nil {
+		return nil, ErrNotGitProject
+	}
+	return proj, nil
+}
+
+func (s *ProjectGitService) auth(ctx context.Context, proj *models.Project) (git.Auth, error) {
+	credential := ""
+	if proj.GitCredential != nil {
+		plain, err := utils.Decrypt(*proj.GitCredential)
+		if err != nil {
+			return git.Auth{}, fmt.Errorf("failed to decrypt git credential: %w", err)
+		}
+		credential = plain
+	}
+	projectsDirectory, err := fs.GetProjectsDirectory(ctx, s.settingsService.GetStringSetting(ctx, "projectsDirectory", "data/projects"))
+	if err != nil {
+		return git.Auth{}, fmt.Errorf("failed to get projects directory: %w", err)
+	}
+	return gitAuth(projectsDirectory, utils.DerefString(proj.GitUsername), credential, *proj.GitRepositoryUrl), nil
+}
+
+func gitAuth(projectsDirectory, username, credential, url string) git.Auth {
+	if credential == "" {
+		return git.Auth{}
+	}
+	if git.IsSSH(url) {
+		return git.Auth{SSHKey: credential, KnownHostsFile: filepath.Join(projectsDirectory, gitKnownHostsFile)}
+	}
+	return git.Auth{Username: username, Token: credential}
+}
+
+// gitCloneRoot returns the folder a Git project is cloned into, which holds its compose file
+// unless it has a sub path.
+func gitCloneRoot(proj *models.Project) string {
+	root := filepath.Clean(proj.Path)
+	if proj.GitSubPath != nil && *proj.GitSubPath != "" {
+		root = strings.TrimSuffix(root, string(filepath.Separator)+filepath.FromSlash(*proj.GitSubPath))
+	}
+	return root
+}
+
+func gitSyncInterval(proj *models.Project) int {
+	if proj.GitSyncInterval != nil && *proj.GitSyncInterval > 0 {
+		return *proj.GitSyncInterval
+	}
+	return defaultGitSyncInterval
+}
+
+// cleanGitSubPath normalizes a folder within a repository to a relative, slash-separated path,
+// empty for the repository root.
+func cleanGitSubPath(subPath string) (string, error) {
+	slashed := strings.ReplaceAll(strings.TrimSpace(subPath), `\`, "/")
+	if slices.Contains(strings.Split(slashed, "/"), "..") {
+		return "", fmt.Errorf("%w: sub path %q leaves the repository", ErrInvalidGitProject, subPath)
+	}
+	return strings.TrimPrefix(path.Clean("/"+slashed), "/"), nil
+}
+
+// repositoryName returns the last element of a repository URL without its .git suffix.
+func repositoryName(url string) string {
+	name := strings.TrimSuffix(strings.TrimRight(url, "/"), ".git")
+	if i := strings.LastIndexAny(name, "/:"); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+func shortCommit(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
+
+func nilIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// projectGitDto describes the Git source of proj, or returns nil for other projects.
+func projectGitDto(proj *models.Project) *dto.ProjectGitDto {
+	if proj.GitRepositoryUrl == nil {
+		return nil
+	}
+	out := &dto.ProjectGitDto{
+		RepositoryUrl:  *proj.GitRepositoryUrl,
+		Branch:         utils.DerefString(proj.GitBranch),
+		SubPath:        utils.DerefString(proj.GitSubPath),
+		Username:       utils.DerefString(proj.GitUsername),
+		HasCredential:  proj.GitCredential != nil,
+		AutoSync:       proj.GitAutoSync,
+		AutoDeploy:     proj.GitAutoDeploy,
+		SyncInterval:   gitSyncInterval(proj),
+		Commit:         utils.DerefString(proj.GitCommit),
+		DeployedCommit: utils.DerefString(proj.GitDeployedCommit),
+		SyncError:      utils.DerefString(proj.GitSyncError),
+	}
+	if proj.GitSyncedAt != nil {
+		syncedAt := proj.GitSyncedAt.Format(time.RFC3339)
+		out.SyncedAt = &syncedAt
+	}
+	return out
+}
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ofkm/arcane-backend/internal/config"
+	"github.com/ofkm/arcane-backend/internal/dto"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/utils"
+	"github.com/ofkm/arcane-backend/internal/utils/git"
+)
+
+// testGitRemote is a bare repository pushed to from a working clone.
+type testGitRemote struct {
+	url  string
+	work string
+}
+
+func newTestGitRemote(t *testing.T) *testGitRemote {
+	t.Helper()
+	dir := t.TempDir()
+	bare := filepath.Join(dir, "stacks.git")
+	r := &testGitRemote{url: "file://" + bare, work: filepath.Join(dir, "work")}
+	r.git(t, dir, "init", "--quiet", "--bare", "--initial-branch=main", bare)
+	r.git(t, dir, "init", "--quiet", "--initial-branch=main", r.work)
+	return r
+}
+
+func (r *testGitRemote) git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+	return strings.TrimSpace(string(out))
+}
+
+// commit writes files into the working clone, pushes them and returns the new commit.
+func (r *testGitRemote) commit(t *testing.T, files map[string]string) string {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(r.work, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	r.git(t, r.work, "add", "--all")
+	r.git(t, r.work, "commit", "--quiet", "-m", "update")
+	r.git(t, r.work, "push", "--quiet", r.url, "main")
+	return r.git(t, r.work, "rev-parse", "HEAD")
+}
+
+func newProjectGitTestService(t *testing.T) (*ProjectGitService, *ProjectService, string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	utils.InitEncryption(&config.Config{})
+	// The test remotes are bare repositories on disk.
+	git.AllowLocalRepositories(true)
+	t.Cleanup(func() { git.AllowLocalRepositories(false) })
+	db, settingsService := newAgentTLSTestDB(t, &models.Project{}, &models.Event{})
+	projectsDir := t.TempDir()
+	require.NoError(t, settingsService.SetStringSetting(context.Background(), "projectsDirectory", projectsDir))
+	eventService := NewEventService(db)
+	projectService := NewProjectService(db, settingsService, eventService, nil)
+	return NewProjectGitService(db, settingsService, projectService, eventService), projectService, projectsDir
+}
+
+func TestProjectGitService_CreateAndSync(t *testing.T) {
+	ctx := context.Background()
+	gitService, projectService, projectsDir := newProjectGitTestService(t)
+	remote := newTestGitRemote(t)
+	first := remote.commit(t, map[string]string{"README.md": "stacks", "web/compose.yaml": "services:\n  web:\n    image: nginx:1.27\n"})
+
+	env := "TOKEN=secret\n"
+	token := "ghp_example"
+	proj, err := gitService.CreateProject(ctx, dto.CreateGitProjectDto{
+		RepositoryUrl: remote.url, SubPath: "/web/", Credential: &token, EnvContent: &env,
+	}, systemUser)
+	require.NoError(t, err)
+	require.Equal(t, "stacks", proj.Name)
+	require.Equal(t, filepath.Join(projectsDir, "stacks", "web"), proj.Path)
+	require.Equal(t, "main", *proj.GitBranch)
+	require.Equal(t, first, *proj.GitCommit)
+	require.NotContains(t, *proj.GitCredential, token, "the credential is stored encrypted")
+	plain, err := utils.Decrypt(*proj.GitCredential)
+	require.NoError(t, err)
+	require.Equal(t, token, plain)
+
+	compose, envContent, err := projectService.GetProjectContent(ctx, proj.ID)
+	require.NoError(t, err)
+	require.Contains(t, compose, "nginx:1.27")
+	require.Equal(t, env, envContent)
+
+	// Nothing new on the branch.
+	result, err := gitService.SyncProject(ctx, proj.ID, false, systemUser)
+	require.NoError(t, err)
+	require.False(t, result.Updated)
+	require.Equal(t, first, result.Commit)
+
+	second := remote.commit(t, map[string]string{"web/compose.yaml": "services:\n  web:\n    image: nginx:1.28\n"})
+	result, err = gitService.SyncProject(ctx, proj.ID, false, systemUser)
+	require.NoError(t, err)
+	require.Equal(t, dto.ProjectGitSyncResultDto{PreviousCommit: first, Commit: second, Updated: true}, *result)
+
+	compose, envContent, err = projectService.GetProjectContent(ctx, proj.ID)
+	require.NoError(t, err)
+	require.Contains(t, compose, "nginx:1.28")
+	require.Equal(t, env, envContent, "the .env next to the compose file survives a sync")
+
+	details, err := projectService.GetProjectDetails(ctx, proj.ID)
+	require.NoError(t, err)
+	require.NotNil(t, details.Git)
+	require.Equal(t, second, details.Git.Commit)
+	require.True(t, details.Git.HasCredential)
+	require.Empty(t, details.Git.DeployedCommit)
+
+	_, err = projectService.UpdateProject(ctx, proj.ID, nil, &compose, nil)
+	require.Error(t, err, "the repository owns the compose file")
+
+	// A filesystem sync leaves the project pointing into its clone's sub path.
+	require.NoError(t, projectService.SyncProjectsFromFileSystem(ctx))
+	synced, err := projectService.GetProjectFromDatabaseByID(ctx, proj.ID)
+	require.NoError(t, err)
+	require.Equal(t, proj.Path, synced.Path)
+}
+
+func TestProjectGitService_SyncDue(t *testing.T) {
+	ctx := context.Background()
+	gitService, projectService, _ := newProjectGitTestService(t)
+	remote := newTestGitRemote(t)
+	remote.commit(t, map[string]string{"compose.yaml": "services:\n  app:\n    image: redis:7\n"})
+
+	interval := 10
+	proj, err := gitService.CreateProject(ctx, dto.CreateGitProjectDto{Name: "cache", RepositoryUrl: remote.url, Branch: "main", AutoSync: true, SyncInterval: &interval}, systemUser)
+	require.NoError(t, err)
+	require.Equal(t, proj.Path, gitCloneRoot(proj))
+
+	next := remote.commit(t, map[string]string{"compose.yaml": "services:\n  app:\n    image: redis:8\n"})
+	synced, err := gitService.SyncDue(ctx)
+	require.NoError(t, err)
+	require.Zero(t, synced, "the project was synced when it was cloned")
+
+	require.NoError(t, gitService.db.Model(proj).Update("git_synced_at", time.Now().Add(-11*time.Minute)).Error)
+	synced, err = gitService.SyncDue(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, synced)
+	reloaded, err := projectService.GetProjectFromDatabaseByID(ctx, proj.ID)
+	require.NoError(t, err)
+	require.Equal(t, next, *reloaded.GitCommit)
+
+	// A branch that disappears is recorded on the project.
+	branch := "gone"
+	_, err = gitService.UpdateProject(ctx, proj.ID, dto.UpdateProjectGitDto{Branch: &branch})
+	require.NoError(t, err)
+	require.NoError(t, gitService.db.Model(proj).Update("git_synced_at", time.Now().Add(-11*time.Minute)).Error)
+	_, err = gitService.SyncDue(ctx)
+	require.ErrorIs(t, err, ErrGitRemote)
+	reloaded, err = projectService.GetProjectFromDatabaseByID(ctx, proj.ID)
+	require.NoError(t, err)
+	require.Contains(t, *reloaded.GitSyncError, `branch "gone" not found`)
+}
+
+func TestProjectGitService_CreateRejectsInvalidSources(t *testing.T) {
+	ctx := context.Background()
+	gitService, _, projectsDir := newProjectGitTestService(t)
+	remote := newTestGitRemote(t)
+	remote.commit(t, map[string]string{"compose.yaml": "services: {}\n"})
+
+	for name, req := range map[string]dto.CreateGitProjectDto{
+		"ext transport":   {RepositoryUrl: "ext::sh -c touch% /tmp/pwned"},
+		"option as url":   {RepositoryUrl: "--upload-pack=touch /tmp/pwned"},
+		"sub path escape": {RepositoryUrl: remote.url, SubPath: "../outside"},
+		"bad branch":      {RepositoryUrl: remote.url, Branch: "--orphan"},
+		"no compose file": {RepositoryUrl: remote.url, SubPath: "missing"},
+	} {
+		_, err := gitService.CreateProject(ctx, req, systemUser)
+		require.ErrorIs(t, err, ErrInvalidGitProject, name)
+	}
+
+	_, err := gitService.CreateProject(ctx, dto.CreateGitProjectDto{RepositoryUrl: remote.url, Branch: "develop"}, systemUser)
+	require.ErrorIs(t, err, ErrGitRemote)
+
+	git.AllowLocalRepositories(false)
+	_, err = gitService.CreateProject(ctx, dto.CreateGitProjectDto{RepositoryUrl: remote.url}, systemUser)
+	require.ErrorIs(t, err, ErrInvalidGitProject, "file:// repositories are refused unless allowed")
+
+	entries, err := os.ReadDir(projectsDir)
+	require.NoError(t, err)
+	require.Empty(t, entries, "failed clones leave no folders behind")
+}
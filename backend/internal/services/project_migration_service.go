@@ -0,0 +1,499 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ofkm/arcane-backend/internal/dto"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/utils/projects"
+)
+
+const (
+	defaultMigrationHealthTimeout = 2 * time.Minute
+	migrationHealthPollInterval   = 2 * time.Second
+)
+
+var (
+	ErrInvalidProjectMigration = errors.New("invalid project migration")
+	ErrMigrationEnvironment    = errors.New("environment not found or not permitted")
+)
+
+// ProjectMigrationService moves a project between environments: it recreates the project from
+// its compose and .env files on the target, optionally copies its volumes, pulls and deploys it
+// there, and stops the source once the target is healthy. A target project left behind by a
+// failed migration is kept for inspection.
+type ProjectMigrationService struct {
+	environmentService *EnvironmentService
+	aggregateService   *AggregateService
+	projectService     *ProjectService
+	volumeService      *VolumeService
+	pollInterval       time.Duration
+}
+
+func NewProjectMigrationService(environmentService *EnvironmentService, aggregateService *AggregateService, projectService *ProjectService, volumeService *VolumeService) *ProjectMigrationService {
+	return &ProjectMigrationService{
+		environmentService: environmentService,
+		aggregateService:   aggregateService,
+		projectService:     projectService,
+		volumeService:      volumeService,
+		pollInterval:       migrationHealthPollInterval,
+	}
+}
+
+// Migrate runs the migration as caller, who needs the matching permissions on both environments.
+// The result lists every step taken; a failed step ends the migration.
+func (s *ProjectMigrationService) Migrate(ctx context.Context, caller AggregateCaller, req dto.MigrateProjectDto) (*dto.ProjectMigrationResultDto, error) {
+	if req.SourceEnvironmentID == req.TargetEnvironmentID {
+		return nil, fmt.Errorf("%w: source and target are the same environment", ErrInvalidProjectMigration)
+	}
+	if req.StopSource && !req.Deploy {
+		return nil, fmt.Errorf("%w: stopping the source requires deploying the target", ErrInvalidProjectMigration)
+	}
+
+	sourcePerms := []models.Permission{models.PermissionProjectsRead}
+	if req.StopSource || req.CopyVolumes {
+		sourcePerms = append(sourcePerms, models.PermissionProjectsDeploy)
+	}
+	targetPerms := []models.Permission{models.PermissionProjectsCreate}
+	if req.PullImages || req.Deploy {
+		targetPerms = append(targetPerms, models.PermissionProjectsDeploy)
+	}
+	if req.CopyVolumes {
+		sourcePerms = append(sourcePerms, models.PermissionVolumesArchive)
+		targetPerms = append(targetPerms, models.PermissionVolumesArchive)
+	}
+	source, err := s.side(ctx, caller, req.SourceEnvironmentID, sourcePerms)
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.side(ctx, caller, req.TargetEnvironmentID, targetPerms)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &projectMigration{req: req, source: source, target: target, result: &dto.ProjectMigrationResultDto{Steps: []dto.ProjectMigrationStepDto{}}, pollInterval: s.pollInterval}
+	m.run(ctx)
+	return m.result, nil
+}
+
+// side resolves an environment the caller holds every one of perms on.
+func (s *ProjectMigrationService) side(ctx context.Context, caller AggregateCaller, id string, perms []models.Permission) (migrationSide, error) {
+	targets, err := s.aggregateService.targets(ctx, caller, perms[0], environmentSelector{ids: []string{id}})
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) != 1 {
+		return nil, fmt.Errorf("%w: %s", ErrMigrationEnvironment, id)
+	}
+	target := targets[0]
+	for _, perm := range perms[1:] {
+		if !models.HasPermission(target.permissions, perm) {
+			return nil, fmt.Errorf("%w: %s", ErrMigrationEnvironment, id)
+		}
+	}
+
+	switch {
+	case target.id == localEnvironmentID:
+		user := systemUser
+		if caller.User != nil {
+			user = *caller.User
+		}
+		return &localMigrationSide{projectService: s.projectService, volumeService: s.volumeService, user: user}, nil
+	case target.direct:
+		return nil, fmt.Errorf("%w: projects are %w", ErrInvalidProjectMigration, ErrDirectDockerUnsupported)
+	default:
+		client, baseURL, err := s.environmentService.AgentHTTPClient(ctx, target.id, target.apiURL, 0)
+		if err != nil {
+			return nil, err
+		}
+		return &agentMigrationSide{environmentService: s.environmentService, client: client, baseURL: baseURL, header: target.header(caller)}, nil
+	}
+}
+
+type projectMigration struct {
+	req          dto.MigrateProjectDto
+	source       migrationSide
+	target       migrationSide
+	result       *dto.ProjectMigrationResultDto
+	pollInterval time.Duration
+}
+
+func (m *projectMigration) step(name string, fn func() (string, error)) bool {
+	detail, err := fn()
+	entry := dto.ProjectMigrationStepDto{Step: name, Success: err == nil, Detail: detail}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	m.result.Steps = append(m.result.Steps, entry)
+	return err == nil
+}
+
+func (m *projectMigration) run(ctx context.Context) {
+	var content migrationProject
+	if !m.step("read", func() (string, error) {
+		var err error
+		content, err = m.source.project(ctx, m.req.ProjectID)
+		return content.name, err
+	}) {
+		return
+	}
+	name := m.req.Name
+	if name == "" {
+		name = content.name
+	}
+
+	if !m.step("create", func() (string, error) {
+		id, err := m.target.createProject(ctx, name, content.compose, content.env)
+		m.result.TargetProjectID = id
+		return id, err
+	}) {
+		return
+	}
+	targetID := m.result.TargetProjectID
+
+	// Volumes are copied with the source down so that what arrives is consistent; the source comes
+	// back up unless the migration completes and was asked to stop it.
+	sourceStopped := false
+	restartSource := func() {
+		if sourceStopped && content.running {
+			m.step("restart-source", func() (string, error) { return "", m.source.deployProject(ctx, m.req.ProjectID) })
+		}
+	}
+	if m.req.CopyVolumes {
+		sourceVolumes, err := projects.ComposeVolumes(normalizeComposeProjectName(content.name), content.compose)
+		if err != nil {
+			m.step("copy-volumes", func() (string, error) { return "", err })
+			return
+		}
+		targetVolumes, _ := projects.ComposeVolumes(normalizeComposeProjectName(name), content.compose)
+		if len(sourceVolumes) > 0 {
+			if !m.step("stop-source", func() (string, error) { return "", m.source.downProject(ctx, m.req.ProjectID) }) {
+				return
+			}
+			sourceStopped = true
+		}
+		for i, from := range sourceVolumes {
+			to := targetVolumes[i]
+			labels := map[string]string{}
+			if !to.External {
+				labels["com.docker.compose.project"] = normalizeComposeProjectName(name)
+				labels["com.docker.compose.volume"] = to.Key
+			}
+			if !m.step("copy-volume:"+from.Key, func() (string, error) {
+				return copyMigrationVolume(ctx, m.source, m.target, from.Name, to.Name, labels)
+			}) {
+				restartSource()
+				return
+			}
+		}
+	}
+
+	if m.req.PullImages && !m.step("pull", func() (string, error) { return "", m.target.pullImages(ctx, targetID) }) {
+		restartSource()
+		return
+	}
+	if m.req.Deploy {
+		if !m.step("deploy", func() (string, error) { return "", m.target.deployProject(ctx, targetID) }) {
+			restartSource()
+			return
+		}
+		if !m.step("health", func() (string, error) { return m.waitHealthy(ctx, targetID) }) {
+			restartSource()
+			return
+		}
+	}
+
+	if m.req.StopSource {
+		if !sourceStopped && !m.step("stop-source", func() (string, error) { return "", m.source.downProject(ctx, m.req.ProjectID) }) {
+			return
+		}
+	} else {
+		restartSource()
+	}
+	m.result.Success = true
+}
+
+// waitHealthy waits for every service of the target project to run and pass its health check.
+func (m *projectMigration) waitHealthy(ctx context.Context, projectID string) (string, error) {
+	timeout := defaultMigrationHealthTimeout
+	if m.req.HealthTimeoutSeconds > 0 {
+		timeout = time.Duration(m.req.HealthTimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var waiting string
+	for {
+		services, err := m.target.projectServices(ctx, projectID)
+		if err == nil {
+			waiting = unhealthyServices(services)
+			if waiting == "" {
+				return fmt.Sprintf("%d services healthy", len(services)), nil
+			}
+		} else if ctx.Err() == nil {
+			waiting = err.Error()
+		}
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("target not healthy after %s: %s", timeout, waiting)
+		case <-time.After(m.pollInterval):
+		}
+	}
+}
+
+// unhealthyServices describes the services not yet running healthily; empty once all are.
+func unhealthyServices(services []ProjectServiceInfo) string {
+	if len(services) == 0 {
+		return "no services running"
+	}
+	var waiting []string
+	for _, svc := range services {
+		switch {
+		case svc.Status != "running":
+			waiting = append(waiting, svc.Name+" is "+svc.Status)
+		case svc.Health != nil && *svc.Health != "healthy":
+			waiting = append(waiting, svc.Name+" is "+*svc.Health)
+		}
+	}
+	return strings.Join(waiting, ", ")
+}
+
+func copyMigrationVolume(ctx context.Context, source, target migrationSide, from, to string, labels map[string]string) (string, error) {
+	archive, err := source.exportVolume(ctx, from)
+	if errors.Is(err, ErrVolumeNotFound) {
+		return "volume " + from + " does not exist on the source, skipped", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer archive.Close()
+	if err := target.importVolume(ctx, to, labels, archive); err != nil {
+		return "", err
+	}
+	return from + " -> " + to, nil
+}
+
+type migrationProject struct {
+	name, compose string
+	env           *string
+	running       bool
+}
+
+// migrationSide runs the project and volume operations a migration needs on one environment.
+type migrationSide interface {
+	project(ctx context.Context, projectID string) (migrationProject, error)
+	createProject(ctx context.Context, name, compose string, env *string) (string, error)
+	pullImages(ctx context.Context, projectID string) error
+	deployProject(ctx context.Context, projectID string) error
+	downProject(ctx context.Context, projectID string) error
+	projectServices(ctx context.Context, projectID string) ([]ProjectServiceInfo, error)
+	exportVolume(ctx context.Context, name string) (io.ReadCloser, error)
+	importVolume(ctx context.Context, name string, labels map[string]string, archive io.Reader) error
+}
+
+type localMigrationSide struct {
+	projectService *ProjectService
+	volumeService  *VolumeService
+	user           models.User
+}
+
+func (l *localMigrationSide) project(ctx context.Context, projectID string) (migrationProject, error) {
+	proj, err := l.projectService.GetProjectFromDatabaseByID(ctx, projectID)
+	if err != nil {
+		return migrationProject{}, err
+	}
+	compose, env, err := l.projectService.GetProjectContent(ctx, projectID)
+	if err != nil {
+		return migrationProject{}, err
+	}
+	out := migrationProject{name: proj.Name, compose: compose}
+	if env != "" {
+		out.env = &env
+	}
+	services, _ := l.projectService.GetProjectServices(ctx, projectID)
+	out.running = anyServiceRunning(services)
+	return out, nil
+}
+
+func (l *localMigrationSide) createProject(ctx context.Context, name, compose string, env *string) (string, error) {
+	proj, err := l.projectService.CreateProject(ctx, name, compose, env, l.user)
+	if err != nil {
+		return "", err
+	}
+	return proj.ID, nil
+}
+
+func (l *localMigrationSide) pullImages(ctx context.Context, projectID string) error {
+	return l.projectService.PullProjectImages(ctx, projectID, io.Discard)
+}
+
+func (l *localMigrationSide) deployProject(ctx context.Context, projectID string) error {
+	return l.projectService.DeployProject(ctx, projectID, l.user)
+}
+
+func (l *localMigrationSide) downProject(ctx context.Context, projectID string) error {
+	return l.projectService.DownProject(ctx, projectID, l.user)
+}
+
+func (l *localMigrationSide) projectServices(ctx context.Context, projectID string) ([]ProjectServiceInfo, error) {
+	return l.projectService.GetProjectServices(ctx, projectID)
+}
+
+func (l *localMigrationSide) exportVolume(ctx context.Context, name string) (io.ReadCloser, error) {
+	return l.volumeService.ExportVolume(ctx, name)
+}
+
+func (l *localMigrationSide) importVolume(ctx context.Context, name string, labels map[string]string, archive io.Reader) error {
+	return l.volumeService.ImportVolume(ctx, name, labels, archive, l.user)
+}
+
+// agentMigrationSide works through an agent's project and volume routes as the caller.
+type agentMigrationSide struct {
+	environmentService *EnvironmentService
+	client             *http.Client
+	baseURL            string
+	header             http.Header
+}
+
+type agentProjectDetails struct {
+	Name           string               `json:"name"`
+	ComposeContent string               `json:"composeContent"`
+	EnvContent     string               `json:"envContent"`
+	Services       []ProjectServiceInfo `json:"services"`
+}
+
+func (a *agentMigrationSide) details(ctx context.Context, projectID string) (agentProjectDetails, error) {
+	var details agentProjectDetails
+	err := a.environmentService.callAgentMethod(ctx, a.client, http.MethodGet, a.baseURL, "/projects/"+url.PathEscape(projectID), a.header, nil, &details)
+	return details, err
+}
+
+func (a *agentMigrationSide) project(ctx context.Context, projectID string) (migrationProject, error) {
+	details, err := a.details(ctx, projectID)
+	if err != nil {
+		return migrationProject{}, err
+	}
+	out := migrationProject{name: details.Name, compose: details.ComposeContent, running: anyServiceRunning(details.Services)}
+	if details.EnvContent != "" {
+		out.env = &details.EnvContent
+	}
+	return out, nil
+}
+
+func (a *agentMigrationSide) createProject(ctx context.Context, name, compose string, env *string) (string, error) {
+	var created dto.CreateProjectReponseDto
+	body := dto.CreateProjectDto{Name: name, ComposeContent: compose, EnvContent: env}
+	if err := a.environmentService.callAgent(ctx, a.client, a.baseURL, "/projects", a.header, body, &created); err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
+// pullImages reads the pull's progress stream to its end, failing on the first error it reports.
+func (a *agentMigrationSide) pullImages(ctx context.Context, projectID string) error {
+	resp, err := a.do(ctx, http.MethodPost, "/projects/"+url.PathEscape(projectID)+"/pull", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		var line struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &line) == nil && line.Error != "" {
+			return errors.New(line.Error)
+		}
+	}
+	return scanner.Err()
+}
+
+func (a *agentMigrationSide) deployProject(ctx context.Context, projectID string) error {
+	return a.environmentService.callAgent(ctx, a.client, a.baseURL, "/projects/"+url.PathEscape(projectID)+"/up", a.header, nil, nil)
+}
+
+func (a *agentMigrationSide) downProject(ctx context.Context, projectID string) error {
+	return a.environmentService.callAgent(ctx, a.client, a.baseURL, "/projects/"+url.PathEscape(projectID)+"/down", a.header, nil, nil)
+}
+
+func (a *agentMigrationSide) projectServices(ctx context.Context, projectID string) ([]ProjectServiceInfo, error) {
+	details, err := a.details(ctx, projectID)
+	return details.Services, err
+}
+
+func (a *agentMigrationSide) exportVolume(ctx context.Context, name string) (io.ReadCloser, error) {
+	resp, err := a.do(ctx, http.MethodGet, "/volumes/"+url.PathEscape(name)+"/archive", nil)
+	if err != nil {
+		if errors.Is(err, errAgentNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrVolumeNotFound, name)
+		}
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (a *agentMigrationSide) importVolume(ctx context.Context, name string, labels map[string]string, archive io.Reader) error {
+	query := url.Values{}
+	for key, value := range labels {
+		query.Add("label", key+"="+value)
+	}
+	endpoint := "/volumes/" + url.PathEscape(name) + "/archive"
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	resp, err := a.do(ctx, http.MethodPut, endpoint, archive)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+var errAgentNotFound = errors.New("not found")
+
+// do sends a request whose response is not a JSON envelope, returning the response on success.
+func (a *agentMigrationSide) do(ctx context.Context, method, endpoint string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, a.baseURL+"/api/environments/"+localEnvironmentID+endpoint, body)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	for k, v := range a.header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-tar")
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		err := fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+		if resp.StatusCode == http.StatusNotFound {
+			err = fmt.Errorf("%w: %w", errAgentNotFound, err)
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+func anyServiceRunning(services []ProjectServiceInfo) bool {
+	for _, svc := range services {
+		if svc.Status == "running" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ofkm/arcane-backend/internal/config"
+	"github.com/ofkm/arcane-backend/internal/dto"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/utils"
+)
+
+const migrationTestCompose = `services:
+  db:
+    image: postgres:17
+    volumes:
+      - data:/var/lib/postgresql/data
+      - shared:/shared
+volumes:
+  data: {}
+  shared:
+    external: true
+`
+
+// migrationTestAgent is an agent holding projects and volumes in memory.
+type migrationTestAgent struct {
+	mu       sync.Mutex
+	calls    []string
+	projects map[string]dto.ProjectDetailsDto
+	running  map[string]bool
+	volumes  map[string]string
+	labels   map[string][]string
+	// unhealthy keeps deployed services starting forever.
+	unhealthy bool
+}
+
+func (a *migrationTestAgent) start(t *testing.T) *httptest.Server {
+	t.Helper()
+	ok := func(w http.ResponseWriter, status int, data any) {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string]any{"success": true, "data": data})
+	}
+	record := func(r *http.Request) {
+		a.mu.Lock()
+		a.calls = append(a.calls, r.Method+" "+r.URL.Path)
+		a.mu.Unlock()
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/environments/0/projects/{projectId}", func(w http.ResponseWriter, r *http.Request) {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		project, found := a.projects[r.PathValue("projectId")]
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		status := "stopped"
+		health := "healthy"
+		if a.running[project.ID] {
+			status = "running"
+			if a.unhealthy {
+				health = "starting"
+			}
+		}
+		project.Services = []any{ProjectServiceInfo{Name: "db", Status: status, Health: &health}}
+		ok(w, http.StatusOK, project)
+	})
+	mux.HandleFunc("POST /api/environments/0/projects", func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		var req dto.CreateProjectDto
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		a.mu.Lock()
+		project := dto.ProjectDetailsDto{ID: "new-" + req.Name, Name: req.Name, ComposeContent: req.ComposeContent}
+		if req.EnvContent != nil {
+			project.EnvContent = *req.EnvContent
+		}
+		a.projects[project.ID] = project
+		a.mu.Unlock()
+		ok(w, http.StatusCreated, dto.CreateProjectReponseDto{ID: project.ID, Name: project.Name})
+	})
+	mux.HandleFunc("POST /api/environments/0/projects/{projectId}/pull", func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		_, _ = io.WriteString(w, `{"status":"starting project image pull"}`+"\n"+`{"status":"done"}`+"\n")
+	})
+	for action, running := range map[string]bool{"up": true, "down": false} {
+		mux.HandleFunc("POST /api/environments/0/projects/{projectId}/"+action, func(w http.ResponseWriter, r *http.Request) {
+			record(r)
+			a.mu.Lock()
+			a.running[r.PathValue("projectId")] = running
+			a.mu.Unlock()
+			ok(w, http.StatusOK, map[string]string{"message": "ok"})
+		})
+	}
+	mux.HandleFunc("GET /api/environments/0/volumes/{volumeName}/archive", func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		a.mu.Lock()
+		content, found := a.volumes[r.PathValue("volumeName")]
+		a.mu.Unlock()
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = io.WriteString(w, content)
+	})
+	mux.HandleFunc("PUT /api/environments/0/volumes/{volumeName}/archive", func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		body, _ := io.ReadAll(r.Body)
+		a.mu.Lock()
+		a.volumes[r.PathValue("volumeName")] = string(body)
+		a.labels[r.PathValue("volumeName")] = r.URL.Query()["label"]
+		a.mu.Unlock()
+		ok(w, http.StatusOK, map[string]string{"message": "ok"})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newMigrationTestAgent() *migrationTestAgent {
+	return &migrationTestAgent{projects: map[string]dto.ProjectDetailsDto{}, running: map[string]bool{}, volumes: map[string]string{}, labels: map[string][]string{}}
+}
+
+func stepNames(result *dto.ProjectMigrationResultDto) []string {
+	names := make([]string, 0, len(result.Steps))
+	for _, step := range result.Steps {
+		names = append(names, step.Step)
+	}
+	return names
+}
+
+func TestProjectMigration_BetweenAgents(t *testing.T) {
+	ctx := context.Background()
+	utils.InitEncryption(&config.Config{})
+	db, _ := newAgentTLSTestDB(t, &models.Environment{}, &models.EnvironmentAccess{})
+	envService := NewEnvironmentService(db, nil)
+	migrations := NewProjectMigrationService(envService, NewAggregateService(db, envService, nil, nil, nil), nil, nil)
+	migrations.pollInterval = 0
+
+	oldHost, newHost := newMigrationTestAgent(), newMigrationTestAgent()
+	env := "POSTGRES_PASSWORD=secret\n"
+	oldHost.projects["p-1"] = dto.ProjectDetailsDto{ID: "p-1", Name: "Billing", ComposeContent: migrationTestCompose, EnvContent: env}
+	oldHost.running["p-1"] = true
+	oldHost.volumes["billing_data"] = "rows"
+	oldHost.volumes["shared"] = "shared files"
+
+	ids := map[*migrationTestAgent]string{}
+	for name, agent := range map[string]*migrationTestAgent{"old": oldHost, "new": newHost} {
+		token := name + "-token"
+		created, err := envService.CreateEnvironment(ctx, &models.Environment{Name: name, ApiUrl: agent.start(t).URL, Enabled: true, AccessToken: &token})
+		require.NoError(t, err)
+		ids[agent] = created.ID
+	}
+	admin := AggregateCaller{User: &models.User{BaseModel: models.BaseModel{ID: "user-1"}}, Permissions: []models.Permission{models.PermissionAll}}
+
+	_, err := migrations.Migrate(ctx, admin, dto.MigrateProjectDto{SourceEnvironmentID: ids[oldHost], ProjectID: "p-1", TargetEnvironmentID: ids[newHost], StopSource: true})
+	require.ErrorIs(t, err, ErrInvalidProjectMigration)
+
+	// A caller who may only read projects cannot create one on the target.
+	viewer := AggregateCaller{User: admin.User, Permissions: []models.Permission{models.PermissionProjectsRead}}
+	_, err = migrations.Migrate(ctx, viewer, dto.MigrateProjectDto{SourceEnvironmentID: ids[oldHost], ProjectID: "p-1", TargetEnvironmentID: ids[newHost]})
+	require.ErrorIs(t, err, ErrMigrationEnvironment)
+
+	result, err := migrations.Migrate(ctx, admin, dto.MigrateProjectDto{
+		SourceEnvironmentID: ids[oldHost], ProjectID: "p-1", TargetEnvironmentID: ids[newHost],
+		PullImages: true, Deploy: true, StopSource: true, CopyVolumes: true,
+	})
+	require.NoError(t, err)
+	require.True(t, result.Success, "%+v", result.Steps)
+	require.Equal(t, []string{"read", "create", "stop-source", "copy-volume:data", "copy-volume:shared", "pull", "deploy", "health"}, stepNames(result))
+	require.Equal(t, "new-Billing", result.TargetProjectID)
+
+	// The project arrives with its .env, its volumes keep their data and compose ownership.
+	require.Equal(t, env, newHost.projects["new-Billing"].EnvContent)
+	require.Equal(t, "rows", newHost.volumes["billing_data"])
+	require.ElementsMatch(t, []string{"com.docker.compose.project=billing", "com.docker.compose.volume=data"}, newHost.labels["billing_data"])
+	require.Equal(t, "shared files", newHost.volumes["shared"])
+	require.Empty(t, newHost.labels["shared"], "external volumes are not claimed by the project")
+	require.True(t, newHost.running["new-Billing"])
+	require.False(t, oldHost.running["p-1"], "the source stays down")
+}
+
+func TestProjectMigration_RestartsSourceWhenTargetUnhealthy(t *testing.T) {
+	ctx := context.Background()
+	utils.InitEncryption(&config.Config{})
+	db, _ := newAgentTLSTestDB(t, &models.Environment{}, &models.EnvironmentAccess{})
+	envService := NewEnvironmentService(db, nil)
+	migrations := NewProjectMigrationService(envService, NewAggregateService(db, envService, nil, nil, nil), nil, nil)
+	migrations.pollInterval = 0
+
+	oldHost, newHost := newMigrationTestAgent(), newMigrationTestAgent()
+	newHost.unhealthy = true
+	oldHost.projects["p-1"] = dto.ProjectDetailsDto{ID: "p-1", Name: "billing", ComposeContent: migrationTestCompose}
+	oldHost.running["p-1"] = true
+
+	ids := map[*migrationTestAgent]string{}
+	for name, agent := range map[string]*migrationTestAgent{"old": oldHost, "new": newHost} {
+		token := name + "-token"
+		created, err := envService.CreateEnvironment(ctx, &models.Environment{Name: name, ApiUrl: agent.start(t).URL, Enabled: true, AccessToken: &token})
+		require.NoError(t, err)
+		ids[agent] = created.ID
+	}
+	admin := AggregateCaller{User: &models.User{BaseModel: models.BaseModel{ID: "user-1"}}, Permissions: []models.Permission{models.PermissionAll}}
+
+	result, err := migrations.Migrate(ctx, admin, dto.MigrateProjectDto{
+		SourceEnvironmentID: ids[oldHost], ProjectID: "p-1", TargetEnvironmentID: ids[newHost],
+		Deploy: true, StopSource: true, CopyVolumes: true, HealthTimeoutSeconds: 1,
+	})
+	require.NoError(t, err)
+	require.False(t, result.Success)
+	require.Equal(t, []string{"read", "create", "stop-source", "copy-volume:data", "copy-volume:shared", "deploy", "health", "restart-source"}, stepNames(result))
+	require.Contains(t, result.Steps[3].Detail, "does not exist on the source")
+	require.Contains(t, result.Steps[6].Error, "db is starting")
+	require.True(t, oldHost.running["p-1"], "the source is brought back up")
+}
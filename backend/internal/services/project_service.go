@@ -2,6 +2,7 @@ package services
 
 import (
 	"bufio"
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
@@ -13,6 +14,7 @@ import (
 	"time"
 
 	"github.com/compose-spec/compose-go/v2/loader"
+	composetypes "github.com/compose-spec/compose-go/v2/types"
 	"github.com/docker/compose/v2/pkg/api"
 	"github.com/ofkm/arcane-backend/internal/database"
 	"github.com/ofkm/arcane-backend/internal/dto"
@@ -24,6 +26,13 @@ import (
 	"gorm.io/gorm"
 )
 
+var (
+	// ErrProjectNotFound is returned for project IDs with no project.
+	ErrProjectNotFound = errors.New("project not found")
+	// ErrUnknownProjectService is returned when an action names a service the project lacks.
+	ErrUnknownProjectService = errors.New("project has no such service")
+)
+
 type ProjectService struct {
 	db              *database.DB
 	settingsService *SettingsService
@@ -63,6 +72,51 @@ func normalizeComposeProjectName(name string) string {
 	return normalized
 }
 
+// selectProjectServices restricts project to the named services, leaving their dependencies
+// as they are. The whole project is kept when no services are named.
+func selectProjectServices(project *composetypes.Project, services []string) (*composetypes.Project, error) {
+	if len(services) == 0 {
+		return project, nil
+	}
+	for _, name := range services {
+		if _, ok := project.Services[name]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownProjectService, name)
+		}
+	}
+	return project.WithSelectedServices(services, composetypes.IgnoreDependencies)
+}
+
+// loadProjectCompose loads the compose project of a project from its folder.
+func (s *ProjectService) loadProjectCompose(ctx context.Context, proj *models.Project) (*composetypes.Project, error) {
+	// Get configured projects directory from settings
+	projectsDirSetting := s.settingsService.GetStringSetting(ctx, "projectsDirectory", "data/projects")
+	projectsDirectory, pdErr := fs.GetProjectsDirectory(ctx, strings.TrimSpace(projectsDirSetting))
+	if pdErr != nil {
+		slog.WarnContext(ctx, "unable to determine projects directory; using default", "error", pdErr)
+		projectsDirectory = "data/projects"
+	}
+
+	compProj, _, lerr := projects.LoadComposeProjectFromDir(ctx, proj.Path, normalizeComposeProjectName(proj.Name), projectsDirectory)
+	if lerr != nil {
+		return nil, fmt.Errorf("failed to load compose project: %w", lerr)
+	}
+	return compProj, nil
+}
+
+// ValidateProjectServices checks that the project defines every named service.
+func (s *ProjectService) ValidateProjectServices(ctx context.Context, projectID string, services []string) error {
+	proj, err := s.GetProjectFromDatabaseByID(ctx, projectID)
+	if err != nil {
+		return err
+	}
+	compProj, err := s.loadProjectCompose(ctx, proj)
+	if err != nil {
+		return err
+	}
+	_, err = selectProjectServices(compProj, services)
+	return err
+}
+
 func (s *ProjectService) GetProjectFromDatabaseByID(ctx context.Context, id string) (*models.Project, error) {
 	var project models.Project
 	if err := s.db.WithContext(ctx).Where("id = ?", id).First(&project).Error; err != nil {
@@ -70,7 +124,7 @@ func (s *ProjectService) GetProjectFromDatabaseByID(ctx context.Context, id stri
 			return nil, fmt.Errorf("request canceled or timed out")
 		}
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, fmt.Errorf("project not found")
+			return nil, ErrProjectNotFound
 		}
 		return nil, fmt.Errorf("failed to get project: %w", err)
 	}
@@ -231,6 +285,7 @@ func (s *ProjectService) GetProjectDetails(ctx context.Context, projectID string
 	resp.ServiceCount = serviceCount
 	resp.RunningCount = runningCount
 	resp.DirName = utils.DerefString(proj.DirName)
+	resp.Git = projectGitDto(proj)
 	if serr == nil && services != nil {
 		raw := make([]any, len(services))
 		for i := range services {
@@ -314,6 +369,10 @@ func (s *ProjectService) upsertProjectForDir(ctx context.Context, dirName, dirPa
 	if err != nil {
 		return fmt.Errorf("query existing project for %q failed: %w", dirPath, err)
 	}
+	if existing.GitRepositoryUrl != nil {
+		// Git projects with a sub path live below the folder; their path is not the folder's.
+		return nil
+	}
 
 	updates := map[string]interface{}{}
 	if existing.Path != dirPath {
@@ -496,7 +555,8 @@ func (s *ProjectService) GetProjectStatusCounts(ctx context.Context) (folderCoun
 
 // Project Actions
 
-func (s *ProjectService) DeployProject(ctx context.Context, projectID string, user models.User) error {
+// DeployProject brings the project up, or only the named services when any are given.
+func (s *ProjectService) DeployProject(ctx context.Context, projectID string, user models.User, services ...string) error {
 	projectFromDb, err := s.GetProjectFromDatabaseByID(ctx, projectID)
 	if err != nil {
 		return fmt.Errorf("failed to get project: %w", err)
@@ -519,6 +579,9 @@ func (s *ProjectService) DeployProject(ctx context.Context, projectID string, us
 	if loadErr != nil {
 		return fmt.Errorf("failed to load compose project from %s: %w", projectFromDb.Path, loadErr)
 	}
+	if project, err = selectProjectServices(project, services); err != nil {
+		return err
+	}
 
 	if err := s.updateProjectStatusInternal(ctx, projectID, models.ProjectStatusDeploying); err != nil {
 		return fmt.Errorf("failed to update project status to deploying: %w", err)
@@ -538,10 +601,19 @@ func (s *ProjectService) DeployProject(ctx context.Context, projectID string, us
 	}
 
 	metadata := models.JSON{"action": "deploy", "projectID": projectID, "projectName": project.Name}
+	if len(services) > 0 {
+		metadata["services"] = services
+	}
 	if logErr := s.eventService.LogProjectEvent(ctx, models.EventTypeProjectDeploy, projectID, project.Name, user.ID, user.Username, "0", metadata); logErr != nil {
 		slog.ErrorContext(ctx, "could not log project deployment action", "error", logErr)
 	}
 
+	if projectFromDb.GitCommit != nil {
+		if err := s.db.WithContext(ctx).Model(projectFromDb).Update("git_deployed_commit", *projectFromDb.GitCommit).Error; err != nil {
+			slog.WarnContext(ctx, "failed to record deployed commit", "projectID", projectID, "error", err)
+		}
+	}
+
 	err = s.updateProjectStatusandCountsInternal(ctx, projectID, models.ProjectStatusRunning)
 	if err != nil {
 		slog.Error("failed to update project status and counts after deploy", "projectID", projectID, "error", err)
@@ -659,7 +731,11 @@ func (s *ProjectService) DestroyProject(ctx context.Context, projectID string, r
 	}
 
 	if removeFiles {
-		if err := os.RemoveAll(proj.Path); err != nil {
+		filesPath := proj.Path
+		if proj.GitRepositoryUrl != nil {
+			filesPath = gitCloneRoot(proj)
+		}
+		if err := os.RemoveAll(filesPath); err != nil {
 			return fmt.Errorf("failed to remove project files: %w", err)
 		}
 	}
@@ -676,41 +752,46 @@ func (s *ProjectService) DestroyProject(ctx context.Context, projectID string, r
 	return nil
 }
 
-func (s *ProjectService) RedeployProject(ctx context.Context, projectID string, user models.User) error {
+// RedeployProject pulls the project's images and deploys it again, or only the named services
+// when any are given.
+func (s *ProjectService) RedeployProject(ctx context.Context, projectID string, user models.User, services ...string) error {
 	proj, err := s.GetProjectFromDatabaseByID(ctx, projectID)
 	if err != nil {
 		return err
 	}
 
-	if err := s.PullProjectImages(ctx, projectID, io.Discard); err != nil {
+	if err := s.PullProjectImages(ctx, projectID, io.Discard, services...); err != nil {
+		if errors.Is(err, ErrUnknownProjectService) {
+			return err
+		}
 		slog.WarnContext(ctx, "failed to pull project images", "error", err)
 	}
 
 	metadata := models.JSON{"action": "redeploy", "projectID": projectID, "projectName": proj.Name}
+	if len(services) > 0 {
+		metadata["services"] = services
+	}
 	if logErr := s.eventService.LogProjectEvent(ctx, models.EventTypeProjectDeploy, projectID, proj.Name, user.ID, user.Username, "0", metadata); logErr != nil {
 		slog.ErrorContext(ctx, "could not log project redeploy action", "error", logErr)
 	}
 
-	return s.DeployProject(ctx, projectID, systemUser)
+	return s.DeployProject(ctx, projectID, systemUser, services...)
 }
 
-func (s *ProjectService) PullProjectImages(ctx context.Context, projectID string, progressWriter io.Writer) error {
+// PullProjectImages pulls the images of the project's services, or of the named ones when any
+// are given.
+func (s *ProjectService) PullProjectImages(ctx context.Context, projectID string, progressWriter io.Writer, services ...string) error {
 	proj, err := s.GetProjectFromDatabaseByID(ctx, projectID)
 	if err != nil {
 		return err
 	}
 
-	// Get configured projects directory from settings
-	projectsDirSetting := s.settingsService.GetStringSetting(ctx, "projectsDirectory", "data/projects")
-	projectsDirectory, pdErr := fs.GetProjectsDirectory(ctx, strings.TrimSpace(projectsDirSetting))
-	if pdErr != nil {
-		slog.WarnContext(ctx, "unable to determine projects directory; using default", "error", pdErr)
-		projectsDirectory = "data/projects"
+	compProj, err := s.loadProjectCompose(ctx, proj)
+	if err != nil {
+		return err
 	}
-
-	compProj, _, lerr := projects.LoadComposeProjectFromDir(ctx, proj.Path, normalizeComposeProjectName(proj.Name), projectsDirectory)
-	if lerr != nil {
-		return fmt.Errorf("failed to load compose project: %w", lerr)
+	if compProj, err = selectProjectServices(compProj, services); err != nil {
+		return err
 	}
 
 	images := map[string]struct{}{}
@@ -822,7 +903,7 @@ func (s *ProjectService) UpdateProject(ctx context.Context, projectID string, na
 	var proj models.Project
 	if err := s.db.WithContext(ctx).First(&proj, "id = ?", projectID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, fmt.Errorf("project not found")
+			return nil, ErrProjectNotFound
 		}
 		return nil, fmt.Errorf("failed to get project: %w", err)
 	}
@@ -840,6 +921,8 @@ func (s *ProjectService) UpdateProject(ctx context.Context, projectID string, na
 	}
 
 	switch {
+	case composeContent != nil && proj.GitRepositoryUrl != nil:
+		return nil, fmt.Errorf("the compose file of a Git project is updated by syncing its repository")
 	case composeContent != nil:
 		if err := fs.SaveOrUpdateProjectFiles(projectsDirectory, proj.Path, *composeContent, envContent); err != nil {
 			return nil, fmt.Errorf("failed to save project files: %w", err)
@@ -944,6 +1027,17 @@ func (s *ProjectService) ListProjects(ctx context.Context, params pagination.Que
 	return result, paginationResp, nil
 }
 
+// projectListSortBindings mirrors the sortable project columns for listings that are sorted in
+// memory, such as the aggregated listing across environments.
+func projectListSortBindings() []pagination.SortBinding[dto.ProjectDetailsDto] {
+	return []pagination.SortBinding[dto.ProjectDetailsDto]{
+		{Key: "name", Fn: func(a, b dto.ProjectDetailsDto) int { return strings.Compare(a.Name, b.Name) }},
+		{Key: "status", Fn: func(a, b dto.ProjectDetailsDto) int { return strings.Compare(a.Status, b.Status) }},
+		{Key: "serviceCount", Fn: func(a, b dto.ProjectDetailsDto) int { return cmp.Compare(a.ServiceCount, b.ServiceCount) }},
+		{Key: "runningCount", Fn: func(a, b dto.ProjectDetailsDto) int { return cmp.Compare(a.RunningCount, b.RunningCount) }},
+	}
+}
+
 // fetchProjectStatusConcurrently fetches live Docker status for multiple projects in parallel
 func (s *ProjectService) fetchProjectStatusConcurrently(ctx context.Context, projects []models.Project) []dto.ProjectDetailsDto {
 	type projectResult struct {
@@ -1034,6 +1128,7 @@ func (s *ProjectService) fetchProjectStatusConcurrently(ctx context.Context, pro
 					RunningCount: displayRunningCount,
 					CreatedAt:    proj.CreatedAt.Format(time.RFC3339),
 					UpdatedAt:    proj.UpdatedAt.Format(time.RFC3339),
+					Git:          projectGitDto(&proj),
 				},
 			}
 		}(i, project)
@@ -1066,6 +1161,7 @@ func (s *ProjectService) fetchProjectStatusConcurrently(ctx context.Context, pro
 					RunningCount: proj.RunningCount,
 					CreatedAt:    proj.CreatedAt.Format(time.RFC3339),
 					UpdatedAt:    proj.UpdatedAt.Format(time.RFC3339),
+					Git:          projectGitDto(&proj),
 				}
 			}
 			return results
@@ -0,0 +1,320 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/utils"
+)
+
+const (
+	webhookSecretLength = 48
+	// webhookRedeployTimeout bounds a redeploy started by a webhook call.
+	webhookRedeployTimeout = 30 * time.Minute
+	// webhookRejectLogInterval is how often a rejected call is logged per client IP and project;
+	// the calls rejected in between are counted into the next event.
+	webhookRejectLogInterval = time.Minute
+)
+
+var (
+	// ErrWebhookNotFound is returned for projects without a webhook, and for missing projects so
+	// that callers cannot tell the two apart.
+	ErrWebhookNotFound     = errors.New("webhook not found")
+	ErrWebhookUnauthorized = errors.New("invalid webhook token or signature")
+)
+
+// webhookUser is who redeploys started by webhooks are attributed to.
+var webhookUser = models.User{Username: "Webhook"}
+
+// WebhookCall is an inbound call to a project's webhook. It is authenticated by Token, the
+// webhook's secret, or by Signature, the hex HMAC-SHA256 of Body keyed with the secret and
+// optionally prefixed "sha256=" as GitHub and Gitea send it.
+type WebhookCall struct {
+	Token     string
+	Signature string
+	Body      []byte
+	// Services limits the redeploy to these services; all are redeployed when empty.
+	Services []string
+	ClientIP string
+}
+
+// ProjectWebhookService lets CI systems redeploy a project through a per-project webhook
+// without a user session. Redeploys run in the background, one at a time per project: calls
+// arriving while one runs are folded into a single follow-up redeploy.
+type ProjectWebhookService struct {
+	db             *database.DB
+	projectService *ProjectService
+	eventService   *EventService
+
+	mu sync.Mutex
+	// runs holds the projects being redeployed.
+	runs map[string]*webhookRun
+	// rejections holds the rejected calls per client IP and project.
+	rejections        map[webhookRejectionKey]*webhookRejections
+	rejectionsSweptAt time.Time
+
+	// redeploy is replaced in tests.
+	redeploy func(ctx context.Context, projectID string, services []string) error
+}
+
+// webhookRun is a project's webhook redeploy in progress and the calls that arrived during it.
+type webhookRun struct {
+	pending bool
+	// services of the pending calls; nil redeploys every service.
+	services []string
+}
+
+type webhookRejectionKey struct {
+	projectID string
+	ip        string
+}
+
+// webhookRejections tracks when a rejected call was last logged and how many were not since.
+type webhookRejections struct {
+	loggedAt   time.Time
+	suppressed int
+}
+
+func NewProjectWebhookService(db *database.DB, projectService *ProjectService, eventService *EventService) *ProjectWebhookService {
+	s := &ProjectWebhookService{
+		db:             db,
+		projectService: projectService,
+		eventService:   eventService,
+		runs:           map[string]*webhookRun{},
+		rejections:     map[webhookRejectionKey]*webhookRejections{},
+	}
+	s.redeploy = func(ctx context.Context, projectID string, services []string) error {
+		return projectService.RedeployProject(ctx, projectID, webhookUser, services...)
+	}
+	return s
+}
+
+// Enabled reports whether the project's webhook is on.
+func (s *ProjectWebhookService) Enabled(ctx context.Context, projectID string) (bool, error) {
+	proj, err := s.projectService.GetProjectFromDatabaseByID(ctx, projectID)
+	if err != nil {
+		return false, err
+	}
+	return proj.WebhookSecret != nil, nil
+}
+
+// RegenerateToken turns the project's webhook on with a new secret, which invalidates the
+// previous one, and returns it. The secret is not shown again.
+func (s *ProjectWebhookService) RegenerateToken(ctx context.Context, projectID string, user models.User) (string, error) {
+	proj, err := s.projectService.GetProjectFromDatabaseByID(ctx, projectID)
+	if err != nil {
+		return "", err
+	}
+
+	secret := utils.GenerateRandomString(webhookSecretLength)
+	encrypted, err := utils.Encrypt(secret)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt webhook secret: %w", err)
+	}
+	if err := s.db.WithContext(ctx).Model(proj).Update("webhook_secret", encrypted).Error; err != nil {
+		return "", fmt.Errorf("failed to save webhook secret: %w", err)
+	}
+
+	metadata := models.JSON{"action": "webhook_token_regenerate", "projectID": proj.ID, "projectName": proj.Name}
+	if logErr := s.eventService.LogProjectEvent(ctx, models.EventTypeProjectUpdate, proj.ID, proj.Name, user.ID, user.Username, "0", metadata); logErr != nil {
+		slog.ErrorContext(ctx, "could not log webhook token regeneration", "error", logErr)
+	}
+	return secret, nil
+}
+
+// Disable turns the project's webhook off.
+func (s *ProjectWebhookService) Disable(ctx context.Context, projectID string, user models.User) error {
+	proj, err := s.projectService.GetProjectFromDatabaseByID(ctx, projectID)
+	if err != nil {
+		return err
+	}
+	if err := s.db.WithContext(ctx).Model(proj).Update("webhook_secret", nil).Error; err != nil {
+		return fmt.Errorf("failed to disable webhook: %w", err)
+	}
+
+	metadata := models.JSON{"action": "webhook_disable", "projectID": proj.ID, "projectName": proj.Name}
+	if logErr := s.eventService.LogProjectEvent(ctx, models.EventTypeProjectUpdate, proj.ID, proj.Name, user.ID, user.Username, "0", metadata); logErr != nil {
+		slog.ErrorContext(ctx, "could not log webhook disable", "error", logErr)
+	}
+	return nil
+}
+
+// Trigger authenticates a webhook call and queues a redeploy of the project. It returns once
+// the redeploy is queued, reporting whether it starts now or follows the one running.
+func (s *ProjectWebhookService) Trigger(ctx context.Context, projectID string, call WebhookCall) (started bool, err error) {
+	proj, err := s.projectService.GetProjectFromDatabaseByID(ctx, projectID)
+	if errors.Is(err, ErrProjectNotFound) {
+		return false, ErrWebhookNotFound
+	}
+	if err != nil {
+		return false, err
+	}
+	if proj.WebhookSecret == nil {
+		return false, ErrWebhookNotFound
+	}
+	secret, err := utils.Decrypt(*proj.WebhookSecret)
+	if err != nil {
+		return false, fmt.Errorf("failed to decrypt webhook secret: %w", err)
+	}
+
+	method, ok := verifyWebhookCall(secret, call)
+	if !ok {
+		suppressed, log := s.trackRejection(proj.ID, call.ClientIP)
+		if !log {
+			return false, ErrWebhookUnauthorized
+		}
+		metadata := models.JSON{"action": "webhook", "projectID": proj.ID, "projectName": proj.Name, "ip": call.ClientIP}
+		if suppressed > 0 {
+			metadata["suppressed"] = suppressed
+		}
+		if logErr := s.eventService.LogProjectEvent(ctx, models.EventTypeProjectWebhookRejected, proj.ID, proj.Name, webhookUser.ID, webhookUser.Username, "0", metadata); logErr != nil {
+			slog.ErrorContext(ctx, "could not log rejected webhook call", "error", logErr)
+		}
+		return false, ErrWebhookUnauthorized
+	}
+
+	services := compactServices(call.Services)
+	if len(services) > 0 {
+		if err := s.projectService.ValidateProjectServices(ctx, proj.ID, services); err != nil {
+			return false, err
+		}
+	}
+
+	started = s.enqueue(ctx, proj, services)
+
+	metadata := models.JSON{"action": "webhook", "projectID": proj.ID, "projectName": proj.Name, "ip": call.ClientIP, "auth": method, "queued": !started}
+	if len(services) > 0 {
+		metadata["services"] = services
+	}
+	if logErr := s.eventService.LogProjectEvent(ctx, models.EventTypeProjectWebhook, proj.ID, proj.Name, webhookUser.ID, webhookUser.Username, "0", metadata); logErr != nil {
+		slog.ErrorContext(ctx, "could not log webhook call", "error", logErr)
+	}
+	return started, nil
+}
+
+// trackRejection records a rejected call from ip to the project and reports whether to log it,
+// along with how many rejected calls went unlogged since the last one.
+func (s *ProjectWebhookService) trackRejection(projectID, ip string) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+
+	// Drop the clients that stopped calling so the map only holds recent ones. Only the count of
+	// their unlogged calls is lost; the first one was logged.
+	if now.Sub(s.rejectionsSweptAt) >= webhookRejectLogInterval {
+		for k, r := range s.rejections {
+			if now.Sub(r.loggedAt) >= 2*webhookRejectLogInterval {
+				delete(s.rejections, k)
+			}
+		}
+		s.rejectionsSweptAt = now
+	}
+
+	key := webhookRejectionKey{projectID: projectID, ip: ip}
+	r, ok := s.rejections[key]
+	if !ok {
+		s.rejections[key] = &webhookRejections{loggedAt: now}
+		return 0, true
+	}
+	if now.Sub(r.loggedAt) < webhookRejectLogInterval {
+		r.suppressed++
+		return 0, false
+	}
+	suppressed := r.suppressed
+	r.loggedAt, r.suppressed = now, 0
+	return suppressed, true
+}
+
+// enqueue starts a redeploy of the project, or folds services into the redeploy that follows
+// the running one, and reports whether it started one.
+func (s *ProjectWebhookService) enqueue(ctx context.Context, proj *models.Project, services []string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if run, ok := s.runs[proj.ID]; ok {
+		switch {
+		case !run.pending:
+			run.pending, run.services = true, services
+		case len(run.services) == 0 || len(services) == 0:
+			run.services = nil
+		default:
+			run.services = compactServices(append(run.services, services...))
+		}
+		return false
+	}
+
+	s.runs[proj.ID] = &webhookRun{}
+	go s.run(context.WithoutCancel(ctx), proj, services)
+	return true
+}
+
+func (s *ProjectWebhookService) run(ctx context.Context, proj *models.Project, services []string) {
+	for {
+		runCtx, cancel := context.WithTimeout(ctx, webhookRedeployTimeout)
+		err := s.redeploy(runCtx, proj.ID, services)
+		cancel()
+		if err != nil {
+			slog.ErrorContext(ctx, "Webhook redeploy failed", "projectID", proj.ID, "services", services, "error", err)
+			metadata := models.JSON{"action": "webhook_redeploy", "projectID": proj.ID, "projectName": proj.Name, "error": err.Error()}
+			if len(services) > 0 {
+				metadata["services"] = services
+			}
+			if logErr := s.eventService.LogProjectEvent(ctx, models.EventTypeProjectError, proj.ID, proj.Name, webhookUser.ID, webhookUser.Username, "0", metadata); logErr != nil {
+				slog.ErrorContext(ctx, "could not log webhook redeploy failure", "error", logErr)
+			}
+		}
+
+		s.mu.Lock()
+		run := s.runs[proj.ID]
+		if !run.pending {
+			delete(s.runs, proj.ID)
+			s.mu.Unlock()
+			return
+		}
+		services = run.services
+		run.pending, run.services = false, nil
+		s.mu.Unlock()
+	}
+}
+
+// verifyWebhookCall checks the call's signature, or its token when unsigned, against secret and
+// returns which of the two authenticated it.
+func verifyWebhookCall(secret string, call WebhookCall) (string, bool) {
+	if call.Signature != "" {
+		got, err := hex.DecodeString(strings.TrimPrefix(call.Signature, "sha256="))
+		if err != nil {
+			return "signature", false
+		}
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(call.Body)
+		return "signature", hmac.Equal(got, mac.Sum(nil))
+	}
+	if call.Token != "" {
+		return "token", subtle.ConstantTimeCompare([]byte(call.Token), []byte(secret)) == 1
+	}
+	return "", false
+}
+
+// compactServices trims, sorts and deduplicates service names, dropping empty ones.
+func compactServices(services []string) []string {
+	out := make([]string, 0, len(services))
+	for _, name := range services {
+		if name = strings.TrimSpace(name); name != "" {
+			out = append(out, name)
+		}
+	}
+	slices.Sort(out)
+	return slices.Compact(out)
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ofkm/arcane-backend/internal/config"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/utils"
+)
+
+// webhookRedeploy is a redeploy the webhook service started, held until release is closed.
+type webhookRedeploy struct {
+	services []string
+	release  chan struct{}
+}
+
+func newProjectWebhookTestService(t *testing.T) (*ProjectWebhookService, *models.Project, chan webhookRedeploy) {
+	t.Helper()
+	utils.InitEncryption(&config.Config{})
+	db, settingsService := newAgentTLSTestDB(t, &models.Project{}, &models.Event{})
+	require.NoError(t, settingsService.SetStringSetting(context.Background(), "projectsDirectory", t.TempDir()))
+	eventService := NewEventService(db)
+	projectService := NewProjectService(db, settingsService, eventService, nil)
+
+	compose := "services:\n  web:\n    image: nginx:1.27\n  worker:\n    image: redis:7\n"
+	proj, err := projectService.CreateProject(context.Background(), "shop", compose, nil, systemUser)
+	require.NoError(t, err)
+
+	redeploys := make(chan webhookRedeploy)
+	webhookService := NewProjectWebhookService(db, projectService, eventService)
+	webhookService.redeploy = func(ctx context.Context, projectID string, services []string) error {
+		call := webhookRedeploy{services: services, release: make(chan struct{})}
+		redeploys <- call
+		<-call.release
+		return nil
+	}
+	return webhookService, proj, redeploys
+}
+
+func nextWebhookRedeploy(t *testing.T, redeploys chan webhookRedeploy) webhookRedeploy {
+	t.Helper()
+	select {
+	case call := <-redeploys:
+		return call
+	case <-time.After(5 * time.Second):
+		t.Fatal("no redeploy was started")
+		return webhookRedeploy{}
+	}
+}
+
+func TestProjectWebhookService_Authentication(t *testing.T) {
+	ctx := context.Background()
+	webhookService, proj, redeploys := newProjectWebhookTestService(t)
+
+	_, err := webhookService.Trigger(ctx, proj.ID, WebhookCall{Token: "anything"})
+	require.ErrorIs(t, err, ErrWebhookNotFound, "webhooks are off until a token is generated")
+	_, err = webhookService.Trigger(ctx, "missing", WebhookCall{Token: "anything"})
+	require.ErrorIs(t, err, ErrWebhookNotFound)
+
+	token, err := webhookService.RegenerateToken(ctx, proj.ID, systemUser)
+	require.NoError(t, err)
+	enabled, err := webhookService.Enabled(ctx, proj.ID)
+	require.NoError(t, err)
+	require.True(t, enabled)
+
+	_, err = webhookService.Trigger(ctx, proj.ID, WebhookCall{Token: "wrong", ClientIP: "203.0.113.7"})
+	require.ErrorIs(t, err, ErrWebhookUnauthorized)
+	_, err = webhookService.Trigger(ctx, proj.ID, WebhookCall{ClientIP: "203.0.113.7"})
+	require.ErrorIs(t, err, ErrWebhookUnauthorized)
+	var rejected []models.Event
+	require.NoError(t, webhookService.db.Where("type = ?", models.EventTypeProjectWebhookRejected).Find(&rejected).Error)
+	require.Len(t, rejected, 1)
+	require.Equal(t, "203.0.113.7", rejected[0].Metadata["ip"])
+
+	_, err = webhookService.Trigger(ctx, proj.ID, WebhookCall{Token: token, Services: []string{"db"}})
+	require.ErrorIs(t, err, ErrUnknownProjectService)
+
+	started, err := webhookService.Trigger(ctx, proj.ID, WebhookCall{Token: token, Services: []string{" web", "web"}, ClientIP: "198.51.100.4"})
+	require.NoError(t, err)
+	require.True(t, started)
+	call := nextWebhookRedeploy(t, redeploys)
+	require.Equal(t, []string{"web"}, call.services)
+	close(call.release)
+
+	var calls []models.Event
+	require.NoError(t, webhookService.db.Where("type = ?", models.EventTypeProjectWebhook).Find(&calls).Error)
+	require.Len(t, calls, 1)
+	require.Equal(t, "198.51.100.4", calls[0].Metadata["ip"])
+	require.Equal(t, "token", calls[0].Metadata["auth"])
+
+	body := []byte(`{"ref":"refs/heads/main"}`)
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write(body)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	_, err = webhookService.Trigger(ctx, proj.ID, WebhookCall{Signature: signature, Body: []byte(`{"ref":"refs/heads/evil"}`)})
+	require.ErrorIs(t, err, ErrWebhookUnauthorized, "the signature covers the body")
+	require.Eventually(t, func() bool {
+		_, err = webhookService.Trigger(ctx, proj.ID, WebhookCall{Signature: signature, Body: body})
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	call = nextWebhookRedeploy(t, redeploys)
+	require.Empty(t, call.services)
+	close(call.release)
+
+	// A new token replaces the old one, and disabling turns the webhook off.
+	newToken, err := webhookService.RegenerateToken(ctx, proj.ID, systemUser)
+	require.NoError(t, err)
+	require.NotEqual(t, token, newToken)
+	_, err = webhookService.Trigger(ctx, proj.ID, WebhookCall{Token: token})
+	require.ErrorIs(t, err, ErrWebhookUnauthorized)
+
+	require.NoError(t, webhookService.Disable(ctx, proj.ID, systemUser))
+	_, err = webhookService.Trigger(ctx, proj.ID, WebhookCall{Token: newToken})
+	require.ErrorIs(t, err, ErrWebhookNotFound)
+}
+
+func TestProjectWebhookService_RateLimitsRejectedCallEvents(t *testing.T) {
+	ctx := context.Background()
+	webhookService, proj, _ := newProjectWebhookTestService(t)
+	_, err := webhookService.RegenerateToken(ctx, proj.ID, systemUser)
+	require.NoError(t, err)
+
+	rejectedEvents := func() []models.Event {
+		var events []models.Event
+		require.NoError(t, webhookService.db.Where("type = ?", models.EventTypeProjectWebhookRejected).Find(&events).Error)
+		return events
+	}
+
+	for range 5 {
+		_, err = webhookService.Trigger(ctx, proj.ID, WebhookCall{Token: "wrong", ClientIP: "203.0.113.7"})
+		require.ErrorIs(t, err, ErrWebhookUnauthorized)
+	}
+	_, err = webhookService.Trigger(ctx, proj.ID, WebhookCall{Token: "wrong", ClientIP: "203.0.113.8"})
+	require.ErrorIs(t, err, ErrWebhookUnauthorized)
+	events := rejectedEvents()
+	require.Len(t, events, 2, "one event per client IP within the interval")
+	require.ElementsMatch(t, []any{"203.0.113.7", "203.0.113.8"}, []any{events[0].Metadata["ip"], events[1].Metadata["ip"]})
+
+	// Once the interval has passed the next rejection is logged with the count of the skipped ones.
+	webhookService.mu.Lock()
+	webhookService.rejections[webhookRejectionKey{projectID: proj.ID, ip: "203.0.113.7"}].loggedAt = time.Now().Add(-webhookRejectLogInterval)
+	webhookService.mu.Unlock()
+	_, err = webhookService.Trigger(ctx, proj.ID, WebhookCall{Token: "wrong", ClientIP: "203.0.113.7"})
+	require.ErrorIs(t, err, ErrWebhookUnauthorized)
+	events = rejectedEvents()
+	require.Len(t, events, 3)
+	var suppressed []any
+	for _, event := range events {
+		if n, ok := event.Metadata["suppressed"]; ok {
+			suppressed = append(suppressed, n)
+		}
+	}
+	require.EqualValues(t, []any{float64(4)}, suppressed)
+}
+
+func TestProjectWebhookService_CoalescesCallsDuringRedeploy(t *testing.T) {
+	ctx := context.Background()
+	webhookService, proj, redeploys := newProjectWebhookTestService(t)
+	token, err := webhookService.RegenerateToken(ctx, proj.ID, systemUser)
+	require.NoError(t, err)
+
+	started, err := webhookService.Trigger(ctx, proj.ID, WebhookCall{Token: token, Services: []string{"web"}})
+	require.NoError(t, err)
+	require.True(t, started)
+	first := nextWebhookRedeploy(t, redeploys)
+
+	for _, services := range [][]string{{"worker"}, {"web"}} {
+		started, err = webhookService.Trigger(ctx, proj.ID, WebhookCall{Token: token, Services: services})
+		require.NoError(t, err)
+		require.False(t, started)
+	}
+	close(first.release)
+
+	second := nextWebhookRedeploy(t, redeploys)
+	require.Equal(t, []string{"web", "worker"}, second.services, "the queued calls run as one redeploy")
+	close(second.release)
+
+	require.Eventually(t, func() bool {
+		webhookService.mu.Lock()
+		defer webhookService.mu.Unlock()
+		return len(webhookService.runs) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,252 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/models"
+)
+
+// proxyLoginInterval is how often a proxy-authenticated user's last login is refreshed and a
+// login event logged; the headers arrive on every request.
+const proxyLoginInterval = time.Hour
+
+var (
+	ErrProxyAuthDisabled = errors.New("proxy authentication is disabled")
+	// ErrProxyUserNotProvisioned is returned for users the proxy vouches for but Arcane does not
+	// know, when auto-provisioning is off.
+	ErrProxyUserNotProvisioned = errors.New("proxy authenticated user does not exist")
+)
+
+type ProxyAuthService struct {
+	db              *database.DB
+	settingsService *SettingsService
+	userService     *UserService
+	eventService    *EventService
+}
+
+func NewProxyAuthService(db *database.DB, settingsService *SettingsService, userService *UserService, eventService *EventService) *ProxyAuthService {
+	return &ProxyAuthService{
+		db:              db,
+		settingsService: settingsService,
+		userService:     userService,
+		eventService:    eventService,
+	}
+}
+
+// GetConfig returns the proxy configuration with default header names applied.
+func (s *ProxyAuthService) GetConfig(ctx context.Context) (*models.ProxyAuthConfig, error) {
+	settings, err := s.settingsService.GetSettings(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get settings: %w", err)
+	}
+	if !settings.AuthProxyEnabled.IsTrue() {
+		return nil, ErrProxyAuthDisabled
+	}
+
+	var cfg models.ProxyAuthConfig
+	if err := json.Unmarshal([]byte(settings.AuthProxyConfig.Value), &cfg); err != nil {
+		return nil, fmt.Errorf("invalid proxy auth config: %w", err)
+	}
+	if cfg.UserHeader == "" {
+		cfg.UserHeader = "Remote-User"
+	}
+	if cfg.EmailHeader == "" {
+		cfg.EmailHeader = "Remote-Email"
+	}
+	if cfg.NameHeader == "" {
+		cfg.NameHeader = "Remote-Name"
+	}
+	if cfg.GroupsHeader == "" {
+		cfg.GroupsHeader = "Remote-Groups"
+	}
+	if cfg.GroupSeparator == "" {
+		cfg.GroupSeparator = ","
+	}
+	return &cfg, nil
+}
+
+// Authenticate returns the user named in the proxy headers. remoteAddr must be the address of
+// the direct peer, not one derived from X-Forwarded-For. It returns a nil user and no error when
+// proxy authentication is off, the peer is not a trusted proxy or no user header is present, so
+// the caller can fall back to other authentication.
+func (s *ProxyAuthService) Authenticate(ctx context.Context, remoteAddr string, header http.Header) (*models.User, error) {
+	cfg, err := s.GetConfig(ctx)
+	if errors.Is(err, ErrProxyAuthDisabled) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	username := strings.TrimSpace(header.Get(cfg.UserHeader))
+	if username == "" {
+		return nil, nil
+	}
+	if !proxyTrusted(cfg.TrustedProxies, remoteAddr) {
+		slog.WarnContext(ctx, "Ignoring proxy authentication headers from untrusted peer", "peer", remoteAddr, "header", cfg.UserHeader)
+		return nil, nil
+	}
+
+	email := strings.TrimSpace(header.Get(cfg.EmailHeader))
+	name := strings.TrimSpace(header.Get(cfg.NameHeader))
+	var groups []string
+	for _, g := range strings.Split(header.Get(cfg.GroupsHeader), cfg.GroupSeparator) {
+		if g = strings.TrimSpace(g); g != "" {
+			groups = append(groups, g)
+		}
+	}
+
+	user, err := s.userService.GetUserByUsername(ctx, username)
+	switch {
+	case err == nil:
+		// Never take over an account that signs in another way, such as the local admin, by
+		// username alone: its roles would be rewritten from the groups header.
+		if !proxyUserAccount(user) {
+			return nil, ErrUsernameTaken
+		}
+		if err := s.updateProxyUser(ctx, cfg, user, email, name, groups); err != nil {
+			return nil, err
+		}
+	case errors.Is(err, ErrUserNotFound):
+		if !cfg.AutoProvision {
+			return nil, ErrProxyUserNotProvisioned
+		}
+		if user, err = s.createProxyUser(ctx, cfg, username, email, name, groups); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	if user.LastLogin == nil || time.Since(*user.LastLogin) > proxyLoginInterval {
+		s.recordLogin(ctx, user)
+	}
+	return user, nil
+}
+
+// MapRoles returns the roles a proxy user should hold. Without group mappings the current roles
+// are kept; with them the result is rebuilt from the groups header alone.
+func (s *ProxyAuthService) MapRoles(cfg *models.ProxyAuthConfig, current models.StringSlice, groups []string) models.StringSlice {
+	if len(cfg.GroupMappings) == 0 {
+		if len(current) == 0 {
+			return models.StringSlice{models.RoleUser}
+		}
+		return current
+	}
+
+	roles := models.StringSlice{models.RoleUser}
+	for _, mapping := range cfg.GroupMappings {
+		if mapping.Role == "" {
+			continue
+		}
+		if slices.ContainsFunc(groups, func(g string) bool { return strings.EqualFold(g, mapping.Group) }) {
+			roles = addRole(roles, mapping.Role)
+		}
+	}
+	return roles
+}
+
+func (s *ProxyAuthService) createProxyUser(ctx context.Context, cfg *models.ProxyAuthConfig, username, email, name string, groups []string) (*models.User, error) {
+	if name == "" {
+		name = username
+	}
+	user := &models.User{
+		BaseModel:   models.BaseModel{ID: uuid.NewString()},
+		Username:    username,
+		DisplayName: &name,
+		Roles:       s.MapRoles(cfg, nil, groups),
+	}
+	if email != "" {
+		user.Email = &email
+	}
+	if _, err := s.userService.CreateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "Provisioned user from proxy authentication", "username", username, "roles", user.Roles)
+	return user, nil
+}
+
+// proxyUserAccount reports whether proxy authentication may sign in as user: the account has no
+// password, OIDC or LDAP identity, as is the case for accounts it provisioned itself.
+func proxyUserAccount(user *models.User) bool {
+	return user.PasswordHash == "" && user.OidcSubjectId == nil && user.LdapId == nil
+}
+
+// updateProxyUser syncs profile fields and roles. The headers arrive on every request, so only
+// changed columns are written, and only when something changed.
+func (s *ProxyAuthService) updateProxyUser(ctx context.Context, cfg *models.ProxyAuthConfig, user *models.User, email, name string, groups []string) error {
+	updates := map[string]interface{}{}
+	if email != "" && (user.Email == nil || *user.Email != email) {
+		user.Email = &email
+		updates["email"] = email
+	}
+	if name != "" && (user.DisplayName == nil || *user.DisplayName != name) {
+		user.DisplayName = &name
+		updates["display_name"] = name
+	}
+	if roles := s.MapRoles(cfg, user.Roles, groups); !slices.Equal(roles, user.Roles) {
+		user.Roles = roles
+		updates["roles"] = roles
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	if err := s.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", user.ID).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to update proxy user: %w", err)
+	}
+	return nil
+}
+
+func (s *ProxyAuthService) recordLogin(ctx context.Context, user *models.User) {
+	now := time.Now()
+	user.LastLogin = &now
+	if err := s.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", user.ID).Update("last_login", now).Error; err != nil {
+		slog.WarnContext(ctx, "Failed to update last login for proxy user", "username", user.Username, "error", err)
+	}
+	if s.eventService != nil {
+		metadata := models.JSON{"action": "login", "method": "proxy"}
+		if err := s.eventService.LogUserEvent(ctx, models.EventTypeUserLogin, user.ID, user.Username, metadata); err != nil {
+			slog.WarnContext(ctx, "Could not log proxy login", "username", user.Username, "error", err)
+		}
+	}
+}
+
+// proxyTrusted reports whether addr, a host or host:port, falls within one of the trusted
+// addresses or CIDRs.
+func proxyTrusted(trusted []string, addr string) bool {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		addrPort, err := netip.ParseAddrPort(addr)
+		if err != nil {
+			return false
+		}
+		ip = addrPort.Addr()
+	}
+	ip = ip.Unmap()
+
+	for _, entry := range trusted {
+		entry = strings.TrimSpace(entry)
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			if prefix.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if trustedIP, err := netip.ParseAddr(entry); err == nil && trustedIP.Unmap() == ip {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	glsqlite "github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/models"
+)
+
+func setupProxyAuthTest(t *testing.T, cfg models.ProxyAuthConfig) (*ProxyAuthService, *UserService, *database.DB) {
+	t.Helper()
+	ctx := context.Background()
+	gdb, err := gorm.Open(glsqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, gdb.AutoMigrate(&models.User{}, &models.SettingVariable{}, &models.Event{}))
+	db := &database.DB{DB: gdb}
+
+	settingsService, err := NewSettingsService(ctx, db)
+	require.NoError(t, err)
+	require.NoError(t, settingsService.EnsureDefaultSettings(ctx))
+	raw, err := json.Marshal(cfg)
+	require.NoError(t, err)
+	require.NoError(t, settingsService.SetStringSetting(ctx, "authProxyConfig", string(raw)))
+	require.NoError(t, settingsService.SetBoolSetting(ctx, "authProxyEnabled", true))
+
+	userService := NewUserService(db)
+	return NewProxyAuthService(db, settingsService, userService, NewEventService(db)), userService, db
+}
+
+func proxyHeaders(user, email, groups string) http.Header {
+	h := http.Header{}
+	h.Set("Remote-User", user)
+	h.Set("Remote-Email", email)
+	h.Set("Remote-Groups", groups)
+	return h
+}
+
+func TestProxyAuthService_ProvisionsAndMapsGroups(t *testing.T) {
+	proxyAuth, userService, db := setupProxyAuthTest(t, models.ProxyAuthConfig{
+		TrustedProxies: []string{"10.0.0.0/24", "::1"},
+		AutoProvision:  true,
+		GroupMappings: []models.ProxyGroupMapping{
+			{Group: "arcane-admins", Role: models.RoleAdmin},
+			{Group: "deployers", Role: models.RoleDeployer},
+		},
+	})
+	ctx := context.Background()
+
+	user, err := proxyAuth.Authenticate(ctx, "10.0.0.5", proxyHeaders("mia", "mia@example.com", "staff, Deployers"))
+	require.NoError(t, err)
+	require.NotNil(t, user)
+	require.Equal(t, models.StringSlice{models.RoleUser, models.RoleDeployer}, user.Roles)
+	require.Equal(t, "mia@example.com", *user.Email)
+	require.NotNil(t, user.LastLogin)
+
+	var logins int64
+	require.NoError(t, db.Model(&models.Event{}).Where("type = ?", models.EventTypeUserLogin).Count(&logins).Error)
+	require.EqualValues(t, 1, logins)
+
+	// Group changes at the identity provider are picked up on the next request.
+	user, err = proxyAuth.Authenticate(ctx, "::1", proxyHeaders("mia", "mia@example.com", "arcane-admins"))
+	require.NoError(t, err)
+	require.Equal(t, models.StringSlice{models.RoleUser, models.RoleAdmin}, user.Roles)
+	stored, err := userService.GetUserByUsername(ctx, "mia")
+	require.NoError(t, err)
+	require.Equal(t, models.StringSlice{models.RoleUser, models.RoleAdmin}, stored.Roles)
+
+	// Only one login event per interval, not one per request.
+	require.NoError(t, db.Model(&models.Event{}).Where("type = ?", models.EventTypeUserLogin).Count(&logins).Error)
+	require.EqualValues(t, 1, logins)
+}
+
+func TestProxyAuthService_IgnoresUntrustedPeers(t *testing.T) {
+	proxyAuth, _, db := setupProxyAuthTest(t, models.ProxyAuthConfig{
+		TrustedProxies: []string{"10.0.0.1"},
+		AutoProvision:  true,
+	})
+	ctx := context.Background()
+
+	user, err := proxyAuth.Authenticate(ctx, "192.0.2.66", proxyHeaders("admin", "", ""))
+	require.NoError(t, err)
+	require.Nil(t, user)
+
+	// Requests without the user header fall through to token authentication.
+	user, err = proxyAuth.Authenticate(ctx, "10.0.0.1", http.Header{})
+	require.NoError(t, err)
+	require.Nil(t, user)
+
+	var count int64
+	require.NoError(t, db.Model(&models.User{}).Count(&count).Error)
+	require.Zero(t, count)
+}
+
+func TestProxyAuthService_RequiresProvisioningWhenDisabled(t *testing.T) {
+	proxyAuth, userService, _ := setupProxyAuthTest(t, models.ProxyAuthConfig{
+		TrustedProxies: []string{"10.0.0.1"},
+	})
+	ctx := context.Background()
+
+	_, err := proxyAuth.Authenticate(ctx, "10.0.0.1", proxyHeaders("nora", "", ""))
+	require.ErrorIs(t, err, ErrProxyUserNotProvisioned)
+
+	// Existing accounts keep their roles when no group mappings are configured.
+	_, err = userService.CreateUser(ctx, &models.User{Username: "nora", Roles: models.StringSlice{models.RoleOperator}})
+	require.NoError(t, err)
+	user, err := proxyAuth.Authenticate(ctx, "10.0.0.1:51234", proxyHeaders("nora", "", "anything"))
+	require.NoError(t, err)
+	require.Equal(t, models.StringSlice{models.RoleOperator}, user.Roles)
+}
+
+func TestProxyAuthService_RefusesAccountsWithOtherSignIns(t *testing.T) {
+	proxyAuth, userService, _ := setupProxyAuthTest(t, models.ProxyAuthConfig{
+		TrustedProxies: []string{"10.0.0.1"},
+		AutoProvision:  true,
+		GroupMappings:  []models.ProxyGroupMapping{{Group: "deployers", Role: models.RoleDeployer}},
+	})
+	ctx := context.Background()
+
+	_, err := userService.CreateUserWithPassword("arcane", "correct-horse", "arcane@example.com", models.RoleAdmin, "Arcane")
+	require.NoError(t, err)
+	ldapID := "entry-1"
+	_, err = userService.CreateUser(ctx, &models.User{Username: "lee", LdapId: &ldapID, Roles: models.StringSlice{models.RoleOperator}})
+	require.NoError(t, err)
+	subject := "oidc-1"
+	_, err = userService.CreateUser(ctx, &models.User{Username: "olu", OidcSubjectId: &subject, Roles: models.StringSlice{models.RoleOperator}})
+	require.NoError(t, err)
+
+	for _, username := range []string{"arcane", "lee", "olu"} {
+		_, err = proxyAuth.Authenticate(ctx, "10.0.0.1", proxyHeaders(username, "", "deployers"))
+		require.ErrorIs(t, err, ErrUsernameTaken, username)
+	}
+	admin, err := userService.GetUserByUsername(ctx, "arcane")
+	require.NoError(t, err)
+	require.Equal(t, models.StringSlice{models.RoleAdmin}, admin.Roles, "the local admin keeps its roles")
+}
+
+func TestProxyTrusted(t *testing.T) {
+	trusted := []string{"172.16.0.0/12", "192.0.2.10", "fd00::/8"}
+	require.True(t, proxyTrusted(trusted, "172.20.1.1"))
+	require.True(t, proxyTrusted(trusted, "192.0.2.10:443"))
+	require.True(t, proxyTrusted(trusted, "::ffff:192.0.2.10"))
+	require.True(t, proxyTrusted(trusted, "fd12::1"))
+	require.False(t, proxyTrusted(trusted, "192.0.2.11"))
+	require.False(t, proxyTrusted(trusted, "not-an-ip"))
+	require.False(t, proxyTrusted(nil, "127.0.0.1"))
+}
@@ -0,0 +1,306 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/dto"
+	"github.com/ofkm/arcane-backend/internal/models"
+)
+
+var (
+	ErrRoleNotFound      = errors.New("role not found")
+	ErrRoleBuiltin       = errors.New("built-in roles cannot be modified")
+	ErrRoleAlreadyExists = errors.New("role already exists")
+	// ErrPermissionEscalation is returned when a caller tries to grant a permission they do not hold.
+	ErrPermissionEscalation = errors.New("cannot grant a permission you do not hold")
+)
+
+type RoleService struct {
+	db *database.DB
+}
+
+func NewRoleService(db *database.DB) *RoleService {
+	return &RoleService{db: db}
+}
+
+// ResolvePermissions returns the union of the permissions granted by the given role names.
+// Unknown role names are ignored so a deleted custom role simply stops granting anything.
+func (s *RoleService) ResolvePermissions(ctx context.Context, roleNames []string) ([]models.Permission, error) {
+	var perms []models.Permission
+	var custom []string
+
+	for _, name := range roleNames {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if builtin, ok := models.BuiltinRoles[name]; ok {
+			perms = appendPermissions(perms, builtin...)
+			continue
+		}
+		custom = append(custom, name)
+	}
+
+	if len(custom) == 0 || s.db == nil {
+		return perms, nil
+	}
+
+	var roles []models.Role
+	if err := s.db.WithContext(ctx).Where("name IN ?", custom).Find(&roles).Error; err != nil {
+		return nil, fmt.Errorf("failed to load roles: %w", err)
+	}
+	for _, r := range roles {
+		for _, p := range r.Permissions {
+			perms = appendPermissions(perms, models.Permission(p))
+		}
+	}
+
+	return perms, nil
+}
+
+func appendPermissions(dst []models.Permission, perms ...models.Permission) []models.Permission {
+	for _, p := range perms {
+		if !slices.Contains(dst, p) {
+			dst = append(dst, p)
+		}
+	}
+	return dst
+}
+
+// ListRoles returns the built-in roles followed by all custom roles.
+func (s *RoleService) ListRoles(ctx context.Context) ([]dto.RoleDto, error) {
+	builtinNames := make([]string, 0, len(models.BuiltinRoles))
+	for name := range models.BuiltinRoles {
+		builtinNames = append(builtinNames, name)
+	}
+	sort.Strings(builtinNames)
+
+	out := make([]dto.RoleDto, 0, len(builtinNames))
+	for _, name := range builtinNames {
+		out = append(out, builtinRoleDto(name))
+	}
+
+	var roles []models.Role
+	if err := s.db.WithContext(ctx).Order("name ASC").Find(&roles).Error; err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	for _, r := range roles {
+		out = append(out, toRoleDto(r))
+	}
+
+	return out, nil
+}
+
+func (s *RoleService) GetRole(ctx context.Context, name string) (*dto.RoleDto, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if models.IsBuiltinRole(name) {
+		out := builtinRoleDto(name)
+		return &out, nil
+	}
+
+	role, err := s.getCustomRole(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	out := toRoleDto(*role)
+	return &out, nil
+}
+
+// CreateRole creates a custom role. granted holds the caller's permissions, which must cover
+// every permission the role grants.
+func (s *RoleService) CreateRole(ctx context.Context, req dto.CreateRoleDto, granted []models.Permission) (*dto.RoleDto, error) {
+	name := strings.ToLower(strings.TrimSpace(req.Name))
+	if name == "" {
+		return nil, &models.ValidationError{Field: "name", Message: "Role name is required"}
+	}
+	if models.IsBuiltinRole(name) {
+		return nil, ErrRoleAlreadyExists
+	}
+	if _, err := s.getCustomRole(ctx, name); err == nil {
+		return nil, ErrRoleAlreadyExists
+	}
+
+	perms, err := validatePermissions(req.Permissions)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkGrantable(granted, nil, perms); err != nil {
+		return nil, err
+	}
+
+	role := &models.Role{
+		Name:        name,
+		Description: req.Description,
+		Permissions: perms,
+	}
+	if err := s.db.WithContext(ctx).Create(role).Error; err != nil {
+		return nil, fmt.Errorf("failed to create role: %w", err)
+	}
+
+	out := toRoleDto(*role)
+	return &out, nil
+}
+
+// UpdateRole changes a custom role. granted holds the caller's permissions, which must cover
+// every permission added to the role.
+func (s *RoleService) UpdateRole(ctx context.Context, name string, req dto.UpdateRoleDto, granted []models.Permission) (*dto.RoleDto, error) {
+	if models.IsBuiltinRole(name) {
+		return nil, ErrRoleBuiltin
+	}
+
+	role, err := s.getCustomRole(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Description != nil {
+		role.Description = req.Description
+	}
+	if req.Permissions != nil {
+		perms, err := validatePermissions(req.Permissions)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkGrantable(granted, role.Permissions, perms); err != nil {
+			return nil, err
+		}
+		role.Permissions = perms
+	}
+
+	if err := s.db.WithContext(ctx).Save(role).Error; err != nil {
+		return nil, fmt.Errorf("failed to update role: %w", err)
+	}
+
+	out := toRoleDto(*role)
+	return &out, nil
+}
+
+func (s *RoleService) DeleteRole(ctx context.Context, name string) error {
+	if models.IsBuiltinRole(name) {
+		return ErrRoleBuiltin
+	}
+
+	role, err := s.getCustomRole(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.WithContext(ctx).Delete(role).Error; err != nil {
+		return fmt.Errorf("failed to delete role: %w", err)
+	}
+	return nil
+}
+
+// ValidateRoleNames ensures every name refers to a built-in or existing custom role.
+func (s *RoleService) ValidateRoleNames(ctx context.Context, names []string) error {
+	for _, name := range names {
+		if models.IsBuiltinRole(name) {
+			continue
+		}
+		if _, err := s.getCustomRole(ctx, name); err != nil {
+			if errors.Is(err, ErrRoleNotFound) {
+				return &models.ValidationError{Field: "roles", Message: fmt.Sprintf("Unknown role '%s'", name)}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckRoleAssignment returns ErrPermissionEscalation unless granted, the caller's permissions,
+// covers every permission conferred by the roles in requested that current does not hold yet.
+func (s *RoleService) CheckRoleAssignment(ctx context.Context, granted []models.Permission, current, requested []string) error {
+	var added []string
+	for _, name := range requested {
+		if !hasRole(current, name) {
+			added = append(added, name)
+		}
+	}
+	if len(added) == 0 {
+		return nil
+	}
+
+	perms, err := s.ResolvePermissions(ctx, added)
+	if err != nil {
+		return err
+	}
+	for _, p := range perms {
+		if !models.HasPermission(granted, p) {
+			return fmt.Errorf("%w: %s", ErrPermissionEscalation, p)
+		}
+	}
+	return nil
+}
+
+func (s *RoleService) getCustomRole(ctx context.Context, name string) (*models.Role, error) {
+	var role models.Role
+	if err := s.db.WithContext(ctx).Where("name = ?", strings.ToLower(strings.TrimSpace(name))).First(&role).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, fmt.Errorf("failed to get role: %w", err)
+	}
+	return &role, nil
+}
+
+func validatePermissions(perms []string) (models.StringSlice, error) {
+	out := make(models.StringSlice, 0, len(perms))
+	for _, p := range perms {
+		p = strings.TrimSpace(p)
+		if !models.Permission(p).IsKnown() {
+			return nil, &models.ValidationError{Field: "permissions", Message: fmt.Sprintf("Unknown permission '%s'", p)}
+		}
+		if !slices.Contains(out, p) {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+// checkGrantable returns ErrPermissionEscalation when perms adds a permission to current that
+// granted does not cover. Wildcards are only grantable by callers holding them.
+func checkGrantable(granted []models.Permission, current, perms models.StringSlice) error {
+	for _, p := range perms {
+		if slices.Contains(current, p) {
+			continue
+		}
+		if !models.HasPermission(granted, models.Permission(p)) {
+			return fmt.Errorf("%w: %s", ErrPermissionEscalation, p)
+		}
+	}
+	return nil
+}
+
+func builtinRoleDto(name string) dto.RoleDto {
+	perms := models.BuiltinRoles[name]
+	out := dto.RoleDto{
+		Name:        name,
+		Permissions: make([]string, len(perms)),
+		Builtin:     true,
+	}
+	for i, p := range perms {
+		out.Permissions[i] = string(p)
+	}
+	return out
+}
+
+func toRoleDto(role models.Role) dto.RoleDto {
+	perms := []string(role.Permissions)
+	if perms == nil {
+		perms = []string{}
+	}
+	return dto.RoleDto{
+		ID:          role.ID,
+		Name:        role.Name,
+		Description: role.Description,
+		Permissions: perms,
+	}
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	glsqlite "github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/dto"
+	"github.com/ofkm/arcane-backend/internal/models"
+)
+
+func setupRoleTestDB(t *testing.T) *database.DB {
+	t.Helper()
+	db, err := gorm.Open(glsqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Role{}))
+	return &database.DB{DB: db}
+}
+
+func TestPermission_Grants(t *testing.T) {
+	require.True(t, models.PermissionAll.Grants(models.PermissionUsersManage))
+	require.True(t, models.Permission("containers:*").Grants(models.PermissionContainersExec))
+	require.False(t, models.Permission("containers:*").Grants(models.PermissionImagesRead))
+	require.True(t, models.PermissionContainersRead.Grants(models.PermissionContainersRead))
+	require.False(t, models.PermissionContainersRead.Grants(models.PermissionContainersExec))
+}
+
+func TestRoleService_ResolvePermissions(t *testing.T) {
+	ctx := context.Background()
+	svc := NewRoleService(setupRoleTestDB(t))
+
+	_, err := svc.CreateRole(ctx, dto.CreateRoleDto{
+		Name:        "Auditor",
+		Permissions: []string{"events:read", "users:read"},
+	}, []models.Permission{models.PermissionAll})
+	require.NoError(t, err)
+
+	perms, err := svc.ResolvePermissions(ctx, []string{models.RoleViewer, "auditor", "missing"})
+	require.NoError(t, err)
+	require.True(t, models.HasPermission(perms, models.PermissionContainersRead))
+	require.True(t, models.HasPermission(perms, models.PermissionEventsRead))
+	require.False(t, models.HasPermission(perms, models.PermissionContainersExec))
+
+	perms, err = svc.ResolvePermissions(ctx, []string{models.RoleUser})
+	require.NoError(t, err)
+	require.True(t, models.HasPermission(perms, models.PermissionContainersExec))
+	require.False(t, models.HasPermission(perms, models.PermissionUsersManage))
+}
+
+func TestRoleService_BuiltinRolesAreProtected(t *testing.T) {
+	ctx := context.Background()
+	svc := NewRoleService(setupRoleTestDB(t))
+
+	_, err := svc.CreateRole(ctx, dto.CreateRoleDto{Name: "admin", Permissions: []string{"*"}}, []models.Permission{models.PermissionAll})
+	require.ErrorIs(t, err, ErrRoleAlreadyExists)
+
+	_, err = svc.UpdateRole(ctx, models.RoleViewer, dto.UpdateRoleDto{Permissions: []string{"*"}}, []models.Permission{models.PermissionAll})
+	require.ErrorIs(t, err, ErrRoleBuiltin)
+
+	require.ErrorIs(t, svc.DeleteRole(ctx, models.RoleOperator), ErrRoleBuiltin)
+}
+
+func TestRoleService_RejectsUnknownPermissionsAndRoles(t *testing.T) {
+	ctx := context.Background()
+	svc := NewRoleService(setupRoleTestDB(t))
+
+	_, err := svc.CreateRole(ctx, dto.CreateRoleDto{Name: "broken", Permissions: []string{"containers:fly"}}, []models.Permission{models.PermissionAll})
+	var validationErr *models.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	require.Equal(t, "permissions", validationErr.Field)
+
+	require.NoError(t, svc.ValidateRoleNames(ctx, []string{models.RoleAdmin, models.RoleDeployer}))
+	require.ErrorAs(t, svc.ValidateRoleNames(ctx, []string{"nope"}), &validationErr)
+}
+
+func TestRoleService_RefusesPermissionEscalation(t *testing.T) {
+	ctx := context.Background()
+	svc := NewRoleService(setupRoleTestDB(t))
+	operator := []models.Permission{models.PermissionRolesManage, models.PermissionUsersManage, "containers:*"}
+
+	for _, perms := range [][]string{{"*"}, {"users:*"}, {"containers:read", "images:pull"}} {
+		_, err := svc.CreateRole(ctx, dto.CreateRoleDto{Name: "escalate", Permissions: perms}, operator)
+		require.ErrorIs(t, err, ErrPermissionEscalation, perms)
+	}
+
+	_, err := svc.CreateRole(ctx, dto.CreateRoleDto{Name: "runner", Permissions: []string{"containers:*", "users:manage"}}, operator)
+	require.NoError(t, err)
+	_, err = svc.UpdateRole(ctx, "runner", dto.UpdateRoleDto{Permissions: []string{"containers:start", "*"}}, operator)
+	require.ErrorIs(t, err, ErrPermissionEscalation)
+
+	// Permissions the role already grants can be kept by callers who lack them.
+	_, err = svc.CreateRole(ctx, dto.CreateRoleDto{Name: "auditor", Permissions: []string{"audit:read", "events:read"}}, []models.Permission{models.PermissionAll})
+	require.NoError(t, err)
+	_, err = svc.UpdateRole(ctx, "auditor", dto.UpdateRoleDto{Permissions: []string{"audit:read"}}, operator)
+	require.NoError(t, err)
+
+	// Role assignment: only roles the user does not hold yet are checked.
+	require.ErrorIs(t, svc.CheckRoleAssignment(ctx, operator, nil, []string{models.RoleAdmin}), ErrPermissionEscalation)
+	require.ErrorIs(t, svc.CheckRoleAssignment(ctx, operator, []string{models.RoleViewer}, []string{models.RoleViewer, "Admin"}), ErrPermissionEscalation)
+	require.ErrorIs(t, svc.CheckRoleAssignment(ctx, operator, nil, []string{"auditor"}), ErrPermissionEscalation)
+	require.NoError(t, svc.CheckRoleAssignment(ctx, operator, nil, []string{"runner"}))
+	require.NoError(t, svc.CheckRoleAssignment(ctx, operator, []string{models.RoleAdmin}, []string{models.RoleAdmin}))
+	require.NoError(t, svc.CheckRoleAssignment(ctx, []models.Permission{models.PermissionAll}, nil, []string{models.RoleAdmin}))
+}
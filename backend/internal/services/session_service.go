@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/dto"
+	"github.com/ofkm/arcane-backend/internal/models"
+)
+
+// sessionTouchInterval limits how often last_seen_at is written for an active session.
+const sessionTouchInterval = time.Minute
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionRevoked  = errors.New("session has been revoked")
+)
+
+type clientInfoKey struct{}
+
+// ClientInfo describes the client a login request came from; it is recorded on new sessions.
+type ClientInfo struct {
+	UserAgent string
+	IPAddress string
+}
+
+// WithClientInfo attaches the requesting client to ctx so the login that follows can record it.
+func WithClientInfo(ctx context.Context, info ClientInfo) context.Context {
+	return context.WithValue(ctx, clientInfoKey{}, info)
+}
+
+func clientInfoFromContext(ctx context.Context) ClientInfo {
+	info, _ := ctx.Value(clientInfoKey{}).(ClientInfo)
+	return info
+}
+
+type SessionService struct {
+	db *database.DB
+}
+
+func NewSessionService(db *database.DB) *SessionService {
+	return &SessionService{db: db}
+}
+
+// CreateSession records a new login session. Expired sessions are pruned at the same time so
+// the table does not need a separate cleanup job.
+func (s *SessionService) CreateSession(ctx context.Context, userID, method string, expiresAt time.Time) (*models.Session, error) {
+	now := time.Now()
+	if err := s.db.WithContext(ctx).Where("expires_at < ?", now).Delete(&models.Session{}).Error; err != nil {
+		slog.WarnContext(ctx, "Failed to prune expired sessions", "error", err)
+	}
+
+	info := clientInfoFromContext(ctx)
+	session := &models.Session{
+		UserID:     userID,
+		UserAgent:  truncateString(info.UserAgent, 512),
+		IPAddress:  info.IPAddress,
+		Method:     method,
+		LastSeenAt: now,
+		ExpiresAt:  expiresAt,
+	}
+	if err := s.db.WithContext(ctx).Create(session).Error; err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	return session, nil
+}
+
+// ValidateSession returns the session when it exists, belongs to userID and has not expired,
+// and records that it was seen.
+func (s *SessionService) ValidateSession(ctx context.Context, sessionID, userID string) (*models.Session, error) {
+	var session models.Session
+	if err := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", sessionID, userID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionRevoked
+		}
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+
+	now := time.Now()
+	if session.IsExpired(now) {
+		return nil, ErrSessionRevoked
+	}
+
+	if now.Sub(session.LastSeenAt) >= sessionTouchInterval {
+		updates := map[string]interface{}{"last_seen_at": now}
+		if ip := clientInfoFromContext(ctx).IPAddress; ip != "" {
+			updates["ip_address"] = ip
+		}
+		if err := s.db.WithContext(ctx).Model(&models.Session{}).Where("id = ?", session.ID).Updates(updates).Error; err != nil {
+			slog.WarnContext(ctx, "Failed to update session last seen", "session", session.ID, "error", err)
+		}
+		session.LastSeenAt = now
+	}
+	return &session, nil
+}
+
+// GetSession returns a session of userID, expired or not.
+func (s *SessionService) GetSession(ctx context.Context, userID, sessionID string) (*models.Session, error) {
+	var session models.Session
+	if err := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", sessionID, userID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+	return &session, nil
+}
+
+// ExtendSession slides the expiry of a session forward when its refresh token is used.
+func (s *SessionService) ExtendSession(ctx context.Context, sessionID string, expiresAt time.Time) error {
+	if err := s.db.WithContext(ctx).Model(&models.Session{}).Where("id = ?", sessionID).
+		Updates(map[string]interface{}{"expires_at": expiresAt, "last_seen_at": time.Now()}).Error; err != nil {
+		return fmt.Errorf("failed to extend session: %w", err)
+	}
+	return nil
+}
+
+func (s *SessionService) ListSessions(ctx context.Context, userID, currentSessionID string) ([]dto.SessionDto, error) {
+	var sessions []models.Session
+	if err := s.db.WithContext(ctx).
+		Where("user_id = ? AND expires_at >= ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error; err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	out := make([]dto.SessionDto, 0, len(sessions))
+	for _, session := range sessions {
+		out = append(out, dto.SessionDto{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IPAddress,
+			Method:     session.Method,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.ID == currentSessionID,
+		})
+	}
+	return out, nil
+}
+
+func (s *SessionService) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	res := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", sessionID, userID).Delete(&models.Session{})
+	if res.Error != nil {
+		return fmt.Errorf("failed to revoke session: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeUserSessions deletes every session of a user except exceptSessionID, which may be empty.
+// It returns how many sessions were revoked.
+func (s *SessionService) RevokeUserSessions(ctx context.Context, userID, exceptSessionID string) (int64, error) {
+	query := s.db.WithContext(ctx).Where("user_id = ?", userID)
+	if exceptSessionID != "" {
+		query = query.Where("id <> ?", exceptSessionID)
+	}
+	res := query.Delete(&models.Session{})
+	if res.Error != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", res.Error)
+	}
+	return res.RowsAffected, nil
+}
+
+func truncateString(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	return s[:limit]
+}
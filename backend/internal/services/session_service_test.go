@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	glsqlite "github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/ofkm/arcane-backend/internal/config"
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/models"
+)
+
+func setupSessionTestAuth(t *testing.T) (*AuthService, *SessionService, *UserService) {
+	t.Helper()
+	ctx := context.Background()
+	gdb, err := gorm.Open(glsqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, gdb.AutoMigrate(&models.User{}, &models.Session{}, &models.SettingVariable{}, &models.Event{}))
+	db := &database.DB{DB: gdb}
+
+	settingsService, err := NewSettingsService(ctx, db)
+	require.NoError(t, err)
+	require.NoError(t, settingsService.EnsureDefaultSettings(ctx))
+	userService := NewUserService(db)
+	sessionService := NewSessionService(db)
+	authService := NewAuthService(userService, settingsService, NewEventService(db), nil, nil, sessionService, nil, nil, newTestJwtKeyService(t, db, settingsService), &config.Config{})
+	return authService, sessionService, userService
+}
+
+func TestAuthService_SessionsCanBeRevoked(t *testing.T) {
+	authService, sessionService, userService := setupSessionTestAuth(t)
+
+	user, err := userService.CreateUserWithPassword("carol", "correct-horse", "carol@example.com", models.RoleUser, "Carol")
+	require.NoError(t, err)
+
+	ctx := WithClientInfo(context.Background(), ClientInfo{UserAgent: "curl/8.0", IPAddress: "192.0.2.10"})
+	_, tokens, err := authService.Login(ctx, "carol", "correct-horse")
+	require.NoError(t, err)
+
+	_, sessionID, err := authService.VerifyTokenSession(ctx, tokens.AccessToken)
+	require.NoError(t, err)
+
+	sessions, err := sessionService.ListSessions(ctx, user.ID, sessionID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	require.True(t, sessions[0].Current)
+	require.Equal(t, "curl/8.0", sessions[0].UserAgent)
+	require.Equal(t, "192.0.2.10", sessions[0].IPAddress)
+
+	refreshed, err := authService.RefreshToken(ctx, tokens.RefreshToken)
+	require.NoError(t, err)
+
+	require.NoError(t, sessionService.RevokeSession(ctx, user.ID, sessionID))
+	_, err = authService.VerifyToken(ctx, refreshed.AccessToken)
+	require.ErrorIs(t, err, ErrInvalidToken)
+	_, err = authService.RefreshToken(ctx, tokens.RefreshToken)
+	require.ErrorIs(t, err, ErrInvalidToken)
+	require.ErrorIs(t, sessionService.RevokeSession(ctx, user.ID, sessionID), ErrSessionNotFound)
+}
+
+func TestAuthService_PasswordChangeRevokesOtherSessions(t *testing.T) {
+	authService, _, userService := setupSessionTestAuth(t)
+	ctx := context.Background()
+
+	user, err := userService.CreateUserWithPassword("dave", "correct-horse", "dave@example.com", models.RoleUser, "Dave")
+	require.NoError(t, err)
+
+	_, laptop, err := authService.Login(ctx, "dave", "correct-horse")
+	require.NoError(t, err)
+	_, phone, err := authService.Login(ctx, "dave", "correct-horse")
+	require.NoError(t, err)
+
+	_, laptopSession, err := authService.VerifyTokenSession(ctx, laptop.AccessToken)
+	require.NoError(t, err)
+
+	require.NoError(t, authService.ChangePassword(ctx, user.ID, laptopSession, "correct-horse", "battery-staple"))
+
+	_, err = authService.VerifyToken(ctx, laptop.AccessToken)
+	require.NoError(t, err)
+	_, err = authService.VerifyToken(ctx, phone.AccessToken)
+	require.ErrorIs(t, err, ErrInvalidToken)
+}
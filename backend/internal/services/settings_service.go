@@ -89,10 +89,22 @@ func (s *SettingsService) getDefaultSettings() *models.Settings {
 		DockerHost:                 models.SettingVariable{Value: "unix:///var/run/docker.sock"},
 		AuthLocalEnabled:           models.SettingVariable{Value: "true"},
 		AuthOidcEnabled:            models.SettingVariable{Value: "false"},
+		AuthLdapEnabled:            models.SettingVariable{Value: "false"},
+		AuthProxyEnabled:           models.SettingVariable{Value: "false"},
 		AuthOidcMergeAccounts:      models.SettingVariable{Value: "false"},
 		AuthSessionTimeout:         models.SettingVariable{Value: "1440"},
 		AuthPasswordPolicy:         models.SettingVariable{Value: "strong"},
+		AuthPasswordHistory:        models.SettingVariable{Value: "5"},
+		AuthRequireTwoFactor:       models.SettingVariable{Value: "false"},
+		AuthJwtRotationInterval:    models.SettingVariable{Value: "30"},
+		AuthJwtGracePeriod:         models.SettingVariable{Value: "168"},
+		AuthLoginMaxAttempts:       models.SettingVariable{Value: "5"},
+		AuthLoginLockoutDuration:   models.SettingVariable{Value: "5"},
+		AuthLoginIpMaxAttempts:     models.SettingVariable{Value: "20"},
+		AuthLoginAttemptWindow:     models.SettingVariable{Value: "15"},
 		AuthOidcConfig:             models.SettingVariable{Value: "{}"},
+		AuthLdapConfig:             models.SettingVariable{Value: "{}"},
+		AuthProxyConfig:            models.SettingVariable{Value: "{}"},
 		OnboardingCompleted:        models.SettingVariable{Value: "false"},
 		OnboardingSteps:            models.SettingVariable{Value: "[]"},
 		MobileNavigationMode:       models.SettingVariable{Value: "floating"},
@@ -262,6 +274,11 @@ func (s *SettingsService) SyncOidcEnvToDatabase(ctx context.Context) ([]models.S
 		AdminClaim:   cfg.OidcAdminClaim,
 		AdminValue:   cfg.OidcAdminValue,
 	}
+	if cfg.OidcRoleMappings != "" {
+		if err := json.Unmarshal([]byte(cfg.OidcRoleMappings), &envOidc.RoleMappings); err != nil {
+			return nil, fmt.Errorf("invalid OIDC_ROLE_MAPPINGS: %w", err)
+		}
+	}
 	b, err := json.Marshal(envOidc)
 	if err != nil {
 		return nil, fmt.Errorf("marshal oidc config: %w", err)
@@ -399,6 +416,42 @@ func (s *SettingsService) UpdateSettings(ctx context.Context, updates dto.Update
 		}
 	}
 
+	// Merge LDAP config the same way so the bind password survives edits. The password is stored
+	// encrypted; the existing value already is.
+	if updates.AuthLdapConfig != nil {
+		var incoming models.LdapConfig
+		if err := json.Unmarshal([]byte(*updates.AuthLdapConfig), &incoming); err != nil {
+			return nil, fmt.Errorf("invalid authLdapConfig JSON: %w", err)
+		}
+
+		current, err := s.GetSettings(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load current settings: %w", err)
+		}
+
+		if incoming.BindPassword != "" {
+			encrypted, err := utils.Encrypt(incoming.BindPassword)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encrypt LDAP bind password: %w", err)
+			}
+			incoming.BindPassword = encrypted
+		} else if current.AuthLdapConfig.Value != "" {
+			var existing models.LdapConfig
+			if err := json.Unmarshal([]byte(current.AuthLdapConfig.Value), &existing); err == nil {
+				incoming.BindPassword = existing.BindPassword
+			}
+		}
+
+		mergedBytes, err := json.Marshal(incoming)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal merged LDAP config: %w", err)
+		}
+
+		if err := s.UpdateSetting(ctx, "authLdapConfig", string(mergedBytes)); err != nil {
+			return nil, fmt.Errorf("failed to update authLdapConfig: %w", err)
+		}
+	}
+
 	if changedPolling && s.OnImagePollingSettingsChanged != nil {
 		s.OnImagePollingSettingsChanged(ctx)
 	}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/utils/tunnel"
+)
+
+// TunnelBaseURL replaces the API URL of an environment reached through its agent tunnel. The
+// host is never resolved; every connection is a stream opened over the tunnel.
+const TunnelBaseURL = "http://agent.tunnel"
+
+// tunnelHeartbeatInterval is how often a connected tunnel refreshes its environment's last seen time.
+const tunnelHeartbeatInterval = 30 * time.Second
+
+var ErrTunnelUnauthorized = errors.New("invalid agent token")
+
+type agentTunnel struct {
+	session   *tunnel.Session
+	transport *http.Transport
+}
+
+// TunnelService tracks the tunnels agents hold open to the manager, for environments the
+// manager cannot reach directly.
+type TunnelService struct {
+	db                 *database.DB
+	environmentService *EnvironmentService
+
+	mu      sync.RWMutex
+	tunnels map[string]*agentTunnel
+}
+
+func NewTunnelService(db *database.DB, environmentService *EnvironmentService) *TunnelService {
+	s := &TunnelService{
+		db:                 db,
+		environmentService: environmentService,
+		tunnels:            make(map[string]*agentTunnel),
+	}
+	environmentService.tunnels = s
+	return s
+}
+
+// AuthenticateAgent returns the enabled environment whose access token is token. While the token
+// is being rotated the agent may still present the previous one.
+func (s *TunnelService) AuthenticateAgent(ctx context.Context, token string) (*models.Environment, error) {
+	if token == "" {
+		return nil, ErrTunnelUnauthorized
+	}
+	var env models.Environment
+	hash := hashAgentToken(token)
+	err := s.db.WithContext(ctx).
+		Where("(access_token_hash = ? OR previous_access_token_hash = ?) AND enabled = ?", hash, hash, true).
+		First(&env).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTunnelUnauthorized
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up environment: %w", err)
+	}
+	return &env, nil
+}
+
+// Serve makes sess the tunnel of env and blocks until it closes. A tunnel the agent already had
+// open is replaced.
+func (s *TunnelService) Serve(ctx context.Context, env *models.Environment, sess *tunnel.Session) {
+	t := &agentTunnel{
+		session: sess,
+		transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return sess.Open(ctx)
+			},
+			MaxIdleConnsPerHost: 16,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+
+	s.mu.Lock()
+	previous := s.tunnels[env.ID]
+	s.tunnels[env.ID] = t
+	s.mu.Unlock()
+	if previous != nil {
+		_ = previous.session.Close()
+	}
+
+	slog.InfoContext(ctx, "Agent tunnel connected", "environmentId", env.ID, "environment", env.Name, "remote", sess.RemoteAddr().String())
+	// The request context ends with the connection; status updates must outlive it.
+	statusCtx := context.WithoutCancel(ctx)
+	if err := s.environmentService.UpdateEnvironmentHeartbeat(statusCtx, env.ID); err != nil {
+		slog.WarnContext(ctx, "Failed to mark tunneled environment online", "environmentId", env.ID, "error", err)
+	}
+
+	ticker := time.NewTicker(tunnelHeartbeatInterval)
+	defer ticker.Stop()
+	for done := false; !done; {
+		select {
+		case <-ticker.C:
+			if err := s.environmentService.UpdateEnvironmentHeartbeat(statusCtx, env.ID); err != nil {
+				slog.WarnContext(ctx, "Failed to record tunnel heartbeat", "environmentId", env.ID, "error", err)
+			}
+		case <-sess.Done():
+			done = true
+		}
+	}
+
+	t.transport.CloseIdleConnections()
+	s.mu.Lock()
+	current := s.tunnels[env.ID] == t
+	if current {
+		delete(s.tunnels, env.ID)
+	}
+	s.mu.Unlock()
+
+	slog.InfoContext(ctx, "Agent tunnel disconnected", "environmentId", env.ID, "error", sess.Err())
+	if current {
+		if err := s.environmentService.setStatus(statusCtx, env.ID, models.EnvironmentStatusOffline, map[string]interface{}{}, "agent tunnel disconnected"); err != nil {
+			slog.WarnContext(ctx, "Failed to mark tunneled environment offline", "environmentId", env.ID, "error", err)
+		}
+	}
+}
+
+// Connected reports whether the environment's agent has a tunnel open.
+func (s *TunnelService) Connected(environmentID string) bool {
+	return s.get(environmentID) != nil
+}
+
+// HTTPClient returns a client whose requests travel through the environment's tunnel, or nil
+// when no tunnel is open. Requests should target TunnelBaseURL.
+func (s *TunnelService) HTTPClient(environmentID string, timeout time.Duration) *http.Client {
+	t := s.get(environmentID)
+	if t == nil {
+		return nil
+	}
+	return &http.Client{Transport: t.transport, Timeout: timeout}
+}
+
+// DialContext returns a dial function that opens streams through the environment's tunnel, or
+// nil when no tunnel is open.
+func (s *TunnelService) DialContext(environmentID string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	t := s.get(environmentID)
+	if t == nil {
+		return nil
+	}
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return t.session.Open(ctx)
+	}
+}
+
+// Disconnect closes the environment's tunnel, if any; the agent will try to reconnect.
+func (s *TunnelService) Disconnect(environmentID string) {
+	if t := s.get(environmentID); t != nil {
+		_ = t.session.Close()
+	}
+}
+
+func (s *TunnelService) get(environmentID string) *agentTunnel {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tunnels[environmentID]
+}
@@ -0,0 +1,292 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/dto"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/utils"
+)
+
+const (
+	totpIssuer        = "Arcane"
+	recoveryCodeCount = 10
+)
+
+var (
+	ErrTwoFactorNotEnrolled        = errors.New("two-factor authentication is not set up")
+	ErrTwoFactorAlreadyEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrInvalidTwoFactorCode        = errors.New("invalid two-factor code")
+	ErrTwoFactorRequiredBySettings = errors.New("two-factor authentication is required by the administrator")
+)
+
+type TwoFactorService struct {
+	db              *database.DB
+	settingsService *SettingsService
+}
+
+func NewTwoFactorService(db *database.DB, settingsService *SettingsService) *TwoFactorService {
+	return &TwoFactorService{db: db, settingsService: settingsService}
+}
+
+// IsRequired reports whether administrators require 2FA for every local account.
+func (s *TwoFactorService) IsRequired(ctx context.Context) bool {
+	if s.settingsService == nil {
+		return false
+	}
+	settings, err := s.settingsService.GetSettings(ctx)
+	if err != nil {
+		return false
+	}
+	return settings.AuthRequireTwoFactor.IsTrue()
+}
+
+func (s *TwoFactorService) GetStatus(ctx context.Context, userID string) (*dto.TwoFactorStatusDto, error) {
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.TwoFactorStatusDto{
+		Enabled:                user.TotpEnabled,
+		Required:               s.IsRequired(ctx),
+		RecoveryCodesRemaining: len(user.TotpRecoveryCodes),
+	}, nil
+}
+
+// BeginEnrollment generates a new pending secret. It only takes effect once ConfirmEnrollment
+// succeeds, so an abandoned enrollment never locks the user out.
+func (s *TwoFactorService) BeginEnrollment(ctx context.Context, userID string) (*dto.TwoFactorEnrollmentDto, error) {
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TotpEnabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := utils.GenerateTotpSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate totp secret: %w", err)
+	}
+	encrypted, err := utils.Encrypt(secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt totp secret: %w", err)
+	}
+
+	if err := s.updateUser(ctx, user.ID, map[string]interface{}{
+		"totp_secret":    encrypted,
+		"totp_last_step": 0,
+	}); err != nil {
+		return nil, err
+	}
+
+	uri := utils.TotpProvisioningURI(totpIssuer, user.Username, secret)
+	qrCode, err := utils.TotpQRCode(uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render totp qr code: %w", err)
+	}
+
+	return &dto.TwoFactorEnrollmentDto{
+		Secret:          secret,
+		ProvisioningURI: uri,
+		QRCode:          qrCode,
+	}, nil
+}
+
+// ConfirmEnrollment enables 2FA once the user proves their authenticator produces valid codes
+// and returns freshly generated recovery codes, which are only ever shown here.
+func (s *TwoFactorService) ConfirmEnrollment(ctx context.Context, userID, code string) ([]string, error) {
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TotpEnabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	if user.TotpSecret == nil || *user.TotpSecret == "" {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+
+	step, ok, err := s.checkTotp(user, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	plain, hashed, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.updateUserIf(ctx, user.ID, map[string]interface{}{
+		"totp_enabled":        true,
+		"totp_recovery_codes": hashed,
+		"totp_last_step":      step,
+	}, "totp_enabled = ? AND totp_last_step < ?", false, step); err != nil {
+		return nil, err
+	}
+	return plain, nil
+}
+
+// Verify accepts either a current TOTP code or an unused recovery code. Recovery codes are
+// consumed on use.
+func (s *TwoFactorService) Verify(ctx context.Context, userID, code string) error {
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !user.TotpEnabled {
+		return ErrTwoFactorNotEnrolled
+	}
+
+	step, ok, err := s.checkTotp(user, code)
+	if err != nil {
+		return err
+	}
+	// The updates only apply while the row is as it was read, so concurrent requests cannot both
+	// spend the same step or recovery code.
+	if ok {
+		return s.updateUserIf(ctx, user.ID, map[string]interface{}{"totp_last_step": step}, "totp_last_step < ?", step)
+	}
+
+	hash := hashRecoveryCode(code)
+	for i, stored := range user.TotpRecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) == 1 {
+			remaining := append(models.StringSlice{}, user.TotpRecoveryCodes[:i]...)
+			remaining = append(remaining, user.TotpRecoveryCodes[i+1:]...)
+			return s.updateUserIf(ctx, user.ID, map[string]interface{}{"totp_recovery_codes": remaining}, "totp_recovery_codes = ?", user.TotpRecoveryCodes)
+		}
+	}
+	return ErrInvalidTwoFactorCode
+}
+
+// Disable turns 2FA off after verifying a code. It is refused while 2FA is mandatory.
+func (s *TwoFactorService) Disable(ctx context.Context, userID, code string) error {
+	if s.IsRequired(ctx) {
+		return ErrTwoFactorRequiredBySettings
+	}
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return err
+	}
+	return s.updateUser(ctx, userID, clearedTotpColumns())
+}
+
+// Reset clears a user's TOTP enrollment and passkeys without a code, for administrators helping
+// a user who lost their device.
+func (s *TwoFactorService) Reset(ctx context.Context, userID string) error {
+	if _, err := s.getUser(ctx, userID); err != nil {
+		return err
+	}
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.WebauthnCredential{}, "user_id = ?", userID).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", userID).Updates(clearedTotpColumns()).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reset two-factor settings: %w", err)
+	}
+	return nil
+}
+
+func clearedTotpColumns() map[string]interface{} {
+	return map[string]interface{}{
+		"totp_secret":         nil,
+		"totp_enabled":        false,
+		"totp_recovery_codes": nil,
+		"totp_last_step":      0,
+	}
+}
+
+func (s *TwoFactorService) RegenerateRecoveryCodes(ctx context.Context, userID, code string) ([]string, error) {
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return nil, err
+	}
+
+	plain, hashed, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.updateUser(ctx, userID, map[string]interface{}{"totp_recovery_codes": hashed}); err != nil {
+		return nil, err
+	}
+	return plain, nil
+}
+
+// checkTotp validates code against the user's secret, rejecting steps that were already used.
+func (s *TwoFactorService) checkTotp(user *models.User, code string) (int64, bool, error) {
+	if user.TotpSecret == nil || *user.TotpSecret == "" {
+		return 0, false, nil
+	}
+	secret, err := utils.Decrypt(*user.TotpSecret)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to decrypt totp secret: %w", err)
+	}
+
+	step, ok := utils.ValidateTotp(secret, code, time.Now())
+	if !ok || step <= user.TotpLastStep {
+		return 0, false, nil
+	}
+	return step, true, nil
+}
+
+func (s *TwoFactorService) getUser(ctx context.Context, userID string) (*models.User, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, ErrUserNotFound
+	}
+	return &user, nil
+}
+
+func (s *TwoFactorService) updateUser(ctx context.Context, userID string, updates map[string]interface{}) error {
+	if err := s.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", userID).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to update two-factor settings: %w", err)
+	}
+	return nil
+}
+
+// updateUserIf applies updates only while the user's row still matches cond, answering
+// ErrInvalidTwoFactorCode when another request changed it first.
+func (s *TwoFactorService) updateUserIf(ctx context.Context, userID string, updates map[string]interface{}, cond string, args ...interface{}) error {
+	res := s.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", userID).Where(cond, args...).Updates(updates)
+	if res.Error != nil {
+		return fmt.Errorf("failed to update two-factor settings: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+func generateRecoveryCodes() ([]string, models.StringSlice, error) {
+	plain := make([]string, recoveryCodeCount)
+	hashed := make(models.StringSlice, recoveryCodeCount)
+	for i := range plain {
+		secret, err := utils.GenerateTotpSecret()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		code := strings.ToLower(secret[:5] + "-" + secret[5:10])
+		plain[i] = code
+		hashed[i] = hashRecoveryCode(code)
+	}
+	return plain, hashed, nil
+}
+
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	glsqlite "github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/ofkm/arcane-backend/internal/config"
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/utils"
+)
+
+func setupTwoFactorTestDB(t *testing.T) *database.DB {
+	t.Helper()
+	utils.InitEncryption(&config.Config{})
+	db, err := gorm.Open(glsqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.SettingVariable{}, &models.Event{}))
+	return &database.DB{DB: db}
+}
+
+func currentTotpCode(t *testing.T, provisioningURI string, at time.Time) string {
+	t.Helper()
+	u, err := url.Parse(provisioningURI)
+	require.NoError(t, err)
+	code, err := utils.TotpCode(u.Query().Get("secret"), utils.TotpStep(at))
+	require.NoError(t, err)
+	return code
+}
+
+func TestTwoFactorService_EnrollVerifyAndRecover(t *testing.T) {
+	ctx := context.Background()
+	db := setupTwoFactorTestDB(t)
+	svc := NewTwoFactorService(db, nil)
+
+	user := &models.User{Username: "alice"}
+	require.NoError(t, db.Create(user).Error)
+
+	enrollment, err := svc.BeginEnrollment(ctx, user.ID)
+	require.NoError(t, err)
+	require.Contains(t, enrollment.ProvisioningURI, "otpauth://totp/Arcane:alice")
+	require.True(t, strings.HasPrefix(enrollment.QRCode, "data:image/png;base64,"))
+
+	var stored models.User
+	require.NoError(t, db.First(&stored, "id = ?", user.ID).Error)
+	require.NotNil(t, stored.TotpSecret)
+	require.NotEqual(t, enrollment.Secret, *stored.TotpSecret)
+	require.False(t, stored.TotpEnabled)
+
+	require.ErrorIs(t, svc.Verify(ctx, user.ID, "000000"), ErrTwoFactorNotEnrolled)
+
+	now := time.Now()
+	codes, err := svc.ConfirmEnrollment(ctx, user.ID, currentTotpCode(t, enrollment.ProvisioningURI, now))
+	require.NoError(t, err)
+	require.Len(t, codes, recoveryCodeCount)
+
+	// The code used for confirmation cannot be replayed, the next one works.
+	require.ErrorIs(t, svc.Verify(ctx, user.ID, currentTotpCode(t, enrollment.ProvisioningURI, now)), ErrInvalidTwoFactorCode)
+	require.NoError(t, svc.Verify(ctx, user.ID, currentTotpCode(t, enrollment.ProvisioningURI, now.Add(utils.TotpPeriod))))
+
+	require.NoError(t, svc.Verify(ctx, user.ID, codes[0]))
+	require.ErrorIs(t, svc.Verify(ctx, user.ID, codes[0]), ErrInvalidTwoFactorCode)
+
+	status, err := svc.GetStatus(ctx, user.ID)
+	require.NoError(t, err)
+	require.True(t, status.Enabled)
+	require.Equal(t, recoveryCodeCount-1, status.RecoveryCodesRemaining)
+
+	require.NoError(t, svc.Disable(ctx, user.ID, codes[1]))
+	require.NoError(t, db.First(&stored, "id = ?", user.ID).Error)
+	require.False(t, stored.TotpEnabled)
+	require.Nil(t, stored.TotpSecret)
+}
+
+func TestTwoFactorService_ConcurrentVerifyAcceptsCodeOnce(t *testing.T) {
+	ctx := context.Background()
+	db := setupTwoFactorTestDB(t)
+	sqlDB, err := db.DB.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	svc := NewTwoFactorService(db, nil)
+
+	user := &models.User{Username: "carol"}
+	require.NoError(t, db.Create(user).Error)
+	enrollment, err := svc.BeginEnrollment(ctx, user.ID)
+	require.NoError(t, err)
+	now := time.Now()
+	codes, err := svc.ConfirmEnrollment(ctx, user.ID, currentTotpCode(t, enrollment.ProvisioningURI, now))
+	require.NoError(t, err)
+
+	// Hold every read of the user until both requests have made theirs, so both check the code
+	// against the same state before either records its use.
+	var reads sync.WaitGroup
+	require.NoError(t, db.Callback().Query().After("gorm:query").Register("test:barrier", func(tx *gorm.DB) {
+		if tx.Statement.Table == "users" {
+			reads.Done()
+			reads.Wait()
+		}
+	}))
+
+	for _, code := range []string{currentTotpCode(t, enrollment.ProvisioningURI, now.Add(utils.TotpPeriod)), codes[0]} {
+		reads.Add(2)
+		var accepted atomic.Int32
+		var wg sync.WaitGroup
+		for range 2 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := svc.Verify(ctx, user.ID, code); err == nil {
+					accepted.Add(1)
+				} else {
+					require.ErrorIs(t, err, ErrInvalidTwoFactorCode)
+				}
+			}()
+		}
+		wg.Wait()
+		require.EqualValues(t, 1, accepted.Load(), code)
+	}
+}
+
+func TestAuthService_LoginRequiresSecondFactor(t *testing.T) {
+	ctx := context.Background()
+	db := setupTwoFactorTestDB(t)
+
+	settingsService, err := NewSettingsService(ctx, db)
+	require.NoError(t, err)
+	require.NoError(t, settingsService.EnsureDefaultSettings(ctx))
+	userService := NewUserService(db)
+	twoFactorService := NewTwoFactorService(db, settingsService)
+	authService := NewAuthService(userService, settingsService, NewEventService(db), twoFactorService, nil, nil, nil, nil, newTestJwtKeyService(t, db, settingsService), &config.Config{})
+
+	_, err = userService.CreateUserWithPassword("bob", "correct-horse", "bob@example.com", models.RoleUser, "Bob")
+	require.NoError(t, err)
+
+	// Without 2FA tokens are issued directly.
+	_, tokens, err := authService.Login(ctx, "bob", "correct-horse")
+	require.NoError(t, err)
+	require.NotNil(t, tokens)
+
+	// Once required, login stops at an enrollment challenge.
+	require.NoError(t, settingsService.SetBoolSetting(ctx, "authRequireTwoFactor", true))
+	_, tokens, err = authService.Login(ctx, "bob", "correct-horse")
+	require.Nil(t, tokens)
+	var challenge *TwoFactorChallenge
+	require.ErrorAs(t, err, &challenge)
+	require.True(t, challenge.EnrollmentRequired)
+
+	// An enrollment challenge cannot be used to skip the code.
+	_, _, err = authService.CompleteTwoFactorLogin(ctx, challenge.Token, "000000")
+	require.ErrorIs(t, err, ErrInvalidToken)
+
+	enrollment, err := authService.BeginTwoFactorEnrollmentForLogin(ctx, challenge.Token)
+	require.NoError(t, err)
+	now := time.Now()
+	_, tokens, codes, err := authService.ConfirmTwoFactorEnrollmentForLogin(ctx, challenge.Token, currentTotpCode(t, enrollment.ProvisioningURI, now))
+	require.NoError(t, err)
+	require.NotNil(t, tokens)
+	require.Len(t, codes, recoveryCodeCount)
+
+	_, _, err = authService.Login(ctx, "bob", "correct-horse")
+	require.ErrorAs(t, err, &challenge)
+	require.False(t, challenge.EnrollmentRequired)
+
+	_, tokens, err = authService.CompleteTwoFactorLogin(ctx, challenge.Token, currentTotpCode(t, enrollment.ProvisioningURI, now.Add(utils.TotpPeriod)))
+	require.NoError(t, err)
+	require.NotNil(t, tokens)
+
+	require.ErrorIs(t, twoFactorService.Disable(ctx, tokensUserID(t, authService, tokens), codes[0]), ErrTwoFactorRequiredBySettings)
+}
+
+func tokensUserID(t *testing.T, s *AuthService, tokens *TokenPair) string {
+	t.Helper()
+	user, err := s.VerifyToken(context.Background(), tokens.AccessToken)
+	require.NoError(t, err)
+	return user.ID
+}
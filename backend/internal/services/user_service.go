@@ -43,6 +43,8 @@ func DefaultArgon2Params() *Argon2Params {
 type UserService struct {
 	db           *database.DB
 	argon2Params *Argon2Params
+	// passwordPolicy is registered by NewPasswordPolicyService; without it any password is accepted.
+	passwordPolicy *PasswordPolicyService
 }
 
 func NewUserService(db *database.DB) *UserService {
@@ -138,17 +140,14 @@ func (s *UserService) CreateUser(ctx context.Context, user *models.User) (*model
 }
 
 func (s *UserService) CreateUserWithPassword(username, password, email, role string, displayName string) (*models.User, error) {
-	hashedPassword, err := s.hashPassword(password)
-	if err != nil {
-		return nil, fmt.Errorf("failed to hash password: %w", err)
-	}
-
 	user := &models.User{
-		Username:     username,
-		Email:        &email,
-		DisplayName:  &displayName,
-		PasswordHash: hashedPassword,
-		Roles:        models.StringSlice{role},
+		Username:    username,
+		Email:       &email,
+		DisplayName: &displayName,
+		Roles:       models.StringSlice{role},
+	}
+	if err := s.SetPassword(context.Background(), user, password); err != nil {
+		return nil, err
 	}
 
 	if err := s.db.Create(user).Error; err != nil {
@@ -158,6 +157,29 @@ func (s *UserService) CreateUserWithPassword(username, password, email, role str
 	return user, nil
 }
 
+// SetPassword checks password against the password policy and replaces the user's hash, moving
+// the old one into the password history. The caller persists user.
+func (s *UserService) SetPassword(ctx context.Context, user *models.User, password string) error {
+	if s.passwordPolicy != nil {
+		if err := s.passwordPolicy.Validate(ctx, user, password); err != nil {
+			return err
+		}
+	}
+
+	hashedPassword, err := s.hashPassword(password)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	if s.passwordPolicy != nil && user.ID != "" {
+		if err := s.passwordPolicy.Remember(ctx, user.ID, user.PasswordHash); err != nil {
+			return err
+		}
+	}
+	user.PasswordHash = hashedPassword
+	return nil
+}
+
 func (s *UserService) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
 	var user models.User
 	if err := s.db.WithContext(ctx).Where("username = ?", username).First(&user).Error; err != nil {
@@ -191,6 +213,17 @@ func (s *UserService) GetUserByOidcSubjectId(ctx context.Context, subjectId stri
 	return &user, nil
 }
 
+func (s *UserService) GetUserByLdapId(ctx context.Context, ldapId string) (*models.User, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("ldap_id = ?", ldapId).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return &user, nil
+}
+
 func (s *UserService) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	var user models.User
 	if err := s.db.WithContext(ctx).Where("email = ?", email).First(&user).Error; err != nil {
@@ -274,15 +307,23 @@ func (s *UserService) CreateDefaultAdmin() error {
 		return nil
 	}
 
-	user, err := s.CreateUserWithPassword("arcane", "arcane-admin", "admin@localhost", "admin", "Arcane Admin")
+	// The well-known default password bypasses the password policy; it has to be changed on first
+	// login, and that change is checked.
+	hashedPassword, err := s.hashPassword("arcane-admin")
 	if err != nil {
-		return fmt.Errorf("failed to create default admin user: %w", err)
+		return fmt.Errorf("failed to hash password: %w", err)
 	}
-
-	// Mark this user as requiring password change on first login
-	user.RequiresPasswordChange = true
-	if err := s.db.Save(user).Error; err != nil {
-		slog.Warn("Failed to mark default admin for password change", "error", err)
+	email, displayName := "admin@localhost", "Arcane Admin"
+	user := &models.User{
+		Username:               "arcane",
+		Email:                  &email,
+		DisplayName:            &displayName,
+		PasswordHash:           hashedPassword,
+		Roles:                  models.StringSlice{models.RoleAdmin},
+		RequiresPasswordChange: true,
+	}
+	if err := s.db.Create(user).Error; err != nil {
+		return fmt.Errorf("failed to create default admin user: %w", err)
 	}
 
 	slog.Info("👑 Default admin user created!")
@@ -294,7 +335,25 @@ func (s *UserService) CreateDefaultAdmin() error {
 }
 
 func (s *UserService) DeleteUser(ctx context.Context, id string) error {
-	if err := s.db.WithContext(ctx).Delete(&models.User{}, "id = ?", id).Error; err != nil {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.ApiToken{}, "user_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.WebauthnCredential{}, "user_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.Session{}, "user_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.PasswordHistory{}, "user_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.EnvironmentAccess{}, "subject_type = ? AND subject_id = ?", models.EnvironmentAccessSubjectUser, id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.User{}, "id = ?", id).Error
+	})
+	if err != nil {
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
 	return nil
@@ -352,9 +411,12 @@ func toUserResponseDto(user models.User) dto.UserResponseDto {
 		Email:         user.Email,
 		Roles:         user.Roles,
 		OidcSubjectId: user.OidcSubjectId,
+		LdapId:        user.LdapId,
 		Locale:        user.Locale,
 		CreatedAt:     user.CreatedAt.Format("2006-01-02T15:04:05.999999Z"),
 		UpdatedAt:     user.UpdatedAt.Format("2006-01-02T15:04:05.999999Z"),
+		TotpEnabled:   user.TotpEnabled,
+		LockedUntil:   user.LockedUntil,
 	}
 }
 
@@ -2,12 +2,17 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"path"
 	"strings"
 
+	cerrdefs "github.com/containerd/errdefs"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
@@ -410,3 +415,122 @@ func (s *VolumeService) ListVolumesPaginated(ctx context.Context, params paginat
 
 	return result.Items, paginationResp, counts, nil
 }
+
+// volumeArchiveImage backs the throwaway container a volume is mounted in while its contents are
+// copied. The container is only created, never started, so any small image will do.
+const volumeArchiveImage = "busybox:stable"
+
+// volumeArchiveMount is where the volume is mounted in that container; archives hold the
+// volume's contents below this directory name.
+const volumeArchiveMount = "/volume"
+
+var ErrVolumeNotFound = errors.New("volume not found")
+
+// ExportVolume returns a tar archive of the volume's contents. Closing it releases the container
+// the volume was mounted in.
+func (s *VolumeService) ExportVolume(ctx context.Context, name string) (io.ReadCloser, error) {
+	dockerClient, err := s.dockerService.CreateConnection(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	if _, err := dockerClient.VolumeInspect(ctx, name); err != nil {
+		dockerClient.Close()
+		if cerrdefs.IsNotFound(err) {
+			return nil, fmt.Errorf("%w: %s", ErrVolumeNotFound, name)
+		}
+		return nil, fmt.Errorf("failed to inspect volume: %w", err)
+	}
+
+	containerID, err := createVolumeArchiveContainer(ctx, dockerClient, name)
+	if err != nil {
+		dockerClient.Close()
+		return nil, err
+	}
+	release := func() {
+		if err := dockerClient.ContainerRemove(context.WithoutCancel(ctx), containerID, container.RemoveOptions{Force: true}); err != nil {
+			slog.WarnContext(ctx, "failed to remove volume archive container", "volume", name, "error", err)
+		}
+		dockerClient.Close()
+	}
+
+	archive, _, err := dockerClient.CopyFromContainer(ctx, containerID, volumeArchiveMount)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("failed to read volume contents: %w", err)
+	}
+	return &volumeArchive{ReadCloser: archive, release: release}, nil
+}
+
+// ImportVolume extracts a tar archive made by ExportVolume into the volume, creating it with
+// labels if it does not exist yet. Existing files are overwritten.
+func (s *VolumeService) ImportVolume(ctx context.Context, name string, labels map[string]string, archive io.Reader, user models.User) error {
+	dockerClient, err := s.dockerService.CreateConnection(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	if _, err := dockerClient.VolumeInspect(ctx, name); cerrdefs.IsNotFound(err) {
+		if _, err := dockerClient.VolumeCreate(ctx, volume.CreateOptions{Name: name, Labels: labels}); err != nil {
+			return fmt.Errorf("failed to create volume: %w", err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to inspect volume: %w", err)
+	}
+
+	containerID, err := createVolumeArchiveContainer(ctx, dockerClient, name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := dockerClient.ContainerRemove(context.WithoutCancel(ctx), containerID, container.RemoveOptions{Force: true}); err != nil {
+			slog.WarnContext(ctx, "failed to remove volume archive container", "volume", name, "error", err)
+		}
+	}()
+
+	if err := dockerClient.CopyToContainer(ctx, containerID, path.Dir(volumeArchiveMount), archive, container.CopyToContainerOptions{}); err != nil {
+		return fmt.Errorf("failed to write volume contents: %w", err)
+	}
+
+	metadata := models.JSON{"action": "import", "name": name}
+	if logErr := s.eventService.LogVolumeEvent(ctx, models.EventTypeVolumeCreate, name, name, user.ID, user.Username, "0", metadata); logErr != nil {
+		slog.WarnContext(ctx, "could not log volume import action", slog.String("volume", name), slog.String("error", logErr.Error()))
+	}
+	docker.InvalidateVolumeUsageCache()
+	return nil
+}
+
+// createVolumeArchiveContainer creates, without starting, a container with the volume mounted,
+// pulling the helper image first if needed.
+func createVolumeArchiveContainer(ctx context.Context, dockerClient *client.Client, volumeName string) (string, error) {
+	if _, err := dockerClient.ImageInspect(ctx, volumeArchiveImage); cerrdefs.IsNotFound(err) {
+		reader, err := dockerClient.ImagePull(ctx, volumeArchiveImage, image.PullOptions{})
+		if err != nil {
+			return "", fmt.Errorf("failed to pull %s: %w", volumeArchiveImage, err)
+		}
+		_, _ = io.Copy(io.Discard, reader)
+		_ = reader.Close()
+	} else if err != nil {
+		return "", fmt.Errorf("failed to inspect %s: %w", volumeArchiveImage, err)
+	}
+
+	resp, err := dockerClient.ContainerCreate(ctx,
+		&container.Config{Image: volumeArchiveImage, Cmd: []string{"true"}, Labels: map[string]string{"com.arcane.volume-archive": volumeName}},
+		&container.HostConfig{Mounts: []mount.Mount{{Type: mount.TypeVolume, Source: volumeName, Target: volumeArchiveMount}}},
+		nil, nil, "")
+	if err != nil {
+		return "", fmt.Errorf("failed to create volume archive container: %w", err)
+	}
+	return resp.ID, nil
+}
+
+type volumeArchive struct {
+	io.ReadCloser
+	release func()
+}
+
+func (a *volumeArchive) Close() error {
+	err := a.ReadCloser.Close()
+	a.release()
+	return err
+}
@@ -0,0 +1,587 @@
+package services
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"gorm.io/gorm"
+
+	"github.com/ofkm/arcane-backend/internal/config"
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/dto"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/utils"
+)
+
+const (
+	webauthnRPName         = "Arcane"
+	webauthnCeremonyExpiry = 5 * time.Minute
+	// webauthnMaxCeremonies caps the pending ceremonies held in memory; the oldest is dropped to
+	// make room for a new one.
+	webauthnMaxCeremonies = 10000
+	// webauthnBeginLimit is how many passwordless logins a client IP can start per
+	// webauthnBeginWindow, since starting one needs no credentials.
+	webauthnBeginLimit  = 30
+	webauthnBeginWindow = time.Minute
+
+	webauthnPurposeRegister  = "register"
+	webauthnPurposeLogin     = "login"
+	webauthnPurposeTwoFactor = "2fa"
+)
+
+// webauthnCredentialParams are the credential key algorithms offered at registration and
+// accepted when it finishes.
+var webauthnCredentialParams = []protocol.CredentialParameter{
+	{Type: protocol.PublicKeyCredentialType, Algorithm: webauthncose.AlgES256},
+	{Type: protocol.PublicKeyCredentialType, Algorithm: webauthncose.AlgEdDSA},
+	{Type: protocol.PublicKeyCredentialType, Algorithm: webauthncose.AlgRS256},
+}
+
+var (
+	ErrWebauthnCredentialNotFound = errors.New("passkey not found")
+	ErrWebauthnCredentialExists   = errors.New("passkey is already registered")
+	ErrWebauthnVerificationFailed = errors.New("passkey verification failed")
+)
+
+// webauthnCeremony is a pending registration or assertion, keyed by its challenge.
+type webauthnCeremony struct {
+	purpose   string
+	userID    string
+	expiresAt time.Time
+	// elem is the ceremony's challenge in WebauthnService.order.
+	elem *list.Element
+}
+
+// webauthnBegins counts the passwordless logins a client IP started in the current window.
+type webauthnBegins struct {
+	windowStart time.Time
+	count       int
+}
+
+type WebauthnService struct {
+	db     *database.DB
+	config *config.Config
+
+	mu         sync.Mutex
+	ceremonies map[string]*webauthnCeremony
+	// order holds the pending challenges oldest first. Ceremonies all last as long, so this is
+	// also their expiry order.
+	order         *list.List
+	begins        map[string]*webauthnBegins
+	beginsSweptAt time.Time
+}
+
+func NewWebauthnService(db *database.DB, cfg *config.Config) *WebauthnService {
+	return &WebauthnService{
+		db:         db,
+		config:     cfg,
+		ceremonies: make(map[string]*webauthnCeremony),
+		order:      list.New(),
+		begins:     make(map[string]*webauthnBegins),
+	}
+}
+
+// relyingParty derives the RP ID and expected origin from APP_URL, which must be the address
+// users open in their browser.
+func (s *WebauthnService) relyingParty() (string, string, error) {
+	u, err := url.Parse(strings.TrimSpace(s.config.AppUrl))
+	if err != nil || u.Scheme == "" || u.Hostname() == "" {
+		return "", "", fmt.Errorf("APP_URL must be an absolute URL to use passkeys")
+	}
+	return u.Hostname(), u.Scheme + "://" + u.Host, nil
+}
+
+func (s *WebauthnService) HasCredentials(ctx context.Context, userID string) bool {
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&models.WebauthnCredential{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return false
+	}
+	return count > 0
+}
+
+func (s *WebauthnService) ListCredentials(ctx context.Context, userID string) ([]dto.WebauthnCredentialDto, error) {
+	var creds []models.WebauthnCredential
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at DESC").Find(&creds).Error; err != nil {
+		return nil, fmt.Errorf("failed to list passkeys: %w", err)
+	}
+
+	out := make([]dto.WebauthnCredentialDto, 0, len(creds))
+	for _, c := range creds {
+		out = append(out, toWebauthnCredentialDto(c))
+	}
+	return out, nil
+}
+
+func (s *WebauthnService) DeleteCredential(ctx context.Context, userID, id string) error {
+	res := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).Delete(&models.WebauthnCredential{})
+	if res.Error != nil {
+		return fmt.Errorf("failed to delete passkey: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrWebauthnCredentialNotFound
+	}
+	return nil
+}
+
+func (s *WebauthnService) BeginRegistration(ctx context.Context, userID string) (*dto.WebauthnCreationOptionsDto, error) {
+	rpID, _, err := s.relyingParty()
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	existing, err := s.descriptorsFor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := s.startCeremony(webauthnPurposeRegister, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	displayName := user.Username
+	if user.DisplayName != nil && *user.DisplayName != "" {
+		displayName = *user.DisplayName
+	}
+
+	return &dto.WebauthnCreationOptionsDto{
+		Challenge: challenge,
+		RP:        dto.WebauthnRelyingPartyDto{ID: rpID, Name: webauthnRPName},
+		User: dto.WebauthnUserEntityDto{
+			ID:          utils.EncodeWebauthnBase64([]byte(user.ID)),
+			Name:        user.Username,
+			DisplayName: displayName,
+		},
+		PubKeyCredParams:   credentialParameterDtos(),
+		Timeout:            webauthnCeremonyExpiry.Milliseconds(),
+		ExcludeCredentials: existing,
+		AuthenticatorSelection: dto.WebauthnAuthenticatorSelectionDto{
+			ResidentKey:      "preferred",
+			UserVerification: "preferred",
+		},
+		Attestation: "none",
+	}, nil
+}
+
+func (s *WebauthnService) FinishRegistration(ctx context.Context, userID string, req dto.FinishWebauthnRegistrationDto) (*dto.WebauthnCredentialDto, error) {
+	rpID, origin, err := s.relyingParty()
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := parseWebauthnRegistration(req.Credential)
+	if err != nil {
+		return nil, err
+	}
+	challenge := parsed.Response.CollectedClientData.Challenge
+	if err := s.consumeCeremony(challenge, webauthnPurposeRegister, userID); err != nil {
+		return nil, err
+	}
+	// User verification stays optional when adding a passkey because the session is already
+	// authenticated.
+	if _, err := parsed.Verify(challenge, false, true, rpID, []string{origin}, nil, protocol.TopOriginIgnoreVerificationMode, nil, webauthnCredentialParams); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrWebauthnVerificationFailed, err)
+	}
+
+	authData := parsed.Response.AttestationObject.AuthData
+	if !authData.Flags.HasAttestedCredentialData() || len(authData.AttData.CredentialID) == 0 {
+		return nil, fmt.Errorf("%w: missing attested credential data", ErrWebauthnVerificationFailed)
+	}
+	var key webauthncose.PublicKeyData
+	if err := webauthncbor.Unmarshal(authData.AttData.CredentialPublicKey, &key); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrWebauthnVerificationFailed, err)
+	}
+
+	credentialID := utils.EncodeWebauthnBase64(authData.AttData.CredentialID)
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&models.WebauthnCredential{}).Where("credential_id = ?", credentialID).Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("failed to check passkey: %w", err)
+	}
+	if count > 0 {
+		return nil, ErrWebauthnCredentialExists
+	}
+
+	cred := &models.WebauthnCredential{
+		UserID:       userID,
+		Name:         strings.TrimSpace(req.Name),
+		CredentialID: credentialID,
+		PublicKey:    utils.EncodeWebauthnBase64(authData.AttData.CredentialPublicKey),
+		Algorithm:    key.Algorithm,
+		SignCount:    int64(authData.Counter),
+		Transports:   models.StringSlice(req.Credential.Response.Transports),
+	}
+	if cred.Transports == nil {
+		cred.Transports = models.StringSlice{}
+	}
+	if err := s.db.WithContext(ctx).Create(cred).Error; err != nil {
+		return nil, fmt.Errorf("failed to save passkey: %w", err)
+	}
+
+	out := toWebauthnCredentialDto(*cred)
+	return &out, nil
+}
+
+// BeginLogin starts a passwordless assertion. With a username the allowed credentials are
+// narrowed to that user; without one the browser offers any discoverable passkey. Unknown
+// usernames get the same response as known ones. Each client IP can only start a limited
+// number per minute.
+func (s *WebauthnService) BeginLogin(ctx context.Context, username string) (*dto.WebauthnRequestOptionsDto, error) {
+	if err := s.allowBegin(clientInfoFromContext(ctx).IPAddress); err != nil {
+		return nil, err
+	}
+
+	allow := []dto.WebauthnCredentialDescriptorDto{}
+	if username = strings.TrimSpace(username); username != "" {
+		var user models.User
+		if err := s.db.WithContext(ctx).Where("username = ?", username).First(&user).Error; err == nil {
+			descriptors, err := s.descriptorsFor(ctx, user.ID)
+			if err != nil {
+				return nil, err
+			}
+			allow = descriptors
+		}
+	}
+	return s.requestOptions(webauthnPurposeLogin, "", allow, "required")
+}
+
+// BeginSecondFactor starts an assertion restricted to the user's own credentials.
+func (s *WebauthnService) BeginSecondFactor(ctx context.Context, userID string) (*dto.WebauthnRequestOptionsDto, error) {
+	allow, err := s.descriptorsFor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(allow) == 0 {
+		return nil, ErrWebauthnCredentialNotFound
+	}
+	return s.requestOptions(webauthnPurposeTwoFactor, userID, allow, "discouraged")
+}
+
+// FinishLogin verifies a passwordless assertion. User verification is required here because
+// the passkey replaces both the password and the second factor.
+func (s *WebauthnService) FinishLogin(ctx context.Context, credential dto.WebauthnAssertionCredentialDto) (*models.User, error) {
+	cred, err := s.verifyAssertion(ctx, webauthnPurposeLogin, "", credential, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("id = ?", cred.UserID).First(&user).Error; err != nil {
+		return nil, ErrUserNotFound
+	}
+	return &user, nil
+}
+
+func (s *WebauthnService) VerifySecondFactor(ctx context.Context, userID string, credential dto.WebauthnAssertionCredentialDto) error {
+	_, err := s.verifyAssertion(ctx, webauthnPurposeTwoFactor, userID, credential, false)
+	return err
+}
+
+func (s *WebauthnService) verifyAssertion(ctx context.Context, purpose, userID string, credential dto.WebauthnAssertionCredentialDto, requireUV bool) (*models.WebauthnCredential, error) {
+	rpID, origin, err := s.relyingParty()
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := parseWebauthnAssertion(credential)
+	if err != nil {
+		return nil, err
+	}
+	challenge := parsed.Response.CollectedClientData.Challenge
+	if err := s.consumeCeremony(challenge, purpose, userID); err != nil {
+		return nil, err
+	}
+
+	var cred models.WebauthnCredential
+	query := s.db.WithContext(ctx).Where("credential_id = ?", utils.EncodeWebauthnBase64(parsed.RawID))
+	if userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	if err := query.First(&cred).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWebauthnVerificationFailed
+		}
+		return nil, fmt.Errorf("failed to load passkey: %w", err)
+	}
+	if len(parsed.Response.UserHandle) > 0 && string(parsed.Response.UserHandle) != cred.UserID {
+		return nil, ErrWebauthnVerificationFailed
+	}
+
+	// The library also accepts an all-zero rpIdHash when no AppID is in use, so compare it here.
+	expected := sha256.Sum256([]byte(rpID))
+	if !bytes.Equal(parsed.Response.AuthenticatorData.RPIDHash, expected[:]) {
+		return nil, fmt.Errorf("%w: relying party mismatch", ErrWebauthnVerificationFailed)
+	}
+
+	publicKey, err := utils.DecodeWebauthnBase64(cred.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode stored passkey: %w", err)
+	}
+	if err := parsed.Verify(challenge, rpID, []string{origin}, nil, protocol.TopOriginIgnoreVerificationMode, "", requireUV, true, publicKey); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrWebauthnVerificationFailed, err)
+	}
+
+	// A counter that does not advance suggests a cloned authenticator. Authenticators that do not
+	// implement counters always report zero.
+	newCount := int64(parsed.Response.AuthenticatorData.Counter)
+	if (newCount != 0 || cred.SignCount != 0) && newCount <= cred.SignCount {
+		return nil, fmt.Errorf("%w: signature counter did not increase", ErrWebauthnVerificationFailed)
+	}
+
+	now := time.Now()
+	if err := s.db.WithContext(ctx).Model(&models.WebauthnCredential{}).Where("id = ?", cred.ID).
+		Updates(map[string]interface{}{"sign_count": newCount, "last_used_at": now}).Error; err != nil {
+		return nil, fmt.Errorf("failed to update passkey: %w", err)
+	}
+	cred.SignCount = newCount
+	cred.LastUsedAt = &now
+	return &cred, nil
+}
+
+// consumeCeremony takes the pending ceremony a response's challenge refers to, failing when it
+// was started for another purpose or user.
+func (s *WebauthnService) consumeCeremony(challenge, purpose, userID string) error {
+	ceremony, ok := s.takeCeremony(challenge)
+	if !ok || ceremony.purpose != purpose || ceremony.userID != userID {
+		return ErrWebauthnVerificationFailed
+	}
+	return nil
+}
+
+// parseWebauthnRegistration converts the credential a browser returned from create() into the
+// library's parsed form. Binary values are re-encoded as unpadded base64url, which it requires.
+func parseWebauthnRegistration(credential dto.WebauthnRegistrationCredentialDto) (*protocol.ParsedCredentialCreationData, error) {
+	rawID, err := decodeWebauthnCredentialID(credential.ID, credential.RawID)
+	if err != nil {
+		return nil, err
+	}
+	clientDataJSON, err := utils.DecodeWebauthnBase64(credential.Response.ClientDataJSON)
+	if err != nil {
+		return nil, ErrWebauthnVerificationFailed
+	}
+	attestation, err := utils.DecodeWebauthnBase64(credential.Response.AttestationObject)
+	if err != nil {
+		return nil, ErrWebauthnVerificationFailed
+	}
+
+	parsed, err := protocol.CredentialCreationResponse{
+		PublicKeyCredential: protocol.PublicKeyCredential{
+			Credential: protocol.Credential{ID: utils.EncodeWebauthnBase64(rawID), Type: webauthnCredentialType(credential.Type)},
+			RawID:      rawID,
+		},
+		AttestationResponse: protocol.AuthenticatorAttestationResponse{
+			AuthenticatorResponse: protocol.AuthenticatorResponse{ClientDataJSON: clientDataJSON},
+			AttestationObject:     attestation,
+			Transports:            credential.Response.Transports,
+		},
+	}.Parse()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrWebauthnVerificationFailed, err)
+	}
+	return parsed, nil
+}
+
+// parseWebauthnAssertion converts the credential a browser returned from get() into the
+// library's parsed form.
+func parseWebauthnAssertion(credential dto.WebauthnAssertionCredentialDto) (*protocol.ParsedCredentialAssertionData, error) {
+	rawID, err := decodeWebauthnCredentialID(credential.ID, credential.RawID)
+	if err != nil {
+		return nil, err
+	}
+	clientDataJSON, err := utils.DecodeWebauthnBase64(credential.Response.ClientDataJSON)
+	if err != nil {
+		return nil, ErrWebauthnVerificationFailed
+	}
+	authData, err := utils.DecodeWebauthnBase64(credential.Response.AuthenticatorData)
+	if err != nil {
+		return nil, ErrWebauthnVerificationFailed
+	}
+	signature, err := utils.DecodeWebauthnBase64(credential.Response.Signature)
+	if err != nil {
+		return nil, ErrWebauthnVerificationFailed
+	}
+	userHandle, err := utils.DecodeWebauthnBase64(credential.Response.UserHandle)
+	if err != nil {
+		return nil, ErrWebauthnVerificationFailed
+	}
+
+	parsed, err := protocol.CredentialAssertionResponse{
+		PublicKeyCredential: protocol.PublicKeyCredential{
+			Credential: protocol.Credential{ID: utils.EncodeWebauthnBase64(rawID), Type: webauthnCredentialType(credential.Type)},
+			RawID:      rawID,
+		},
+		AssertionResponse: protocol.AuthenticatorAssertionResponse{
+			AuthenticatorResponse: protocol.AuthenticatorResponse{ClientDataJSON: clientDataJSON},
+			AuthenticatorData:     authData,
+			Signature:             signature,
+			UserHandle:            userHandle,
+		},
+	}.Parse()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrWebauthnVerificationFailed, err)
+	}
+	return parsed, nil
+}
+
+// decodeWebauthnCredentialID prefers rawId and falls back to id, which carry the same bytes.
+func decodeWebauthnCredentialID(id, rawID string) ([]byte, error) {
+	if rawID == "" {
+		rawID = id
+	}
+	b, err := utils.DecodeWebauthnBase64(rawID)
+	if err != nil || len(b) == 0 {
+		return nil, ErrWebauthnVerificationFailed
+	}
+	return b, nil
+}
+
+// webauthnCredentialType defaults the credential type, which some clients leave out.
+func webauthnCredentialType(t string) string {
+	if t == "" {
+		return string(protocol.PublicKeyCredentialType)
+	}
+	return t
+}
+
+func (s *WebauthnService) requestOptions(purpose, userID string, allow []dto.WebauthnCredentialDescriptorDto, userVerification string) (*dto.WebauthnRequestOptionsDto, error) {
+	rpID, _, err := s.relyingParty()
+	if err != nil {
+		return nil, err
+	}
+	challenge, err := s.startCeremony(purpose, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.WebauthnRequestOptionsDto{
+		Challenge:        challenge,
+		RPID:             rpID,
+		Timeout:          webauthnCeremonyExpiry.Milliseconds(),
+		AllowCredentials: allow,
+		UserVerification: userVerification,
+	}, nil
+}
+
+func (s *WebauthnService) descriptorsFor(ctx context.Context, userID string) ([]dto.WebauthnCredentialDescriptorDto, error) {
+	var creds []models.WebauthnCredential
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Find(&creds).Error; err != nil {
+		return nil, fmt.Errorf("failed to list passkeys: %w", err)
+	}
+	out := make([]dto.WebauthnCredentialDescriptorDto, 0, len(creds))
+	for _, c := range creds {
+		out = append(out, dto.WebauthnCredentialDescriptorDto{Type: "public-key", ID: c.CredentialID, Transports: c.Transports})
+	}
+	return out, nil
+}
+
+func (s *WebauthnService) startCeremony(purpose, userID string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate challenge: %w", err)
+	}
+	challenge := utils.EncodeWebauthnBase64(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for front := s.order.Front(); front != nil; front = s.order.Front() {
+		oldest := front.Value.(string)
+		if now.Before(s.ceremonies[oldest].expiresAt) && len(s.ceremonies) < webauthnMaxCeremonies {
+			break
+		}
+		s.order.Remove(front)
+		delete(s.ceremonies, oldest)
+	}
+	s.ceremonies[challenge] = &webauthnCeremony{
+		purpose:   purpose,
+		userID:    userID,
+		expiresAt: now.Add(webauthnCeremonyExpiry),
+		elem:      s.order.PushBack(challenge),
+	}
+	return challenge, nil
+}
+
+// takeCeremony removes and returns a pending ceremony so each challenge can only be answered once.
+func (s *WebauthnService) takeCeremony(challenge string) (*webauthnCeremony, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.ceremonies[challenge]
+	if !ok {
+		return nil, false
+	}
+	s.order.Remove(c.elem)
+	delete(s.ceremonies, challenge)
+	if time.Now().After(c.expiresAt) {
+		return nil, false
+	}
+	return c, true
+}
+
+// allowBegin counts a passwordless login started from ip, failing once the IP exceeds
+// webauthnBeginLimit in the current window.
+func (s *WebauthnService) allowBegin(ip string) error {
+	if ip == "" {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+
+	// Drop the windows that ran out so the map only holds recently active clients.
+	if now.Sub(s.beginsSweptAt) >= webauthnBeginWindow {
+		for k, e := range s.begins {
+			if now.Sub(e.windowStart) >= webauthnBeginWindow {
+				delete(s.begins, k)
+			}
+		}
+		s.beginsSweptAt = now
+	}
+
+	entry, ok := s.begins[ip]
+	if !ok || now.Sub(entry.windowStart) >= webauthnBeginWindow {
+		entry = &webauthnBegins{windowStart: now}
+		s.begins[ip] = entry
+	}
+	if entry.count >= webauthnBeginLimit {
+		return &LoginLockoutError{Until: entry.windowStart.Add(webauthnBeginWindow), err: ErrTooManyLoginAttempts}
+	}
+	entry.count++
+	return nil
+}
+
+func credentialParameterDtos() []dto.WebauthnCredentialParameterDto {
+	out := make([]dto.WebauthnCredentialParameterDto, 0, len(webauthnCredentialParams))
+	for _, p := range webauthnCredentialParams {
+		out = append(out, dto.WebauthnCredentialParameterDto{Type: string(p.Type), Alg: int64(p.Algorithm)})
+	}
+	return out
+}
+
+func toWebauthnCredentialDto(c models.WebauthnCredential) dto.WebauthnCredentialDto {
+	transports := []string(c.Transports)
+	if transports == nil {
+		transports = []string{}
+	}
+	return dto.WebauthnCredentialDto{
+		ID:         c.ID,
+		Name:       c.Name,
+		Transports: transports,
+		LastUsedAt: c.LastUsedAt,
+		CreatedAt:  c.CreatedAt,
+	}
+}
@@ -0,0 +1,389 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	glsqlite "github.com/glebarez/sqlite"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/ofkm/arcane-backend/internal/config"
+	"github.com/ofkm/arcane-backend/internal/database"
+	"github.com/ofkm/arcane-backend/internal/dto"
+	"github.com/ofkm/arcane-backend/internal/models"
+	"github.com/ofkm/arcane-backend/internal/utils"
+)
+
+const testWebauthnOrigin = "https://arcane.example.com"
+
+// softAuthenticator is a minimal ES256 authenticator producing "none" attestations. Tests can
+// change its fields to produce responses a real authenticator or browser would not.
+type softAuthenticator struct {
+	t            *testing.T
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	rpIDHash     []byte
+	origin       string
+	// clientType overrides the ceremony type in the client data when set.
+	clientType string
+	// alg is the COSE algorithm the credential public key claims.
+	alg       int
+	signCount uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	id := make([]byte, 16)
+	_, err = rand.Read(id)
+	require.NoError(t, err)
+	rpIDHash := sha256.Sum256([]byte("arcane.example.com"))
+	return &softAuthenticator{t: t, key: key, credentialID: id, rpIDHash: rpIDHash[:], origin: testWebauthnOrigin, alg: -7}
+}
+
+func (a *softAuthenticator) clientData(typ, challenge string) []byte {
+	if a.clientType != "" {
+		typ = a.clientType
+	}
+	b, err := json.Marshal(map[string]string{"type": typ, "challenge": challenge, "origin": a.origin})
+	require.NoError(a.t, err)
+	return b
+}
+
+func (a *softAuthenticator) authData(flags protocol.AuthenticatorFlags, attested []byte) []byte {
+	out := append([]byte{}, a.rpIDHash...)
+	out = append(out, byte(flags))
+	out = binary.BigEndian.AppendUint32(out, a.signCount)
+	return append(out, attested...)
+}
+
+func (a *softAuthenticator) create(options *dto.WebauthnCreationOptionsDto) dto.WebauthnRegistrationCredentialDto {
+	coseKey, err := cbor.Marshal(map[int]interface{}{
+		1:  2,
+		3:  a.alg,
+		-1: 1,
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	require.NoError(a.t, err)
+
+	attested := make([]byte, 16) // zero AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, coseKey...)
+
+	attestation, err := cbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(protocol.FlagUserPresent|protocol.FlagUserVerified|protocol.FlagAttestedCredentialData, attested),
+	})
+	require.NoError(a.t, err)
+
+	id := utils.EncodeWebauthnBase64(a.credentialID)
+	return dto.WebauthnRegistrationCredentialDto{
+		ID:    id,
+		RawID: id,
+		Type:  "public-key",
+		Response: dto.WebauthnAttestationResponseDto{
+			ClientDataJSON:    utils.EncodeWebauthnBase64(a.clientData("webauthn.create", options.Challenge)),
+			AttestationObject: utils.EncodeWebauthnBase64(attestation),
+			Transports:        []string{"usb"},
+		},
+	}
+}
+
+func (a *softAuthenticator) get(options *dto.WebauthnRequestOptionsDto, flags protocol.AuthenticatorFlags, userHandle string) dto.WebauthnAssertionCredentialDto {
+	a.signCount++
+	authData := a.authData(flags, nil)
+	clientData := a.clientData("webauthn.get", options.Challenge)
+
+	clientHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	require.NoError(a.t, err)
+
+	id := utils.EncodeWebauthnBase64(a.credentialID)
+	return dto.WebauthnAssertionCredentialDto{
+		ID:    id,
+		RawID: id,
+		Type:  "public-key",
+		Response: dto.WebauthnAssertionResponseDto{
+			ClientDataJSON:    utils.EncodeWebauthnBase64(clientData),
+			AuthenticatorData: utils.EncodeWebauthnBase64(authData),
+			Signature:         utils.EncodeWebauthnBase64(sig),
+			UserHandle:        userHandle,
+		},
+	}
+}
+
+func setupWebauthnTestDB(t *testing.T) *database.DB {
+	t.Helper()
+	utils.InitEncryption(&config.Config{})
+	db, err := gorm.Open(glsqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.WebauthnCredential{}, &models.SettingVariable{}, &models.Event{}))
+	return &database.DB{DB: db}
+}
+
+func TestWebauthnService_RegisterAndPasswordlessLogin(t *testing.T) {
+	ctx := context.Background()
+	db := setupWebauthnTestDB(t)
+	svc := NewWebauthnService(db, &config.Config{AppUrl: testWebauthnOrigin + "/"})
+
+	user := &models.User{Username: "alice"}
+	require.NoError(t, db.Create(user).Error)
+	authenticator := newSoftAuthenticator(t)
+
+	creation, err := svc.BeginRegistration(ctx, user.ID)
+	require.NoError(t, err)
+	require.Equal(t, "arcane.example.com", creation.RP.ID)
+
+	registration := authenticator.create(creation)
+	cred, err := svc.FinishRegistration(ctx, user.ID, dto.FinishWebauthnRegistrationDto{Name: "YubiKey", Credential: registration})
+	require.NoError(t, err)
+	require.Equal(t, []string{"usb"}, cred.Transports)
+	require.True(t, svc.HasCredentials(ctx, user.ID))
+
+	// The registration challenge was consumed.
+	_, err = svc.FinishRegistration(ctx, user.ID, dto.FinishWebauthnRegistrationDto{Name: "again", Credential: registration})
+	require.ErrorIs(t, err, ErrWebauthnVerificationFailed)
+
+	options, err := svc.BeginLogin(ctx, "alice")
+	require.NoError(t, err)
+	require.Len(t, options.AllowCredentials, 1)
+
+	userHandle := utils.EncodeWebauthnBase64([]byte(user.ID))
+	got, err := svc.FinishLogin(ctx, authenticator.get(options, protocol.FlagUserPresent|protocol.FlagUserVerified, userHandle))
+	require.NoError(t, err)
+	require.Equal(t, user.ID, got.ID)
+
+	// Passwordless login needs user verification.
+	options, err = svc.BeginLogin(ctx, "")
+	require.NoError(t, err)
+	_, err = svc.FinishLogin(ctx, authenticator.get(options, protocol.FlagUserPresent, ""))
+	require.ErrorIs(t, err, ErrWebauthnVerificationFailed)
+
+	// A replayed counter is rejected as a possible clone.
+	options, err = svc.BeginLogin(ctx, "")
+	require.NoError(t, err)
+	authenticator.signCount = 0
+	_, err = svc.FinishLogin(ctx, authenticator.get(options, protocol.FlagUserPresent|protocol.FlagUserVerified, ""))
+	require.ErrorIs(t, err, ErrWebauthnVerificationFailed)
+
+	// Assertions from another origin are rejected.
+	options, err = svc.BeginLogin(ctx, "")
+	require.NoError(t, err)
+	authenticator.origin = "https://evil.example.com"
+	authenticator.signCount = 10
+	_, err = svc.FinishLogin(ctx, authenticator.get(options, protocol.FlagUserPresent|protocol.FlagUserVerified, ""))
+	require.ErrorIs(t, err, ErrWebauthnVerificationFailed)
+}
+
+func TestWebauthnService_RejectsInvalidResponses(t *testing.T) {
+	ctx := context.Background()
+	otherRP := sha256.Sum256([]byte("evil.example.com"))
+	verified := protocol.FlagUserPresent | protocol.FlagUserVerified
+
+	registrations := map[string]func(a *softAuthenticator){
+		"rpIdHash of another domain": func(a *softAuthenticator) { a.rpIDHash = otherRP[:] },
+		"all-zero rpIdHash":          func(a *softAuthenticator) { a.rpIDHash = make([]byte, 32) },
+		"wrong origin":               func(a *softAuthenticator) { a.origin = "https://evil.example.com" },
+		"wrong client data type":     func(a *softAuthenticator) { a.clientType = "webauthn.get" },
+		"unsupported algorithm":      func(a *softAuthenticator) { a.alg = -35 },
+	}
+	for name, mutate := range registrations {
+		t.Run("register/"+name, func(t *testing.T) {
+			db := setupWebauthnTestDB(t)
+			svc := NewWebauthnService(db, &config.Config{AppUrl: testWebauthnOrigin})
+			user := &models.User{Username: "alice"}
+			require.NoError(t, db.Create(user).Error)
+
+			authenticator := newSoftAuthenticator(t)
+			mutate(authenticator)
+			creation, err := svc.BeginRegistration(ctx, user.ID)
+			require.NoError(t, err)
+			_, err = svc.FinishRegistration(ctx, user.ID, dto.FinishWebauthnRegistrationDto{Name: "key", Credential: authenticator.create(creation)})
+			require.ErrorIs(t, err, ErrWebauthnVerificationFailed)
+			require.False(t, svc.HasCredentials(ctx, user.ID))
+		})
+	}
+
+	assertions := map[string]struct {
+		mutate func(a *softAuthenticator)
+		flags  protocol.AuthenticatorFlags
+	}{
+		"rpIdHash of another domain": {func(a *softAuthenticator) { a.rpIDHash = otherRP[:] }, verified},
+		"all-zero rpIdHash":          {func(a *softAuthenticator) { a.rpIDHash = make([]byte, 32) }, verified},
+		"user presence not set":      {func(a *softAuthenticator) {}, protocol.FlagUserVerified},
+		"user verification not set":  {func(a *softAuthenticator) {}, protocol.FlagUserPresent},
+		"counter went backwards":     {func(a *softAuthenticator) { a.signCount = 0 }, verified},
+		"wrong origin":               {func(a *softAuthenticator) { a.origin = "http://arcane.example.com" }, verified},
+		"wrong client data type":     {func(a *softAuthenticator) { a.clientType = "webauthn.create" }, verified},
+	}
+	for name, tc := range assertions {
+		t.Run("login/"+name, func(t *testing.T) {
+			db := setupWebauthnTestDB(t)
+			svc := NewWebauthnService(db, &config.Config{AppUrl: testWebauthnOrigin})
+			user := &models.User{Username: "alice"}
+			require.NoError(t, db.Create(user).Error)
+
+			authenticator := newSoftAuthenticator(t)
+			authenticator.signCount = 5
+			creation, err := svc.BeginRegistration(ctx, user.ID)
+			require.NoError(t, err)
+			_, err = svc.FinishRegistration(ctx, user.ID, dto.FinishWebauthnRegistrationDto{Name: "key", Credential: authenticator.create(creation)})
+			require.NoError(t, err)
+
+			tc.mutate(authenticator)
+			options, err := svc.BeginLogin(ctx, "")
+			require.NoError(t, err)
+			_, err = svc.FinishLogin(ctx, authenticator.get(options, tc.flags, ""))
+			require.ErrorIs(t, err, ErrWebauthnVerificationFailed)
+		})
+	}
+}
+
+func TestAuthService_PasskeyAsSecondFactor(t *testing.T) {
+	ctx := context.Background()
+	db := setupWebauthnTestDB(t)
+
+	settingsService, err := NewSettingsService(ctx, db)
+	require.NoError(t, err)
+	require.NoError(t, settingsService.EnsureDefaultSettings(ctx))
+	userService := NewUserService(db)
+	webauthnService := NewWebauthnService(db, &config.Config{AppUrl: testWebauthnOrigin})
+	authService := NewAuthService(userService, settingsService, NewEventService(db), NewTwoFactorService(db, settingsService), webauthnService, nil, nil, nil, newTestJwtKeyService(t, db, settingsService), &config.Config{})
+
+	user, err := userService.CreateUserWithPassword("bob", "correct-horse", "bob@example.com", models.RoleUser, "Bob")
+	require.NoError(t, err)
+
+	authenticator := newSoftAuthenticator(t)
+	creation, err := webauthnService.BeginRegistration(ctx, user.ID)
+	require.NoError(t, err)
+	_, err = webauthnService.FinishRegistration(ctx, user.ID, dto.FinishWebauthnRegistrationDto{Name: "key", Credential: authenticator.create(creation)})
+	require.NoError(t, err)
+
+	_, tokens, err := authService.Login(ctx, "bob", "correct-horse")
+	require.Nil(t, tokens)
+	var challenge *TwoFactorChallenge
+	require.ErrorAs(t, err, &challenge)
+	require.False(t, challenge.EnrollmentRequired)
+	require.Equal(t, []string{TwoFactorMethodWebauthn}, challenge.Methods)
+
+	options, err := authService.BeginWebauthnTwoFactorLogin(ctx, challenge.Token)
+	require.NoError(t, err)
+
+	// As a second factor user presence is enough.
+	_, tokens, err = authService.CompleteWebauthnTwoFactorLogin(ctx, challenge.Token, authenticator.get(options, protocol.FlagUserPresent, ""))
+	require.NoError(t, err)
+	require.NotNil(t, tokens)
+
+	// A challenge from the 2FA flow cannot be answered through passwordless login.
+	options, err = authService.BeginWebauthnTwoFactorLogin(ctx, challenge.Token)
+	require.NoError(t, err)
+	_, _, err = authService.WebauthnLogin(ctx, authenticator.get(options, protocol.FlagUserPresent|protocol.FlagUserVerified, ""))
+	require.ErrorIs(t, err, ErrWebauthnVerificationFailed)
+}
+
+func TestAuthService_PasskeyLoginIsThrottled(t *testing.T) {
+	db := setupWebauthnTestDB(t)
+	ctx := WithClientInfo(context.Background(), ClientInfo{IPAddress: "203.0.113.9"})
+
+	settingsService, err := NewSettingsService(ctx, db)
+	require.NoError(t, err)
+	require.NoError(t, settingsService.EnsureDefaultSettings(ctx))
+	require.NoError(t, settingsService.SetIntSetting(ctx, "authLoginIpMaxAttempts", 2))
+	userService := NewUserService(db)
+	eventService := NewEventService(db)
+	throttle := NewLoginThrottleService(db, settingsService, eventService)
+	webauthnService := NewWebauthnService(db, &config.Config{AppUrl: testWebauthnOrigin})
+	authService := NewAuthService(userService, settingsService, eventService, nil, webauthnService, nil, throttle, nil, newTestJwtKeyService(t, db, settingsService), &config.Config{})
+
+	user, err := userService.CreateUserWithPassword("dana", "correct-horse", "dana@example.com", models.RoleUser, "Dana")
+	require.NoError(t, err)
+	authenticator := newSoftAuthenticator(t)
+	creation, err := webauthnService.BeginRegistration(ctx, user.ID)
+	require.NoError(t, err)
+	_, err = webauthnService.FinishRegistration(ctx, user.ID, dto.FinishWebauthnRegistrationDto{Name: "key", Credential: authenticator.create(creation)})
+	require.NoError(t, err)
+	verified := protocol.FlagUserPresent | protocol.FlagUserVerified
+
+	// A locked account cannot get around the lockout with a passkey.
+	lockedUntil := time.Now().Add(time.Hour)
+	require.NoError(t, db.Model(user).Update("locked_until", lockedUntil).Error)
+	options, err := authService.webauthnService.BeginLogin(ctx, "")
+	require.NoError(t, err)
+	_, _, err = authService.WebauthnLogin(ctx, authenticator.get(options, verified, ""))
+	require.ErrorIs(t, err, ErrAccountLocked)
+	require.NoError(t, throttle.Unlock(ctx, user.ID))
+
+	// Failed assertions count against the client IP.
+	for range 2 {
+		options, err = authService.webauthnService.BeginLogin(ctx, "")
+		require.NoError(t, err)
+		_, _, err = authService.WebauthnLogin(ctx, authenticator.get(options, protocol.FlagUserPresent, ""))
+		require.ErrorIs(t, err, ErrWebauthnVerificationFailed)
+	}
+	options, err = authService.webauthnService.BeginLogin(ctx, "")
+	require.NoError(t, err)
+	_, _, err = authService.WebauthnLogin(ctx, authenticator.get(options, verified, ""))
+	require.ErrorIs(t, err, ErrTooManyLoginAttempts)
+
+	throttle.UnlockIP("203.0.113.9")
+	_, tokens, err := authService.WebauthnLogin(ctx, authenticator.get(options, verified, ""))
+	require.NoError(t, err)
+	require.NotNil(t, tokens)
+}
+
+func TestWebauthnService_BoundsPendingCeremonies(t *testing.T) {
+	svc := NewWebauthnService(setupWebauthnTestDB(t), &config.Config{AppUrl: testWebauthnOrigin})
+
+	first, err := svc.startCeremony(webauthnPurposeLogin, "")
+	require.NoError(t, err)
+	second, err := svc.startCeremony(webauthnPurposeLogin, "")
+	require.NoError(t, err)
+	_, ok := svc.takeCeremony(second)
+	require.True(t, ok)
+	for range webauthnMaxCeremonies {
+		_, err := svc.startCeremony(webauthnPurposeLogin, "")
+		require.NoError(t, err)
+	}
+	require.Len(t, svc.ceremonies, webauthnMaxCeremonies)
+	require.Equal(t, webauthnMaxCeremonies, svc.order.Len())
+	_, ok = svc.takeCeremony(first)
+	require.False(t, ok, "the oldest ceremony makes room for new ones")
+}
+
+func TestWebauthnService_RateLimitsPasswordlessLoginStarts(t *testing.T) {
+	svc := NewWebauthnService(setupWebauthnTestDB(t), &config.Config{AppUrl: testWebauthnOrigin})
+	ctx := WithClientInfo(context.Background(), ClientInfo{IPAddress: "192.0.2.44"})
+
+	for range webauthnBeginLimit {
+		_, err := svc.BeginLogin(ctx, "")
+		require.NoError(t, err)
+	}
+	_, err := svc.BeginLogin(ctx, "")
+	require.ErrorIs(t, err, ErrTooManyLoginAttempts)
+	var lockout *LoginLockoutError
+	require.ErrorAs(t, err, &lockout)
+	require.Positive(t, lockout.RetryAfter())
+
+	other := WithClientInfo(context.Background(), ClientInfo{IPAddress: "192.0.2.45"})
+	_, err = svc.BeginLogin(other, "")
+	require.NoError(t, err)
+
+	svc.begins["192.0.2.44"].windowStart = time.Now().Add(-webauthnBeginWindow)
+	_, err = svc.BeginLogin(ctx, "")
+	require.NoError(t, err)
+}
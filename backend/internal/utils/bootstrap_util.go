@@ -7,15 +7,6 @@ import (
 	"github.com/ofkm/arcane-backend/internal/config"
 )
 
-func LoadAgentToken(ctx context.Context, cfg *config.Config, getSettingFunc func(context.Context, string, string) string) {
-	if cfg.AgentMode && cfg.AgentToken == "" {
-		if tok := getSettingFunc(ctx, "agentToken", ""); tok != "" {
-			cfg.AgentToken = tok
-			slog.InfoContext(ctx, "Loaded agent token from database")
-		}
-	}
-}
-
 func EnsureEncryptionKey(ctx context.Context, cfg *config.Config, ensureKeyFunc func(context.Context) (string, error)) {
 	if cfg.AgentMode || cfg.Environment != "production" {
 		key, err := ensureKeyFunc(ctx)
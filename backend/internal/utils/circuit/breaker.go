@@ -0,0 +1,176 @@
+package circuit
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrOpen is returned by Allow while the circuit is open.
+var ErrOpen = errors.New("circuit open")
+
+type State int
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// Breaker opens after threshold consecutive failures and fails requests fast until cooldown has
+// passed. It then lets a single trial request through: a success closes the circuit again, a
+// failure keeps it open for another cooldown. A trial that never reports back is given up on
+// after a cooldown so the circuit cannot get stuck half-open.
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	trialAt  time.Time
+}
+
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &Breaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// Allow reports whether a request may go ahead, returning ErrOpen if it may not.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	switch b.state {
+	case StateOpen:
+		if now.Sub(b.openedAt) < b.cooldown {
+			return ErrOpen
+		}
+		b.state, b.trialAt = StateHalfOpen, now
+		return nil
+	case StateHalfOpen:
+		if now.Sub(b.trialAt) < b.cooldown {
+			return ErrOpen
+		}
+		b.trialAt = now
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Success records a successful request and reports whether it closed the circuit.
+func (b *Breaker) Success() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	if b.state == StateClosed {
+		return false
+	}
+	b.state = StateClosed
+	return true
+}
+
+// Failure records a failed request and reports whether it opened the circuit. A failed trial
+// reopens the circuit without reporting it again.
+func (b *Breaker) Failure() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	switch b.state {
+	case StateHalfOpen:
+		b.state, b.openedAt = StateOpen, b.now()
+		return false
+	case StateClosed:
+		if b.failures < b.threshold {
+			return false
+		}
+		b.state, b.openedAt = StateOpen, b.now()
+		return true
+	default:
+		return false
+	}
+}
+
+// Reset closes the circuit and reports whether it was not closed before.
+func (b *Breaker) Reset() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	wasOpen := b.state != StateClosed
+	b.state, b.failures = StateClosed, 0
+	return wasOpen
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// RetryAfter returns how long until the circuit next lets a request through; zero when closed.
+func (b *Breaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var since time.Time
+	switch b.state {
+	case StateOpen:
+		since = b.openedAt
+	case StateHalfOpen:
+		since = b.trialAt
+	default:
+		return 0
+	}
+	return max(b.cooldown-b.now().Sub(since), 0)
+}
+
+// Set holds one breaker per key, created on first use with the set's threshold and cooldown.
+type Set struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+func NewSet(threshold int, cooldown time.Duration) *Set {
+	return &Set{threshold: threshold, cooldown: cooldown, breakers: map[string]*Breaker{}}
+}
+
+func (s *Set) Get(key string) *Breaker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.breakers[key]
+	if !ok {
+		b = NewBreaker(s.threshold, s.cooldown)
+		s.breakers[key] = b
+	}
+	return b
+}
+
+// Remove forgets the key's breaker, so the next request starts with a closed circuit.
+func (s *Set) Remove(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.breakers, key)
+}
@@ -0,0 +1,40 @@
+package circuit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreaker_OpensAndRecovers(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := NewBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	require.False(t, b.Failure())
+	require.False(t, b.Success(), "a success while closed changes nothing")
+	require.False(t, b.Failure(), "failures must be consecutive")
+	require.True(t, b.Failure())
+	require.Equal(t, StateOpen, b.State())
+	require.ErrorIs(t, b.Allow(), ErrOpen)
+	require.Equal(t, time.Minute, b.RetryAfter())
+
+	// After the cooldown a single trial goes through; a failed one reopens the circuit.
+	now = now.Add(time.Minute)
+	require.NoError(t, b.Allow())
+	require.Equal(t, StateHalfOpen, b.State())
+	require.ErrorIs(t, b.Allow(), ErrOpen)
+	require.False(t, b.Failure())
+	require.Equal(t, StateOpen, b.State())
+
+	// A trial that never reports back is given up on after another cooldown.
+	now = now.Add(time.Minute)
+	require.NoError(t, b.Allow())
+	now = now.Add(time.Minute)
+	require.NoError(t, b.Allow())
+	require.True(t, b.Success())
+	require.Equal(t, StateClosed, b.State())
+	require.Zero(t, b.RetryAfter())
+	require.NoError(t, b.Allow())
+}
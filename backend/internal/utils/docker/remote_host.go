@@ -0,0 +1,109 @@
+package docker
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const defaultSSHSocketPath = "/var/run/docker.sock"
+
+// SSHHost is a Docker daemon whose socket is reached over SSH.
+type SSHHost struct {
+	User       string
+	Addr       string
+	SocketPath string
+}
+
+// ParseSSHHost parses ssh://user@host[:port][/path/to/docker.sock]. The port defaults to 22 and
+// the socket to /var/run/docker.sock.
+func ParseSSHHost(raw string) (SSHHost, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return SSHHost{}, fmt.Errorf("invalid ssh host: %w", err)
+	}
+	if u.Scheme != "ssh" || u.Hostname() == "" {
+		return SSHHost{}, fmt.Errorf("invalid ssh host %q: expected ssh://user@host", raw)
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return SSHHost{}, fmt.Errorf("invalid ssh host %q: a user is required", raw)
+	}
+	if _, hasPassword := u.User.Password(); hasPassword {
+		return SSHHost{}, errors.New("invalid ssh host: passwords are not supported, use a private key")
+	}
+	port := u.Port()
+	if port == "" {
+		port = "22"
+	}
+	host := SSHHost{User: u.User.Username(), Addr: net.JoinHostPort(u.Hostname(), port), SocketPath: u.Path}
+	if host.SocketPath == "" || host.SocketPath == "/" {
+		host.SocketPath = defaultSSHSocketPath
+	}
+	return host, nil
+}
+
+// SSHDialer returns a dial function for the Docker client that opens an SSH connection per
+// connection and forwards it to the daemon's socket. Closing the returned connection closes the
+// SSH connection with it, so nothing outlives the Docker client.
+func SSHDialer(host SSHHost, config *ssh.ClientConfig) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", host.Addr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to %s: %w", host.Addr, err)
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = conn.SetDeadline(deadline)
+		}
+		sshConn, chans, reqs, err := ssh.NewClientConn(conn, host.Addr, config)
+		if err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("ssh handshake with %s failed: %w", host.Addr, err)
+		}
+		_ = conn.SetDeadline(time.Time{})
+
+		client := ssh.NewClient(sshConn, chans, reqs)
+		socket, err := client.Dial("unix", host.SocketPath)
+		if err != nil {
+			_ = client.Close()
+			return nil, fmt.Errorf("failed to reach docker socket %s: %w", host.SocketPath, err)
+		}
+		return &sshSocketConn{Conn: socket, client: client}, nil
+	}
+}
+
+type sshSocketConn struct {
+	net.Conn
+	client *ssh.Client
+}
+
+func (c *sshSocketConn) Close() error {
+	err := c.Conn.Close()
+	_ = c.client.Close()
+	return err
+}
+
+// TLSConfig builds the client TLS configuration for a daemon listening on tcp:// from the PEM
+// encoded CA certificate, client certificate and client key.
+func TLSConfig(caPEM, certPEM, keyPEM string) (*tls.Config, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(caPEM)) {
+		return nil, errors.New("invalid CA certificate")
+	}
+	cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		return nil, fmt.Errorf("invalid client certificate: %w", err)
+	}
+	return &tls.Config{
+		RootCAs:      pool,
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
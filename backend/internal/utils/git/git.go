@@ -0,0 +1,174 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// ErrInvalidRepository is returned for repository URLs and branches git is not run with.
+var ErrInvalidRepository = errors.New("invalid repository")
+
+// remoteProtocols keeps git away from transports such as ext:: that run arbitrary commands.
+const remoteProtocols = "git:http:https:ssh"
+
+// localRepositories permits file:// repositories, see AllowLocalRepositories.
+var localRepositories atomic.Bool
+
+// scpLikeURL matches the user@host:path form ssh remotes are usually given in.
+var scpLikeURL = regexp.MustCompile(`^[A-Za-z0-9._-]+@[A-Za-z0-9.-]+:[^/]`)
+
+// Auth holds the credentials for a remote: SSHKey is a private key for ssh remotes, Token a
+// personal access or deploy token for http(s) remotes, sent as the password of Username.
+type Auth struct {
+	SSHKey string
+	// KnownHostsFile pins the host keys of ssh remotes, adding those not yet known on first
+	// connect. The user's known_hosts is used when empty.
+	KnownHostsFile string
+	Username       string
+	Token          string
+}
+
+// AllowLocalRepositories lets file:// URLs be used as repositories. They are refused by default
+// since they would let anyone who can add a project read any repository on the server.
+func AllowLocalRepositories(allow bool) {
+	localRepositories.Store(allow)
+}
+
+func allowedProtocols() string {
+	if localRepositories.Load() {
+		return "file:" + remoteProtocols
+	}
+	return remoteProtocols
+}
+
+// IsSSH reports whether url is reached over ssh.
+func IsSSH(url string) bool {
+	return strings.HasPrefix(url, "ssh://") || scpLikeURL.MatchString(url)
+}
+
+// ValidateRepository checks that url and branch are safe to pass to git. An empty branch
+// stands for the remote's default branch.
+func ValidateRepository(url, branch string) error {
+	switch {
+	case url == "" || strings.HasPrefix(url, "-"):
+		return fmt.Errorf("%w: repository URL is required", ErrInvalidRepository)
+	case IsSSH(url):
+	default:
+		scheme, _, ok := strings.Cut(url, "://")
+		if !ok || !strings.Contains(":"+allowedProtocols()+":", ":"+scheme+":") {
+			return fmt.Errorf("%w: unsupported repository URL %q", ErrInvalidRepository, url)
+		}
+	}
+	if branch != "" && (strings.HasPrefix(branch, "-") || strings.ContainsAny(branch, " ~^:?*[\\") || strings.Contains(branch, "..")) {
+		return fmt.Errorf("%w: invalid branch %q", ErrInvalidRepository, branch)
+	}
+	return nil
+}
+
+// RemoteHead returns the commit branch points to on the remote without fetching it.
+func RemoteHead(ctx context.Context, url, branch string, auth Auth) (string, error) {
+	out, err := run(ctx, "", auth, "ls-remote", "--", url, "refs/heads/"+branch)
+	if err != nil {
+		return "", err
+	}
+	// Patterns match the tail of ref names, so other refs may be listed as well.
+	for line := range strings.Lines(out) {
+		sha, ref, _ := strings.Cut(strings.TrimSpace(line), "\t")
+		if ref == "refs/heads/"+branch {
+			return sha, nil
+		}
+	}
+	return "", fmt.Errorf("branch %q not found in %s", branch, url)
+}
+
+// Clone makes a shallow clone of branch, or of the default branch when empty, into dir, which
+// must be missing or empty. It returns the branch and the commit checked out.
+func Clone(ctx context.Context, dir, url, branch string, auth Auth) (checkedOut, sha string, err error) {
+	args := []string{"clone", "--depth", "1", "--single-branch"}
+	if branch != "" {
+		args = append(args, "--branch", branch)
+	}
+	if _, err := run(ctx, "", auth, append(args, "--", url, dir)...); err != nil {
+		return "", "", err
+	}
+	if checkedOut, err = run(ctx, dir, Auth{}, "symbolic-ref", "--short", "HEAD"); err != nil {
+		return "", "", err
+	}
+	if sha, err = Head(ctx, dir); err != nil {
+		return "", "", err
+	}
+	return checkedOut, sha, nil
+}
+
+// Checkout fetches branch from url into the clone in dir and resets the working tree to it.
+// Untracked files such as a project's .env are left alone. It returns the commit checked out.
+func Checkout(ctx context.Context, dir, url, branch string, auth Auth) (string, error) {
+	if _, err := run(ctx, dir, auth, "fetch", "--depth", "1", "--", url, "refs/heads/"+branch); err != nil {
+		return "", err
+	}
+	if _, err := run(ctx, dir, Auth{}, "reset", "--hard", "FETCH_HEAD"); err != nil {
+		return "", err
+	}
+	return Head(ctx, dir)
+}
+
+// Head returns the commit checked out in dir.
+func Head(ctx context.Context, dir string) (string, error) {
+	return run(ctx, dir, Auth{}, "rev-parse", "HEAD")
+}
+
+func run(ctx context.Context, dir string, auth Auth, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ALLOW_PROTOCOL="+allowedProtocols())
+
+	if auth.SSHKey != "" {
+		keyDir, err := os.MkdirTemp("", "arcane-git-")
+		if err != nil {
+			return "", fmt.Errorf("failed to prepare ssh key: %w", err)
+		}
+		defer os.RemoveAll(keyDir)
+		keyFile := filepath.Join(keyDir, "id")
+		if err := os.WriteFile(keyFile, []byte(strings.TrimSpace(auth.SSHKey)+"\n"), 0o600); err != nil {
+			return "", fmt.Errorf("failed to prepare ssh key: %w", err)
+		}
+		sshCommand := "ssh -i " + shellQuote(keyFile) + " -o IdentitiesOnly=yes -o BatchMode=yes -o StrictHostKeyChecking=accept-new"
+		if auth.KnownHostsFile != "" {
+			sshCommand += " -o UserKnownHostsFile=" + shellQuote(auth.KnownHostsFile)
+		}
+		cmd.Env = append(cmd.Env, "GIT_SSH_COMMAND="+sshCommand)
+	}
+	if auth.Token != "" {
+		username := auth.Username
+		if username == "" {
+			username = "git"
+		}
+		// Passed through the environment rather than the URL or arguments so that the token
+		// shows up neither in the clone's config nor in the process list.
+		header := "Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+auth.Token))
+		cmd.Env = append(cmd.Env, "GIT_CONFIG_COUNT=1", "GIT_CONFIG_KEY_0=http.extraHeader", "GIT_CONFIG_VALUE_0="+header)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s failed: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s failed: %w", args[0], err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
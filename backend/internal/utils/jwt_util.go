@@ -1,7 +1,6 @@
 package utils
 
 import (
-	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -80,20 +79,6 @@ func GetStringSliceClaim(m map[string]any, key string) []string {
 	return nil
 }
 
-func CheckOrGenerateJwtSecret(jwtSecret string) []byte {
-	var secretBytes []byte
-	if jwtSecret != "" {
-		secretBytes = []byte(jwtSecret)
-		return secretBytes
-	} else {
-		secretBytes = make([]byte, 32)
-		if _, err := rand.Read(secretBytes); err != nil {
-			panic(fmt.Errorf("failed to generate random JWT secret: %w", err))
-		}
-	}
-	return nil
-}
-
 func ParseJWTClaims(idToken string) map[string]any {
 	parts := strings.Split(idToken, ".")
 	if len(parts) < 2 {
@@ -1,6 +1,9 @@
 package pagination
 
 import (
+	"net/url"
+	"strconv"
+
 	"github.com/gin-gonic/gin"
 	arcanehttp "github.com/ofkm/arcane-backend/internal/utils/http"
 )
@@ -46,3 +49,27 @@ func ExtractListModifiersQueryParams(c *gin.Context) QueryParams {
 		filters,
 	}
 }
+
+// Values encodes the parameters back into a query string understood by ExtractListModifiersQueryParams.
+func (q QueryParams) Values() url.Values {
+	v := url.Values{}
+	for key, value := range q.Filters {
+		v.Set(key, value)
+	}
+	if q.Search != "" {
+		v.Set("search", q.Search)
+	}
+	if q.sort != "" {
+		v.Set("sort", q.sort)
+	}
+	if q.order != "" {
+		v.Set("order", string(q.order))
+	}
+	if q.Start > 0 {
+		v.Set("start", strconv.Itoa(q.Start))
+	}
+	if q.Limit > 0 {
+		v.Set("limit", strconv.Itoa(q.Limit))
+	}
+	return v
+}
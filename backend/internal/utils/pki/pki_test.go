@@ -0,0 +1,61 @@
+package pki
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIssueFromCSR(t *testing.T) {
+	caKey, err := GenerateKey()
+	require.NoError(t, err)
+	ca, err := NewCA(caKey, "Test CA", time.Hour)
+	require.NoError(t, err)
+
+	key, err := GenerateKey()
+	require.NoError(t, err)
+	csrPEM, err := CreateCSR(key, "agent")
+	require.NoError(t, err)
+	csr, err := ParseCSR(csrPEM)
+	require.NoError(t, err)
+
+	cert, err := Issue(ca, caKey, csr.PublicKey, LeafTemplate{
+		CommonName: "agent",
+		Hosts:      []string{"edge.example", "10.0.0.5"},
+		Validity:   24 * time.Hour,
+		Server:     true,
+	})
+	require.NoError(t, err)
+	require.True(t, SamePublicKey(cert, key))
+	require.Equal(t, []string{"edge.example"}, cert.DNSNames)
+	require.Len(t, cert.IPAddresses, 1)
+	// Leaves never outlive their CA.
+	require.False(t, cert.NotAfter.After(ca.NotAfter))
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	_, err = cert.Verify(x509.VerifyOptions{Roots: roots, DNSName: "edge.example"})
+	require.NoError(t, err)
+	_, err = cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	require.Error(t, err, "a server-only certificate must not authenticate clients")
+
+	parsed, err := ParseCertificate(EncodeCertificate(cert))
+	require.NoError(t, err)
+	require.Equal(t, Fingerprint(cert), Fingerprint(parsed))
+	require.Equal(t, SerialString(cert.SerialNumber), SerialString(parsed.SerialNumber))
+}
+
+func TestKeyRoundTrip(t *testing.T) {
+	key, err := GenerateKey()
+	require.NoError(t, err)
+	encoded, err := EncodeKey(key)
+	require.NoError(t, err)
+	parsed, err := ParseKey(encoded)
+	require.NoError(t, err)
+	require.True(t, key.Equal(parsed))
+
+	_, err = ParseCSR("not a csr")
+	require.Error(t, err)
+}
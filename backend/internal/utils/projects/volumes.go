@@ -0,0 +1,58 @@
+package projects
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// ComposeVolume is a named volume declared at the top level of a compose file.
+type ComposeVolume struct {
+	// Key is the volume's key under volumes:, which services refer to it by.
+	Key string
+	// Name is the Docker volume the key resolves to for the project.
+	Name     string
+	External bool
+}
+
+// ComposeVolumes lists the named volumes a compose file declares and the Docker volumes they map
+// to for projectName, which must already be normalized: compose prefixes volumes with the project
+// name unless they are external or named explicitly. Variables in names are not interpolated.
+func ComposeVolumes(projectName, composeContent string) ([]ComposeVolume, error) {
+	var doc struct {
+		Volumes map[string]*struct {
+			Name     string `yaml:"name"`
+			External any    `yaml:"external"`
+		} `yaml:"volumes"`
+	}
+	if err := yaml.Unmarshal([]byte(composeContent), &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse compose file: %w", err)
+	}
+
+	volumes := make([]ComposeVolume, 0, len(doc.Volumes))
+	for key, spec := range doc.Volumes {
+		v := ComposeVolume{Key: key, Name: projectName + "_" + key}
+		if spec != nil {
+			switch external := spec.External.(type) {
+			case bool:
+				v.External = external
+			case map[string]any:
+				// The legacy external: {name: ...} form.
+				v.External = true
+				if name, ok := external["name"].(string); ok && spec.Name == "" {
+					spec.Name = name
+				}
+			}
+			if spec.Name != "" {
+				v.Name = spec.Name
+			} else if v.External {
+				v.Name = key
+			}
+		}
+		volumes = append(volumes, v)
+	}
+	slices.SortFunc(volumes, func(a, b ComposeVolume) int { return strings.Compare(a.Key, b.Key) })
+	return volumes, nil
+}
@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/base64"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTotpCode_RFC6238Vectors(t *testing.T) {
+	// RFC 6238 appendix B SHA1 vectors, truncated to six digits.
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		got, err := TotpCode(secret, TotpStep(time.Unix(tt.unix, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, got, "unix time %d", tt.unix)
+	}
+}
+
+func TestValidateTotp(t *testing.T) {
+	secret, err := GenerateTotpSecret()
+	require.NoError(t, err)
+
+	now := time.Now()
+	code, err := TotpCode(secret, TotpStep(now))
+	require.NoError(t, err)
+
+	step, ok := ValidateTotp(secret, code, now)
+	assert.True(t, ok)
+	assert.Equal(t, TotpStep(now), step)
+
+	// Accepted one period later to tolerate drift, rejected two periods later.
+	_, ok = ValidateTotp(secret, code, now.Add(TotpPeriod))
+	assert.True(t, ok)
+	_, ok = ValidateTotp(secret, code, now.Add(3*TotpPeriod))
+	assert.False(t, ok)
+
+	_, ok = ValidateTotp(secret, "12345", now)
+	assert.False(t, ok)
+}
+
+func TestTotpProvisioningURI(t *testing.T) {
+	uri := TotpProvisioningURI("Arcane", "alice", "JBSWY3DPEHPK3PXP")
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Arcane:alice?"))
+	assert.Contains(t, uri, "secret=JBSWY3DPEHPK3PXP")
+	assert.Contains(t, uri, "issuer=Arcane")
+}
+
+func TestTotpQRCode(t *testing.T) {
+	dataURI, err := TotpQRCode(TotpProvisioningURI("Arcane", "alice", "JBSWY3DPEHPK3PXP"))
+	require.NoError(t, err)
+	encoded, ok := strings.CutPrefix(dataURI, "data:image/png;base64,")
+	require.True(t, ok)
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	require.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(raw))
+	require.NoError(t, err)
+	assert.Equal(t, totpQRCodeSize, img.Bounds().Dx())
+}
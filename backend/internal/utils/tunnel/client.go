@@ -0,0 +1,78 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/cenkalti/backoff/v5"
+	"github.com/gorilla/websocket"
+)
+
+// stableAfter is how long a tunnel must stay up before the reconnect backoff starts over.
+const stableAfter = time.Minute
+
+// RunClient keeps a tunnel to url open and serves handler on every stream the peer opens. It
+// reconnects with exponential backoff until ctx is done. header is called for every connection
+// attempt, so credentials changed in the meantime are picked up.
+func RunClient(ctx context.Context, url string, header func() http.Header, handler http.Handler) {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = time.Second
+
+	for {
+		started := time.Now()
+		err := serveOnce(ctx, url, header, handler)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(started) > stableAfter {
+			b.Reset()
+		}
+
+		retryIn := b.NextBackOff()
+		slog.WarnContext(ctx, "Tunnel to manager lost; reconnecting", "url", url, "error", err, "retryIn", retryIn.String())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryIn):
+		}
+	}
+}
+
+func serveOnce(ctx context.Context, url string, header func() http.Header, handler http.Handler) error {
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: 30 * time.Second,
+	}
+	conn, resp, err := dialer.DialContext(ctx, url, header())
+	if resp != nil && resp.Body != nil {
+		_ = resp.Body.Close()
+	}
+	if err != nil {
+		if resp != nil {
+			return fmt.Errorf("dial failed with status %d: %w", resp.StatusCode, err)
+		}
+		return fmt.Errorf("dial failed: %w", err)
+	}
+
+	sess := NewSession(conn, true)
+	defer sess.Close()
+	slog.InfoContext(ctx, "Tunnel to manager established", "url", url)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = sess.Close()
+		case <-sess.Done():
+		}
+	}()
+
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+	_ = srv.Serve(sess)
+	return sess.Err()
+}
@@ -0,0 +1,269 @@
+// Package tunnel multiplexes many bidirectional streams over a single WebSocket so the manager
+// can reach an agent that dialed out to it. Every stream is a net.Conn: the agent serves its
+// regular HTTP router on them, and the manager dials them for proxied HTTP and WebSocket
+// requests, so nothing above the transport needs to know about the tunnel.
+package tunnel
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	frameOpen byte = iota + 1
+	frameData
+	frameWindow
+	frameClose
+)
+
+const (
+	headerSize = 5
+	// maxPayload is the largest data frame sent; larger writes are split.
+	maxPayload = 32 * 1024
+	// initialWindow is how many unread bytes a stream buffers before its sender must wait.
+	initialWindow = 256 * 1024
+	acceptBacklog = 64
+	pingInterval  = 20 * time.Second
+	readTimeout   = 3 * pingInterval
+	writeTimeout  = 10 * time.Second
+)
+
+var (
+	ErrSessionClosed = errors.New("tunnel session closed")
+	// errWindowExceeded ends a session whose peer sent more than the window it was granted.
+	errWindowExceeded = errors.New("tunnel peer exceeded the stream window")
+)
+
+// Session is one end of a tunnel. It implements net.Listener for streams opened by the peer.
+type Session struct {
+	conn *websocket.Conn
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	streams map[uint32]*Stream
+	nextID  uint32
+	closed  bool
+	err     error
+
+	accept    chan *Stream
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewSession starts multiplexing over conn. The dialing side passes client=true; the two sides
+// allocate stream IDs from disjoint ranges so both may open streams.
+func NewSession(conn *websocket.Conn, client bool) *Session {
+	s := &Session{
+		conn:    conn,
+		streams: make(map[uint32]*Stream),
+		nextID:  2,
+		accept:  make(chan *Stream, acceptBacklog),
+		done:    make(chan struct{}),
+	}
+	if client {
+		s.nextID = 1
+	}
+
+	conn.SetReadLimit(headerSize + maxPayload)
+	_ = conn.SetReadDeadline(time.Now().Add(readTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(readTimeout))
+	})
+
+	go s.readLoop()
+	go s.keepalive()
+	return s
+}
+
+// Open opens a new stream to the peer.
+func (s *Session) Open(ctx context.Context) (net.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, ErrSessionClosed
+	}
+	id := s.nextID
+	s.nextID += 2
+	st := newStream(s, id)
+	s.streams[id] = st
+	s.mu.Unlock()
+
+	if err := s.writeFrame(frameOpen, id, nil); err != nil {
+		s.remove(id)
+		return nil, err
+	}
+	return st, nil
+}
+
+// Accept waits for the peer to open a stream.
+func (s *Session) Accept() (net.Conn, error) {
+	select {
+	case st := <-s.accept:
+		return st, nil
+	case <-s.done:
+		return nil, ErrSessionClosed
+	}
+}
+
+// Close closes the session and every stream on it.
+func (s *Session) Close() error {
+	s.closeWithError(ErrSessionClosed)
+	return nil
+}
+
+// Addr returns the local address of the underlying connection.
+func (s *Session) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// RemoteAddr returns the address of the peer.
+func (s *Session) RemoteAddr() net.Addr {
+	return s.conn.RemoteAddr()
+}
+
+// Done is closed when the session ends.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns why the session ended, or nil while it is open.
+func (s *Session) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *Session) closeWithError(err error) {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		s.closed = true
+		s.err = err
+		streams := s.streams
+		s.streams = map[uint32]*Stream{}
+		s.mu.Unlock()
+
+		for _, st := range streams {
+			st.remoteClose()
+		}
+		close(s.done)
+		_ = s.conn.Close()
+	})
+}
+
+func (s *Session) readLoop() {
+	for {
+		messageType, msg, err := s.conn.ReadMessage()
+		if err != nil {
+			s.closeWithError(err)
+			return
+		}
+		_ = s.conn.SetReadDeadline(time.Now().Add(readTimeout))
+		if messageType != websocket.BinaryMessage || len(msg) < headerSize {
+			continue
+		}
+
+		id := binary.BigEndian.Uint32(msg[1:headerSize])
+		payload := msg[headerSize:]
+		switch msg[0] {
+		case frameOpen:
+			s.handleOpen(id)
+		case frameData:
+			if st := s.stream(id); st != nil && !st.receive(payload) {
+				s.closeWithError(errWindowExceeded)
+				return
+			}
+		case frameWindow:
+			if st := s.stream(id); st != nil && len(payload) == 4 {
+				st.grow(binary.BigEndian.Uint32(payload))
+			}
+		case frameClose:
+			if st := s.stream(id); st != nil {
+				st.remoteClose()
+			}
+		}
+	}
+}
+
+func (s *Session) handleOpen(id uint32) {
+	s.mu.Lock()
+	// Streams the peer opens use the other side's ID range.
+	if s.closed || id%2 == s.nextID%2 || s.streams[id] != nil {
+		s.mu.Unlock()
+		return
+	}
+	st := newStream(s, id)
+	s.streams[id] = st
+	s.mu.Unlock()
+
+	select {
+	case s.accept <- st:
+	default:
+		_ = st.Close()
+	}
+}
+
+func (s *Session) keepalive() {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				s.closeWithError(err)
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *Session) writeFrame(frameType byte, id uint32, payload []byte) error {
+	buf := make([]byte, headerSize+len(payload))
+	buf[0] = frameType
+	binary.BigEndian.PutUint32(buf[1:headerSize], id)
+	copy(buf[headerSize:], payload)
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	select {
+	case <-s.done:
+		return ErrSessionClosed
+	default:
+	}
+	_ = s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err := s.conn.WriteMessage(websocket.BinaryMessage, buf); err != nil {
+		s.closeWithError(err)
+		return err
+	}
+	return nil
+}
+
+func (s *Session) sendWindow(id uint32, n int) {
+	var payload [4]byte
+	binary.BigEndian.PutUint32(payload[:], uint32(n)) // #nosec G115 -- n never exceeds initialWindow
+	_ = s.writeFrame(frameWindow, id, payload[:])
+}
+
+func (s *Session) stream(id uint32) *Stream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.streams[id]
+}
+
+func (s *Session) remove(id uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.streams, id)
+}
@@ -0,0 +1,200 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestTunnel connects a client session serving handler to a server session and returns the
+// server side, which opens streams the way the manager does.
+func newTestTunnel(t *testing.T, handler http.Handler) *Session {
+	t.Helper()
+
+	accepted := make(chan *Session, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		sess := NewSession(conn, false)
+		accepted <- sess
+		<-sess.Done()
+	}))
+	t.Cleanup(srv.Close)
+
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+
+	client := NewSession(conn, true)
+	go func() { _ = (&http.Server{Handler: handler, ReadHeaderTimeout: 5 * time.Second}).Serve(client) }()
+	t.Cleanup(func() { _ = client.Close() })
+
+	select {
+	case sess := <-accepted:
+		t.Cleanup(func() { _ = sess.Close() })
+		return sess
+	case <-time.After(5 * time.Second):
+		t.Fatal("tunnel was not accepted")
+		return nil
+	}
+}
+
+func dialThrough(sess *Session) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return sess.Open(ctx)
+	}
+}
+
+func TestSession_HTTPOverTunnel(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(w, r.Body)
+	})
+	mux.HandleFunc("/hello", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello " + r.Header.Get("X-Name")))
+	})
+	sess := newTestTunnel(t, mux)
+
+	client := &http.Client{Transport: &http.Transport{DialContext: dialThrough(sess)}, Timeout: 10 * time.Second}
+
+	req, err := http.NewRequest(http.MethodGet, "http://agent.tunnel/hello", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Name", "arcane")
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, "hello arcane", string(body))
+
+	// Larger than the stream window in both directions, so flow control must release credit.
+	payload := make([]byte, 3*initialWindow+123)
+	_, err = rand.Read(payload)
+	require.NoError(t, err)
+	resp, err = client.Post("http://agent.tunnel/echo", "application/octet-stream", bytes.NewReader(payload))
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(payload, body), "echoed body differs")
+}
+
+func TestSession_WebSocketOverTunnel(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			mt, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(mt, msg); err != nil {
+				return
+			}
+		}
+	})
+	sess := newTestTunnel(t, handler)
+
+	dialer := websocket.Dialer{NetDialContext: dialThrough(sess), HandshakeTimeout: 5 * time.Second}
+	conn, resp, err := dialer.Dial("ws://agent.tunnel/ws", nil)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	defer conn.Close()
+
+	for _, msg := range []string{"first", "second", "third"} {
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(msg)))
+		_, got, err := conn.ReadMessage()
+		require.NoError(t, err)
+		require.Equal(t, msg, string(got))
+	}
+}
+
+func TestSession_CloseEndsStreams(t *testing.T) {
+	block := make(chan struct{})
+	sess := newTestTunnel(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer close(block)
+
+	conn, err := sess.Open(context.Background())
+	require.NoError(t, err)
+
+	require.NoError(t, sess.Close())
+	<-sess.Done()
+
+	_, err = conn.Read(make([]byte, 1))
+	require.ErrorIs(t, err, io.EOF)
+	_, err = sess.Open(context.Background())
+	require.ErrorIs(t, err, ErrSessionClosed)
+}
+
+func TestSession_ClosesWhenPeerIgnoresWindow(t *testing.T) {
+	accepted := make(chan *Session, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		sess := NewSession(conn, false)
+		accepted <- sess
+		<-sess.Done()
+	}))
+	t.Cleanup(srv.Close)
+
+	// The peer speaks the frame format directly and never waits for window updates.
+	peer, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	t.Cleanup(func() { _ = peer.Close() })
+	go func() {
+		for {
+			if _, _, err := peer.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	send := func(frameType byte, payload []byte) error {
+		msg := append([]byte{frameType, 0, 0, 0, 1}, payload...)
+		return peer.WriteMessage(websocket.BinaryMessage, msg)
+	}
+
+	sess := <-accepted
+	require.NoError(t, send(frameOpen, nil))
+	conn, err := sess.Accept()
+	require.NoError(t, err)
+
+	// A full window is buffered, and reading it grants the peer another one.
+	chunk := bytes.Repeat([]byte("x"), maxPayload)
+	for range initialWindow / maxPayload {
+		require.NoError(t, send(frameData, chunk))
+	}
+	_, err = io.ReadFull(conn, make([]byte, initialWindow))
+	require.NoError(t, err)
+
+	for range initialWindow/maxPayload + 1 {
+		if send(frameData, chunk) != nil {
+			break
+		}
+	}
+	select {
+	case <-sess.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("session kept buffering past the window")
+	}
+	require.ErrorIs(t, sess.Err(), errWindowExceeded)
+}
@@ -0,0 +1,215 @@
+package tunnel
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Stream is one multiplexed connection of a Session.
+type Stream struct {
+	id   uint32
+	sess *Session
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+	// unacked counts bytes read but not yet credited back to the peer. Together with buf they
+	// are what the peer sent against the window granted to it, which never exceeds initialWindow.
+	unacked       int
+	window        int
+	localClosed   bool
+	remoteClosed  bool
+	readDeadline  time.Time
+	writeDeadline time.Time
+
+	readReady  chan struct{}
+	writeReady chan struct{}
+}
+
+var _ net.Conn = (*Stream)(nil)
+
+func newStream(sess *Session, id uint32) *Stream {
+	return &Stream{
+		id:         id,
+		sess:       sess,
+		window:     initialWindow,
+		readReady:  make(chan struct{}, 1),
+		writeReady: make(chan struct{}, 1),
+	}
+}
+
+func (st *Stream) Read(p []byte) (int, error) {
+	for {
+		st.mu.Lock()
+		if st.buf.Len() > 0 {
+			n, _ := st.buf.Read(p)
+			// Return credit in batches rather than one frame per read.
+			st.unacked += n
+			ack := 0
+			if st.unacked >= initialWindow/4 || st.buf.Len() == 0 {
+				ack, st.unacked = st.unacked, 0
+			}
+			closed := st.remoteClosed
+			st.mu.Unlock()
+			if ack > 0 && !closed {
+				st.sess.sendWindow(st.id, ack)
+			}
+			return n, nil
+		}
+		if st.localClosed {
+			st.mu.Unlock()
+			return 0, net.ErrClosed
+		}
+		if st.remoteClosed {
+			st.mu.Unlock()
+			return 0, io.EOF
+		}
+		deadline := st.readDeadline
+		st.mu.Unlock()
+
+		if err := wait(st.readReady, deadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (st *Stream) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		st.mu.Lock()
+		if st.localClosed {
+			st.mu.Unlock()
+			return written, net.ErrClosed
+		}
+		if st.remoteClosed {
+			st.mu.Unlock()
+			return written, io.ErrClosedPipe
+		}
+		if st.window == 0 {
+			deadline := st.writeDeadline
+			st.mu.Unlock()
+			if err := wait(st.writeReady, deadline); err != nil {
+				return written, err
+			}
+			continue
+		}
+		n := min(len(p)-written, st.window, maxPayload)
+		st.window -= n
+		st.mu.Unlock()
+
+		if err := st.sess.writeFrame(frameData, st.id, p[written:written+n]); err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return written, nil
+}
+
+// Close closes the stream in both directions. Data still buffered for reading is discarded.
+func (st *Stream) Close() error {
+	st.mu.Lock()
+	if st.localClosed {
+		st.mu.Unlock()
+		return nil
+	}
+	st.localClosed = true
+	remoteClosed := st.remoteClosed
+	st.buf.Reset()
+	st.mu.Unlock()
+	notify(st.readReady)
+	notify(st.writeReady)
+
+	st.sess.remove(st.id)
+	if !remoteClosed {
+		_ = st.sess.writeFrame(frameClose, st.id, nil)
+	}
+	return nil
+}
+
+func (st *Stream) LocalAddr() net.Addr  { return st.sess.conn.LocalAddr() }
+func (st *Stream) RemoteAddr() net.Addr { return st.sess.conn.RemoteAddr() }
+
+func (st *Stream) SetDeadline(t time.Time) error {
+	_ = st.SetReadDeadline(t)
+	return st.SetWriteDeadline(t)
+}
+
+func (st *Stream) SetReadDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.readDeadline = t
+	st.mu.Unlock()
+	notify(st.readReady)
+	return nil
+}
+
+func (st *Stream) SetWriteDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.writeDeadline = t
+	st.mu.Unlock()
+	notify(st.writeReady)
+	return nil
+}
+
+// receive buffers data from the peer. It reports false when the peer sent more than the window
+// granted to it, which a well-behaved peer never does.
+func (st *Stream) receive(p []byte) bool {
+	st.mu.Lock()
+	if st.localClosed {
+		st.mu.Unlock()
+		return true
+	}
+	if st.buf.Len()+st.unacked+len(p) > initialWindow {
+		st.mu.Unlock()
+		return false
+	}
+	st.buf.Write(p)
+	st.mu.Unlock()
+	notify(st.readReady)
+	return true
+}
+
+func (st *Stream) grow(n uint32) {
+	st.mu.Lock()
+	st.window += int(n)
+	st.mu.Unlock()
+	notify(st.writeReady)
+}
+
+func (st *Stream) remoteClose() {
+	st.mu.Lock()
+	st.remoteClosed = true
+	st.mu.Unlock()
+	notify(st.readReady)
+	notify(st.writeReady)
+}
+
+// wait blocks until ch is signalled or the deadline passes. Callers re-check their state after
+// every wake-up, so spurious signals are harmless.
+func wait(ch <-chan struct{}, deadline time.Time) error {
+	if deadline.IsZero() {
+		<-ch
+		return nil
+	}
+	d := time.Until(deadline)
+	if d <= 0 {
+		return os.ErrDeadlineExceeded
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ch:
+		return nil
+	case <-timer.C:
+		return os.ErrDeadlineExceeded
+	}
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,20 @@
+package utils
+
+import (
+	"encoding/base64"
+	"strings"
+)
+
+// DecodeWebauthnBase64 decodes the base64url values browsers produce, tolerating padding and
+// the standard alphabet.
+func DecodeWebauthnBase64(s string) ([]byte, error) {
+	s = strings.TrimRight(strings.TrimSpace(s), "=")
+	if b, err := base64.RawURLEncoding.DecodeString(s); err == nil {
+		return b, nil
+	}
+	return base64.RawStdEncoding.DecodeString(s)
+}
+
+func EncodeWebauthnBase64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -18,6 +18,13 @@ var upgrader = websocket.Upgrader{
 
 // ProxyHTTP upgrades the incoming client connection and bridges it to remoteWS.
 func ProxyHTTP(w http.ResponseWriter, r *http.Request, remoteWS string, header http.Header) error {
+	return ProxyHTTPWithDialer(w, r, remoteWS, header, nil)
+}
+
+// ProxyHTTPWithDialer is ProxyHTTP with a custom dialer for the remote connection, such as one
+// that opens a stream through an agent tunnel or presents a client certificate. A nil dialer
+// dials the network directly.
+func ProxyHTTPWithDialer(w http.ResponseWriter, r *http.Request, remoteWS string, header http.Header, dialer *websocket.Dialer) error {
 	clientConn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		slog.Error("failed to upgrade client connection", "remoteWS", remoteWS, "err", err)
@@ -25,9 +32,11 @@ func ProxyHTTP(w http.ResponseWriter, r *http.Request, remoteWS string, header h
 	}
 	defer clientConn.Close()
 
-	dialer := websocket.Dialer{
-		Proxy:            http.ProxyFromEnvironment,
-		HandshakeTimeout: 45 * time.Second,
+	if dialer == nil {
+		dialer = &websocket.Dialer{
+			Proxy:            http.ProxyFromEnvironment,
+			HandshakeTimeout: 45 * time.Second,
+		}
 	}
 
 	slog.Debug("attempting websocket dial", "remoteWS", remoteWS, "headers", header)
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_environment_access_subject;
+DROP TABLE IF EXISTS environment_access;
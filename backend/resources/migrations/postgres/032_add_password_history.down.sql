@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_user_password_history_user_id;
+DROP TABLE IF EXISTS user_password_history;
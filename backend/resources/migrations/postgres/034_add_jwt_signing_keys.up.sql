@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS jwt_signing_keys (
+    id TEXT PRIMARY KEY,
+    secret TEXT NOT NULL,
+    retired_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_jwt_signing_keys_retired_at ON jwt_signing_keys(retired_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_agent_certificates_environment_id;
+DROP TABLE IF EXISTS agent_certificates;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_environments_access_token_hash;
+ALTER TABLE environments DROP COLUMN previous_access_token_hash;
+ALTER TABLE environments DROP COLUMN access_token_hash;
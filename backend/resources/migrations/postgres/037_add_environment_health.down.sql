@@ -0,0 +1,2 @@
+ALTER TABLE environments DROP COLUMN docker_version;
+ALTER TABLE environments DROP COLUMN latency_ms;
@@ -0,0 +1,4 @@
+ALTER TABLE environments ADD COLUMN group_name TEXT;
+ALTER TABLE environments ADD COLUMN tags TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_environments_group_name ON environments(group_name);
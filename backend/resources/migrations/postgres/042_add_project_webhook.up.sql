@@ -0,0 +1 @@
+ALTER TABLE projects ADD COLUMN webhook_secret TEXT;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS environment_access (
+    id TEXT PRIMARY KEY,
+    environment_id TEXT NOT NULL,
+    subject_type TEXT NOT NULL,
+    subject_id TEXT NOT NULL,
+    access_level TEXT NOT NULL DEFAULT 'read',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME,
+    UNIQUE (environment_id, subject_type, subject_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_environment_access_subject ON environment_access(subject_type, subject_id);
@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN ldap_id TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_ldap_id_unique
+ON users(ldap_id)
+WHERE ldap_id IS NOT NULL;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS agent_certificates (
+    id TEXT PRIMARY KEY,
+    environment_id TEXT NOT NULL,
+    serial_number TEXT NOT NULL UNIQUE,
+    fingerprint TEXT NOT NULL,
+    certificate TEXT NOT NULL,
+    not_after DATETIME NOT NULL,
+    activated_at DATETIME,
+    revoked_at DATETIME,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_agent_certificates_environment_id ON agent_certificates(environment_id);
@@ -0,0 +1,4 @@
+ALTER TABLE environments ADD COLUMN access_token_hash TEXT;
+ALTER TABLE environments ADD COLUMN previous_access_token_hash TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_environments_access_token_hash ON environments(access_token_hash);
@@ -0,0 +1,2 @@
+ALTER TABLE environments ADD COLUMN latency_ms INTEGER;
+ALTER TABLE environments ADD COLUMN docker_version TEXT;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_environments_group_name;
+ALTER TABLE environments DROP COLUMN tags;
+ALTER TABLE environments DROP COLUMN group_name;
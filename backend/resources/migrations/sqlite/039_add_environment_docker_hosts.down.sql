@@ -0,0 +1,6 @@
+ALTER TABLE environments DROP COLUMN tls_key;
+ALTER TABLE environments DROP COLUMN tls_cert;
+ALTER TABLE environments DROP COLUMN tls_ca_cert;
+ALTER TABLE environments DROP COLUMN ssh_host_key;
+ALTER TABLE environments DROP COLUMN ssh_private_key;
+ALTER TABLE environments DROP COLUMN type;
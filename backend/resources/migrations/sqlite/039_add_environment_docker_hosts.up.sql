@@ -0,0 +1,6 @@
+ALTER TABLE environments ADD COLUMN type TEXT NOT NULL DEFAULT 'agent';
+ALTER TABLE environments ADD COLUMN ssh_private_key TEXT;
+ALTER TABLE environments ADD COLUMN ssh_host_key TEXT;
+ALTER TABLE environments ADD COLUMN tls_ca_cert TEXT;
+ALTER TABLE environments ADD COLUMN tls_cert TEXT;
+ALTER TABLE environments ADD COLUMN tls_key TEXT;
@@ -0,0 +1,5 @@
+ALTER TABLE environments DROP COLUMN prune_mode;
+ALTER TABLE environments DROP COLUMN auto_update_interval;
+ALTER TABLE environments DROP COLUMN auto_update;
+ALTER TABLE environments DROP COLUMN polling_interval;
+ALTER TABLE environments DROP COLUMN polling_enabled;
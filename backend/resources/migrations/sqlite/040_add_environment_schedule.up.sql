@@ -0,0 +1,5 @@
+ALTER TABLE environments ADD COLUMN polling_enabled BOOLEAN;
+ALTER TABLE environments ADD COLUMN polling_interval INTEGER;
+ALTER TABLE environments ADD COLUMN auto_update BOOLEAN;
+ALTER TABLE environments ADD COLUMN auto_update_interval INTEGER;
+ALTER TABLE environments ADD COLUMN prune_mode TEXT;
@@ -0,0 +1,12 @@
+ALTER TABLE projects DROP COLUMN git_sync_error;
+ALTER TABLE projects DROP COLUMN git_synced_at;
+ALTER TABLE projects DROP COLUMN git_deployed_commit;
+ALTER TABLE projects DROP COLUMN git_commit;
+ALTER TABLE projects DROP COLUMN git_sync_interval;
+ALTER TABLE projects DROP COLUMN git_auto_deploy;
+ALTER TABLE projects DROP COLUMN git_auto_sync;
+ALTER TABLE projects DROP COLUMN git_credential;
+ALTER TABLE projects DROP COLUMN git_username;
+ALTER TABLE projects DROP COLUMN git_sub_path;
+ALTER TABLE projects DROP COLUMN git_branch;
+ALTER TABLE projects DROP COLUMN git_repository_url;
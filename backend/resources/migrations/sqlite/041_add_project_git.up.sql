@@ -0,0 +1,12 @@
+ALTER TABLE projects ADD COLUMN git_repository_url TEXT;
+ALTER TABLE projects ADD COLUMN git_branch TEXT;
+ALTER TABLE projects ADD COLUMN git_sub_path TEXT;
+ALTER TABLE projects ADD COLUMN git_username TEXT;
+ALTER TABLE projects ADD COLUMN git_credential TEXT;
+ALTER TABLE projects ADD COLUMN git_auto_sync BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE projects ADD COLUMN git_auto_deploy BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE projects ADD COLUMN git_sync_interval INTEGER;
+ALTER TABLE projects ADD COLUMN git_commit TEXT;
+ALTER TABLE projects ADD COLUMN git_deployed_commit TEXT;
+ALTER TABLE projects ADD COLUMN git_synced_at DATETIME;
+ALTER TABLE projects ADD COLUMN git_sync_error TEXT;